@@ -0,0 +1,96 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "utils/memutils.h"
+
+extern void plgo_aggregate_release(uint64 handle);
+extern Datum get_arg(FunctionCallInfo fcinfo, unsigned int i);
+extern bool arg_is_null(FunctionCallInfo fcinfo, unsigned int i);
+
+static void plgo_aggregate_reset(void *arg) {
+	plgo_aggregate_release((uint64) (uintptr_t) arg);
+}
+
+//plgo_aggregate_register releases the state handle when the aggregate context is reset,
+//it returns 0 if the function isn't called as an aggregate
+int plgo_aggregate_register(FunctionCallInfo fcinfo, uint64 handle) {
+	MemoryContext aggcontext;
+	MemoryContextCallback *callback;
+
+	if (!AggCheckCallContext(fcinfo, &aggcontext))
+		return 0;
+	callback = MemoryContextAlloc(aggcontext, sizeof(MemoryContextCallback));
+	callback->func = plgo_aggregate_reset;
+	callback->arg = (void *) (uintptr_t) handle;
+	MemoryContextRegisterResetCallback(aggcontext, callback);
+	return 1;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+//aggregateStates are the states of the running aggregates by their handles,
+//the handle is the internal state value of the aggregate in PostgreSQL
+var (
+	aggregateMu     sync.Mutex
+	aggregateStates = make(map[uint64]interface{})
+	aggregateHandle uint64
+)
+
+//aggregateState returns the state of the aggregate, the first argument of its transition function,
+//and its handle returned as the new state. The first call creates the state with newState,
+//it is released with the memory context of the aggregate
+func aggregateState(fcinfo *funcInfo, name string, newState func() interface{}) (Datum, interface{}) {
+	cfcinfo := (*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo))
+	if C.arg_is_null(cfcinfo, 0) == (C._Bool)(false) {
+		handle := uint64(C.get_arg(cfcinfo, 0))
+		aggregateMu.Lock()
+		state, ok := aggregateStates[handle]
+		aggregateMu.Unlock()
+		if !ok {
+			Log.Error(fmt.Sprintf("Aggregate %s: state %d not found", name, handle))
+		}
+		return Datum(handle), state
+	}
+	state := newState()
+	aggregateMu.Lock()
+	aggregateHandle++
+	handle := aggregateHandle
+	aggregateStates[handle] = state
+	aggregateMu.Unlock()
+	if C.plgo_aggregate_register(cfcinfo, C.uint64(handle)) == 0 {
+		releaseAggregate(handle)
+		Log.Error(fmt.Sprintf("Aggregate %s: the transition function is called outside of an aggregate", name))
+	}
+	return Datum(handle), state
+}
+
+//finalState returns the state of the aggregate passed to its final function,
+//the aggregate of no rows has the state created by newState
+func finalState(fcinfo *funcInfo, name string, newState func() interface{}) interface{} {
+	cfcinfo := (*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo))
+	if C.arg_is_null(cfcinfo, 0) == (C._Bool)(true) {
+		return newState()
+	}
+	handle := uint64(C.get_arg(cfcinfo, 0))
+	aggregateMu.Lock()
+	state, ok := aggregateStates[handle]
+	aggregateMu.Unlock()
+	if !ok {
+		Log.Error(fmt.Sprintf("Aggregate %s: state %d not found", name, handle))
+	}
+	return state
+}
+
+//releaseAggregate forgets the state of the finished aggregate
+func releaseAggregate(handle uint64) {
+	aggregateMu.Lock()
+	delete(aggregateStates, handle)
+	aggregateMu.Unlock()
+}
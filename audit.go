@@ -0,0 +1,42 @@
+package plgo
+
+//QueryInfo describes an query executed through a Stmt
+type QueryInfo struct {
+	//Query is the SQL text of the prepared statement
+	Query string
+	//Args are the query parameters
+	Args []interface{}
+	//Function is the name of the exported function running the query, empty outside of an function call
+	Function string
+}
+
+//QueryHook is called before every query executed through a Stmt,
+//an returned error rejects the query
+type QueryHook func(info QueryInfo) error
+
+var queryHooks []QueryHook
+
+//AddQueryHook registers an hook that is called before every query executed through a Stmt,
+//e.g. to log all database access of the extension or to enforce an allow-list of queries.
+//If the hook returns an error, the query is not executed and Query, QueryRow or Exec returns the error.
+//It should be called from an init() function of the package
+func AddQueryHook(hook QueryHook) {
+	queryHooks = append(queryHooks, hook)
+}
+
+//auditQuery runs the query hooks
+func auditQuery(q *queryCall) error {
+	if len(queryHooks) == 0 {
+		return nil
+	}
+	info := QueryInfo{Query: q.query, Args: q.args}
+	if call := currentCall(); call != nil {
+		info.Function = call.name
+	}
+	for _, hook := range queryHooks {
+		if err := hook(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,400 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "catalog/pg_type.h"
+#include "miscadmin.h"
+#include "datatype/timestamp.h"
+#include "storage/ipc.h"
+#include "storage/lwlock.h"
+#include "storage/shmem.h"
+#include "utils/dsa.h"
+#include "utils/memutils.h"
+#include "utils/timestamp.h"
+#include "lib/dshash.h"
+
+#define PLGO_CACHE_KEYLEN 128
+
+extern void *plgo_shmem_init_struct(char *name, Size size, bool *found);
+
+typedef struct plgo_cache_entry {
+	char key[PLGO_CACHE_KEYLEN];
+	dsa_pointer node;
+} plgo_cache_entry;
+
+// plgo_cache_node is an item of the LRU list, the head is the most recently used item
+typedef struct plgo_cache_node {
+	char key[PLGO_CACHE_KEYLEN];
+	dsa_pointer value;
+	Size value_len;
+	// expires is 0 for the items without TTL
+	TimestampTz expires;
+	dsa_pointer prev;
+	dsa_pointer next;
+} plgo_cache_node;
+
+typedef struct plgo_cache_control {
+	bool initialized;
+	int refcount;
+	int tranche_id;
+	// lock protects the LRU list and the counters, it's taken before the dshash partition locks
+	LWLock lock;
+	dsa_handle area;
+	dshash_table_handle table;
+	dsa_pointer head;
+	dsa_pointer tail;
+	int64 entries;
+	int64 size;
+	int64 hits;
+	int64 misses;
+	int64 evictions;
+} plgo_cache_control;
+
+typedef struct plgo_cache {
+	plgo_cache_control *control;
+	dsa_area *area;
+	dshash_table *table;
+} plgo_cache;
+
+typedef struct plgo_cache_stats {
+	int64 entries;
+	int64 size;
+	int64 hits;
+	int64 misses;
+	int64 evictions;
+} plgo_cache_stats;
+
+static void plgo_cache_params(dshash_parameters *params, int tranche_id) {
+	MemSet(params, 0, sizeof(dshash_parameters));
+	params->key_size = PLGO_CACHE_KEYLEN;
+	params->entry_size = sizeof(plgo_cache_entry);
+	params->compare_function = dshash_memcmp;
+	params->hash_function = dshash_memhash;
+#if PG_VERSION_NUM >= 170000
+	params->copy_function = dshash_memcpy;
+#endif
+	params->tranche_id = tranche_id;
+}
+
+static void plgo_cache_detach(int code, Datum arg) {
+	plgo_cache_control *control = (plgo_cache_control *) DatumGetPointer(arg);
+	LWLockAcquire(AddinShmemInitLock, LW_EXCLUSIVE);
+	if (--control->refcount == 0)
+		control->initialized = false;
+	LWLockRelease(AddinShmemInitLock);
+}
+
+plgo_cache *plgo_cache_attach(char *shmem_name) {
+	bool found;
+	dshash_parameters params;
+	plgo_cache_control *control;
+	plgo_cache *cache;
+	MemoryContext old = MemoryContextSwitchTo(TopMemoryContext);
+
+	cache = palloc0(sizeof(plgo_cache));
+	LWLockAcquire(AddinShmemInitLock, LW_EXCLUSIVE);
+	control = plgo_shmem_init_struct(shmem_name, sizeof(plgo_cache_control), &found);
+	if (!found) {
+		control->initialized = false;
+		control->refcount = 0;
+		control->tranche_id = LWLockNewTrancheId();
+		LWLockInitialize(&control->lock, control->tranche_id);
+	}
+	LWLockRegisterTranche(control->tranche_id, "plgo_cache");
+	plgo_cache_params(&params, control->tranche_id);
+	if (!control->initialized) {
+		cache->area = dsa_create(control->tranche_id);
+		cache->table = dshash_create(cache->area, &params, NULL);
+		control->area = dsa_get_handle(cache->area);
+		control->table = dshash_get_hash_table_handle(cache->table);
+		control->head = InvalidDsaPointer;
+		control->tail = InvalidDsaPointer;
+		control->entries = 0;
+		control->size = 0;
+		control->hits = 0;
+		control->misses = 0;
+		control->evictions = 0;
+		control->initialized = true;
+	} else {
+		cache->area = dsa_attach(control->area);
+		cache->table = dshash_attach(cache->area, &params, control->table, NULL);
+	}
+	dsa_pin_mapping(cache->area);
+	control->refcount++;
+	cache->control = control;
+	LWLockRelease(AddinShmemInitLock);
+	before_shmem_exit(plgo_cache_detach, PointerGetDatum(control));
+	MemoryContextSwitchTo(old);
+	return cache;
+}
+
+static plgo_cache_node *plgo_cache_node_at(plgo_cache *cache, dsa_pointer dp) {
+	return (plgo_cache_node *) dsa_get_address(cache->area, dp);
+}
+
+static void plgo_cache_unlink(plgo_cache *cache, dsa_pointer dp) {
+	plgo_cache_node *node = plgo_cache_node_at(cache, dp);
+	if (DsaPointerIsValid(node->prev))
+		plgo_cache_node_at(cache, node->prev)->next = node->next;
+	else
+		cache->control->head = node->next;
+	if (DsaPointerIsValid(node->next))
+		plgo_cache_node_at(cache, node->next)->prev = node->prev;
+	else
+		cache->control->tail = node->prev;
+	node->prev = InvalidDsaPointer;
+	node->next = InvalidDsaPointer;
+}
+
+static void plgo_cache_push_front(plgo_cache *cache, dsa_pointer dp) {
+	plgo_cache_node *node = plgo_cache_node_at(cache, dp);
+	node->prev = InvalidDsaPointer;
+	node->next = cache->control->head;
+	if (DsaPointerIsValid(node->next))
+		plgo_cache_node_at(cache, node->next)->prev = dp;
+	else
+		cache->control->tail = dp;
+	cache->control->head = dp;
+}
+
+// plgo_cache_remove removes the item, the caller holds the cache lock and no dshash lock
+static void plgo_cache_remove(plgo_cache *cache, dsa_pointer dp) {
+	plgo_cache_node *node = plgo_cache_node_at(cache, dp);
+	plgo_cache_unlink(cache, dp);
+	dshash_delete_key(cache->table, node->key);
+	cache->control->size -= sizeof(plgo_cache_node) + node->value_len;
+	cache->control->entries--;
+	if (DsaPointerIsValid(node->value))
+		dsa_free(cache->area, node->value);
+	dsa_free(cache->area, dp);
+}
+
+static dsa_pointer plgo_cache_lookup(plgo_cache *cache, char *key) {
+	char keybuf[PLGO_CACHE_KEYLEN];
+	plgo_cache_entry *entry;
+	dsa_pointer dp = InvalidDsaPointer;
+	MemSet(keybuf, 0, PLGO_CACHE_KEYLEN);
+	strlcpy(keybuf, key, PLGO_CACHE_KEYLEN);
+	entry = dshash_find(cache->table, keybuf, false);
+	if (entry != NULL) {
+		dp = entry->node;
+		dshash_release_lock(cache->table, entry);
+	}
+	return dp;
+}
+
+// plgo_cache_get returns palloc'd copy of the value, or NULL if the key isn't cached or is expired
+void *plgo_cache_get(plgo_cache *cache, char *key, Size *len) {
+	dsa_pointer dp;
+	plgo_cache_node *node;
+	void *value = NULL;
+	LWLockAcquire(&cache->control->lock, LW_EXCLUSIVE);
+	dp = plgo_cache_lookup(cache, key);
+	if (DsaPointerIsValid(dp)) {
+		node = plgo_cache_node_at(cache, dp);
+		if (node->expires != 0 && node->expires <= GetCurrentTimestamp()) {
+			plgo_cache_remove(cache, dp);
+		} else {
+			plgo_cache_unlink(cache, dp);
+			plgo_cache_push_front(cache, dp);
+			*len = node->value_len;
+			value = palloc(node->value_len > 0 ? node->value_len : 1);
+			memcpy(value, dsa_get_address(cache->area, node->value), node->value_len);
+		}
+	}
+	if (value != NULL)
+		cache->control->hits++;
+	else
+		cache->control->misses++;
+	LWLockRelease(&cache->control->lock);
+	return value;
+}
+
+// plgo_cache_put stores the value and evicts the least recently used items above max_size,
+// returns false if the value alone doesn't fit
+bool plgo_cache_put(plgo_cache *cache, char *key, void *value, Size len, int64 ttl_usecs, int64 max_size) {
+	char keybuf[PLGO_CACHE_KEYLEN];
+	plgo_cache_entry *entry;
+	plgo_cache_node *node;
+	dsa_pointer dp;
+	bool found;
+	if ((int64) (sizeof(plgo_cache_node) + len) > max_size)
+		return false;
+	MemSet(keybuf, 0, PLGO_CACHE_KEYLEN);
+	strlcpy(keybuf, key, PLGO_CACHE_KEYLEN);
+	LWLockAcquire(&cache->control->lock, LW_EXCLUSIVE);
+	entry = dshash_find_or_insert(cache->table, keybuf, &found);
+	if (found) {
+		dp = entry->node;
+		node = plgo_cache_node_at(cache, dp);
+		plgo_cache_unlink(cache, dp);
+		cache->control->size -= node->value_len;
+		dsa_free(cache->area, node->value);
+	} else {
+		dp = dsa_allocate0(cache->area, sizeof(plgo_cache_node));
+		node = plgo_cache_node_at(cache, dp);
+		memcpy(node->key, keybuf, PLGO_CACHE_KEYLEN);
+		entry->node = dp;
+		cache->control->size += sizeof(plgo_cache_node);
+		cache->control->entries++;
+	}
+	dshash_release_lock(cache->table, entry);
+	node->value = dsa_allocate(cache->area, len > 0 ? len : 1);
+	memcpy(dsa_get_address(cache->area, node->value), value, len);
+	node->value_len = len;
+	node->expires = ttl_usecs > 0 ? GetCurrentTimestamp() + ttl_usecs : 0;
+	cache->control->size += len;
+	plgo_cache_push_front(cache, dp);
+	while (cache->control->size > max_size && cache->control->tail != dp) {
+		plgo_cache_remove(cache, cache->control->tail);
+		cache->control->evictions++;
+	}
+	LWLockRelease(&cache->control->lock);
+	return true;
+}
+
+bool plgo_cache_delete(plgo_cache *cache, char *key) {
+	dsa_pointer dp;
+	LWLockAcquire(&cache->control->lock, LW_EXCLUSIVE);
+	dp = plgo_cache_lookup(cache, key);
+	if (DsaPointerIsValid(dp))
+		plgo_cache_remove(cache, dp);
+	LWLockRelease(&cache->control->lock);
+	return DsaPointerIsValid(dp);
+}
+
+plgo_cache_stats plgo_cache_get_stats(plgo_cache *cache) {
+	plgo_cache_stats stats;
+	LWLockAcquire(&cache->control->lock, LW_SHARED);
+	stats.entries = cache->control->entries;
+	stats.size = cache->control->size;
+	stats.hits = cache->control->hits;
+	stats.misses = cache->control->misses;
+	stats.evictions = cache->control->evictions;
+	LWLockRelease(&cache->control->lock);
+	return stats;
+}
+
+bool plgo_cache_arg_null(FunctionCallInfo fcinfo, int i) {
+	return i >= PG_NARGS() || PG_ARGISNULL(i);
+}
+
+int64 plgo_cache_arg_interval_usecs(FunctionCallInfo fcinfo, int i) {
+	Interval *interval = PG_GETARG_INTERVAL_P(i);
+	return interval->time + ((int64) interval->month * DAYS_PER_MONTH + interval->day) * USECS_PER_DAY;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"math"
+	"time"
+	"unsafe"
+)
+
+//cacheKeyLen is the maximum length of an cache key (including the terminating zero byte)
+const cacheKeyLen = 128
+
+//cacheSize is <extension>.cache_size
+var cacheSize = newIntGUC(gucDesc{
+	name:      "cache_size",
+	shortDesc: "Sets the maximum size of the shared cache of the extension.",
+	context:   gucSighup,
+	flags:     gucUnitKB,
+}, 16*1024, 64, math.MaxInt32)
+
+//Cache is the LRU cache of the extension in shared memory, that is visible to all backends.
+//The least recently used items are evicted when the cache is larger than <extension>.cache_size.
+//Like the shared areas, the cache lives until the last attached backend exits
+type Cache struct {
+	c *C.plgo_cache
+}
+
+//CacheStats are the counters of the shared cache
+type CacheStats struct {
+	Entries   int64 `json:"entries"`
+	Size      int64 `json:"size"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+var sharedCache *Cache
+
+//SharedCache attaches to the shared cache of the extension, it creates the cache if it doesn't exist yet.
+//It raises an ERROR if the name of the extension is too long for the shared memory index
+func SharedCache() *Cache {
+	if sharedCache == nil {
+		cname, err := shmemName("plgo cache ", extensionName)
+		if err != nil {
+			Log.Error(err.Error())
+			return nil
+		}
+		defer C.free(unsafe.Pointer(cname))
+		sharedCache = &Cache{c: C.plgo_cache_attach(cname)}
+	}
+	return sharedCache
+}
+
+func cacheKey(key string) (*C.char, error) {
+	if len(key) == 0 || len(key) >= cacheKeyLen {
+		return nil, fmt.Errorf("Cache key must be 1 to %d bytes long: %q", cacheKeyLen-1, key)
+	}
+	return C.CString(key), nil
+}
+
+//Get returns a copy of the cached value, ok is false if the key isn't cached or its TTL expired
+func (c *Cache) Get(key string) (value []byte, ok bool, err error) {
+	ckey, err := cacheKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	defer C.free(unsafe.Pointer(ckey))
+	var length C.Size
+	cvalue := C.plgo_cache_get(c.c, ckey, &length)
+	if cvalue == nil {
+		return nil, false, nil
+	}
+	defer C.pfree(cvalue)
+	return C.GoBytes(cvalue, C.int(length)), true, nil
+}
+
+//Put stores the value under the key, the value expires after the ttl (0 means no expiration).
+//It returns false if the value is larger than the cache
+func (c *Cache) Put(key string, value []byte, ttl time.Duration) (bool, error) {
+	ckey, err := cacheKey(key)
+	if err != nil {
+		return false, err
+	}
+	defer C.free(unsafe.Pointer(ckey))
+	var p unsafe.Pointer
+	if len(value) > 0 {
+		p = C.CBytes(value)
+		defer C.free(p)
+	}
+	maxSize := C.int64(cacheSize.get()) * 1024
+	return C.plgo_cache_put(c.c, ckey, p, C.Size(len(value)), C.int64(ttl/time.Microsecond), maxSize) == (C._Bool)(true), nil
+}
+
+//Delete removes the key from the cache, returns false if it wasn't cached
+func (c *Cache) Delete(key string) (bool, error) {
+	ckey, err := cacheKey(key)
+	if err != nil {
+		return false, err
+	}
+	defer C.free(unsafe.Pointer(ckey))
+	return C.plgo_cache_delete(c.c, ckey) == (C._Bool)(true), nil
+}
+
+//Stats returns the counters of the cache
+func (c *Cache) Stats() CacheStats {
+	stats := C.plgo_cache_get_stats(c.c)
+	return CacheStats{
+		Entries:   int64(stats.entries),
+		Size:      int64(stats.size),
+		Hits:      int64(stats.hits),
+		Misses:    int64(stats.misses),
+		Evictions: int64(stats.evictions),
+	}
+}
@@ -0,0 +1,103 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "catalog/pg_type.h"
+
+bool plgo_cache_arg_null(FunctionCallInfo fcinfo, int i);
+int64 plgo_cache_arg_interval_usecs(FunctionCallInfo fcinfo, int i);
+*/
+import "C"
+import (
+	"encoding/json"
+	"time"
+	"unsafe"
+)
+
+//cfcinfo returns the C pointer of the call info
+func (fcinfo *funcInfo) cfcinfo() C.FunctionCallInfo {
+	return (C.FunctionCallInfo)(unsafe.Pointer(fcinfo))
+}
+
+//cacheGet reads the key argument and returns the cached value
+func cacheGet(fcinfo *funcInfo) ([]byte, bool) {
+	var key string
+	if err := fcinfo.Scan(&key); err != nil {
+		Log.Error(err.Error())
+	}
+	value, ok, err := SharedCache().Get(key)
+	if err != nil {
+		Log.Error(err.Error())
+	}
+	if !ok {
+		fcinfo.isnull = (C._Bool)(true)
+	}
+	return value, ok
+}
+
+//export plgo_cache_get_bytea
+func plgo_cache_get_bytea(fcinfo *funcInfo) Datum {
+	value, ok := cacheGet(fcinfo)
+	if !ok {
+		return toDatum(nil)
+	}
+	return toDatum(value)
+}
+
+//export plgo_cache_get_jsonb
+func plgo_cache_get_jsonb(fcinfo *funcInfo) Datum {
+	value, ok := cacheGet(fcinfo)
+	if !ok {
+		return toDatum(nil)
+	}
+	return jsonbDatum(json.RawMessage(value))
+}
+
+//export plgo_cache_store
+func plgo_cache_store(fcinfo *funcInfo) Datum {
+	cfcinfo := fcinfo.cfcinfo()
+	if C.plgo_cache_arg_null(cfcinfo, 0) == (C._Bool)(true) || C.plgo_cache_arg_null(cfcinfo, 1) == (C._Bool)(true) {
+		return toDatum(false)
+	}
+	var key string
+	var value []byte
+	var err error
+	if C.get_call_expr_argtype(fcinfo.flinfo.fn_expr, 1) == C.BYTEAOID {
+		err = fcinfo.Scan(&key, &value)
+	} else {
+		var raw json.RawMessage
+		err = fcinfo.Scan(&key, &raw)
+		value = raw
+	}
+	if err != nil {
+		Log.Error(err.Error())
+	}
+	var ttl time.Duration
+	if C.plgo_cache_arg_null(cfcinfo, 2) != (C._Bool)(true) {
+		ttl = time.Duration(C.plgo_cache_arg_interval_usecs(cfcinfo, 2)) * time.Microsecond
+	}
+	stored, err := SharedCache().Put(key, value, ttl)
+	if err != nil {
+		Log.Error(err.Error())
+	}
+	return toDatum(stored)
+}
+
+//export plgo_cache_remove_key
+func plgo_cache_remove_key(fcinfo *funcInfo) Datum {
+	var key string
+	if err := fcinfo.Scan(&key); err != nil {
+		Log.Error(err.Error())
+	}
+	deleted, err := SharedCache().Delete(key)
+	if err != nil {
+		Log.Error(err.Error())
+	}
+	return toDatum(deleted)
+}
+
+//export plgo_cache_counters
+func plgo_cache_counters(fcinfo *funcInfo) Datum {
+	return jsonbDatum(SharedCache().Stats())
+}
@@ -0,0 +1,221 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "access/xact.h"
+
+extern Datum jsonb_to_datum(char* val);
+*/
+import "C"
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+//funcCall is the state of an running call of an exported function
+type funcCall struct {
+	id       uint64
+	name     string
+	start    time.Time
+	subID    uint32
+	rows     int64
+	counters map[string]int64
+	span     *span
+	//aborted is the time when the call was interrupted by an ERROR
+	aborted time.Time
+	//deadline is the time set by SetDeadline, zero if the call has no deadline
+	deadline time.Time
+	//traced is true when the call is logged by <extension>.trace, result is its logged result
+	traced bool
+	result string
+	//nonatomic is true for the procedures called by CALL outside of an transaction block
+	nonatomic bool
+}
+
+//lastCallID is the id of the last call in the backend
+var lastCallID uint64
+
+//callStack holds the running calls, the last one is the innermost call
+//(exported functions can call each other through SPI)
+var callStack []*funcCall
+
+//beginCall is called by the generated wrappers at the start of every exported function,
+//the returned call must be ended with end
+func beginCall(fcinfo *funcInfo, name string) *funcCall {
+	if len(pendingErrors) > 0 {
+		flushPendingErrors()
+	}
+	enterRestricted()
+	lastCallID++
+	call := &funcCall{
+		id:     lastCallID,
+		name:   name,
+		start:  time.Now(),
+		subID:  currentSubTransactionID(),
+		span:   startCallSpan(name, int(fcinfo.nargs)),
+		traced: traceCalls.get(),
+	}
+	callStack = append(callStack, call)
+	CheckTimers()
+	return call
+}
+
+//end finishes the call and records its statistics,
+//it must be deferred directly, so it can recover panics of the function
+func (call *funcCall) end() {
+	if r := recover(); r != nil {
+		//raises ERROR, the call is then cleaned up by the abort handler
+		handlePanic(call, r)
+	}
+	if call.traced {
+		//logged before the call is removed from the stack, so the line has its function and call id
+		call.traceEnd(time.Since(call.start))
+	}
+	for i := len(callStack) - 1; i >= 0; i-- {
+		if callStack[i] == call {
+			callStack = callStack[:i]
+			break
+		}
+	}
+	call.endDeadline()
+	call.span.finish(nil)
+	duration := time.Since(call.start)
+	explainStats.record(call, duration)
+	recordStat(call, duration, false)
+}
+
+//currentSubTransactionID returns the id of the current (sub)transaction
+func currentSubTransactionID() uint32 {
+	return uint32(C.GetCurrentSubTransactionId())
+}
+
+//currentCall returns the innermost running call, or nil if no exported function is running
+func currentCall() *funcCall {
+	if len(callStack) == 0 {
+		return nil
+	}
+	return callStack[len(callStack)-1]
+}
+
+func init() {
+	//calls interrupted by an ERROR never call end, drop them from the stack
+	onAbort(func(subID uint32) {
+		for i, call := range callStack {
+			if subID == 0 || call.subID >= subID {
+				now := time.Now()
+				for _, aborted := range callStack[i:] {
+					aborted.aborted = now
+					pendingErrors = append(pendingErrors, aborted)
+				}
+				callStack = callStack[:i]
+				return
+			}
+		}
+	})
+}
+
+//AddRows adds n to the rows counter of the currently running exported function,
+//the rows are reported by the <extension>_explain() function
+func AddRows(n int64) {
+	if call := currentCall(); call != nil {
+		call.rows += n
+	}
+}
+
+//AddCounter adds delta to the named counter of the currently running exported function,
+//the counters are reported by the <extension>_explain() function
+func AddCounter(name string, delta int64) {
+	call := currentCall()
+	if call == nil {
+		return
+	}
+	if call.counters == nil {
+		call.counters = make(map[string]int64)
+	}
+	call.counters[name] += delta
+}
+
+//funcExplain are the instrumentation data of one exported function in the current backend
+type funcExplain struct {
+	Function  string           `json:"function"`
+	Calls     int64            `json:"calls"`
+	TotalTime float64          `json:"total_time_ms"`
+	MaxTime   float64          `json:"max_time_ms"`
+	MeanTime  float64          `json:"mean_time_ms"`
+	Rows      int64            `json:"rows"`
+	Counters  map[string]int64 `json:"counters,omitempty"`
+}
+
+type explainCollector struct {
+	sync.Mutex
+	funcs map[string]*funcExplain
+}
+
+var explainStats = &explainCollector{funcs: make(map[string]*funcExplain)}
+
+func (e *explainCollector) record(call *funcCall, duration time.Duration) {
+	e.Lock()
+	defer e.Unlock()
+	f, ok := e.funcs[call.name]
+	if !ok {
+		f = &funcExplain{Function: call.name}
+		e.funcs[call.name] = f
+	}
+	ms := float64(duration) / float64(time.Millisecond)
+	f.Calls++
+	f.TotalTime += ms
+	if ms > f.MaxTime {
+		f.MaxTime = ms
+	}
+	f.MeanTime = f.TotalTime / float64(f.Calls)
+	f.Rows += call.rows
+	for name, delta := range call.counters {
+		if f.Counters == nil {
+			f.Counters = make(map[string]int64)
+		}
+		f.Counters[name] += delta
+	}
+}
+
+func (e *explainCollector) list() []funcExplain {
+	e.Lock()
+	defer e.Unlock()
+	list := make([]funcExplain, 0, len(e.funcs))
+	for _, f := range e.funcs {
+		list = append(list, *f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Function < list[j].Function })
+	return list
+}
+
+func (e *explainCollector) reset() {
+	e.Lock()
+	defer e.Unlock()
+	e.funcs = make(map[string]*funcExplain)
+}
+
+//jsonbDatum returns val marshaled as jsonb datum
+func jsonbDatum(val interface{}) Datum {
+	data, err := json.Marshal(val)
+	if err != nil {
+		data = []byte("null")
+	}
+	cjson := C.CString(string(data))
+	defer C.free(unsafe.Pointer(cjson))
+	return (Datum)(C.jsonb_to_datum(cjson))
+}
+
+//export plgo_explain
+func plgo_explain(fcinfo *funcInfo) Datum {
+	return jsonbDatum(explainStats.list())
+}
+
+//export plgo_explain_reset
+func plgo_explain_reset(fcinfo *funcInfo) Datum {
+	explainStats.reset()
+	return toDatum(nil)
+}
@@ -0,0 +1,89 @@
+package plgo
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+	"unicode/utf8"
+)
+
+//traceCalls is <extension>.trace, the calls of the exported functions are logged at DEBUG1,
+//regardless of <extension>.log_level (log_min_messages and client_min_messages still apply)
+var traceCalls = newBoolGUC(gucDesc{
+	name:      "trace",
+	shortDesc: "Logs the calls of the exported functions with their arguments, duration and result at DEBUG1.",
+	longDesc:  "The values are passed through the redactor set with SetTraceRedactor and the secrets are hidden.",
+	context:   gucSuset,
+}, false)
+
+//maxTraceValue is the maximum length of an logged argument or result
+const maxTraceValue = 200
+
+//TraceRedactor returns the value written to the trace for the argument or the result ("result") of the function,
+//e.g. an placeholder for the sensitive parameters
+type TraceRedactor func(function, name string, value interface{}) interface{}
+
+var traceRedactor TraceRedactor
+
+//SetTraceRedactor sets the redactor of the values logged by <extension>.trace,
+//it should be called from an init() function of the package
+func SetTraceRedactor(redactor TraceRedactor) {
+	traceRedactor = redactor
+}
+
+//traceValue returns the short description of the value for the trace
+func (call *funcCall) traceValue(name string, value interface{}) string {
+	if traceRedactor != nil {
+		value = traceRedactor(call.name, name, value)
+	}
+	//the nullable arguments and results are pointers
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "NULL"
+		}
+		value = v.Elem().Interface()
+	}
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return fmt.Sprintf("bytea(%d bytes)", len(v))
+	case string:
+		s = fmt.Sprintf("%q", v)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if len(s) > maxTraceValue {
+		cut := maxTraceValue
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = fmt.Sprintf("%s...(%d bytes)", s[:cut], len(s))
+	}
+	return s
+}
+
+//traceArgs logs the entry of the traced call with its arguments,
+//it is called by the generated wrappers after the arguments are scanned
+func (call *funcCall) traceArgs(names []string, args ...interface{}) {
+	fields := make([]interface{}, 0, 2*len(args))
+	for i, arg := range args {
+		fields = append(fields, "arg."+names[i], call.traceValue(names[i], arg))
+	}
+	writeLine(LevelDebug, Log.Format("call", fields...))
+}
+
+//traceResult remembers the result of the traced call, it is logged when the call ends
+func (call *funcCall) traceResult(result interface{}) {
+	call.result = call.traceValue("result", result)
+}
+
+//traceEnd logs the exit of the traced call
+func (call *funcCall) traceEnd(duration time.Duration) {
+	fields := []interface{}{"duration_ms", float64(duration) / float64(time.Millisecond)}
+	if call.result != "" {
+		fields = append(fields, "result", call.result)
+	}
+	writeLine(LevelDebug, Log.Format("return", fields...))
+}
@@ -0,0 +1,174 @@
+//go:build plgo_codecs
+
+package plgo
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+//maxDecompressedSize is the largest bytea value PostgreSQL can store (MaxAllocSize),
+//the larger decompressed data is rejected instead of exhausting the backend memory
+const maxDecompressedSize = 1<<30 - 1
+
+//compress compresses the data with gzip, zlib, raw deflate, zstd or lz4 (frame format)
+func compress(algorithm string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch algorithm {
+	case "zstd":
+		zw, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer zw.Close()
+		return zw.EncodeAll(data, nil), nil
+	case "lz4":
+		w = lz4.NewWriter(&buf)
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	case "deflate":
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		w = fw
+	default:
+		return nil, fmt.Errorf("Unknown compression %q, use zstd, lz4, gzip, zlib or deflate", algorithm)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//decompress decompresses the data compressed by compress
+func decompress(algorithm string, data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	switch algorithm {
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxDecompressedSize))
+		if err != nil {
+			return nil, err
+		}
+		r = zr.IOReadCloser()
+	case "lz4":
+		r = io.NopCloser(lz4.NewReader(bytes.NewReader(data)))
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	case "zlib":
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case "deflate":
+		r = flate.NewReader(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("Unknown compression %q, use zstd, lz4, gzip, zlib or deflate", algorithm)
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxDecompressedSize {
+		return nil, fmt.Errorf("Decompressed data is larger than %d bytes", maxDecompressedSize)
+	}
+	return out, nil
+}
+
+//encode encodes the data as base64, base64url (without padding) or hex
+func encode(format string, data []byte) (string, error) {
+	switch format {
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(data), nil
+	case "hex":
+		return hex.EncodeToString(data), nil
+	default:
+		return "", fmt.Errorf("Unknown encoding %q, use base64, base64url or hex", format)
+	}
+}
+
+//decode decodes the text encoded by encode
+func decode(format string, text string) ([]byte, error) {
+	switch format {
+	case "base64":
+		return base64.StdEncoding.DecodeString(text)
+	case "base64url":
+		return base64.RawURLEncoding.DecodeString(text)
+	case "hex":
+		return hex.DecodeString(text)
+	default:
+		return nil, fmt.Errorf("Unknown encoding %q, use base64, base64url or hex", format)
+	}
+}
+
+//codecArgs reads the data and the algorithm (or format) arguments
+func codecArgs(fcinfo *funcInfo, data interface{}) string {
+	var algorithm string
+	if err := fcinfo.Scan(data, &algorithm); err != nil {
+		Log.Error(err.Error())
+	}
+	return algorithm
+}
+
+//export plgo_codec_compress
+func plgo_codec_compress(fcinfo *funcInfo) Datum {
+	var data []byte
+	out, err := compress(codecArgs(fcinfo, &data), data)
+	if err != nil {
+		Log.Error(err.Error())
+	}
+	return toDatum(out)
+}
+
+//export plgo_codec_decompress
+func plgo_codec_decompress(fcinfo *funcInfo) Datum {
+	var data []byte
+	out, err := decompress(codecArgs(fcinfo, &data), data)
+	if err != nil {
+		Log.Error(err.Error())
+	}
+	return toDatum(out)
+}
+
+//export plgo_codec_encode
+func plgo_codec_encode(fcinfo *funcInfo) Datum {
+	var data []byte
+	out, err := encode(codecArgs(fcinfo, &data), data)
+	if err != nil {
+		Log.Error(err.Error())
+	}
+	return toDatum(out)
+}
+
+//export plgo_codec_decode
+func plgo_codec_decode(fcinfo *funcInfo) Datum {
+	var text string
+	out, err := decode(codecArgs(fcinfo, &text), text)
+	if err != nil {
+		Log.Error(err.Error())
+	}
+	return toDatum(out)
+}
@@ -0,0 +1,86 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "funcapi.h"
+#include "access/htup_details.h"
+#include "utils/typcache.h"
+
+TupleDesc plgo_composite_tupdesc(Datum val, HeapTupleData *tuple) {
+	HeapTupleHeader header = DatumGetHeapTupleHeader(val);
+	tuple->t_len = HeapTupleHeaderGetDatumLength(header);
+	ItemPointerSetInvalid(&(tuple->t_self));
+	tuple->t_tableOid = InvalidOid;
+	tuple->t_data = header;
+	return lookup_rowtype_tupdesc(HeapTupleHeaderGetTypeId(header), HeapTupleHeaderGetTypMod(header));
+}
+
+void plgo_release_tupdesc(TupleDesc tupdesc) {
+	ReleaseTupleDesc(tupdesc);
+}
+
+TupleDesc plgo_result_tupdesc(FunctionCallInfo fcinfo) {
+	TupleDesc tupdesc;
+	if (get_call_result_type(fcinfo, NULL, &tupdesc) != TYPEFUNC_COMPOSITE)
+		ereport(ERROR, (errcode(ERRCODE_FEATURE_NOT_SUPPORTED),
+						errmsg("function returning composite type called in context that cannot accept type record")));
+	return BlessTupleDesc(tupdesc);
+}
+
+Datum plgo_composite_datum(HeapTuple tuple) {
+	return HeapTupleGetDatum(tuple);
+}
+*/
+import "C"
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+//scanComposite sets the struct pointed by dest from the composite datum,
+//the attributes are mapped to the fields like the columns in TriggerRow.ScanStruct
+func scanComposite(val C.Datum, dest interface{}) error {
+	var tuple C.HeapTupleData
+	tupleDesc := C.plgo_composite_tupdesc(val, &tuple)
+	defer C.plgo_release_tupdesc(tupleDesc)
+	return newTriggerRow(tupleDesc, &tuple).ScanStruct(dest)
+}
+
+//compositeDatum returns the struct pointed by src as the composite result of the function,
+//the attributes without an field are NULL
+func compositeDatum(fcinfo *funcInfo, src interface{}) Datum {
+	tupleDesc := C.plgo_result_tupdesc((*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo)))
+	natts := int(tupleDesc.natts)
+	row := &TriggerRow{tupleDesc, make([]C.Datum, natts), make([]bool, natts)}
+	for i := range row.nulls {
+		row.nulls[i] = true
+	}
+	if err := row.SetStruct(src); err != nil {
+		Log.Error(err.Error())
+	}
+	return (Datum)(C.plgo_composite_datum(row.heapTuple()))
+}
+
+//recordDatum returns the values as the record result of an function with OUT parameters,
+//the values are in the order of the OUT parameters, the nil pointers are NULL
+func recordDatum(fcinfo *funcInfo, values ...interface{}) Datum {
+	tupleDesc := C.plgo_result_tupdesc((*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo)))
+	natts := int(tupleDesc.natts)
+	if natts != len(values) {
+		Log.Error(fmt.Sprintf("The function returns %d values for %d OUT parameters", len(values), natts))
+	}
+	row := &TriggerRow{tupleDesc, make([]C.Datum, natts), make([]bool, natts)}
+	for i, value := range values {
+		if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				row.Set(i, nil)
+				continue
+			}
+			value = v.Elem().Interface()
+		}
+		row.Set(i, value)
+	}
+	return (Datum)(C.plgo_composite_datum(row.heapTuple()))
+}
@@ -0,0 +1,52 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "miscadmin.h"
+#include "utils/guc.h"
+
+//plgo_get_config returns the value of the setting as current_setting, NULL if it doesn't exist
+char *plgo_get_config(const char *name) {
+	return GetConfigOptionByName(name, NULL, true);
+}
+
+//plgo_set_config sets the setting as set_config, the invalid values raise an ERROR
+void plgo_set_config(const char *name, const char *value, bool is_local) {
+	(void) set_config_option(name, value, superuser() ? PGC_SUSET : PGC_USERSET, PGC_S_SESSION,
+							 is_local ? GUC_ACTION_LOCAL : GUC_ACTION_SET, true, 0, false);
+}
+*/
+import "C"
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+//GetConfigOption returns the value of the setting as current_setting(name), e.g. "30s" for statement_timeout,
+//it returns an error if the setting doesn't exist. The settings readable only by the privileged roles raise an ERROR
+func GetConfigOption(name string) (string, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	value := C.plgo_get_config(cname)
+	if value == nil {
+		return "", fmt.Errorf("Unrecognized configuration parameter %s", name)
+	}
+	defer C.pfree(unsafe.Pointer(value))
+	return C.GoString(value), nil
+}
+
+//SetConfigOption sets the setting as set_config(name, value, isLocal), the local value lasts until the end of the transaction,
+//otherwise until the end of the session. It returns an error if the setting doesn't exist (the names with an dot
+//are the custom settings, they are created), the invalid values and the settings the user can't change raise an ERROR
+func SetConfigOption(name, value string, isLocal bool) error {
+	if _, err := GetConfigOption(name); err != nil && !strings.Contains(name, ".") {
+		return err
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cvalue))
+	C.plgo_set_config(cname, cvalue, (C._Bool)(isLocal))
+	return nil
+}
@@ -0,0 +1,288 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "access/xact.h"
+#include "catalog/namespace.h"
+#include "catalog/objectaddress.h"
+#include "commands/copy.h"
+#include "miscadmin.h"
+#include "nodes/makefuncs.h"
+#include "nodes/value.h"
+#include "parser/parse_node.h"
+#include "parser/parse_type.h"
+#include "utils/acl.h"
+#include "utils/rel.h"
+#include "utils/rls.h"
+#include "utils/varlena.h"
+#if PG_VERSION_NUM >= 120000
+#include "access/table.h"
+#else
+#include "access/heapam.h"
+#define table_openrv heap_openrv
+#define table_close heap_close
+#endif
+#if PG_VERSION_NUM < 140000
+typedef CopyState CopyFromState;
+#endif
+
+extern char *plgo_text_output(Oid type, Datum value);
+extern int plgo_copy_read(void *outbuf, int minread, int maxread);
+
+//plgo_copy_from loads the rows read by plgo_copy_read into the columns of the table as COPY table (columns) FROM
+//in the text format, the user must have the INSERT privilege on the table. It returns the number of the loaded rows
+uint64 plgo_copy_from(const char *table, char **columns, int ncolumns) {
+#if PG_VERSION_NUM >= 160000
+	RangeVar *rv = makeRangeVarFromNameList(stringToQualifiedNameList(table, NULL));
+#else
+	RangeVar *rv = makeRangeVarFromNameList(stringToQualifiedNameList(table));
+#endif
+	Relation rel = table_openrv(rv, RowExclusiveLock);
+	ParseState *pstate;
+	CopyFromState cstate;
+	List *attnames = NIL;
+	AclResult aclresult;
+	uint64 processed;
+	int i;
+
+	aclresult = pg_class_aclcheck(RelationGetRelid(rel), GetUserId(), ACL_INSERT);
+	if (aclresult != ACLCHECK_OK)
+		aclcheck_error(aclresult, get_relkind_objtype(rel->rd_rel->relkind), RelationGetRelationName(rel));
+	if (check_enable_rls(RelationGetRelid(rel), InvalidOid, false) == RLS_ENABLED)
+		ereport(ERROR, (errcode(ERRCODE_FEATURE_NOT_SUPPORTED),
+						errmsg("COPY FROM not supported with row-level security")));
+	for (i = 0; i < ncolumns; i++)
+		attnames = lappend(attnames, makeString(pstrdup(columns[i])));
+	pstate = make_parsestate(NULL);
+#if PG_VERSION_NUM >= 140000
+	cstate = BeginCopyFrom(pstate, rel, NULL, NULL, false, plgo_copy_read, attnames, NIL);
+#else
+	cstate = BeginCopyFrom(pstate, rel, NULL, false, plgo_copy_read, attnames, NIL);
+#endif
+	processed = CopyFrom(cstate);
+	EndCopyFrom(cstate);
+	free_parsestate(pstate);
+	table_close(rel, NoLock);
+	//the next queries see the loaded rows
+	CommandCounterIncrement();
+	return processed;
+}
+
+//plgo_copy_type returns the type of the type name, e.g. timestamptz
+Oid plgo_copy_type(const char *name) {
+	Oid type;
+	int32 typmod;
+
+#if PG_VERSION_NUM >= 160000
+	parseTypeString(name, &type, &typmod, NULL);
+#else
+	parseTypeString(name, &type, &typmod, false);
+#endif
+	return type;
+}
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+//CopySource is the source of the rows loaded by CopyFrom, Next advances to the next row
+//and Values returns its values, Err the error that stopped Next
+type CopySource interface {
+	Next() bool
+	Values() ([]interface{}, error)
+	Err() error
+}
+
+//copyRows is the CopySource of an slice of rows
+type copyRows struct {
+	rows [][]interface{}
+	next int
+}
+
+//CopyFromRows returns the CopySource of the rows
+func CopyFromRows(rows [][]interface{}) CopySource {
+	return &copyRows{rows: rows}
+}
+
+func (r *copyRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *copyRows) Values() ([]interface{}, error) {
+	return r.rows[r.next-1], nil
+}
+
+func (r *copyRows) Err() error {
+	return nil
+}
+
+//copyReader formats the rows of the source as the COPY text format for plgo_copy_read
+type copyReader struct {
+	source  CopySource
+	columns int
+	//types are the SQL types of the Go types of the values
+	types   map[reflect.Type]C.Oid
+	pending []byte
+	rows    int64
+	done    bool
+	err     error
+}
+
+//currentCopy is the running CopyFrom
+var currentCopy *copyReader
+
+func init() {
+	//the ERROR in COPY never returns to CopyFrom
+	onAbort(func(subID uint32) {
+		currentCopy = nil
+	})
+}
+
+//CopyFrom loads the rows of the source into the columns of the table (an qualified name, e.g. "sales.orders")
+//as COPY FROM, much faster than the INSERT of every row. The values are converted as the query parameters
+//(int64 is bigint, time.Time timestamptz, ...) and then to the types of the columns, nil and the nil pointers are NULL.
+//It returns the number of the loaded rows. The rows loaded before an error of the source stay inserted,
+//run CopyFrom in an db.SubTransaction to load all or nothing. The invalid values raise an ERROR as in COPY
+//
+//	n, err := db.CopyFrom("events", []string{"id", "created", "payload"}, plgo.CopyFromRows(rows))
+func (db *DB) CopyFrom(table string, columns []string, source CopySource) (processed int64, err error) {
+	if len(columns) == 0 {
+		return 0, errors.New("CopyFrom needs at least one column")
+	}
+	if currentCopy != nil {
+		return 0, errors.New("Another CopyFrom is running, finish it first")
+	}
+	//the query hooks, the tracing and the slow query log see the COPY command
+	q := beginQuery("COPY "+table+" ("+strings.Join(columns, ", ")+") FROM STDIN", nil)
+	defer endQuery(q, &err)
+	if err = auditQuery(q); err != nil {
+		return 0, err
+	}
+	currentCopy = &copyReader{source: source, columns: len(columns), types: make(map[reflect.Type]C.Oid)}
+	defer func() { currentCopy = nil }()
+	ctable := C.CString(table)
+	defer C.free(unsafe.Pointer(ctable))
+	ccolumns := make([]*C.char, len(columns))
+	for i, column := range columns {
+		ccolumns[i] = C.CString(column)
+		defer C.free(unsafe.Pointer(ccolumns[i]))
+	}
+	//the array of C strings is in the C memory, it can't hold them as an Go slice
+	cnames := (**C.char)(C.malloc(C.size_t(len(columns)) * C.size_t(unsafe.Sizeof(ccolumns[0]))))
+	defer C.free(unsafe.Pointer(cnames))
+	copy(unsafe.Slice(cnames, len(columns)), ccolumns)
+	processed = int64(C.plgo_copy_from(ctable, cnames, C.int(len(columns))))
+	if currentCopy.err != nil {
+		return processed, currentCopy.err
+	}
+	return processed, nil
+}
+
+//export plgo_copy_read
+func plgo_copy_read(outbuf unsafe.Pointer, minread, maxread C.int) C.int {
+	r := currentCopy
+	for !r.done && len(r.pending) < int(minread) {
+		if !r.source.Next() {
+			r.err = r.source.Err()
+			r.done = true
+			break
+		}
+		if r.err = r.appendRow(); r.err != nil {
+			//the rows before the failed one are still loaded, the copy ends after them
+			r.done = true
+		}
+	}
+	n := len(r.pending)
+	if n > int(maxread) {
+		n = int(maxread)
+	}
+	copy(unsafe.Slice((*byte)(outbuf), n), r.pending[:n])
+	r.pending = r.pending[n:]
+	return C.int(n)
+}
+
+//appendRow appends the line of the values of the current row of the source
+func (r *copyReader) appendRow() error {
+	values, err := r.source.Values()
+	if err != nil {
+		return err
+	}
+	if len(values) != r.columns {
+		return fmt.Errorf("CopyFrom row %d has %d values, expected %d", r.rows+1, len(values), r.columns)
+	}
+	line := len(r.pending)
+	for i, value := range values {
+		if i > 0 {
+			r.pending = append(r.pending, '\t')
+		}
+		if err = r.appendValue(value); err != nil {
+			r.pending = r.pending[:line]
+			return fmt.Errorf("CopyFrom row %d, column %d: %w", r.rows+1, i+1, err)
+		}
+	}
+	r.pending = append(r.pending, '\n')
+	r.rows++
+	return nil
+}
+
+//appendValue appends the value as the text of its SQL type, escaped for the COPY text format
+func (r *copyReader) appendValue(value interface{}) error {
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			value = nil
+		} else {
+			value = v.Elem().Interface()
+		}
+	}
+	if value == nil {
+		r.pending = append(r.pending, `\N`...)
+		return nil
+	}
+	oid, err := r.typeOf(value)
+	if err != nil {
+		return err
+	}
+	text := C.plgo_text_output(oid, (C.Datum)(toDatum(value)))
+	defer C.pfree(unsafe.Pointer(text))
+	for _, c := range []byte(C.GoString(text)) {
+		switch c {
+		case '\\':
+			r.pending = append(r.pending, `\\`...)
+		case '\t':
+			r.pending = append(r.pending, `\t`...)
+		case '\n':
+			r.pending = append(r.pending, `\n`...)
+		case '\r':
+			r.pending = append(r.pending, `\r`...)
+		default:
+			r.pending = append(r.pending, c)
+		}
+	}
+	return nil
+}
+
+//typeOf returns the SQL type of the Go type of the value as in the query parameters
+func (r *copyReader) typeOf(value interface{}) (C.Oid, error) {
+	t := reflect.TypeOf(value)
+	if oid, ok := r.types[t]; ok {
+		return oid, nil
+	}
+	typeName, ok := paramTypes[t]
+	if t == reflect.TypeOf(JSONB(nil)) {
+		typeName, ok = "jsonb", true
+	}
+	if !ok {
+		return 0, fmt.Errorf("type %T not supported", value)
+	}
+	ctype := C.CString(typeName)
+	defer C.free(unsafe.Pointer(ctype))
+	oid := C.plgo_copy_type(ctype)
+	r.types[t] = oid
+	return oid, nil
+}
@@ -0,0 +1,143 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "executor/spi.h"
+*/
+import "C"
+import (
+	"fmt"
+)
+
+//defaultFetchSize is the number of rows fetched by an Cursor at once
+const defaultFetchSize = 1000
+
+//Cursor streams the rows of an query, they are fetched in batches (SPI_cursor_fetch) instead of materialized at once,
+//so only the current batch is in the memory. The cursor must be closed before the DB
+//
+//	cursor, err := db.QueryCursor("SELECT id, name FROM users WHERE active = $1", true)
+//	if err != nil {
+//		...
+//	}
+//	defer cursor.Close()
+//	for cursor.Next() {
+//		err = cursor.Scan(&id, &name)
+//	}
+type Cursor struct {
+	portal    C.Portal
+	fetchSize int
+	//tuptable is the fetched batch, rows its remaining rows
+	tuptable *C.SPITupleTable
+	rows     *Rows
+	done     bool
+}
+
+//QueryCursor opens an cursor of the query, the parameter types are derived from the Go types of the args
+//as in Query.Param
+func (db *DB) QueryCursor(query string, args ...interface{}) (*Cursor, error) {
+	types := make([]string, len(args))
+	for i, arg := range args {
+		typeName, err := paramType(arg, i+1)
+		if err != nil {
+			return nil, err
+		}
+		types[i] = typeName
+	}
+	stmt, err := db.Prepare(query, types)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Cursor(args...)
+}
+
+//Cursor executes the prepared Stmt with the provided args and returns an cursor of its rows
+func (stmt *Stmt) Cursor(args ...interface{}) (cursor *Cursor, err error) {
+	q := beginQuery(stmt.query, args)
+	defer endQuery(q, &err)
+	if err = auditQuery(q); err != nil {
+		return nil, err
+	}
+	valuesP, nullsP, err := stmt.spiArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	portal, err := stmt.cursorOpen(valuesP, nullsP)
+	if err != nil {
+		return nil, err
+	}
+	if portal == nil {
+		return nil, fmt.Errorf("Cursor failed: %s", C.GoString(C.SPI_result_code_string(C.SPI_result)))
+	}
+	return &Cursor{portal: portal, fetchSize: defaultFetchSize}, nil
+}
+
+//SetFetchSize sets the number of rows fetched at once, 1000 by default
+func (c *Cursor) SetFetchSize(n int) {
+	if n > 0 {
+		c.fetchSize = n
+	}
+}
+
+//Next sets the cursor to the next row, the next batch is fetched when the current is read.
+//It returns false after the last row
+func (c *Cursor) Next() bool {
+	if c.rows != nil && c.rows.Next() {
+		return true
+	}
+	if c.done || c.portal == nil {
+		return false
+	}
+	c.freeBatch()
+	C.SPI_cursor_fetch(c.portal, (C._Bool)(true), C.long(c.fetchSize))
+	if C.SPI_processed == 0 {
+		c.done = true
+		return false
+	}
+	c.tuptable = C.SPI_tuptable
+	c.rows = newRows(c.tuptable.vals, c.tuptable.tupdesc, C.uint64(C.SPI_processed))
+	return c.rows.Next()
+}
+
+//freeBatch frees the fetched batch
+func (c *Cursor) freeBatch() {
+	if c.tuptable != nil {
+		C.SPI_freetuptable(c.tuptable)
+		c.tuptable, c.rows = nil, nil
+	}
+}
+
+//Scan takes pointers to variables that will be filled with the values of the current row
+func (c *Cursor) Scan(args ...interface{}) error {
+	if c.rows == nil {
+		return fmt.Errorf("Cursor has no current row")
+	}
+	return c.rows.Scan(args...)
+}
+
+//ScanStruct sets the exported fields of the struct pointed by dest from the columns of the current row,
+//as Rows.ScanStruct
+func (c *Cursor) ScanStruct(dest interface{}) error {
+	if c.rows == nil {
+		return fmt.Errorf("Cursor has no current row")
+	}
+	return c.rows.ScanStruct(dest)
+}
+
+//Columns returns the names of columns, after the first Next
+func (c *Cursor) Columns() ([]string, error) {
+	if c.rows == nil {
+		return nil, fmt.Errorf("Cursor has no current row")
+	}
+	return c.rows.Columns()
+}
+
+//Close frees the fetched rows and closes the cursor
+func (c *Cursor) Close() error {
+	if c.portal == nil {
+		return nil
+	}
+	c.freeBatch()
+	C.SPI_cursor_close(c.portal)
+	c.portal = nil
+	return nil
+}
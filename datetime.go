@@ -0,0 +1,125 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "catalog/pg_type.h"
+#include "datatype/timestamp.h"
+#include "utils/date.h"
+#include "utils/timestamp.h"
+
+extern Datum date_to_datum(DateADT val);
+extern Datum time_to_datum(Timestamp val);
+extern Datum timetz_to_datum(TimestampTz val);
+extern DateADT datum_to_date(Datum val);
+extern Timestamp datum_to_time(Datum val);
+extern TimestampTz datum_to_timetz(Datum val);
+
+Datum plgo_timeadt_to_datum(TimeADT val) {
+	return TimeADTGetDatum(val);
+}
+
+TimeADT plgo_datum_to_timeadt(Datum val) {
+	return DatumGetTimeADT(val);
+}
+
+Datum plgo_interval_to_datum(int64 time, int32 day, int32 month) {
+	Interval *interval = palloc(sizeof(Interval));
+
+	interval->time = time;
+	interval->day = day;
+	interval->month = month;
+	return IntervalPGetDatum(interval);
+}
+
+void plgo_datum_to_interval(Datum val, int64 *time, int32 *day, int32 *month) {
+	Interval *interval = DatumGetIntervalP(val);
+
+	*time = interval->time;
+	*day = interval->day;
+	*month = interval->month;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"time"
+)
+
+//pgEpoch is the Unix time of 2000-01-01 00:00:00 UTC, the epoch of the PostgreSQL timestamps and dates
+const pgEpoch = 946684800
+
+//pgMicros returns the microseconds of the time since the PostgreSQL epoch
+func pgMicros(t time.Time) int64 {
+	return (t.Unix()-pgEpoch)*1000000 + int64(t.Nanosecond()/1000)
+}
+
+//fromPgMicros returns the time of the microseconds since the PostgreSQL epoch
+func fromPgMicros(micros int64) time.Time {
+	return time.Unix(pgEpoch+micros/1000000, micros%1000000*1000)
+}
+
+//wallClock returns the date and the clock of the time in its location as an UTC time,
+//the timestamp (without time zone) and the date keep the wall clock
+func wallClock(t time.Time) time.Time {
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	return time.Date(year, month, day, hour, min, sec, t.Nanosecond(), time.UTC)
+}
+
+//timeDatum converts the time to the datum of the SQL type, timestamptz, timestamp, date or time (the time of day),
+//the types are declared with the //plgo:time directive
+func timeDatum(t time.Time, sqlType string) Datum {
+	switch sqlType {
+	case "timestamp":
+		return (Datum)(C.time_to_datum(C.Timestamp(pgMicros(wallClock(t)))))
+	case "date":
+		year, month, day := t.Date()
+		days := (time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() - pgEpoch) / (24 * 60 * 60)
+		return (Datum)(C.date_to_datum(C.DateADT(days)))
+	case "time":
+		hour, min, sec := t.Clock()
+		micros := (int64(hour)*3600+int64(min)*60+int64(sec))*1000000 + int64(t.Nanosecond()/1000)
+		return (Datum)(C.plgo_timeadt_to_datum(C.TimeADT(micros)))
+	}
+	return (Datum)(C.timetz_to_datum(C.TimestampTz(pgMicros(t))))
+}
+
+//scanTime sets the time from the timestamptz (in the local time zone), timestamp (UTC), date (UTC midnight)
+//or time datum (the time of the day 0000-01-01 UTC)
+func scanTime(oid C.Oid, typeName string, val C.Datum, dest *time.Time) error {
+	switch oid {
+	case C.TIMESTAMPTZOID:
+		*dest = fromPgMicros(int64(C.datum_to_timetz(val))).Local()
+	case C.TIMESTAMPOID:
+		*dest = fromPgMicros(int64(C.datum_to_time(val))).UTC()
+	case C.DATEOID:
+		*dest = time.Unix(pgEpoch+int64(C.datum_to_date(val))*24*60*60, 0).UTC()
+	case C.TIMEOID:
+		*dest = time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(C.plgo_datum_to_timeadt(val)) * time.Microsecond)
+	default:
+		return fmt.Errorf("Unsupported time type %s", typeName)
+	}
+	return nil
+}
+
+//intervalDatum converts the duration to an interval of microseconds, without days and months
+func intervalDatum(d time.Duration) Datum {
+	return (Datum)(C.plgo_interval_to_datum(C.int64(d.Microseconds()), 0, 0))
+}
+
+//scanDuration sets the duration from the interval, the days are 24 hours and the months 30 days as in the interval comparison,
+//or from the time of the day
+func scanDuration(oid C.Oid, typeName string, val C.Datum, dest *time.Duration) error {
+	switch oid {
+	case C.INTERVALOID:
+		var micros C.int64
+		var days, months C.int32
+		C.plgo_datum_to_interval(val, &micros, &days, &months)
+		*dest = time.Duration(micros)*time.Microsecond + time.Duration(int64(days)+int64(months)*30)*24*time.Hour
+	case C.TIMEOID:
+		*dest = time.Duration(C.plgo_datum_to_timeadt(val)) * time.Microsecond
+	default:
+		return fmt.Errorf("Column type is not interval %s", typeName)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "utils/lsyscache.h"
+
+extern Datum plgo_text_input(Oid type, char *text);
+extern char *plgo_text_output(Oid type, Datum value);
+
+//plgo_result_type returns the declared result type of the called function
+Oid plgo_result_type(FunctionCallInfo fcinfo) {
+	return get_func_rettype(fcinfo->flinfo->fn_oid);
+}
+*/
+import "C"
+import (
+	"reflect"
+	"unsafe"
+)
+
+//enumDatum returns the datum of the label of the enum result of the function, the unknown label raises an ERROR
+func enumDatum(fcinfo *funcInfo, label string) Datum {
+	oid := C.plgo_result_type((C.FunctionCallInfo)(unsafe.Pointer(fcinfo)))
+	text := C.CString(label)
+	defer C.free(unsafe.Pointer(text))
+	return (Datum)(C.plgo_text_input(oid, text))
+}
+
+//scanEnum sets the string type pointed by the target to the label of the enum datum
+func scanEnum(oid C.Oid, val C.Datum, target reflect.Value) {
+	text := C.plgo_text_output(oid, val)
+	defer C.pfree(unsafe.Pointer(text))
+	target.Elem().SetString(C.GoString(text))
+}
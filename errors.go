@@ -0,0 +1,154 @@
+package plgo
+
+/*
+#include "postgres.h"
+
+//plgo_raise_error raises an ERROR with the message and the detail if not NULL,
+//the SQLSTATE is ERRCODE_INTERNAL_ERROR if sqlstate is NULL
+void plgo_raise_error(const char *sqlstate, const char *message, const char *detail) {
+	int code = ERRCODE_INTERNAL_ERROR;
+
+	if (sqlstate != NULL)
+		code = MAKE_SQLSTATE(sqlstate[0], sqlstate[1], sqlstate[2], sqlstate[3], sqlstate[4]);
+	ereport(ERROR, (errcode(code), errmsg("%s", message), detail != NULL ? errdetail("%s", detail) : 0));
+}
+
+//plgo_raise_fields raises an ERROR as plgo_raise_error with the hint and the names of the object if not NULL
+void plgo_raise_fields(const char *sqlstate, const char *message, const char *detail, const char *hint,
+					   const char *schema, const char *table, const char *column, const char *datatype, const char *constraint) {
+	int code = ERRCODE_INTERNAL_ERROR;
+
+	if (sqlstate != NULL)
+		code = MAKE_SQLSTATE(sqlstate[0], sqlstate[1], sqlstate[2], sqlstate[3], sqlstate[4]);
+	ereport(ERROR, (errcode(code), errmsg("%s", message),
+					detail != NULL ? errdetail("%s", detail) : 0,
+					hint != NULL ? errhint("%s", hint) : 0,
+					schema != NULL ? err_generic_string(PG_DIAG_SCHEMA_NAME, schema) : 0,
+					table != NULL ? err_generic_string(PG_DIAG_TABLE_NAME, table) : 0,
+					column != NULL ? err_generic_string(PG_DIAG_COLUMN_NAME, column) : 0,
+					datatype != NULL ? err_generic_string(PG_DIAG_DATATYPE_NAME, datatype) : 0,
+					constraint != NULL ? err_generic_string(PG_DIAG_CONSTRAINT_NAME, constraint) : 0));
+}
+*/
+import "C"
+import "errors"
+
+//SQLStater is implemented by the errors with an SQLSTATE code, e.g. 22023 (invalid_parameter_value).
+//The error returned by an exported function is raised with its code
+type SQLStater interface {
+	SQLState() string
+}
+
+//sqlStateError is an error with an SQLSTATE code
+type sqlStateError struct {
+	code string
+	err  error
+}
+
+func (e *sqlStateError) Error() string {
+	return e.err.Error()
+}
+
+func (e *sqlStateError) SQLState() string {
+	return e.code
+}
+
+func (e *sqlStateError) Unwrap() error {
+	return e.err
+}
+
+//WithSQLState returns the error with the SQLSTATE code, it is raised with the code when returned by an exported function
+//
+//	return 0, plgo.WithSQLState("22023", fmt.Errorf("negative amount %d", amount))
+func WithSQLState(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &sqlStateError{code: code, err: err}
+}
+
+//Error is an error raised with the SQLSTATE code and the fields of the PostgreSQL error, the clients can handle it
+//by the code (e.g. 23505 unique_violation) and the names of the object
+//
+//	return &plgo.Error{Code: "23514", Message: "negative balance", Detail: fmt.Sprintf("Account %d has %d.", id, balance),
+//		Table: "accounts", Constraint: "balance_positive"}
+type Error struct {
+	//Code is the SQLSTATE, internal_error (XX000) if empty
+	Code    string
+	Message string
+	//Detail and Hint are reported as DETAIL and HINT
+	Detail, Hint string
+	//Schema, Table, Column, Datatype and Constraint are the names of the object the error is about
+	Schema, Table, Column, Datatype, Constraint string
+	//Err is the cause of the error, it's not reported
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) SQLState() string {
+	return e.Code
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+//validSQLState reports if the code is an SQLSTATE, five digits or upper case letters
+func validSQLState(code string) bool {
+	if len(code) != 5 {
+		return false
+	}
+	for _, c := range code {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+//raiseError raises the error returned by an exported function as an PostgreSQL ERROR,
+//with the fields of the first *Error in its chain, otherwise with the SQLSTATE of the first error implementing SQLStater
+func raiseError(err error) {
+	var pgError *Error
+	if errors.As(err, &pgError) {
+		raiseFields(pgError, err.Error())
+	}
+	var stater SQLStater
+	if errors.As(err, &stater) && validSQLState(stater.SQLState()) {
+		raise(stater.SQLState(), err.Error(), "")
+	}
+	raise("", err.Error(), "")
+}
+
+//raise raises an ERROR with the SQLSTATE code (internal_error if empty), the message and the detail if not empty
+func raise(code, message, detail string) {
+	//the strings are freed with the C memory of the aborted call
+	var ccode, cdetail *C.char
+	if code != "" {
+		ccode = C.CString(code)
+	}
+	if detail != "" {
+		cdetail = C.CString(detail)
+	}
+	C.plgo_raise_error(ccode, C.CString(message), cdetail)
+}
+
+//raiseFields raises an ERROR with the message and the fields of the error, the invalid code is internal_error
+func raiseFields(e *Error, message string) {
+	//the strings are freed with the C memory of the aborted call
+	cstring := func(s string) *C.char {
+		if s == "" {
+			return nil
+		}
+		return C.CString(s)
+	}
+	code := e.Code
+	if !validSQLState(code) {
+		code = ""
+	}
+	C.plgo_raise_fields(cstring(code), C.CString(message), cstring(e.Detail), cstring(e.Hint),
+		cstring(e.Schema), cstring(e.Table), cstring(e.Column), cstring(e.Datatype), cstring(e.Constraint))
+}
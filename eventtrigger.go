@@ -0,0 +1,142 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "commands/event_trigger.h"
+
+bool plgo_called_as_event_trigger(FunctionCallInfo fcinfo) {
+	return CALLED_AS_EVENT_TRIGGER(fcinfo);
+}
+
+const char *plgo_event_trigger_event(FunctionCallInfo fcinfo) {
+	return ((EventTriggerData *) fcinfo->context)->event;
+}
+
+//plgo_event_trigger_tag returns the command tag, e.g. CREATE TABLE
+const char *plgo_event_trigger_tag(FunctionCallInfo fcinfo) {
+#if PG_VERSION_NUM >= 130000
+	return GetCommandTagName(((EventTriggerData *) fcinfo->context)->tag);
+#else
+	return ((EventTriggerData *) fcinfo->context)->tag;
+#endif
+}
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+//EventTriggerData is the event passed to an event trigger function declared with //plgo:event-trigger,
+//func(ev *plgo.EventTriggerData) error
+type EventTriggerData struct {
+	//Event is ddl_command_start, ddl_command_end, sql_drop or table_rewrite
+	Event string
+	//Tag is the command tag of the command firing the event, e.g. CREATE TABLE
+	Tag string
+}
+
+//DDLCommand is an object created or altered by the command, an row of pg_event_trigger_ddl_commands()
+type DDLCommand struct {
+	ClassID, ObjID Oid
+	ObjSubID       int32
+	CommandTag     string
+	ObjectType     string
+	//SchemaName is "" for the objects not in an schema
+	SchemaName     string
+	ObjectIdentity string
+	InExtension    bool
+}
+
+//DroppedObject is an object dropped by the command, an row of pg_event_trigger_dropped_objects()
+type DroppedObject struct {
+	ClassID, ObjID Oid
+	ObjSubID       int32
+	//Original is true for the objects named in the command, Normal for the objects dropped by an normal dependency
+	Original, Normal bool
+	IsTemporary      bool
+	ObjectType       string
+	//SchemaName and ObjectName are "" when they don't apply to the object
+	SchemaName, ObjectName string
+	ObjectIdentity         string
+	AddressNames           []string
+	AddressArgs            []string
+}
+
+//EventTriggerData returns the event data, if the function was called as an event trigger, else nil
+func (fcinfo *funcInfo) EventTriggerData() *EventTriggerData {
+	cfcinfo := (C.FunctionCallInfo)(unsafe.Pointer(fcinfo))
+	if C.plgo_called_as_event_trigger(cfcinfo) != (C._Bool)(true) {
+		return nil
+	}
+	return &EventTriggerData{
+		Event: C.GoString(C.plgo_event_trigger_event(cfcinfo)),
+		Tag:   C.GoString(C.plgo_event_trigger_tag(cfcinfo)),
+	}
+}
+
+//DDLCommands returns the objects created or altered by the command, it's available only in ddl_command_end
+func (ev *EventTriggerData) DDLCommands() ([]DDLCommand, error) {
+	if ev.Event != "ddl_command_end" {
+		return nil, fmt.Errorf("DDLCommands is available only in ddl_command_end, not in %s", ev.Event)
+	}
+	var commands []DDLCommand
+	err := queryEventObjects(`SELECT classid::bigint, objid::bigint, objsubid, command_tag, object_type,
+		coalesce(schema_name, ''), object_identity, in_extension FROM pg_event_trigger_ddl_commands()`, func(rows *Rows) error {
+		var c DDLCommand
+		var classID, objID int64
+		if err := rows.Scan(&classID, &objID, &c.ObjSubID, &c.CommandTag, &c.ObjectType, &c.SchemaName, &c.ObjectIdentity, &c.InExtension); err != nil {
+			return err
+		}
+		c.ClassID, c.ObjID = Oid(classID), Oid(objID)
+		commands = append(commands, c)
+		return nil
+	})
+	return commands, err
+}
+
+//DroppedObjects returns the objects dropped by the command, it's available only in sql_drop
+func (ev *EventTriggerData) DroppedObjects() ([]DroppedObject, error) {
+	if ev.Event != "sql_drop" {
+		return nil, fmt.Errorf("DroppedObjects is available only in sql_drop, not in %s", ev.Event)
+	}
+	var objects []DroppedObject
+	err := queryEventObjects(`SELECT classid::bigint, objid::bigint, objsubid, original, normal, is_temporary, object_type,
+		coalesce(schema_name, ''), coalesce(object_name, ''), object_identity, address_names, address_args
+		FROM pg_event_trigger_dropped_objects()`, func(rows *Rows) error {
+		var o DroppedObject
+		var classID, objID int64
+		if err := rows.Scan(&classID, &objID, &o.ObjSubID, &o.Original, &o.Normal, &o.IsTemporary, &o.ObjectType,
+			&o.SchemaName, &o.ObjectName, &o.ObjectIdentity, &o.AddressNames, &o.AddressArgs); err != nil {
+			return err
+		}
+		o.ClassID, o.ObjID = Oid(classID), Oid(objID)
+		objects = append(objects, o)
+		return nil
+	})
+	return objects, err
+}
+
+//queryEventObjects runs the query of the event trigger function in its own SPI connection and calls scan for every row
+func queryEventObjects(query string, scan func(rows *Rows) error) error {
+	db, err := Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	stmt, err := db.Prepare(query, nil)
+	if err != nil {
+		return err
+	}
+	rows, err := stmt.Query()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
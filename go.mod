@@ -3,6 +3,6 @@ module github.com/algonode/plgo
 go 1.20
 
 require (
-	golang.org/x/mod v0.14.0
+	github.com/BurntSushi/toml v1.4.0
 	golang.org/x/sys v0.14.0
 )
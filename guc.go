@@ -0,0 +1,293 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "utils/guc.h"
+#include "utils/memutils.h"
+
+static char *guc_strdup_top(char *s) {
+	if (s == NULL)
+		return NULL;
+	return MemoryContextStrdup(TopMemoryContext, s);
+}
+
+int *plgo_define_int_guc(char *name, char *short_desc, char *long_desc, int boot, int min, int max, int context, int flags) {
+	int *value = MemoryContextAllocZero(TopMemoryContext, sizeof(int));
+	*value = boot;
+	DefineCustomIntVariable(name, guc_strdup_top(short_desc), guc_strdup_top(long_desc), value,
+							boot, min, max, (GucContext) context, flags, NULL, NULL, NULL);
+	return value;
+}
+
+bool *plgo_define_bool_guc(char *name, char *short_desc, char *long_desc, bool boot, int context, int flags) {
+	bool *value = MemoryContextAllocZero(TopMemoryContext, sizeof(bool));
+	*value = boot;
+	DefineCustomBoolVariable(name, guc_strdup_top(short_desc), guc_strdup_top(long_desc), value,
+							 boot, (GucContext) context, flags, NULL, NULL, NULL);
+	return value;
+}
+
+double *plgo_define_real_guc(char *name, char *short_desc, char *long_desc, double boot, double min, double max, int context, int flags) {
+	double *value = MemoryContextAllocZero(TopMemoryContext, sizeof(double));
+	*value = boot;
+	DefineCustomRealVariable(name, guc_strdup_top(short_desc), guc_strdup_top(long_desc), value,
+							 boot, min, max, (GucContext) context, flags, NULL, NULL, NULL);
+	return value;
+}
+
+char **plgo_define_string_guc(char *name, char *short_desc, char *long_desc, char *boot, int context, int flags) {
+	char **value = MemoryContextAllocZero(TopMemoryContext, sizeof(char *));
+	DefineCustomStringVariable(name, guc_strdup_top(short_desc), guc_strdup_top(long_desc), value,
+							   guc_strdup_top(boot), (GucContext) context, flags, NULL, NULL, NULL);
+	return value;
+}
+
+struct config_enum_entry *plgo_new_enum_options(int count) {
+	return MemoryContextAllocZero(TopMemoryContext, sizeof(struct config_enum_entry) * (count + 1));
+}
+
+void plgo_set_enum_option(struct config_enum_entry *options, int i, char *name, int val) {
+	options[i].name = guc_strdup_top(name);
+	options[i].val = val;
+	options[i].hidden = false;
+}
+
+int *plgo_define_enum_guc(char *name, char *short_desc, char *long_desc, int boot, struct config_enum_entry *options, int context, int flags) {
+	int *value = MemoryContextAllocZero(TopMemoryContext, sizeof(int));
+	*value = boot;
+	DefineCustomEnumVariable(name, guc_strdup_top(short_desc), guc_strdup_top(long_desc), value,
+							 boot, options, (GucContext) context, flags, NULL, NULL, NULL);
+	return value;
+}
+
+void plgo_reserve_guc_prefix(char *prefix) {
+#if PG_VERSION_NUM >= 150000
+	MarkGUCPrefixReserved(prefix);
+#else
+	EmitWarningsOnPlaceholders(prefix);
+#endif
+}
+*/
+import "C"
+import "unsafe"
+
+//gucContext is the context in which the setting can be changed
+type gucContext int
+
+//gucContext constants
+const (
+	gucUserset    gucContext = C.PGC_USERSET
+	gucSuset      gucContext = C.PGC_SUSET
+	gucSighup     gucContext = C.PGC_SIGHUP
+	gucBackend    gucContext = C.PGC_BACKEND
+	gucPostmaster gucContext = C.PGC_POSTMASTER
+)
+
+//flags of the settings
+const (
+	//gucUnitMs is the flag for settings in milliseconds
+	gucUnitMs = C.GUC_UNIT_MS
+	//gucUnitKB is the flag for settings in kilobytes
+	gucUnitKB = C.GUC_UNIT_KB
+	//gucSuperuserOnly hides the setting from the other users
+	gucSuperuserOnly = C.GUC_SUPERUSER_ONLY
+)
+
+//gucVar is a custom configuration variable <extension>.<name>,
+//the variables are defined from _PG_init
+type gucVar interface {
+	define(fullName *C.char)
+	gucName() string
+}
+
+var gucVars []gucVar
+
+func init() {
+	onInit(defineGUCs)
+}
+
+func registerGUC(v gucVar) {
+	gucVars = append(gucVars, v)
+}
+
+func defineGUCs() {
+	if len(gucVars) == 0 {
+		return
+	}
+	for _, v := range gucVars {
+		cname := C.CString(extensionName + "." + v.gucName())
+		v.define(cname)
+		C.free(unsafe.Pointer(cname))
+	}
+	cprefix := C.CString(extensionName)
+	defer C.free(unsafe.Pointer(cprefix))
+	C.plgo_reserve_guc_prefix(cprefix)
+}
+
+//gucDesc has the common fields of the configuration variables
+type gucDesc struct {
+	name      string
+	shortDesc string
+	longDesc  string
+	context   gucContext
+	flags     int
+}
+
+func (d *gucDesc) gucName() string {
+	return d.name
+}
+
+//cDesc returns the C strings of the descriptions, they must be freed by the caller
+func (d *gucDesc) cDesc() (*C.char, *C.char) {
+	var long *C.char
+	if d.longDesc != "" {
+		long = C.CString(d.longDesc)
+	}
+	return C.CString(d.shortDesc), long
+}
+
+func freeDesc(short, long *C.char) {
+	C.free(unsafe.Pointer(short))
+	if long != nil {
+		C.free(unsafe.Pointer(long))
+	}
+}
+
+type intGUC struct {
+	gucDesc
+	boot, min, max int
+	value          *C.int
+}
+
+func newIntGUC(desc gucDesc, boot, min, max int) *intGUC {
+	g := &intGUC{gucDesc: desc, boot: boot, min: min, max: max}
+	registerGUC(g)
+	return g
+}
+
+func (g *intGUC) define(fullName *C.char) {
+	short, long := g.cDesc()
+	defer freeDesc(short, long)
+	g.value = C.plgo_define_int_guc(fullName, short, long, C.int(g.boot), C.int(g.min), C.int(g.max), C.int(g.context), C.int(g.flags))
+}
+
+//get returns the current value of the variable
+func (g *intGUC) get() int {
+	if g.value == nil {
+		return g.boot
+	}
+	return int(*g.value)
+}
+
+type boolGUC struct {
+	gucDesc
+	boot  bool
+	value *C.bool
+}
+
+func newBoolGUC(desc gucDesc, boot bool) *boolGUC {
+	g := &boolGUC{gucDesc: desc, boot: boot}
+	registerGUC(g)
+	return g
+}
+
+func (g *boolGUC) define(fullName *C.char) {
+	short, long := g.cDesc()
+	defer freeDesc(short, long)
+	g.value = C.plgo_define_bool_guc(fullName, short, long, (C._Bool)(g.boot), C.int(g.context), C.int(g.flags))
+}
+
+func (g *boolGUC) get() bool {
+	if g.value == nil {
+		return g.boot
+	}
+	return *g.value == (C._Bool)(true)
+}
+
+type realGUC struct {
+	gucDesc
+	boot, min, max float64
+	value          *C.double
+}
+
+func newRealGUC(desc gucDesc, boot, min, max float64) *realGUC {
+	g := &realGUC{gucDesc: desc, boot: boot, min: min, max: max}
+	registerGUC(g)
+	return g
+}
+
+func (g *realGUC) define(fullName *C.char) {
+	short, long := g.cDesc()
+	defer freeDesc(short, long)
+	g.value = C.plgo_define_real_guc(fullName, short, long, C.double(g.boot), C.double(g.min), C.double(g.max), C.int(g.context), C.int(g.flags))
+}
+
+func (g *realGUC) get() float64 {
+	if g.value == nil {
+		return g.boot
+	}
+	return float64(*g.value)
+}
+
+type stringGUC struct {
+	gucDesc
+	boot  string
+	value **C.char
+}
+
+func newStringGUC(desc gucDesc, boot string) *stringGUC {
+	g := &stringGUC{gucDesc: desc, boot: boot}
+	registerGUC(g)
+	return g
+}
+
+func (g *stringGUC) define(fullName *C.char) {
+	short, long := g.cDesc()
+	defer freeDesc(short, long)
+	boot := C.CString(g.boot)
+	defer C.free(unsafe.Pointer(boot))
+	g.value = C.plgo_define_string_guc(fullName, short, long, boot, C.int(g.context), C.int(g.flags))
+}
+
+func (g *stringGUC) get() string {
+	if g.value == nil {
+		return g.boot
+	}
+	if *g.value == nil {
+		return ""
+	}
+	return C.GoString(*g.value)
+}
+
+type enumGUC struct {
+	gucDesc
+	boot    int
+	options []string
+	value   *C.int
+}
+
+//newEnumGUC defines an enum variable, the value is the index of the option
+func newEnumGUC(desc gucDesc, boot int, options []string) *enumGUC {
+	g := &enumGUC{gucDesc: desc, boot: boot, options: options}
+	registerGUC(g)
+	return g
+}
+
+func (g *enumGUC) define(fullName *C.char) {
+	short, long := g.cDesc()
+	defer freeDesc(short, long)
+	options := C.plgo_new_enum_options(C.int(len(g.options)))
+	for i, option := range g.options {
+		coption := C.CString(option)
+		C.plgo_set_enum_option(options, C.int(i), coption, C.int(i))
+		C.free(unsafe.Pointer(coption))
+	}
+	g.value = C.plgo_define_enum_guc(fullName, short, long, C.int(g.boot), options, C.int(g.context), C.int(g.flags))
+}
+
+func (g *enumGUC) get() int {
+	if g.value == nil {
+		return g.boot
+	}
+	return int(*g.value)
+}
@@ -0,0 +1,123 @@
+package plgo
+
+import (
+	"fmt"
+	"regexp"
+)
+
+//GUCContext is the context in which an setting of the extension can be changed
+type GUCContext int
+
+//GUCContext constants
+const (
+	//GUCUserset settings can be changed by any user with SET
+	GUCUserset = GUCContext(gucUserset)
+	//GUCSuset settings can be changed by superusers with SET
+	GUCSuset = GUCContext(gucSuset)
+	//GUCSighup settings are changed in postgresql.conf and reloaded
+	GUCSighup = GUCContext(gucSighup)
+	//GUCBackend settings are fixed when the session starts
+	GUCBackend = GUCContext(gucBackend)
+	//GUCPostmaster settings are changed by an restart of the server, the extension must be in shared_preload_libraries
+	GUCPostmaster = GUCContext(gucPostmaster)
+)
+
+//gucNameRe matches the valid names of the settings
+var gucNameRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+//publicDesc returns the description of the setting defined by the package,
+//it panics if the name is invalid or already used by the extension
+func publicDesc(name, description string, context GUCContext) gucDesc {
+	if !gucNameRe.MatchString(name) {
+		panic(fmt.Sprintf("plgo: invalid setting name %q", name))
+	}
+	for _, v := range gucVars {
+		if v.gucName() == name {
+			panic(fmt.Sprintf("plgo: setting %s is already defined", name))
+		}
+	}
+	return gucDesc{name: name, shortDesc: description, context: gucContext(context)}
+}
+
+//IntGUC is an integer setting of the extension defined with DefineIntGUC
+type IntGUC struct {
+	guc *intGUC
+}
+
+//DefineIntGUC defines the setting <extension>.<name> with the default value and the range,
+//it must be called from an init() function or an variable declaration of the package:
+//
+//	var batchSize = plgo.DefineIntGUC("batch_size", "Sets the number of rows processed in one batch.", 100, 1, 10000, plgo.GUCUserset)
+func DefineIntGUC(name, description string, boot, min, max int, context GUCContext) *IntGUC {
+	return &IntGUC{newIntGUC(publicDesc(name, description, context), boot, min, max)}
+}
+
+//Get returns the current value of the setting
+func (g *IntGUC) Get() int {
+	return g.guc.get()
+}
+
+//BoolGUC is an boolean setting of the extension defined with DefineBoolGUC
+type BoolGUC struct {
+	guc *boolGUC
+}
+
+//DefineBoolGUC defines the boolean setting <extension>.<name>, like DefineIntGUC
+func DefineBoolGUC(name, description string, boot bool, context GUCContext) *BoolGUC {
+	return &BoolGUC{newBoolGUC(publicDesc(name, description, context), boot)}
+}
+
+//Get returns the current value of the setting
+func (g *BoolGUC) Get() bool {
+	return g.guc.get()
+}
+
+//FloatGUC is an floating point setting of the extension defined with DefineFloatGUC
+type FloatGUC struct {
+	guc *realGUC
+}
+
+//DefineFloatGUC defines the floating point setting <extension>.<name> with the default value and the range, like DefineIntGUC
+func DefineFloatGUC(name, description string, boot, min, max float64, context GUCContext) *FloatGUC {
+	return &FloatGUC{newRealGUC(publicDesc(name, description, context), boot, min, max)}
+}
+
+//Get returns the current value of the setting
+func (g *FloatGUC) Get() float64 {
+	return g.guc.get()
+}
+
+//StringGUC is an string setting of the extension defined with DefineStringGUC
+type StringGUC struct {
+	guc *stringGUC
+}
+
+//DefineStringGUC defines the string setting <extension>.<name>, like DefineIntGUC
+func DefineStringGUC(name, description, boot string, context GUCContext) *StringGUC {
+	return &StringGUC{newStringGUC(publicDesc(name, description, context), boot)}
+}
+
+//Get returns the current value of the setting
+func (g *StringGUC) Get() string {
+	return g.guc.get()
+}
+
+//EnumGUC is an setting of the extension with one of the options, defined with DefineEnumGUC
+type EnumGUC struct {
+	guc *enumGUC
+}
+
+//DefineEnumGUC defines the setting <extension>.<name> with one of the options, boot is the default option, like DefineIntGUC
+func DefineEnumGUC(name, description, boot string, options []string, context GUCContext) *EnumGUC {
+	for i, option := range options {
+		if option == boot {
+			return &EnumGUC{newEnumGUC(publicDesc(name, description, context), i, options)}
+		}
+	}
+	panic(fmt.Sprintf("plgo: setting %s: the default %q isn't an option", name, boot))
+}
+
+//Get returns the current option of the setting
+func (g *EnumGUC) Get() string {
+	return g.guc.options[g.guc.get()]
+}
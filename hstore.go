@@ -0,0 +1,159 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "access/htup_details.h"
+#include "catalog/pg_type.h"
+#include "commands/extension.h"
+#include "utils/lsyscache.h"
+#include "utils/syscache.h"
+
+//plgo_hstore_oid returns the oid of the hstore type in the schema of the hstore extension, InvalidOid without the extension
+Oid plgo_hstore_oid(void) {
+	Oid extension = get_extension_oid("hstore", true);
+
+	if (!OidIsValid(extension))
+		return InvalidOid;
+#if PG_VERSION_NUM >= 120000
+	return GetSysCacheOid2(TYPENAMENSP, Anum_pg_type_oid, CStringGetDatum("hstore"),
+						   ObjectIdGetDatum(get_extension_schema(extension)));
+#else
+	return GetSysCacheOid2(TYPENAMENSP, CStringGetDatum("hstore"),
+						   ObjectIdGetDatum(get_extension_schema(extension)));
+#endif
+}
+
+Datum plgo_text_input(Oid type, char *text) {
+	Oid input, ioparam;
+
+	getTypeInputInfo(type, &input, &ioparam);
+	return OidInputFunctionCall(input, text, ioparam, -1);
+}
+
+char *plgo_text_output(Oid type, Datum value) {
+	Oid output;
+	bool varlena;
+
+	getTypeOutputInfo(type, &output, &varlena);
+	return OidOutputFunctionCall(output, value);
+}
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+//hstoreOid returns the oid of the hstore type, an error if the hstore extension isn't created.
+//It isn't cached, the extension can be recreated
+func hstoreOid() (C.Oid, error) {
+	oid := C.plgo_hstore_oid()
+	if oid == C.InvalidOid {
+		return oid, errors.New("The hstore extension is not created")
+	}
+	return oid, nil
+}
+
+//formatHstore returns the hstore text of the map, the nil values are NULL
+func formatHstore(m map[string]*string) string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = `"` + quote.Replace(key) + `"=>`
+		if value := m[key]; value != nil {
+			pairs[i] += `"` + quote.Replace(*value) + `"`
+		} else {
+			pairs[i] += "NULL"
+		}
+	}
+	return strings.Join(pairs, ", ")
+}
+
+//parseHstore parses the hstore text, as written by the hstore output function: "key"=>"value", "key"=>NULL
+func parseHstore(text string) (map[string]*string, error) {
+	m := make(map[string]*string)
+	//readQuoted reads the quoted string at the start of text, it returns the unescaped string and the rest of text
+	readQuoted := func(text string) (string, string, error) {
+		if !strings.HasPrefix(text, `"`) {
+			return "", "", fmt.Errorf("Invalid hstore %q", text)
+		}
+		var b strings.Builder
+		for i := 1; i < len(text); i++ {
+			switch text[i] {
+			case '\\':
+				i++
+				if i < len(text) {
+					b.WriteByte(text[i])
+				}
+			case '"':
+				return b.String(), text[i+1:], nil
+			default:
+				b.WriteByte(text[i])
+			}
+		}
+		return "", "", fmt.Errorf("Invalid hstore %q", text)
+	}
+	rest := strings.TrimSpace(text)
+	for rest != "" {
+		key, after, err := readQuoted(rest)
+		if err != nil {
+			return nil, err
+		}
+		after = strings.TrimSpace(after)
+		if !strings.HasPrefix(after, "=>") {
+			return nil, fmt.Errorf("Invalid hstore %q", text)
+		}
+		after = strings.TrimSpace(after[2:])
+		if strings.HasPrefix(after, "NULL") {
+			m[key], after = nil, after[4:]
+		} else {
+			value, valueAfter, err := readQuoted(after)
+			if err != nil {
+				return nil, err
+			}
+			m[key], after = &value, valueAfter
+		}
+		rest = strings.TrimPrefix(strings.TrimSpace(after), ",")
+		rest = strings.TrimSpace(rest)
+	}
+	return m, nil
+}
+
+//hstoreDatum converts the map to an hstore datum
+func hstoreDatum(m map[string]*string) Datum {
+	oid, err := hstoreOid()
+	if err != nil {
+		Log.Error(err.Error())
+	}
+	text := C.CString(formatHstore(m))
+	defer C.free(unsafe.Pointer(text))
+	return (Datum)(C.plgo_text_input(oid, text))
+}
+
+//scanHstore sets the map from the hstore datum, an error if the type oid isn't hstore
+func scanHstore(oid C.Oid, typeName string, val C.Datum, dest *map[string]*string) error {
+	hstore, err := hstoreOid()
+	if err != nil {
+		return err
+	}
+	if oid != hstore {
+		return fmt.Errorf("Column type is not hstore %s", typeName)
+	}
+	text := C.plgo_text_output(oid, val)
+	defer C.pfree(unsafe.Pointer(text))
+	m, err := parseHstore(C.GoString(text))
+	if err != nil {
+		return err
+	}
+	*dest = m
+	return nil
+}
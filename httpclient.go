@@ -0,0 +1,60 @@
+package plgo
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+var httpClient *http.Client
+
+//HTTPClient returns the HTTP client of the backend. Its requests are canceled by an query cancel
+//or statement_timeout (the function then returns ErrInterrupted and the backend reports the cancel),
+//so the API calls can't hang the backend. The connections are reused by all calls in the backend.
+//The response body must be closed
+func HTTPClient() *http.Client {
+	if httpClient == nil {
+		//the clone keeps the restrictions of the default transport
+		base := http.DefaultTransport.(*http.Transport).Clone()
+		base.IdleConnTimeout = 5 * time.Minute
+		httpClient = &http.Client{Transport: &interruptTransport{base: base}}
+	}
+	return httpClient
+}
+
+//interruptTransport watches the backend interrupts during the request and reading of the response body
+type interruptTransport struct {
+	base http.RoundTripper
+}
+
+//RoundTrip executes the request, it is canceled when the backend is interrupted
+func (t *interruptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, watcher := watchInterrupts(req.Context())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		watcher.stop()
+		return nil, watcher.err(err)
+	}
+	resp.Body = &interruptBody{ReadCloser: resp.Body, watcher: watcher}
+	return resp, nil
+}
+
+//interruptBody stops the interrupt watcher when the body is closed
+type interruptBody struct {
+	io.ReadCloser
+	watcher *interruptWatcher
+}
+
+func (b *interruptBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = b.watcher.err(err)
+	}
+	return n, err
+}
+
+func (b *interruptBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.watcher.stop()
+	return err
+}
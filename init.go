@@ -0,0 +1,67 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "access/xact.h"
+*/
+import "C"
+import "unsafe"
+
+//initFuncs are run from _PG_init when the extension library is loaded into the backend
+var initFuncs []func()
+
+//abortFuncs are run when the transaction (or a subtransaction) is aborted,
+//e.g. after an ERROR jumped out of Go code
+var abortFuncs []func(subID uint32)
+
+//onInit registers fn to be run from _PG_init,
+//PostgreSQL functions can be called only from there, not from the Go init() functions
+func onInit(fn func()) {
+	initFuncs = append(initFuncs, fn)
+}
+
+//onAbort registers fn to be run on a transaction abort (subID is 0)
+//or on a subtransaction abort (subID is the aborted subtransaction)
+func onAbort(fn func(subID uint32)) {
+	abortFuncs = append(abortFuncs, fn)
+}
+
+//export plgo_init
+func plgo_init() {
+	for _, fn := range initFuncs {
+		fn()
+	}
+}
+
+//export plgo_xact_abort
+func plgo_xact_abort() {
+	//the Rollback of an procedure aborts the transaction without an ERROR
+	if endingTransaction {
+		return
+	}
+	for _, fn := range abortFuncs {
+		fn(0)
+	}
+}
+
+//export plgo_subxact_abort
+func plgo_subxact_abort(subID C.SubTransactionId) {
+	for _, fn := range abortFuncs {
+		fn(uint32(subID))
+	}
+}
+
+//export plgo_worker_run
+func plgo_worker_run(name *C.char, arg C.int64) C.int {
+	return C.int(runWorker(C.GoString(name), int64(arg)))
+}
+
+//export plgo_aggregate_release
+func plgo_aggregate_release(handle C.uint64) {
+	releaseAggregate(uint64(handle))
+}
+
+//export plgo_notification
+func plgo_notification(msg unsafe.Pointer, length C.int) {
+	receiveNotification(C.GoBytes(msg, length))
+}
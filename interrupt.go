@@ -0,0 +1,112 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "miscadmin.h"
+
+int plgo_interrupt_pending(void) {
+	return InterruptPending && (QueryCancelPending || ProcDiePending);
+}
+*/
+import "C"
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//ErrInterrupted is returned when an operation was canceled by an query cancel,
+//statement_timeout or backend termination
+var ErrInterrupted = errors.New("plgo: canceled by query cancel or statement timeout")
+
+//interruptPollInterval is how often the interrupt flags are checked while Go code waits
+const interruptPollInterval = 50 * time.Millisecond
+
+//interruptPending reports whether the backend received an query cancel (including statement_timeout) or termination,
+//the flags are set by the signal handlers, so they can be read while the backend waits in Go code.
+//The interrupt itself is processed by the backend at the next CHECK_FOR_INTERRUPTS
+func interruptPending() bool {
+	return C.plgo_interrupt_pending() != 0
+}
+
+//interruptWatchers are the running watchers, they are stopped when the transaction aborts
+var interruptWatchers = struct {
+	sync.Mutex
+	running map[*interruptWatcher]bool
+}{running: make(map[*interruptWatcher]bool)}
+
+//interruptWatcher cancels an context when the backend is interrupted
+type interruptWatcher struct {
+	cancel      context.CancelFunc
+	done        chan struct{}
+	once        sync.Once
+	interrupted atomic.Bool
+}
+
+//watchInterrupts returns an context derived from parent that is canceled on an interrupt of the backend,
+//the watcher must be stopped when the operation finished
+func watchInterrupts(parent context.Context) (context.Context, *interruptWatcher) {
+	ctx, cancel := context.WithCancel(parent)
+	w := &interruptWatcher{cancel: cancel, done: make(chan struct{})}
+	interruptWatchers.Lock()
+	interruptWatchers.running[w] = true
+	interruptWatchers.Unlock()
+	go func() {
+		ticker := time.NewTicker(interruptPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if interruptPending() {
+					w.interrupted.Store(true)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return ctx, w
+}
+
+//stop stops the watcher and cancels its context
+func (w *interruptWatcher) stop() {
+	w.once.Do(func() {
+		close(w.done)
+		w.cancel()
+		interruptWatchers.Lock()
+		delete(interruptWatchers.running, w)
+		interruptWatchers.Unlock()
+	})
+}
+
+//err returns ErrInterrupted if the context was canceled by an interrupt, otherwise err
+func (w *interruptWatcher) err(err error) error {
+	if err != nil && w.interrupted.Load() {
+		return ErrInterrupted
+	}
+	return err
+}
+
+func init() {
+	//the operations interrupted by an ERROR are never finished
+	onAbort(func(subID uint32) {
+		if subID != 0 {
+			return
+		}
+		interruptWatchers.Lock()
+		watchers := make([]*interruptWatcher, 0, len(interruptWatchers.running))
+		for w := range interruptWatchers.running {
+			watchers = append(watchers, w)
+		}
+		interruptWatchers.Unlock()
+		for _, w := range watchers {
+			w.stop()
+		}
+	})
+}
@@ -0,0 +1,485 @@
+package plgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//JobFunc is the Go function of an scheduled job, it runs in an transaction which is committed if it returns nil
+type JobFunc func(db *DB) error
+
+//job is an registered scheduled job
+type job struct {
+	name     string
+	schedule string
+	fn       JobFunc
+}
+
+//jobs are the registered jobs by name
+var jobs = make(map[string]*job)
+
+//background workers of the scheduler
+const (
+	jobSchedulerName = "job scheduler"
+	jobRunnerName    = "job runner"
+)
+
+//jobsDatabase is <extension>.jobs_database
+var jobsDatabase *stringGUC
+
+//RegisterJob registers an Go job run by the cron schedule (e.g. "*/5 * * * *" or "@daily", in UTC).
+//The schedule is stored in the <extension>_jobs table when the scheduler starts,
+//where it can be changed, the job disabled or its retries configured.
+//The jobs are run by an background worker connected to the <extension>.jobs_database,
+//so the extension must be loaded with shared_preload_libraries.
+//It must be called from an init() function of the package
+func RegisterJob(name, schedule string, fn JobFunc) {
+	if _, err := parseCron(schedule); err != nil {
+		panic(fmt.Sprintf("plgo: job %s: %s", name, err))
+	}
+	jobs[name] = &job{name: name, schedule: schedule, fn: fn}
+	if jobsDatabase != nil {
+		return
+	}
+	jobsDatabase = newStringGUC(gucDesc{
+		name:      "jobs_database",
+		shortDesc: "Sets the database where the scheduled jobs of the extension run.",
+		context:   gucPostmaster,
+	}, "postgres")
+	database := func() string { return jobsDatabase.get() }
+	registerWorker(&worker{name: jobSchedulerName, database: database, restart: 10 * time.Second, main: scheduleJobs})
+	registerWorker(&worker{name: jobRunnerName, database: database, dynamic: true, main: runJob})
+}
+
+//cronSchedule is an parsed cron expression, the fields are bitmaps of the allowed values
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	//domStar and dowStar are true if the day field is *, the days are matched as in cron:
+	//if both day fields are restricted, either of them matches
+	domStar, dowStar bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+//parseCron parses the 5 field cron expression: minute hour day-of-month month day-of-week,
+//the fields can be *, numbers, ranges (1-5), steps (*/10, 0-30/5) and lists (1,15)
+func parseCron(expr string) (*cronSchedule, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var bits [5]uint64
+	for i, field := range fields {
+		var err error
+		if bits[i], err = parseCronField(field, bounds[i][0], bounds[i][1]); err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+	}
+	//sunday is 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronSchedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domStar: fields[2] == "*", dowStar: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+		}
+		from, to := min, max
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("invalid range %q", part)
+				}
+			} else if hasStep {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("value out of range %q", part)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+//matches reports whether the schedule runs in the minute of t
+func (s *cronSchedule) matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+//jobConfig is an row of the <extension>_jobs table
+type jobConfig struct {
+	Name       string  `json:"name"`
+	Schedule   string  `json:"schedule"`
+	Enabled    bool    `json:"enabled"`
+	MaxRetries int     `json:"max_retries"`
+	RetryDelay float64 `json:"retry_delay"`
+}
+
+//jobRun is an run of an job started by the scheduler
+type jobRun struct {
+	id      int64
+	job     string
+	attempt int
+	handle  *workerHandle
+}
+
+//jobRetry is an failed run waiting for the retry
+type jobRetry struct {
+	job     string
+	attempt int
+	at      time.Time
+}
+
+//scheduler is the state of the scheduler worker
+type scheduler struct {
+	ctx *workerContext
+	//schema of the extension, empty until the extension is found in the database
+	schema     string
+	lastLookup time.Time
+	lastMinute time.Time
+	configs    map[string]jobConfig
+	running    map[int64]*jobRun
+	retries    []jobRetry
+}
+
+//table returns the qualified name of the extension table
+func (s *scheduler) table(name string) string {
+	return QuoteIdent(s.schema) + "." + QuoteIdent(extensionName+"_"+name)
+}
+
+//scheduleJobs is the main function of the scheduler worker
+func scheduleJobs(ctx *workerContext) error {
+	s := &scheduler{ctx: ctx, running: make(map[int64]*jobRun), configs: make(map[string]jobConfig)}
+	for ctx.Wait(time.Second) {
+		if s.schema == "" && !s.lookupSchema() {
+			continue
+		}
+		s.checkRunning()
+		now := time.Now().UTC()
+		if minute := now.Truncate(time.Minute); minute.After(s.lastMinute) {
+			s.lastMinute = minute
+			s.loadConfigs()
+			for _, config := range s.configs {
+				schedule, err := parseCron(config.Schedule)
+				if err != nil {
+					Log.Warning("invalid job schedule", "job", config.Name, "error", err)
+					continue
+				}
+				if config.Enabled && schedule.matches(minute) {
+					s.start(config.Name, 1)
+				}
+			}
+		}
+		pending := s.retries
+		s.retries = nil
+		for _, retry := range pending {
+			if now.Before(retry.at) {
+				s.retries = append(s.retries, retry)
+				continue
+			}
+			s.start(retry.job, retry.attempt)
+		}
+	}
+	return nil
+}
+
+//lookupSchema finds the schema of the extension and stores the registered jobs into its table,
+//the lookup is repeated every minute until the extension is created in the database
+func (s *scheduler) lookupSchema() bool {
+	if time.Since(s.lastLookup) < time.Minute {
+		return false
+	}
+	s.lastLookup = time.Now()
+	err := s.ctx.Transaction(func(db *DB) error {
+		var err error
+		if s.schema, err = extensionSchema(db); err != nil || s.schema == "" {
+			return err
+		}
+		insert, err := db.Prepare("INSERT INTO "+s.table("jobs")+" (name, schedule) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING",
+			[]string{"text", "text"})
+		if err != nil {
+			return err
+		}
+		for _, j := range jobs {
+			if err = insert.Exec(j.name, j.schedule); err != nil {
+				return err
+			}
+		}
+		//the runs of the previous scheduler can't be followed anymore
+		stale, err := db.Prepare("WITH stale AS (UPDATE "+s.table("job_runs")+" SET status = 'failed', finished_at = now(), "+
+			"error = 'scheduler restarted' WHERE status IN ('scheduled', 'running') RETURNING 1) SELECT count(*) FROM stale", nil)
+		if err != nil {
+			return err
+		}
+		_, err = stale.QueryRow()
+		return err
+	})
+	if err != nil {
+		Log.Warning("cannot initialize the job scheduler", "error", err)
+		s.schema = ""
+	}
+	return s.schema != ""
+}
+
+//loadConfigs reads the <extension>_jobs table
+func (s *scheduler) loadConfigs() {
+	err := s.ctx.Transaction(func(db *DB) error {
+		stmt, err := db.Prepare("SELECT coalesce(json_agg(j), '[]')::text FROM (SELECT name, schedule, enabled, max_retries, "+
+			"extract(epoch FROM retry_delay)::float8 AS retry_delay FROM "+s.table("jobs")+") j", nil)
+		if err != nil {
+			return err
+		}
+		row, err := stmt.QueryRow()
+		if err != nil {
+			return err
+		}
+		var data string
+		if err = row.Scan(&data); err != nil {
+			return err
+		}
+		var configs []jobConfig
+		if err = json.Unmarshal([]byte(data), &configs); err != nil {
+			return err
+		}
+		s.configs = make(map[string]jobConfig)
+		for _, config := range configs {
+			if _, ok := jobs[config.Name]; ok {
+				s.configs[config.Name] = config
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		Log.Warning("cannot read the jobs", "error", err)
+	}
+}
+
+//start records the run and starts an runner worker for it,
+//the run is skipped if the previous run of the job is still running
+func (s *scheduler) start(name string, attempt int) {
+	for _, run := range s.running {
+		if run.job == name {
+			s.insertRun(name, attempt, "skipped", "previous run is still running")
+			return
+		}
+	}
+	id, err := s.insertRun(name, attempt, "scheduled", "")
+	if err != nil {
+		Log.Warning("cannot schedule job", "job", name, "error", err)
+		return
+	}
+	handle, err := startWorker(jobRunnerName, id)
+	if err != nil {
+		s.finishRun(id, err.Error())
+		s.retry(&jobRun{id: id, job: name, attempt: attempt})
+		return
+	}
+	s.running[id] = &jobRun{id: id, job: name, attempt: attempt, handle: handle}
+}
+
+func (s *scheduler) insertRun(name string, attempt int, status, runError string) (id int64, err error) {
+	err = s.ctx.Transaction(func(db *DB) error {
+		stmt, err := db.Prepare("INSERT INTO "+s.table("job_runs")+" (job, attempt, status, error, finished_at) "+
+			"VALUES ($1, $2, $3, nullif($4, ''), CASE WHEN $3 = 'skipped' THEN now() END) RETURNING id",
+			[]string{"text", "integer", "text", "text"})
+		if err != nil {
+			return err
+		}
+		row, err := stmt.QueryRow(name, int32(attempt), status, runError)
+		if err != nil {
+			return err
+		}
+		return row.Scan(&id)
+	})
+	return
+}
+
+//finishRun marks the run failed if the runner didn't record its result, returns the final status
+func (s *scheduler) finishRun(id int64, runError string) (status string) {
+	err := s.ctx.Transaction(func(db *DB) error {
+		stmt, err := db.Prepare("UPDATE "+s.table("job_runs")+" SET status = CASE WHEN status IN ('scheduled', 'running') "+
+			"THEN 'failed' ELSE status END, error = CASE WHEN status IN ('scheduled', 'running') THEN $2 ELSE error END, "+
+			"finished_at = coalesce(finished_at, now()) WHERE id = $1 RETURNING status", []string{"bigint", "text"})
+		if err != nil {
+			return err
+		}
+		row, err := stmt.QueryRow(id, runError)
+		if err != nil {
+			return err
+		}
+		return row.Scan(&status)
+	})
+	if err != nil {
+		Log.Warning("cannot finish job run", "run", id, "error", err)
+		return "failed"
+	}
+	return status
+}
+
+//checkRunning finishes the runs whose workers exited
+func (s *scheduler) checkRunning() {
+	for id, run := range s.running {
+		if !run.handle.stopped() {
+			continue
+		}
+		delete(s.running, id)
+		if s.finishRun(id, "job worker exited with an error, see the server log") == "failed" {
+			s.retry(run)
+		}
+	}
+}
+
+//retry schedules the next attempt of the failed run, if the job has retries left
+func (s *scheduler) retry(run *jobRun) {
+	config, ok := s.configs[run.job]
+	if !ok || run.attempt > config.MaxRetries {
+		return
+	}
+	delay := time.Duration(config.RetryDelay * float64(time.Second))
+	s.retries = append(s.retries, jobRetry{job: run.job, attempt: run.attempt + 1, at: time.Now().UTC().Add(delay)})
+}
+
+//errJobLocked is returned when the job is already running
+var errJobLocked = errors.New("job is already running")
+
+//runJob is the main function of the runner worker, it runs the job of the run ctx.arg
+func runJob(ctx *workerContext) error {
+	id := ctx.arg
+	s := &scheduler{}
+	var name string
+	err := ctx.Transaction(func(db *DB) error {
+		stmt, err := db.Prepare("SELECT n.nspname::text FROM pg_catalog.pg_extension e "+
+			"JOIN pg_catalog.pg_namespace n ON n.oid = e.extnamespace WHERE e.extname = $1", []string{"text"})
+		if err != nil {
+			return err
+		}
+		row, err := stmt.QueryRow(extensionName)
+		if err != nil {
+			return err
+		}
+		if err = row.Scan(&s.schema); err != nil {
+			return err
+		}
+		start, err := db.Prepare("UPDATE "+s.table("job_runs")+" SET status = 'running', started_at = clock_timestamp() "+
+			"WHERE id = $1 RETURNING job", []string{"bigint"})
+		if err != nil {
+			return err
+		}
+		if row, err = start.QueryRow(id); err != nil {
+			return err
+		}
+		return row.Scan(&name)
+	})
+	if err != nil {
+		return err
+	}
+	j, ok := jobs[name]
+	if !ok {
+		return recordRun(ctx, s, id, fmt.Errorf("job %s is not registered", name))
+	}
+	err = ctx.Transaction(func(db *DB) error {
+		lock, err := db.Prepare("SELECT pg_catalog.pg_try_advisory_xact_lock(pg_catalog.hashtext($1))", []string{"text"})
+		if err != nil {
+			return err
+		}
+		row, err := lock.QueryRow(extensionName + "." + name)
+		if err != nil {
+			return err
+		}
+		var locked bool
+		if err = row.Scan(&locked); err != nil {
+			return err
+		}
+		if !locked {
+			return errJobLocked
+		}
+		if err = runJobFunc(j, db); err != nil {
+			return err
+		}
+		return succeedRun(db, s, id)
+	})
+	if err != nil {
+		return recordRun(ctx, s, id, err)
+	}
+	return nil
+}
+
+//runJobFunc calls the job function, its panic is returned as an error
+func runJobFunc(j *job, db *DB) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			Log.Warning("panic in job", "job", j.name, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.fn(db)
+}
+
+func succeedRun(db *DB, s *scheduler, id int64) error {
+	stmt, err := db.Prepare("UPDATE "+s.table("job_runs")+" SET status = 'succeeded', finished_at = clock_timestamp() "+
+		"WHERE id = $1 RETURNING id", []string{"bigint"})
+	if err != nil {
+		return err
+	}
+	_, err = stmt.QueryRow(id)
+	return err
+}
+
+//recordRun records the failed run in its own transaction, the transaction of the job was rolled back
+func recordRun(ctx *workerContext, s *scheduler, id int64, runError error) error {
+	return ctx.Transaction(func(db *DB) error {
+		stmt, err := db.Prepare("UPDATE "+s.table("job_runs")+" SET status = 'failed', finished_at = clock_timestamp(), "+
+			"error = $2 WHERE id = $1 RETURNING id", []string{"bigint", "text"})
+		if err != nil {
+			return err
+		}
+		_, err = stmt.QueryRow(id, RedactSecrets(runError.Error()))
+		return err
+	})
+}
@@ -0,0 +1,34 @@
+package plgo
+
+import "errors"
+
+//JSONB is an raw jsonb document, it is passed to and returned from the functions without (un)marshaling.
+//The structs declared in the package are jsonb too, they are (un)marshaled with encoding/json
+type JSONB []byte
+
+//document returns the document, nil is null
+func (j JSONB) document() []byte {
+	if j == nil {
+		return []byte("null")
+	}
+	return j
+}
+
+//MarshalJSON returns the document
+func (j JSONB) MarshalJSON() ([]byte, error) {
+	return j.document(), nil
+}
+
+//UnmarshalJSON sets the document to an copy of data
+func (j *JSONB) UnmarshalJSON(data []byte) error {
+	if j == nil {
+		return errors.New("plgo.JSONB: UnmarshalJSON on nil pointer")
+	}
+	*j = append((*j)[0:0], data...)
+	return nil
+}
+
+//String returns the document
+func (j JSONB) String() string {
+	return string(j)
+}
@@ -0,0 +1,144 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "libpq/libpq-fs.h"
+#include "storage/large_object.h"
+#include "utils/memutils.h"
+
+LargeObjectDesc *lo_open_desc(Oid oid, int mode) {
+	return inv_open(oid, mode, TopTransactionContext);
+}
+*/
+import "C"
+import (
+	"errors"
+	"io"
+	"unsafe"
+)
+
+//Oid is an PostgreSQL object identifier
+type Oid uint32
+
+//LargeObjectMode is the mode in which the large object is opened
+type LargeObjectMode int
+
+//LargeObjectMode constants, can be combined LORead|LOWrite
+const (
+	LORead  LargeObjectMode = C.INV_READ
+	LOWrite LargeObjectMode = C.INV_WRITE
+)
+
+//maxLargeObjectChunk is the maximum number of bytes read or written in one inv_read/inv_write call
+const maxLargeObjectChunk = 1 << 30
+
+//LargeObject is an opened large object, it implements io.ReadWriteSeeker and io.Closer.
+//The large object must be closed before the end of the transaction
+type LargeObject struct {
+	oid  Oid
+	desc *C.LargeObjectDesc
+}
+
+//CreateLargeObject creates a new empty large object and returns its Oid
+func CreateLargeObject() (Oid, error) {
+	oid := C.inv_create(0) // InvalidOid lets the server assign the Oid
+	if oid == 0 {
+		return 0, errors.New("Cannot create large object")
+	}
+	return Oid(oid), nil
+}
+
+//OpenLargeObject opens the large object with the mode
+func OpenLargeObject(oid Oid, mode LargeObjectMode) (*LargeObject, error) {
+	if mode&(LORead|LOWrite) == 0 {
+		return nil, errors.New("Large object mode must contain LORead or LOWrite")
+	}
+	desc := C.lo_open_desc(C.Oid(oid), C.int(mode))
+	if desc == nil {
+		return nil, errors.New("Cannot open large object")
+	}
+	return &LargeObject{oid: oid, desc: desc}, nil
+}
+
+//UnlinkLargeObject removes the large object from the database
+func UnlinkLargeObject(oid Oid) error {
+	if C.inv_drop(C.Oid(oid)) != 1 {
+		return errors.New("Cannot remove large object")
+	}
+	return nil
+}
+
+//Oid returns the Oid of the large object
+func (lo *LargeObject) Oid() Oid {
+	return lo.oid
+}
+
+//Read reads up to len(p) bytes from the current position
+func (lo *LargeObject) Read(p []byte) (int, error) {
+	if lo.desc == nil {
+		return 0, errors.New("Large object is closed")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(p) > maxLargeObjectChunk {
+		p = p[:maxLargeObjectChunk]
+	}
+	n := int(C.inv_read(lo.desc, (*C.char)(unsafe.Pointer(&p[0])), C.int(len(p))))
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+//Write writes p at the current position
+func (lo *LargeObject) Write(p []byte) (int, error) {
+	if lo.desc == nil {
+		return 0, errors.New("Large object is closed")
+	}
+	written := 0
+	for written < len(p) {
+		chunk := p[written:]
+		if len(chunk) > maxLargeObjectChunk {
+			chunk = chunk[:maxLargeObjectChunk]
+		}
+		n := int(C.inv_write(lo.desc, (*C.char)(unsafe.Pointer(&chunk[0])), C.int(len(chunk))))
+		written += n
+		if n < len(chunk) {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+//Seek sets the position for the next Read or Write, whence is io.SeekStart, io.SeekCurrent or io.SeekEnd
+func (lo *LargeObject) Seek(offset int64, whence int) (int64, error) {
+	if lo.desc == nil {
+		return 0, errors.New("Large object is closed")
+	}
+	switch whence {
+	case io.SeekStart, io.SeekCurrent, io.SeekEnd:
+	default:
+		return 0, errors.New("Invalid whence")
+	}
+	return int64(C.inv_seek(lo.desc, C.int64(offset), C.int(whence))), nil
+}
+
+//Truncate truncates (or extends) the large object to size
+func (lo *LargeObject) Truncate(size int64) error {
+	if lo.desc == nil {
+		return errors.New("Large object is closed")
+	}
+	C.inv_truncate(lo.desc, C.int64(size))
+	return nil
+}
+
+//Close closes the large object
+func (lo *LargeObject) Close() error {
+	if lo.desc == nil {
+		return errors.New("Large object is already closed")
+	}
+	C.inv_close(lo.desc)
+	lo.desc = nil
+	return nil
+}
@@ -0,0 +1,222 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "commands/async.h"
+#include "libpq/libpq.h"
+#include "libpq/pqcomm.h"
+#include "tcop/tcopprot.h"
+
+extern void plgo_notification(void *msg, int len);
+
+//the listener worker has no client, the notifications are sent to the client (NotifyMyFrontEnd)
+//as the NotificationResponse protocol messages, they are dispatched to Go and the other messages are dropped
+static int plgo_listen_putmessage(char msgtype, const char *s, size_t len) {
+	if (msgtype == 'A')
+		plgo_notification((void *) s, (int) len);
+	return 0;
+}
+
+static void plgo_listen_putmessage_noblock(char msgtype, const char *s, size_t len) {
+	(void) plgo_listen_putmessage(msgtype, s, len);
+}
+
+static void plgo_listen_comm_reset(void) {
+}
+
+static int plgo_listen_flush(void) {
+	return 0;
+}
+
+static bool plgo_listen_is_send_pending(void) {
+	return false;
+}
+
+#if PG_VERSION_NUM < 140000
+static void plgo_listen_startcopyout(void) {
+}
+
+static void plgo_listen_endcopyout(bool errorAbort) {
+}
+#endif
+
+static const PQcommMethods plgo_listen_comm_methods = {
+	.comm_reset = plgo_listen_comm_reset,
+	.flush = plgo_listen_flush,
+	.flush_if_writable = plgo_listen_flush,
+	.is_send_pending = plgo_listen_is_send_pending,
+	.putmessage = plgo_listen_putmessage,
+	.putmessage_noblock = plgo_listen_putmessage_noblock,
+#if PG_VERSION_NUM < 140000
+	.startcopyout = plgo_listen_startcopyout,
+	.endcopyout = plgo_listen_endcopyout,
+#endif
+};
+
+//plgo_listen_start redirects the messages to the client into plgo_listen_putmessage, as the parallel workers
+//redirect them into the shared memory queue. The protocol version 3 has the payload in the notifications
+void plgo_listen_start(void) {
+	PqCommMethods = &plgo_listen_comm_methods;
+	whereToSendOutput = DestRemote;
+	FrontendProtocol = PG_PROTOCOL(3, 0);
+}
+
+void plgo_listen(char *channel) {
+	Async_Listen(channel);
+}
+
+//the longest payload of an notification, as in async.c
+int plgo_notify_payload_max_length(void) {
+	return BLCKSZ - NAMEDATALEN - 128;
+}
+
+void plgo_notify(char *channel, char *payload) {
+	Async_Notify(channel, payload);
+}
+
+void plgo_process_notifies(void) {
+	if (notifyInterruptPending)
+		ProcessNotifyInterrupt(false);
+}
+*/
+import "C"
+import (
+	"bytes"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+//Notification is an message sent by NOTIFY or pg_notify
+type Notification struct {
+	Channel string
+	Payload string
+}
+
+//NotificationHandler handles the notification in an transaction, which is committed if it returns nil
+type NotificationHandler func(db *DB, n Notification) error
+
+//listeners are the handlers by channel
+var listeners = make(map[string][]NotificationHandler)
+
+//listenerWorkerName is the name of the background worker listening on the channels
+const listenerWorkerName = "listener"
+
+//listenDatabase is <extension>.listen_database
+var listenDatabase *stringGUC
+
+//pendingNotifications are the received notifications waiting for the dispatch
+var pendingNotifications []Notification
+
+//Listen registers the handler of the notifications sent to the channel (the channel name is case sensitive,
+//as in pg_notify). The notifications are received by an background worker connected to the <extension>.listen_database,
+//so the extension must be loaded with shared_preload_libraries.
+//It must be called from an init() function of the package
+func Listen(channel string, handler NotificationHandler) {
+	listeners[channel] = append(listeners[channel], handler)
+	if listenDatabase != nil {
+		return
+	}
+	listenDatabase = newStringGUC(gucDesc{
+		name:      "listen_database",
+		shortDesc: "Sets the database where the extension listens for notifications.",
+		context:   gucPostmaster,
+	}, "postgres")
+	registerWorker(&worker{
+		name:     listenerWorkerName,
+		database: func() string { return listenDatabase.get() },
+		restart:  10 * time.Second,
+		main:     listenNotifications,
+	})
+}
+
+//Notify sends the notification to the channel as pg_notify, it is delivered when the transaction commits
+//(and dropped when it rolls back). The channel must be shorter than 64 bytes and the payload than 8000 bytes,
+//neither can contain an zero byte
+func Notify(channel, payload string) error {
+	if channel == "" {
+		return fmt.Errorf("Notify: the channel name can't be empty")
+	}
+	if len(channel) >= C.NAMEDATALEN {
+		return fmt.Errorf("Notify: the channel name %s is too long", channel)
+	}
+	if max := int(C.plgo_notify_payload_max_length()); len(payload) >= max {
+		return fmt.Errorf("Notify: the payload of %d bytes is too long, the limit is %d bytes", len(payload), max-1)
+	}
+	if strings.IndexByte(channel, 0) >= 0 || strings.IndexByte(payload, 0) >= 0 {
+		return fmt.Errorf("Notify: the channel name and the payload can't contain an zero byte")
+	}
+	cchannel := C.CString(channel)
+	defer C.free(unsafe.Pointer(cchannel))
+	cpayload := C.CString(payload)
+	defer C.free(unsafe.Pointer(cpayload))
+	//Async_Notify copies the notification into the transaction memory, the C strings can be freed
+	C.plgo_notify(cchannel, cpayload)
+	return nil
+}
+
+//receiveNotification is called with the NotificationResponse message received by the listener worker
+func receiveNotification(msg []byte) {
+	if n, ok := parseNotification(msg); ok {
+		pendingNotifications = append(pendingNotifications, n)
+	}
+}
+
+//parseNotification parses the NotificationResponse message: the int32 pid of the notifying backend,
+//the channel and the payload as zero terminated strings (they can't contain an zero byte)
+func parseNotification(msg []byte) (Notification, bool) {
+	if len(msg) < 4 {
+		return Notification{}, false
+	}
+	fields := bytes.SplitN(msg[4:], []byte{0}, 3)
+	if len(fields) != 3 || len(fields[2]) != 0 {
+		return Notification{}, false
+	}
+	return Notification{Channel: string(fields[0]), Payload: string(fields[1])}, true
+}
+
+//listenNotifications is the main function of the listener worker
+func listenNotifications(ctx *workerContext) error {
+	C.plgo_listen_start()
+	err := ctx.Transaction(func(db *DB) error {
+		for channel := range listeners {
+			cchannel := C.CString(channel)
+			C.plgo_listen(cchannel)
+			C.free(unsafe.Pointer(cchannel))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	//the worker is woken up by the latch when an notification arrives
+	for ctx.Wait(time.Minute) {
+		C.plgo_process_notifies()
+		notifications := pendingNotifications
+		pendingNotifications = nil
+		for _, n := range notifications {
+			for _, handler := range listeners[n.Channel] {
+				err := ctx.Transaction(func(db *DB) error {
+					return runNotificationHandler(handler, db, n)
+				})
+				if err != nil {
+					Log.Warning("notification handler failed", "channel", n.Channel, "error", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//runNotificationHandler calls the handler, its panic is returned as an error
+func runNotificationHandler(handler NotificationHandler, db *DB, n Notification) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			Log.Warning("panic in notification handler", "channel", n.Channel, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(db, n)
+}
@@ -0,0 +1,296 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "utils/elog.h"
+#include <stdlib.h>
+
+//plgo_pstrdup copies the string allocated by C.CString into the current memory context and frees it
+static char *plgo_pstrdup(char *s) {
+	char *copy;
+	if (s == NULL)
+		return NULL;
+	copy = pstrdup(s);
+	free(s);
+	return copy;
+}
+
+//plgo_ereport reports the message with the level, the SQLSTATE, the detail and the hint are added if not NULL.
+//It takes the strings allocated by C.CString: they are copied into the current memory context before ereport,
+//because ereport(ERROR) doesn't return, the copies are freed with the context
+void plgo_ereport(int level, char *sqlstate, char *message, char *detail, char *hint) {
+	sqlstate = plgo_pstrdup(sqlstate);
+	message = plgo_pstrdup(message);
+	detail = plgo_pstrdup(detail);
+	hint = plgo_pstrdup(hint);
+	ereport(level, (sqlstate != NULL ? errcode(MAKE_SQLSTATE(sqlstate[0], sqlstate[1], sqlstate[2], sqlstate[3], sqlstate[4])) : 0,
+					errmsg("%s", message),
+					detail != NULL ? errdetail("%s", detail) : 0,
+					hint != NULL ? errhint("%s", hint) : 0));
+	pfree(message);
+	if (sqlstate != NULL)
+		pfree(sqlstate);
+	if (detail != NULL)
+		pfree(detail);
+	if (hint != NULL)
+		pfree(hint);
+}
+*/
+import "C"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//LogLevel is the elog level of an log message
+type LogLevel int
+
+//LogLevel constants
+const (
+	LevelDebug   LogLevel = C.DEBUG1
+	LevelLog     LogLevel = C.LOG
+	LevelInfo    LogLevel = C.INFO
+	LevelNotice  LogLevel = C.NOTICE
+	LevelWarning LogLevel = C.WARNING
+	LevelError   LogLevel = C.ERROR
+)
+
+//logLevels are the options of <extension>.log_level
+var logLevels = []LogLevel{LevelDebug, LevelLog, LevelInfo, LevelNotice, LevelWarning, LevelError}
+
+//minLogLevel is <extension>.log_level, the messages below this level are not written
+var minLogLevel = newEnumGUC(gucDesc{
+	name:      "log_level",
+	shortDesc: "Sets the message levels of the extension that are logged.",
+	longDesc:  "Each level includes all the levels that follow it. Errors are always reported.",
+	context:   gucUserset,
+}, 1, []string{"debug", "log", "info", "notice", "warning", "error"})
+
+//Enabled reports whether the messages of the level are written, see <extension>.log_level
+func (level LogLevel) Enabled() bool {
+	return level >= LevelError || level >= logLevels[minLogLevel.get()]
+}
+
+//LogFormat is the format of the structured log lines
+type LogFormat int
+
+//LogFormat constants
+const (
+	//FormatKeyValue formats the log line as msg="..." key=value ...
+	FormatKeyValue LogFormat = iota
+	//FormatJSON formats the log line as an JSON object
+	FormatJSON
+)
+
+//Logger writes structured log lines with key/value fields into the PostgreSQL log.
+//Every line contains also the name of the running exported function and the id of its call
+type Logger struct {
+	format LogFormat
+	fields []interface{}
+	//code is the SQLSTATE, detail and hint are the DETAIL and HINT of the messages
+	code, detail, hint string
+}
+
+//Log is the default structured logger
+var Log = &Logger{}
+
+//With returns a new Logger that adds the key/value pairs to every log line
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	logger := *l
+	logger.fields = fields
+	return &logger
+}
+
+//WithFormat returns a new Logger that writes the log lines in the format
+func (l *Logger) WithFormat(format LogFormat) *Logger {
+	logger := *l
+	logger.format = format
+	return &logger
+}
+
+//WithCode returns a new Logger that reports the messages with the SQLSTATE code, e.g. 01000 (warning)
+//or 23505 (unique_violation) for Error, so the clients can handle them programmatically.
+//The invalid codes are ignored
+func (l *Logger) WithCode(code string) *Logger {
+	logger := *l
+	logger.code = code
+	return &logger
+}
+
+//WithDetail returns a new Logger that reports the messages with the DETAIL
+func (l *Logger) WithDetail(detail string) *Logger {
+	logger := *l
+	logger.detail = detail
+	return &logger
+}
+
+//WithHint returns a new Logger that reports the messages with the HINT
+func (l *Logger) WithHint(hint string) *Logger {
+	logger := *l
+	logger.hint = hint
+	return &logger
+}
+
+//Debug writes the message with DEBUG1 level
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.write(LevelDebug, msg, keyvals)
+}
+
+//Log writes the message with LOG level (only into the server log)
+func (l *Logger) Log(msg string, keyvals ...interface{}) {
+	l.write(LevelLog, msg, keyvals)
+}
+
+//Info writes the message with INFO level
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.write(LevelInfo, msg, keyvals)
+}
+
+//Notice writes the message with NOTICE level
+func (l *Logger) Notice(msg string, keyvals ...interface{}) {
+	l.write(LevelNotice, msg, keyvals)
+}
+
+//Warning writes the message with WARNING level
+func (l *Logger) Warning(msg string, keyvals ...interface{}) {
+	l.write(LevelWarning, msg, keyvals)
+}
+
+//Error writes the message with ERROR level, this aborts the current transaction
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.write(LevelError, msg, keyvals)
+}
+
+//Debugf writes the formatted message with DEBUG1 level
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.write(LevelDebug, fmt.Sprintf(format, args...), nil)
+}
+
+//Logf writes the formatted message with LOG level (only into the server log)
+func (l *Logger) Logf(format string, args ...interface{}) {
+	l.write(LevelLog, fmt.Sprintf(format, args...), nil)
+}
+
+//Infof writes the formatted message with INFO level
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.write(LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+
+//Noticef writes the formatted message with NOTICE level
+func (l *Logger) Noticef(format string, args ...interface{}) {
+	l.write(LevelNotice, fmt.Sprintf(format, args...), nil)
+}
+
+//Warningf writes the formatted message with WARNING level
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.write(LevelWarning, fmt.Sprintf(format, args...), nil)
+}
+
+//Errorf writes the formatted message with ERROR level, this aborts the current transaction
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.write(LevelError, fmt.Sprintf(format, args...), nil)
+}
+
+func (l *Logger) write(level LogLevel, msg string, keyvals []interface{}) {
+	if !level.Enabled() {
+		return
+	}
+	code := l.code
+	if !validSQLState(code) {
+		code = ""
+	}
+	writeReport(level, code, l.Format(msg, keyvals...), RedactSecrets(l.detail), RedactSecrets(l.hint))
+}
+
+//writeLine writes the formatted line with the level, regardless of <extension>.log_level
+func writeLine(level LogLevel, line string) {
+	writeReport(level, "", line, "", "")
+}
+
+//writeReport reports the line with the level, the SQLSTATE code, the detail and the hint ("" are not reported)
+func writeReport(level LogLevel, code, line, detail, hint string) {
+	cstrings := []*C.char{C.CString(line), nil, nil, nil}
+	for i, s := range []string{code, detail, hint} {
+		if s != "" {
+			cstrings[i+1] = C.CString(s)
+		}
+	}
+	//plgo_ereport frees the strings, also when ereport(ERROR) doesn't return
+	C.plgo_ereport(C.int(level), cstrings[1], cstrings[0], cstrings[2], cstrings[3])
+}
+
+//Format returns the log line that would be written for the message and key/value pairs
+func (l *Logger) Format(msg string, keyvals ...interface{}) string {
+	fields := []interface{}{"msg", msg}
+	if call := currentCall(); call != nil {
+		fields = append(fields, "function", call.name, "call_id", call.id)
+	}
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, "(MISSING)")
+	}
+	if l.format == FormatJSON {
+		return RedactSecrets(formatJSON(fields))
+	}
+	return RedactSecrets(formatKeyValue(fields))
+}
+
+func formatKeyValue(fields []interface{}) string {
+	var b strings.Builder
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(fmt.Sprint(fields[i]))
+		b.WriteByte('=')
+		b.WriteString(formatValue(fields[i+1]))
+	}
+	return b.String()
+}
+
+func formatValue(val interface{}) string {
+	var s string
+	switch v := val.(type) {
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\r\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func formatJSON(fields []interface{}) string {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(fmt.Sprint(fields[i]))
+		b.Write(key)
+		b.WriteByte(':')
+		val := fields[i+1]
+		if err, ok := val.(error); ok {
+			val = err.Error()
+		}
+		data, err := json.Marshal(val)
+		if err != nil {
+			data, _ = json.Marshal(fmt.Sprint(val))
+		}
+		b.Write(data)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
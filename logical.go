@@ -0,0 +1,53 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "access/xlogdefs.h"
+#include "replication/message.h"
+
+XLogRecPtr log_logical_message(char *prefix, char *message, size_t size, bool transactional) {
+#if PG_VERSION_NUM >= 170000
+	return LogLogicalMessage(prefix, message, size, transactional, false);
+#else
+	return LogLogicalMessage(prefix, message, size, transactional);
+#endif
+}
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+//LSN is a WAL location (XLogRecPtr)
+type LSN uint64
+
+//String returns the LSN in the PostgreSQL format (e.g. 16/B374D848)
+func (lsn LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
+
+//EmitLogicalMessage writes a message into the WAL stream, where logical decoding
+//output plugins can read it, it's the same as pg_logical_emit_message().
+//Transactional messages are decoded only if the transaction commits,
+//non-transactional messages are decoded immediately even if the transaction aborts.
+//Returns the LSN of the written message
+func EmitLogicalMessage(prefix string, message []byte, transactional bool) (LSN, error) {
+	if prefix == "" {
+		return 0, fmt.Errorf("Logical message prefix can't be empty")
+	}
+	cprefix := C.CString(prefix)
+	defer C.free(unsafe.Pointer(cprefix))
+	var cmessage *C.char
+	if len(message) > 0 {
+		cmessage = (*C.char)(C.CBytes(message))
+		defer C.free(unsafe.Pointer(cmessage))
+	}
+	lsn := C.log_logical_message(cprefix, cmessage, C.size_t(len(message)), (C._Bool)(transactional))
+	return LSN(lsn), nil
+}
+
+//EmitLogicalMessageString is like EmitLogicalMessage with a text message
+func EmitLogicalMessageString(prefix, message string, transactional bool) (LSN, error) {
+	return EmitLogicalMessage(prefix, []byte(message), transactional)
+}
@@ -0,0 +1,133 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "catalog/pg_type.h"
+#include "utils/inet.h"
+
+Datum plgo_inet_to_datum(unsigned char family, unsigned char bits, const unsigned char *addr) {
+	inet *ip = palloc0(sizeof(inet));
+
+	ip_family(ip) = family == 4 ? PGSQL_AF_INET : PGSQL_AF_INET6;
+	ip_bits(ip) = bits;
+	memcpy(ip_addr(ip), addr, ip_addrsize(ip));
+	SET_INET_VARSIZE(ip);
+	return InetPGetDatum(ip);
+}
+
+//plgo_datum_to_inet copies the address of the inet or cidr datum, it returns the size of the address (4 or 16)
+int plgo_datum_to_inet(Datum val, unsigned char *bits, unsigned char *addr) {
+	inet *ip = DatumGetInetPP(val);
+	int size = ip_addrsize(ip);
+
+	*bits = ip_bits(ip);
+	memcpy(addr, ip_addr(ip), size);
+	return size;
+}
+
+Datum plgo_macaddr_to_datum(const unsigned char *addr) {
+	macaddr *mac = palloc(sizeof(macaddr));
+
+	memcpy(mac, addr, sizeof(macaddr));
+	return MacaddrPGetDatum(mac);
+}
+
+void plgo_datum_to_macaddr(Datum val, unsigned char *addr) {
+	memcpy(addr, DatumGetMacaddrP(val), sizeof(macaddr));
+}
+
+void plgo_datum_to_macaddr8(Datum val, unsigned char *addr) {
+	memcpy(addr, DatumGetMacaddr8P(val), sizeof(macaddr8));
+}
+*/
+import "C"
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"unsafe"
+)
+
+//inetDatum returns the inet (or cidr) datum of the address with the netmask bits, the IPv6 zone is dropped
+func inetDatum(addr netip.Addr, bits int) Datum {
+	if !addr.IsValid() {
+		raise("22023", "invalid IP address, the zero netip.Addr can't be converted to inet", "")
+	}
+	family := 6
+	if addr.Is4() {
+		family = 4
+	}
+	ip := addr.WithZone("").AsSlice()
+	return (Datum)(C.plgo_inet_to_datum(C.uchar(family), C.uchar(bits), (*C.uchar)(unsafe.Pointer(&ip[0]))))
+}
+
+//addrDatum returns the inet of the host address
+func addrDatum(addr netip.Addr) Datum {
+	return inetDatum(addr, addr.BitLen())
+}
+
+//prefixDatum returns the cidr of the network, the host bits are cleared
+func prefixDatum(prefix netip.Prefix) Datum {
+	if !prefix.IsValid() {
+		raise("22023", "invalid IP prefix, the zero netip.Prefix can't be converted to cidr", "")
+	}
+	prefix = prefix.Masked()
+	return inetDatum(prefix.Addr(), prefix.Bits())
+}
+
+//scanInet returns the address and the netmask bits of the inet or cidr datum
+func scanInet(oid C.Oid, typeName string, val C.Datum) (netip.Addr, int, error) {
+	if oid != C.INETOID && oid != C.CIDROID {
+		return netip.Addr{}, 0, fmt.Errorf("Column type is not inet or cidr %s", typeName)
+	}
+	var bits C.uchar
+	var ip [16]byte
+	size := C.plgo_datum_to_inet(val, &bits, (*C.uchar)(unsafe.Pointer(&ip[0])))
+	addr, _ := netip.AddrFromSlice(ip[:size])
+	return addr, int(bits), nil
+}
+
+//scanAddr sets the address of the inet or cidr datum, the netmask is dropped
+func scanAddr(oid C.Oid, typeName string, val C.Datum, dest *netip.Addr) error {
+	addr, _, err := scanInet(oid, typeName, val)
+	if err != nil {
+		return err
+	}
+	*dest = addr
+	return nil
+}
+
+//scanPrefix sets the prefix of the cidr or inet datum, the inet keeps its host bits
+func scanPrefix(oid C.Oid, typeName string, val C.Datum, dest *netip.Prefix) error {
+	addr, bits, err := scanInet(oid, typeName, val)
+	if err != nil {
+		return err
+	}
+	*dest = netip.PrefixFrom(addr, bits)
+	return nil
+}
+
+//macaddrDatum returns the macaddr datum, the address must have 6 bytes
+func macaddrDatum(mac net.HardwareAddr) Datum {
+	if len(mac) != 6 {
+		raise("22023", fmt.Sprintf("invalid MAC address %s, macaddr has 6 bytes", mac), "")
+	}
+	return (Datum)(C.plgo_macaddr_to_datum((*C.uchar)(unsafe.Pointer(&mac[0]))))
+}
+
+//scanMacaddr sets the address of the macaddr or macaddr8 datum
+func scanMacaddr(oid C.Oid, typeName string, val C.Datum, dest *net.HardwareAddr) error {
+	switch oid {
+	case C.MACADDROID:
+		mac := make(net.HardwareAddr, 6)
+		C.plgo_datum_to_macaddr(val, (*C.uchar)(unsafe.Pointer(&mac[0])))
+		*dest = mac
+	case C.MACADDR8OID:
+		mac := make(net.HardwareAddr, 8)
+		C.plgo_datum_to_macaddr8(val, (*C.uchar)(unsafe.Pointer(&mac[0])))
+		*dest = mac
+	default:
+		return fmt.Errorf("Column type is not macaddr %s", typeName)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !(plgo_restricted && plgo_seccomp && linux)
+
+package plgo
+
+//enterRestricted is called before every call of an exported function,
+//it installs the seccomp filter when the extension is built with plgo -seccomp
+func enterRestricted() {}
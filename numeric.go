@@ -0,0 +1,90 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "catalog/pg_type.h"
+
+extern Datum plgo_text_input(Oid type, char *text);
+extern char *plgo_text_output(Oid type, Datum value);
+*/
+import "C"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"unsafe"
+)
+
+//Numeric is the PostgreSQL numeric in its text form, e.g. "12.50" or "NaN",
+//it is converted without the precision loss of float64
+type Numeric string
+
+//NewNumeric returns the number rounded to the scale (the digits after the decimal point)
+func NewNumeric(r *big.Rat, scale int) Numeric {
+	return Numeric(r.FloatString(scale))
+}
+
+//Rat returns the number as an big.Rat, an error for NaN and the infinities
+func (n Numeric) Rat() (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(string(n))
+	if !ok {
+		return nil, fmt.Errorf("Numeric %q is not a finite number", string(n))
+	}
+	return r, nil
+}
+
+//Float64 returns the nearest float64
+func (n Numeric) Float64() (float64, error) {
+	return strconv.ParseFloat(string(n), 64)
+}
+
+//String returns the text form
+func (n Numeric) String() string {
+	return string(n)
+}
+
+//MarshalJSON writes the finite numbers as JSON numbers, so the numeric fields of the jsonb structs keep their digits
+func (n Numeric) MarshalJSON() ([]byte, error) {
+	if _, err := n.Rat(); err != nil {
+		return json.Marshal(string(n))
+	}
+	return []byte(n), nil
+}
+
+//UnmarshalJSON reads an JSON number or string
+func (n *Numeric) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*n = Numeric(s)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*n = Numeric(number)
+	return nil
+}
+
+//numericDatum returns the numeric datum, the invalid text raises an ERROR
+func numericDatum(n Numeric) Datum {
+	text := C.CString(string(n))
+	defer C.free(unsafe.Pointer(text))
+	return (Datum)(C.plgo_text_input(C.NUMERICOID, text))
+}
+
+//scanNumeric sets the number from the numeric datum, an error if the type oid isn't numeric
+func scanNumeric(oid C.Oid, typeName string, val C.Datum, dest *Numeric) error {
+	if oid != C.NUMERICOID {
+		return fmt.Errorf("Column type is not numeric %s", typeName)
+	}
+	text := C.plgo_text_output(oid, val)
+	defer C.pfree(unsafe.Pointer(text))
+	*dest = Numeric(C.GoString(text))
+	return nil
+}
@@ -0,0 +1,45 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "miscadmin.h"
+#include "access/xact.h"
+*/
+import "C"
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+//goroutineStacks returns the stack traces of all goroutines
+func goroutineStacks() string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+//handlePanic logs the recovered panic with the function name, backend and transaction context
+//and all goroutine stacks at WARNING, and then raises an ERROR with the panic value
+//and the stack of the panicking goroutine in its DETAIL. It must be called by the deferred function recovering the panic
+func handlePanic(call *funcCall, recovered interface{}) {
+	stack := string(debug.Stack())
+	Log.Warning("panic in exported function",
+		"panic", fmt.Sprint(recovered),
+		"pid", int(C.MyProcPid),
+		"txid", uint32(C.GetTopTransactionIdIfAny()),
+		"goroutines", goroutineStacks(),
+	)
+	raise("", fmt.Sprintf("panic in function %s: %v", call.name, recovered), "Go stack:\n"+stack)
+}
+
+//export plgo_goroutines
+func plgo_goroutines(fcinfo *funcInfo) Datum {
+	return toDatum(goroutineStacks())
+}
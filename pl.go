@@ -3,7 +3,6 @@ package plgo
 /*
 #cgo CFLAGS: -I"/usr/include/postgresql/16/server" -fpic
 #cgo LDFLAGS: -shared
-//{windowsCFLAGS}
 
 typedef unsigned int uint;
 
@@ -23,11 +22,35 @@ typedef unsigned int uint;
 #include "utils/rel.h"
 #include "utils/lsyscache.h"
 #include "utils/jsonb.h"
+#include "access/xact.h"
 
 #ifdef PG_MODULE_MAGIC
 PG_MODULE_MAGIC;
 #endif
 
+extern void plgo_init(void);
+extern void plgo_xact_abort(void);
+extern void plgo_subxact_abort(SubTransactionId subid);
+
+PGDLLEXPORT void _PG_init(void);
+
+static void plgo_xact_callback(XactEvent event, void *arg) {
+	if (event == XACT_EVENT_ABORT || event == XACT_EVENT_PARALLEL_ABORT)
+		plgo_xact_abort();
+}
+
+static void plgo_subxact_callback(SubXactEvent event, SubTransactionId mySubid,
+								  SubTransactionId parentSubid, void *arg) {
+	if (event == SUBXACT_EVENT_ABORT_SUB)
+		plgo_subxact_abort(mySubid);
+}
+
+void _PG_init(void) {
+	RegisterXactCallback(plgo_xact_callback, NULL);
+	RegisterSubXactCallback(plgo_subxact_callback, NULL);
+	plgo_init();
+}
+
 int __varsize(void *var) {
     return VARSIZE(var);
 }
@@ -37,17 +60,21 @@ int __varsize_any(void *var) {
 }
 
 void elog_notice(char* string) {
-    elog(NOTICE, string, "");
+    elog(NOTICE, "%s", string);
 }
 
 void elog_error(char* string) {
-    elog(ERROR, string, "");
+    elog(ERROR, "%s", string);
 }
 
 Datum get_arg(PG_FUNCTION_ARGS, uint i) {
 	return PG_GETARG_DATUM(i);
 }
 
+bool arg_is_null(PG_FUNCTION_ARGS, uint i) {
+	return PG_ARGISNULL(i);
+}
+
 HeapTuple get_heap_tuple(HeapTuple* ht, uint i) {
     return ht[i];
 }
@@ -63,11 +90,8 @@ bool called_as_trigger(PG_FUNCTION_ARGS) {
 	return CALLED_AS_TRIGGER(fcinfo);
 }
 
-Datum get_heap_getattr(HeapTuple ht, uint i, TupleDesc td) {
-	bool isNull;
-	Datum ret = heap_getattr(ht, i, td, &isNull);
-	if (isNull) PG_RETURN_VOID();
-	return ret;
+Datum get_heap_getattr(HeapTuple ht, uint i, TupleDesc td, bool *isNull) {
+	return heap_getattr(ht, i, td, isNull);
 }
 
 //val to datum//////////////////////////////////////////////////
@@ -78,12 +102,13 @@ Datum void_datum(){
 Datum bytes_to_datum(void *val, uint len) {
 	void *v = (void *)palloc(len + VARHDRSZ);
 	SET_VARSIZE(v, len + VARHDRSZ);
-	memcpy(VARDATA(v), val, len);
+	if (len > 0)
+		memcpy(VARDATA(v), val, len);
 	return PointerGetDatum(v);
 }
 
 Datum cstring_to_datum(char *val) {
-    return CStringGetDatum(val);
+    return CStringGetTextDatum(val);
 }
 
 Datum int16_to_datum(int16 val) {
@@ -134,9 +159,8 @@ Datum heap_tuple_to_datum(HeapTuple val) {
 	return PointerGetDatum(val);
 }
 
-Datum array_to_datum(Oid element_type, Datum* vals, int size) {
+Datum array_to_datum(Oid element_type, Datum* vals, bool* isnull, int size) {
 	ArrayType *result;
-	bool* isnull = (bool *)palloc0(sizeof(bool)*size);
     int dims[1];
     int lbs[1];
     int16 typlen;
@@ -160,7 +184,7 @@ Datum jsonb_to_datum(char* val) {
 
 //Datum to val //////////////////////////////////////////////////////////
 char* datum_to_cstring(Datum val) {
-    return DatumGetCString(val);
+    return TextDatumGetCString(val);
 }
 
 bytea* datum_to_byteap(Datum val) {
@@ -171,6 +195,12 @@ unsigned char * bytea_to_chars(bytea* val) {
     return  ((unsigned char *)VARDATA_ANY(val));
 }
 
+//bytea_free frees the detoasted copy of the bytea datum, the large values aren't kept until the end of the call
+void bytea_free(Datum val, bytea *detoasted) {
+	if ((Pointer) detoasted != DatumGetPointer(val))
+		pfree(detoasted);
+}
+
 
 int16 datum_to_int16(Datum val) {
     return DatumGetInt16(val);
@@ -220,20 +250,20 @@ HeapTuple datum_to_heap_tuple(Datum val) {
 	return (HeapTuple) DatumGetPointer(val);
 }
 
-Datum* datum_to_array(Datum val, int* nelemsp) {
+Datum* datum_to_array(Datum val, int* nelemsp, bool** nullsp, Oid* elemtypep) {
 	ArrayType* array = DatumGetArrayTypeP(val);
 
     int16 typlen;
     bool typbyval;
     char typalign;
 	Datum *result;
-	bool *nullsp;
 
+	*elemtypep = ARR_ELEMTYPE(array);
     get_typlenbyvalalign(ARR_ELEMTYPE(array), &typlen, &typbyval, &typalign);
 
 	deconstruct_array(array, ARR_ELEMTYPE(array),
                       typlen, typbyval, typalign,
-                      &result, &nullsp, nelemsp);
+                      &result, nullsp, nelemsp);
 	return result;
 }
 
@@ -291,6 +321,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/netip"
 	"reflect"
 	"time"
 	"unsafe"
@@ -303,10 +335,21 @@ func main() {}
 type Datum C.Datum
 
 //DB represents the db connection, can be made only once
-type DB struct{}
+type DB struct {
+	//nonatomic is true in the procedures called by CALL, they can Commit and Rollback
+	nonatomic bool
+	//subTx is the innermost running subtransaction
+	subTx *SubTx
+}
 
-//Open returns DB connection and runs SPI_connect
+//Open returns DB connection and runs SPI_connect, nonatomic in the procedures called by CALL
 func Open() (*DB, error) {
+	if call := currentCall(); call != nil && call.nonatomic {
+		if C.SPI_connect_ext(C.SPI_OPT_NONATOMIC) != C.SPI_OK_CONNECT {
+			return nil, errors.New("can't connect")
+		}
+		return &DB{nonatomic: true}, nil
+	}
 	if C.SPI_connect() != C.SPI_OK_CONNECT {
 		return nil, errors.New("can't connect")
 	}
@@ -315,6 +358,9 @@ func Open() (*DB, error) {
 
 //Close closes the DB connection
 func (db *DB) Close() error {
+	if db.subTx != nil {
+		return errors.New("Error closing DB, release or rollback the subtransaction first")
+	}
 	if C.SPI_finish() != C.SPI_OK_FINISH {
 		return errors.New("Error closing DB")
 	}
@@ -370,17 +416,45 @@ func (fcinfo *funcInfo) CalledAsTrigger() bool {
 
 //TODO Scan must return argument also if the function is called as trigger
 
-//Scan sets the args to the function parameter values (converted from PostgreSQL types to Go types)
+//Scan sets the args to the function parameter values (converted from PostgreSQL types to Go types).
+//The pointers to pointers (e.g. **int64) are set to nil for NULL, the other NULL arguments keep the zero values
 func (fcinfo *funcInfo) Scan(args ...interface{}) error {
+	_, err := fcinfo.scanArgs(0, args...)
+	return err
+}
+
+//scanArgs sets the args to the parameter values from the parameter first on, as Scan,
+//it reports whether all the arguments of the not nullable args are not NULL
+func (fcinfo *funcInfo) scanArgs(first int, args ...interface{}) (bool, error) {
+	present := true
 	for i, arg := range args {
-		funcArg := C.get_arg((*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo)), C.uint(i))
-		argOid := C.get_call_expr_argtype(fcinfo.flinfo.fn_expr, C.int(i))
+		n := first + i
+		target := reflect.ValueOf(arg).Elem()
+		nullable := target.Kind() == reflect.Ptr
+		if C.arg_is_null((*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo)), C.uint(n)) == (C._Bool)(true) {
+			if nullable {
+				target.Set(reflect.Zero(target.Type()))
+			} else {
+				present = false
+			}
+			continue
+		}
+		funcArg := C.get_arg((*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo)), C.uint(n))
+		argOid := C.get_call_expr_argtype(fcinfo.flinfo.fn_expr, C.int(n))
+		if nullable {
+			value := reflect.New(target.Type().Elem())
+			if err := scanVal(argOid, "", funcArg, value.Interface()); err != nil {
+				return false, err
+			}
+			target.Set(value)
+			continue
+		}
 		err := scanVal(argOid, "", funcArg, arg)
 		if err != nil {
-			return err
+			return false, err
 		}
 	}
-	return nil
+	return present, nil
 }
 
 //TriggerData returns Trigger data, if the function was called as trigger, else nil
@@ -465,22 +539,31 @@ func (td *TriggerData) FiredByTruncate() bool {
 type TriggerRow struct {
 	tupleDesc C.TupleDesc
 	attrs     []C.Datum
+	nulls     []bool
 }
 
 func newTriggerRow(tupleDesc C.TupleDesc, heapTuple C.HeapTuple) *TriggerRow {
-	row := &TriggerRow{tupleDesc, make([]C.Datum, int(tupleDesc.natts))}
 	if heapTuple == nil {
 		return nil
 	}
-	for i := 0; i < int(tupleDesc.natts); i++ {
-		row.attrs[i] = C.get_heap_getattr(heapTuple, C.uint(i+1), tupleDesc)
+	natts := int(tupleDesc.natts)
+	row := &TriggerRow{tupleDesc, make([]C.Datum, natts), make([]bool, natts)}
+	for i := 0; i < natts; i++ {
+		var isNull C.bool
+		row.attrs[i] = C.get_heap_getattr(heapTuple, C.uint(i+1), tupleDesc, &isNull)
+		row.nulls[i] = isNull == (C._Bool)(true)
 	}
 	return row
 }
 
-//Scan sets the args from the TriggerRow
+//Scan sets the args from the TriggerRow, the args of NULL columns are set to their zero values
 func (row *TriggerRow) Scan(args ...interface{}) error {
 	for i, arg := range args {
+		if row.nulls[i] {
+			target := reflect.ValueOf(arg).Elem()
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
 		oid := C.SPI_gettypeid(row.tupleDesc, C.int(i+1))
 		typeName := C.SPI_gettype(row.tupleDesc, C.int(i+1))
 		err := scanVal(oid, C.GoString(typeName), row.attrs[i], arg)
@@ -491,30 +574,129 @@ func (row *TriggerRow) Scan(args ...interface{}) error {
 	return nil
 }
 
-//Set sets the i'th value in the row
+//heapTuple forms the heap tuple of the row
+func (row *TriggerRow) heapTuple() C.HeapTuple {
+	isNull := make([]C.bool, len(row.attrs))
+	for i := range row.attrs {
+		isNull[i] = (C._Bool)(row.nulls[i])
+	}
+	return C.heap_form_tuple(row.tupleDesc, &row.attrs[0], &isNull[0])
+}
+
+//Set sets the i'th value in the row, nil sets it to NULL
 func (row *TriggerRow) Set(i int, val interface{}) {
 	row.attrs[i] = (C.Datum)(toDatum(val))
+	row.nulls[i] = val == nil
 }
 
-func makeArray(elemtype C.Oid, arg interface{}) Datum {
-	s := reflect.ValueOf(arg)
-	if s.Kind() != reflect.Slice {
-		panic("InterfaceSlice() given a non-slice type")
+//arrayElemOid returns the PostgreSQL type of the array elements of the Go type, the pointers are nullable elements
+func arrayElemOid(t reflect.Type) (C.Oid, bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return C.TIMESTAMPTZOID, true
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return C.INTERVALOID, true
+	}
+	if t == reflect.TypeOf([]byte(nil)) {
+		return C.BYTEAOID, true
+	}
+	switch t {
+	case reflect.TypeOf(netip.Addr{}):
+		return C.INETOID, true
+	case reflect.TypeOf(netip.Prefix{}):
+		return C.CIDROID, true
+	case reflect.TypeOf(net.HardwareAddr(nil)):
+		return C.MACADDROID, true
+	}
+	if t == reflect.TypeOf(UUID{}) {
+		return C.UUIDOID, true
+	}
+	if t == reflect.TypeOf(Numeric("")) {
+		return C.NUMERICOID, true
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return C.TEXTOID, true
+	case reflect.Int16, reflect.Uint16:
+		return C.INT2OID, true
+	case reflect.Int32, reflect.Uint32:
+		return C.INT4OID, true
+	case reflect.Int64, reflect.Int, reflect.Uint:
+		return C.INT8OID, true
+	case reflect.Float32:
+		return C.FLOAT4OID, true
+	case reflect.Float64:
+		return C.FLOAT8OID, true
+	case reflect.Bool:
+		return C.BOOLOID, true
 	}
+	return 0, false
+}
 
-	datums := make([]C.Datum, s.Len())
+//makeArray returns the array datum of the slice, the nil pointer elements are NULL
+func makeArray(elemtype C.Oid, s reflect.Value) Datum {
+	datums := make([]C.Datum, s.Len()+1)
+	nulls := make([]C.bool, s.Len()+1)
 	for i := 0; i < s.Len(); i++ {
-		datums[i] = (C.Datum)(toDatum(s.Index(i).Interface()))
+		elem := s.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				nulls[i] = (C._Bool)(true)
+				continue
+			}
+			elem = elem.Elem()
+		}
+		datums[i] = (C.Datum)(toDatum(elem.Interface()))
 	}
-	return (Datum)(C.array_to_datum(elemtype, &datums[0], C.int(s.Len())))
+	return (Datum)(C.array_to_datum(elemtype, &datums[0], &nulls[0], C.int(s.Len())))
 }
 
-func makeSlice(val C.Datum) []C.Datum {
+//makeSlice returns the elements of the array datum with their NULL flags and the element type
+func makeSlice(val C.Datum) ([]C.Datum, []bool, C.Oid) {
 	var clength C.int
-	datumArray := C.datum_to_array(val, &clength)
+	var cnulls *C.bool
+	var elemtype C.Oid
+	datumArray := C.datum_to_array(val, &clength, &cnulls, &elemtype)
 	length := int(clength)
-	slice := (*[1 << 30]C.Datum)(unsafe.Pointer(datumArray))[:length]
-	return slice
+	if length == 0 {
+		return nil, nil, elemtype
+	}
+	slice := (*[1 << 30]C.Datum)(unsafe.Pointer(datumArray))[:length:length]
+	cnullSlice := (*[1 << 30]C.bool)(unsafe.Pointer(cnulls))[:length:length]
+	nulls := make([]bool, length)
+	for i, isNull := range cnullSlice {
+		nulls[i] = isNull == (C._Bool)(true)
+	}
+	return slice, nulls, elemtype
+}
+
+//scanArray sets the slice pointed by target from the array datum,
+//the NULL elements can be scanned only into an slice of pointers
+func scanArray(val C.Datum, typeName string, target reflect.Value) error {
+	elems, nulls, elemtype := makeSlice(val)
+	slice := reflect.MakeSlice(target.Type(), len(elems), len(elems))
+	for i := range elems {
+		elem := slice.Index(i)
+		if nulls[i] {
+			if elem.Kind() != reflect.Ptr {
+				return fmt.Errorf("Array %s contains NULL, scan it into an slice of pointers (%s)", typeName, reflect.PtrTo(target.Type().Elem()))
+			}
+			continue
+		}
+		ptr := elem.Addr()
+		if elem.Kind() == reflect.Ptr {
+			elem.Set(reflect.New(elem.Type().Elem()))
+			ptr = elem
+		}
+		if err := scanVal(elemtype, typeName, elems[i], ptr.Interface()); err != nil {
+			return err
+		}
+	}
+	target.Set(slice)
+	return nil
 }
 
 //toDatum returns the Postgresql C type from Golang type
@@ -529,9 +711,11 @@ func toDatum(val interface{}) Datum {
 		defer C.free(unsafe.Pointer(s))
 		return (Datum)(C.cstring_to_datum(s))
 	case []byte:
-		b := C.CBytes(v)
-		defer C.free(b)
-		return (Datum)(C.bytes_to_datum(b, C.uint(len(v))))
+		//the bytes are copied from the Go memory into the varlena, without an intermediate C copy
+		if len(v) == 0 {
+			return (Datum)(C.bytes_to_datum(nil, 0))
+		}
+		return (Datum)(C.bytes_to_datum(unsafe.Pointer(&v[0]), C.uint(len(v))))
 	case int16:
 		return (Datum)(C.int16_to_datum(C.int16(v)))
 	case uint16:
@@ -551,51 +735,52 @@ func toDatum(val interface{}) Datum {
 	case float64:
 		return (Datum)(C.float8_to_datum(C.double(v)))
 	case time.Time:
-		return (Datum)(C.timetz_to_datum(C.TimestampTz((v.UTC().Unix() - 946684800) * int64(C.USECS_PER_SEC))))
+		return timeDatum(v, "timestamptz")
+	case time.Duration:
+		return intervalDatum(v)
 	case bool:
 		if v {
 			return (Datum)(C.bool_to_datum((C._Bool)(true)))
 		}
 		return (Datum)(C.bool_to_datum((C._Bool)(false)))
-	case []string:
-		return makeArray(C.TEXTOID, v)
-	case []int16:
-		return makeArray(C.INT2OID, v)
-	case []uint16:
-		return makeArray(C.INT2OID, v)
-	case []int32:
-		return makeArray(C.INT4OID, v)
-	case []uint32:
-		return makeArray(C.INT4OID, v)
-	case []int64:
-		return makeArray(C.INT8OID, v)
-	case []int:
-		return makeArray(C.INT8OID, v)
-	case []uint:
-		return makeArray(C.INT8OID, v)
-	case []float32:
-		return makeArray(C.FLOAT4OID, v)
-	case []float64:
-		return makeArray(C.FLOAT8OID, v)
-	case []bool:
-		return makeArray(C.BOOLOID, v)
-	case []time.Time:
-		return makeArray(C.TIMESTAMPTZOID, v)
+	case map[string]*string:
+		return hstoreDatum(v)
+	case UUID:
+		return uuidDatum(v)
+	case Numeric:
+		return numericDatum(v)
+	case netip.Addr:
+		return addrDatum(v)
+	case netip.Prefix:
+		return prefixDatum(v)
+	case net.HardwareAddr:
+		return macaddrDatum(v)
+	case rangeValue:
+		return rangeDatum(v)
+	case JSONB:
+		cjson := C.CString(string(v.document()))
+		defer C.free(unsafe.Pointer(cjson))
+		return (Datum)(C.jsonb_to_datum(cjson))
 	case *TriggerRow:
 		if v == nil {
 			return toDatum(nil)
 		}
-		isNull := make([]C.bool, len(v.attrs))
-		for i, attr := range v.attrs {
-			if attr == (C.Datum)(toDatum(nil)) {
-				isNull[i] = (C._Bool)(true)
-			} else {
-				isNull[i] = (C._Bool)(false)
+		return (Datum)(C.heap_tuple_to_datum(v.heapTuple()))
+	default:
+		//slices of the builtin types and of pointers to them (nullable elements) are arrays
+		if s := reflect.ValueOf(val); s.Kind() == reflect.Slice {
+			if elemtype, ok := arrayElemOid(s.Type().Elem()); ok {
+				return makeArray(elemtype, s)
 			}
 		}
-		heapTuple := C.heap_form_tuple(v.tupleDesc, &v.attrs[0], &isNull[0])
-		return (Datum)(C.heap_tuple_to_datum(heapTuple))
-	default:
+		//the structs (and maps) are jsonb
+		if k := reflect.ValueOf(val).Kind(); k == reflect.Struct || k == reflect.Map {
+			data, err := json.Marshal(val)
+			if err != nil {
+				Log.Error(fmt.Sprintf("Cannot marshal %T to jsonb: %s", val, err))
+			}
+			return toDatum(JSONB(data))
+		}
 		return (Datum)(C.void_datum())
 	}
 }
@@ -605,6 +790,7 @@ type Stmt struct {
 	spiPlan C.SPIPlanPtr
 	db      *DB
 	typeIds []C.Oid
+	query   string
 }
 
 //Prepare prepares an SQL query and returns a Stmt that can be executed
@@ -625,21 +811,32 @@ func (db *DB) Prepare(query string, types []string) (*Stmt, error) {
 	}
 	cq := C.CString(query)
 	defer C.free(unsafe.Pointer(cq))
-	cplan := C.SPI_prepare(cq, C.int(len(types)), typeIdsP)
+	cplan, err := db.prepare(cq, C.int(len(types)), typeIdsP)
+	if err != nil {
+		return nil, err
+	}
 	if cplan != nil {
-		return &Stmt{spiPlan: cplan, db: db, typeIds: typeIds}, nil
+		return &Stmt{spiPlan: cplan, db: db, typeIds: typeIds, query: query}, nil
 	}
 	return nil, fmt.Errorf("Prepare failed: %s", C.GoString(C.SPI_result_code_string(C.SPI_result)))
 }
 
 //Query executes the prepared Stmt with the provided args and returns
 //multiple Rows result, that can be iterated
-func (stmt *Stmt) Query(args ...interface{}) (*Rows, error) {
+func (stmt *Stmt) Query(args ...interface{}) (rows *Rows, err error) {
+	q := beginQuery(stmt.query, args)
+	defer endQuery(q, &err)
+	if err = auditQuery(q); err != nil {
+		return nil, err
+	}
 	valuesP, nullsP, err := stmt.spiArgs(args)
 	if err != nil {
 		return nil, err
 	}
-	rv := C.SPI_execute_plan(stmt.spiPlan, valuesP, nullsP, (C._Bool)(false), 0)
+	rv, err := stmt.executePlan(valuesP, nullsP, 0)
+	if err != nil {
+		return nil, err
+	}
 	if rv == C.SPI_OK_SELECT && C.SPI_processed > 0 {
 		return newRows(C.SPI_tuptable.vals, C.SPI_tuptable.tupdesc, C.uint64(C.SPI_processed)), nil
 	}
@@ -647,12 +844,20 @@ func (stmt *Stmt) Query(args ...interface{}) (*Rows, error) {
 }
 
 //QueryRow executes the prepared Stmt with the provided args and returns one row result
-func (stmt *Stmt) QueryRow(args ...interface{}) (*Row, error) {
+func (stmt *Stmt) QueryRow(args ...interface{}) (row *Row, err error) {
+	q := beginQuery(stmt.query, args)
+	defer endQuery(q, &err)
+	if err = auditQuery(q); err != nil {
+		return nil, err
+	}
 	valuesP, nullsP, err := stmt.spiArgs(args)
 	if err != nil {
 		return nil, err
 	}
-	rv := C.SPI_execute_plan(stmt.spiPlan, valuesP, nullsP, (C._Bool)(false), 1)
+	rv, err := stmt.executePlan(valuesP, nullsP, 1)
+	if err != nil {
+		return nil, err
+	}
 	if rv >= C.int(0) && C.SPI_processed == 1 {
 		return &Row{
 			heapTuple: C.get_heap_tuple(C.SPI_tuptable.vals, C.uint(0)),
@@ -663,12 +868,20 @@ func (stmt *Stmt) QueryRow(args ...interface{}) (*Row, error) {
 }
 
 //Exec executes a prepared query Stmt with no result
-func (stmt *Stmt) Exec(args ...interface{}) error {
+func (stmt *Stmt) Exec(args ...interface{}) (err error) {
+	q := beginQuery(stmt.query, args)
+	defer endQuery(q, &err)
+	if err = auditQuery(q); err != nil {
+		return err
+	}
 	valuesP, nullsP, err := stmt.spiArgs(args)
 	if err != nil {
 		return err
 	}
-	rv := C.SPI_execute_plan(stmt.spiPlan, valuesP, nullsP, (C._Bool)(false), 0)
+	rv, err := stmt.executePlan(valuesP, nullsP, 0)
+	if err != nil {
+		return err
+	}
 	if rv >= C.int(0) && C.SPI_processed == 0 {
 		return nil
 	}
@@ -678,6 +891,28 @@ func (stmt *Stmt) Exec(args ...interface{}) error {
 	return fmt.Errorf("Exec failed: %s", C.GoString(C.SPI_result_code_string(C.SPI_result)))
 }
 
+//queryCall is an query running through a Stmt
+type queryCall struct {
+	query string
+	args  []interface{}
+	start time.Time
+	span  *span
+}
+
+//beginQuery is called before every query executed through a Stmt
+func beginQuery(query string, args []interface{}) *queryCall {
+	CheckTimers()
+	q := &queryCall{query: query, args: args, start: time.Now()}
+	q.span = startQuerySpan(query)
+	return q
+}
+
+//endQuery is called after the query finished, err is the error returned by the query
+func endQuery(q *queryCall, err *error) {
+	q.span.finish(*err)
+	logSlowQuery(q, *err)
+}
+
 func (stmt *Stmt) spiArgs(args []interface{}) (valuesP *C.Datum, nullsP *C.char, err error) {
 	if len(args) == 0 {
 		return
@@ -685,6 +920,18 @@ func (stmt *Stmt) spiArgs(args []interface{}) (valuesP *C.Datum, nullsP *C.char,
 	values := make([]Datum, len(args))
 	nulls := make([]C.char, len(args))
 	for i, arg := range args {
+		//nil and the nil pointers are NULL, the other pointers (but the trigger rows) bind their values
+		if v := reflect.ValueOf(arg); v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				arg = nil
+			} else if _, ok := arg.(*TriggerRow); !ok {
+				arg = v.Elem().Interface()
+			}
+		}
+		if arg == nil {
+			nulls[i] = C.char('n')
+			continue
+		}
 		switch stmt.typeIds[i] {
 		case C.JSONBOID:
 			jsonData, err := json.Marshal(arg)
@@ -886,124 +1133,50 @@ func scanVal(oid C.Oid, typeName string, val C.Datum, arg interface{}) error {
 		case C.BYTEAOID:
 			bytea := C.datum_to_byteap(val)
 			byteaPointer := unsafe.Pointer(bytea)
+			//the bytes are copied into the Go memory, the slice can be kept after the call
 			*targ = C.GoBytes(unsafe.Pointer(C.bytea_to_chars(bytea)), C.__varsize_any(byteaPointer))
+			C.bytea_free(val, bytea)
 		default:
 			return fmt.Errorf("Column type is not bytea %s", typeName)
 		}
 	case *time.Time:
-		switch oid {
-		case C.DATEOID:
-			dateadt := C.datum_to_date(val)
-			*targ = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(dateadt))
-		case C.TIMESTAMPOID:
-			t := C.datum_to_time(val)
-			*targ = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Second * time.Duration(int64(t)/int64(C.USECS_PER_SEC)))
-		case C.TIMESTAMPTZOID:
-			t := C.datum_to_timetz(val)
-			*targ = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Second * time.Duration(int64(t)/int64(C.USECS_PER_SEC))).Local()
-		default:
-			return fmt.Errorf("Unsupported time type %s", typeName)
-		}
-	case *[]string:
-		slice := makeSlice(val)
-		*targ = make([]string, len(slice))
-		for i := range slice {
-			err := scanVal(C.TEXTOID, "Text", slice[i], &((*targ)[i]))
-			if err != nil {
-				return err
-			}
-		}
-	case *[]int16:
-		slice := makeSlice(val)
-		*targ = make([]int16, len(slice))
-		for i := range slice {
-			err := scanVal(C.INT2OID, "SMALLINT", slice[i], &((*targ)[i]))
-			if err != nil {
-				return err
-			}
+		return scanTime(oid, typeName, val, targ)
+	case *time.Duration:
+		return scanDuration(oid, typeName, val, targ)
+	case *UUID:
+		return scanUUID(oid, typeName, val, targ)
+	case *Numeric:
+		return scanNumeric(oid, typeName, val, targ)
+	case *netip.Addr:
+		return scanAddr(oid, typeName, val, targ)
+	case *netip.Prefix:
+		return scanPrefix(oid, typeName, val, targ)
+	case *net.HardwareAddr:
+		return scanMacaddr(oid, typeName, val, targ)
+	case rangeTarget:
+		return scanRange(oid, typeName, val, targ)
+	case *map[string]*string:
+		//the jsonb objects can be scanned into the map too
+		if oid == C.JSONBOID {
+			return json.Unmarshal([]byte(C.GoString(C.datum_to_jsonb_cstring(val))), targ)
 		}
-	case *[]uint16:
-		slice := makeSlice(val)
-		*targ = make([]uint16, len(slice))
-		for i := range slice {
-			err := scanVal(C.INT2OID, "SMALLINT", slice[i], &((*targ)[i]))
-			if err != nil {
-				return err
-			}
-		}
-	case *[]int32:
-		slice := makeSlice(val)
-		*targ = make([]int32, len(slice))
-		for i := range slice {
-			err := scanVal(C.INT4OID, "INT", slice[i], &((*targ)[i]))
-			if err != nil {
-				return err
-			}
-		}
-	case *[]uint32:
-		slice := makeSlice(val)
-		*targ = make([]uint32, len(slice))
-		for i := range slice {
-			err := scanVal(C.INT4OID, "INT", slice[i], &((*targ)[i]))
-			if err != nil {
-				return err
-			}
-		}
-	case *[]int64:
-		slice := makeSlice(val)
-		*targ = make([]int64, len(slice))
-		for i := range slice {
-			err := scanVal(C.INT8OID, "INT", slice[i], &((*targ)[i]))
-			if err != nil {
-				return err
-			}
-		}
-	case *[]int:
-		slice := makeSlice(val)
-		*targ = make([]int, len(slice))
-		for i := range slice {
-			err := scanVal(C.INT8OID, "INT", slice[i], &((*targ)[i]))
-			if err != nil {
-				return err
-			}
-		}
-	case *[]bool:
-		slice := makeSlice(val)
-		*targ = make([]bool, len(slice))
-		for i := range slice {
-			err := scanVal(C.BOOLOID, "BOOL", slice[i], &((*targ)[i]))
-			if err != nil {
-				return err
-			}
-		}
-	case *[]float32:
-		slice := makeSlice(val)
-		*targ = make([]float32, len(slice))
-		for i := range slice {
-			err := scanVal(C.FLOAT4OID, "REAL", slice[i], &((*targ)[i]))
-			if err != nil {
-				return err
+		return scanHstore(oid, typeName, val, targ)
+	default:
+		//slices of the builtin types and of pointers to them (nullable elements)
+		if target := reflect.ValueOf(arg); target.Kind() == reflect.Ptr && target.Elem().Kind() == reflect.Slice && C.get_element_type(oid) != 0 {
+			if _, ok := arrayElemOid(target.Type().Elem().Elem()); ok {
+				return scanArray(val, typeName, target.Elem())
 			}
 		}
-	case *[]float64:
-		slice := makeSlice(val)
-		*targ = make([]float64, len(slice))
-		for i := range slice {
-			err := scanVal(C.FLOAT8OID, "DOUBLE", slice[i], &((*targ)[i]))
-			if err != nil {
-				return err
-			}
+		//the structs are the composite types
+		if target := reflect.ValueOf(arg); target.Kind() == reflect.Ptr && target.Elem().Kind() == reflect.Struct && C.type_is_rowtype(oid) == (C._Bool)(true) {
+			return scanComposite(val, arg)
 		}
-	case *[]time.Time:
-		slice := makeSlice(val)
-		*targ = make([]time.Time, len(slice))
-		for i := range slice {
-			err := scanVal(C.TIMESTAMPTZOID, "TIMETZ", slice[i], &((*targ)[i]))
-			if err != nil {
-				return err
-			}
+		//the string types are the enum types
+		if target := reflect.ValueOf(arg); target.Kind() == reflect.Ptr && target.Elem().Kind() == reflect.String && C.type_is_enum(oid) == (C._Bool)(true) {
+			scanEnum(oid, val, target)
+			return nil
 		}
-	default:
 		switch oid {
 		case C.JSONBOID:
 			jsonData := []byte(C.GoString(C.datum_to_jsonb_cstring(val)))
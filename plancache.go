@@ -0,0 +1,53 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "executor/spi.h"
+*/
+import "C"
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//plans are the statements prepared by Prepare by their queries and parameter types,
+//they are kept for the life of the backend
+var plans = struct {
+	sync.Mutex
+	stmts map[string]*Stmt
+}{stmts: make(map[string]*Stmt)}
+
+//Prepare returns the prepared statement of the query with the parameter types (PostgreSQL type names),
+//the plan is prepared by the first call in the backend and kept (SPI_keepplan) for the next calls of the functions,
+//PostgreSQL replans it when the used tables change. It must be called with an open DB
+//
+//	stmt, err := plgo.Prepare("SELECT name FROM users WHERE id = $1", "bigint")
+//	row, err := stmt.QueryRow(id)
+func Prepare(query string, argTypes ...string) (*Stmt, error) {
+	key := strings.Join(argTypes, ",") + "\x00" + query
+	plans.Lock()
+	defer plans.Unlock()
+	if stmt, ok := plans.stmts[key]; ok {
+		return stmt, nil
+	}
+	stmt, err := new(DB).Prepare(query, argTypes)
+	if err != nil {
+		return nil, err
+	}
+	if rv := C.SPI_keepplan(stmt.spiPlan); rv != 0 {
+		return nil, fmt.Errorf("Prepare failed: %s", C.GoString(C.SPI_result_code_string(rv)))
+	}
+	plans.stmts[key] = stmt
+	return stmt, nil
+}
+
+//ResetPrepared frees the plans kept by Prepare, the next calls prepare them again
+func ResetPrepared() {
+	plans.Lock()
+	defer plans.Unlock()
+	for key, stmt := range plans.stmts {
+		C.SPI_freeplan(stmt.spiPlan)
+		delete(plans.stmts, key)
+	}
+}
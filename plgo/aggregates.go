@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//AggregateFunction is an aggregate of an type with the Accumulate and Final methods:
+//the state is an value of the type kept by the runtime (internal in SQL), Accumulate is called for every row
+//with the arguments of the aggregate and the result of Final is the result of the aggregate
+type AggregateFunction struct {
+	//Name is the name of the Go type and of the aggregate
+	Name string
+	Doc  string
+	//Accumulate is the state transition function, its parameters without the state are the parameters of the aggregate
+	Accumulate VoidFunction
+	//Final is the final function
+	Final Function
+}
+
+//packageAggregates returns the aggregates of the exported types of the package with the Accumulate and Final methods,
+//sorted by name
+func packageAggregates(packageAst *ast.Package, structs map[string]*ast.StructType, composites map[string]*CompositeType) ([]CodeWriter, error) {
+	docs := make(map[string]*ast.CommentGroup)
+	methods := make(map[string]map[string]*ast.FuncDecl)
+	for _, file := range packageAst.Files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				if decl.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range decl.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					docs[typeSpec.Name.Name] = typeSpec.Doc
+					if typeSpec.Doc == nil && len(decl.Specs) == 1 {
+						docs[typeSpec.Name.Name] = decl.Doc
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Recv == nil || len(decl.Recv.List) != 1 || (decl.Name.Name != "Accumulate" && decl.Name.Name != "Final") {
+					continue
+				}
+				recv := decl.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				ident, ok := recv.(*ast.Ident)
+				if !ok || !ast.IsExported(ident.Name) {
+					continue
+				}
+				if methods[ident.Name] == nil {
+					methods[ident.Name] = make(map[string]*ast.FuncDecl)
+				}
+				methods[ident.Name][decl.Name.Name] = decl
+			}
+		}
+	}
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var aggregates []CodeWriter
+	for _, name := range names {
+		accumulate, final := methods[name]["Accumulate"], methods[name]["Final"]
+		if accumulate == nil || final == nil {
+			continue
+		}
+		aggregate, err := newAggregate(name, docs[name], accumulate, final, structs, composites)
+		if err != nil {
+			return nil, err
+		}
+		aggregates = append(aggregates, aggregate)
+	}
+	return aggregates, nil
+}
+
+//newAggregate returns the aggregate of the type from its Accumulate and Final methods
+func newAggregate(name string, doc *ast.CommentGroup, accumulate, final *ast.FuncDecl, structs map[string]*ast.StructType, composites map[string]*CompositeType) (*AggregateFunction, error) {
+	//the methods are named in the errors
+	method := *accumulate
+	method.Name = ast.NewIdent(name + ".Accumulate")
+	params, err := getParamList(&method, structs, composites)
+	if err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		return nil, fmt.Errorf("Aggregate %s: Accumulate must have parameters", name)
+	}
+	for _, p := range params {
+		if p.Type == triggerData {
+			return nil, fmt.Errorf("Aggregate %s: Accumulate can't take *plgo.TriggerData", name)
+		}
+	}
+	if accumulate.Type.Results != nil && len(accumulate.Type.Results.List) > 0 {
+		return nil, fmt.Errorf("Aggregate %s: Accumulate must not return results", name)
+	}
+	if len(final.Type.Params.List) > 0 {
+		return nil, fmt.Errorf("Aggregate %s: Final must not have parameters", name)
+	}
+	returnType, sqlReturnType, isStar, err := getReturnType(name+".Final", final.Type.Results, structs, composites)
+	if err != nil {
+		return nil, err
+	}
+	if returnType == "" || returnType == triggerRow {
+		return nil, fmt.Errorf("Aggregate %s: Final must return the result of the aggregate", name)
+	}
+	//the transition function is called with the NULL state of the first row
+	attributes := FunctionAttributes{Volatility: "immutable"}
+	aggregate := &AggregateFunction{
+		Name:       name,
+		Doc:        doc.Text(),
+		Accumulate: VoidFunction{Name: name + "_accumulate", Params: params, Attributes: attributes},
+		Final: Function{VoidFunction: VoidFunction{Name: name + "_final", Attributes: attributes},
+			ReturnType: returnType, SQLReturnType: sqlReturnType, IsStar: isStar, Composite: composites[returnType].isRow(),
+			Enum: composites[returnType].isEnum()},
+	}
+	for _, p := range params {
+		aggregate.Accumulate.dependOn(composites[strings.TrimPrefix(p.Type, "*")])
+	}
+	aggregate.Final.dependOn(composites[returnType])
+	return aggregate, nil
+}
+
+//FuncDec returns the PG INFO_V1 macros of the transition and final functions
+func (a *AggregateFunction) FuncDec() string {
+	return a.Accumulate.FuncDec() + a.Final.FuncDec()
+}
+
+//Code writes the wrapper functions, the transition function scans the arguments into the parameters of Accumulate,
+//the rows with an NULL argument of an not pointer parameter are skipped
+func (a *AggregateFunction) Code(w io.Writer) {
+	newState := "func() interface{} { return new(" + a.Name + ") }"
+	writeFuncHeader(w, a.Accumulate.Name)
+	w.Write([]byte("handle, state := aggregateState(fcinfo, " + strconv.Quote(a.Name) + ", " + newState + ")\n"))
+	for _, p := range a.Accumulate.Params {
+		w.Write([]byte("var " + p.Name + " " + p.Type + "\n"))
+	}
+	w.Write([]byte("present, err := fcinfo.scanArgs(1,\n"))
+	for _, p := range a.Accumulate.Params {
+		w.Write([]byte("&" + p.Name + ",\n"))
+	}
+	w.Write([]byte(")\n"))
+	w.Write([]byte(`
+	if(err!=nil){
+		C.elog_error(C.CString(
+			err.Error(),
+		))
+	}
+	if(!present){
+		return handle
+	}
+	`))
+	a.Accumulate.writeTraceArgs(w)
+	w.Write([]byte("state.(*" + a.Name + ").Accumulate(\n"))
+	for _, p := range a.Accumulate.Params {
+		w.Write([]byte(p.arg() + ",\n"))
+	}
+	w.Write([]byte(")\n"))
+	w.Write([]byte("return handle\n"))
+	w.Write([]byte("}\n"))
+
+	writeFuncHeader(w, a.Final.Name)
+	w.Write([]byte("ret := finalState(fcinfo, " + strconv.Quote(a.Name) + ", " + newState + ").(*" + a.Name + ").Final()\n"))
+	w.Write([]byte("if call.traced {\ncall.traceResult(ret)\n}\n"))
+	a.Final.writeReturn(w)
+	w.Write([]byte("}\n"))
+}
+
+//signature returns the name of the aggregate with the SQL types of its parameters
+func (a *AggregateFunction) signature() string {
+	return a.Name + "(" + strings.Join(a.Accumulate.sqlParamTypes(), ",") + ")"
+}
+
+//SQL writes the SQL commands that create the transition and final functions and the aggregate in DB
+func (a *AggregateFunction) SQL(target SQLTarget, w io.Writer) {
+	var paramStrings []string
+	for _, p := range a.Accumulate.Params {
+		paramStrings = append(paramStrings, p.sql())
+	}
+	//the parameters are named, the upgrade scripts read their types
+	w.Write([]byte("CREATE OR REPLACE FUNCTION " + target.qualify(a.Accumulate.Name) + "(" + strings.Join(append([]string{"_state internal"}, paramStrings...), ",") + ")\n"))
+	w.Write([]byte("RETURNS internal AS\n"))
+	w.Write([]byte(modulePathname + ", '" + a.Accumulate.Name + "'\n"))
+	a.Accumulate.writeLanguage(target, w)
+	w.Write([]byte("CREATE OR REPLACE FUNCTION " + target.qualify(a.Final.Name) + "(_state internal)\n"))
+	w.Write([]byte("RETURNS " + a.Final.sqlReturnType() + " AS\n"))
+	w.Write([]byte(modulePathname + ", '" + a.Final.Name + "'\n"))
+	a.Final.writeLanguage(target, w)
+	w.Write([]byte("CREATE AGGREGATE " + target.qualify(a.Name) + "(" + strings.Join(paramStrings, ",") + ") (\n"))
+	w.Write([]byte("\tSFUNC = " + target.qualify(a.Accumulate.Name) + ",\n"))
+	w.Write([]byte("\tSTYPE = internal,\n"))
+	w.Write([]byte("\tFINALFUNC = " + target.qualify(a.Final.Name) + "\n"))
+	w.Write([]byte(");\n"))
+	if a.Doc == "" {
+		w.Write([]byte("\n"))
+		return
+	}
+	w.Write([]byte("COMMENT ON AGGREGATE " + target.qualify(a.signature()) + " IS " + quoteLiteral(a.Doc) + ";\n\n"))
+}
+
+//Describe adds the aggregate to the manifest, the transition and final functions are internal
+func (a *AggregateFunction) Describe(m *Manifest) {
+	function := a.Accumulate.manifestFunction(a.Final.sqlReturnType())
+	function.Name, function.Volatility, function.Strict = a.Name, "", false
+	function.Aggregate = true
+	function.Doc = strings.TrimSpace(a.Doc)
+	m.Functions = append(m.Functions, function)
+}
+
+//Entity returns the id of the aggregate
+func (a *AggregateFunction) Entity() string {
+	return "aggregate " + strings.ToLower(a.Name) + "(" + strings.Join(a.Accumulate.sqlParamTypes(), ",") + ")"
+}
+
+//Dependencies returns the composite types used by the aggregate
+func (a *AggregateFunction) Dependencies() []string {
+	return append(append([]string{}, a.Accumulate.Dependencies()...), a.Final.Dependencies()...)
+}
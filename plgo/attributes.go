@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strconv"
+	"strings"
+)
+
+//FunctionAttributes are the attributes of the CREATE FUNCTION command, declared in the doc comment of the function
+//with the attribute directives, e.g. //plgo:stable strict parallel-safe cost=10
+type FunctionAttributes struct {
+	//Volatility is immutable, stable or volatile
+	Volatility string
+	//Strict functions aren't called with NULL arguments, they return NULL
+	Strict bool
+	//Parallel is safe, restricted or unsafe, empty is the PG default (unsafe)
+	Parallel string
+	//Cost and Rows are the planner estimates, 0 is the PG default
+	Cost, Rows      int
+	Leakproof       bool
+	SecurityDefiner bool
+	//Window functions are called with an OVER clause, they read the rows of the partition
+	Window bool
+	//SearchPath are the schemas of the SET search_path clause declared with //plgo:search-path,
+	//the security definer functions without it get the schema of the function and pg_temp
+	SearchPath []string
+}
+
+//defaultAttributes are the attribute directive words applied to every function before its own directives,
+//the attributes of plgo.toml
+var defaultAttributes []string
+
+//functionAttributes returns the attributes of the function declared with the attribute directives,
+//the words of an directive are separated by spaces or commas, e.g. //plgo:volatile called-on-null-input,cost=100.
+//The functions are immutable by default, strict is the default strictness, the procedures don't get the default attributes
+func functionAttributes(function *ast.FuncDecl, strict bool) (FunctionAttributes, error) {
+	attributes := FunctionAttributes{Volatility: "immutable", Strict: strict}
+	if _, procedure := functionDirectives(function)["procedure"]; !procedure {
+		for _, word := range defaultAttributes {
+			if err := attributes.set(word); err != nil {
+				return attributes, fmt.Errorf("Function %s: default %w", function.Name.Name, err)
+			}
+		}
+	}
+	for _, schema := range functionDirectives(function)["search-path"] {
+		//@extschema@ is the schema of the extension
+		if schema != "@extschema@" && !sqlIdentRe.MatchString(schema) {
+			return attributes, fmt.Errorf("Function %s: //plgo:search-path %s isn't an schema name", function.Name.Name, schema)
+		}
+		if schema != "@extschema@" {
+			schema = sqlName(schema)
+		}
+		attributes.SearchPath = append(attributes.SearchPath, schema)
+	}
+	if function.Doc == nil {
+		return attributes, nil
+	}
+	for _, comment := range function.Doc.List {
+		if !strings.HasPrefix(comment.Text, directivePrefix) {
+			continue
+		}
+		words := strings.FieldsFunc(strings.TrimPrefix(comment.Text, directivePrefix), func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		if len(words) == 0 || !isAttribute(words[0]) {
+			continue
+		}
+		for _, word := range words {
+			if err := attributes.set(word); err != nil {
+				return attributes, fmt.Errorf("Function %s: %w", function.Name.Name, err)
+			}
+		}
+	}
+	return attributes, nil
+}
+
+//isAttribute reports whether the directive word is an function attribute
+func isAttribute(word string) bool {
+	name, _, _ := strings.Cut(word, "=")
+	switch name {
+	case "immutable", "stable", "volatile", "strict", "called-on-null-input",
+		"parallel-safe", "parallel-restricted", "parallel-unsafe",
+		"cost", "rows", "leakproof", "security-definer", "security-invoker":
+		return true
+	}
+	return false
+}
+
+//set sets the attribute declared by the directive word
+func (a *FunctionAttributes) set(word string) error {
+	name, value, hasValue := strings.Cut(word, "=")
+	if hasValue != (name == "cost" || name == "rows") {
+		return fmt.Errorf("invalid attribute %s", word)
+	}
+	switch name {
+	case "immutable", "stable", "volatile":
+		a.Volatility = name
+	case "strict":
+		a.Strict = true
+	case "called-on-null-input":
+		a.Strict = false
+	case "parallel-safe", "parallel-restricted", "parallel-unsafe":
+		a.Parallel = strings.TrimPrefix(name, "parallel-")
+	case "cost", "rows":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("attribute %s must be an positive integer", name)
+		}
+		if name == "cost" {
+			a.Cost = n
+		} else {
+			a.Rows = n
+		}
+	case "leakproof":
+		a.Leakproof = true
+	case "security-definer":
+		a.SecurityDefiner = true
+	case "security-invoker":
+		a.SecurityDefiner = false
+	default:
+		return fmt.Errorf("unknown attribute %s", word)
+	}
+	return nil
+}
+
+//SQL returns the attributes as the clauses of the CREATE FUNCTION command, e.g. STABLE STRICT PARALLEL SAFE COST 10
+func (a FunctionAttributes) SQL() string {
+	clauses := []string{strings.ToUpper(a.Volatility)}
+	if a.Window {
+		clauses = append([]string{"WINDOW"}, clauses...)
+	}
+	if a.Strict {
+		clauses = append(clauses, "STRICT")
+	}
+	if a.Leakproof {
+		clauses = append(clauses, "LEAKPROOF")
+	}
+	if a.SecurityDefiner {
+		clauses = append(clauses, "SECURITY DEFINER")
+	}
+	if a.Parallel != "" {
+		clauses = append(clauses, "PARALLEL "+strings.ToUpper(a.Parallel))
+	}
+	if a.Cost > 0 {
+		clauses = append(clauses, "COST "+strconv.Itoa(a.Cost))
+	}
+	if a.Rows > 0 {
+		clauses = append(clauses, "ROWS "+strconv.Itoa(a.Rows))
+	}
+	return strings.Join(clauses, " ")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//buildCacheDir returns the directory of the cached temporary modules, plgo in the user cache directory
+func buildCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("Cannot find the cache directory: %w", err)
+	}
+	return filepath.Join(dir, plgo), nil
+}
+
+//errLocked is returned by lockFile when the file is locked by another process
+var errLocked = errors.New("The file is locked")
+
+//buildPath returns the emptied temporary module directory of the build configuration (the package directory, pg_config
+//and the build tags) in the build cache. The rebuilds of the configuration write the module into the same directory,
+//so the go build cache compiles only the changed packages. The directory is locked until unlock is called,
+//an concurrent build of the configuration waits for it
+func buildPath(packagePath string, buildTags []string) (dir string, unlock func(), err error) {
+	absPackagePath, err := filepath.Abs(packagePath)
+	if err != nil {
+		return "", nil, err
+	}
+	cacheDir, err := buildCacheDir()
+	if err != nil {
+		return "", nil, err
+	}
+	key := sha256.Sum256([]byte(absPackagePath + "\x00" + pgConfigPath() + "\x00" + strings.Join(buildTags, ",")))
+	dir = filepath.Join(cacheDir, filepath.Base(absPackagePath)+"-"+hex.EncodeToString(key[:8]))
+	if err = os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", nil, err
+	}
+	lock, err := os.OpenFile(dir+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return "", nil, err
+	}
+	if err = lockFile(lock, false); err == errLocked {
+		log.Printf("waiting for the other build of %s in %s", packagePath, dir)
+		err = lockFile(lock, true)
+	}
+	if err != nil {
+		lock.Close()
+		return "", nil, fmt.Errorf("Cannot lock %s: %w", dir, err)
+	}
+	unlock = func() { lock.Close() }
+	if err = os.RemoveAll(dir); err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err != nil {
+		unlock()
+		return "", nil, err
+	}
+	return dir, unlock, nil
+}
+
+//clean removes the cached temporary modules, plgo clean
+func clean(args []string) error {
+	cacheDir, err := buildCacheDir()
+	if err != nil {
+		return err
+	}
+	if err = os.RemoveAll(cacheDir); err != nil {
+		return fmt.Errorf("Cannot remove %s: %w", cacheDir, err)
+	}
+	fmt.Println("Removed", cacheDir)
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//setCacheDir sets the user cache directory of the test
+func setCacheDir(t *testing.T) string {
+	t.Helper()
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	t.Setenv("LocalAppData", cache)
+	dir, err := buildCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestBuildPath(t *testing.T) {
+	cacheDir := setCacheDir(t)
+	defer func(path string) { pgConfig = path }(pgConfig)
+	pgConfig = "/usr/lib/postgresql/16/bin/pg_config"
+	path := func(packagePath string, buildTags ...string) string {
+		t.Helper()
+		dir, unlock, err := buildPath(packagePath, buildTags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unlock()
+		return dir
+	}
+	ext := path("ext")
+	if !strings.HasPrefix(ext, filepath.Join(cacheDir, "ext-")) {
+		t.Errorf("the module of ext is built in %s, not in %s", ext, cacheDir)
+	}
+	if err := os.WriteFile(filepath.Join(ext, "stale.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if again := path("./ext/"); again != ext {
+		t.Errorf("the rebuild of ext is in %s, not in %s", again, ext)
+	}
+	if _, err := os.Stat(filepath.Join(ext, "stale.go")); !os.IsNotExist(err) {
+		t.Errorf("the directory of the rebuild isn't emptied: %v", err)
+	}
+	others := map[string]string{"other package": path("other/ext"), "build tags": path("ext", "plgo_codecs")}
+	pgConfig = "/usr/lib/postgresql/15/bin/pg_config"
+	others["pg_config"] = path("ext")
+	for name, dir := range others {
+		if dir == ext {
+			t.Errorf("the build with another %s is in the directory of ext %s", name, dir)
+		}
+	}
+	//the concurrent build waits until the directory is unlocked, it doesn't empty it meanwhile
+	_, unlock, err := buildPath("ext", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(ext, "main.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	concurrent := make(chan error)
+	go func() {
+		_, unlock, err := buildPath("ext", nil)
+		if err == nil {
+			unlock()
+		}
+		concurrent <- err
+	}()
+	select {
+	case err = <-concurrent:
+		t.Fatalf("the concurrent build didn't wait for the lock: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if _, err = os.Stat(filepath.Join(ext, "main.go")); err != nil {
+		t.Errorf("the concurrent build emptied the locked directory: %v", err)
+	}
+	unlock()
+	if err = <-concurrent; err != nil {
+		t.Fatal(err)
+	}
+	if err := clean(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Errorf("plgo clean didn't remove %s: %v", cacheDir, err)
+	}
+}
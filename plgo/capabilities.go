@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//capabilities of the functions, declared with //plgo:requires
+const (
+	capabilityNet  = "net"
+	capabilityFS   = "fs"
+	capabilityExec = "exec"
+)
+
+var allCapabilities = []string{capabilityNet, capabilityFS, capabilityExec}
+
+//capabilityImports are the packages whose every use needs the capabilities, the path ending with /... matches
+//the package with its subpackages. The other net packages (net/url, net/netip, net/mail) don't access the network
+var capabilityImports = []struct {
+	path         string
+	capabilities []string
+}{
+	{"net", []string{capabilityNet}},
+	{"net/http/...", []string{capabilityNet}},
+	{"net/rpc/...", []string{capabilityNet}},
+	{"net/smtp", []string{capabilityNet}},
+	{"net/textproto", []string{capabilityNet}},
+	{"os/exec", []string{capabilityExec}},
+	{"plugin", []string{capabilityExec}},
+	{"syscall/...", allCapabilities},
+	{"golang.org/x/sys/...", allCapabilities},
+}
+
+//capabilityFuncs are the functions of the other packages that need an capability
+var capabilityFuncs = map[string]map[string]string{
+	"os": {
+		"Chdir": capabilityFS, "Chmod": capabilityFS, "Chown": capabilityFS, "Chtimes": capabilityFS,
+		"Create": capabilityFS, "CreateTemp": capabilityFS, "DirFS": capabilityFS, "Lchown": capabilityFS,
+		"Link": capabilityFS, "Lstat": capabilityFS, "Mkdir": capabilityFS, "MkdirAll": capabilityFS,
+		"MkdirTemp": capabilityFS, "NewFile": capabilityFS, "Open": capabilityFS, "OpenFile": capabilityFS,
+		"ReadDir": capabilityFS, "ReadFile": capabilityFS, "Readlink": capabilityFS, "Remove": capabilityFS,
+		"RemoveAll": capabilityFS, "Rename": capabilityFS, "Stat": capabilityFS, "Symlink": capabilityFS,
+		"Truncate": capabilityFS, "WriteFile": capabilityFS, "StartProcess": capabilityExec,
+	},
+	"io/ioutil": {
+		"ReadDir": capabilityFS, "ReadFile": capabilityFS, "TempDir": capabilityFS, "TempFile": capabilityFS,
+		"WriteFile": capabilityFS,
+	},
+	"path/filepath": {
+		"Glob": capabilityFS, "Walk": capabilityFS, "WalkDir": capabilityFS, "EvalSymlinks": capabilityFS,
+	},
+}
+
+//capabilityUse is an use of an capability in the package
+type capabilityUse struct {
+	capability string
+	what       string
+	pos        token.Pos
+}
+
+//CapabilityVisitor collects the network, file system and process execution access of the package.
+//The uses are tracked per top level function, including the package functions it calls.
+//Access through methods or through other packages isn't attributed to the functions
+type CapabilityVisitor struct {
+	fset *token.FileSet
+	//imports are the local names of the packages imported by the current file
+	imports map[string]string
+	//current is the top level function being visited
+	current string
+	//uses are the capability uses by the functions, the uses outside of functions are under ""
+	uses map[string][]capabilityUse
+	//refs are the identifiers used by the functions, some of them are the called package functions
+	refs map[string][]string
+}
+
+//NewCapabilityVisitor collects the capability uses of the package
+func NewCapabilityVisitor(fset *token.FileSet, packageAst *ast.Package) *CapabilityVisitor {
+	v := &CapabilityVisitor{fset: fset, uses: make(map[string][]capabilityUse), refs: make(map[string][]string)}
+	for _, file := range packageAst.Files {
+		ast.Walk(v, file)
+	}
+	return v
+}
+
+//Visit records the imports, the capability uses and the references of the functions
+func (v *CapabilityVisitor) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.File:
+		v.current = ""
+		v.imports = make(map[string]string)
+		for _, spec := range n.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			name := path.Base(importPath)
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			v.imports[name] = importPath
+			for _, capability := range importCapabilities(importPath) {
+				v.uses[""] = append(v.uses[""], capabilityUse{capability: capability, what: "import of " + importPath, pos: spec.Pos()})
+			}
+		}
+	case *ast.FuncDecl:
+		v.current = ""
+		if n.Recv == nil {
+			v.current = n.Name.Name
+		}
+		if n.Body != nil {
+			ast.Walk(v, n.Body)
+		}
+		v.current = ""
+		return nil
+	case *ast.SelectorExpr:
+		ident, ok := n.X.(*ast.Ident)
+		if !ok {
+			return v
+		}
+		importPath, ok := v.imports[ident.Name]
+		if !ok {
+			return v
+		}
+		what := ident.Name + "." + n.Sel.Name
+		for _, capability := range importCapabilities(importPath) {
+			v.uses[v.current] = append(v.uses[v.current], capabilityUse{capability: capability, what: what, pos: n.Pos()})
+		}
+		if capability, ok := capabilityFuncs[importPath][n.Sel.Name]; ok {
+			v.uses[v.current] = append(v.uses[v.current], capabilityUse{capability: capability, what: what, pos: n.Pos()})
+		}
+		return nil
+	case *ast.Ident:
+		if v.current != "" {
+			v.refs[v.current] = append(v.refs[v.current], n.Name)
+		}
+	}
+	return v
+}
+
+func importCapabilities(importPath string) []string {
+	for _, imp := range capabilityImports {
+		if prefix, ok := strings.CutSuffix(imp.path, "/..."); ok {
+			if importPath == prefix || strings.HasPrefix(importPath, prefix+"/") {
+				return imp.capabilities
+			}
+		} else if importPath == imp.path {
+			return imp.capabilities
+		}
+	}
+	return nil
+}
+
+//functionUses returns the capability uses of the function and the package functions it calls
+func (v *CapabilityVisitor) functionUses(name string) []capabilityUse {
+	var uses []capabilityUse
+	visited := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		uses = append(uses, v.uses[name]...)
+		for _, ref := range v.refs[name] {
+			if _, ok := v.refs[ref]; ok || v.uses[ref] != nil {
+				visit(ref)
+			}
+		}
+	}
+	visit(name)
+	return uses
+}
+
+//Check returns an error if the function uses an capability not declared with //plgo:requires
+func (v *CapabilityVisitor) Check(function string, requires []string) error {
+	declared := make(map[string]bool)
+	for _, capability := range requires {
+		if !contains(allCapabilities, capability) {
+			return fmt.Errorf("Function %s: unknown capability %s in //plgo:requires, use %s", function, capability, strings.Join(allCapabilities, ","))
+		}
+		declared[capability] = true
+	}
+	for _, use := range v.functionUses(function) {
+		if !declared[use.capability] {
+			return fmt.Errorf("Function %s uses %s (%s at %s), declare it with //plgo:requires %s",
+				function, use.capability, use.what, v.fset.Position(use.pos), use.capability)
+		}
+	}
+	return nil
+}
+
+//Restricted returns the descriptions of all capability uses in the package, see plgo -restricted
+func (v *CapabilityVisitor) Restricted() []string {
+	var all []capabilityUse
+	for _, uses := range v.uses {
+		all = append(all, uses...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].pos < all[j].pos })
+	var ret []string
+	for i, use := range all {
+		if i > 0 && all[i-1].pos == use.pos {
+			continue
+		}
+		ret = append(ret, fmt.Sprintf("%s: %s is not allowed in restricted mode", v.fset.Position(use.pos), use.what))
+	}
+	return ret
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportCapabilities(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"net", []string{capabilityNet}},
+		{"net/http", []string{capabilityNet}},
+		{"net/http/httputil", []string{capabilityNet}},
+		{"net/rpc/jsonrpc", []string{capabilityNet}},
+		{"net/smtp", []string{capabilityNet}},
+		{"net/url", nil},
+		{"net/netip", nil},
+		{"net/mail", nil},
+		{"network", nil},
+		{"os/exec", []string{capabilityExec}},
+		{"os", nil},
+		{"syscall", allCapabilities},
+		{"syscall/js", allCapabilities},
+		{"golang.org/x/sys/unix", allCapabilities},
+		{"golang.org/x/sysinfo", nil},
+		{"encoding/json", nil},
+	}
+	for _, test := range tests {
+		if capabilities := importCapabilities(test.path); !reflect.DeepEqual(capabilities, test.want) {
+			t.Errorf("importCapabilities(%q) = %q, want %q", test.path, capabilities, test.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strings"
+)
+
+//Cast is the cast from the parameter type to the result type of an function declared with //plgo:cast,
+//func(v Source) Target. The cast is explicit by default, //plgo:cast assignment is applied in the assignments too
+//and //plgo:cast implicit in any context
+type Cast struct {
+	//Context is "", ASSIGNMENT or IMPLICIT
+	Context string
+	//Function is the function of the cast
+	Function *Function
+}
+
+//newCasts returns the cast declared by the //plgo:cast directive of the function, if any
+func newCasts(function *ast.FuncDecl, code CodeWriter) ([]CodeWriter, error) {
+	words, ok := functionDirectives(function)["cast"]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := code.(*Function)
+	if !ok || len(f.Params) != 1 {
+		return nil, fmt.Errorf("Function %s: the cast function must be func(v Source) Target", function.Name.Name)
+	}
+	if f.Params[0].SQLType == f.SQLReturnType {
+		return nil, fmt.Errorf("Function %s: the cast function converts %s to itself", function.Name.Name, f.SQLReturnType)
+	}
+	c := &Cast{Function: f}
+	words = strings.Fields(strings.Join(words, " "))
+	switch {
+	case len(words) == 0 || (len(words) == 1 && words[0] == "explicit"):
+	case len(words) == 1 && (words[0] == "assignment" || words[0] == "implicit"):
+		c.Context = strings.ToUpper(words[0])
+	default:
+		return nil, fmt.Errorf("Function %s: //plgo:cast %s, the cast is explicit, assignment or implicit", function.Name.Name, strings.Join(words, " "))
+	}
+	return []CodeWriter{c}, nil
+}
+
+//types returns the source and the target type of the cast, e.g. (version AS text)
+func (c *Cast) types() string {
+	return "(" + c.Function.Params[0].SQLType + " AS " + c.Function.SQLReturnType + ")"
+}
+
+//FuncDec returns nothing, cast isn't a function
+func (c *Cast) FuncDec() string {
+	return ""
+}
+
+//Code does nothing, the function of the cast has the wrapper
+func (c *Cast) Code(w io.Writer) {}
+
+//SQL writes the SQL command that creates the cast in DB, the casts have no schema
+func (c *Cast) SQL(target SQLTarget, w io.Writer) {
+	w.Write([]byte("CREATE CAST " + c.types() + "\nWITH FUNCTION " + c.Function.target(target).qualify(c.Function.signature())))
+	if c.Context != "" {
+		w.Write([]byte("\nAS " + c.Context))
+	}
+	w.Write([]byte(";\n\n"))
+}
+
+//Entity returns the id of the cast, e.g. "cast (version as text)"
+func (c *Cast) Entity() string {
+	return relationEntity("cast", c.types())
+}
+
+//Dependencies returns the function of the cast
+func (c *Cast) Dependencies() []string {
+	return []string{c.Function.Entity()}
+}
+
+//Describe adds the cast to the manifest
+func (c *Cast) Describe(m *Manifest) {
+	m.Relations = append(m.Relations, ManifestRelation{Kind: "cast", Name: c.types()})
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+//configFile is the build configuration of the package, the flags of the command line override it
+const configFile = "plgo.toml"
+
+//Config is the build configuration of the extension read from plgo.toml in the package directory:
+//
+//	name = "geo"                  # extension name, the directory name by default
+//	version = "1.2"               # overrides //plgo:version
+//	schema = "geo"
+//	pg_config = "/usr/lib/postgresql/16/bin/pg_config"
+//	cflags = "-I/opt/proj/include"
+//	ldflags = "-L/opt/proj/lib"
+//	trusted = true
+//	codecs = false
+//
+//	[functions]
+//	attributes = "stable parallel-safe"   # default attributes, the //plgo: directives of the function override them
+//	naming = "snake_case"                 # SQL names of the functions, go (the Go names) by default, //plgo:name overrides them
+//	grant = ["app_user"]                  # roles executing the functions without //plgo:grant, PUBLIC is revoked
+//
+//	[control]
+//	comment = "geographic functions"
+//	requires = ["postgis"]
+//	superuser = false
+type Config struct {
+	Name, Version, Schema string
+	//PgConfig is the pg_config of the target installation
+	PgConfig string
+	//CFlags and LDFlags are added to CGO_CFLAGS and CGO_LDFLAGS of the build of the shared object
+	CFlags, LDFlags string
+	Trusted, Codecs bool
+	//Attributes are the default attribute directive words of the functions, e.g. stable parallel-safe
+	Attributes []string
+	//Grants are the roles allowed to execute the functions without //plgo:grant
+	Grants []string
+	//Naming is the conversion of the Go names of the functions into the SQL names, go or snake_case
+	Naming string
+	//Comment and Requires of the control file, the required extensions are added to the detected ones
+	Comment  string
+	Requires []string
+	//Control are the other parameters of the control file with their values as written, e.g. superuser = false
+	Control map[string]string
+}
+
+//ReadConfig reads plgo.toml of the package, the empty configuration if it doesn't exist
+func ReadConfig(packagePath string) (*Config, error) {
+	path := filepath.Join(packagePath, configFile)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	values, err := parseTOML(data)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse %s: %w", path, err)
+	}
+	config := &Config{Control: make(map[string]string)}
+	strs := map[string]*string{"name": &config.Name, "version": &config.Version, "schema": &config.Schema, "pg_config": &config.PgConfig,
+		"cflags": &config.CFlags, "ldflags": &config.LDFlags, "control.comment": &config.Comment, "functions.naming": &config.Naming}
+	bools := map[string]*bool{"trusted": &config.Trusted, "codecs": &config.Codecs}
+	for key, value := range values {
+		var ok bool
+		switch {
+		case strs[key] != nil:
+			*strs[key], ok = value.(string)
+		case bools[key] != nil:
+			*bools[key], ok = value.(bool)
+		case key == "functions.attributes", key == "functions.grant", key == "control.requires":
+			var list []string
+			switch v := value.(type) {
+			case string:
+				list, ok = strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' }), true
+			case []string:
+				list, ok = v, true
+			}
+			switch key {
+			case "control.requires":
+				config.Requires = list
+			case "functions.grant":
+				config.Grants = list
+			default:
+				config.Attributes = list
+			}
+		case strings.HasPrefix(key, "control."):
+			name := strings.TrimPrefix(key, "control.")
+			switch v := value.(type) {
+			case string:
+				config.Control[name], ok = quoteControlValue(v), true
+			case bool:
+				config.Control[name], ok = strconv.FormatBool(v), true
+			case int64:
+				config.Control[name], ok = strconv.FormatInt(v, 10), true
+			}
+		default:
+			return nil, fmt.Errorf("%s: unknown setting %s", path, key)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s: invalid value of %s", path, key)
+		}
+	}
+	for _, word := range config.Attributes {
+		//rows is allowed only for the set returning functions
+		if !isAttribute(word) || strings.HasPrefix(word, "rows") {
+			return nil, fmt.Errorf("%s: %s isn't an default function attribute", path, word)
+		}
+	}
+	if config.Naming != "" && config.Naming != "go" && config.Naming != "snake_case" {
+		return nil, fmt.Errorf("%s: naming %s isn't go or snake_case", path, config.Naming)
+	}
+	if config.Name != "" && !extensionNameRe.MatchString(config.Name) {
+		return nil, fmt.Errorf("%s: extension name %s must be lowercase letters, digits and underscores, starting with a letter", path, config.Name)
+	}
+	return config, nil
+}
+
+//cgoEnv returns CGO_CFLAGS and CGO_LDFLAGS of the build with the flags of plgo.toml added, nil without them
+func (c *Config) cgoEnv() ([]string, error) {
+	var env []string
+	for _, v := range []struct{ name, flags string }{{"CGO_CFLAGS", c.CFlags}, {"CGO_LDFLAGS", c.LDFlags}} {
+		if v.flags == "" {
+			continue
+		}
+		//the flags of go env are the defaults, e.g. -O2 -g
+		flags, err := goEnv(v.name)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, v.name+"="+strings.TrimSpace(flags+" "+v.flags))
+	}
+	return env, nil
+}
+
+//controlFlags are the command line flags of the control file parameters, they override plgo.toml
+type controlFlags struct {
+	comment, requires, modulePathname string
+	superuser                         bool
+}
+
+//addControlFlags adds the flags of the control file parameters to the flags of the command
+func addControlFlags(flags *flag.FlagSet) *controlFlags {
+	c := &controlFlags{}
+	flags.StringVar(&c.comment, "comment", "", "comment of the extension in the control file, the comment of plgo.toml by default")
+	flags.StringVar(&c.requires, "requires", "", "comma separated extensions required by the extension, e.g. hstore,postgis")
+	flags.BoolVar(&c.superuser, "superuser", true, "-superuser=false allows the non-superusers with the CREATE privilege on the database to create the extension")
+	flags.StringVar(&c.modulePathname, "module-pathname", "", "module_pathname of the control file, the shared object of the functions, $libdir/<extension> by default")
+	return c
+}
+
+//apply sets the control file parameters of the flags in the configuration of the extension
+func (c *controlFlags) apply(config *Config) {
+	if c.comment != "" {
+		config.Comment = c.comment
+	}
+	config.Requires = append(config.Requires, splitList(c.requires)...)
+	if !c.superuser {
+		config.setControl("superuser", "false")
+	}
+	if c.modulePathname != "" {
+		config.setControl("module_pathname", quoteControlValue(c.modulePathname))
+	}
+}
+
+//setControl sets the parameter of the control file to the value as written, e.g. superuser = false
+func (c *Config) setControl(name, value string) {
+	if c.Control == nil {
+		c.Control = make(map[string]string)
+	}
+	c.Control[name] = value
+}
+
+//parseTOML parses plgo.toml, the keys of the tables are prefixed with the table name, e.g. control.comment.
+//The arrays of strings are []string
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	var document map[string]interface{}
+	if _, err := toml.Decode(string(data), &document); err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	flattenTOML(values, "", document)
+	return values, nil
+}
+
+//flattenTOML adds the values of the table to the values with the keys prefixed by the table name
+func flattenTOML(values map[string]interface{}, prefix string, table map[string]interface{}) {
+	for key, value := range table {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenTOML(values, prefix+key+".", v)
+		case []interface{}:
+			list := make([]string, 0, len(v))
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					//the other arrays are invalid values of the settings
+					list = nil
+					break
+				}
+				list = append(list, s)
+			}
+			if list != nil {
+				values[prefix+key] = list
+			} else {
+				values[prefix+key] = v
+			}
+		default:
+			values[prefix+key] = v
+		}
+	}
+}
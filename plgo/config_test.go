@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	tests := []struct {
+		name, toml string
+		want       *Config
+		//err is the part of the expected error
+		err string
+	}{
+		{
+			name: "settings",
+			toml: `name = "geo"   # the extension name
+version = '1.2'
+trusted = true
+cflags = "-I/opt/proj/include -DNAME=\"geo\""
+
+[functions]
+attributes = "stable parallel-safe"
+grant = [
+	"app_user",   # the application
+	"reporting",
+]
+
+[control]
+comment = "geographic # functions"
+requires = ["postgis"]
+superuser = false
+`,
+			want: &Config{Name: "geo", Version: "1.2", Trusted: true, CFlags: `-I/opt/proj/include -DNAME="geo"`,
+				Attributes: []string{"stable", "parallel-safe"}, Grants: []string{"app_user", "reporting"},
+				Comment: "geographic # functions", Requires: []string{"postgis"}, Control: map[string]string{"superuser": "false"}},
+		},
+		{
+			name: "inline table",
+			toml: `functions = { naming = "snake_case", attributes = ["immutable", "strict"] }
+control.module_pathname = "$libdir/geo"
+control.priority = 10
+`,
+			want: &Config{Naming: "snake_case", Attributes: []string{"immutable", "strict"},
+				Control: map[string]string{"module_pathname": "'$libdir/geo'", "priority": "10"}},
+		},
+		{name: "empty", toml: "", want: &Config{Control: map[string]string{}}},
+		{name: "unknown setting", toml: "nmae = \"geo\"\n", err: "unknown setting nmae"},
+		{name: "invalid value", toml: "trusted = \"yes\"\n", err: "invalid value of trusted"},
+		{name: "array of integers", toml: "[functions]\ngrant = [1, 2]\n", err: "invalid value of functions.grant"},
+		{name: "duplicate key", toml: "name = \"a\"\nname = \"b\"\n", err: "Cannot parse"},
+		{name: "syntax error", toml: "name = \n", err: "Cannot parse"},
+		{name: "invalid name", toml: "name = \"Geo\"\n", err: "extension name Geo"},
+		{name: "invalid attribute", toml: "[functions]\nattributes = \"rows=10\"\n", err: "isn't an default function attribute"},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, configFile), []byte(test.toml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := ReadConfig(dir)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(config, test.want) {
+			t.Errorf("%s: config\n%+v\nwant\n%+v", test.name, config, test.want)
+		}
+	}
+}
+
+func TestReadConfigMissing(t *testing.T) {
+	config, err := ReadConfig(t.TempDir())
+	if err != nil || !reflect.DeepEqual(config, &Config{}) {
+		t.Errorf("ReadConfig without plgo.toml = %+v, %v", config, err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"os/exec"
+	"strings"
+)
+
+//debugMode logs the generated files, the commands run by plgo and the cgo flags of the build, plgo build -debug
+var debugMode bool
+
+//debugf logs the message in the debug mode
+func debugf(format string, args ...interface{}) {
+	if debugMode {
+		log.Printf(format, args...)
+	}
+}
+
+//debugCommand logs the command line with its directory and the environment variables added by plgo in the debug mode
+func debugCommand(cmd *exec.Cmd, env []string) {
+	if !debugMode {
+		return
+	}
+	dir := cmd.Dir
+	if dir == "" {
+		dir = "."
+	}
+	line := strings.Join(cmd.Args, " ")
+	if len(env) > 0 {
+		line = strings.Join(env, " ") + " " + line
+	}
+	log.Printf("run in %s: %s", dir, line)
+}
+
+//isGeneratedFile reports if the file of the temporary module is generated from the package,
+//the others are the runtime files
+func isGeneratedFile(name string) bool {
+	return strings.HasPrefix(name, "package_") || name == "pl.go" || name == "methods.go"
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"go/ast"
+	"strings"
+)
+
+//directivePrefix starts the plgo directives in the doc comment of an function or type, e.g. //plgo:requires net,fs
+const directivePrefix = "//plgo:"
+
+//functionDirectives returns the comma separated values of the plgo directives of the function by the directive names
+func functionDirectives(function *ast.FuncDecl) map[string][]string {
+	return docDirectives(function.Doc)
+}
+
+//docDirectives returns the comma separated values of the plgo directives in the doc comment by the directive names
+func docDirectives(doc *ast.CommentGroup) map[string][]string {
+	directives := make(map[string][]string)
+	if doc == nil {
+		return directives
+	}
+	for _, comment := range doc.List {
+		if !strings.HasPrefix(comment.Text, directivePrefix) {
+			continue
+		}
+		name, values, _ := strings.Cut(strings.TrimPrefix(comment.Text, directivePrefix), " ")
+		directives[name] = append(directives[name], splitList(values)...)
+	}
+	return directives
+}
+
+//splitList splits the comma separated list, the empty items are skipped
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	texttemplate "text/template"
+)
+
+//docBlock is an paragraph or an example of an doc comment,
+//the indented lines of the comment are the examples like in the Go doc comments
+type docBlock struct {
+	Code bool
+	Text string
+}
+
+//docBlocks splits the doc comment into paragraphs and examples
+func docBlocks(doc string) []docBlock {
+	var blocks []docBlock
+	var lines []string
+	code := false
+	flush := func() {
+		text := strings.Join(lines, "\n")
+		if code {
+			text = dedent(lines)
+		}
+		if strings.TrimSpace(text) != "" {
+			blocks = append(blocks, docBlock{Code: code, Text: strings.TrimSpace(text)})
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		indented := strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " ")
+		blank := strings.TrimSpace(line) == ""
+		if blank && !code {
+			flush()
+			continue
+		}
+		if !blank && indented != code {
+			flush()
+			code = indented
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return blocks
+}
+
+//dedent removes the common indentation of the example lines
+func dedent(lines []string) string {
+	prefix := ""
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if i == 0 || prefix == "" || strings.HasPrefix(prefix, indent) {
+			prefix = indent
+		}
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = strings.TrimPrefix(line, prefix)
+	}
+	return strings.Join(out, "\n")
+}
+
+//docSignature returns the SQL signature of the function with the argument names
+func docSignature(f ManifestFunction) string {
+	args := make([]string, len(f.Args))
+	for i, arg := range f.Args {
+		args[i] = arg
+		if i < len(f.ArgNames) && f.ArgNames[i] != "" {
+			args[i] = f.ArgNames[i] + " " + arg
+		}
+		if i < len(f.Defaults) && f.Defaults[i] != "" {
+			args[i] += " DEFAULT " + f.Defaults[i]
+		}
+	}
+	name := f.Name
+	if f.Schema != "" {
+		name = f.Schema + "." + name
+	}
+	if f.Procedure {
+		return name + "(" + strings.Join(args, ", ") + ")"
+	}
+	return name + "(" + strings.Join(args, ", ") + ") RETURNS " + f.Returns
+}
+
+//docAttributes returns the volatility, strictness and parallel safety of the function, or AGGREGATE or PROCEDURE
+func docAttributes(f ManifestFunction) string {
+	attributes := []string{}
+	if f.Aggregate {
+		attributes = append(attributes, "AGGREGATE")
+	}
+	if f.Procedure {
+		attributes = append(attributes, "PROCEDURE")
+	}
+	if f.Volatility != "" {
+		attributes = append(attributes, strings.ToUpper(f.Volatility))
+	}
+	if f.Strict {
+		attributes = append(attributes, "STRICT")
+	}
+	if f.Parallel != "" {
+		attributes = append(attributes, "PARALLEL "+strings.ToUpper(f.Parallel))
+	}
+	return strings.Join(attributes, " ")
+}
+
+var docFuncs = map[string]interface{}{
+	"blocks":     docBlocks,
+	"signature":  docSignature,
+	"attributes": docAttributes,
+}
+
+const markdownDoc = `# {{.Extension}} {{.Version}}
+{{range blocks .Doc}}
+{{if .Code}}` + "```sql\n{{.Text}}\n```" + `{{else}}{{.Text}}{{end}}
+{{end}}
+## Functions
+{{range .Functions}}
+### {{.Name}}
+
+` + "```sql\n{{signature .}}\n```" + `
+{{with attributes .}}
+{{.}}
+{{end}}{{range blocks .Doc}}
+{{if .Code}}` + "```sql\n{{.Text}}\n```" + `{{else}}{{.Text}}{{end}}
+{{end}}{{end}}{{if .Relations}}
+## Tables, views and types
+{{range .Relations}}
+### {{.Name}} ({{.Kind}})
+{{range blocks .Doc}}
+{{if .Code}}` + "```sql\n{{.Text}}\n```" + `{{else}}{{.Text}}{{end}}
+{{end}}{{end}}{{end}}`
+
+const htmlDoc = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Extension}} {{.Version}}</title>
+</head>
+<body>
+<h1>{{.Extension}} {{.Version}}</h1>
+{{range blocks .Doc}}{{if .Code}}<pre><code>{{.Text}}</code></pre>{{else}}<p>{{.Text}}</p>{{end}}
+{{end}}<h2>Functions</h2>
+{{range .Functions}}<h3 id="{{.Name}}">{{.Name}}</h3>
+<pre><code>{{signature .}}</code></pre>
+{{with attributes .}}<p><em>{{.}}</em></p>
+{{end}}{{range blocks .Doc}}{{if .Code}}<pre><code>{{.Text}}</code></pre>{{else}}<p>{{.Text}}</p>{{end}}
+{{end}}{{end}}{{if .Relations}}<h2>Tables, views and types</h2>
+{{range .Relations}}<h3 id="{{.Name}}">{{.Name}} ({{.Kind}})</h3>
+{{range blocks .Doc}}{{if .Code}}<pre><code>{{.Text}}</code></pre>{{else}}<p>{{.Text}}</p>{{end}}
+{{end}}{{end}}{{end}}</body>
+</html>
+`
+
+//WriteDoc writes the documentation of the SQL functions, tables and views of the extension as markdown or html
+func WriteDoc(m *Manifest, format string, w io.Writer) error {
+	if format == "html" {
+		return htmltemplate.Must(htmltemplate.New("doc").Funcs(docFuncs).Parse(htmlDoc)).Execute(w, m)
+	}
+	return texttemplate.Must(texttemplate.New("doc").Funcs(docFuncs).Parse(markdownDoc)).Execute(w, m)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+//dockerBuildfile is the Dockerfile of the build image: the Debian based postgres image with the server headers
+//of its version (PG_MAJOR), gcc, the Go toolchain and plgo. The build runs as the user, so the caches are in /tmp
+const dockerBuildfile = `FROM golang:1-bookworm AS go
+
+FROM %s
+RUN apt-get update \
+	&& apt-get install -y --no-install-recommends ca-certificates gcc libc6-dev make git postgresql-server-dev-$PG_MAJOR \
+	&& rm -rf /var/lib/apt/lists/*
+COPY --from=go /usr/local/go /usr/local/go
+RUN GOBIN=/usr/local/bin GOPATH=/root/go GOCACHE=/root/go-cache /usr/local/go/bin/go install github.com/algonode/plgo/plgo@%s \
+	&& rm -rf /root/go /root/go-cache
+ENV PATH=/usr/local/go/bin:$PATH HOME=/tmp GOPATH=/tmp/go GOCACHE=/tmp/go-cache
+`
+
+//dockerTagRe matches the characters not allowed in the tag of the build image
+var dockerTagRe = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+//moduleRoot returns the directory of the go.mod of the package, the package directory without it
+func moduleRoot(packagePath string) (string, error) {
+	dir, err := filepath.Abs(packagePath)
+	if err != nil {
+		return "", err
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err = os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d, nil
+		}
+		if filepath.Dir(d) == d {
+			return dir, nil
+		}
+	}
+}
+
+//dockerArgs returns the build flags set on the command line for plgo in the container,
+//without the flags of the docker build and the output directory
+func dockerArgs() []string {
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "docker", "o", "pg", "plgo-source":
+			return
+		}
+		args = append(args, "-"+f.Name+"="+f.Value.String())
+	})
+	return args
+}
+
+//buildInDocker builds the extension in an container of the postgres image, with the glibc and the server headers
+//of the image, the shared object and the extension files are written into the output directory.
+//The image is extended with gcc, the server headers, the Go toolchain and plgo, the module of the package is mounted into it
+func buildInDocker(image, packagePath, output string) error {
+	root, err := moduleRoot(packagePath)
+	if err != nil {
+		return err
+	}
+	absPackage, err := filepath.Abs(packagePath)
+	if err != nil {
+		return err
+	}
+	relPackage, err := filepath.Rel(root, absPackage)
+	if err != nil {
+		return err
+	}
+	if err = makeBuildDir(output); err != nil {
+		return err
+	}
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	context, err := ioutil.TempDir("", "plgodocker")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(context)
+	dockerfile := fmt.Sprintf(dockerBuildfile, image, plgoModuleVersion())
+	if err = ioutil.WriteFile(filepath.Join(context, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		return err
+	}
+	tag := "plgo-build:" + strings.Trim(dockerTagRe.ReplaceAllString(strings.ToLower(image), "-"), "-.")
+	fmt.Println("Building the image", tag)
+	dockerBuild := exec.Command("docker", "build", "-t", tag, context)
+	dockerBuild.Stdout = os.Stdout
+	dockerBuild.Stderr = os.Stderr
+	if err = dockerBuild.Run(); err != nil {
+		return fmt.Errorf("Cannot build the image %s: %w", tag, err)
+	}
+	run := []string{"run", "--rm", "-v", root + ":/src", "-v", absOutput + ":/out", "-w", filepath.ToSlash(filepath.Join("/src", relPackage))}
+	//the files written into the mounted directories are owned by the user
+	if runtime.GOOS == "linux" {
+		run = append(run, "--user", strconv.Itoa(os.Getuid())+":"+strconv.Itoa(os.Getgid()))
+	}
+	run = append(run, tag, "plgo", "build", "-o", "/out")
+	run = append(run, dockerArgs()...)
+	dockerRun := exec.Command("docker", append(run, ".")...)
+	dockerRun.Stdout = os.Stdout
+	dockerRun.Stderr = os.Stderr
+	if err = dockerRun.Run(); err != nil {
+		return fmt.Errorf("Cannot build the extension in %s: %w", image, err)
+	}
+	fmt.Println("Built the extension for", image, "into", output)
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//eventTriggerData is the parameter type of the event trigger functions
+const eventTriggerData = "EventTriggerData"
+
+//triggerEvents are the events of the event triggers
+var triggerEvents = map[string]bool{"ddl_command_start": true, "ddl_command_end": true, "sql_drop": true, "table_rewrite": true}
+
+//EventTriggerFunction is an function declared with //plgo:event-trigger event[,tag...],
+//func(ev *plgo.EventTriggerData) or func(ev *plgo.EventTriggerData) error, it is created with the event trigger of the same name
+//fired on the event by the commands with the tags (all the commands without tags)
+type EventTriggerFunction struct {
+	VoidFunction
+	Event string
+	Tags  []string
+}
+
+//newEventTriggerFunction returns the event trigger function declared by the //plgo:event-trigger directive
+func newEventTriggerFunction(function *ast.FuncDecl, options []string) (*EventTriggerFunction, error) {
+	params, results := function.Type.Params.List, function.Type.Results
+	if len(params) != 1 || len(params[0].Names) > 1 || !isPlgoPointer(params[0].Type, eventTriggerData) ||
+		(results != nil && (len(results.List) != 1 || typeString(results.List[0].Type) != "error")) {
+		return nil, fmt.Errorf("Event trigger %s must be func(ev *plgo.EventTriggerData) error", function.Name.Name)
+	}
+	if len(options) == 0 || !triggerEvents[strings.ToLower(options[0])] {
+		return nil, fmt.Errorf("Event trigger %s: the event must be ddl_command_start, ddl_command_end, sql_drop or table_rewrite", function.Name.Name)
+	}
+	directives := functionDirectives(function)
+	f := &EventTriggerFunction{
+		VoidFunction: VoidFunction{Name: function.Name.Name, Doc: function.Doc.Text(), Requires: directives["requires"], Error: results != nil},
+		Event:        strings.ToLower(options[0]),
+	}
+	for _, tag := range options[1:] {
+		f.Tags = append(f.Tags, strings.ToUpper(tag))
+	}
+	return f, nil
+}
+
+//Code writes the wrapper function, it raises an ERROR when it isn't called as an event trigger
+func (f *EventTriggerFunction) Code(w io.Writer) {
+	writeFuncHeader(w, f.Name)
+	w.Write([]byte("ev := fcinfo.EventTriggerData()\n"))
+	w.Write([]byte("if ev == nil {\nC.elog_error(C.CString(" + strconv.Quote(f.Name+" not called by event trigger manager") + "))\n}\n"))
+	if f.Error {
+		w.Write([]byte("retErr := "))
+	}
+	w.Write([]byte("__" + f.Name + "(ev)\n"))
+	f.writeRaise(w)
+	w.Write([]byte("return toDatum(nil)\n"))
+	w.Write([]byte("}\n"))
+}
+
+//SQL writes the SQL commands that create the function and its event trigger in DB,
+//the upgrade script drops the changed event trigger before creating it again
+func (f *EventTriggerFunction) SQL(target SQLTarget, w io.Writer) {
+	f.writeRequires(w)
+	w.Write([]byte("CREATE OR REPLACE FUNCTION " + f.qualifiedName(target) + "()\n"))
+	w.Write([]byte("RETURNS event_trigger AS\n"))
+	w.Write([]byte(modulePathname + ", '" + f.Name + "'\n"))
+	w.Write([]byte("LANGUAGE c;\n"))
+	w.Write([]byte("CREATE EVENT TRIGGER " + sqlName(f.sqlFunctionName()) + " ON " + f.Event + "\n"))
+	if len(f.Tags) > 0 {
+		tags := make([]string, len(f.Tags))
+		for i, tag := range f.Tags {
+			tags[i] = quoteLiteral(tag)
+		}
+		w.Write([]byte("WHEN TAG IN (" + strings.Join(tags, ", ") + ")\n"))
+	}
+	w.Write([]byte("EXECUTE FUNCTION " + f.qualifiedName(target) + "();\n"))
+	if f.Doc == "" {
+		w.Write([]byte("\n"))
+		return
+	}
+	f.Comment(target, w)
+}
+
+//Describe adds the function to the manifest
+func (f *EventTriggerFunction) Describe(m *Manifest) {
+	function := f.manifestFunction("event_trigger")
+	function.Volatility, function.Strict = "", false
+	m.Functions = append(m.Functions, function)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//testDir is the directory of the SQL tests in the package, test/<name>.out is the expected output of test/<name>.sql
+const testDir = "test"
+
+//testCluster is an throwaway PostgreSQL cluster, it listens only on the unix socket in its temporary directory
+type testCluster struct {
+	dir string
+}
+
+//pgBinary returns the path of the PostgreSQL program in the pg_config bindir, or its name to be looked up in PATH
+func pgBinary(name string) string {
+	if out, err := exec.Command(pgConfigPath(), "--bindir").Output(); err == nil {
+		path := filepath.Join(strings.TrimSpace(string(out)), name)
+		if _, err = os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return name
+}
+
+//startTestCluster initializes and starts an cluster in an temporary directory, it returns the conninfo of its postgres database
+func startTestCluster() (*testCluster, string, error) {
+	dir, err := ioutil.TempDir("", "plgotest")
+	if err != nil {
+		return nil, "", err
+	}
+	cluster := &testCluster{dir: dir}
+	initdb := exec.Command(pgBinary("initdb"), "-D", cluster.dataDir(), "-A", "trust", "-U", "postgres", "-E", "UTF8")
+	if out, err := initdb.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return nil, "", fmt.Errorf("Cannot initialize the test cluster: %s\n%s", err, out)
+	}
+	options := "-c listen_addresses='' -k " + dir
+	start := exec.Command(pgBinary("pg_ctl"), "-D", cluster.dataDir(), "-l", filepath.Join(dir, "server.log"), "-o", options, "-w", "start")
+	if out, err := start.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return nil, "", fmt.Errorf("Cannot start the test cluster: %s\n%s", err, out)
+	}
+	return cluster, "host=" + dir + " user=postgres dbname=postgres", nil
+}
+
+//dataDir returns the data directory of the cluster
+func (c *testCluster) dataDir() string {
+	return filepath.Join(c.dir, "data")
+}
+
+//stop stops the cluster and removes its directory
+func (c *testCluster) stop() {
+	exec.Command(pgBinary("pg_ctl"), "-D", c.dataDir(), "-m", "immediate", "-w", "stop").Run()
+	os.RemoveAll(c.dir)
+}
+
+//withDatabase returns the conninfo (key=value or URI) connecting to the database
+func withDatabase(conninfo, database string) string {
+	if u, err := url.Parse(conninfo); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		u.Path = "/" + database
+		return u.String()
+	}
+	return conninfo + " dbname=" + database
+}
+
+//psql runs the psql command with the arguments in the directory, it returns the output and the error output together
+func psql(dir string, args ...string) (string, error) {
+	cmd := exec.Command(pgBinary("psql"), append([]string{"-X", "-q"}, args...)...)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return out.String(), err
+}
+
+//createTestDatabase (re)creates the database with the extension
+func createTestDatabase(conninfo, database, extension string) error {
+	for _, command := range []string{"DROP DATABASE IF EXISTS " + quoteIdent(database), "CREATE DATABASE " + quoteIdent(database)} {
+		if out, err := psql("", "-v", "ON_ERROR_STOP=1", "-d", conninfo, "-c", command); err != nil {
+			return fmt.Errorf("Cannot create the test database %s: %s\n%s", database, err, out)
+		}
+	}
+	out, err := psql("", "-v", "ON_ERROR_STOP=1", "-d", withDatabase(conninfo, database), "-c", "CREATE EXTENSION "+quoteIdent(extension)+" CASCADE")
+	if err != nil {
+		return fmt.Errorf("Cannot create the extension %s: %s\n%s", extension, err, out)
+	}
+	return nil
+}
+
+//runSQLTest runs the SQL test in an new database with the extension, the test passes if psql succeeds,
+//or if the output matches the expected output test/<name>.out when it exists. The output of an failed test is written
+//into <output>/test/<name>.out
+func runSQLTest(conninfo, extension, packagePath, output, name string) error {
+	database := "plgo_test_" + extension
+	if err := createTestDatabase(conninfo, database, extension); err != nil {
+		return err
+	}
+	dir := filepath.Join(packagePath, testDir)
+	expectedName := strings.TrimSuffix(name, ".sql") + ".out"
+	expected, err := ioutil.ReadFile(filepath.Join(dir, expectedName))
+	if os.IsNotExist(err) {
+		out, err := psql(dir, "-v", "ON_ERROR_STOP=1", "-d", withDatabase(conninfo, database), "-f", name)
+		if err != nil {
+			return fmt.Errorf("%s\n%s", err, out)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	//the errors are part of the expected output, the statements are echoed like in pg_regress
+	out, _ := psql(dir, "-a", "-d", withDatabase(conninfo, database), "-f", name)
+	if out == string(expected) {
+		return nil
+	}
+	resultDir := filepath.Join(output, testDir)
+	if err = makeBuildDir(resultDir); err != nil {
+		return err
+	}
+	resultPath := filepath.Join(resultDir, expectedName)
+	if err = ioutil.WriteFile(resultPath, []byte(out), 0644); err != nil {
+		return err
+	}
+	return fmt.Errorf("output differs from %s, see %s", filepath.Join(dir, expectedName), resultPath)
+}
+
+//installExtension installs the built extension with make install into the PostgreSQL installation of pg_config
+func installExtension(output string) error {
+	install := exec.Command("make", "install", "with_llvm=no")
+	install.Dir = output
+	debugCommand(install, nil)
+	if out, err := install.CombinedOutput(); err != nil {
+		return fmt.Errorf("Cannot install the extension (run plgo test with the permissions of make install): %s\n%s", err, out)
+	}
+	return nil
+}
+
+//testExtension builds and installs the extension, then runs the SQL tests of the package and the Go tests against
+//an test database, in an throwaway cluster or in the server of -dsn (PGTEST_DSN)
+func testExtension(args []string) error {
+	var conninfo, goPackages string
+	var keepCluster bool
+	flag.StringVar(&conninfo, "dsn", os.Getenv("PGTEST_DSN"), "conninfo of an existing server for the tests, PGTEST_DSN by default, an throwaway cluster is started without it")
+	flag.StringVar(&goPackages, "go", "", "Go packages tested with go test against the test database (PGTEST_DSN), e.g. ./integration/...")
+	flag.BoolVar(&keepCluster, "keep-cluster", false, "keep the throwaway cluster running after the tests, for debugging")
+	moduleWriter, output, err := buildModule(args)
+	if err != nil {
+		return err
+	}
+	packagePath := "."
+	if flag.NArg() == 1 {
+		packagePath = flag.Arg(0)
+	}
+	tests, err := filepath.Glob(filepath.Join(packagePath, testDir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(tests)
+	if len(tests) == 0 && goPackages == "" {
+		return fmt.Errorf("No tests in %s and no -go packages", filepath.Join(packagePath, testDir))
+	}
+	if err = installExtension(output); err != nil {
+		return err
+	}
+	if conninfo == "" {
+		cluster, clusterConninfo, err := startTestCluster()
+		if err != nil {
+			return err
+		}
+		if keepCluster {
+			fmt.Println("test cluster:", clusterConninfo)
+		} else {
+			defer cluster.stop()
+		}
+		conninfo = clusterConninfo
+	}
+	extension := moduleWriter.PackageName
+	var failed int
+	for _, test := range tests {
+		name := filepath.Base(test)
+		start := time.Now()
+		if err := runSQLTest(conninfo, extension, packagePath, output, name); err != nil {
+			failed++
+			fmt.Printf("FAIL\t%s\t%.2fs\n%s\n", name, time.Since(start).Seconds(), err)
+			continue
+		}
+		fmt.Printf("ok\t%s\t%.2fs\n", name, time.Since(start).Seconds())
+	}
+	if goPackages != "" {
+		database := "plgo_test_" + extension
+		if err = createTestDatabase(conninfo, database, extension); err != nil {
+			return err
+		}
+		goTest := exec.Command("go", append([]string{"test"}, strings.Fields(goPackages)...)...)
+		goTest.Env = append(os.Environ(), "PGTEST_DSN="+withDatabase(conninfo, database))
+		goTest.Stdout = os.Stdout
+		goTest.Stderr = os.Stderr
+		if err = goTest.Run(); err != nil {
+			failed++
+			fmt.Printf("FAIL\tgo test %s\n", goPackages)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("FAIL: %d tests of %s failed", failed, extension)
+	}
+	fmt.Println("PASS")
+	return nil
+}
@@ -4,12 +4,21 @@ import (
 	"fmt"
 	"go/ast"
 	"io"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 const (
 	triggerData = "TriggerData"
 	triggerRow  = "TriggerRow"
+	//jsonbType is plgo.JSONB, the raw jsonb document
+	jsonbType = "JSONB"
+	//windowContext is the first parameter of the window functions
+	windowContext = "WindowContext"
+	//goContext is the first parameter of the set returning functions returning an channel
+	goContext = "context.Context"
 )
 
 var datumTypes = map[string]string{
@@ -25,7 +34,7 @@ var datumTypes = map[string]string{
 	"uint":        "bigint",
 	"float32":     "real",
 	"float64":     "double precision",
-	"time.Time":   "timestamp with timezone",
+	"time.Time":   "timestamptz",
 	"bool":        "boolean",
 	"[]string":    "text[]",
 	"[]int16":     "smallint[]",
@@ -38,139 +47,432 @@ var datumTypes = map[string]string{
 	"[]float32":   "real[]",
 	"[]float64":   "double precision[]",
 	"[]bool":      "boolean[]",
-	"[]time.Time": "timestamp with timezone[]",
+	"[]time.Time": "timestamptz[]",
+	"[][]byte":    "bytea[]",
 	"TriggerRow":  "trigger",
+	//slices of pointers are arrays with NULL elements
+	"[]*string":    "text[]",
+	"[]*int16":     "smallint[]",
+	"[]*uint16":    "smallint[]",
+	"[]*int32":     "integer[]",
+	"[]*uint32":    "integer[]",
+	"[]*int64":     "bigint[]",
+	"[]*int":       "bigint[]",
+	"[]*uint":      "bigint[]",
+	"[]*float32":   "real[]",
+	"[]*float64":   "double precision[]",
+	"[]*bool":      "boolean[]",
+	"[]*time.Time": "timestamptz[]",
+	//time.Duration is an interval of microseconds, the scanned days are 24 hours and the months 30 days
+	"time.Duration":    "interval",
+	"[]time.Duration":  "interval[]",
+	"[]*time.Duration": "interval[]",
+	//the hstore extension is required by the extensions using it, the nil values are NULL
+	"map[string]*string": "hstore",
+	//plgo.UUID converts to github.com/google/uuid UUID
+	"plgo.UUID":   "uuid",
+	"[]plgo.UUID": "uuid[]",
+	//plgo.Numeric is the text form of the numeric, without the precision loss of float8
+	"plgo.Numeric":   "numeric",
+	"[]plgo.Numeric": "numeric[]",
+	//netip.Addr is an inet host address, netip.Prefix an cidr network
+	"netip.Addr":         "inet",
+	"[]netip.Addr":       "inet[]",
+	"netip.Prefix":       "cidr",
+	"[]netip.Prefix":     "cidr[]",
+	"net.HardwareAddr":   "macaddr",
+	"[]net.HardwareAddr": "macaddr[]",
+	//plgo.Range is the range of its bounds, the time ranges are tsrange or daterange declared with //plgo:time
+	"plgo.Range[int32]":        "int4range",
+	"plgo.Range[int64]":        "int8range",
+	"plgo.Range[plgo.Numeric]": "numrange",
+	"plgo.Range[time.Time]":    "tstzrange",
+}
+
+//typePackages are the import paths of the packages of the datumTypes, the generated code imports the used ones
+var typePackages = map[string]string{"time": "time", "netip": "net/netip", "net": "net"}
+
+//typePackageRe matches the qualified identifiers of the typePackages
+var typePackageRe = regexp.MustCompile(`\b(time|netip|net)\.`)
+
+//typeImports returns the sorted import paths of the typePackages used by the code
+func typeImports(code string) []string {
+	used := make(map[string]bool)
+	for _, match := range typePackageRe.FindAllStringSubmatch(code, -1) {
+		used[typePackages[match[1]]] = true
+	}
+	imports := make([]string, 0, len(used))
+	for path := range used {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+	return imports
 }
 
 //CodeWriter is an interface of an object that can print its code
 type CodeWriter interface {
 	FuncDec() string
 	Code(w io.Writer)
-	SQL(packageName string, w io.Writer)
+	SQL(target SQLTarget, w io.Writer)
+	//Describe adds the SQL object to the manifest of the release
+	Describe(m *Manifest)
+	//Entity returns the id of the SQL object, Dependencies the ids of the objects that must be created before it
+	Entity() string
+	Dependencies() []string
+}
+
+//NewCode parses the ast.FuncDecl and returns a new Function, SetFunction, OutFunction, ProcedureFunction, WorkerFunction, EventTriggerFunction,
+//WindowFunction or An (typed) TriggerFunction,
+//structs are the struct types of the package, composites the structs annotated as composite types and the enum types
+func NewCode(function *ast.FuncDecl, structs map[string]*ast.StructType, composites map[string]*CompositeType) (CodeWriter, error) {
+	code, err := newCode(function, structs, composites)
+	if err != nil {
+		return nil, err
+	}
+	//the SQL functions are named by //plgo:name, the workers have none
+	if named, ok := code.(interface{ setSQLName(*ast.FuncDecl) error }); ok {
+		err = named.setSQLName(function)
+	}
+	return code, err
 }
 
-//NewCode parses the ast.FuncDecl and returns a new Function or An TriggerFunction
-func NewCode(function *ast.FuncDecl) (CodeWriter, error) {
-	params, err := getParamList(function)
+//newCode returns the CodeWriter of the function with its Go name
+func newCode(function *ast.FuncDecl, structs map[string]*ast.StructType, composites map[string]*CompositeType) (CodeWriter, error) {
+	if options, ok := functionDirectives(function)["worker"]; ok {
+		return newWorkerFunction(function, options)
+	}
+	if options, ok := functionDirectives(function)["event-trigger"]; ok {
+		return newEventTriggerFunction(function, options)
+	}
+	trigger, err := newTypedTrigger(function, structs)
 	if err != nil {
 		return nil, err
 	}
-	returnType, isStar, err := getReturnType(function.Name.Name, function.Type.Results)
+	if trigger != nil {
+		return trigger, nil
+	}
+	params, err := getParamList(function, structs, composites)
 	if err != nil {
 		return nil, err
 	}
-
+	if err = setParamDefaults(function, params); err != nil {
+		return nil, err
+	}
+	//the window context isn't an SQL parameter
+	window := ""
+	if len(params) > 0 && params[0].Type == windowContext {
+		window, params = params[0].Name, params[1:]
+	}
+	//the context isn't an SQL parameter, it's passed to the set returning functions returning an channel
+	setContext := false
+	if len(params) > 0 && params[0].Type == goContext {
+		if results := function.Type.Results; results == nil || len(results.List) == 0 || !isChanType(results.List[0].Type) {
+			return nil, fmt.Errorf("Function %s: context.Context is the first parameter only of the functions returning an channel", function.Name.Name)
+		}
+		setContext, params = true, params[1:]
+	}
+	directives := functionDirectives(function)
+	times, err := parseTimeDirective(function.Name.Name, directives["time"])
+	if err != nil {
+		return nil, err
+	}
+	if err = setTimeTypes(function.Name.Name, params, times); err != nil {
+		return nil, err
+	}
+	//the functions with nullable parameters are called with NULL arguments, unless declared strict
+	strict := true
+	for _, p := range params {
+		strict = strict && !p.Nullable
+	}
+	attributes, err := functionAttributes(function, strict)
+	if err != nil {
+		return nil, err
+	}
+	voidFunction := VoidFunction{Name: function.Name.Name, Params: params, Doc: function.Doc.Text(), Requires: directives["requires"], Grants: directives["grant"], Attributes: attributes}
+	for _, p := range params {
+		voidFunction.dependOn(composites[strings.TrimPrefix(p.Type, "*")])
+	}
+	if window != "" {
+		return newWindowFunction(voidFunction, window, function.Type.Results, structs, composites, times[timeReturn])
+	}
+	if _, ok := directives["procedure"]; ok {
+		if times[timeReturn] != "" {
+			return nil, fmt.Errorf("Procedure %s: //plgo:time return is not allowed, procedures have no result", function.Name.Name)
+		}
+		return newProcedureFunction(voidFunction, function.Type.Results)
+	}
+	out, err := newOutFunction(voidFunction, function.Type.Results, structs, composites)
+	if err != nil {
+		return nil, err
+	}
+	if out != nil {
+		if times[timeReturn] != "" {
+			return nil, fmt.Errorf("Function %s: //plgo:time return is allowed only for the time.Time result", function.Name.Name)
+		}
+		if attributes.Rows > 0 {
+			return nil, fmt.Errorf("Function %s: the rows attribute is allowed only for set returning functions", function.Name.Name)
+		}
+		return out, nil
+	}
+	//the error of (T, error) is raised, T is the result
+	results := function.Type.Results
+	if results != nil && len(results.List) == 2 && len(results.List[0].Names) <= 1 && len(results.List[1].Names) <= 1 &&
+		typeString(results.List[1].Type) == "error" {
+		results, voidFunction.Error = &ast.FieldList{List: results.List[:1]}, true
+	}
+	if results != nil && len(results.List) == 1 {
+		set, err := newSetFunction(voidFunction, results.List[0].Type, structs)
+		if err != nil {
+			return nil, err
+		}
+		if set != nil {
+			set.Context = setContext
+			if times[timeReturn] != "" {
+				return nil, fmt.Errorf("Function %s: //plgo:time return is allowed only for the time.Time result", function.Name.Name)
+			}
+			return set, nil
+		}
+	}
+	if attributes.Rows > 0 {
+		return nil, fmt.Errorf("Function %s: the rows attribute is allowed only for set returning functions", function.Name.Name)
+	}
+	returnType, sqlReturnType, isStar, err := getReturnType(function.Name.Name, results, structs, composites)
+	if err != nil {
+		return nil, err
+	}
+	composite := composites[returnType]
+	voidFunction.dependOn(composite)
+	if voidFunction.Error && (returnType == triggerRow || returnType == "error") {
+		return nil, fmt.Errorf("Function %s can't return (%s, error)", function.Name.Name, returnType)
+	}
 	if returnType == triggerRow {
 		if len(params) == 0 || params[0].Type != triggerData {
 			return nil, fmt.Errorf("Function %s can return *plgo.TriggerRow when the first parameter will be *plgo.TriggerData", function.Name.Name)
 		}
-		return &TriggerFunction{VoidFunction: VoidFunction{Name: function.Name.Name, Params: params[1:], Doc: function.Doc.Text()}}, nil
+		voidFunction.Params = params[1:]
+		return &TriggerFunction{VoidFunction: voidFunction}, nil
+	}
+	if timeType := times[timeReturn]; timeType != "" {
+		if sqlReturnType = timeSQLType(returnType, timeType); sqlReturnType == "" || strings.HasPrefix(returnType, "[]") {
+			return nil, fmt.Errorf("Function %s: //plgo:time return=%s is not allowed for the %s result", function.Name.Name, timeType, returnType)
+		}
 	}
 	if returnType == "" {
-		return &VoidFunction{Name: function.Name.Name, Params: params, Doc: function.Doc.Text()}, nil
+		return &voidFunction, nil
+	}
+	return &Function{VoidFunction: voidFunction, ReturnType: returnType, SQLReturnType: sqlReturnType, IsStar: isStar, Composite: composite.isRow(),
+		Enum: composite.isEnum(), TimeType: times[timeReturn]}, nil
+}
+
+//goSQLType returns the Go type of the expression as written in the generated code and its SQL type:
+//the builtin types of datumTypes, the composite types, plgo.JSONB and the other structs declared in the package are jsonb.
+//The SQL type is empty if the type is not supported
+func goSQLType(expr ast.Expr, structs map[string]*ast.StructType, composites map[string]*CompositeType) (string, string) {
+	if ident := plgoSelector(expr); ident != nil {
+		switch ident.Name {
+		case jsonbType:
+			return jsonbType, "jsonb"
+		case triggerRow:
+			return triggerRow, datumTypes[triggerRow]
+		}
+		return ident.Name, datumTypes[plgo+"."+ident.Name]
+	}
+	goType := typeString(expr)
+	if sqlType, ok := datumTypes[goType]; ok {
+		//the plgo types are declared in the generated package
+		return strings.ReplaceAll(goType, plgo+".", ""), sqlType
+	}
+	if composite := composites[goType]; composite != nil {
+		return goType, sqlName(composite.Name)
 	}
-	return &Function{VoidFunction: VoidFunction{Name: function.Name.Name, Params: params, Doc: function.Doc.Text()}, ReturnType: returnType, IsStar: isStar}, nil
+	if structs[goType] != nil {
+		return goType, "jsonb"
+	}
+	return goType, ""
 }
 
-func getParamList(function *ast.FuncDecl) (Params []Param, err error) {
+func getParamList(function *ast.FuncDecl, structs map[string]*ast.StructType, composites map[string]*CompositeType) (Params []Param, err error) {
 	for i, param := range function.Type.Params.List {
 		for _, paramName := range param.Names {
-			switch paramType := param.Type.(type) {
-			case *ast.Ident:
-				//built in type
-				if _, ok := datumTypes[paramType.Name]; !ok {
-					return nil, fmt.Errorf("Function %s, parameter %s: type %s not supported", function.Name.Name, paramName.Name, paramType.Name)
-				}
-				Params = append(Params, Param{Name: paramName.Name, Type: paramType.Name})
-			case *ast.ArrayType:
-				//built in array type
-				arrayType, ok := paramType.Elt.(*ast.Ident)
-				if !ok {
-					return nil, fmt.Errorf("Function %s, parameter %s: array type not supported", function.Name.Name, paramName.Name)
-				}
-				if _, ok := datumTypes["[]"+arrayType.Name]; !ok {
-					return nil, fmt.Errorf("Function %s, parameter %s: array type not supported", function.Name.Name, paramName.Name)
-				}
-				Params = append(Params, Param{Name: paramName.Name, Type: "[]" + arrayType.Name})
-			case *ast.StarExpr:
-				//*plgo.TriggerData
-				selector, ok := paramType.X.(*ast.SelectorExpr)
-				if !ok {
-					return nil, fmt.Errorf("Function %s, parameter %s: type not supported", function.Name.Name, paramName.Name)
-				}
-				var pkg *ast.Ident
-				pkg, ok = selector.X.(*ast.Ident)
-				if !ok {
-					return nil, fmt.Errorf("Function %s, parameter %s: type not supported", function.Name.Name, paramName.Name)
-				}
-				if pkg.Name != plgo || selector.Sel.Name != triggerData {
-					return nil, fmt.Errorf("Function %s, parameter %s: type not supported", function.Name.Name, paramName.Name)
+			if typeString(param.Type) == goContext {
+				if i != 0 || len(param.Names) > 1 {
+					return nil, fmt.Errorf("Function %s, parameter %s: context.Context must be just the first parameter", function.Name.Name, paramName.Name)
 				}
+				Params = append(Params, Param{Name: paramName.Name, Type: goContext})
+				continue
+			}
+			if context := contextType(param.Type); context != "" {
 				if i != 0 {
-					return nil, fmt.Errorf("Function %s, parameter %s: *plgo.TriggerData type must be the first parameter", function.Name.Name, paramName.Name)
+					return nil, fmt.Errorf("Function %s, parameter %s: *plgo.%s type must be the first parameter", function.Name.Name, paramName.Name, context)
 				}
 				if len(param.Names) > 1 {
-					return nil, fmt.Errorf("Function %s, parameter %s: *plgo.TriggerData must be just one parameter", function.Name.Name, paramName.Name)
+					return nil, fmt.Errorf("Function %s, parameter %s: *plgo.%s must be just one parameter", function.Name.Name, paramName.Name, context)
 				}
-				Params = append(Params, Param{Name: param.Names[0].Name, Type: "TriggerData"})
-			default:
-				return nil, fmt.Errorf("Function %s, parameter %s: type not supported", function.Name.Name, paramName.Name)
+				Params = append(Params, Param{Name: param.Names[0].Name, Type: context})
+				continue
 			}
+			paramType := param.Type
+			//the variadic parameter ...T is the array of the VARIADIC parameter
+			ellipsis, variadic := paramType.(*ast.Ellipsis)
+			if variadic {
+				paramType = &ast.ArrayType{Elt: ellipsis.Elt}
+			}
+			star, nullable := paramType.(*ast.StarExpr)
+			if nullable {
+				paramType = star.X
+			}
+			goType, sqlType := goSQLType(paramType, structs, composites)
+			if sqlType == "" || goType == triggerRow || (nullable && strings.HasPrefix(goType, "[]")) || (variadic && !strings.HasSuffix(sqlType, "[]")) {
+				return nil, fmt.Errorf("Function %s, parameter %s: type %s not supported", function.Name.Name, paramName.Name, typeString(param.Type))
+			}
+			if nullable {
+				goType = "*" + goType
+			}
+			Params = append(Params, Param{Name: paramName.Name, Type: goType, SQLType: sqlType, Nullable: nullable, Variadic: variadic})
 		}
 	}
 	return
 }
 
-func getReturnType(functionName string, results *ast.FieldList) (string, bool, error) {
+//contextType returns the context passed to the function as its first parameter, *plgo.TriggerData or *plgo.WindowContext,
+//"" for the other types
+func contextType(expr ast.Expr) string {
+	for _, context := range []string{triggerData, windowContext} {
+		if isPlgoPointer(expr, context) {
+			return context
+		}
+	}
+	return ""
+}
+
+//getReturnType returns the Go and SQL type of the result and if it is an pointer (NULL when nil)
+func getReturnType(functionName string, results *ast.FieldList, structs map[string]*ast.StructType, composites map[string]*CompositeType) (string, string, bool, error) {
 	//Result is void
 	if results == nil {
-		return "", false, nil
+		return "", "", false, nil
 	}
 	if len(results.List) > 1 {
-		return "", false, fmt.Errorf("Function %s has multiple return types", functionName)
-	}
-	switch res := results.List[0].Type.(type) {
-	case *ast.StarExpr:
-		var selector *ast.SelectorExpr
-		ident, ok := res.X.(*ast.Ident)
-		if ok {
-			if _, ok := datumTypes[ident.Name]; !ok {
-				return "", false, fmt.Errorf("Function %s has not suported return type", functionName)
-			}
-			return ident.Name, true, nil
+		return "", "", false, fmt.Errorf("Function %s has multiple return types", functionName)
+	}
+	result := results.List[0].Type
+	star, isStar := result.(*ast.StarExpr)
+	if isStar {
+		result = star.X
+	}
+	goType, sqlType := goSQLType(result, structs, composites)
+	switch {
+	case sqlType == "":
+		return "", "", false, fmt.Errorf("Function %s has not supported return type", functionName)
+	case goType == triggerRow && !isStar:
+		return "", "", false, fmt.Errorf("Function %s must return *plgo.TriggerRow", functionName)
+	case goType == triggerRow:
+		return triggerRow, sqlType, false, nil
+	case isStar && strings.HasPrefix(goType, "[]"):
+		return "", "", false, fmt.Errorf("Function %s has not supported return type", functionName)
+	}
+	return goType, sqlType, isStar, nil
+}
+
+//Param the parameters of the functions
+type Param struct {
+	Name, Type string
+	//SQLType is the SQL type of the parameter
+	SQLType string
+	//Nullable parameters are pointers, nil is NULL
+	Nullable bool
+	//Variadic is the last parameter ...T, the VARIADIC array
+	Variadic bool
+	//Default is the SQL literal of the DEFAULT clause declared with //plgo:default, the callers can omit the argument
+	Default string
+}
+
+//sql returns the parameter declaration of the CREATE FUNCTION command
+func (p Param) sql() string {
+	declaration := sqlName(p.Name) + " " + p.SQLType
+	if p.Variadic {
+		declaration = "VARIADIC " + declaration
+	}
+	if p.Default != "" {
+		declaration += " DEFAULT " + p.Default
+	}
+	return declaration
+}
+
+//paramDefaultRe matches the name=value pair of //plgo:default, the values are the SQL string literals, the numbers,
+//true, false and null
+var paramDefaultRe = regexp.MustCompile(`^([\pL_][\pL\pN_]*)=('(?:[^']|'')*'|[-+]?\d+(?:\.\d+)?(?:[eE][-+]?\d+)?|(?i:true|false|null))(?:[\s,]+|$)`)
+
+//integerDefaultRe matches the numbers without an fraction and exponent, the defaults of the integer parameters
+var integerDefaultRe = regexp.MustCompile(`^[-+]?\d+$`)
+
+//checkParamDefault checks that the default fits the Go type of the parameter: the numbers are the defaults
+//of the numeric types (the integers of the integer types), true and false of bool.
+//The SQL string literals and null are the defaults of all types, PostgreSQL converts them
+func checkParamDefault(p Param, value string) error {
+	goType := strings.TrimPrefix(p.Type, "*")
+	switch lower := strings.ToLower(value); {
+	case strings.HasPrefix(value, "'") || lower == "null":
+		return nil
+	case lower == "true" || lower == "false":
+		if goType != "bool" {
+			return fmt.Errorf("%s isn't an default of the %s parameter %s", value, p.Type, p.Name)
 		}
-		selector, ok = res.X.(*ast.SelectorExpr)
-		if !ok {
-			return "", false, fmt.Errorf("Function %s has not supported return type", functionName)
+	case strings.HasPrefix(goType, "float"):
+	case strings.HasPrefix(goType, "int") || strings.HasPrefix(goType, "uint"):
+		if !integerDefaultRe.MatchString(value) {
+			return fmt.Errorf("%s isn't an integer default of the %s parameter %s", value, p.Type, p.Name)
 		}
-		var pkg *ast.Ident
-		pkg, ok = selector.X.(*ast.Ident)
+	default:
+		return fmt.Errorf("%s isn't an default of the %s parameter %s", value, p.Type, p.Name)
+	}
+	return nil
+}
+
+//setParamDefaults sets the defaults of the parameters declared with //plgo:default, e.g. //plgo:default limit=100 prefix='',
+//the parameters after an parameter with an default must have defaults too
+func setParamDefaults(function *ast.FuncDecl, params []Param) error {
+	if function.Doc == nil {
+		return nil
+	}
+	for _, comment := range function.Doc.List {
+		text, ok := strings.CutPrefix(comment.Text, directivePrefix+"default ")
 		if !ok {
-			return "", false, fmt.Errorf("Function %s has not supported return type", functionName)
-		}
-		if pkg.Name != plgo || selector.Sel.Name != triggerRow {
-			return "", false, fmt.Errorf("Function %s has not supported return type", functionName)
+			continue
 		}
-		return "TriggerRow", false, nil
-	case *ast.Ident:
-		if _, ok := datumTypes[res.Name]; !ok {
-			return "", false, fmt.Errorf("Function %s has not suported return type", functionName)
+		for text = strings.TrimSpace(text); text != ""; {
+			match := paramDefaultRe.FindStringSubmatch(text)
+			if match == nil {
+				return fmt.Errorf("Function %s: invalid //plgo:default %s, use name=value with an SQL string literal, number, true, false or null", function.Name.Name, text)
+			}
+			text = text[len(match[0]):]
+			found := false
+			for i := range params {
+				if params[i].Name == match[1] {
+					if err := checkParamDefault(params[i], match[2]); err != nil {
+						return fmt.Errorf("Function %s: invalid //plgo:default, %s", function.Name.Name, err)
+					}
+					params[i].Default, found = match[2], true
+				}
+			}
+			if !found {
+				return fmt.Errorf("Function %s: //plgo:default of unknown parameter %s", function.Name.Name, match[1])
+			}
 		}
-		return res.Name, false, nil
-	case *ast.ArrayType:
-		ident, ok := res.Elt.(*ast.Ident)
-		if !ok {
-			return "", false, fmt.Errorf("Function %s has not supported return type", functionName)
+	}
+	for i := 1; i < len(params); i++ {
+		if params[i-1].Default != "" && params[i].Default == "" {
+			return fmt.Errorf("Function %s: parameter %s must have an default, it follows the parameter %s with an default", function.Name.Name, params[i].Name, params[i-1].Name)
 		}
-		return "[]" + ident.Name, false, nil
-	default:
-		return "", false, fmt.Errorf("Function %s has not suported return type", functionName)
 	}
+	return nil
 }
 
-//Param the parameters of the functions
-type Param struct {
-	Name, Type string
+//arg returns the argument of the call of the Go function, the variadic slice is unpacked
+func (p Param) arg() string {
+	if p.Variadic {
+		return p.Name + "..."
+	}
+	return p.Name
 }
 
 //VoidFunction is an function with no return type
@@ -178,6 +480,20 @@ type VoidFunction struct {
 	Name   string
 	Params []Param
 	Doc    string
+	//Requires are the capabilities declared with //plgo:requires
+	Requires []string
+	//Grants are the roles allowed to execute the function, declared with //plgo:grant
+	Grants []string
+	//Depends are the ids of the composite types of the parameters and the result
+	Depends []string
+	//Attributes are the attributes of the CREATE FUNCTION command
+	Attributes FunctionAttributes
+	//Error is true if the last result of the Go function is an error, it is raised when not nil
+	Error bool
+	//SQLName is the SQL name declared with //plgo:name or converted by the naming of plgo.toml, "" is the Go name
+	SQLName string
+	//Schema is the schema declared with //plgo:name schema=, "" is the schema of the extension
+	Schema string
 }
 
 //FuncDec returns the PG INFO_V1 macro
@@ -185,9 +501,145 @@ func (f *VoidFunction) FuncDec() string {
 	return "PG_FUNCTION_INFO_V1(" + f.Name + ");"
 }
 
+//writeFuncHeader writes the exported wrapper function declaration with the call instrumentation
+func writeFuncHeader(w io.Writer, name string) {
+	w.Write([]byte("//export " + name + "\nfunc " + name + "(fcinfo *funcInfo) Datum {\n"))
+	w.Write([]byte("call := beginCall(fcinfo, \"" + name + "\")\ndefer call.end()\n"))
+}
+
+//writeRaise writes the raising of the error retErr returned by the Go function
+func (f *VoidFunction) writeRaise(w io.Writer) {
+	if f.Error {
+		w.Write([]byte("if retErr != nil {\nraiseError(retErr)\n}\n"))
+	}
+}
+
+//writeTraceArgs writes the logging of the scanned arguments when the call is traced (<extension>.trace)
+func (f *VoidFunction) writeTraceArgs(w io.Writer) {
+	names := make([]string, len(f.Params))
+	args := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		names[i] = strconv.Quote(p.Name)
+		args[i] = ", " + p.Name
+	}
+	w.Write([]byte("if call.traced {\ncall.traceArgs([]string{" + strings.Join(names, ", ") + "}" + strings.Join(args, "") + ")\n}\n"))
+}
+
+//writeRequires writes the declared capabilities as an SQL comment, so they are visible in the extension script
+func (f *VoidFunction) writeRequires(w io.Writer) {
+	if len(f.Requires) > 0 {
+		w.Write([]byte("-- requires: " + strings.Join(f.Requires, ", ") + "\n"))
+	}
+}
+
+//signature returns the function name with the SQL parameter types
+func (f *VoidFunction) signature() string {
+	return f.sqlFunctionName() + "(" + strings.Join(f.sqlParamTypes(), ",") + ")"
+}
+
+//sqlFunctionName returns the SQL name of the function
+func (f *VoidFunction) sqlFunctionName() string {
+	if f.SQLName != "" {
+		return f.SQLName
+	}
+	return f.Name
+}
+
+//target returns the target with the schema of the function
+func (f *VoidFunction) target(target SQLTarget) SQLTarget {
+	if f.Schema != "" {
+		target.Schema = f.Schema
+	}
+	return target
+}
+
+//qualifiedName returns the SQL name of the function qualified with its schema
+func (f *VoidFunction) qualifiedName(target SQLTarget) string {
+	return f.target(target).qualify(f.sqlFunctionName())
+}
+
+//setSQLName sets the SQL name and the schema of the function declared with //plgo:name
+func (f *VoidFunction) setSQLName(function *ast.FuncDecl) (err error) {
+	f.SQLName, f.Schema, err = functionSQLName(function)
+	return err
+}
+
+//defaultGrants are the roles allowed to execute the functions without //plgo:grant, the grant of plgo.toml
+var defaultGrants []string
+
+//writeGrants revokes the execution of the function from PUBLIC and grants it to the roles declared with //plgo:grant
+func (f *VoidFunction) writeGrants(target SQLTarget, w io.Writer) {
+	f.writeGrantsOn("FUNCTION", target, w)
+}
+
+//writeGrantsOn writes the grants of the FUNCTION or PROCEDURE, the default grants apply without //plgo:grant.
+//The security definer functions without grants are revoked from PUBLIC, only the owner and the superusers can execute them,
+//granting public keeps the execution by PUBLIC
+func (f *VoidFunction) writeGrantsOn(kind string, target SQLTarget, w io.Writer) {
+	grants := f.Grants
+	if len(grants) == 0 {
+		grants = defaultGrants
+	}
+	if len(grants) == 0 && !f.Attributes.SecurityDefiner {
+		return
+	}
+	revoke := true
+	var roles []string
+	for _, role := range grants {
+		if strings.EqualFold(role, "public") {
+			revoke = false
+			continue
+		}
+		roles = append(roles, quoteIdent(role))
+	}
+	signature := f.target(target).qualify(f.signature())
+	if revoke {
+		w.Write([]byte("REVOKE ALL ON " + kind + " " + signature + " FROM PUBLIC;\n"))
+	}
+	if len(roles) > 0 {
+		w.Write([]byte("GRANT EXECUTE ON " + kind + " " + signature + " TO " + strings.Join(roles, ", ") + ";\n"))
+	}
+}
+
+//modulePathname is the shared object of the C functions, CREATE EXTENSION replaces it with the module_pathname of the control file,
+//so the script doesn't depend on the name and the directory of the installed library
+const modulePathname = "'MODULE_PATHNAME'"
+
+//SQLTarget is the extension the SQL objects are written for
+type SQLTarget struct {
+	//PackageName is the name of the extension and of its shared object
+	PackageName string
+	//Schema is the schema of the objects, "" creates them in the schema of CREATE EXTENSION
+	Schema string
+}
+
+//qualify returns the SQL name qualified with the quoted schema of the target, the name without an schema.
+//The name can be followed by the parameter types, e.g. add(integer,integer)
+func (t SQLTarget) qualify(name string) string {
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = sqlName(name[:i]) + name[i:]
+	} else {
+		name = sqlName(name)
+	}
+	if t.Schema == "" {
+		return name
+	}
+	return quoteIdent(t.Schema) + "." + name
+}
+
+//quoteIdent quotes the SQL identifier
+func quoteIdent(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+//quoteLiteral quotes the SQL string literal, with standard_conforming_strings the backslashes aren't escaped
+func quoteLiteral(literal string) string {
+	return "'" + strings.ReplaceAll(literal, "'", "''") + "'"
+}
+
 //Code writes the wrapper function
 func (f *VoidFunction) Code(w io.Writer) {
-	w.Write([]byte("//export " + f.Name + "\nfunc " + f.Name + "(fcinfo *funcInfo) Datum {\n"))
+	writeFuncHeader(w, f.Name)
 	if len(f.Params) > 0 {
 		for _, p := range f.Params {
 			w.Write([]byte("var " + p.Name + " " + p.Type + "\n"))
@@ -198,9 +650,10 @@ func (f *VoidFunction) Code(w io.Writer) {
 		}
 		w.Write([]byte(")\n"))
 	}
+	f.writeTraceArgs(w)
 	w.Write([]byte("__" + f.Name + "(\n"))
 	for _, p := range f.Params {
-		w.Write([]byte(p.Name + ",\n"))
+		w.Write([]byte(p.arg() + ",\n"))
 	}
 	w.Write([]byte(")\n"))
 	w.Write([]byte("return toDatum(nil)\n"))
@@ -208,43 +661,136 @@ func (f *VoidFunction) Code(w io.Writer) {
 }
 
 //SQL writes the SQL command that creates the function in DB
-func (f *VoidFunction) SQL(packageName string, w io.Writer) {
-	w.Write([]byte("CREATE OR REPLACE FUNCTION " + f.Name + "("))
+func (f *VoidFunction) SQL(target SQLTarget, w io.Writer) {
+	f.writeRequires(w)
+	w.Write([]byte("CREATE OR REPLACE FUNCTION " + f.qualifiedName(target) + "("))
 	var paramStrings []string
 	for _, p := range f.Params {
-		paramStrings = append(paramStrings, p.Name+" "+datumTypes[p.Type])
+		paramStrings = append(paramStrings, p.sql())
 	}
 	w.Write([]byte(strings.Join(paramStrings, ",")))
 	w.Write([]byte(")\n"))
 	w.Write([]byte("RETURNS VOID AS\n"))
-	w.Write([]byte("'$libdir/" + packageName + "', '" + f.Name + "'\n"))
-	w.Write([]byte("LANGUAGE c IMMUTABLE STRICT;\n"))
+	w.Write([]byte(modulePathname + ", '" + f.Name + "'\n"))
+	f.writeLanguage(target, w)
+	f.writeGrants(target, w)
 	if f.Doc == "" {
 		w.Write([]byte("\n"))
 		return
 	}
-	f.Comment(w)
+	f.Comment(target, w)
+}
+
+//writeLanguage writes the LANGUAGE clause with the attributes of the function and the search_path guard
+func (f *VoidFunction) writeLanguage(target SQLTarget, w io.Writer) {
+	w.Write([]byte("LANGUAGE c " + f.Attributes.SQL() + f.searchPath(target) + ";\n"))
+}
+
+//searchPath returns the SET search_path clause of the function, the schemas declared with //plgo:search-path.
+//The security definer functions are guarded by default, the search path is the schema of the function and pg_temp last,
+//so the callers can't shadow the objects used by the function with their own objects
+func (f *VoidFunction) searchPath(target SQLTarget) string {
+	schemas := f.Attributes.SearchPath
+	if len(schemas) == 0 {
+		if !f.Attributes.SecurityDefiner {
+			return ""
+		}
+		//@extschema@ is replaced by the schema of CREATE EXTENSION
+		schema := "@extschema@"
+		if s := f.target(target).Schema; s != "" {
+			schema = quoteIdent(s)
+		}
+		schemas = []string{schema, "pg_temp"}
+	}
+	return " SET search_path = " + strings.Join(schemas, ", ")
 }
 
 //Comment writes the Doc comment of the golang function as an DB comment for that function
-func (f *VoidFunction) Comment(w io.Writer) {
-	var paramTypes []string
+func (f *VoidFunction) Comment(target SQLTarget, w io.Writer) {
+	f.commentOn("FUNCTION", target, w)
+}
+
+//commentOn writes the Doc comment of the FUNCTION or PROCEDURE
+func (f *VoidFunction) commentOn(kind string, target SQLTarget, w io.Writer) {
+	w.Write([]byte("COMMENT ON " + kind + " " + f.target(target).qualify(f.signature()) + " IS " + quoteLiteral(f.Doc) + ";\n\n"))
+}
+
+//dependOn adds the composite type to the dependencies of the function, nil is ignored
+func (f *VoidFunction) dependOn(composite *CompositeType) {
+	if composite == nil {
+		return
+	}
+	id := composite.Entity()
+	for _, dep := range f.Depends {
+		if dep == id {
+			return
+		}
+	}
+	f.Depends = append(f.Depends, id)
+}
+
+//sqlParamTypes returns the SQL types of the parameters
+func (f *VoidFunction) sqlParamTypes() []string {
+	paramTypes := []string{}
 	for _, p := range f.Params {
-		paramTypes = append(paramTypes, datumTypes[p.Type])
+		paramTypes = append(paramTypes, p.SQLType)
+	}
+	return paramTypes
+}
+
+//manifestFunction returns the manifest entry of the function with the return type
+func (f *VoidFunction) manifestFunction(returns string) ManifestFunction {
+	names := make([]string, len(f.Params))
+	var defaults []string
+	for i, p := range f.Params {
+		names[i] = p.Name
+		if p.Default != "" {
+			if defaults == nil {
+				defaults = make([]string, len(f.Params))
+			}
+			defaults[i] = p.Default
+		}
+	}
+	return ManifestFunction{Name: f.sqlFunctionName(), Schema: f.Schema, Args: f.sqlParamTypes(), ArgNames: names, Defaults: defaults, Returns: returns,
+		Volatility: f.Attributes.Volatility, Strict: f.Attributes.Strict, Parallel: f.Attributes.Parallel, Doc: strings.TrimSpace(f.Doc)}
+}
+
+//Entity returns the id of the function
+func (f *VoidFunction) Entity() string {
+	name := f.sqlFunctionName()
+	if f.Schema != "" {
+		name = f.Schema + "." + name
 	}
-	w.Write([]byte("COMMENT ON FUNCTION " + f.Name + "(" + strings.Join(paramTypes, ",") + ") IS '" + f.Doc + "';\n\n"))
+	return functionEntity(name, f.sqlParamTypes())
+}
+
+//Dependencies returns the composite types used by the function
+func (f *VoidFunction) Dependencies() []string {
+	return f.Depends
+}
+
+//Describe adds the function to the manifest
+func (f *VoidFunction) Describe(m *Manifest) {
+	m.Functions = append(m.Functions, f.manifestFunction("void"))
 }
 
 //Function is a list of parameters and the return type
 type Function struct {
 	VoidFunction
-	ReturnType string
-	IsStar     bool
+	ReturnType    string
+	SQLReturnType string
+	IsStar        bool
+	//Composite is true if the result is an composite type, it is returned as an row
+	Composite bool
+	//TimeType is the SQL type of the time.Time (or time range) result declared with //plgo:time, "" for timestamptz
+	TimeType string
+	//Enum is true if the result is an enum type, it is returned by its label
+	Enum bool
 }
 
 //Code writes the wrapper function
 func (f *Function) Code(w io.Writer) {
-	w.Write([]byte("//export " + f.Name + "\nfunc " + f.Name + "(fcinfo *funcInfo) Datum {\n"))
+	writeFuncHeader(w, f.Name)
 	if len(f.Params) > 0 {
 		for _, p := range f.Params {
 			w.Write([]byte("var " + p.Name + " " + p.Type + "\n"))
@@ -262,51 +808,93 @@ func (f *Function) Code(w io.Writer) {
 		}
 		`))
 	}
-	w.Write([]byte("ret := "))
+	f.writeTraceArgs(w)
+	if f.Error {
+		w.Write([]byte("ret, retErr := "))
+	} else {
+		w.Write([]byte("ret := "))
+	}
 	w.Write([]byte("__" + f.Name + "(\n"))
 	for _, p := range f.Params {
-		w.Write([]byte(p.Name + ",\n"))
+		w.Write([]byte(p.arg() + ",\n"))
 	}
 	w.Write([]byte(")\n"))
-	if f.IsStar {
+	f.writeRaise(w)
+	w.Write([]byte("if call.traced {\ncall.traceResult(ret)\n}\n"))
+	f.writeReturn(w)
+	w.Write([]byte("}\n"))
+
+}
+
+//writeReturn writes the return of the result ret, the nil pointers are NULL and the composite types rows
+func (f *Function) writeReturn(w io.Writer) {
+	switch {
+	case f.IsStar && f.Composite:
 		w.Write([]byte(`
 		if(ret==nil){
-			fcinfo.isnull=C.char(1);
+			fcinfo.isnull=(C._Bool)(true);
 			return toDatum(nil)
 		}
-		return toDatum(*ret)
+		return compositeDatum(fcinfo, ret)
 		`))
-	} else {
-		w.Write([]byte("return toDatum(ret)\n"))
+	case f.IsStar:
+		w.Write([]byte(`
+		if(ret==nil){
+			fcinfo.isnull=(C._Bool)(true);
+			return toDatum(nil)
+		}
+		return ` + f.datum("*ret") + `
+		`))
+	case f.Composite:
+		w.Write([]byte("return compositeDatum(fcinfo, &ret)\n"))
+	default:
+		w.Write([]byte("return " + f.datum("ret") + "\n"))
 	}
-	w.Write([]byte("}\n"))
+}
 
+//datum returns the conversion of the result to the datum, the time.Time result to the type declared with //plgo:time
+func (f *Function) datum(ret string) string {
+	if f.Enum {
+		return "enumDatum(fcinfo, string(" + ret + "))"
+	}
+	if f.TimeType != "" && f.ReturnType == timeRange {
+		return "timeRangeDatum(" + ret + ", " + strconv.Quote(f.TimeType) + ")"
+	}
+	if f.TimeType != "" {
+		return "timeDatum(" + ret + ", " + strconv.Quote(f.TimeType) + ")"
+	}
+	return "toDatum(" + ret + ")"
 }
 
 //SQL writes the SQL command that creates the function in DB
-func (f *Function) SQL(packageName string, w io.Writer) {
-	w.Write([]byte("CREATE OR REPLACE FUNCTION " + f.Name + "("))
+func (f *Function) SQL(target SQLTarget, w io.Writer) {
+	f.writeRequires(w)
+	w.Write([]byte("CREATE OR REPLACE FUNCTION " + f.qualifiedName(target) + "("))
 	var paramsString []string
 	for _, p := range f.Params {
-		paramsString = append(paramsString, p.Name+" "+datumTypes[p.Type])
+		paramsString = append(paramsString, p.sql())
 	}
 	w.Write([]byte(strings.Join(paramsString, ",")))
 	w.Write([]byte(")\n"))
-	switch {
-	case f.ReturnType == "[]byte":
-		w.Write([]byte("RETURNS bytea AS\n"))
-	case strings.HasPrefix(f.ReturnType[:2], "[]"):
-		w.Write([]byte("RETURNS " + datumTypes[f.ReturnType[2:len(f.ReturnType)]] + "[] AS\n"))
-	default:
-		w.Write([]byte("RETURNS " + datumTypes[f.ReturnType] + " AS\n"))
-	}
-	w.Write([]byte("'$libdir/" + packageName + "', '" + f.Name + "'\n"))
-	w.Write([]byte("LANGUAGE c IMMUTABLE STRICT;\n"))
+	w.Write([]byte("RETURNS " + f.sqlReturnType() + " AS\n"))
+	w.Write([]byte(modulePathname + ", '" + f.Name + "'\n"))
+	f.writeLanguage(target, w)
+	f.writeGrants(target, w)
 	if f.Doc == "" {
 		w.Write([]byte("\n"))
 		return
 	}
-	f.Comment(w)
+	f.Comment(target, w)
+}
+
+//sqlReturnType returns the SQL type of the Go return type
+func (f *Function) sqlReturnType() string {
+	return f.SQLReturnType
+}
+
+//Describe adds the function to the manifest
+func (f *Function) Describe(m *Manifest) {
+	m.Functions = append(m.Functions, f.manifestFunction(f.sqlReturnType()))
 }
 
 //TriggerFunction a special type of function, it takes TriggerData as the first argument and TriggerRow as return type
@@ -316,7 +904,7 @@ type TriggerFunction struct {
 
 //Code writes the wrapper function
 func (f *TriggerFunction) Code(w io.Writer) {
-	w.Write([]byte("//export " + f.Name + "\nfunc " + f.Name + "(fcinfo *funcInfo) Datum {\n"))
+	writeFuncHeader(w, f.Name)
 	if len(f.Params) > 0 {
 		//TODO scan from fcinfo may not work, TEST IT!
 		for _, p := range f.Params {
@@ -328,31 +916,524 @@ func (f *TriggerFunction) Code(w io.Writer) {
 		}
 		w.Write([]byte(")\n"))
 	}
+	f.writeTraceArgs(w)
 	w.Write([]byte("ret := "))
 	w.Write([]byte("__" + f.Name + "(\nfcinfo.TriggerData(),\n"))
 	for _, p := range f.Params {
-		w.Write([]byte(p.Name + ",\n"))
+		w.Write([]byte(p.arg() + ",\n"))
 	}
 	w.Write([]byte(")\n"))
+	w.Write([]byte("if call.traced {\ncall.traceResult(ret)\n}\n"))
 	w.Write([]byte("return toDatum(ret)\n"))
 	w.Write([]byte("}\n"))
 }
 
 //SQL writes the SQL command that creates the function in DB
-func (f *TriggerFunction) SQL(packageName string, w io.Writer) {
-	w.Write([]byte("CREATE OR REPLACE FUNCTION " + f.Name + "("))
+func (f *TriggerFunction) SQL(target SQLTarget, w io.Writer) {
+	f.writeRequires(w)
+	w.Write([]byte("CREATE OR REPLACE FUNCTION " + f.qualifiedName(target) + "("))
 	var paramsString []string
 	for _, p := range f.Params {
-		paramsString = append(paramsString, p.Name+" "+datumTypes[p.Type])
+		paramsString = append(paramsString, p.sql())
 	}
 	w.Write([]byte(strings.Join(paramsString, ",")))
 	w.Write([]byte(")\n"))
 	w.Write([]byte("RETURNS TRIGGER AS\n"))
-	w.Write([]byte("'$libdir/" + packageName + "', '" + f.Name + "'\n"))
-	w.Write([]byte("LANGUAGE c IMMUTABLE STRICT;\n"))
+	w.Write([]byte(modulePathname + ", '" + f.Name + "'\n"))
+	f.writeLanguage(target, w)
+	f.writeGrants(target, w)
 	if f.Doc == "" {
 		w.Write([]byte("\n"))
 		return
 	}
-	f.Comment(w)
+	f.Comment(target, w)
+}
+
+//Describe adds the function to the manifest
+func (f *TriggerFunction) Describe(m *Manifest) {
+	m.Functions = append(m.Functions, f.manifestFunction("trigger"))
+}
+
+//TypedTriggerFunction is an trigger function receiving NEW and OLD as structs declared in the package
+//and returning the row, func(td *plgo.TriggerData, newRow, oldRow *Row) *Row
+type TypedTriggerFunction struct {
+	TriggerFunction
+	RowType string
+}
+
+//isPlgoPointer reports if the expression is the pointer to the plgo type, e.g. *plgo.TriggerData
+func isPlgoPointer(expr ast.Expr, name string) bool {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	ident := plgoSelector(star.X)
+	return ident != nil && ident.Name == name
+}
+
+//isChanType returns true if the expression is an channel type
+func isChanType(expr ast.Expr) bool {
+	_, ok := expr.(*ast.ChanType)
+	return ok
+}
+
+//structPointer returns the name of the struct declared in the package if the expression is an pointer to it
+func structPointer(expr ast.Expr, structs map[string]*ast.StructType) string {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return ""
+	}
+	ident, ok := star.X.(*ast.Ident)
+	if !ok || structs[ident.Name] == nil {
+		return ""
+	}
+	return ident.Name
+}
+
+//newTypedTrigger returns the typed trigger function if the function takes *plgo.TriggerData and pointers to an struct of the package,
+//otherwise nil
+func newTypedTrigger(function *ast.FuncDecl, structs map[string]*ast.StructType) (*TypedTriggerFunction, error) {
+	var types []ast.Expr
+	for _, param := range function.Type.Params.List {
+		for range param.Names {
+			types = append(types, param.Type)
+		}
+	}
+	if len(types) < 2 || !isPlgoPointer(types[0], triggerData) || structPointer(types[1], structs) == "" {
+		return nil, nil
+	}
+	rowType := structPointer(types[1], structs)
+	results := function.Type.Results
+	if len(types) != 3 || structPointer(types[2], structs) != rowType ||
+		results == nil || len(results.List) != 1 || structPointer(results.List[0].Type, structs) != rowType {
+		return nil, fmt.Errorf("Function %s: typed trigger function must be func(td *plgo.TriggerData, newRow, oldRow *%s) *%s", function.Name.Name, rowType, rowType)
+	}
+	if _, err := structColumns("Function "+function.Name.Name, structs[rowType]); err != nil {
+		return nil, err
+	}
+	attributes, err := functionAttributes(function, true)
+	if err != nil {
+		return nil, err
+	}
+	directives := functionDirectives(function)
+	trigger := TriggerFunction{VoidFunction{Name: function.Name.Name, Doc: function.Doc.Text(), Requires: directives["requires"], Grants: directives["grant"], Attributes: attributes}}
+	return &TypedTriggerFunction{TriggerFunction: trigger, RowType: rowType}, nil
+}
+
+//Code writes the wrapper function, NEW and OLD are scanned into the structs and the returned struct is set into the row
+func (f *TypedTriggerFunction) Code(w io.Writer) {
+	writeFuncHeader(w, f.Name)
+	w.Write([]byte("td := fcinfo.TriggerData()\n"))
+	w.Write([]byte("var newRow, oldRow *" + f.RowType + "\n"))
+	w.Write([]byte(`
+	if err := td.scanRows(&newRow, &oldRow); err != nil {
+		C.elog_error(C.CString(
+			err.Error(),
+		))
+	}
+	`))
+	w.Write([]byte("if call.traced {\ncall.traceArgs([]string{\"new\", \"old\"}, newRow, oldRow)\n}\n"))
+	w.Write([]byte("ret := __" + f.Name + "(td, newRow, oldRow)\n"))
+	w.Write([]byte("if call.traced {\ncall.traceResult(ret)\n}\n"))
+	w.Write([]byte("return td.returnRow(ret)\n"))
+	w.Write([]byte("}\n"))
+}
+
+//BuiltinFunction is an function implemented in the plgo runtime, that is exposed in every extension
+type BuiltinFunction struct {
+	Name       string
+	Symbol     string
+	Args       []BuiltinArg
+	ReturnType string
+	Doc        string
+	//Strict functions aren't called with NULL arguments
+	Strict bool
+	//Public functions can be executed by every role, the others change the state shared by all sessions
+	//or expose it, they are revoked from PUBLIC and the owner of the extension grants them
+	Public bool
+}
+
+//BuiltinArg is an argument of the builtin function
+type BuiltinArg struct {
+	Name    string
+	Type    string
+	Default string
+}
+
+//builtinFunctions returns the runtime functions exposed by the extension
+func builtinFunctions(packageName string) []CodeWriter {
+	return []CodeWriter{
+		&BuiltinFunction{
+			Name:       packageName + "_explain",
+			Symbol:     "plgo_explain",
+			ReturnType: "jsonb",
+			Doc:        "timing, rows and counters of the extension functions called in the current session",
+			Public:     true,
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_explain_reset",
+			Symbol:     "plgo_explain_reset",
+			ReturnType: "VOID",
+			Doc:        "resets the data returned by " + packageName + "_explain()",
+			Public:     true,
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_stat_functions_data",
+			Symbol:     "plgo_stat_functions",
+			ReturnType: "jsonb",
+			Doc:        "statistics of the extension functions from all backends, use the " + packageName + "_stat_functions view",
+			Public:     true,
+		},
+		&BuiltinView{
+			Name: packageName + "_stat_functions",
+			Query: "SELECT * FROM jsonb_to_recordset(" + packageName + "_stat_functions_data()) AS s(\n" +
+				"\tfuncname text, calls bigint, errors bigint,\n" +
+				"\ttotal_time double precision, mean_time double precision,\n" +
+				"\tmin_time double precision, max_time double precision,\n" +
+				"\tp50_time double precision, p95_time double precision, p99_time double precision)",
+			Doc:     "call counts, errors and latencies (in milliseconds) of the extension functions",
+			Depends: []string{functionEntity(packageName+"_stat_functions_data", nil)},
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_stat_reset",
+			Symbol:     "plgo_stat_reset",
+			ReturnType: "VOID",
+			Doc:        "resets the statistics in the " + packageName + "_stat_functions view",
+		},
+	}
+}
+
+//FuncDec returns the PG INFO_V1 macro
+func (f *BuiltinFunction) FuncDec() string {
+	return "PG_FUNCTION_INFO_V1(" + f.Symbol + ");"
+}
+
+//Code does nothing, the function is implemented in the runtime
+func (f *BuiltinFunction) Code(w io.Writer) {}
+
+//SQL writes the SQL command that creates the function in DB
+func (f *BuiltinFunction) SQL(target SQLTarget, w io.Writer) {
+	args := make([]string, len(f.Args))
+	types := make([]string, len(f.Args))
+	for i, arg := range f.Args {
+		args[i] = arg.Name + " " + arg.Type
+		if arg.Default != "" {
+			args[i] += " DEFAULT " + arg.Default
+		}
+		types[i] = arg.Type
+	}
+	w.Write([]byte("CREATE OR REPLACE FUNCTION " + target.qualify(f.Name) + "(" + strings.Join(args, ", ") + ")\n"))
+	w.Write([]byte("RETURNS " + f.ReturnType + " AS\n"))
+	w.Write([]byte(modulePathname + ", '" + f.Symbol + "'\n"))
+	if f.Strict {
+		w.Write([]byte("LANGUAGE c VOLATILE STRICT;\n"))
+	} else {
+		w.Write([]byte("LANGUAGE c VOLATILE;\n"))
+	}
+	signature := target.qualify(f.Name) + "(" + strings.Join(types, ", ") + ")"
+	if !f.Public {
+		w.Write([]byte("REVOKE ALL ON FUNCTION " + signature + " FROM PUBLIC;\n"))
+	}
+	w.Write([]byte("COMMENT ON FUNCTION " + signature + " IS " + quoteLiteral(f.Doc) + ";\n\n"))
+}
+
+//Entity returns the id of the function
+func (f *BuiltinFunction) Entity() string {
+	types := make([]string, len(f.Args))
+	for i, arg := range f.Args {
+		types[i] = arg.Type
+	}
+	return functionEntity(f.Name, types)
+}
+
+//Dependencies returns nothing, the builtin functions have builtin types
+func (f *BuiltinFunction) Dependencies() []string {
+	return nil
+}
+
+//Describe adds the function to the manifest
+func (f *BuiltinFunction) Describe(m *Manifest) {
+	args := make([]string, len(f.Args))
+	names := make([]string, len(f.Args))
+	for i, arg := range f.Args {
+		args[i] = arg.Type
+		names[i] = arg.Name
+	}
+	m.Functions = append(m.Functions, ManifestFunction{Name: f.Name, Args: args, ArgNames: names, Returns: strings.ToLower(f.ReturnType),
+		Volatility: "volatile", Strict: f.Strict, Doc: f.Doc})
+}
+
+//BuiltinView is an view over builtin functions, that is created in every extension
+type BuiltinView struct {
+	Name  string
+	Query string
+	Doc   string
+	//Depends are the ids of the objects used by the query
+	Depends []string
+}
+
+//FuncDec returns nothing, view isn't a function
+func (v *BuiltinView) FuncDec() string {
+	return ""
+}
+
+//Code does nothing, view has no wrapper
+func (v *BuiltinView) Code(w io.Writer) {}
+
+//SQL writes the SQL command that creates the view in DB
+func (v *BuiltinView) SQL(target SQLTarget, w io.Writer) {
+	w.Write([]byte("CREATE OR REPLACE VIEW " + target.qualify(v.Name) + " AS\n" + v.Query + ";\n"))
+	w.Write([]byte("COMMENT ON VIEW " + target.qualify(v.Name) + " IS " + quoteLiteral(v.Doc) + ";\n\n"))
+}
+
+//Entity returns the id of the view
+func (v *BuiltinView) Entity() string {
+	return relationEntity("view", v.Name)
+}
+
+//Dependencies returns the objects used by the view
+func (v *BuiltinView) Dependencies() []string {
+	return v.Depends
+}
+
+//Describe adds the view to the manifest
+func (v *BuiltinView) Describe(m *Manifest) {
+	m.Relations = append(m.Relations, ManifestRelation{Kind: "view", Name: v.Name, Doc: v.Doc})
+}
+
+//BuiltinTable is an table of the plgo runtime, that is created in the extensions using the runtime feature
+type BuiltinTable struct {
+	Name    string
+	Columns string
+	Doc     string
+	//Config tables are dumped by pg_dump with their data
+	Config bool
+	//Indexes are the definitions of the indexes, e.g. "(queue, run_at) WHERE status = 'ready'"
+	Indexes []string
+	//Depends are the ids of the objects used by the columns
+	Depends []string
+}
+
+//FuncDec returns nothing, table isn't a function
+func (t *BuiltinTable) FuncDec() string {
+	return ""
+}
+
+//Code does nothing, table has no wrapper
+func (t *BuiltinTable) Code(w io.Writer) {}
+
+//SQL writes the SQL command that creates the table in DB
+func (t *BuiltinTable) SQL(target SQLTarget, w io.Writer) {
+	name := target.qualify(t.Name)
+	w.Write([]byte("CREATE TABLE " + name + " (\n" + t.Columns + "\n);\n"))
+	for _, index := range t.Indexes {
+		w.Write([]byte("CREATE INDEX ON " + name + " " + index + ";\n"))
+	}
+	if t.Config {
+		w.Write([]byte("SELECT pg_catalog.pg_extension_config_dump(" + quoteLiteral(name) + ", '');\n"))
+	}
+	w.Write([]byte("COMMENT ON TABLE " + name + " IS " + quoteLiteral(t.Doc) + ";\n\n"))
+}
+
+//Entity returns the id of the table
+func (t *BuiltinTable) Entity() string {
+	return relationEntity("table", t.Name)
+}
+
+//Dependencies returns the objects used by the table
+func (t *BuiltinTable) Dependencies() []string {
+	return t.Depends
+}
+
+//Describe adds the table to the manifest
+func (t *BuiltinTable) Describe(m *Manifest) {
+	m.Relations = append(m.Relations, ManifestRelation{Kind: "table", Name: t.Name, Doc: t.Doc})
+}
+
+//goroutinesFunction returns the function dumping the goroutines, of the extensions starting goroutines
+func goroutinesFunction(packageName string) CodeWriter {
+	return &BuiltinFunction{
+		Name:       packageName + "_goroutines",
+		Symbol:     "plgo_goroutines",
+		ReturnType: "text",
+		Doc:        "stack traces of all goroutines in the current backend",
+	}
+}
+
+//cacheFunctions returns the SQL functions of the shared cache (plgo.SharedCache)
+func cacheFunctions(packageName string) []CodeWriter {
+	return []CodeWriter{
+		&BuiltinFunction{
+			Name:       packageName + "_cache_get",
+			Symbol:     "plgo_cache_get_bytea",
+			Args:       []BuiltinArg{{Name: "key", Type: "text"}},
+			ReturnType: "bytea",
+			Doc:        "value cached under the key in the shared cache, NULL if it is not cached or expired",
+			Strict:     true,
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_cache_get_json",
+			Symbol:     "plgo_cache_get_jsonb",
+			Args:       []BuiltinArg{{Name: "key", Type: "text"}},
+			ReturnType: "jsonb",
+			Doc:        "JSON value cached under the key in the shared cache, NULL if it is not cached or expired",
+			Strict:     true,
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_cache_put",
+			Symbol:     "plgo_cache_store",
+			Args:       []BuiltinArg{{Name: "key", Type: "text"}, {Name: "value", Type: "bytea"}, {Name: "ttl", Type: "interval", Default: "NULL"}},
+			ReturnType: "boolean",
+			Doc:        "caches the value under the key for the ttl (NULL means no expiration), returns false if the value is larger than the cache",
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_cache_put",
+			Symbol:     "plgo_cache_store",
+			Args:       []BuiltinArg{{Name: "key", Type: "text"}, {Name: "value", Type: "jsonb"}, {Name: "ttl", Type: "interval", Default: "NULL"}},
+			ReturnType: "boolean",
+			Doc:        "caches the JSON value under the key for the ttl (NULL means no expiration), returns false if the value is larger than the cache",
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_cache_delete",
+			Symbol:     "plgo_cache_remove_key",
+			Args:       []BuiltinArg{{Name: "key", Type: "text"}},
+			ReturnType: "boolean",
+			Doc:        "removes the key from the shared cache, returns false if it was not cached",
+			Strict:     true,
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_cache_stats",
+			Symbol:     "plgo_cache_counters",
+			ReturnType: "jsonb",
+			Doc:        "entries, size in bytes, hits, misses and evictions of the shared cache",
+			Public:     true,
+		},
+	}
+}
+
+//rateLimitArgs are the arguments of the rate limit functions
+var rateLimitArgs = []BuiltinArg{
+	{Name: "name", Type: "text"},
+	{Name: "rate", Type: "double precision"},
+	{Name: "burst", Type: "integer"},
+	{Name: "tokens", Type: "integer", Default: "1"},
+}
+
+//rateLimitFunctions returns the SQL functions of the shared token buckets (plgo.NewRateLimiter)
+func rateLimitFunctions(packageName string) []CodeWriter {
+	return []CodeWriter{
+		&BuiltinFunction{
+			Name:       packageName + "_rate_limit",
+			Symbol:     "plgo_rate_limit",
+			Args:       rateLimitArgs,
+			ReturnType: "boolean",
+			Doc:        "takes the tokens from the named token bucket shared by all backends, returns false if the rate (per second) is exceeded",
+			Strict:     true,
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_rate_limit_wait",
+			Symbol:     "plgo_rate_limit_wait",
+			Args:       rateLimitArgs,
+			ReturnType: "VOID",
+			Doc:        "waits until the tokens can be taken from the named token bucket shared by all backends",
+			Strict:     true,
+		},
+	}
+}
+
+//jobObjects returns the tables and views of the job scheduler (plgo.RegisterJob)
+func jobObjects(packageName string) []CodeWriter {
+	return []CodeWriter{
+		&BuiltinTable{
+			Name: packageName + "_jobs",
+			Columns: "\tname text PRIMARY KEY,\n" +
+				"\tschedule text NOT NULL,\n" +
+				"\tenabled boolean NOT NULL DEFAULT true,\n" +
+				"\tmax_retries integer NOT NULL DEFAULT 0,\n" +
+				"\tretry_delay interval NOT NULL DEFAULT '1 minute'",
+			Doc:    "cron schedules (in UTC) of the jobs registered by the extension",
+			Config: true,
+		},
+		&BuiltinTable{
+			Name: packageName + "_job_runs",
+			Columns: "\tid bigserial PRIMARY KEY,\n" +
+				"\tjob text NOT NULL,\n" +
+				"\tattempt integer NOT NULL,\n" +
+				"\tstatus text NOT NULL,\n" +
+				"\tscheduled_at timestamptz NOT NULL DEFAULT now(),\n" +
+				"\tstarted_at timestamptz,\n" +
+				"\tfinished_at timestamptz,\n" +
+				"\terror text",
+			Doc: "runs of the jobs, use the " + packageName + "_job_history view",
+		},
+		&BuiltinView{
+			Name: packageName + "_job_history",
+			Query: "SELECT id, job, attempt, status, scheduled_at, started_at, finished_at,\n" +
+				"\tfinished_at - started_at AS duration, error\n" +
+				"FROM " + packageName + "_job_runs ORDER BY id DESC",
+			Doc:     "run history of the jobs: scheduled, running, succeeded, failed or skipped",
+			Depends: []string{relationEntity("table", packageName+"_job_runs")},
+		},
+	}
+}
+
+//queueObjects returns the table of the work queues (plgo.NewQueue)
+func queueObjects(packageName string) []CodeWriter {
+	return []CodeWriter{
+		&BuiltinTable{
+			Name: packageName + "_queue",
+			Columns: "\tid bigserial PRIMARY KEY,\n" +
+				"\tqueue text NOT NULL,\n" +
+				"\tpayload text NOT NULL,\n" +
+				"\tstatus text NOT NULL DEFAULT 'ready',\n" +
+				"\tattempts integer NOT NULL DEFAULT 0,\n" +
+				"\trun_at timestamptz NOT NULL DEFAULT now(),\n" +
+				"\tcreated_at timestamptz NOT NULL DEFAULT now(),\n" +
+				"\tlast_error text",
+			Doc:     "messages of the work queues: ready or dead after the last failed attempt",
+			Indexes: []string{"(queue, run_at, id) WHERE status = 'ready'"},
+		},
+	}
+}
+
+//codecFunctions returns the compression and encoding functions of the opt-in codec module (plgo -codecs)
+func codecFunctions(packageName string) []CodeWriter {
+	return []CodeWriter{
+		&BuiltinFunction{
+			Name:       packageName + "_compress",
+			Symbol:     "plgo_codec_compress",
+			Args:       []BuiltinArg{{Name: "data", Type: "bytea"}, {Name: "algorithm", Type: "text", Default: "'zstd'"}},
+			ReturnType: "bytea",
+			Doc:        "compresses the data with zstd, lz4, gzip, zlib or deflate",
+			Strict:     true,
+			Public:     true,
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_decompress",
+			Symbol:     "plgo_codec_decompress",
+			Args:       []BuiltinArg{{Name: "data", Type: "bytea"}, {Name: "algorithm", Type: "text", Default: "'zstd'"}},
+			ReturnType: "bytea",
+			Doc:        "decompresses the data compressed with zstd, lz4, gzip, zlib or deflate",
+			Strict:     true,
+			Public:     true,
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_encode",
+			Symbol:     "plgo_codec_encode",
+			Args:       []BuiltinArg{{Name: "data", Type: "bytea"}, {Name: "format", Type: "text", Default: "'base64'"}},
+			ReturnType: "text",
+			Doc:        "encodes the data as base64, base64url or hex",
+			Strict:     true,
+			Public:     true,
+		},
+		&BuiltinFunction{
+			Name:       packageName + "_decode",
+			Symbol:     "plgo_codec_decode",
+			Args:       []BuiltinArg{{Name: "text", Type: "text"}, {Name: "format", Type: "text", Default: "'base64'"}},
+			ReturnType: "bytea",
+			Doc:        "decodes the base64, base64url or hex text",
+			Strict:     true,
+			Public:     true,
+		},
+	}
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetParamDefaults(t *testing.T) {
+	tests := []struct {
+		source string
+		//defaults are the defaults of the parameters, err is the part of the expected error
+		defaults []string
+		err      string
+	}{
+		{"func F(a string, limit int64) {}", []string{"", ""}, ""},
+		{"//plgo:default limit=100 prefix=''\nfunc F(query string, limit int64, prefix string) {}", []string{"", "100", "''"}, ""},
+		{"//plgo:default prefix='it''s', limit=-1\nfunc F(limit int32, prefix string) {}", []string{"-1", "'it''s'"}, ""},
+		{"//plgo:default ratio=0.5\nfunc F(ratio float64) {}", []string{"0.5"}, ""},
+		{"//plgo:default ratio=1.5e-3\nfunc F(ratio float32) {}", []string{"1.5e-3"}, ""},
+		{"//plgo:default ok=TRUE\nfunc F(ok bool) {}", []string{"TRUE"}, ""},
+		{"//plgo:default n=null\nfunc F(n *int64) {}", []string{"null"}, ""},
+		{"//plgo:default at='2024-01-01'\nfunc F(at time.Time) {}", []string{"'2024-01-01'"}, ""},
+		{"//plgo:default n=1.2.3\nfunc F(n float64) {}", nil, "invalid //plgo:default"},
+		{"//plgo:default n=1.\nfunc F(n float64) {}", nil, "invalid //plgo:default"},
+		{"//plgo:default n=1.5\nfunc F(n int64) {}", nil, "isn't an integer default"},
+		{"//plgo:default n=1e3\nfunc F(n int32) {}", nil, "isn't an integer default"},
+		{"//plgo:default s=42\nfunc F(s string) {}", nil, "isn't an default of the string parameter s"},
+		{"//plgo:default n=true\nfunc F(n int64) {}", nil, "isn't an default of the int64 parameter n"},
+		{"//plgo:default m=1\nfunc F(n int64) {}", nil, "unknown parameter m"},
+		{"//plgo:default a=1\nfunc F(a int64, b int64) {}", nil, "parameter b must have an default"},
+	}
+	for _, test := range tests {
+		function := parseFuncDecl(t, test.source)
+		params, err := getParamList(function, nil, nil)
+		if err != nil {
+			t.Fatalf("%q: %s", test.source, err)
+		}
+		err = setParamDefaults(function, params)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: error %v, want %q", test.source, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", test.source, err)
+			continue
+		}
+		var defaults []string
+		for _, p := range params {
+			defaults = append(defaults, p.Default)
+		}
+		if !reflect.DeepEqual(defaults, test.defaults) {
+			t.Errorf("%q: defaults %q, want %q", test.source, defaults, test.defaults)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+//go:build ignore
+
+//gen_runtime writes runtime_sources.go with the source files of the plgo runtime (the parent directory),
+//run it with go generate after changing the runtime
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	matches, err := filepath.Glob(filepath.Join("..", "*.go"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Strings(matches)
+	buf := bytes.NewBufferString(`// Code generated by gen_runtime.go; DO NOT EDIT.
+
+package main
+
+//embeddedRuntime are the source files of the plgo runtime by their names
+var embeddedRuntime = map[string]string{
+`)
+	for _, path := range matches {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		buf.WriteString(strconv.Quote(filepath.Base(path)) + ": " + strconv.Quote(string(source)) + ",\n")
+	}
+	buf.WriteString("}\n")
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = ioutil.WriteFile("runtime_sources.go", code, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//Manifest describes the SQL objects of an extension release, it's written next to the extension script,
+//so the next release can check its upgrade path against it
+type Manifest struct {
+	Extension string             `json:"extension"`
+	Version   string             `json:"version"`
+	Doc       string             `json:"doc,omitempty"`
+	Functions []ManifestFunction `json:"functions"`
+	Relations []ManifestRelation `json:"relations,omitempty"`
+}
+
+//ManifestFunction is an SQL function of the extension
+type ManifestFunction struct {
+	Name       string   `json:"name"`
+	Schema     string   `json:"schema,omitempty"`
+	Args       []string `json:"args"`
+	ArgNames   []string `json:"arg_names,omitempty"`
+	Defaults   []string `json:"arg_defaults,omitempty"`
+	Returns    string   `json:"returns"`
+	Volatility string   `json:"volatility,omitempty"`
+	Strict     bool     `json:"strict,omitempty"`
+	Parallel   string   `json:"parallel,omitempty"`
+	Aggregate  bool     `json:"aggregate,omitempty"`
+	Procedure  bool     `json:"procedure,omitempty"`
+	Window     bool     `json:"window,omitempty"`
+	Doc        string   `json:"doc,omitempty"`
+}
+
+//ManifestRelation is an table, view or composite type of the extension
+type ManifestRelation struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Doc  string `json:"doc,omitempty"`
+}
+
+//kind returns the SQL kind of the function in the DROP and CREATE statements
+func (f ManifestFunction) kind() string {
+	switch {
+	case f.Procedure:
+		return "PROCEDURE"
+	case f.Aggregate:
+		return "AGGREGATE"
+	}
+	return "FUNCTION"
+}
+
+//kindName returns the kind of the function in the messages, the window functions are functions in SQL
+func (f ManifestFunction) kindName() string {
+	if f.Window {
+		return "window function"
+	}
+	return strings.ToLower(f.kind())
+}
+
+//key identifies the function, the unquoted SQL names are case insensitive
+func (f ManifestFunction) key() string {
+	name := strings.ToLower(f.Name)
+	if f.Schema != "" {
+		name = f.Schema + "." + name
+	}
+	return name + "(" + strings.Join(f.Args, ",") + ")"
+}
+
+func (r ManifestRelation) key() string {
+	return r.Kind + " " + strings.ToLower(r.Name)
+}
+
+//Manifest returns the manifest of the extension
+func (mw *ModuleWriter) Manifest() *Manifest {
+	m := &Manifest{Extension: mw.PackageName, Version: mw.Version, Doc: strings.TrimSpace(mw.Doc)}
+	for _, f := range mw.functions {
+		f.Describe(m)
+	}
+	return m
+}
+
+//manifestPath returns the path of the manifest of the extension in the directory
+func manifestPath(path, extension string) string {
+	return filepath.Join(path, extension+".manifest.json")
+}
+
+//WriteManifest writes the manifest of the extension
+func (mw *ModuleWriter) WriteManifest(path string) error {
+	data, err := json.MarshalIndent(mw.Manifest(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(manifestPath(path, mw.PackageName), append(data, '\n'), 0644)
+}
+
+//ReadManifest reads the manifest file
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read manifest: %w", err)
+	}
+	m := new(Manifest)
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("Cannot parse manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+//upgradeScriptName returns the file name of the script run by ALTER EXTENSION UPDATE
+func upgradeScriptName(extension, from, to string) string {
+	return extension + "--" + from + "--" + to + ".sql"
+}
+
+//scriptPattern returns the regexp matching the statement on the object in an SQL script,
+//the name can be schema qualified and quoted
+func scriptPattern(statement, kind, name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?is)\b` + statement + `\s+` + kind + `\s+(IF\s+(NOT\s+)?EXISTS\s+)?` +
+		`([^\s(]+\.)?"?` + regexp.QuoteMeta(name) + `"?(\s|\(|;|$)`)
+}
+
+//VerifyUpgrade checks the upgrade from the previous release to the current one, the upgrade script is read from the directory.
+//It returns the problems that would break ALTER EXTENSION UPDATE or leave the upgraded extension different from a new install
+func VerifyUpgrade(previous, current *Manifest, scriptDir string) ([]string, error) {
+	if previous.Extension != current.Extension {
+		return nil, fmt.Errorf("The manifest is of extension %s, not %s", previous.Extension, current.Extension)
+	}
+	var problems []string
+	removed, added, changed := diffFunctions(previous, current)
+	removedRelations, addedRelations := diffRelations(previous, current)
+	if len(removed)+len(added)+len(changed)+len(removedRelations)+len(addedRelations) == 0 {
+		return nil, nil
+	}
+	if previous.Version == current.Version {
+		return []string{fmt.Sprintf("The SQL objects changed but the version is still %s, build with -version", current.Version)}, nil
+	}
+	scriptName := upgradeScriptName(current.Extension, previous.Version, current.Version)
+	script, err := ioutil.ReadFile(filepath.Join(scriptDir, scriptName))
+	if os.IsNotExist(err) {
+		problems = append(problems, fmt.Sprintf("Missing upgrade script %s (add it to the sql directory of the package)", scriptName))
+	} else if err != nil {
+		return nil, err
+	}
+	for _, f := range removed {
+		if !scriptPattern("DROP", f.kind(), f.Name).Match(script) {
+			problem := fmt.Sprintf("Function %s was removed, the upgrade script must DROP it", f.key())
+			if renamed := findRenamed(f, added); renamed != nil {
+				problem += fmt.Sprintf(" (renamed to %s?)", renamed.Name)
+			}
+			problems = append(problems, problem)
+		}
+	}
+	for _, f := range changed {
+		//the previous function is dropped with its kind, e.g. DROP FUNCTION of the function changed to an aggregate
+		old := previous.function(f.key())
+		if scriptPattern("DROP", old.kind(), f.Name).Match(script) {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("Function %s %s, the upgrade script must DROP it before CREATE", f.key(), functionChange(old, f)))
+	}
+	for _, f := range append(added, changed...) {
+		if !scriptPattern("CREATE(\\s+OR\\s+REPLACE)?", f.kind(), f.Name).Match(script) {
+			problems = append(problems, fmt.Sprintf("Function %s is not created by the upgrade script", f.key()))
+		}
+	}
+	for _, r := range removedRelations {
+		if !scriptPattern("DROP", r.Kind, r.Name).Match(script) {
+			problems = append(problems, fmt.Sprintf("The %s %s was removed, the upgrade script must DROP it", r.Kind, r.Name))
+		}
+	}
+	for _, r := range addedRelations {
+		if !scriptPattern("CREATE(\\s+OR\\s+REPLACE)?", r.Kind, r.Name).Match(script) {
+			problems = append(problems, fmt.Sprintf("The %s %s is not created by the upgrade script", r.Kind, r.Name))
+		}
+	}
+	return problems, nil
+}
+
+//diffFunctions returns the functions missing in the current release, the new ones and the ones with changed return type
+//or removed parameter defaults
+func diffFunctions(previous, current *Manifest) (removed, added, changed []ManifestFunction) {
+	previousFunctions := make(map[string]ManifestFunction)
+	for _, f := range previous.Functions {
+		previousFunctions[f.key()] = f
+	}
+	currentFunctions := make(map[string]bool)
+	for _, f := range current.Functions {
+		currentFunctions[f.key()] = true
+		old, ok := previousFunctions[f.key()]
+		switch {
+		case !ok:
+			added = append(added, f)
+		case functionChange(old, f) != "":
+			changed = append(changed, f)
+		}
+	}
+	for _, f := range previous.Functions {
+		if !currentFunctions[f.key()] {
+			removed = append(removed, f)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].key() < removed[j].key() })
+	return removed, added, changed
+}
+
+//functionChange describes the change of the function with the same signature that CREATE OR REPLACE can't make,
+//so the upgrade script must DROP the previous function, "" if it can be replaced
+func functionChange(previous, current ManifestFunction) string {
+	switch {
+	case previous.kindName() != current.kindName():
+		return "changed from an " + previous.kindName() + " to an " + current.kindName()
+	case !strings.EqualFold(previous.Returns, current.Returns):
+		return "changed the return type to " + current.Returns
+	case renamesParameter(previous, current):
+		return "renamed the parameters to (" + strings.Join(current.ArgNames, ", ") + ")"
+	case removesDefault(previous, current):
+		return "removed an parameter default"
+	}
+	return ""
+}
+
+//renamesParameter reports whether the current release renames or unnames an input parameter of the function,
+//CREATE OR REPLACE can't change the names of the input parameters
+func renamesParameter(previous, current ManifestFunction) bool {
+	for i, name := range previous.ArgNames {
+		if name != "" && (i >= len(current.ArgNames) || current.ArgNames[i] != name) {
+			return true
+		}
+	}
+	return false
+}
+
+//removesDefault reports whether the current release removes the default of an parameter of the function,
+//CREATE OR REPLACE can't remove the defaults
+func removesDefault(previous, current ManifestFunction) bool {
+	for i, value := range previous.Defaults {
+		if value != "" && (i >= len(current.Defaults) || current.Defaults[i] == "") {
+			return true
+		}
+	}
+	return false
+}
+
+//function returns the function of the manifest with the key
+func (m *Manifest) function(key string) ManifestFunction {
+	for _, f := range m.Functions {
+		if f.key() == key {
+			return f
+		}
+	}
+	return ManifestFunction{}
+}
+
+//diffRelations returns the tables, views and types missing in the current release and the new ones
+func diffRelations(previous, current *Manifest) (removed, added []ManifestRelation) {
+	previousRelations := make(map[string]bool)
+	for _, r := range previous.Relations {
+		previousRelations[r.key()] = true
+	}
+	currentRelations := make(map[string]bool)
+	for _, r := range current.Relations {
+		currentRelations[r.key()] = true
+		if !previousRelations[r.key()] {
+			added = append(added, r)
+		}
+	}
+	for _, r := range previous.Relations {
+		if !currentRelations[r.key()] {
+			removed = append(removed, r)
+		}
+	}
+	return removed, added
+}
+
+//findRenamed returns the added function with the same signature as the removed one
+func findRenamed(removed ManifestFunction, added []ManifestFunction) *ManifestFunction {
+	for i, f := range added {
+		if strings.Join(f.Args, ",") == strings.Join(removed.Args, ",") && strings.EqualFold(f.Returns, removed.Returns) {
+			return &added[i]
+		}
+	}
+	return nil
+}
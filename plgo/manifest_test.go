@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyUpgrade(t *testing.T) {
+	add := ManifestFunction{Name: "add", Args: []string{"integer", "integer"}, Returns: "integer"}
+	search := ManifestFunction{Name: "search", Args: []string{"text", "bigint"}, ArgNames: []string{"query", "limit"},
+		Defaults: []string{"", "100"}, Returns: "SETOF text"}
+	previous := &Manifest{Extension: "ext", Version: "0.1", Functions: []ManifestFunction{add, search},
+		Relations: []ManifestRelation{{Kind: "table", Name: "ext_jobs"}}}
+	sum := ManifestFunction{Name: "sum2", Args: []string{"integer", "integer"}, Returns: "integer"}
+	searchNoDefault := search
+	searchNoDefault.Defaults = nil
+	addBigint := add
+	addBigint.Returns = "bigint"
+	searchRenamed := search
+	searchRenamed.ArgNames = []string{"pattern", "limit"}
+	addAggregate := add
+	addAggregate.Aggregate = true
+	tests := []struct {
+		name    string
+		current *Manifest
+		//script is the upgrade script ext--0.1--0.2.sql, none if empty
+		script string
+		want   []string
+	}{
+		{
+			name:    "unchanged",
+			current: &Manifest{Extension: "ext", Version: "0.1", Functions: []ManifestFunction{search, add}, Relations: previous.Relations},
+		},
+		{
+			name:    "same version",
+			current: &Manifest{Extension: "ext", Version: "0.1", Functions: []ManifestFunction{add}},
+			want:    []string{"The SQL objects changed but the version is still 0.1, build with -version"},
+		},
+		{
+			name:    "missing script",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{add, search, sum}, Relations: previous.Relations},
+			want: []string{
+				"Missing upgrade script ext--0.1--0.2.sql (add it to the sql directory of the package)",
+				"Function sum2(integer,integer) is not created by the upgrade script",
+			},
+		},
+		{
+			name:    "added function",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{add, search, sum}, Relations: previous.Relations},
+			script:  "CREATE OR REPLACE FUNCTION sum2(a integer, b integer)\nRETURNS integer AS 'MODULE_PATHNAME', 'Sum2' LANGUAGE c;\n",
+		},
+		{
+			name:    "renamed function",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{sum, search}, Relations: previous.Relations},
+			script:  "CREATE FUNCTION sum2(a integer, b integer)\nRETURNS integer AS 'MODULE_PATHNAME', 'Sum2' LANGUAGE c;\n",
+			want:    []string{"Function add(integer,integer) was removed, the upgrade script must DROP it (renamed to sum2?)"},
+		},
+		{
+			name:    "dropped function",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{search}, Relations: previous.Relations},
+			script:  "DROP FUNCTION IF EXISTS \"public\".\"add\"(integer, integer);\n",
+		},
+		{
+			name:    "changed return type",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{addBigint, search}, Relations: previous.Relations},
+			script:  "CREATE OR REPLACE FUNCTION add(a integer, b integer)\nRETURNS bigint AS 'MODULE_PATHNAME', 'Add' LANGUAGE c;\n",
+			want:    []string{"Function add(integer,integer) changed the return type to bigint, the upgrade script must DROP it before CREATE"},
+		},
+		{
+			name:    "removed default",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{add, searchNoDefault}, Relations: previous.Relations},
+			script:  "DROP FUNCTION search(text, bigint);\nCREATE FUNCTION search(query text, \"limit\" bigint)\nRETURNS SETOF text AS 'MODULE_PATHNAME', 'Search' LANGUAGE c;\n",
+		},
+		{
+			name:    "removed default without DROP",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{add, searchNoDefault}, Relations: previous.Relations},
+			script:  "CREATE OR REPLACE FUNCTION search(query text, \"limit\" bigint)\nRETURNS SETOF text AS 'MODULE_PATHNAME', 'Search' LANGUAGE c;\n",
+			want:    []string{"Function search(text,bigint) removed an parameter default, the upgrade script must DROP it before CREATE"},
+		},
+		{
+			name:    "renamed parameter",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{add, searchRenamed}, Relations: previous.Relations},
+			script:  "DROP FUNCTION search(text, bigint);\nCREATE FUNCTION search(pattern text, \"limit\" bigint DEFAULT 100)\nRETURNS SETOF text AS 'MODULE_PATHNAME', 'Search' LANGUAGE c;\n",
+		},
+		{
+			name:    "renamed parameter without DROP",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{add, searchRenamed}, Relations: previous.Relations},
+			script:  "CREATE OR REPLACE FUNCTION search(pattern text, \"limit\" bigint DEFAULT 100)\nRETURNS SETOF text AS 'MODULE_PATHNAME', 'Search' LANGUAGE c;\n",
+			want:    []string{"Function search(text,bigint) renamed the parameters to (pattern, limit), the upgrade script must DROP it before CREATE"},
+		},
+		{
+			name:    "function changed to aggregate",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{addAggregate, search}, Relations: previous.Relations},
+			script:  "DROP FUNCTION add(integer, integer);\nCREATE AGGREGATE add(integer, integer) (\n\tsfunc = add_state,\n\tstype = integer\n);\n",
+		},
+		{
+			name:    "function changed to aggregate without DROP",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{addAggregate, search}, Relations: previous.Relations},
+			script:  "CREATE AGGREGATE add(integer, integer) (\n\tsfunc = add_state,\n\tstype = integer\n);\n",
+			want:    []string{"Function add(integer,integer) changed from an function to an aggregate, the upgrade script must DROP it before CREATE"},
+		},
+		{
+			name:    "relations",
+			current: &Manifest{Extension: "ext", Version: "0.2", Functions: []ManifestFunction{add, search}, Relations: []ManifestRelation{{Kind: "view", Name: "ext_stat_functions"}}},
+			script:  "-- the jobs are kept\n",
+			want: []string{
+				"The table ext_jobs was removed, the upgrade script must DROP it",
+				"The view ext_stat_functions is not created by the upgrade script",
+			},
+		},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		if test.script != "" {
+			if err := os.WriteFile(filepath.Join(dir, "ext--0.1--0.2.sql"), []byte(test.script), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		problems, err := VerifyUpgrade(previous, test.current, dir)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(problems, test.want) {
+			t.Errorf("%s: problems\n%q\nwant\n%q", test.name, problems, test.want)
+		}
+	}
+	if _, err := VerifyUpgrade(previous, &Manifest{Extension: "other"}, t.TempDir()); err == nil {
+		t.Error("VerifyUpgrade of another extension didn't fail")
+	}
+}
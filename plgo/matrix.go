@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//findPgConfig returns the pg_config of the PostgreSQL major version, PG_CONFIG_<version> (e.g. PG_CONFIG_16)
+//or the one of the usual installations
+func findPgConfig(version string) (string, error) {
+	if path := os.Getenv("PG_CONFIG_" + version); path != "" {
+		return path, nil
+	}
+	for _, path := range pgConfigCandidates(version) {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("Cannot find pg_config of PostgreSQL %s, set PG_CONFIG_%s", version, version)
+}
+
+//pgTarget is an PostgreSQL major version the extension is written for, with the output directory of its files
+type pgTarget struct {
+	version int
+	output  string
+}
+
+//pgTargets returns the comma separated major versions of -pg with their output directories <output>/pg<version>,
+//without versions the version of pg_config with the output directory
+func pgTargets(versions, output string) ([]pgTarget, error) {
+	if versions == "" {
+		version, err := serverVersion()
+		if err != nil {
+			return nil, err
+		}
+		return []pgTarget{{version, output}}, nil
+	}
+	var targets []pgTarget
+	for _, v := range splitList(versions) {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid PostgreSQL major version %s", v)
+		}
+		targets = append(targets, pgTarget{version, filepath.Join(output, "pg"+v)})
+	}
+	return targets, nil
+}
+
+//selectPgConfig makes pg_config of the PostgreSQL major version the pg_config of the build
+func selectPgConfig(version int) error {
+	path, err := findPgConfig(strconv.Itoa(version))
+	if err != nil {
+		return err
+	}
+	pgConfig = path
+	detected, err := serverVersion()
+	if err != nil {
+		return err
+	}
+	if detected != version {
+		return fmt.Errorf("%s is pg_config of PostgreSQL %d, not %d", path, detected, version)
+	}
+	return nil
+}
+
+//usePgVersion selects pg_config of the -pg version of plgo test and watch, which build for one version,
+//it returns the output directory <output>/pg<version>, the output directory without the version
+func usePgVersion(versions, output string) (string, error) {
+	if versions == "" {
+		return output, nil
+	}
+	targets, err := pgTargets(versions, output)
+	if err != nil {
+		return "", err
+	}
+	if len(targets) > 1 {
+		return "", fmt.Errorf("-pg %s: the extension is tested with one PostgreSQL version, build for the others with plgo build -pg", versions)
+	}
+	if err = selectPgConfig(targets[0].version); err != nil {
+		return "", err
+	}
+	return targets[0].output, nil
+}
+
+//buildMatrix builds the extension for each of the comma separated major versions with their pg_config and server headers
+//into <output>/pg<version>, the Makefile of each installs it with its pg_config. The pg_config of plgo.toml is ignored
+func buildMatrix(build func(output string) (*ModuleWriter, string, error), output, versions string) error {
+	targets, err := pgTargets(versions, output)
+	if err != nil {
+		return err
+	}
+	var failed []string
+	for _, target := range targets {
+		if err = selectPgConfig(target.version); err != nil {
+			return err
+		}
+		fmt.Printf("PostgreSQL %d (%s)\n", target.version, pgConfig)
+		if _, _, err = build(target.output); err != nil {
+			failed = append(failed, strconv.Itoa(target.version))
+			fmt.Printf("FAIL\tPostgreSQL %d\n%s\n", target.version, err)
+			continue
+		}
+		fmt.Printf("ok\tPostgreSQL %d\t%s\n", target.version, target.output)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("FAIL: the build for PostgreSQL %s failed", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//plpgsqlFunction is an PL/pgSQL function found in the database or in the dump
+type plpgsqlFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Result    string `json:"result"`
+	Source    string `json:"source"`
+}
+
+//sqlGoTypes are the Go types of the SQL types supported by plgo, the reverse of datumTypes
+var sqlGoTypes = map[string]string{
+	"text":                        "string",
+	"character varying":           "string",
+	"varchar":                     "string",
+	"bytea":                       "[]byte",
+	"smallint":                    "int16",
+	"int2":                        "int16",
+	"integer":                     "int32",
+	"int":                         "int32",
+	"int4":                        "int32",
+	"bigint":                      "int64",
+	"int8":                        "int64",
+	"real":                        "float32",
+	"float4":                      "float32",
+	"double precision":            "float64",
+	"float8":                      "float64",
+	"boolean":                     "bool",
+	"bool":                        "bool",
+	"timestamp with time zone":    "time.Time",
+	"timestamptz":                 "time.Time",
+	"timestamp without time zone": "time.Time",
+	"timestamp":                   "time.Time",
+	"date":                        "time.Time",
+	"time without time zone":      "time.Time",
+	"time":                        "time.Time",
+	"inet":                        "netip.Addr",
+	"cidr":                        "netip.Prefix",
+	"macaddr":                     "net.HardwareAddr",
+	"int4range":                   "plgo.Range[int32]",
+	"int8range":                   "plgo.Range[int64]",
+	"numrange":                    "plgo.Range[plgo.Numeric]",
+	"tstzrange":                   "plgo.Range[time.Time]",
+	"tsrange":                     "plgo.Range[time.Time]",
+	"daterange":                   "plgo.Range[time.Time]",
+	"interval":                    "time.Duration",
+	"hstore":                      "map[string]*string",
+	"uuid":                        "plgo.UUID",
+	"numeric":                     "plgo.Numeric",
+	"decimal":                     "plgo.Numeric",
+}
+
+//plpgsqlQuery reads the PL/pgSQL functions of the schema as an JSON array
+const plpgsqlQuery = `SELECT coalesce(json_agg(json_build_object(
+	'name', p.proname, 'arguments', pg_get_function_arguments(p.oid),
+	'result', pg_get_function_result(p.oid), 'source', p.prosrc) ORDER BY p.proname, p.oid), '[]')
+FROM pg_proc p
+JOIN pg_language l ON l.oid = p.prolang
+JOIN pg_namespace n ON n.oid = p.pronamespace
+WHERE l.lanname = 'plpgsql' AND p.prokind = 'f' AND n.nspname = %s`
+
+//readDatabaseFunctions reads the PL/pgSQL functions of the schema with psql
+func readDatabaseFunctions(conninfo, schema string) ([]plpgsqlFunction, error) {
+	query := fmt.Sprintf(plpgsqlQuery, "'"+strings.ReplaceAll(schema, "'", "''")+"'")
+	var stderr bytes.Buffer
+	psql := exec.Command("psql", "-X", "-A", "-t", "-v", "ON_ERROR_STOP=1", "-d", conninfo, "-c", query)
+	psql.Stderr = &stderr
+	out, err := psql.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read functions with psql: %s %s", err, stderr.String())
+	}
+	var functions []plpgsqlFunction
+	if err = json.Unmarshal(out, &functions); err != nil {
+		return nil, fmt.Errorf("Cannot parse psql output: %w", err)
+	}
+	return functions, nil
+}
+
+var (
+	createFunctionRe = regexp.MustCompile(`(?is)\bCREATE\s+(?:OR\s+REPLACE\s+)?FUNCTION\s+(?:(?:"[^"]+"|[\w$]+)\.)?("[^"]+"|[\w$]+)\s*\(`)
+	returnsRe        = regexp.MustCompile(`(?is)^\s*RETURNS\s+(SETOF\s+)?(.+?)\s+(?:LANGUAGE|AS|IMMUTABLE|STABLE|VOLATILE|STRICT|CALLED|SECURITY|PARALLEL|COST|ROWS|SET|WINDOW|LEAKPROOF|RETURNS\s+NULL)\b`)
+	languageRe       = regexp.MustCompile(`(?is)\bLANGUAGE\s+'?plpgsql'?`)
+	dollarBodyRe     = regexp.MustCompile(`(?s)\bAS\s+(\$[\w]*\$)(.*?)(\$[\w]*\$)`)
+	argDefaultRe     = regexp.MustCompile(`(?i)\s+DEFAULT\s+|\s*=\s*`)
+	//stubDefaultRe matches the DEFAULT values written as //plgo:default, the literals with an optional cast, e.g. 'a'::text or (-1)
+	stubDefaultRe = regexp.MustCompile(`(?is)^\(?('(?:[^']|'')*'|[-+]?\d+(?:\.\d+)?(?:e[-+]?\d+)?|true|false|null)\)?(?:::[\w\s."\[\]()]+)?$`)
+)
+
+//readDumpFunctions parses the PL/pgSQL functions from an SQL script, e.g. pg_dump --schema-only output
+func readDumpFunctions(dump string) []plpgsqlFunction {
+	var functions []plpgsqlFunction
+	matches := createFunctionRe.FindAllStringSubmatchIndex(dump, -1)
+	for i, match := range matches {
+		end := len(dump)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		statement := dump[match[0]:end]
+		name := dumpIdent(dump[match[2]:match[3]])
+		args, rest, ok := balancedParens(dump[match[1]:end])
+		if !ok || !languageRe.MatchString(statement) {
+			continue
+		}
+		f := plpgsqlFunction{Name: name, Arguments: args}
+		if returns := returnsRe.FindStringSubmatch(rest); returns != nil {
+			f.Result = returns[1] + strings.TrimSpace(returns[2])
+		}
+		if body := dollarBodyRe.FindStringSubmatch(statement); body != nil {
+			f.Source = body[2]
+		}
+		functions = append(functions, f)
+	}
+	return functions
+}
+
+//dumpIdent returns the name of the SQL identifier, the unquoted identifiers are folded to lower case
+func dumpIdent(ident string) string {
+	if unquoted, ok := strings.CutPrefix(ident, `"`); ok {
+		return strings.ReplaceAll(strings.TrimSuffix(unquoted, `"`), `""`, `"`)
+	}
+	return strings.ToLower(ident)
+}
+
+//balancedParens returns the text until the closing parenthesis and the text after it
+func balancedParens(s string) (string, string, bool) {
+	depth := 1
+	quoted := false
+	for i, r := range s {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth == 0 {
+				return s[:i], s[i+1:], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+//splitArguments splits the argument list on the top level commas
+func splitArguments(args string) []string {
+	var parts []string
+	depth, start := 0, 0
+	quoted := false
+	for i, r := range args {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(args[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(args[start:]); last != "" {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+var argModes = map[string]bool{"in": true, "out": true, "inout": true, "variadic": true}
+
+//baseSQLType returns the lower case SQL type without pg_catalog and the type modifiers
+func baseSQLType(sqlType string) string {
+	sqlType = strings.ToLower(strings.TrimSpace(sqlType))
+	if dot := strings.LastIndex(sqlType, "."); dot >= 0 && sqlType[:dot] == "pg_catalog" {
+		sqlType = sqlType[dot+1:]
+	}
+	//the type modifiers, e.g. varchar(20) or numeric(10,2)
+	if paren := strings.Index(sqlType, "("); paren >= 0 {
+		if close := strings.Index(sqlType, ")"); close > paren {
+			sqlType = strings.TrimSpace(sqlType[:paren] + sqlType[close+1:])
+		}
+	}
+	return sqlType
+}
+
+//stubTimeTypes are the //plgo:time types of the SQL types converted to time.Time or its range, timestamptz is the default
+var stubTimeTypes = map[string]string{
+	"timestamp without time zone": "timestamp",
+	"timestamp":                   "timestamp",
+	"date":                        "date",
+	"time without time zone":      "time",
+	"time":                        "time",
+	"tsrange":                     "timestamp",
+	"daterange":                   "date",
+}
+
+//stubTimeType returns the //plgo:time type of the SQL type (or array), "" if it isn't needed
+func stubTimeType(sqlType string) string {
+	return stubTimeTypes[strings.TrimSuffix(baseSQLType(sqlType), "[]")]
+}
+
+//goType returns the Go type of the SQL type, or "" if plgo doesn't support it
+func goType(sqlType string) string {
+	sqlType = baseSQLType(sqlType)
+	if strings.HasSuffix(sqlType, "[]") {
+		if elem := goType(strings.TrimSuffix(sqlType, "[]")); elem != "" {
+			return "[]" + elem
+		}
+		return ""
+	}
+	return sqlGoTypes[sqlType]
+}
+
+//goName returns the exported Go name of the SQL name, e.g. get_user_name is GetUserName
+func goName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if r == '_' || r == '$' || r == ' ' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	goName := b.String()
+	if goName == "" || !unicode.IsLetter([]rune(goName)[0]) {
+		goName = "F" + goName
+	}
+	return goName
+}
+
+//goParamName returns the Go parameter name of the SQL argument
+func goParamName(name string, i int) string {
+	if name == "" {
+		return fmt.Sprintf("arg%d", i+1)
+	}
+	goName := goName(name)
+	goName = strings.ToLower(goName[:1]) + goName[1:]
+	switch goName {
+	case "type", "func", "var", "range", "map", "chan", "go", "select", "case", "default", "interface", "struct",
+		"package", "import", "return", "break", "continue", "for", "if", "else", "switch", "const", "defer", "fallthrough", "goto":
+		goName += "_"
+	}
+	return goName
+}
+
+//zeroValue returns the zero value expression of the Go type
+func zeroValue(goType string) string {
+	switch {
+	case goType == "string":
+		return `""`
+	case goType == "bool":
+		return "false"
+	case goType == "plgo.Numeric":
+		return `"0"`
+	case goType == "time.Time" || goType == "plgo.UUID" || goType == "netip.Addr" || goType == "netip.Prefix" || strings.HasPrefix(goType, "plgo.Range["):
+		return goType + "{}"
+	case strings.HasPrefix(goType, "[]") || strings.HasPrefix(goType, "map[") || goType == "net.HardwareAddr":
+		return "nil"
+	default:
+		return "0"
+	}
+}
+
+//WriteStubs writes the Go stubs of the PL/pgSQL functions, the unsupported functions are listed in an comment
+func WriteStubs(functions []plpgsqlFunction, w io.Writer) error {
+	var buf bytes.Buffer
+	var skipped []string
+	packages, usesPlgo := make(map[string]bool), false
+	names := make(map[string]int)
+	var stubs bytes.Buffer
+	for _, f := range functions {
+		stub, err := writeStub(f, names, packages, &usesPlgo)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s(%s): %s", f.Name, f.Arguments, err))
+			continue
+		}
+		stubs.WriteString(stub)
+	}
+	buf.WriteString("package main\n\n")
+	var imports []string
+	if len(packages) > 0 {
+		var paths []string
+		for path := range packages {
+			paths = append(paths, strconv.Quote(path))
+		}
+		sort.Strings(paths)
+		imports = append(imports, strings.Join(paths, "\n"))
+	}
+	if usesPlgo {
+		imports = append(imports, `"github.com/algonode/plgo"`)
+	}
+	if len(imports) > 0 {
+		buf.WriteString("import (\n" + strings.Join(imports, "\n\n") + "\n)\n\n")
+	}
+	if len(skipped) > 0 {
+		sort.Strings(skipped)
+		buf.WriteString("//TODO: functions with types not supported by plgo:\n")
+		for _, s := range skipped {
+			buf.WriteString("//  " + s + "\n")
+		}
+		buf.WriteString("\n")
+	}
+	buf.Write(stubs.Bytes())
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("Cannot format the stubs: %w", err)
+	}
+	_, err = w.Write(code)
+	return err
+}
+
+//stubSQLName returns the name of the function or column as written in //plgo:name or the tag of the row,
+//the names that aren't lower case identifiers are quoted, e.g. "GetUser", the unquoted names are folded to lower case
+func stubSQLName(name string) string {
+	if name != strings.ToLower(name) || !sqlIdentRe.MatchString(name) {
+		return quoteIdent(name)
+	}
+	return name
+}
+
+//stubParamDefault is the DEFAULT of an argument of the migrated function
+type stubParamDefault struct {
+	//name is the Go parameter, value the SQL expression and literal its //plgo:default value, "" if it isn't an literal
+	name, value, literal string
+}
+
+//stubDefault returns the //plgo:default value of the DEFAULT of the parameter, "" if it isn't an literal,
+//the literals of other types are quoted, e.g. DEFAULT 1 of an numeric parameter is '1'
+func stubDefault(p Param, value string) string {
+	match := stubDefaultRe.FindStringSubmatch(value)
+	if match == nil {
+		return ""
+	}
+	literal := match[1]
+	if checkParamDefault(p, literal) != nil {
+		literal = quoteLiteral(literal)
+	}
+	return literal
+}
+
+//rowField returns the field of the row struct of an set returning function, it adds the import paths of its type to the packages
+func rowField(column, sqlType string, packages map[string]bool, usesPlgo *bool) (string, error) {
+	typ := goType(sqlType)
+	if typ == "" {
+		return "", fmt.Errorf("column %s type %s", column, sqlType)
+	}
+	//the times of the rows are timestamptz, //plgo:time declares only the parameters and the result
+	if stubTimeType(sqlType) != "" {
+		return "", fmt.Errorf("column %s type %s, the time columns of the rows are timestamp with time zone", column, sqlType)
+	}
+	for _, path := range typeImports(typ) {
+		packages[path] = true
+	}
+	if strings.Contains(typ, "plgo.") {
+		*usesPlgo = true
+	}
+	return fmt.Sprintf("%s %s `plgo:%q`", goName(column), typ, stubSQLName(column)), nil
+}
+
+//writeStub returns the Go stub of the function, it adds the import paths of the used types to the packages.
+//The set returning functions return an slice of an row struct, SETOF an scalar is an row of one column
+func writeStub(f plpgsqlFunction, names map[string]int, packages map[string]bool, usesPlgo *bool) (string, error) {
+	result := strings.TrimSpace(f.Result)
+	lowerResult := strings.ToLower(result)
+	var params, times []string
+	var paramDefaults []stubParamDefault
+	trigger := lowerResult == "trigger"
+	if trigger {
+		params = append(params, "td *plgo.TriggerData")
+		*usesPlgo = true
+	}
+	for i, arg := range splitArguments(f.Arguments) {
+		value := ""
+		if idx := argDefaultRe.FindStringIndex(arg); idx != nil {
+			arg, value = arg[:idx[0]], strings.TrimSpace(arg[idx[1]:])
+		}
+		fields := strings.Fields(arg)
+		if len(fields) > 0 && argModes[strings.ToLower(fields[0])] {
+			if mode := strings.ToLower(fields[0]); mode != "in" {
+				return "", fmt.Errorf("%s arguments are not supported", strings.ToUpper(mode))
+			}
+			fields = fields[1:]
+		}
+		name := ""
+		sqlType := strings.Join(fields, " ")
+		if len(fields) > 1 && goType(sqlType) == "" {
+			name, sqlType = fields[0], strings.Join(fields[1:], " ")
+		}
+		typ := goType(sqlType)
+		if typ == "" {
+			return "", fmt.Errorf("argument type %s", sqlType)
+		}
+		for _, path := range typeImports(typ) {
+			packages[path] = true
+		}
+		if strings.Contains(typ, "plgo.") {
+			*usesPlgo = true
+		}
+		paramName := goParamName(strings.Trim(name, `"`), i)
+		if timeType := stubTimeType(sqlType); timeType != "" {
+			times = append(times, paramName+"="+timeType)
+		}
+		params = append(params, paramName+" "+typ)
+		if value != "" {
+			paramDefaults = append(paramDefaults, stubParamDefault{paramName, value, stubDefault(Param{Name: paramName, Type: typ}, value)})
+		}
+	}
+	returnType := ""
+	var rowFields []string
+	switch resultFields := strings.Fields(lowerResult); {
+	case trigger:
+		returnType = "*plgo.TriggerRow"
+	case lowerResult == "void" || lowerResult == "":
+	case strings.HasPrefix(lowerResult, "table"):
+		columns, _, ok := balancedParens(strings.TrimPrefix(strings.TrimSpace(result[len("table"):]), "("))
+		if !ok {
+			return "", fmt.Errorf("return type %s", result)
+		}
+		for _, column := range splitArguments(columns) {
+			fields := strings.Fields(column)
+			if len(fields) < 2 {
+				return "", fmt.Errorf("return type %s", result)
+			}
+			field, err := rowField(dumpIdent(fields[0]), strings.Join(fields[1:], " "), packages, usesPlgo)
+			if err != nil {
+				return "", err
+			}
+			rowFields = append(rowFields, field)
+		}
+	case len(resultFields) > 1 && resultFields[0] == "setof":
+		//the column of SETOF is named as the function
+		field, err := rowField(f.Name, strings.TrimSpace(result[len("setof"):]), packages, usesPlgo)
+		if err != nil {
+			return "", err
+		}
+		rowFields = append(rowFields, field)
+	default:
+		returnType = goType(result)
+		if returnType == "" {
+			return "", fmt.Errorf("return type %s", result)
+		}
+		for _, path := range typeImports(returnType) {
+			packages[path] = true
+		}
+		if timeType := stubTimeType(result); timeType != "" {
+			times = append(times, timeReturn+"="+timeType)
+		}
+		if strings.Contains(returnType, "plgo.") {
+			*usesPlgo = true
+		}
+	}
+	name := goName(f.Name)
+	names[name]++
+	if names[name] > 1 {
+		name = fmt.Sprintf("%s%d", name, names[name])
+	}
+	var b strings.Builder
+	if len(rowFields) > 0 {
+		returnType = "[]" + name + "Row"
+		fmt.Fprintf(&b, "//%sRow is an row returned by %s\n", name, name)
+		fmt.Fprintf(&b, "type %sRow struct {\n%s\n}\n\n", name, strings.Join(rowFields, "\n"))
+	}
+	fmt.Fprintf(&b, "//%s is migrated from the PL/pgSQL function %s(%s)\n", name, f.Name, f.Arguments)
+	//the function keeps its SQL name, so the callers don't change
+	if sqlName := stubSQLName(f.Name); sqlName != strings.ToLower(name) {
+		b.WriteString(directivePrefix + "name " + sqlName + "\n")
+	}
+	if len(times) > 0 {
+		b.WriteString(directivePrefix + "time " + strings.Join(times, ",") + "\n")
+	}
+	//the defaults are trailing, so the defaults before an default that isn't an literal are dropped too
+	var declared, dropped []string
+	for i := len(paramDefaults) - 1; i >= 0; i-- {
+		d := paramDefaults[i]
+		if d.literal != "" && len(dropped) == 0 {
+			declared = append([]string{d.name + "=" + d.literal}, declared...)
+			continue
+		}
+		dropped = append([]string{d.name + " DEFAULT " + d.value}, dropped...)
+	}
+	if len(declared) > 0 {
+		b.WriteString(directivePrefix + "default " + strings.Join(declared, " ") + "\n")
+	}
+	fmt.Fprintf(&b, "func %s(%s) %s {\n", name, strings.Join(params, ", "), returnType)
+	if len(dropped) > 0 {
+		b.WriteString("//TODO: the callers must pass the dropped defaults that aren't SQL literals or precede one: " + strings.Join(dropped, ", ") + "\n")
+	}
+	b.WriteString("//TODO: port the PL/pgSQL body\n")
+	for _, line := range strings.Split(strings.Trim(f.Source, "\n"), "\n") {
+		if strings.TrimSpace(f.Source) != "" {
+			b.WriteString("//  " + strings.TrimRight(line, " \t\r") + "\n")
+		}
+	}
+	switch {
+	case trigger:
+		b.WriteString("return nil\n")
+	case returnType != "":
+		b.WriteString("return " + zeroValue(returnType) + "\n")
+	}
+	b.WriteString("}\n\n")
+	return b.String(), nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//migrateDump is an pg_dump --schema-only output with the supported and unsupported PL/pgSQL functions
+const migrateDump = `CREATE FUNCTION public.add_one(x integer, y integer DEFAULT 1) RETURNS integer
+    LANGUAGE plpgsql IMMUTABLE
+    AS $$ BEGIN RETURN x + y; END $$;
+CREATE OR REPLACE FUNCTION "Mixed"(a text, b timestamp without time zone) RETURNS date LANGUAGE plpgsql AS $f$ BEGIN RETURN b::date; END $f$;
+CREATE FUNCTION trg() RETURNS trigger LANGUAGE plpgsql AS $$ BEGIN RETURN NEW; END $$;
+CREATE FUNCTION srf(n int) RETURNS SETOF int LANGUAGE plpgsql AS $$ BEGIN RETURN; END $$;
+CREATE FUNCTION dur(i interval, type text) RETURNS numeric(10,2) LANGUAGE plpgsql AS $$ BEGIN RETURN 1; END $$;
+CREATE FUNCTION sqlf(i int) RETURNS int LANGUAGE sql AS $$ SELECT 1 $$;
+`
+
+func TestReadDumpFunctions(t *testing.T) {
+	var got []string
+	for _, f := range readDumpFunctions(migrateDump) {
+		got = append(got, f.Name+"("+f.Arguments+") "+f.Result)
+	}
+	want := []string{
+		"add_one(x integer, y integer DEFAULT 1) integer",
+		"Mixed(a text, b timestamp without time zone) date",
+		"trg() trigger",
+		"srf(n int) SETOF int",
+		"dur(i interval, type text) numeric(10,2)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readDumpFunctions:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if f := readDumpFunctions(migrateDump)[0]; f.Source != " BEGIN RETURN x + y; END " {
+		t.Errorf("source of add_one %q", f.Source)
+	}
+}
+
+func TestGoType(t *testing.T) {
+	tests := []struct {
+		sqlType, want string
+	}{
+		{"integer", "int32"},
+		{"pg_catalog.int8", "int64"},
+		{"character varying(20)", "string"},
+		{"Double Precision", "float64"},
+		{"text[]", "[]string"},
+		{"bytea", "[]byte"},
+		{"bytea[]", "[][]byte"},
+		{"timestamp without time zone", "time.Time"},
+		{"interval", "time.Duration"},
+		{"point", ""},
+		{"public.my_type", ""},
+	}
+	for _, test := range tests {
+		if got := goType(test.sqlType); got != test.want {
+			t.Errorf("goType(%q) = %q, want %q", test.sqlType, got, test.want)
+		}
+	}
+}
+
+func TestWriteStubs(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+		//contains are the lines expected in the stubs
+		contains []string
+	}{
+		{
+			name: "dump",
+			dump: migrateDump,
+			contains: []string{
+				"//plgo:name add_one\n//plgo:default y=1\nfunc AddOne(x int32, y int32) int32 {",
+				"//plgo:name \"Mixed\"\n//plgo:time b=timestamp,return=date\nfunc Mixed(a string, b time.Time) time.Time {",
+				"func Trg(td *plgo.TriggerData) *plgo.TriggerRow {",
+				"type SrfRow struct {\n\tSrf int32 `plgo:\"srf\"`\n}",
+				"func Srf(n int32) []SrfRow {\n",
+				"func Dur(i time.Duration, type_ string) plgo.Numeric {",
+				"\t\"time\"\n\n\t\"github.com/algonode/plgo\"\n",
+				"BEGIN RETURN x + y; END",
+			},
+		},
+		{
+			name: "renamed and overloaded",
+			dump: "CREATE FUNCTION get_user(id bigint) RETURNS text LANGUAGE plpgsql AS $$ BEGIN RETURN ''; END $$;\n" +
+				"CREATE FUNCTION get_user(name text) RETURNS text LANGUAGE plpgsql AS $$ BEGIN RETURN ''; END $$;\n",
+			contains: []string{
+				"//plgo:name get_user\nfunc GetUser(id int64) string {",
+				"//plgo:name get_user\nfunc GetUser2(name string) string {",
+			},
+		},
+		{
+			name: "names folded to lower case",
+			dump: "CREATE FUNCTION GetUser(id bigint) RETURNS text LANGUAGE plpgsql AS $$ BEGIN RETURN ''; END $$;\n" +
+				"CREATE FUNCTION \"GetUser\"(name text) RETURNS text LANGUAGE plpgsql AS $$ BEGIN RETURN ''; END $$;\n",
+			contains: []string{
+				"function getuser(id bigint)\nfunc Getuser(id int64) string {",
+				"//plgo:name \"GetUser\"\nfunc GetUser(name string) string {",
+			},
+		},
+		{
+			name: "RETURNS TABLE",
+			dump: "CREATE FUNCTION list_users(since timestamptz) RETURNS TABLE(id bigint, \"Name\" text, tags text[])\n" +
+				"    LANGUAGE plpgsql AS $$ BEGIN RETURN QUERY SELECT 1, '', '{}'; END $$;\n" +
+				"CREATE FUNCTION days() RETURNS TABLE(day date) LANGUAGE plpgsql AS $$ BEGIN END $$;\n",
+			contains: []string{
+				"type ListUsersRow struct {\n\tId   int64    `plgo:\"id\"`\n\tName string   `plgo:\"\\\"Name\\\"\"`\n\tTags []string `plgo:\"tags\"`\n}",
+				"func ListUsers(since time.Time) []ListUsersRow {",
+				"\treturn nil\n",
+				"//  days(): column day type date, the time columns of the rows are timestamp with time zone",
+			},
+		},
+		{
+			name: "defaults",
+			dump: "CREATE FUNCTION f(a text DEFAULT 'x'::text, b numeric DEFAULT 1.5, c int DEFAULT (-1)) RETURNS void LANGUAGE plpgsql AS $$ BEGIN END $$;\n" +
+				"CREATE FUNCTION g(a int DEFAULT 1, b timestamptz DEFAULT now(), c int DEFAULT 2) RETURNS void LANGUAGE plpgsql AS $$ BEGIN END $$;\n",
+			contains: []string{
+				"//plgo:default a='x' b='1.5' c=-1\nfunc F(",
+				"//plgo:default c=2\nfunc G(",
+				"TODO: the callers must pass the dropped defaults that aren't SQL literals or precede one: a DEFAULT 1, b DEFAULT now()",
+			},
+		},
+		{
+			name:     "Go keywords and unnamed arguments",
+			dump:     "CREATE FUNCTION f(type text, integer) RETURNS void LANGUAGE plpgsql AS $$ BEGIN END $$;\n",
+			contains: []string{"func F(type_ string, arg2 int32) {"},
+		},
+		{
+			name:     "unsupported type",
+			dump:     "CREATE FUNCTION f(p point) RETURNS void LANGUAGE plpgsql AS $$ BEGIN END $$;\n",
+			contains: []string{"//  f(p point): argument type point"},
+		},
+		{
+			name:     "OUT arguments",
+			dump:     "CREATE FUNCTION f(IN a text, OUT b text) RETURNS text LANGUAGE plpgsql AS $$ BEGIN END $$;\n",
+			contains: []string{"//  f(IN a text, OUT b text): OUT arguments are not supported"},
+		},
+	}
+	for _, test := range tests {
+		var stubs bytes.Buffer
+		if err := WriteStubs(readDumpFunctions(test.dump), &stubs); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		for _, line := range test.contains {
+			if !strings.Contains(stubs.String(), line) {
+				t.Errorf("%s: the stubs don't contain %q:\n%s", test.name, line, stubs.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//modFile is the part of go.mod and go.work read by plgo, the output of go mod edit -json and go work edit -json
+type modFile struct {
+	Go      string
+	Use     []struct{ DiskPath string }
+	Replace []struct{ Old, New modVersion }
+}
+
+//modVersion is an module path with an optional version, the version of an local replacement is empty
+type modVersion struct {
+	Path, Version string
+}
+
+func (v modVersion) String() string {
+	if v.Version == "" {
+		return v.Path
+	}
+	return v.Path + " " + v.Version
+}
+
+//readModFile reads the go.mod or go.work file, kind is mod or work
+func readModFile(kind, path string) (*modFile, error) {
+	out, err := exec.Command("go", kind, "edit", "-json", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read %s: %w", path, err)
+	}
+	file := new(modFile)
+	if err = json.Unmarshal(out, file); err != nil {
+		return nil, fmt.Errorf("Cannot parse %s: %w", path, err)
+	}
+	return file, nil
+}
+
+//localReplacements returns the replace directives of the file with the relative local paths resolved against dir
+func (f *modFile) localReplacements(dir string) []struct{ Old, New modVersion } {
+	var replacements []struct{ Old, New modVersion }
+	for _, r := range f.Replace {
+		if r.New.Version == "" && !filepath.IsAbs(r.New.Path) {
+			r.New.Path = filepath.Join(dir, r.New.Path)
+			replacements = append(replacements, r)
+		}
+	}
+	return replacements
+}
+
+//mirrorGoMod points the relative replace directives of the go.mod copied into the temporary module
+//to the directories of the original module
+func mirrorGoMod(root, temp string) error {
+	goMod := filepath.Join(temp, "go.mod")
+	if _, err := os.Stat(goMod); err != nil {
+		return nil
+	}
+	file, err := readModFile("mod", goMod)
+	if err != nil {
+		return err
+	}
+	replacements := file.localReplacements(root)
+	if len(replacements) == 0 {
+		return nil
+	}
+	args := []string{"mod", "edit"}
+	for _, r := range replacements {
+		old := r.Old.Path
+		if r.Old.Version != "" {
+			old += "@" + r.Old.Version
+		}
+		args = append(args, "-replace="+old+"="+r.New.Path)
+	}
+	if out, err := exec.Command("go", append(args, goMod)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("Cannot edit %s: %s %s", goMod, err, out)
+	}
+	return nil
+}
+
+//mirrorGoWork writes go.work of the temporary module with the modules and the replace directives of the workspace,
+//the module of the package is replaced by its copy. It returns the path of the written go.work
+func mirrorGoWork(goWork, root, temp string) (string, error) {
+	file, err := readModFile("work", goWork)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(goWork)
+	//the paths are quoted, they can contain spaces
+	work := "go " + file.Go + "\n\nuse (\n\t" + strconv.Quote(temp) + "\n"
+	for _, use := range file.Use {
+		path := use.DiskPath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if path != root {
+			work += "\t" + strconv.Quote(path) + "\n"
+		}
+	}
+	work += ")\n"
+	for _, r := range file.Replace {
+		if r.New.Version == "" {
+			if !filepath.IsAbs(r.New.Path) {
+				r.New.Path = filepath.Join(dir, r.New.Path)
+			}
+			r.New.Path = strconv.Quote(r.New.Path)
+		}
+		work += "\nreplace " + r.Old.String() + " => " + r.New.String()
+	}
+	path := filepath.Join(temp, "go.work")
+	return path, ioutil.WriteFile(path, []byte(work+"\n"), 0644)
+}
+
+//packageModule returns the root directory of the module of the package, "" if the package isn't in an module
+func packageModule(packagePath string) (string, error) {
+	root, err := moduleRoot(packagePath)
+	if err != nil {
+		return "", err
+	}
+	if _, err = os.Stat(filepath.Join(root, "go.mod")); err != nil {
+		return "", nil
+	}
+	return root, nil
+}
+
+//copyModuleTree copies the module of the package into the temporary directory, so the package can import
+//its subpackages, the internal ones too, and its dependencies are resolved by the go.mod and go.sum of the module.
+//The Go packages of the module are copied with their other files (cgo, embedded files), the vendor directory too,
+//without the tests, the hidden directories, testdata and the nested modules. The files of the package
+//are replaced by the generated package, it returns its directory in the copy
+func copyModuleTree(root, packagePath, temp string) (string, error) {
+	absPackage, err := filepath.Abs(packagePath)
+	if err != nil {
+		return "", err
+	}
+	relPackage, err := filepath.Rel(root, absPackage)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{"go.mod", "go.sum"} {
+		if err = copyFile(filepath.Join(root, name), filepath.Join(temp, name)); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	vendor := filepath.Join(root, "vendor")
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		name := info.Name()
+		if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata") {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil && path != root {
+			return filepath.SkipDir
+		}
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		isVendor := path == vendor || strings.HasPrefix(path, vendor+string(filepath.Separator))
+		hasGo := false
+		for _, file := range files {
+			hasGo = hasGo || (!file.IsDir() && strings.HasSuffix(file.Name(), ".go"))
+		}
+		if !hasGo && !isVendor {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			name := file.Name()
+			switch {
+			case !file.Mode().IsRegular(), strings.HasSuffix(name, "_test.go"), path == root && (name == "go.mod" || name == "go.sum"):
+				continue
+			case path == absPackage && strings.HasSuffix(name, ".go"):
+				//the files of the package are written into the generated package by writeUserPackage
+				continue
+			}
+			if err = copyFile(filepath.Join(path, name), filepath.Join(temp, rel, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	tempPackage := filepath.Join(temp, relPackage)
+	return tempPackage, os.MkdirAll(tempPackage, 0755)
+}
+
+//copyFile copies the file, the directory of the copy is created
+func copyFile(source, target string) error {
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(target, data, 0644)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+//moduleFiles is the tree of an module with the extension package ext
+var moduleFiles = map[string]string{
+	"go.mod":                         "module example.com/ext\n\ngo 1.20\n",
+	"go.sum":                         "",
+	"README.md":                      "",
+	"ext/ext.go":                     extensionSource,
+	"ext/ext_test.go":                "package main\n",
+	"ext/helper.c":                   "int helper() { return 1; }\n",
+	"internal/util/util.go":          "package util\n",
+	"internal/util/util_test.go":     "package util\n",
+	"internal/util/data.txt":         "embedded",
+	"docs/index.md":                  "",
+	".git/hooks/hook.go":             "package hooks\n",
+	"testdata/fixture.go":            "package fixture\n",
+	"_tools/tool.go":                 "package tools\n",
+	"nested/go.mod":                  "module example.com/nested\n",
+	"nested/nested.go":               "package nested\n",
+	"vendor/modules.txt":             "# example.com/dep v1.0.0\n",
+	"vendor/example.com/dep/a.go":    "package dep\n",
+	"vendor/example.com/dep/LICENSE": "",
+}
+
+//treeFiles returns the slash separated paths of the files in the directory
+func treeFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestPackageModule(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, moduleFiles)
+	noModule := t.TempDir()
+	writeFiles(t, noModule, map[string]string{"ext/ext.go": extensionSource})
+	tests := []struct {
+		packagePath, want string
+	}{
+		{filepath.Join(dir, "ext"), dir},
+		{dir, dir},
+		{filepath.Join(dir, "nested"), filepath.Join(dir, "nested")},
+		{filepath.Join(noModule, "ext"), ""},
+	}
+	for _, test := range tests {
+		if root, err := packageModule(test.packagePath); root != test.want || err != nil {
+			t.Errorf("packageModule(%s) = %s, %v, want %s", test.packagePath, root, err, test.want)
+		}
+	}
+}
+
+func TestCopyModuleTree(t *testing.T) {
+	root, temp := t.TempDir(), t.TempDir()
+	writeFiles(t, root, moduleFiles)
+	tempPackage, err := copyModuleTree(root, filepath.Join(root, "ext"), temp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tempPackage != filepath.Join(temp, "ext") {
+		t.Errorf("the package is copied into %s", tempPackage)
+	}
+	want := []string{
+		"ext/helper.c",
+		"go.mod",
+		"go.sum",
+		"internal/util/data.txt",
+		"internal/util/util.go",
+		"vendor/example.com/dep/LICENSE",
+		"vendor/example.com/dep/a.go",
+		"vendor/modules.txt",
+	}
+	if files := treeFiles(t, temp); !reflect.DeepEqual(files, want) {
+		t.Errorf("copied files %q, want %q", files, want)
+	}
+}
+
+func TestMirrorGoMod(t *testing.T) {
+	root, temp := t.TempDir(), t.TempDir()
+	goMod := "module example.com/ext\n\ngo 1.20\n\n" +
+		"replace example.com/lib => ../lib\n\n" +
+		"replace example.com/tool v1.0.0 => ./tools/tool\n\n" +
+		"replace example.com/dep => example.com/fork v1.2.0\n\n" +
+		"replace example.com/abs => " + filepath.Join(root, "abs") + "\n"
+	writeFiles(t, root, map[string]string{"go.mod": goMod})
+	writeFiles(t, temp, map[string]string{"go.mod": goMod})
+	if err := mirrorGoMod(root, temp); err != nil {
+		t.Fatal(err)
+	}
+	file, err := readModFile("mod", filepath.Join(temp, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"example.com/lib":         filepath.Join(filepath.Dir(root), "lib"),
+		"example.com/tool v1.0.0": filepath.Join(root, "tools", "tool"),
+		"example.com/dep":         "example.com/fork v1.2.0",
+		"example.com/abs":         filepath.Join(root, "abs"),
+	}
+	got := make(map[string]string)
+	for _, r := range file.Replace {
+		got[r.Old.String()] = r.New.String()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replace directives of the copy %q, want %q", got, want)
+	}
+	if err := mirrorGoMod(root, t.TempDir()); err != nil {
+		t.Errorf("mirrorGoMod without go.mod: %s", err)
+	}
+}
+
+func TestMirrorGoWork(t *testing.T) {
+	workspace, temp := t.TempDir(), t.TempDir()
+	writeFiles(t, workspace, map[string]string{
+		"go.work":    "go 1.21\n\nuse (\n\t./ext\n\t./lib\n)\n\nreplace example.com/dep => ./dep\n\nreplace example.com/old v1.0.0 => example.com/new v1.1.0\n",
+		"ext/go.mod": "module example.com/ext\n\ngo 1.20\n",
+		"lib/go.mod": "module example.com/lib\n\ngo 1.20\n",
+	})
+	path, err := mirrorGoWork(filepath.Join(workspace, "go.work"), filepath.Join(workspace, "ext"), temp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(temp, "go.work") {
+		t.Errorf("go.work is written into %s", path)
+	}
+	file, err := readModFile("work", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uses []string
+	for _, use := range file.Use {
+		uses = append(uses, use.DiskPath)
+	}
+	if want := []string{temp, filepath.Join(workspace, "lib")}; file.Go != "1.21" || !reflect.DeepEqual(uses, want) {
+		t.Errorf("go.work of the copy: go %s, use %q, want %q", file.Go, uses, want)
+	}
+	var replacements []string
+	for _, r := range file.Replace {
+		replacements = append(replacements, r.Old.String()+" => "+r.New.String())
+	}
+	want := []string{"example.com/dep => " + filepath.Join(workspace, "dep"), "example.com/old v1.0.0 => example.com/new v1.1.0"}
+	if !reflect.DeepEqual(replacements, want) {
+		t.Errorf("go.work of the copy: replace %q, want %q", replacements, want)
+	}
+}
@@ -7,14 +7,17 @@ import (
 	"go/build"
 	"go/format"
 	"go/parser"
+	"go/printer"
 	"go/token"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-
-	"golang.org/x/mod/modfile"
 )
 
 //ToUnexported changes Exported function name to unexported
@@ -25,58 +28,251 @@ func ToUnexported(name string) string {
 //ModuleWriter writes the tmp module wrapper that will be build to shared object
 type ModuleWriter struct {
 	PackageName string
-	Doc         string
-	fset        *token.FileSet
-	packageAst  *ast.Package
-	functions   []CodeWriter
+	//Version is the version of the extension, the default_version of the control file
+	Version      string
+	Doc          string
+	path         string
+	fset         *token.FileSet
+	packageAst   *ast.Package
+	functions    []CodeWriter
+	files        []string
+	capabilities *CapabilityVisitor
+	//BuildTags select the files of the package (plgo -tags) and of the runtime, e.g. plgo_restricted,
+	//go build gets them too
+	BuildTags []string
+	//ServerVersion is the major version of the target PostgreSQL, 0 if unknown
+	ServerVersion int
+	//Trusted allows non-superusers with CREATE privilege on the database to install the extension
+	Trusted bool
+	//Schema is the schema of the SQL objects, declared in the control file, "" for an relocatable extension
+	Schema string
+	//Regress scaffolds the pg_regress test of the package and enables REGRESS in the Makefile
+	Regress bool
+	//config is plgo.toml of the package
+	config *Config
+	codecs bool
+	//tempPath is the temporary directory of WriteModule, goDir and goEnv the directory and the environment of the go build
+	tempPath, goDir string
+	goEnv           []string
+	//unlock releases the lock of tempPath
+	unlock func()
 }
 
-//NewModuleWriter parses the go package and returns the FileSet and AST
-func NewModuleWriter(packagePath string) (*ModuleWriter, error) {
+//NewModuleWriter parses the go package and returns the FileSet and AST, the files of the package
+//are selected by their build constraints with the build tags
+func NewModuleWriter(packagePath string, buildTags ...string) (*ModuleWriter, error) {
 	fset := token.NewFileSet()
+	//the files are parsed with their absolute paths, the //line directives of the generated package refer to them
+	absPackagePath, err := filepath.Abs(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	//the go command ignores the build constraints of the files listed on the command line,
+	//so the files of the package are selected with the build tags here
+	buildContext := build.Default
+	buildContext.BuildTags = buildTags
+	buildContext.CgoEnabled = true
 	// skip _test files in current package
 	filtertestfiles := func(fi os.FileInfo) bool {
 		if strings.HasSuffix(fi.Name(), "_test.go") {
 			return false
 		}
-		return true
+		match, err := buildContext.MatchFile(absPackagePath, fi.Name())
+		return err == nil && match
 	}
 
-	f, err := parser.ParseDir(fset, packagePath, filtertestfiles, parser.ParseComments)
+	f, err := parser.ParseDir(fset, absPackagePath, filtertestfiles, parser.ParseComments)
 	if err != nil {
 		return nil, fmt.Errorf("Cannot parse package: %w", err)
 	}
 	if len(f) > 1 {
 		return nil, fmt.Errorf("More than one package in %s", packagePath)
 	}
-	packageAst, ok := f["main"]
-	if !ok {
-		return nil, fmt.Errorf("No package main in %s", packagePath)
+	var packageAst *ast.Package
+	for _, p := range f {
+		packageAst = p
+	}
+	if packageAst == nil {
+		return nil, fmt.Errorf("No Go package in %s", packagePath)
+	}
+	//an library package is compiled as the main package of the shared object, so it stays importable
+	//and testable as an regular Go package
+	if packageAst.Name != "main" {
+		for name, file := range packageAst.Files {
+			if file.Scope.Lookup("main") != nil {
+				return nil, fmt.Errorf("%s: main is declared by the plgo runtime, rename it", name)
+			}
+		}
+		packageAst.Name = "main"
+	}
+	config, err := ReadConfig(packagePath)
+	if err != nil {
+		return nil, err
 	}
 	var packageDoc string
+	version := "0.1"
 	for _, packageFile := range packageAst.Files {
 		packageDoc += packageFile.Doc.Text() + "\n"
+		//the version can be declared in the package doc comment with //plgo:version 0.2
+		if versions := docDirectives(packageFile.Doc)["version"]; len(versions) > 0 {
+			version = versions[0]
+		}
+	}
+	if config.Version != "" {
+		version = config.Version
+	}
+	defaultAttributes = config.Attributes
+	functionNaming = config.Naming
+	defaultGrants = config.Grants
+	//the pg_config of the built PostgreSQL version of plgo build -pg is kept
+	if pgConfig == "" {
+		pgConfig = config.PgConfig
+	}
+	//collect functions from the package,
+	//the capabilities are collected first, FuncVisitor renames the exported functions
+	capabilities := NewCapabilityVisitor(fset, packageAst)
+	composites, err := compositeTypes(packageAst)
+	if err != nil {
+		return nil, err
 	}
-	//collect functions from the package
-	funcVisitor := new(FuncVisitor)
+	structs := packageStructs(packageAst)
+	funcVisitor := &FuncVisitor{capabilities: capabilities, structs: structs, composites: composites}
 	ast.Walk(funcVisitor, packageAst)
 	if funcVisitor.err != nil {
 		return nil, funcVisitor.err
 	}
-	absPackagePath, err := filepath.Abs(packagePath)
+	if err = bindOperatorClasses(funcVisitor.functions); err != nil {
+		return nil, err
+	}
+	aggregates, err := packageAggregates(packageAst, structs, composites)
 	if err != nil {
 		return nil, err
 	}
 	packageName := filepath.Base(absPackagePath)
-	return &ModuleWriter{PackageName: packageName, Doc: packageDoc, fset: fset, packageAst: packageAst, functions: funcVisitor.functions}, nil
+	if config.Name != "" {
+		packageName = config.Name
+	}
+	//the name is written unquoted into the scripts, the control file and the Makefile
+	if !extensionNameRe.MatchString(packageName) {
+		return nil, fmt.Errorf("Extension name %s must be lowercase letters, digits and underscores, starting with an letter, rename the directory or set the name in %s", packageName, configFile)
+	}
+	functions := append(funcVisitor.functions, aggregates...)
+	//the types are sorted by name, the functions using them are created after them
+	typeNames := make([]string, 0, len(composites))
+	for name := range composites {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+	for _, name := range typeNames {
+		functions = append(functions, composites[name])
+	}
+	functions = append(functions, builtinFunctions(packageName)...)
+	if startsGoroutines(packageAst) {
+		functions = append(functions, goroutinesFunction(packageName))
+	}
+	if usesPlgo(packageAst, "SharedCache") {
+		functions = append(functions, cacheFunctions(packageName)...)
+	}
+	if usesPlgo(packageAst, "NewRateLimiter") {
+		functions = append(functions, rateLimitFunctions(packageName)...)
+	}
+	if usesPlgo(packageAst, "RegisterJob") {
+		functions = append(functions, jobObjects(packageName)...)
+	}
+	if usesPlgo(packageAst, "NewQueue") {
+		functions = append(functions, queueObjects(packageName)...)
+	}
+	mw := &ModuleWriter{PackageName: packageName, Version: version, Doc: packageDoc, path: packagePath, fset: fset, packageAst: packageAst, BuildTags: buildTags,
+		functions: functions, capabilities: capabilities, config: config, Trusted: config.Trusted}
+	if err = mw.SetSchema(config.Schema); err != nil {
+		return nil, err
+	}
+	if config.Codecs {
+		mw.EnableCodecs()
+	}
+	return mw, nil
+}
+
+//CheckRestricted returns an error listing the file system and network access of the package
+func (mw *ModuleWriter) CheckRestricted() error {
+	if uses := mw.capabilities.Restricted(); len(uses) > 0 {
+		return fmt.Errorf("Package uses restricted functionality:\n%s", strings.Join(uses, "\n"))
+	}
+	return nil
+}
+
+//EnableCodecs adds the opt-in codec module, its runtime file is selected by the plgo_codecs build tag
+func (mw *ModuleWriter) EnableCodecs() {
+	if mw.codecs {
+		return
+	}
+	mw.codecs = true
+	mw.BuildTags = append(mw.BuildTags, "plgo_codecs")
+	mw.functions = append(mw.functions, codecFunctions(mw.PackageName)...)
+}
+
+//codecModules are the modules of the zstd and lz4 codecs, the module of the package built with the codecs must require them
+var codecModules = []string{"github.com/klauspost/compress", "github.com/pierrec/lz4/v4"}
+
+//checkCodecModules returns an error if the module of the package, root ("" without module), doesn't require the codec modules,
+//goDir and env are the directory and the additional environment variables of the go command building the module
+func checkCodecModules(root, goDir string, env []string) error {
+	modules := strings.Join(codecModules, " ")
+	if root == "" {
+		return fmt.Errorf("The codecs need the modules %s, run go mod init and go get %s in the directory of the package", modules, modules)
+	}
+	var missing []string
+	for _, module := range codecModules {
+		goList := exec.Command("go", "list", "-m", module)
+		goList.Dir = goDir
+		goList.Env = append(os.Environ(), env...)
+		debugCommand(goList, env)
+		if err := goList.Run(); err != nil {
+			missing = append(missing, module)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("The module %s doesn't require the codec modules %s, run go get %s in it", root, strings.Join(missing, " "), strings.Join(missing, " "))
+	}
+	return nil
 }
 
 //WriteModule writes the tmp module wrapper
 func (mw *ModuleWriter) WriteModule() (string, error) {
-	tempPackagePath, err := buildPath()
+	mw.ReleaseModule()
+	tempPath, unlock, err := buildPath(mw.path, mw.BuildTags)
 	if err != nil {
 		return "", fmt.Errorf("Cannot get tempdir: %w", err)
 	}
+	mw.tempPath, mw.goDir, mw.goEnv, mw.unlock = tempPath, "", nil, unlock
+	tempPackagePath := tempPath
+	//the module of the package is copied with its go.mod, the go command runs in the copy.
+	//In an workspace the go.work of the copy uses the other modules of the workspace
+	root, err := packageModule(mw.path)
+	if err != nil {
+		return "", err
+	}
+	if root != "" {
+		if tempPackagePath, err = copyModuleTree(root, mw.path, tempPath); err != nil {
+			return "", fmt.Errorf("Cannot copy the module %s: %w", root, err)
+		}
+		if err = mirrorGoMod(root, tempPath); err != nil {
+			return "", err
+		}
+		if gowork := goWork(); gowork != "" {
+			tempGoWork, err := mirrorGoWork(gowork, root, tempPath)
+			if err != nil {
+				return "", err
+			}
+			mw.goEnv = []string{"GOWORK=" + tempGoWork}
+		}
+		mw.goDir = tempPackagePath
+	}
+	if mw.codecs {
+		if err = checkCodecModules(root, mw.goDir, mw.goEnv); err != nil {
+			return "", err
+		}
+	}
 	err = mw.writeUserPackage(tempPackagePath)
 	if err != nil {
 		return "", err
@@ -92,117 +288,126 @@ func (mw *ModuleWriter) WriteModule() (string, error) {
 	return tempPackagePath, nil
 }
 
-func (mw *ModuleWriter) writeUserPackage(tempPackagePath string) error {
-	ast.Walk(new(Remover), mw.packageAst)
-	packageFile, err := os.Create(filepath.Join(tempPackagePath, "package.go"))
-	if err != nil {
-		return fmt.Errorf("Cannot write file tempdir: %w", err)
-	}
-	if err = format.Node(packageFile, mw.fset, ast.MergePackageFiles(mw.packageAst, ast.FilterFuncDuplicates)); err != nil {
-		return fmt.Errorf("Cannot format package %w", err)
-	}
-	err = packageFile.Close()
-	if err != nil {
-		return fmt.Errorf("Cannot write file tempdir: %w", err)
-	}
-	return nil
+//Files returns the names of the go files written by WriteModule
+func (mw *ModuleWriter) Files() []string {
+	return mw.files
 }
 
-func versionInfo(mod string) (string, error) {
-	gomod, err := ioutil.ReadFile("go.mod")
-	if os.IsNotExist(err) {
-		return "", fmt.Errorf("go.mod is missing. Please run go mod init")
-	} else if err != nil {
-		return "", err
-	}
-	moddata, err := modfile.Parse("go.mod", gomod, nil)
-	if err != nil {
-		return "", err
-	}
-	for _, req := range moddata.Require {
-		if req.Mod.Path == mod {
-			return req.Mod.Version, nil
-		}
+//TempPath returns the temporary directory of the module written by WriteModule
+func (mw *ModuleWriter) TempPath() string {
+	return mw.tempPath
+}
+
+//ReleaseModule releases the lock of the temporary module written by WriteModule, after its build.
+//The module stays in the build cache until the next build of the package
+func (mw *ModuleWriter) ReleaseModule() {
+	if mw.unlock != nil {
+		mw.unlock()
+		mw.unlock = nil
 	}
-	return "", fmt.Errorf("Cannot find %s in go.mod", mod)
 }
 
-func readPlGoSource() ([]byte, error) {
-	var found string
-	goPath := os.Getenv("GOPATH")
-	if goPath == "" {
-		goPath = build.Default.GOPATH // Go 1.8 and later have a default GOPATH
-	}
-	for _, goPathElement := range filepath.SplitList(goPath) {
-		path := filepath.Join(goPathElement, "src", "github.com", "algonode", "plgo", "pl.go")
-		if _, err := os.Stat(path); err == nil {
-			found = path
-			break
-		}
+//GoEnv returns the environment variables of the go command building the module written by WriteModule,
+//GOWORK of the copied module in an workspace
+func (mw *ModuleWriter) GoEnv() []string {
+	return mw.goEnv
+}
+
+//GoDir returns the directory of the go command building the module written by WriteModule,
+//"" for the current directory
+func (mw *ModuleWriter) GoDir() string {
+	return mw.goDir
+}
+
+//userFilePrinter prints the files of the package with the //line directives of their positions,
+//so the compiler errors and the panics refer to the lines of the package files
+var userFilePrinter = &printer.Config{Mode: printer.UseSpaces | printer.TabIndent | printer.SourcePos, Tabwidth: 8}
+
+//writeUserPackage writes the files of the package without the plgo usages into the temporary module, the files
+//are prefixed with package_ so they don't collide with the runtime files, the build constraints are kept
+func (mw *ModuleWriter) writeUserPackage(tempPackagePath string) error {
+	ast.Walk(new(Remover), mw.packageAst)
+	paths := make([]string, 0, len(mw.packageAst.Files))
+	for path := range mw.packageAst.Files {
+		paths = append(paths, path)
 	}
-	if found == "" {
-		version, err := versionInfo("github.com/algonode/plgo")
+	sort.Strings(paths)
+	for _, path := range paths {
+		file := mw.packageAst.Files[path]
+		file.Name.Name = mw.packageAst.Name
+		name := "package_" + filepath.Base(path)
+		mw.files = append(mw.files, name)
+		packageFile, err := os.Create(filepath.Join(tempPackagePath, name))
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("Cannot write file tempdir: %w", err)
 		}
-		pathEnd := filepath.Join("pkg", "mod", "github.com", "algonode", "plgo@"+version, "pl.go")
-		cache, ok := os.LookupEnv("GOMODCACHE")
-		if ok {
-			path := filepath.Join(cache, pathEnd)
-			if _, err := os.Stat(path); err == nil {
-				found = path
-			}
+		if err = userFilePrinter.Fprint(packageFile, mw.fset, file); err != nil {
+			packageFile.Close()
+			return fmt.Errorf("Cannot format package %w", err)
 		}
-		if found == "" {
-			for _, goPathElement := range filepath.SplitList(goPath) {
-				path := filepath.Join(goPathElement, pathEnd)
-				if _, err := os.Stat(path); err == nil {
-					found = path
-					break
-				}
-			}
+		if err = packageFile.Close(); err != nil {
+			return fmt.Errorf("Cannot write file tempdir: %w", err)
 		}
 	}
-	if found != "" {
-		rv, err := ioutil.ReadFile(found)
-		if err == nil {
-			return rv, nil
-		} else {
-			return nil, fmt.Errorf("Cannot read plgo package: %w", err)
-		}
-	}
-	return nil, fmt.Errorf("Package github.com/algonode/plgo not installed\nplease install it with: go get -u github.com/algonode/plgo/plgo")
+	return nil
+}
+
+//toMainPackage changes the package clause of a plgo runtime file to package main
+func toMainPackage(source []byte) string {
+	return strings.Replace(string(source), "package plgo", "package main", 1)
 }
 
 func (mw *ModuleWriter) writeplgo(tempPackagePath string) error {
-	plgoSourceBin, err := readPlGoSource()
+	sources, err := readPlGoSources(mw.BuildTags)
 	if err != nil {
 		return err
 	}
-	plgoSource := string(plgoSourceBin)
-	plgoSource = "package main\n\n" + plgoSource[12:]
-	postgresIncludeDir, err := exec.Command("pg_config", "--includedir-server").CombinedOutput()
+	for name, source := range sources {
+		if name == "pl.go" {
+			continue
+		}
+		err = ioutil.WriteFile(filepath.Join(tempPackagePath, name), []byte(toMainPackage(source)), 0644)
+		if err != nil {
+			return fmt.Errorf("Cannot write file tempdir: %w", err)
+		}
+		mw.files = append(mw.files, name)
+	}
+	plgoSource := toMainPackage(sources["pl.go"])
+	pg, err := detectInstallation()
 	if err != nil {
-		return fmt.Errorf("Cannot run pg_config: %w", err)
+		return err
+	}
+	platform := currentPlatform()
+	directives := platform.cgoDirectives(pg, tempPackagePath)
+	debugf("cgo directives of pl.go:\n%s", directives)
+	plgoSource = setCgoDirectives(plgoSource, directives)
+	if err = platform.prepare(pg, tempPackagePath); err != nil {
+		return err
 	}
-	postgresIncludeStr := getcorrectpath(string(postgresIncludeDir)) // corrects 8.3 filenames on windows
-	plgoSource = strings.Replace(plgoSource, "/usr/include/postgresql/server", postgresIncludeStr, 1)
-
-	addOtherIncludesAndLDFLAGS(&plgoSource, postgresIncludeStr) // on mingw windows workarounds
 
 	var funcdec string
+	declared := make(map[string]bool)
 	for _, f := range mw.functions {
-		funcdec += f.FuncDec()
+		//overloaded builtin functions share the symbol
+		if dec := f.FuncDec(); !declared[dec] {
+			declared[dec] = true
+			funcdec += dec
+		}
 	}
 	plgoSource = strings.Replace(plgoSource, "//{funcdec}", funcdec, 1)
 	err = ioutil.WriteFile(filepath.Join(tempPackagePath, "pl.go"), []byte(plgoSource), 0644)
 	if err != nil {
 		return fmt.Errorf("Cannot write file tempdir: %w", err)
 	}
+	mw.files = append(mw.files, "pl.go")
 	return nil
 }
 
 func (mw *ModuleWriter) writeExportedMethods(tempPackagePath string) error {
+	wrappers := bytes.NewBuffer(nil)
+	for _, f := range mw.functions {
+		f.Code(wrappers)
+	}
 	buf := bytes.NewBuffer(nil)
 	_, err := buf.WriteString(`package main
 
@@ -217,60 +422,269 @@ import "C"
 	if err != nil {
 		return fmt.Errorf("Cannot write file tempdir: %w", err)
 	}
-	for _, f := range mw.functions {
-		f.Code(buf)
+	//the packages of the parameter and result types, e.g. time
+	for _, path := range typeImports(wrappers.String()) {
+		buf.WriteString("import " + strconv.Quote(path) + "\n")
 	}
-	//fmt.Println(buf.String())
+	buf.WriteString(`
+func init() {
+	extensionName = "` + mw.PackageName + `"
+}
+`)
+	buf.Write(wrappers.Bytes())
 	code, err := format.Source(buf.Bytes())
 	if err != nil {
+		//the unformatted wrappers are logged for finding the invalid generated code
+		debugf("methods.go:\n%s", buf.Bytes())
 		return err
 	}
 	err = ioutil.WriteFile(filepath.Join(tempPackagePath, "methods.go"), code, 0644)
 	if err != nil {
 		return fmt.Errorf("Cannot write file tempdir: %w", err)
 	}
+	mw.files = append(mw.files, "methods.go")
+	return nil
+}
+
+//WriteExtensionFiles writes the files installing the extension next to the shared object:
+//the SQL script, the control file, the upgrade scripts, the manifest, the Makefile and the pg_regress test
+func (mw *ModuleWriter) WriteExtensionFiles(path string) error {
+	if err := checkServerVersion(mw.ServerVersion, mw.serverFeatures()); err != nil {
+		return err
+	}
+	if mw.Regress {
+		if err := mw.ScaffoldRegressTest(); err != nil {
+			return err
+		}
+	}
+	writers := []func(string) error{mw.WriteSQL, mw.WriteControl, mw.WriteUpgradeScripts, mw.WriteManifest, mw.WriteMakefile, mw.WriteRegressTest}
+	for _, write := range writers {
+		if err := write(path); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+//SetSchema sets the schema of the SQL objects, the schemas of PostgreSQL (pg_*) can't be used
+func (mw *ModuleWriter) SetSchema(schema string) error {
+	if strings.HasPrefix(strings.ToLower(schema), "pg_") {
+		return fmt.Errorf("Schema %s: the pg_ prefix is reserved for the system schemas", schema)
+	}
+	mw.Schema = schema
+	return nil
+}
+
+//serverFeatures returns the features of the extension depending on the PostgreSQL version
+func (mw *ModuleWriter) serverFeatures() []string {
+	var features []string
+	if mw.Trusted {
+		features = append(features, "trusted")
+	}
+	return features
+}
+
 //WriteSQL writes sql file with commands to create functions in DB
 func (mw *ModuleWriter) WriteSQL(tempPackagePath string) error {
-	sqlPath := filepath.Join(tempPackagePath, mw.PackageName+"--0.1.sql")
+	sqlPath := filepath.Join(tempPackagePath, mw.PackageName+"--"+mw.Version+".sql")
 	sqlFile, err := os.Create(sqlPath)
 	if err != nil {
 		return err
 	}
 	defer sqlFile.Close()
-	sqlFile.WriteString(`-- complain if script is sourced in psql, rather than via CREATE EXTENSION
+	return mw.writeScript(sqlFile)
+}
+
+//writeScript writes the extension script creating the SQL objects
+func (mw *ModuleWriter) writeScript(w io.Writer) error {
+	writers, err := orderSQL(mw.functions)
+	if err != nil {
+		return err
+	}
+	w.Write([]byte(`-- complain if script is sourced in psql, rather than via CREATE EXTENSION
 \echo Use "CREATE EXTENSION ` + mw.PackageName + `" to load this file. \quit
-`)
-	for _, f := range mw.functions {
-		f.SQL(mw.PackageName, sqlFile)
+`))
+	for _, schema := range functionSchemas(writers) {
+		w.Write([]byte("CREATE SCHEMA IF NOT EXISTS " + quoteIdent(schema) + ";\n"))
 	}
+	if err = mw.writeSQLFragment(w, "pre.sql"); err != nil {
+		return err
+	}
+	for _, f := range writers {
+		f.SQL(SQLTarget{PackageName: mw.PackageName, Schema: mw.Schema}, w)
+	}
+	return mw.writeSQLFragment(w, "post.sql")
+}
+
+//functionSchemas returns the schemas of the functions declared with //plgo:name schema=, the extension creates them
+func functionSchemas(writers []CodeWriter) []string {
+	var schemas []string
+	seen := make(map[string]bool)
+	for _, f := range writers {
+		if named, ok := f.(interface{ target(SQLTarget) SQLTarget }); ok {
+			if schema := named.target(SQLTarget{}).Schema; schema != "" && !seen[schema] {
+				seen[schema] = true
+				schemas = append(schemas, schema)
+			}
+		}
+	}
+	return schemas
+}
+
+//writeSQLFragment copies the project SQL fragment (sql/pre.sql or sql/post.sql) into the extension script, if it exists.
+//pre.sql can create the schemas, tables and types used by the functions, post.sql the objects using them and the seed data
+func (mw *ModuleWriter) writeSQLFragment(w io.Writer, name string) error {
+	fragment, err := ioutil.ReadFile(filepath.Join(mw.path, "sql", name))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Cannot read sql/%s: %w", name, err)
+	}
+	w.Write([]byte("\n-- sql/" + name + "\n"))
+	w.Write(bytes.TrimRight(fragment, "\n"))
+	w.Write([]byte("\n\n"))
 	return nil
 }
 
-//WriteControl writes .control file for the new postgresql extension
+//controlParameters are the parameters of the control file written first in this order, the others follow sorted by name
+var controlParameters = []string{"comment", "default_version", "module_pathname", "relocatable", "schema", "trusted", "superuser", "requires"}
+
+//WriteControl writes .control file for the new postgresql extension,
+//the parameters of plgo.toml and of the command line override the generated ones
 func (mw *ModuleWriter) WriteControl(path string) error {
-	control := []byte(`# ` + mw.PackageName + ` extension
-comment = '` + mw.PackageName + ` extension'
-default_version = '0.1'
-relocatable = true`)
+	params := map[string]string{
+		"comment":         quoteControlValue(mw.comment()),
+		"default_version": quoteControlValue(mw.Version),
+		"module_pathname": quoteControlValue("$libdir/" + mw.PackageName),
+		//the extension with an schema isn't relocatable, CREATE EXTENSION creates the schema if it doesn't exist,
+		//the extension using @extschema@ can't be moved, the schema is written into its objects
+		"relocatable": strconv.FormatBool(mw.Schema == "" && !mw.usesExtschema()),
+	}
+	if mw.Schema != "" {
+		params["schema"] = quoteControlValue(mw.Schema)
+	}
+	if mw.Trusted {
+		params["trusted"] = "true"
+	}
+	if requires := mw.requiredExtensions(); len(requires) > 0 {
+		params["requires"] = quoteControlValue(strings.Join(requires, ", "))
+	}
+	for name, value := range mw.config.Control {
+		params[name] = value
+	}
+	control := "# " + mw.PackageName + " extension\n"
+	for _, name := range controlParameters {
+		if value, ok := params[name]; ok {
+			control += name + " = " + value + "\n"
+			delete(params, name)
+		}
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		control += name + " = " + params[name] + "\n"
+	}
 	controlPath := filepath.Join(path, mw.PackageName+".control")
-	return ioutil.WriteFile(controlPath, control, 0644)
+	return ioutil.WriteFile(controlPath, []byte(control), 0644)
+}
+
+//usesExtschema reports whether the extension script uses @extschema@, the search_path guards of the security definer functions
+func (mw *ModuleWriter) usesExtschema() bool {
+	for _, f := range mw.functions {
+		if guarded, ok := f.(interface{ searchPath(SQLTarget) string }); ok && strings.Contains(guarded.searchPath(SQLTarget{}), "@extschema@") {
+			return true
+		}
+	}
+	return false
+}
+
+//comment returns the comment of the extension, the comment of plgo.toml or "<extension> extension"
+func (mw *ModuleWriter) comment() string {
+	if mw.config.Comment != "" {
+		return mw.config.Comment
+	}
+	return mw.PackageName + " extension"
+}
+
+//extensionTypes are the types of the other extensions by the extensions
+var extensionTypes = map[string]*regexp.Regexp{
+	"hstore": regexp.MustCompile(`\bhstore\b`),
+}
+
+//requiredExtensions returns the sorted extensions required in plgo.toml and the extensions with the types used by the functions
+//or the composite types
+func (mw *ModuleWriter) requiredExtensions() []string {
+	var types []string
+	for _, f := range mw.Manifest().Functions {
+		types = append(types, f.Args...)
+		types = append(types, f.Returns)
+	}
+	for _, f := range mw.functions {
+		if composite, ok := f.(*CompositeType); ok {
+			for _, column := range composite.Columns {
+				types = append(types, column.Type)
+			}
+		}
+	}
+	var requires []string
+	for _, extension := range mw.config.Requires {
+		if !contains(requires, extension) {
+			requires = append(requires, extension)
+		}
+	}
+	for extension, re := range extensionTypes {
+		if contains(requires, extension) {
+			continue
+		}
+		for _, t := range types {
+			if re.MatchString(t) {
+				requires = append(requires, extension)
+				break
+			}
+		}
+	}
+	sort.Strings(requires)
+	return requires
 }
 
-//WriteMakefile writes .control file for the new postgresql extension
+//WriteMakefile writes .control file for the new postgresql extension,
+//REGRESS is enabled if the package has the pg_regress test
 func (mw *ModuleWriter) WriteMakefile(path string) error {
+	regress := "# REGRESS"
+	if mw.Regress || mw.hasRegressTest() {
+		regress = "REGRESS"
+	}
 	makefile := []byte(`EXTENSION = ` + mw.PackageName + `
-DATA = ` + mw.PackageName + `--0.1.sql  # script files to install
-# REGRESS = ` + mw.PackageName + `_test     # our test script file (without extension)
+DATA = $(wildcard ` + mw.PackageName + `--*.sql)  # script files to install
+` + regress + ` = ` + regressTest(mw.PackageName) + `     # our test script file (without extension)
 MODULES = ` + mw.PackageName + `          # our c module file to build
 override with_llvm = no
 
 # postgres build stuff
-PG_CONFIG = pg_config
+PG_CONFIG = ` + makePgConfig() + `
 PGXS := $(shell $(PG_CONFIG) --pgxs)
 include $(PGXS)`)
 	makePath := filepath.Join(path, "Makefile")
 	return ioutil.WriteFile(makePath, makefile, 0644)
 }
+
+//WriteUpgradeScripts copies the upgrade scripts (sql/<extension>--<from>--<to>.sql) of the package
+func (mw *ModuleWriter) WriteUpgradeScripts(path string) error {
+	scripts, err := filepath.Glob(filepath.Join(mw.path, "sql", mw.PackageName+"--*--*.sql"))
+	if err != nil {
+		return err
+	}
+	for _, script := range scripts {
+		data, err := ioutil.ReadFile(script)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(filepath.Join(path, filepath.Base(script)), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+//lineSource is an package file with an function whose lines are checked in the written package
+const lineSource = `package main
+
+import "strings"
+
+//Upper returns the text in upper case
+func Upper(text string) string {
+	return upper(text)
+}
+
+func upper(text string) string {
+
+	text = strings.TrimSpace(text)
+	return strings.ToUpper(text)
+}
+`
+
+func TestWriteUserPackageLines(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ext")
+	writeFiles(t, dir, map[string]string{"upper.go": lineSource})
+	mw, err := NewModuleWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	temp := t.TempDir()
+	if err = mw.writeUserPackage(temp); err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filepath.Join(temp, "package_upper.go"), nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the statements of upper are on the lines 12 and 13 of upper.go
+	want := map[string]int{"TrimSpace": 12, "ToUpper": 13}
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		selector, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || want[selector.Sel.Name] == 0 {
+			return true
+		}
+		position := fset.Position(call.Pos())
+		if position.Filename != filepath.Join(dir, "upper.go") || position.Line != want[selector.Sel.Name] {
+			t.Errorf("strings.%s is at %s, want %s:%d", selector.Sel.Name, position, filepath.Join(dir, "upper.go"), want[selector.Sel.Name])
+		}
+		delete(want, selector.Sel.Name)
+		return true
+	})
+	if len(want) > 0 {
+		t.Errorf("the calls %v are missing in the written package", want)
+	}
+}
+
+//builtinNames returns the names of the builtin functions of the extension with the source
+func builtinNames(t *testing.T, source string) map[string]bool {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "ext")
+	writeFiles(t, dir, map[string]string{"ext.go": source})
+	mw, err := NewModuleWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, f := range mw.functions {
+		if builtin, ok := f.(*BuiltinFunction); ok {
+			names[builtin.Name] = true
+		}
+	}
+	return names
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		name, code string
+		//builtins are the gated builtin functions created for the code
+		builtins []string
+	}{
+		{"none", "", nil},
+		{"cache", "plgo.SharedCache().Delete(key)", []string{"ext_cache_get", "ext_cache_put", "ext_cache_stats"}},
+		{"rate limit", "plgo.NewRateLimiter(key, 10, 20)", []string{"ext_rate_limit", "ext_rate_limit_wait"}},
+		{"goroutines", "go plgo.SharedCache().Delete(key)", []string{"ext_goroutines", "ext_cache_get", "ext_cache_put", "ext_cache_stats"}},
+	}
+	gated := []string{"ext_goroutines", "ext_cache_get", "ext_cache_put", "ext_cache_stats", "ext_rate_limit", "ext_rate_limit_wait"}
+	for _, test := range tests {
+		names := builtinNames(t, "package main\n\nimport \"github.com/algonode/plgo\"\n\n"+
+			"var _ = plgo.Log\n\n//Run runs the code\nfunc Run(key string) {\n\t"+test.code+"\n}\n")
+		if !names["ext_explain"] || !names["ext_stat_reset"] {
+			t.Errorf("%s: the builtin functions of every extension are missing: %v", test.name, names)
+		}
+		want := make(map[string]bool)
+		for _, name := range test.builtins {
+			want[name] = true
+		}
+		for _, name := range gated {
+			if names[name] != want[name] {
+				t.Errorf("%s: function %s created %t, want %t", test.name, name, names[name], want[name])
+			}
+		}
+	}
+}
+
+func TestCheckCodecModules(t *testing.T) {
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOFLAGS", "-mod=mod")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"none/go.mod":     "module example.com/none\n\ngo 1.20\n",
+		"partial/go.mod":  "module example.com/partial\n\ngo 1.20\n\nrequire github.com/klauspost/compress v1.18.0\n\nreplace github.com/klauspost/compress => ../compress\n",
+		"codecs/go.mod":   "module example.com/codecs\n\ngo 1.20\n\nrequire (\n\tgithub.com/klauspost/compress v1.18.0\n\tgithub.com/pierrec/lz4/v4 v4.1.22\n)\n\nreplace github.com/klauspost/compress => ../compress\n\nreplace github.com/pierrec/lz4/v4 => ../lz4\n",
+		"compress/go.mod": "module github.com/klauspost/compress\n",
+		"lz4/go.mod":      "module github.com/pierrec/lz4/v4\n",
+	})
+	tests := []struct {
+		root string
+		//err is the part of the expected error
+		err string
+	}{
+		{"", "run go mod init and go get github.com/klauspost/compress github.com/pierrec/lz4/v4"},
+		{"none", "run go get github.com/klauspost/compress github.com/pierrec/lz4/v4"},
+		{"partial", "run go get github.com/pierrec/lz4/v4 in it"},
+		{"codecs", ""},
+	}
+	for _, test := range tests {
+		root, goDir := "", ""
+		if test.root != "" {
+			root = filepath.Join(dir, test.root)
+			goDir = root
+		}
+		err := checkCodecModules(root, goDir, nil)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("checkCodecModules(%s) = %v, want %q", test.root, err, test.err)
+		}
+	}
+}
+
+func TestModuleWriterBuildTags(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ext")
+	writeFiles(t, dir, map[string]string{
+		"ext.go":   "package main\n\n//Add adds the numbers\nfunc Add(a, b int32) int32 {\n\treturn a + b\n}\n",
+		"extra.go": "//go:build extra\n\npackage main\n\n//Extra is built with the extra tag\nfunc Extra() int32 {\n\treturn 1\n}\n",
+		"other.go": "//go:build ignore\n\npackage other\n",
+	})
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{nil, []string{"Add"}},
+		{[]string{"extra"}, []string{"Add", "Extra"}},
+	}
+	for _, test := range tests {
+		mw, err := NewModuleWriter(dir, test.tags...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range mw.functions {
+			if function, ok := f.(*Function); ok {
+				names = append(names, function.Name)
+			}
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, test.want) || !reflect.DeepEqual(mw.BuildTags, test.tags) {
+			t.Errorf("NewModuleWriter with the tags %q: functions %q, build tags %q, want %q", test.tags, names, mw.BuildTags, test.want)
+		}
+	}
+}
+
+func TestPgTargets(t *testing.T) {
+	targets, err := pgTargets("15, 16", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []pgTarget{{15, filepath.Join("build", "pg15")}, {16, filepath.Join("build", "pg16")}}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("pgTargets(15, 16) = %v, want %v", targets, want)
+	}
+	if _, err = pgTargets("16,next", "build"); err == nil || err.Error() != "Invalid PostgreSQL major version next" {
+		t.Errorf("pgTargets of an invalid version: %v", err)
+	}
+}
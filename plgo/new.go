@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+//extensionNameRe matches the names usable as the extension name and the shared object without quoting
+var extensionNameRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+//newProjectFiles returns the files of the new extension project by their paths relative to the project directory
+func newProjectFiles(name, modulePath string) map[string]string {
+	return map[string]string{
+		"go.mod": "module " + modulePath + "\n\ngo 1.20\n",
+		name + ".go": `//Package main is the ` + name + ` PostgreSQL extension, every exported function is an SQL function.
+//Build and install it with:
+//
+//	plgo build
+//	cd build && sudo make install with_llvm=no
+//
+//then run CREATE EXTENSION ` + name + `; in the database.
+//
+//plgo:version 0.1
+package main
+
+import (
+	"github.com/algonode/plgo"
+)
+
+//Hello greets the name, e.g.
+//
+//	SELECT hello(current_user);
+//
+//plgo:immutable parallel-safe
+func Hello(name string) (string, error) {
+	if name == "" {
+		return "", &plgo.Error{Code: "22023", Message: "name must not be empty"}
+	}
+	return "Hello, " + name + "!", nil
+}
+`,
+		//the test passes if psql runs it without an error, plgo test compares the output with test/hello.out if it's added
+		filepath.Join(testDir, "hello.sql"): "SELECT hello('world');\n",
+		".gitignore":                        "/build/\n",
+	}
+}
+
+//plgoModuleVersion returns the version of the plgo module required by the new project,
+//the release of the plgo binary or latest for an development build
+func plgoModuleVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && strings.HasPrefix(info.Main.Version, "v") && !strings.Contains(info.Main.Version, "+") {
+		return info.Main.Version
+	}
+	return "latest"
+}
+
+//newProject creates the directory of the new extension with an example function ready to be built by plgo
+func newProject(args []string) error {
+	flags := flag.NewFlagSet("new", flag.ExitOnError)
+	modulePath := flags.String("module", "", "module path of the go.mod, the name of the extension by default")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: plgo new [-module path] path/to/extension")
+	}
+	dir := flags.Arg(0)
+	name := filepath.Base(dir)
+	if !extensionNameRe.MatchString(name) {
+		return fmt.Errorf("Extension name %s must be lowercase letters, digits and underscores, starting with a letter", name)
+	}
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("Directory %s already exists and is not empty", dir)
+	}
+	if *modulePath == "" {
+		*modulePath = name
+	}
+	for path, content := range newProjectFiles(name, *modulePath) {
+		path = filepath.Join(dir, path)
+		if err := makeBuildDir(filepath.Dir(path)); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	//the plgo module is needed by the editors and go vet, plgo builds the extension with its embedded runtime
+	goGet := exec.Command("go", "get", "github.com/algonode/plgo@"+plgoModuleVersion())
+	goGet.Dir = dir
+	if out, err := goGet.CombinedOutput(); err != nil {
+		fmt.Printf("Cannot add the plgo module, run go get github.com/algonode/plgo in %s: %s\n%s", dir, err, out)
+	}
+	fmt.Printf("Created the %s extension in %s, build it with:\n\n\tcd %s && plgo build\n", name, dir, dir)
+	return nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"regexp"
+	"strings"
+)
+
+//Operator is an operator declared with //plgo:operator on an function with two parameters (or one, an prefix operator),
+//e.g. //plgo:operator < commutator=> negator=>= restrict=scalarltsel join=scalarltjoinsel
+type Operator struct {
+	Symbol string
+	//Function is the function of the operator
+	Function *Function
+	//Commutator and Negator are the operators of the commutated and the negated comparison
+	Commutator, Negator string
+	//Restrict and Join are the selectivity estimators of the planner, e.g. eqsel and eqjoinsel
+	Restrict, Join string
+	//Hashes and Merges operators can be used in the hash and merge joins, the equality operators
+	Hashes, Merges bool
+}
+
+//OperatorClass is the index operator class of the type declared with //plgo:operator-class on the support function,
+//e.g. //plgo:operator-class btree default name=version_ops. The btree support function compares the values,
+//func(a, b T) int32, the hash support function hashes the value, func(v T) int32
+type OperatorClass struct {
+	Name, Method string
+	Default      bool
+	Function     *Function
+	//Operators are the operators of the strategies, bound after all the functions are parsed
+	Operators []*Operator
+}
+
+//operatorRe matches the operator symbols allowed by PostgreSQL
+var operatorRe = regexp.MustCompile("^[-+*/<>=~!@#%^&|`?]{1,63}$")
+
+//strategies are the operators of the index strategies of the operator class methods, numbered from 1
+var strategies = map[string][]string{
+	"btree": {"<", "<=", "=", ">=", ">"},
+	"hash":  {"="},
+}
+
+//supportFunctions are the signatures of the support functions of the operator class methods
+var supportFunctions = map[string]string{
+	"btree": "func(a, b T) int32",
+	"hash":  "func(v T) int32",
+}
+
+//isOperator reports whether the symbol is an valid operator name, it can't contain the comment starts
+//and the longer names can't end with + or - unless they contain an of ~ ! @ # % ^ & | ` ?
+func isOperator(symbol string) bool {
+	if !operatorRe.MatchString(symbol) || strings.Contains(symbol, "--") || strings.Contains(symbol, "/*") {
+		return false
+	}
+	return len(symbol) == 1 || !strings.ContainsAny(symbol[len(symbol)-1:], "+-") || strings.ContainsAny(symbol, "~!@#%^&|`?")
+}
+
+//newOperators returns the operator and the operator class declared by the directives of the function, if any
+func newOperators(function *ast.FuncDecl, code CodeWriter) ([]CodeWriter, error) {
+	directives := functionDirectives(function)
+	operatorWords, isOperatorFunction := directives["operator"]
+	classWords, isClassFunction := directives["operator-class"]
+	if !isOperatorFunction && !isClassFunction {
+		return nil, nil
+	}
+	f, ok := code.(*Function)
+	if !ok {
+		return nil, fmt.Errorf("Function %s: the operators and the operator classes need an function returning an value", function.Name.Name)
+	}
+	var writers []CodeWriter
+	if isOperatorFunction {
+		operator, err := newOperator(f, strings.Fields(strings.Join(operatorWords, " ")))
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, operator)
+	}
+	if isClassFunction {
+		class, err := newOperatorClass(f, strings.Fields(strings.Join(classWords, " ")))
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, class)
+	}
+	return writers, nil
+}
+
+//newOperator returns the operator of the function declared with the directive words
+func newOperator(f *Function, words []string) (*Operator, error) {
+	if len(f.Params) < 1 || len(f.Params) > 2 {
+		return nil, fmt.Errorf("Function %s: the operator function must have one or two parameters", f.Name)
+	}
+	if len(words) == 0 || !isOperator(words[0]) {
+		return nil, fmt.Errorf("Function %s: //plgo:operator needs the operator name, e.g. //plgo:operator <", f.Name)
+	}
+	o := &Operator{Symbol: words[0], Function: f}
+	for _, word := range words[1:] {
+		name, value, _ := strings.Cut(word, "=")
+		switch name {
+		case "commutator", "negator":
+			if !isOperator(value) {
+				return nil, fmt.Errorf("Function %s: %s %s isn't an operator", f.Name, name, value)
+			}
+			if len(f.Params) == 1 {
+				return nil, fmt.Errorf("Function %s: the prefix operator %s can't have an %s", f.Name, o.Symbol, name)
+			}
+			if name == "commutator" {
+				o.Commutator = value
+			} else {
+				o.Negator = value
+			}
+		case "restrict", "join":
+			if !sqlIdentRe.MatchString(value) {
+				return nil, fmt.Errorf("Function %s: %s %s isn't an function name", f.Name, name, value)
+			}
+			if name == "restrict" {
+				o.Restrict = value
+			} else {
+				o.Join = value
+			}
+		case "hashes", "merges":
+			if value != "" || len(f.Params) == 1 {
+				return nil, fmt.Errorf("Function %s: invalid operator option %s", f.Name, word)
+			}
+			if name == "hashes" {
+				o.Hashes = true
+			} else {
+				o.Merges = true
+			}
+		default:
+			return nil, fmt.Errorf("Function %s: unknown operator option %s", f.Name, word)
+		}
+	}
+	return o, nil
+}
+
+//args returns the left and the right argument types, the left is NONE for the prefix operators
+func (o *Operator) args() (string, string) {
+	params := o.Function.sqlParamTypes()
+	if len(params) == 1 {
+		return "NONE", params[0]
+	}
+	return params[0], params[1]
+}
+
+//qualifiedName returns the operator qualified with the schema of its function, the symbol isn't quoted
+func (o *Operator) qualifiedName(target SQLTarget) string {
+	if schema := o.Function.target(target).Schema; schema != "" {
+		return quoteIdent(schema) + "." + o.Symbol
+	}
+	return o.Symbol
+}
+
+//FuncDec returns nothing, operator isn't a function
+func (o *Operator) FuncDec() string {
+	return ""
+}
+
+//Code does nothing, the function of the operator has the wrapper
+func (o *Operator) Code(w io.Writer) {}
+
+//SQL writes the SQL command that creates the operator in DB
+func (o *Operator) SQL(target SQLTarget, w io.Writer) {
+	left, right := o.args()
+	options := []string{"FUNCTION = " + o.Function.qualifiedName(target)}
+	if left != "NONE" {
+		options = append(options, "LEFTARG = "+left)
+	}
+	options = append(options, "RIGHTARG = "+right)
+	if o.Commutator != "" {
+		options = append(options, "COMMUTATOR = OPERATOR("+o.Commutator+")")
+	}
+	if o.Negator != "" {
+		options = append(options, "NEGATOR = OPERATOR("+o.Negator+")")
+	}
+	if o.Restrict != "" {
+		options = append(options, "RESTRICT = "+o.Restrict)
+	}
+	if o.Join != "" {
+		options = append(options, "JOIN = "+o.Join)
+	}
+	if o.Hashes {
+		options = append(options, "HASHES")
+	}
+	if o.Merges {
+		options = append(options, "MERGES")
+	}
+	w.Write([]byte("CREATE OPERATOR " + o.qualifiedName(target) + " (\n\t" + strings.Join(options, ",\n\t") + "\n);\n\n"))
+}
+
+//Entity returns the id of the operator, e.g. "operator <(version,version)"
+func (o *Operator) Entity() string {
+	left, right := o.args()
+	return "operator " + o.Symbol + "(" + strings.ToLower(left) + "," + right + ")"
+}
+
+//Dependencies returns the function of the operator
+func (o *Operator) Dependencies() []string {
+	return []string{o.Function.Entity()}
+}
+
+//Describe adds the operator to the manifest
+func (o *Operator) Describe(m *Manifest) {
+	m.Relations = append(m.Relations, ManifestRelation{Kind: "operator", Name: o.Symbol})
+}
+
+//newOperatorClass returns the operator class of the support function declared with the directive words,
+//the btree and hash methods are supported
+func newOperatorClass(f *Function, words []string) (*OperatorClass, error) {
+	if len(words) == 0 || strategies[words[0]] == nil {
+		return nil, fmt.Errorf("Function %s: //plgo:operator-class needs the index method btree or hash", f.Name)
+	}
+	c := &OperatorClass{Method: words[0], Function: f}
+	params := f.sqlParamTypes()
+	if f.SQLReturnType != "integer" || (c.Method == "btree" && (len(params) != 2 || params[0] != params[1])) || (c.Method == "hash" && len(params) != 1) {
+		return nil, fmt.Errorf("Function %s: the %s support function must be %s", f.Name, c.Method, supportFunctions[c.Method])
+	}
+	c.Name = strings.ReplaceAll(params[0], " ", "_") + "_ops"
+	for _, word := range words[1:] {
+		name, value, _ := strings.Cut(word, "=")
+		switch {
+		case word == "default":
+			c.Default = true
+		case name == "name" && sqlIdentRe.MatchString(value):
+			c.Name = value
+		default:
+			return nil, fmt.Errorf("Function %s: invalid operator class option %s", f.Name, word)
+		}
+	}
+	return c, nil
+}
+
+//bindOperatorClasses binds the operator classes to the operators of their strategies on their type
+func bindOperatorClasses(writers []CodeWriter) error {
+	operators := make(map[string]*Operator)
+	for _, w := range writers {
+		if o, ok := w.(*Operator); ok {
+			operators[o.Entity()] = o
+		}
+	}
+	for _, w := range writers {
+		c, ok := w.(*OperatorClass)
+		if !ok {
+			continue
+		}
+		sqlType := c.Function.sqlParamTypes()[0]
+		c.Operators = nil
+		for _, symbol := range strategies[c.Method] {
+			o := operators["operator "+symbol+"("+sqlType+","+sqlType+")"]
+			if o == nil {
+				return fmt.Errorf("Operator class %s: declare the operator %s(%s, %s) with //plgo:operator", c.Name, symbol, sqlType, sqlType)
+			}
+			c.Operators = append(c.Operators, o)
+		}
+	}
+	return nil
+}
+
+//FuncDec returns nothing, operator class isn't a function
+func (c *OperatorClass) FuncDec() string {
+	return ""
+}
+
+//Code does nothing, the support function has the wrapper
+func (c *OperatorClass) Code(w io.Writer) {}
+
+//SQL writes the SQL command that creates the operator class in DB
+func (c *OperatorClass) SQL(target SQLTarget, w io.Writer) {
+	w.Write([]byte("CREATE OPERATOR CLASS " + c.Function.target(target).qualify(c.Name) + "\n"))
+	if c.Default {
+		w.Write([]byte("DEFAULT "))
+	}
+	w.Write([]byte("FOR TYPE " + c.Function.sqlParamTypes()[0] + " USING " + c.Method + " AS\n"))
+	for i, o := range c.Operators {
+		w.Write([]byte(fmt.Sprintf("\tOPERATOR %d %s,\n", i+1, o.qualifiedName(target))))
+	}
+	w.Write([]byte("\tFUNCTION 1 " + c.Function.target(target).qualify(c.Function.signature()) + ";\n\n"))
+}
+
+//Entity returns the id of the operator class, e.g. "operator class version_ops using btree"
+func (c *OperatorClass) Entity() string {
+	return relationEntity("operator class", c.Name+" using "+c.Method)
+}
+
+//Dependencies returns the support function and the operators of the operator class
+func (c *OperatorClass) Dependencies() []string {
+	deps := []string{c.Function.Entity()}
+	for _, o := range c.Operators {
+		deps = append(deps, o.Entity())
+	}
+	return deps
+}
+
+//Describe adds the operator class to the manifest
+func (c *OperatorClass) Describe(m *Manifest) {
+	m.Relations = append(m.Relations, ManifestRelation{Kind: "operator class", Name: c.Name})
+}
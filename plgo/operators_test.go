@@ -0,0 +1,164 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+//operatorWriters returns the functions, operators and operator classes declared in the source,
+//the functions can use the composite type Version
+func operatorWriters(t *testing.T, source string) ([]CodeWriter, error) {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "test.go", "package test\n\n"+source, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	composites := map[string]*CompositeType{"Version": {GoName: "Version", Name: "version"}}
+	var writers []CodeWriter
+	for _, decl := range file.Decls {
+		function, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		code, err := NewCode(function, nil, composites)
+		if err != nil {
+			return nil, err
+		}
+		operators, err := newOperators(function, code)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(append(writers, code), operators...)
+	}
+	return writers, bindOperatorClasses(writers)
+}
+
+func TestIsOperator(t *testing.T) {
+	tests := []struct {
+		symbol string
+		valid  bool
+	}{
+		{"<", true},
+		{"<=", true},
+		{"@>", true},
+		{"-", true},
+		{"!-", true},
+		{"<-", false},
+		{"--", false},
+		{"</*", false},
+		{"<a", false},
+		{"", false},
+		{strings.Repeat("<", 64), false},
+	}
+	for _, test := range tests {
+		if valid := isOperator(test.symbol); valid != test.valid {
+			t.Errorf("isOperator(%q) = %v, want %v", test.symbol, valid, test.valid)
+		}
+	}
+}
+
+//versionOperators are the comparison operators of the btree operator class of Version
+const versionOperators = `
+//plgo:operator < commutator=> negator=>= restrict=scalarltsel join=scalarltjoinsel
+func Lt(a, b Version) bool { return false }
+//plgo:operator <=
+func Le(a, b Version) bool { return false }
+//plgo:operator = commutator== hashes merges
+func Eq(a, b Version) bool { return false }
+//plgo:operator >=
+func Ge(a, b Version) bool { return false }
+//plgo:operator >
+func Gt(a, b Version) bool { return false }
+`
+
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		source string
+		//sql is the part of the expected SQL, err is the part of the expected error
+		sql, err string
+	}{
+		{source: versionOperators, sql: "CREATE OPERATOR < (\n\tFUNCTION = Lt,\n\tLEFTARG = version,\n\tRIGHTARG = version,\n\t" +
+			"COMMUTATOR = OPERATOR(>),\n\tNEGATOR = OPERATOR(>=),\n\tRESTRICT = scalarltsel,\n\tJOIN = scalarltjoinsel\n);"},
+		{source: versionOperators, sql: "RIGHTARG = version,\n\tCOMMUTATOR = OPERATOR(=),\n\tHASHES,\n\tMERGES\n);"},
+		{source: "//plgo:operator -\nfunc Neg(a Version) Version { return a }", sql: "FUNCTION = Neg,\n\tRIGHTARG = version\n);"},
+		{source: "//plgo:operator <\nfunc Lt(a, b, c Version) bool { return false }", err: "must have one or two parameters"},
+		{source: "//plgo:operator\nfunc Lt(a, b Version) bool { return false }", err: "needs the operator name"},
+		{source: "//plgo:operator lt\nfunc Lt(a, b Version) bool { return false }", err: "needs the operator name"},
+		{source: "//plgo:operator < commutator=gt\nfunc Lt(a, b Version) bool { return false }", err: "commutator gt isn't an operator"},
+		{source: "//plgo:operator - negator=+\nfunc Neg(a Version) Version { return a }", err: "the prefix operator - can't have an negator"},
+		{source: "//plgo:operator < restrict=sel;\nfunc Lt(a, b Version) bool { return false }", err: "restrict sel; isn't an function name"},
+		{source: "//plgo:operator = hashes=yes\nfunc Eq(a, b Version) bool { return false }", err: "invalid operator option hashes=yes"},
+		{source: "//plgo:operator < sort\nfunc Lt(a, b Version) bool { return false }", err: "unknown operator option sort"},
+		{source: "//plgo:operator <\nfunc Lt(a, b Version) {}", err: "need an function returning an value"},
+	}
+	for _, test := range tests {
+		writers, err := operatorWriters(t, test.source)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: error %v, want %q", test.source, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", test.source, err)
+			continue
+		}
+		var sql strings.Builder
+		for _, w := range writers {
+			if _, ok := w.(*Operator); ok {
+				w.SQL(SQLTarget{}, &sql)
+			}
+		}
+		if !strings.Contains(sql.String(), test.sql) {
+			t.Errorf("%q: SQL\n%s\nwithout\n%s", test.source, sql.String(), test.sql)
+		}
+	}
+}
+
+func TestOperatorClasses(t *testing.T) {
+	tests := []struct {
+		source string
+		//sql is the part of the expected SQL, err is the part of the expected error
+		sql, err string
+	}{
+		{source: versionOperators + "//plgo:operator-class btree default\nfunc Cmp(a, b Version) int32 { return 0 }",
+			sql: "CREATE OPERATOR CLASS version_ops\nDEFAULT FOR TYPE version USING btree AS\n\tOPERATOR 1 <,\n\tOPERATOR 2 <=,\n\t" +
+				"OPERATOR 3 =,\n\tOPERATOR 4 >=,\n\tOPERATOR 5 >,\n\tFUNCTION 1 Cmp(version,version);"},
+		{source: versionOperators + "//plgo:operator-class hash name=version_hash_ops\nfunc Hash(v Version) int32 { return 0 }",
+			sql: "CREATE OPERATOR CLASS version_hash_ops\nFOR TYPE version USING hash AS\n\tOPERATOR 1 =,\n\tFUNCTION 1 Hash(version);"},
+		{source: "//plgo:operator-class gist\nfunc Cmp(a, b Version) int32 { return 0 }", err: "needs the index method btree or hash"},
+		{source: "//plgo:operator-class btree\nfunc Cmp(a, b Version) int64 { return 0 }", err: "the btree support function must be func(a, b T) int32"},
+		{source: "//plgo:operator-class btree\nfunc Cmp(a Version, b string) int32 { return 0 }", err: "the btree support function must be func(a, b T) int32"},
+		{source: "//plgo:operator-class hash\nfunc Hash(a, b Version) int32 { return 0 }", err: "the hash support function must be func(v T) int32"},
+		{source: "//plgo:operator-class btree name=my-ops\nfunc Cmp(a, b Version) int32 { return 0 }", err: "invalid operator class option name=my-ops"},
+		{source: "//plgo:operator-class btree unique\nfunc Cmp(a, b Version) int32 { return 0 }", err: "invalid operator class option unique"},
+		{source: "//plgo:operator-class btree\nfunc Cmp(a, b Version) int32 { return 0 }", err: "Operator class version_ops: declare the operator <(version, version)"},
+		{source: strings.Replace(versionOperators, "//plgo:operator >=\n", "", 1) + "//plgo:operator-class btree\nfunc Cmp(a, b Version) int32 { return 0 }",
+			err: "declare the operator >=(version, version)"},
+	}
+	for _, test := range tests {
+		writers, err := operatorWriters(t, test.source)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: error %v, want %q", test.source, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", test.source, err)
+			continue
+		}
+		var sql strings.Builder
+		for _, w := range writers {
+			if _, ok := w.(*OperatorClass); ok {
+				w.SQL(SQLTarget{}, &sql)
+			}
+		}
+		if !strings.Contains(sql.String(), test.sql) {
+			t.Errorf("%q: SQL\n%s\nwithout\n%s", test.source, sql.String(), test.sql)
+		}
+	}
+}
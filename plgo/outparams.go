@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//OutParam is an OUT parameter, an named result of the Go function
+type OutParam struct {
+	Param
+	//InOut is the index of the parameter with the same SQL name (case insensitive), the INOUT parameter, -1 for OUT
+	InOut int
+}
+
+//OutFunction is an function with more named results, they are the OUT parameters of the function returning an record.
+//The result named as an parameter (case insensitive, count and Count) makes it an INOUT parameter,
+//the last result of type error is raised as in the (T, error) functions
+type OutFunction struct {
+	VoidFunction
+	Outs []OutParam
+}
+
+//newOutFunction returns the function with OUT parameters if it has more results besides an last error, otherwise nil
+func newOutFunction(function VoidFunction, results *ast.FieldList, structs map[string]*ast.StructType, composites map[string]*CompositeType) (*OutFunction, error) {
+	if results == nil {
+		return nil, nil
+	}
+	fields := results.List
+	hasError := false
+	if last := fields[len(fields)-1]; len(last.Names) <= 1 && typeString(last.Type) == "error" {
+		fields, hasError = fields[:len(fields)-1], true
+	}
+	count := 0
+	for _, field := range fields {
+		count += len(field.Names)
+		if len(field.Names) == 0 {
+			count++
+		}
+	}
+	if count < 2 {
+		return nil, nil
+	}
+	f := &OutFunction{VoidFunction: function}
+	f.Error = hasError
+	for _, field := range fields {
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("Function %s: the results must be named, they are the OUT parameters", function.Name)
+		}
+		resultType := field.Type
+		star, nullable := resultType.(*ast.StarExpr)
+		if nullable {
+			resultType = star.X
+		}
+		goType, sqlType := goSQLType(resultType, structs, composites)
+		for _, name := range field.Names {
+			if sqlType == "" || goType == triggerRow || composites[goType] != nil || (nullable && strings.HasPrefix(goType, "[]")) {
+				return nil, fmt.Errorf("Function %s, result %s: type %s not supported", function.Name, name.Name, typeString(field.Type))
+			}
+			out := OutParam{Param: Param{Name: name.Name, Type: goType, SQLType: sqlType, Nullable: nullable}, InOut: -1}
+			if nullable {
+				out.Type = "*" + goType
+			}
+			for i, p := range function.Params {
+				if !strings.EqualFold(p.Name, name.Name) {
+					continue
+				}
+				if p.Variadic {
+					return nil, fmt.Errorf("Function %s: the variadic parameter %s can't be INOUT", function.Name, p.Name)
+				}
+				if p.SQLType != sqlType {
+					return nil, fmt.Errorf("Function %s: the INOUT result %s must have the SQL type %s of the parameter %s", function.Name, name.Name, p.SQLType, p.Name)
+				}
+				out.InOut = i
+			}
+			f.Outs = append(f.Outs, out)
+		}
+	}
+	return f, nil
+}
+
+//columns returns the OUT parameters in the order of the record columns: the INOUT parameters in the order
+//of the parameters, then the OUT parameters
+func (f *OutFunction) columns() []int {
+	var columns []int
+	for i := range f.Params {
+		for j, out := range f.Outs {
+			if out.InOut == i {
+				columns = append(columns, j)
+			}
+		}
+	}
+	for j, out := range f.Outs {
+		if out.InOut < 0 {
+			columns = append(columns, j)
+		}
+	}
+	return columns
+}
+
+//Code writes the wrapper function, the results are returned as an record
+func (f *OutFunction) Code(w io.Writer) {
+	writeFuncHeader(w, f.Name)
+	if len(f.Params) > 0 {
+		for _, p := range f.Params {
+			w.Write([]byte("var " + p.Name + " " + p.Type + "\n"))
+		}
+		w.Write([]byte("err:=fcinfo.Scan(\n"))
+		for _, p := range f.Params {
+			w.Write([]byte("&" + p.Name + ",\n"))
+		}
+		w.Write([]byte(")\n"))
+		w.Write([]byte(`
+		if(err!=nil){
+			C.elog_error(C.CString(
+				err.Error(),
+			))
+		}
+		`))
+	}
+	f.writeTraceArgs(w)
+	rets := make([]string, len(f.Outs))
+	traced := make([]string, len(f.Outs))
+	for i, out := range f.Outs {
+		rets[i] = "ret" + strconv.Itoa(i)
+		traced[i] = strconv.Quote(out.Name) + ": " + rets[i]
+	}
+	if f.Error {
+		rets = append(rets, "retErr")
+	}
+	w.Write([]byte(strings.Join(rets, ", ") + " := "))
+	w.Write([]byte("__" + f.Name + "(\n"))
+	for _, p := range f.Params {
+		w.Write([]byte(p.arg() + ",\n"))
+	}
+	w.Write([]byte(")\n"))
+	f.writeRaise(w)
+	w.Write([]byte("if call.traced {\ncall.traceResult(map[string]interface{}{" + strings.Join(traced, ", ") + "})\n}\n"))
+	w.Write([]byte("return recordDatum(fcinfo"))
+	for _, j := range f.columns() {
+		w.Write([]byte(", ret" + strconv.Itoa(j)))
+	}
+	w.Write([]byte(")\n"))
+	w.Write([]byte("}\n"))
+}
+
+//sqlReturnType returns the record of the OUT parameters, the manifest compares their types between the releases
+func (f *OutFunction) sqlReturnType() string {
+	columns := make([]string, len(f.Outs))
+	for i, j := range f.columns() {
+		columns[i] = sqlName(strings.ToLower(f.Outs[j].Name)) + " " + f.Outs[j].SQLType
+	}
+	return "record(" + strings.Join(columns, ", ") + ")"
+}
+
+//SQL writes the SQL command that creates the function in DB, with the modes of the parameters
+func (f *OutFunction) SQL(target SQLTarget, w io.Writer) {
+	f.writeRequires(w)
+	w.Write([]byte("CREATE OR REPLACE FUNCTION " + f.qualifiedName(target) + "("))
+	var paramsString []string
+	for i, p := range f.Params {
+		mode := "IN "
+		for _, out := range f.Outs {
+			if out.InOut == i {
+				mode = "INOUT "
+			}
+		}
+		if p.Variadic {
+			mode = ""
+		}
+		paramsString = append(paramsString, mode+p.sql())
+	}
+	for _, out := range f.Outs {
+		if out.InOut < 0 {
+			paramsString = append(paramsString, "OUT "+sqlName(out.Name)+" "+out.SQLType)
+		}
+	}
+	w.Write([]byte(strings.Join(paramsString, ",")))
+	w.Write([]byte(")\n"))
+	w.Write([]byte("RETURNS record AS\n"))
+	w.Write([]byte(modulePathname + ", '" + f.Name + "'\n"))
+	f.writeLanguage(target, w)
+	f.writeGrants(target, w)
+	if f.Doc == "" {
+		w.Write([]byte("\n"))
+		return
+	}
+	f.Comment(target, w)
+}
+
+//Describe adds the function to the manifest
+func (f *OutFunction) Describe(m *Manifest) {
+	m.Functions = append(m.Functions, f.manifestFunction(f.sqlReturnType()))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//packagers are the formats of plgo package, they package the extension built into the build directory
+var packagers = map[string]func(args []string) error{
+	"docker": packageDocker,
+	"pgxn":   packagePGXN,
+	"deb":    packageDeb,
+	"rpm":    packageRPM,
+}
+
+//packageExtension packages the built extension for the distribution, plgo package <format> [flags] [path/to/package]
+func packageExtension(args []string) error {
+	if len(args) == 0 || packagers[args[0]] == nil {
+		return fmt.Errorf("Usage: plgo package docker [-build build] [-image postgres:16] [path/to/package]\n" +
+			"       plgo package pgxn [-build build] [-maintainer 'name <email>'] [-license unknown] [-status stable] [path/to/package]\n" +
+			"       plgo package deb|rpm [-build build] [-maintainer 'name <email>'] [-license unknown] [-pg 16] [path/to/package]")
+	}
+	return packagers[args[0]](args[1:])
+}
+
+//builtExtension parses the package of the flag arguments and checks that its extension is built into the build directory,
+//the version of the module writer is the built one
+func builtExtension(flags *flag.FlagSet, buildDir string) (*ModuleWriter, error) {
+	packagePath := "."
+	if flags.NArg() == 1 {
+		packagePath = flags.Arg(0)
+	}
+	moduleWriter, err := NewModuleWriter(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	path := manifestPath(buildDir, moduleWriter.PackageName)
+	if _, err = os.Stat(path); err != nil {
+		return nil, fmt.Errorf("The extension isn't built, %s is missing, run plgo build first", path)
+	}
+	manifest, err := ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	moduleWriter.Version = manifest.Version
+	return moduleWriter, nil
+}
+
+//description returns the first paragraph of the package doc in one line, the comment of the extension without doc
+func (mw *ModuleWriter) description() string {
+	if doc := strings.TrimSpace(mw.Doc); doc != "" {
+		return strings.Join(strings.Fields(strings.SplitN(doc, "\n\n", 2)[0]), " ")
+	}
+	return mw.comment()
+}
+
+//needsPreload reports if the extension must be loaded with shared_preload_libraries: it has background workers,
+//scheduled jobs, notification listeners, tracing or postmaster settings
+func (mw *ModuleWriter) needsPreload() bool {
+	for _, f := range mw.functions {
+		if _, ok := f.(*WorkerFunction); ok {
+			return true
+		}
+	}
+	for _, name := range []string{"RegisterJob", "Listen", "EnableTracing", "GUCPostmaster"} {
+		if usesPlgo(mw.packageAst, name) {
+			return true
+		}
+	}
+	return false
+}
+
+//packageDocker writes the Dockerfile of the postgres image with the built extension installed into the build directory,
+//the build directory is the context of the image. The extension must be built for the glibc and the PostgreSQL version
+//of the image, e.g. with plgo build -docker
+func packageDocker(args []string) error {
+	flags := flag.NewFlagSet("package docker", flag.ExitOnError)
+	buildDir := flags.String("build", "build", "directory of the built extension")
+	image := flags.String("image", "", "Debian based postgres image extended with the extension, postgres:<major version of pg_config> by default")
+	flags.Parse(args)
+	moduleWriter, err := builtExtension(flags, *buildDir)
+	if err != nil {
+		return err
+	}
+	library := filepath.Join(*buildDir, moduleWriter.PackageName+".so")
+	if _, err = os.Stat(library); err != nil {
+		return fmt.Errorf("%s is missing, build the extension for linux, e.g. with plgo build -docker", library)
+	}
+	if *image == "" {
+		version, err := serverVersion()
+		if err != nil {
+			return fmt.Errorf("%w, set the image with -image", err)
+		}
+		*image = "postgres:" + strconv.Itoa(version)
+	}
+	name := moduleWriter.PackageName
+	var dockerfile strings.Builder
+	fmt.Fprintf(&dockerfile, "# the %s extension installed into %s, written by plgo package docker\n", name, *image)
+	fmt.Fprintf(&dockerfile, "FROM %s\n", *image)
+	fmt.Fprintf(&dockerfile, "COPY %[1]s.so %[1]s.control %[1]s--*.sql /tmp/%[1]s/\n", name)
+	fmt.Fprintf(&dockerfile, "RUN install -m 755 /tmp/%[1]s/%[1]s.so /usr/lib/postgresql/$PG_MAJOR/lib/ \\\n"+
+		"\t&& install -m 644 /tmp/%[1]s/%[1]s.control /tmp/%[1]s/*.sql /usr/share/postgresql/$PG_MAJOR/extension/ \\\n"+
+		"\t&& rm -rf /tmp/%[1]s\n", name)
+	if moduleWriter.needsPreload() {
+		//initdb copies the sample into the postgresql.conf of the new cluster
+		dockerfile.WriteString("# the workers, jobs, listeners or postmaster settings of the extension need it in shared_preload_libraries\n")
+		fmt.Fprintf(&dockerfile, "RUN echo \"shared_preload_libraries = '%s'\" >> /usr/share/postgresql/postgresql.conf.sample\n", name)
+	}
+	path := filepath.Join(*buildDir, "Dockerfile")
+	if err = ioutil.WriteFile(path, []byte(dockerfile.String()), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s, build the image with: docker build -t %s %s\n", path, name, *buildDir)
+	return nil
+}
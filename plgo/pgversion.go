@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//minServerVersion is the oldest PostgreSQL major version supported by the plgo runtime (dshash)
+const minServerVersion = 11
+
+//serverFeatures are the PostgreSQL major versions introducing the features of the generated extension.
+//The runtime builds for every version since minServerVersion with the fallbacks of its #if PG_VERSION_NUM blocks,
+//so its features aren't listed: the shared areas and the cache use the named DSM segments (GetNamedDSMSegment)
+//since PostgreSQL 17 and the spare main shared memory (ShmemInitStruct) before, the set returning functions use
+//the materialize mode (SFRM_Materialize) of all the versions, and the renamed server functions
+//(e.g. GetCommandTagName, BeginCopyFrom, make_range) are called with the signatures of the version
+var serverFeatures = map[string]int{
+	"trusted": 13,
+}
+
+var pgConfigVersionRe = regexp.MustCompile(`^PostgreSQL (\d+)(?:\.(\d+))?`)
+
+//parseServerVersion returns the major version from the output of pg_config --version,
+//e.g. 15 from "PostgreSQL 15.4 (Debian 15.4-1)" or 9 from "PostgreSQL 9.6.24"
+func parseServerVersion(version string) (int, error) {
+	match := pgConfigVersionRe.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return 0, fmt.Errorf("Cannot parse PostgreSQL version %q", strings.TrimSpace(version))
+	}
+	return strconv.Atoi(match[1])
+}
+
+//serverVersion detects the major version of the target PostgreSQL with pg_config
+func serverVersion() (int, error) {
+	out, err := exec.Command(pgConfigPath(), "--version").Output()
+	if err != nil {
+		return 0, fmt.Errorf("Cannot run pg_config: %w", err)
+	}
+	return parseServerVersion(string(out))
+}
+
+//checkServerVersion returns an error if the target server is older than supported or lacks an feature used by the extension,
+//the version 0 is unknown and isn't checked
+func checkServerVersion(version int, features []string) error {
+	if version == 0 {
+		return nil
+	}
+	if version < minServerVersion {
+		return fmt.Errorf("PostgreSQL %d is not supported, plgo needs PostgreSQL %d or later", version, minServerVersion)
+	}
+	var missing []string
+	for _, feature := range features {
+		if since := serverFeatures[feature]; version < since {
+			missing = append(missing, fmt.Sprintf("%s (PostgreSQL %d)", feature, since))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("The extension uses features missing in PostgreSQL %d: %s", version, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    int
+		valid   bool
+	}{
+		{"PostgreSQL 15.4 (Debian 15.4-1.pgdg120+1)\n", 15, true},
+		{"PostgreSQL 16.0", 16, true},
+		{"PostgreSQL 17beta2", 17, true},
+		{"PostgreSQL 9.6.24", 9, true},
+		{"  PostgreSQL 11.22\r\n", 11, true},
+		{"postgres (PostgreSQL) 15.4", 0, false},
+		{"PostgreSQL", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		version, err := parseServerVersion(test.version)
+		if (err == nil) != test.valid || version != test.want {
+			t.Errorf("parseServerVersion(%q) = %d, %v, want %d", test.version, version, err, test.want)
+		}
+	}
+}
+
+func TestCheckServerVersion(t *testing.T) {
+	tests := []struct {
+		version  int
+		features []string
+		//err is the part of the expected error
+		err string
+	}{
+		{0, []string{"trusted"}, ""},
+		{16, []string{"trusted"}, ""},
+		{13, []string{"trusted"}, ""},
+		{11, nil, ""},
+		{12, []string{"trusted"}, "The extension uses features missing in PostgreSQL 12: trusted (PostgreSQL 13)"},
+		{10, nil, "PostgreSQL 10 is not supported, plgo needs PostgreSQL 11 or later"},
+	}
+	for _, test := range tests {
+		err := checkServerVersion(test.version, test.features)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("checkServerVersion(%d, %q) = %v, want %q", test.version, test.features, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//pgxnMakefile is the Makefile of the PGXN distribution run by the PGXN client, it builds the extension with plgo
+//for the pg_config of the client and installs it with the generated PGXS Makefile
+const pgxnMakefile = `PG_CONFIG ?= pg_config
+PLGO ?= plgo
+
+all:
+	PATH="$$(dirname "$$(command -v $(PG_CONFIG))"):$$PATH" $(PLGO) build -o build .
+
+install installcheck: all
+	$(MAKE) -C build $@ PG_CONFIG=$(PG_CONFIG)
+
+clean:
+	rm -rf build
+
+.PHONY: all install installcheck clean
+`
+
+//semverRe matches the versions of PGXN, major.minor.patch with an optional prerelease
+var semverRe = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z-]+)?$`)
+
+//pgxnVersion returns the semantic version of the extension version, 1.2 is 1.2.0
+func pgxnVersion(version string) (string, error) {
+	for _, v := range []string{version, version + ".0", version + ".0.0"} {
+		if semverRe.MatchString(v) {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("Version %s isn't an semantic version required by PGXN, e.g. 1.2.0", version)
+}
+
+//gitMaintainer returns the "name <email>" of the git configuration, "" without it
+func gitMaintainer() string {
+	name, err := exec.Command("git", "config", "user.name").Output()
+	if err != nil {
+		return ""
+	}
+	maintainer := strings.TrimSpace(string(name))
+	if email, err := exec.Command("git", "config", "user.email").Output(); err == nil && len(email) > 1 {
+		maintainer += " <" + strings.TrimSpace(string(email)) + ">"
+	}
+	return maintainer
+}
+
+//pgxnMeta returns META.json of the distribution, https://pgxn.org/spec/
+func (mw *ModuleWriter) pgxnMeta(version, maintainer, license, status string) ([]byte, error) {
+	provides := map[string]interface{}{
+		"file":     "sql/" + mw.PackageName + "--" + mw.Version + ".sql",
+		"version":  version,
+		"abstract": mw.comment(),
+	}
+	meta := map[string]interface{}{
+		"name":           mw.PackageName,
+		"abstract":       mw.comment(),
+		"version":        version,
+		"maintainer":     maintainer,
+		"license":        license,
+		"release_status": status,
+		"provides":       map[string]interface{}{mw.PackageName: provides},
+		"generated_by":   "plgo",
+		"meta-spec":      map[string]string{"version": "1.0.0", "url": "https://pgxn.org/meta/spec.txt"},
+	}
+	if strings.TrimSpace(mw.Doc) != "" {
+		meta["description"] = mw.description()
+	}
+	if requires := mw.requiredExtensions(); len(requires) > 0 {
+		prereqs := make(map[string]string, len(requires))
+		for _, extension := range requires {
+			prereqs[extension] = "0"
+		}
+		meta["prereqs"] = map[string]interface{}{"runtime": map[string]interface{}{"requires": prereqs}}
+	}
+	//the maintainer isn't escaped, "name <email>"
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(meta)
+	return data.Bytes(), err
+}
+
+//packagePGXN writes the PGXN distribution <extension>-<version>.zip into the build directory: the sources of the package,
+//META.json, the Makefile building the extension with plgo and the extension script as sql/<extension>--<version>.sql.
+//The PGXN client needs Go and plgo to install it
+func packagePGXN(args []string) error {
+	flags := flag.NewFlagSet("package pgxn", flag.ExitOnError)
+	buildDir := flags.String("build", "build", "directory of the built extension")
+	maintainer := flags.String("maintainer", "", "maintainer of the distribution, \"name <email>\" of git config by default")
+	license := flags.String("license", "unknown", "license of the distribution, e.g. postgresql, mit or apache_2_0")
+	status := flags.String("status", "stable", "release status, stable, testing or unstable")
+	flags.Parse(args)
+	moduleWriter, err := builtExtension(flags, *buildDir)
+	if err != nil {
+		return err
+	}
+	if *maintainer == "" {
+		if *maintainer = gitMaintainer(); *maintainer == "" {
+			return fmt.Errorf("Cannot find the maintainer in git config, set it with -maintainer")
+		}
+	}
+	switch *status {
+	case "stable", "testing", "unstable":
+	default:
+		return fmt.Errorf("Release status %s isn't stable, testing or unstable", *status)
+	}
+	version, err := pgxnVersion(moduleWriter.Version)
+	if err != nil {
+		return err
+	}
+	meta, err := moduleWriter.pgxnMeta(version, *maintainer, *license, *status)
+	if err != nil {
+		return err
+	}
+	script := moduleWriter.PackageName + "--" + moduleWriter.Version + ".sql"
+	scriptData, err := ioutil.ReadFile(filepath.Join(*buildDir, script))
+	if err != nil {
+		return err
+	}
+	dist := moduleWriter.PackageName + "-" + version
+	path := filepath.Join(*buildDir, dist+".zip")
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	generated := map[string][]byte{"META.json": meta, "Makefile": []byte(pgxnMakefile), "sql/" + script: scriptData}
+	for _, name := range []string{"META.json", "Makefile", "sql/" + script} {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: dist + "/" + name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(generated[name]); err != nil {
+			return err
+		}
+	}
+	if err = addPackageSources(archive, dist, moduleWriter.path, *buildDir, generated); err != nil {
+		return err
+	}
+	if err = archive.Close(); err != nil {
+		return err
+	}
+	fmt.Println("Wrote", path)
+	return nil
+}
+
+//addPackageSources adds the files of the package directory into the directory of the archive,
+//without the hidden files, the build directory and the generated files
+func addPackageSources(archive *zip.Writer, dir, packagePath, buildDir string, generated map[string][]byte) error {
+	absBuild, err := filepath.Abs(buildDir)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(packagePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(packagePath, path)
+		if err != nil || name == "." {
+			return err
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") || abs == absBuild {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name = filepath.ToSlash(name)
+		if info.IsDir() || generated[name] != nil {
+			return nil
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name, header.Method = dir+"/"+name, zip.Deflate
+		w, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		source, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		_, err = io.Copy(w, source)
+		return err
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+//writeFiles writes the files by their slash separated paths into the directory
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+//extensionSource is the package of an extension using the hstore extension
+const extensionSource = `//Package ext tags
+//the rows.
+//
+//plgo:version 1.2
+package main
+
+//Tags returns the number of the tags
+func Tags(tags map[string]*string) int32 { return int32(len(tags)) }
+`
+
+func TestPGXNVersion(t *testing.T) {
+	tests := []struct {
+		version, want string
+	}{
+		{"1", "1.0.0"},
+		{"1.2", "1.2.0"},
+		{"1.2.3", "1.2.3"},
+		{"1.2.3-beta1", "1.2.3-beta1"},
+		{"1.2.3.4", ""},
+		{"v1.2", ""},
+		{"1.2beta", ""},
+	}
+	for _, test := range tests {
+		version, err := pgxnVersion(test.version)
+		if version != test.want || (err == nil) != (test.want != "") {
+			t.Errorf("pgxnVersion(%q) = %q, %v, want %q", test.version, version, err, test.want)
+		}
+	}
+}
+
+func TestPackagePGXN(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ext")
+	writeFiles(t, dir, map[string]string{
+		"ext.go":                    extensionSource,
+		"sql/post.sql":              "SELECT 1;\n",
+		".git/HEAD":                 "ref: refs/heads/main\n",
+		"build/ext.manifest.json":   `{"extension": "ext", "version": "1.2", "functions": []}`,
+		"build/ext--1.2.sql":        "CREATE FUNCTION tags(tags hstore) RETURNS integer AS 'MODULE_PATHNAME', 'Tags' LANGUAGE c;\n",
+		"build/ext--1.2.sql.backup": "",
+	})
+	buildDir := filepath.Join(dir, "build")
+	if err := packagePGXN([]string{"-build", buildDir, "-maintainer", "Jo <jo@example.com>", "-license", "mit", dir}); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.OpenReader(filepath.Join(buildDir, "ext-1.2.0.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	var names []string
+	var meta map[string]interface{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+		if file.Name != "ext-1.2.0/META.json" {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(r).Decode(&meta)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Strings(names)
+	want := []string{"ext-1.2.0/META.json", "ext-1.2.0/Makefile", "ext-1.2.0/ext.go", "ext-1.2.0/sql/ext--1.2.sql", "ext-1.2.0/sql/post.sql"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("files of the distribution %q, want %q", names, want)
+	}
+	for key, value := range map[string]interface{}{
+		"name":        "ext",
+		"version":     "1.2.0",
+		"maintainer":  "Jo <jo@example.com>",
+		"license":     "mit",
+		"description": "Package ext tags the rows.",
+		"prereqs":     map[string]interface{}{"runtime": map[string]interface{}{"requires": map[string]interface{}{"hstore": "0"}}},
+	} {
+		if !reflect.DeepEqual(meta[key], value) {
+			t.Errorf("META.json %s is %v, want %v", key, meta[key], value)
+		}
+	}
+	if err := packagePGXN([]string{"-build", buildDir, "-maintainer", "Jo", "-status", "beta", dir}); err == nil {
+		t.Error("packagePGXN accepted the release status beta")
+	}
+}
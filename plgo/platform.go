@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+//pgInstallation are the directories of the target PostgreSQL installation, read with its pg_config
+type pgInstallation struct {
+	//IncludeServer are the server headers, PkgLibDir the shared objects of the extensions,
+	//ShareDir/extension the control files and the scripts of the extensions, BinDir the programs
+	IncludeServer, PkgLibDir, ShareDir, BinDir string
+}
+
+//pgConfig is the pg_config of the target installation set in plgo.toml, "" to look it up
+var pgConfig string
+
+//makePgConfig returns the PG_CONFIG of the generated Makefile, the pg_config of plgo.toml or of plgo build -pg
+func makePgConfig() string {
+	if pgConfig == "" {
+		return "pg_config"
+	}
+	return pgConfig
+}
+
+//detectInstallation reads the directories of the installation of the pg_config found by pgConfigPath
+func detectInstallation() (*pgInstallation, error) {
+	pg := &pgInstallation{}
+	dirs := []struct {
+		flag string
+		dir  *string
+	}{{"--includedir-server", &pg.IncludeServer}, {"--pkglibdir", &pg.PkgLibDir}, {"--sharedir", &pg.ShareDir}, {"--bindir", &pg.BinDir}}
+	for _, d := range dirs {
+		out, err := exec.Command(pgConfigPath(), d.flag).Output()
+		if err != nil {
+			return nil, fmt.Errorf("Cannot run pg_config: %w", err)
+		}
+		*d.dir = longPath(strings.TrimSpace(string(out)))
+	}
+	return pg, nil
+}
+
+//buildPlatform is the platform specific part of the build of the shared object, selected by GOOS:
+//the cgo flags of the runtime, the import library of the server on windows and the installation of the built extension
+type buildPlatform struct {
+	GOOS string
+}
+
+//currentPlatform returns the platform plgo runs on
+func currentPlatform() buildPlatform {
+	return buildPlatform{GOOS: runtime.GOOS}
+}
+
+//windows reports if the platform is windows, the extensions are built with MinGW (MSYS2) gcc
+func (p buildPlatform) windows() bool {
+	return p.GOOS == "windows"
+}
+
+//libraryExt returns the extension of the shared object
+func (p buildPlatform) libraryExt() string {
+	if p.windows() {
+		return ".dll"
+	}
+	return ".so"
+}
+
+//importLibrary is the name of the import library of postgres.exe generated for MinGW into the build path,
+//the postgres.lib of the installation built by MSVC can't be used by gcc
+const importLibrary = "postgres"
+
+//cgoDirectives returns the #cgo lines of the runtime for the installation, the build path is the temporary module
+func (p buildPlatform) cgoDirectives(pg *pgInstallation, buildPath string) string {
+	if !p.windows() {
+		return "#cgo CFLAGS: -I\"" + pg.IncludeServer + "\" -fpic\n#cgo LDFLAGS: -shared\n"
+	}
+	include := filepath.ToSlash(pg.IncludeServer)
+	return "#cgo CFLAGS: -I\"" + include + "\" -I\"" + include + "/port/win32\" -DHAVE_LONG_LONG_INT_64\n" +
+		"#cgo LDFLAGS: -L\"" + filepath.ToSlash(buildPath) + "\" -l" + importLibrary + "\n"
+}
+
+//cgoLineRe matches the #cgo lines of the runtime, they are replaced by the lines of the platform
+var cgoLineRe = regexp.MustCompile(`(?m)^#cgo .*\n`)
+
+//setCgoDirectives replaces the #cgo lines of the runtime source with the directives
+func setCgoDirectives(source, directives string) string {
+	first := true
+	return cgoLineRe.ReplaceAllStringFunc(source, func(string) string {
+		if first {
+			first = false
+			return directives
+		}
+		return ""
+	})
+}
+
+//prepare prepares the build path for the build, on windows it generates the import library of postgres.exe
+//with gendef and dlltool (mingw-w64-tools and binutils of MSYS2)
+func (p buildPlatform) prepare(pg *pgInstallation, buildPath string) error {
+	if !p.windows() {
+		return nil
+	}
+	postgres := filepath.Join(pg.BinDir, "postgres.exe")
+	def := filepath.Join(buildPath, importLibrary+".def")
+	out, err := exec.Command("gendef", "-", postgres).Output()
+	if err != nil {
+		return fmt.Errorf("Cannot run gendef (pacman -S mingw-w64-x86_64-tools-git): %w", err)
+	}
+	if err = ioutil.WriteFile(def, out, 0644); err != nil {
+		return err
+	}
+	dlltool := exec.Command("dlltool", "-D", postgres, "-d", def, "-l", filepath.Join(buildPath, "lib"+importLibrary+".a"))
+	if out, err = dlltool.CombinedOutput(); err != nil {
+		return fmt.Errorf("Cannot create the import library with dlltool: %s %s", err, out)
+	}
+	return nil
+}
+
+//writeInstall writes the installation of the built extension on windows, install.cmd copying the files
+//into the installation, pgxs (make install) isn't used there. It returns the instructions for the user
+func (p buildPlatform) writeInstall(pg *pgInstallation, packageName, output string) (string, error) {
+	if !p.windows() {
+		return "", nil
+	}
+	extensionDir := filepath.Join(pg.ShareDir, "extension")
+	script := "@echo off\r\n" +
+		"rem installs the " + packageName + " extension into " + filepath.Dir(pg.BinDir) + "\r\n" +
+		"copy /Y \"%~dp0" + packageName + ".dll\" \"" + pg.PkgLibDir + "\" || exit /b 1\r\n" +
+		"copy /Y \"%~dp0" + packageName + ".control\" \"" + extensionDir + "\" || exit /b 1\r\n" +
+		"copy /Y \"%~dp0" + packageName + "--*.sql\" \"" + extensionDir + "\" || exit /b 1\r\n"
+	if err := ioutil.WriteFile(filepath.Join(output, "install.cmd"), []byte(script), 0644); err != nil {
+		return "", err
+	}
+	return "Run " + filepath.Join(output, "install.cmd") + " as an administrator to install the extension into " + filepath.Dir(pg.BinDir), nil
+}
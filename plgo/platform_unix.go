@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+//pgConfigPath returns the pg_config of the target installation, the one of plgo.toml or found in PATH
+func pgConfigPath() string {
+	if pgConfig != "" {
+		return pgConfig
+	}
+	return "pg_config"
+}
+
+//pgConfigCandidates returns the paths of the pg_config of the major version in the usual installations:
+//the Debian and Ubuntu packages, the PGDG RPM packages and Homebrew
+func pgConfigCandidates(version string) []string {
+	return []string{
+		"/usr/lib/postgresql/" + version + "/bin/pg_config",
+		"/usr/pgsql-" + version + "/bin/pg_config",
+		"/opt/homebrew/opt/postgresql@" + version + "/bin/pg_config",
+		"/usr/local/opt/postgresql@" + version + "/bin/pg_config",
+	}
+}
+
+//longPath returns the path, the short (8.3) names are only on windows
+func longPath(path string) string {
+	return path
+}
@@ -0,0 +1,84 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+//installationsKey is the registry key of the installations of the EDB PostgreSQL installer
+const installationsKey = `SOFTWARE\PostgreSQL\Installations`
+
+//pgConfigPath returns the pg_config of the target installation: the one of plgo.toml, in %PGROOT%\bin, in PATH
+//or of the newest installation registered by the PostgreSQL installer
+func pgConfigPath() string {
+	if pgConfig != "" {
+		return pgConfig
+	}
+	if root := os.Getenv("PGROOT"); root != "" {
+		return filepath.Join(root, "bin", "pg_config.exe")
+	}
+	if path, err := exec.LookPath("pg_config"); err == nil {
+		return path
+	}
+	if root := registeredInstallation(); root != "" {
+		return filepath.Join(root, "bin", "pg_config.exe")
+	}
+	return "pg_config"
+}
+
+//pgConfigCandidates returns the paths of the pg_config of the major version in the installations of the EDB installer
+func pgConfigCandidates(version string) []string {
+	var candidates []string
+	for _, env := range []string{"ProgramFiles", "ProgramW6432"} {
+		if dir := os.Getenv(env); dir != "" {
+			candidates = append(candidates, filepath.Join(dir, "PostgreSQL", version, "bin", "pg_config.exe"))
+		}
+	}
+	return candidates
+}
+
+//registeredInstallation returns the base directory of the last installation in the registry, "" if there is none
+func registeredInstallation() string {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, installationsKey, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+	names, err := key.ReadSubKeyNames(-1)
+	if err != nil {
+		return ""
+	}
+	var base string
+	for _, name := range names {
+		installation, err := registry.OpenKey(key, name, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		if dir, _, err := installation.GetStringValue("Base Directory"); err == nil {
+			base = dir
+		}
+		installation.Close()
+	}
+	return base
+}
+
+//longPath returns the long form of the short (8.3) path printed by pg_config, the path if it can't be converted
+func longPath(path string) string {
+	short, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return path
+	}
+	b := make([]uint16, windows.MAX_LONG_PATH)
+	n, err := windows.GetLongPathName(short, &b[0], uint32(len(b)))
+	if err != nil || n == 0 || int(n) > len(b) {
+		return path
+	}
+	return windows.UTF16ToString(b[:n])
+}
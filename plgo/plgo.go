@@ -1,39 +1,351 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
+	"regexp"
+	"strings"
 )
 
 func printUsage() {
-	fmt.Println(`Usage: plgo [-v] [path/to/package]`)
+	fmt.Println(`Usage: plgo [build] [-v] [-debug] [-keep-temp] [-plgo-source dir] [-restricted] [-seccomp] [-docker postgres:16] [extension flags] [path/to/package]
+       plgo test [-dsn conninfo] [-go ./packages/...] [-keep-cluster] [build flags] [path/to/package]
+       plgo sql [extension flags] [path/to/package]
+       plgo upgrade [extension flags] previous.sql [path/to/package]
+       plgo doc [-format markdown|html] [-o file] [-version 0.1] [-codecs] [path/to/package]
+       plgo watch [-db conninfo] [-interval 1s] [build flags] [path/to/package]
+       plgo new [-module path] path/to/extension
+       plgo check [-build build] [-accept] [path/to/package]
+       plgo clean
+       plgo package docker [-build build] [-image postgres:16] [path/to/package]
+       plgo package pgxn [-build build] [-maintainer 'name <email>'] [-license unknown] [-status stable] [path/to/package]
+       plgo package deb|rpm [-build build] [-maintainer 'name <email>'] [-license unknown] [-pg 16] [path/to/package]
+       plgo verify-upgrade [-build build] previous.manifest.json
+       plgo migrate (-db conninfo [-schema public] | -dump dump.sql) [-o file.go]
+extension flags: [-o build] [-pg 15,16] [-tags tag,...] [-version 0.1] [-codecs] [-trusted] [-schema name] [-with-regress] [-print-sql] [control file flags]`)
 	flag.PrintDefaults()
 }
 
-func buildPackage(buildPath, packageName string) error {
+//commands are the subcommands of plgo, without a subcommand plgo builds the extension
+var commands = map[string]func(args []string) error{
+	"build":          buildExtension,
+	"test":           testExtension,
+	"sql":            writeSQLOnly,
+	"upgrade":        writeUpgrade,
+	"doc":            writeDoc,
+	"verify-upgrade": verifyUpgrade,
+	"check":          check,
+	"new":            newProject,
+	"clean":          clean,
+	"watch":          watchExtension,
+	"package":        packageExtension,
+	"migrate":        migrate,
+}
+
+//makeBuildDir creates the build directory if it doesn't exist
+func makeBuildDir(dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return os.MkdirAll(dir, 0744)
+	}
+	return nil
+}
+
+//extensionFlags are the flags of the extension shared by plgo build, sql and upgrade
+type extensionFlags struct {
+	output, pg, tags, version, schema  string
+	codecs, trusted, regress, printSQL bool
+	control                            *controlFlags
+}
+
+//addExtensionFlags defines the flags of the extension shared by plgo build, sql and upgrade in the flag set
+func addExtensionFlags(flags *flag.FlagSet) *extensionFlags {
+	e := &extensionFlags{}
+	flags.StringVar(&e.output, "o", "build", "output directory of the extension files and the shared object")
+	flags.StringVar(&e.pg, "pg", "", "comma separated major versions of PostgreSQL, e.g. 15,16, the extension is written for each with its pg_config into <output>/pg<version>, the version of pg_config by default")
+	flags.StringVar(&e.tags, "tags", "", "comma separated build tags selecting the files of the package, passed to go build")
+	flags.StringVar(&e.version, "version", "", "version of the extension, the //plgo:version directive of the package doc or 0.1 by default")
+	flags.BoolVar(&e.codecs, "codecs", false, "add the compression (zstd, lz4, gzip, zlib, deflate) and encoding (base64, hex) SQL functions, the build needs the modules "+strings.Join(codecModules, " and ")+" in the module of the package")
+	flags.BoolVar(&e.trusted, "trusted", false, "mark the extension as trusted, installable by non-superusers (PostgreSQL 13)")
+	flags.StringVar(&e.schema, "schema", "", "schema of the SQL objects, declared in the control file, relocatable extension by default")
+	flags.BoolVar(&e.regress, "with-regress", false, "scaffold the pg_regress test sql/<extension>_test.sql of the package and enable REGRESS in the Makefile")
+	flags.BoolVar(&e.printSQL, "print-sql", false, "print the generated extension script to stdout")
+	e.control = addControlFlags(flags)
+	return e
+}
+
+//moduleWriter returns the module writer of the package with the build tags of the flags and the settings of the other flags
+func (e *extensionFlags) moduleWriter(packagePath string) (*ModuleWriter, error) {
+	moduleWriter, err := NewModuleWriter(packagePath, splitList(e.tags)...)
+	if err != nil {
+		return nil, err
+	}
+	if e.version != "" {
+		moduleWriter.Version = e.version
+	}
+	moduleWriter.Trusted = moduleWriter.Trusted || e.trusted
+	moduleWriter.Regress = e.regress
+	e.control.apply(moduleWriter.config)
+	if e.schema != "" {
+		if err = moduleWriter.SetSchema(e.schema); err != nil {
+			return nil, err
+		}
+	}
+	if e.codecs {
+		moduleWriter.EnableCodecs()
+	}
+	return moduleWriter, nil
+}
+
+//writeSQLOnly regenerates the extension files without compiling the shared object,
+//for the changes of signatures, comments, grants or version of an already built extension
+func writeSQLOnly(args []string) error {
+	flags := flag.NewFlagSet("sql", flag.ExitOnError)
+	extension := addExtensionFlags(flags)
+	flags.Parse(args)
+	packagePath := "."
+	if flags.NArg() == 1 {
+		packagePath = flags.Arg(0)
+	}
+	moduleWriter, err := extension.moduleWriter(packagePath)
+	if err != nil {
+		return err
+	}
+	targets, err := pgTargets(extension.pg, extension.output)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		moduleWriter.ServerVersion = target.version
+		if err = checkServerVersion(moduleWriter.ServerVersion, moduleWriter.serverFeatures()); err != nil {
+			return err
+		}
+		if err = makeBuildDir(target.output); err != nil {
+			return err
+		}
+		if err = moduleWriter.WriteExtensionFiles(target.output); err != nil {
+			return err
+		}
+		if extension.printSQL {
+			if err = moduleWriter.writeScript(os.Stdout); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//writeUpgrade writes the extension files with the script upgrading the extension from the previous release,
+//the script is generated from the differences between the previous extension script and the current one
+func writeUpgrade(args []string) error {
+	flags := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	extension := addExtensionFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		return fmt.Errorf("Usage: plgo upgrade [-o build] [-pg 15,16] [-tags tag,...] [-version 0.2] [-codecs] [-trusted] [-schema name] previous.sql [path/to/package]")
+	}
+	packagePath := "."
+	if flags.NArg() == 2 {
+		packagePath = flags.Arg(1)
+	}
+	moduleWriter, err := extension.moduleWriter(packagePath)
+	if err != nil {
+		return err
+	}
+	previousPath := flags.Arg(0)
+	match := regexp.MustCompile(`^` + regexp.QuoteMeta(moduleWriter.PackageName) + `--([^-]+)\.sql$`).FindStringSubmatch(filepath.Base(previousPath))
+	if match == nil {
+		return fmt.Errorf("%s isn't an script of the %s extension (%s--<version>.sql)", previousPath, moduleWriter.PackageName, moduleWriter.PackageName)
+	}
+	if match[1] == moduleWriter.Version {
+		return fmt.Errorf("The version is still %s, raise it with -version or //plgo:version", moduleWriter.Version)
+	}
+	scriptName := upgradeScriptName(moduleWriter.PackageName, match[1], moduleWriter.Version)
+	if _, err = os.Stat(filepath.Join(packagePath, "sql", scriptName)); err == nil {
+		return fmt.Errorf("The upgrade script sql/%s is written by hand, edit it instead", scriptName)
+	}
+	previous, err := ioutil.ReadFile(previousPath)
+	if err != nil {
+		return err
+	}
+	targets, err := pgTargets(extension.pg, extension.output)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		moduleWriter.ServerVersion = target.version
+		if err = checkServerVersion(moduleWriter.ServerVersion, moduleWriter.serverFeatures()); err != nil {
+			return err
+		}
+		var current bytes.Buffer
+		if err = moduleWriter.writeScript(&current); err != nil {
+			return err
+		}
+		if err = makeBuildDir(target.output); err != nil {
+			return err
+		}
+		if err = moduleWriter.WriteExtensionFiles(target.output); err != nil {
+			return err
+		}
+		if extension.printSQL {
+			os.Stdout.Write(current.Bytes())
+		}
+		script := upgradeScript(moduleWriter.PackageName, moduleWriter.Version, string(previous), current.String())
+		scriptPath := filepath.Join(target.output, scriptName)
+		if err = ioutil.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+			return err
+		}
+		fmt.Println("Wrote", scriptPath)
+	}
+	return nil
+}
+
+//writeDoc writes the documentation of the SQL API of the extension, build/<extension>.md or .html by default
+func writeDoc(args []string) error {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+	format := flags.String("format", "markdown", "format of the documentation: markdown or html")
+	output := flags.String("o", "", "output file")
+	version := flags.String("version", "", "version of the extension, the //plgo:version directive of the package doc or 0.1 by default")
+	codecs := flags.Bool("codecs", false, "document the codec functions added by plgo -codecs")
+	flags.Parse(args)
+	if *format != "markdown" && *format != "html" {
+		return fmt.Errorf("Unknown documentation format %s, use markdown or html", *format)
+	}
+	packagePath := "."
+	if flags.NArg() == 1 {
+		packagePath = flags.Arg(0)
+	}
+	moduleWriter, err := NewModuleWriter(packagePath)
+	if err != nil {
+		return err
+	}
+	if *version != "" {
+		moduleWriter.Version = *version
+	}
+	if *codecs {
+		moduleWriter.EnableCodecs()
+	}
+	if *output == "" {
+		if err = makeBuildDir("build"); err != nil {
+			return err
+		}
+		ext := ".md"
+		if *format == "html" {
+			ext = ".html"
+		}
+		*output = filepath.Join("build", moduleWriter.PackageName+ext)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err = WriteDoc(moduleWriter.Manifest(), *format, file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+//migrate writes the Go stubs of the PL/pgSQL functions read from the database or from the dump
+func migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	conninfo := flags.String("db", "", "connection string of the database, passed to psql")
+	schema := flags.String("schema", "public", "schema of the functions in the database")
+	dump := flags.String("dump", "", "SQL dump with the functions, e.g. from pg_dump --schema-only")
+	output := flags.String("o", "", "output Go file, the standard output by default")
+	flags.Parse(args)
+	var functions []plpgsqlFunction
+	switch {
+	case *dump != "" && *conninfo == "":
+		data, err := ioutil.ReadFile(*dump)
+		if err != nil {
+			return err
+		}
+		functions = readDumpFunctions(string(data))
+	case *conninfo != "" && *dump == "":
+		var err error
+		if functions, err = readDatabaseFunctions(*conninfo, *schema); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Usage: plgo migrate (-db conninfo [-schema public] | -dump dump.sql) [-o file.go]")
+	}
+	if *output == "" {
+		return WriteStubs(functions, os.Stdout)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err = WriteStubs(functions, file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+//verifyUpgrade checks the upgrade path from the previous release to the current build
+func verifyUpgrade(args []string) error {
+	flags := flag.NewFlagSet("verify-upgrade", flag.ExitOnError)
+	buildDir := flags.String("build", "build", "directory of the current build")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: plgo verify-upgrade [-build build] previous.manifest.json")
+	}
+	previous, err := ReadManifest(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	current, err := ReadManifest(manifestPath(*buildDir, previous.Extension))
+	if err != nil {
+		return err
+	}
+	problems, err := VerifyUpgrade(previous, current, *buildDir)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("Upgrade from %s to %s would break:\n%s", previous.Version, current.Version, strings.Join(problems, "\n"))
+	}
+	fmt.Printf("Upgrade of %s from %s to %s is valid\n", current.Extension, previous.Version, current.Version)
+	return nil
+}
+
+//buildPackage builds the shared object of the temporary module in goDir, "" the current directory,
+//with the build tags, env are the additional environment variables of go build
+func buildPackage(buildPath, goDir, outputDir, packageName string, files, buildTags []string, env []string) error {
 	if err := os.Setenv("CGO_LDFLAGS_ALLOW", "-shared"); err != nil {
 		return err
 	}
+	//the go command can run in the copy of the module
+	outputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return err
+	}
 	switchx := "-v" // substitutor
 	if verbose {
 		switchx = "-x"
 	}
-	fileExt := ".so"
-	if runtime.GOOS == "windows" {
-		fileExt = ".dll"
-	}
-	goBuild := exec.Command("go", "build", switchx,
+	args := []string{"build", switchx,
 		"-buildmode=c-shared",
-		"-o", filepath.Join("build", packageName+fileExt),
-		filepath.Join(buildPath, "package.go"),
-		filepath.Join(buildPath, "methods.go"),
-		filepath.Join(buildPath, "pl.go"),
-	)
+		"-o", filepath.Join(outputDir, packageName+currentPlatform().libraryExt()),
+	}
+	if len(buildTags) > 0 {
+		args = append(args, "-tags", strings.Join(buildTags, ","))
+	}
+	args = append(args, workspaceBuildFlags()...)
+	for _, file := range files {
+		args = append(args, filepath.Join(buildPath, file))
+	}
+	goBuild := exec.Command("go", args...)
+	goBuild.Dir = goDir
+	goBuild.Env = append(os.Environ(), env...)
+	debugCommand(goBuild, env)
 	goBuild.Stdout = os.Stdout
 	goBuild.Stderr = os.Stderr
 	if err := goBuild.Run(); err != nil {
@@ -44,50 +356,141 @@ func buildPackage(buildPath, packageName string) error {
 
 var verbose bool
 
-func main() {
+//buildExtension builds the shared object and writes the extension files into the output directory,
+//the temporary module of the build is kept in the build cache for the rebuilds
+func buildExtension(args []string) error {
+	var image string
+	flag.StringVar(&image, "docker", "", "build the extension in an container of the Debian based postgres image, e.g. postgres:16")
+	build, extension := parseBuildFlags(args)
+	if image != "" {
+		if extension.pg != "" {
+			return fmt.Errorf("-docker builds for the PostgreSQL version of the image, it can't be combined with -pg")
+		}
+		packagePath := "."
+		if flag.NArg() == 1 {
+			packagePath = flag.Arg(0)
+		}
+		return buildInDocker(image, packagePath, extension.output)
+	}
+	if extension.pg != "" {
+		return buildMatrix(build, extension.output, extension.pg)
+	}
+	_, _, err := build(extension.output)
+	return err
+}
+
+//buildModule builds the extension with the build flags in args, it returns the module writer of the package
+//and the output directory
+func buildModule(args []string) (*ModuleWriter, string, error) {
+	build, extension := parseBuildFlags(args)
+	output, err := usePgVersion(extension.pg, extension.output)
+	if err != nil {
+		return nil, "", err
+	}
+	return build(output)
+}
+
+//parseBuildFlags parses the build flags in args, it returns the function building the extension with them into the output directory,
+//e.g. to rebuild it in plgo watch, and the flags of the extension with the output directory of -o
+func parseBuildFlags(args []string) (func(output string) (*ModuleWriter, string, error), *extensionFlags) {
+	var restricted, seccomp, keepTemp bool
 	flag.BoolVar(&verbose, "v", false, "be verbose, 'go build -x'")
-	flag.Parse()
+	flag.BoolVar(&debugMode, "debug", false, "log the generated files, the go build and make commands and the cgo flags, implies -keep-temp")
+	flag.BoolVar(&keepTemp, "keep-temp", false, "log the path of the temporary module in the build cache, it's kept until the next build of the package, for debugging")
+	flag.StringVar(&plgoSource, "plgo-source", "", "directory of the plgo runtime used instead of the one embedded in plgo, for its development")
+	flag.BoolVar(&restricted, "restricted", false, "reject the packages using the file system and the network in the source of the package (an static check, -seccomp guards the run time)")
+	flag.BoolVar(&seccomp, "seccomp", false, "restricted mode with an seccomp filter denying the file system and the network sockets to the extension code at run time (linux)")
+	extension := addExtensionFlags(flag.CommandLine)
+	flag.CommandLine.Parse(args)
 	packagePath := "."
 	if len(flag.Args()) == 1 {
 		packagePath = flag.Arg(0)
 	}
-	moduleWriter, err := NewModuleWriter(packagePath)
-	if err != nil {
-		fmt.Println(err)
-		printUsage()
-		return
-	}
-	tempPackagePath, err := moduleWriter.WriteModule()
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	log.Println(tempPackagePath)
-	if _, err = os.Stat("build"); os.IsNotExist(err) {
-		err = os.Mkdir("build", 0744)
+	return func(output string) (*ModuleWriter, string, error) {
+		moduleWriter, err := extension.moduleWriter(packagePath)
+		if err != nil {
+			printUsage()
+			return nil, "", err
+		}
+		if restricted || seccomp {
+			if err = moduleWriter.CheckRestricted(); err != nil {
+				return nil, "", err
+			}
+			moduleWriter.BuildTags = append(moduleWriter.BuildTags, "plgo_restricted")
+			if seccomp {
+				moduleWriter.BuildTags = append(moduleWriter.BuildTags, "plgo_seccomp")
+			}
+		}
+		//the shared object is built with the headers of the pg_config server
+		if moduleWriter.ServerVersion, err = serverVersion(); err != nil {
+			return nil, "", err
+		}
+		if err = checkServerVersion(moduleWriter.ServerVersion, moduleWriter.serverFeatures()); err != nil {
+			return nil, "", err
+		}
+		//the temporary module is locked until the shared object is built
+		defer moduleWriter.ReleaseModule()
+		tempPackagePath, err := moduleWriter.WriteModule()
+		if err != nil {
+			return nil, "", err
+		}
+		if keepTemp || debugMode {
+			log.Println("temporary module:", tempPackagePath)
+		}
+		for _, name := range moduleWriter.Files() {
+			if isGeneratedFile(name) {
+				debugf("generated %s", filepath.Join(tempPackagePath, name))
+			}
+		}
+		if err = makeBuildDir(output); err != nil {
+			return nil, "", err
+		}
+		env, err := moduleWriter.config.cgoEnv()
+		if err != nil {
+			return nil, "", err
+		}
+		err = buildPackage(tempPackagePath, moduleWriter.GoDir(), output, moduleWriter.PackageName, moduleWriter.Files(), moduleWriter.BuildTags, append(env, moduleWriter.GoEnv()...))
+		if err != nil {
+			return nil, "", err
+		}
+		if err = moduleWriter.WriteExtensionFiles(output); err != nil {
+			return nil, "", err
+		}
+		if extension.printSQL {
+			if err = moduleWriter.writeScript(os.Stdout); err != nil {
+				return nil, "", err
+			}
+		}
+		//pgxs isn't used on windows, the extension is installed by the written script
+		pg, err := detectInstallation()
+		if err != nil {
+			return nil, "", err
+		}
+		instructions, err := currentPlatform().writeInstall(pg, moduleWriter.PackageName, output)
 		if err != nil {
-			fmt.Println(err)
+			return nil, "", err
+		}
+		if instructions != "" {
+			fmt.Println(instructions)
+		}
+		return moduleWriter, output, nil
+	}, extension
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if command, ok := commands[args[0]]; ok {
+			if err := command(args[1:]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
 			return
 		}
 	}
-	err = buildPackage(tempPackagePath, moduleWriter.PackageName)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	err = moduleWriter.WriteSQL("build")
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	err = moduleWriter.WriteControl("build")
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	err = moduleWriter.WriteMakefile("build")
-	if err != nil {
+	//without a subcommand plgo builds the extension
+	if err := buildExtension(args); err != nil {
 		fmt.Println(err)
-		return
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//ProcedureFunction is an function declared with //plgo:procedure, func(params...) or func(params...) error,
+//it is created as an SQL procedure executed with CALL. The procedure called outside of an transaction block
+//can commit and rollback with db.Commit() and db.Rollback()
+type ProcedureFunction struct {
+	VoidFunction
+}
+
+//newProcedureFunction returns the procedure of the function, it has no result besides an error
+//and the only attribute of an procedure is security-definer
+func newProcedureFunction(function VoidFunction, results *ast.FieldList) (*ProcedureFunction, error) {
+	if results != nil {
+		if len(results.List) != 1 || len(results.List[0].Names) > 1 || typeString(results.List[0].Type) != "error" {
+			return nil, fmt.Errorf("Procedure %s can return only an error", function.Name)
+		}
+		function.Error = true
+	}
+	a := function.Attributes
+	if a.Volatility != "immutable" || a.Parallel != "" || a.Cost > 0 || a.Rows > 0 || a.Leakproof {
+		return nil, fmt.Errorf("Procedure %s: only the security-definer attribute is allowed", function.Name)
+	}
+	for _, p := range function.Params {
+		if p.Type == triggerData {
+			return nil, fmt.Errorf("Procedure %s can't be an trigger", function.Name)
+		}
+	}
+	return &ProcedureFunction{VoidFunction: function}, nil
+}
+
+//Code writes the wrapper function, the DB opened by the procedure is nonatomic when it is called by CALL
+func (f *ProcedureFunction) Code(w io.Writer) {
+	w.Write([]byte("//export " + f.Name + "\nfunc " + f.Name + "(fcinfo *funcInfo) Datum {\n"))
+	w.Write([]byte("call := beginProcedure(fcinfo, " + strconv.Quote(f.Name) + ")\ndefer call.end()\n"))
+	if len(f.Params) > 0 {
+		for _, p := range f.Params {
+			w.Write([]byte("var " + p.Name + " " + p.Type + "\n"))
+		}
+		w.Write([]byte("err:=fcinfo.Scan(\n"))
+		for _, p := range f.Params {
+			w.Write([]byte("&" + p.Name + ",\n"))
+		}
+		w.Write([]byte(")\n"))
+		w.Write([]byte(`
+		if(err!=nil){
+			C.elog_error(C.CString(
+				err.Error(),
+			))
+		}
+		`))
+	}
+	f.writeTraceArgs(w)
+	if f.Error {
+		w.Write([]byte("retErr := "))
+	}
+	w.Write([]byte("__" + f.Name + "(\n"))
+	for _, p := range f.Params {
+		w.Write([]byte(p.arg() + ",\n"))
+	}
+	w.Write([]byte(")\n"))
+	f.writeRaise(w)
+	w.Write([]byte("return toDatum(nil)\n"))
+	w.Write([]byte("}\n"))
+}
+
+//SQL writes the SQL command that creates the procedure in DB, the NULL arguments are passed as the zero values
+func (f *ProcedureFunction) SQL(target SQLTarget, w io.Writer) {
+	f.writeRequires(w)
+	w.Write([]byte("CREATE OR REPLACE PROCEDURE " + f.qualifiedName(target) + "("))
+	var paramsString []string
+	for _, p := range f.Params {
+		paramsString = append(paramsString, p.sql())
+	}
+	w.Write([]byte(strings.Join(paramsString, ",")))
+	w.Write([]byte(")\n"))
+	w.Write([]byte("AS " + modulePathname + ", '" + f.Name + "'\n"))
+	if f.Attributes.SecurityDefiner {
+		w.Write([]byte("LANGUAGE c SECURITY DEFINER" + f.searchPath(target) + ";\n"))
+	} else {
+		w.Write([]byte("LANGUAGE c" + f.searchPath(target) + ";\n"))
+	}
+	f.writeGrantsOn("PROCEDURE", target, w)
+	if f.Doc == "" {
+		w.Write([]byte("\n"))
+		return
+	}
+	f.commentOn("PROCEDURE", target, w)
+}
+
+//Describe adds the procedure to the manifest
+func (f *ProcedureFunction) Describe(m *Manifest) {
+	procedure := f.manifestFunction("")
+	procedure.Volatility, procedure.Strict, procedure.Parallel = "", false, ""
+	procedure.Procedure = true
+	m.Functions = append(m.Functions, procedure)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//regressTest returns the name of the pg_regress test of the extension, sql/<name>.sql and expected/<name>.out
+func regressTest(extension string) string {
+	return extension + "_test"
+}
+
+//hasRegressTest reports if the package has the pg_regress test, once scaffolded the REGRESS of the Makefile stays enabled
+func (mw *ModuleWriter) hasRegressTest() bool {
+	_, err := os.Stat(filepath.Join(mw.path, "sql", regressTest(mw.PackageName)+".sql"))
+	return err == nil
+}
+
+//regressArgs are the sample arguments of the seeded calls, the other types are passed as NULL
+var regressArgs = map[string]string{
+	"text":             "'text'",
+	"smallint":         "1",
+	"integer":          "1",
+	"bigint":           "1",
+	"real":             "1.5",
+	"double precision": "1.5",
+	"numeric":          "1.5",
+	"boolean":          "true",
+	"bytea":            `'\x0102'`,
+	"jsonb":            `'{"key": "value"}'`,
+	"json":             `'{"key": "value"}'`,
+	"uuid":             "'a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11'",
+	"date":             "'2024-01-01'",
+	"timestamptz":      "'2024-01-01 12:00:00+00'",
+	"timestamp":        "'2024-01-01 12:00:00'",
+	"interval":         "'1 hour'",
+	"text[]":           "ARRAY['a', 'b']",
+	"integer[]":        "ARRAY[1, 2]",
+	"bigint[]":         "ARRAY[1, 2]",
+}
+
+//regressCall returns the statement calling the function with the sample arguments, "" for the triggers.
+//The arguments are passed in the named notation, so the VARIADIC array is passed as an array
+func regressCall(target SQLTarget, f ManifestFunction) string {
+	if f.Returns == "trigger" || f.Returns == "event_trigger" {
+		return ""
+	}
+	args := make([]string, len(f.Args))
+	for i, t := range f.Args {
+		value, ok := regressArgs[t]
+		if !ok {
+			value = "NULL"
+		}
+		args[i] = value + "::" + t
+		//the window functions are called in the positional notation
+		if i < len(f.ArgNames) && f.ArgNames[i] != "" && !f.Window {
+			args[i] = sqlName(f.ArgNames[i]) + " => " + args[i]
+		}
+	}
+	if f.Schema != "" {
+		target.Schema = f.Schema
+	}
+	call := target.qualify(f.Name) + "(" + strings.Join(args, ", ") + ")"
+	switch {
+	case f.Procedure:
+		return "CALL " + call + ";"
+	case strings.HasPrefix(f.Returns, "SETOF ") || strings.HasPrefix(f.Returns, "TABLE("):
+		return "SELECT * FROM " + call + ";"
+	case f.Window:
+		return "SELECT " + call + " OVER ();"
+	}
+	return "SELECT " + call + ";"
+}
+
+//regressScript returns the seeded pg_regress test, it creates the extension and calls every function of the package
+func (mw *ModuleWriter) regressScript() string {
+	m := &Manifest{}
+	for _, f := range mw.functions {
+		//the runtime functions aren't tested by the extension
+		if _, ok := f.(*BuiltinFunction); !ok {
+			f.Describe(m)
+		}
+	}
+	target := SQLTarget{PackageName: mw.PackageName, Schema: mw.Schema}
+	var script strings.Builder
+	script.WriteString("-- pg_regress test of the " + mw.PackageName + " extension, run by plgo check (make installcheck)\n")
+	script.WriteString("CREATE EXTENSION " + quoteIdent(mw.PackageName) + " CASCADE;\n")
+	for _, f := range m.Functions {
+		if call := regressCall(target, f); call != "" {
+			script.WriteString(call + "\n")
+		}
+	}
+	return script.String()
+}
+
+//ScaffoldRegressTest writes the pg_regress test sql/<extension>_test.sql of the package seeded with the calls
+//of the functions and its expected output expected/<extension>_test.out. The expected output has only the statements,
+//the results are added by plgo check -accept. The existing files are kept
+func (mw *ModuleWriter) ScaffoldRegressTest() error {
+	name := regressTest(mw.PackageName)
+	sqlPath := filepath.Join(mw.path, "sql", name+".sql")
+	if _, err := os.Stat(sqlPath); err == nil {
+		return nil
+	}
+	for _, dir := range []string{"sql", "expected"} {
+		if err := makeBuildDir(filepath.Join(mw.path, dir)); err != nil {
+			return err
+		}
+	}
+	script := mw.regressScript()
+	if err := ioutil.WriteFile(sqlPath, []byte(script), 0644); err != nil {
+		return err
+	}
+	fmt.Println("Wrote", sqlPath)
+	expectedPath := filepath.Join(mw.path, "expected", name+".out")
+	if _, err := os.Stat(expectedPath); err == nil {
+		return nil
+	}
+	if err := ioutil.WriteFile(expectedPath, []byte(script), 0644); err != nil {
+		return err
+	}
+	fmt.Println("Wrote", expectedPath)
+	return nil
+}
+
+//WriteRegressTest copies the pg_regress test of the package next to the Makefile, into sql/ and expected/
+func (mw *ModuleWriter) WriteRegressTest(path string) error {
+	if !mw.hasRegressTest() {
+		return nil
+	}
+	return copyRegressTest(mw.path, path, mw.PackageName)
+}
+
+//copyRegressTest copies the pg_regress test of the extension from the package into the build directory
+func copyRegressTest(packagePath, buildDir, extension string) error {
+	name := regressTest(extension)
+	for _, file := range []string{filepath.Join("sql", name+".sql"), filepath.Join("expected", name+".out")} {
+		data, err := ioutil.ReadFile(filepath.Join(packagePath, file))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err = makeBuildDir(filepath.Join(buildDir, filepath.Dir(file))); err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(filepath.Join(buildDir, file), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//check runs the pg_regress test of the installed extension with make installcheck in the build directory,
+//the server is selected by the PG* environment variables. With -accept the results become the expected output
+func check(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	buildDir := flags.String("build", "build", "directory of the build, with the Makefile")
+	accept := flags.Bool("accept", false, "copy the results of the test into the expected output of the package")
+	flags.Parse(args)
+	packagePath := "."
+	if flags.NArg() == 1 {
+		packagePath = flags.Arg(0)
+	}
+	moduleWriter, err := NewModuleWriter(packagePath)
+	if err != nil {
+		return err
+	}
+	extension := moduleWriter.PackageName
+	if !moduleWriter.hasRegressTest() {
+		return fmt.Errorf("No pg_regress test sql/%s.sql in %s, build with -with-regress to scaffold it", regressTest(extension), packagePath)
+	}
+	//the test edited after the build is checked
+	if err = copyRegressTest(packagePath, *buildDir, extension); err != nil {
+		return err
+	}
+	installcheck := exec.Command("make", "installcheck", "with_llvm=no")
+	installcheck.Dir = *buildDir
+	installcheck.Stdout = os.Stdout
+	installcheck.Stderr = os.Stderr
+	checkErr := installcheck.Run()
+	if !*accept {
+		if checkErr != nil {
+			return fmt.Errorf("make installcheck failed: %s, see %s", checkErr, filepath.Join(*buildDir, "regression.diffs"))
+		}
+		return nil
+	}
+	results, err := ioutil.ReadFile(filepath.Join(*buildDir, "results", regressTest(extension)+".out"))
+	if err != nil {
+		return fmt.Errorf("No results of the test: %w", err)
+	}
+	expectedPath := filepath.Join(packagePath, "expected", regressTest(extension)+".out")
+	if err = ioutil.WriteFile(expectedPath, results, 0644); err != nil {
+		return err
+	}
+	fmt.Println("Wrote", expectedPath)
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+//go:generate go run gen_runtime.go
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+//plgoSource is the directory of the plgo runtime set by -plgo-source,
+//it is used instead of the runtime embedded in the plgo binary (for the development of the runtime)
+var plgoSource string
+
+//runtimeFiles returns the source files of the plgo runtime by their names,
+//read from the plgoSource directory or the embedded ones
+func runtimeFiles() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if plgoSource == "" {
+		for name, source := range embeddedRuntime {
+			files[name] = []byte(source)
+		}
+		return files, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(plgoSource, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range matches {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read plgo package: %w", err)
+		}
+		files[filepath.Base(path)] = source
+	}
+	if _, ok := files["pl.go"]; !ok {
+		return nil, fmt.Errorf("Cannot find pl.go in %s", plgoSource)
+	}
+	return files, nil
+}
+
+//readPlGoSources returns the runtime source files of the plgo package matching the build tags,
+//the files are returned by their file names
+func readPlGoSources(buildTags []string) (map[string][]byte, error) {
+	files, err := runtimeFiles()
+	if err != nil {
+		return nil, err
+	}
+	//the go command ignores the build constraints of files listed on the command line
+	buildContext := build.Default
+	buildContext.BuildTags = buildTags
+	buildContext.CgoEnabled = true
+	buildContext.OpenFile = func(path string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(files[filepath.Base(path)])), nil
+	}
+	sources := make(map[string][]byte)
+	for name, source := range files {
+		if match, err := buildContext.MatchFile(".", name); err != nil || !match {
+			continue
+		}
+		sources[name] = source
+	}
+	return sources, nil
+}
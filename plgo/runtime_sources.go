@@ -0,0 +1,65 @@
+// Code generated by gen_runtime.go; DO NOT EDIT.
+
+package main
+
+// embeddedRuntime are the source files of the plgo runtime by their names
+var embeddedRuntime = map[string]string{
+	"aggregate.go":       "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"utils/memutils.h\"\n\nextern void plgo_aggregate_release(uint64 handle);\nextern Datum get_arg(FunctionCallInfo fcinfo, unsigned int i);\nextern bool arg_is_null(FunctionCallInfo fcinfo, unsigned int i);\n\nstatic void plgo_aggregate_reset(void *arg) {\n\tplgo_aggregate_release((uint64) (uintptr_t) arg);\n}\n\n//plgo_aggregate_register releases the state handle when the aggregate context is reset,\n//it returns 0 if the function isn't called as an aggregate\nint plgo_aggregate_register(FunctionCallInfo fcinfo, uint64 handle) {\n\tMemoryContext aggcontext;\n\tMemoryContextCallback *callback;\n\n\tif (!AggCheckCallContext(fcinfo, &aggcontext))\n\t\treturn 0;\n\tcallback = MemoryContextAlloc(aggcontext, sizeof(MemoryContextCallback));\n\tcallback->func = plgo_aggregate_reset;\n\tcallback->arg = (void *) (uintptr_t) handle;\n\tMemoryContextRegisterResetCallback(aggcontext, callback);\n\treturn 1;\n}\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"sync\"\n\t\"unsafe\"\n)\n\n//aggregateStates are the states of the running aggregates by their handles,\n//the handle is the internal state value of the aggregate in PostgreSQL\nvar (\n\taggregateMu     sync.Mutex\n\taggregateStates = make(map[uint64]interface{})\n\taggregateHandle uint64\n)\n\n//aggregateState returns the state of the aggregate, the first argument of its transition function,\n//and its handle returned as the new state. The first call creates the state with newState,\n//it is released with the memory context of the aggregate\nfunc aggregateState(fcinfo *funcInfo, name string, newState func() interface{}) (Datum, interface{}) {\n\tcfcinfo := (*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo))\n\tif C.arg_is_null(cfcinfo, 0) == (C._Bool)(false) {\n\t\thandle := uint64(C.get_arg(cfcinfo, 0))\n\t\taggregateMu.Lock()\n\t\tstate, ok := aggregateStates[handle]\n\t\taggregateMu.Unlock()\n\t\tif !ok {\n\t\t\tLog.Error(fmt.Sprintf(\"Aggregate %s: state %d not found\", name, handle))\n\t\t}\n\t\treturn Datum(handle), state\n\t}\n\tstate := newState()\n\taggregateMu.Lock()\n\taggregateHandle++\n\thandle := aggregateHandle\n\taggregateStates[handle] = state\n\taggregateMu.Unlock()\n\tif C.plgo_aggregate_register(cfcinfo, C.uint64(handle)) == 0 {\n\t\treleaseAggregate(handle)\n\t\tLog.Error(fmt.Sprintf(\"Aggregate %s: the transition function is called outside of an aggregate\", name))\n\t}\n\treturn Datum(handle), state\n}\n\n//finalState returns the state of the aggregate passed to its final function,\n//the aggregate of no rows has the state created by newState\nfunc finalState(fcinfo *funcInfo, name string, newState func() interface{}) interface{} {\n\tcfcinfo := (*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo))\n\tif C.arg_is_null(cfcinfo, 0) == (C._Bool)(true) {\n\t\treturn newState()\n\t}\n\thandle := uint64(C.get_arg(cfcinfo, 0))\n\taggregateMu.Lock()\n\tstate, ok := aggregateStates[handle]\n\taggregateMu.Unlock()\n\tif !ok {\n\t\tLog.Error(fmt.Sprintf(\"Aggregate %s: state %d not found\", name, handle))\n\t}\n\treturn state\n}\n\n//releaseAggregate forgets the state of the finished aggregate\nfunc releaseAggregate(handle uint64) {\n\taggregateMu.Lock()\n\tdelete(aggregateStates, handle)\n\taggregateMu.Unlock()\n}\n",
+	"audit.go":           "package plgo\n\n//QueryInfo describes an query executed through a Stmt\ntype QueryInfo struct {\n\t//Query is the SQL text of the prepared statement\n\tQuery string\n\t//Args are the query parameters\n\tArgs []interface{}\n\t//Function is the name of the exported function running the query, empty outside of an function call\n\tFunction string\n}\n\n//QueryHook is called before every query executed through a Stmt,\n//an returned error rejects the query\ntype QueryHook func(info QueryInfo) error\n\nvar queryHooks []QueryHook\n\n//AddQueryHook registers an hook that is called before every query executed through a Stmt,\n//e.g. to log all database access of the extension or to enforce an allow-list of queries.\n//If the hook returns an error, the query is not executed and Query, QueryRow or Exec returns the error.\n//It should be called from an init() function of the package\nfunc AddQueryHook(hook QueryHook) {\n\tqueryHooks = append(queryHooks, hook)\n}\n\n//auditQuery runs the query hooks\nfunc auditQuery(q *queryCall) error {\n\tif len(queryHooks) == 0 {\n\t\treturn nil\n\t}\n\tinfo := QueryInfo{Query: q.query, Args: q.args}\n\tif call := currentCall(); call != nil {\n\t\tinfo.Function = call.name\n\t}\n\tfor _, hook := range queryHooks {\n\t\tif err := hook(info); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n\treturn nil\n}\n",
+	"cache.go":           "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"catalog/pg_type.h\"\n#include \"miscadmin.h\"\n#include \"datatype/timestamp.h\"\n#include \"storage/ipc.h\"\n#include \"storage/lwlock.h\"\n#include \"storage/shmem.h\"\n#include \"utils/dsa.h\"\n#include \"utils/memutils.h\"\n#include \"utils/timestamp.h\"\n#include \"lib/dshash.h\"\n\n#define PLGO_CACHE_KEYLEN 128\n\nextern void *plgo_shmem_init_struct(char *name, Size size, bool *found);\n\ntypedef struct plgo_cache_entry {\n\tchar key[PLGO_CACHE_KEYLEN];\n\tdsa_pointer node;\n} plgo_cache_entry;\n\n// plgo_cache_node is an item of the LRU list, the head is the most recently used item\ntypedef struct plgo_cache_node {\n\tchar key[PLGO_CACHE_KEYLEN];\n\tdsa_pointer value;\n\tSize value_len;\n\t// expires is 0 for the items without TTL\n\tTimestampTz expires;\n\tdsa_pointer prev;\n\tdsa_pointer next;\n} plgo_cache_node;\n\ntypedef struct plgo_cache_control {\n\tbool initialized;\n\tint refcount;\n\tint tranche_id;\n\t// lock protects the LRU list and the counters, it's taken before the dshash partition locks\n\tLWLock lock;\n\tdsa_handle area;\n\tdshash_table_handle table;\n\tdsa_pointer head;\n\tdsa_pointer tail;\n\tint64 entries;\n\tint64 size;\n\tint64 hits;\n\tint64 misses;\n\tint64 evictions;\n} plgo_cache_control;\n\ntypedef struct plgo_cache {\n\tplgo_cache_control *control;\n\tdsa_area *area;\n\tdshash_table *table;\n} plgo_cache;\n\ntypedef struct plgo_cache_stats {\n\tint64 entries;\n\tint64 size;\n\tint64 hits;\n\tint64 misses;\n\tint64 evictions;\n} plgo_cache_stats;\n\nstatic void plgo_cache_params(dshash_parameters *params, int tranche_id) {\n\tMemSet(params, 0, sizeof(dshash_parameters));\n\tparams->key_size = PLGO_CACHE_KEYLEN;\n\tparams->entry_size = sizeof(plgo_cache_entry);\n\tparams->compare_function = dshash_memcmp;\n\tparams->hash_function = dshash_memhash;\n#if PG_VERSION_NUM >= 170000\n\tparams->copy_function = dshash_memcpy;\n#endif\n\tparams->tranche_id = tranche_id;\n}\n\nstatic void plgo_cache_detach(int code, Datum arg) {\n\tplgo_cache_control *control = (plgo_cache_control *) DatumGetPointer(arg);\n\tLWLockAcquire(AddinShmemInitLock, LW_EXCLUSIVE);\n\tif (--control->refcount == 0)\n\t\tcontrol->initialized = false;\n\tLWLockRelease(AddinShmemInitLock);\n}\n\nplgo_cache *plgo_cache_attach(char *shmem_name) {\n\tbool found;\n\tdshash_parameters params;\n\tplgo_cache_control *control;\n\tplgo_cache *cache;\n\tMemoryContext old = MemoryContextSwitchTo(TopMemoryContext);\n\n\tcache = palloc0(sizeof(plgo_cache));\n\tLWLockAcquire(AddinShmemInitLock, LW_EXCLUSIVE);\n\tcontrol = plgo_shmem_init_struct(shmem_name, sizeof(plgo_cache_control), &found);\n\tif (!found) {\n\t\tcontrol->initialized = false;\n\t\tcontrol->refcount = 0;\n\t\tcontrol->tranche_id = LWLockNewTrancheId();\n\t\tLWLockInitialize(&control->lock, control->tranche_id);\n\t}\n\tLWLockRegisterTranche(control->tranche_id, \"plgo_cache\");\n\tplgo_cache_params(&params, control->tranche_id);\n\tif (!control->initialized) {\n\t\tcache->area = dsa_create(control->tranche_id);\n\t\tcache->table = dshash_create(cache->area, &params, NULL);\n\t\tcontrol->area = dsa_get_handle(cache->area);\n\t\tcontrol->table = dshash_get_hash_table_handle(cache->table);\n\t\tcontrol->head = InvalidDsaPointer;\n\t\tcontrol->tail = InvalidDsaPointer;\n\t\tcontrol->entries = 0;\n\t\tcontrol->size = 0;\n\t\tcontrol->hits = 0;\n\t\tcontrol->misses = 0;\n\t\tcontrol->evictions = 0;\n\t\tcontrol->initialized = true;\n\t} else {\n\t\tcache->area = dsa_attach(control->area);\n\t\tcache->table = dshash_attach(cache->area, &params, control->table, NULL);\n\t}\n\tdsa_pin_mapping(cache->area);\n\tcontrol->refcount++;\n\tcache->control = control;\n\tLWLockRelease(AddinShmemInitLock);\n\tbefore_shmem_exit(plgo_cache_detach, PointerGetDatum(control));\n\tMemoryContextSwitchTo(old);\n\treturn cache;\n}\n\nstatic plgo_cache_node *plgo_cache_node_at(plgo_cache *cache, dsa_pointer dp) {\n\treturn (plgo_cache_node *) dsa_get_address(cache->area, dp);\n}\n\nstatic void plgo_cache_unlink(plgo_cache *cache, dsa_pointer dp) {\n\tplgo_cache_node *node = plgo_cache_node_at(cache, dp);\n\tif (DsaPointerIsValid(node->prev))\n\t\tplgo_cache_node_at(cache, node->prev)->next = node->next;\n\telse\n\t\tcache->control->head = node->next;\n\tif (DsaPointerIsValid(node->next))\n\t\tplgo_cache_node_at(cache, node->next)->prev = node->prev;\n\telse\n\t\tcache->control->tail = node->prev;\n\tnode->prev = InvalidDsaPointer;\n\tnode->next = InvalidDsaPointer;\n}\n\nstatic void plgo_cache_push_front(plgo_cache *cache, dsa_pointer dp) {\n\tplgo_cache_node *node = plgo_cache_node_at(cache, dp);\n\tnode->prev = InvalidDsaPointer;\n\tnode->next = cache->control->head;\n\tif (DsaPointerIsValid(node->next))\n\t\tplgo_cache_node_at(cache, node->next)->prev = dp;\n\telse\n\t\tcache->control->tail = dp;\n\tcache->control->head = dp;\n}\n\n// plgo_cache_remove removes the item, the caller holds the cache lock and no dshash lock\nstatic void plgo_cache_remove(plgo_cache *cache, dsa_pointer dp) {\n\tplgo_cache_node *node = plgo_cache_node_at(cache, dp);\n\tplgo_cache_unlink(cache, dp);\n\tdshash_delete_key(cache->table, node->key);\n\tcache->control->size -= sizeof(plgo_cache_node) + node->value_len;\n\tcache->control->entries--;\n\tif (DsaPointerIsValid(node->value))\n\t\tdsa_free(cache->area, node->value);\n\tdsa_free(cache->area, dp);\n}\n\nstatic dsa_pointer plgo_cache_lookup(plgo_cache *cache, char *key) {\n\tchar keybuf[PLGO_CACHE_KEYLEN];\n\tplgo_cache_entry *entry;\n\tdsa_pointer dp = InvalidDsaPointer;\n\tMemSet(keybuf, 0, PLGO_CACHE_KEYLEN);\n\tstrlcpy(keybuf, key, PLGO_CACHE_KEYLEN);\n\tentry = dshash_find(cache->table, keybuf, false);\n\tif (entry != NULL) {\n\t\tdp = entry->node;\n\t\tdshash_release_lock(cache->table, entry);\n\t}\n\treturn dp;\n}\n\n// plgo_cache_get returns palloc'd copy of the value, or NULL if the key isn't cached or is expired\nvoid *plgo_cache_get(plgo_cache *cache, char *key, Size *len) {\n\tdsa_pointer dp;\n\tplgo_cache_node *node;\n\tvoid *value = NULL;\n\tLWLockAcquire(&cache->control->lock, LW_EXCLUSIVE);\n\tdp = plgo_cache_lookup(cache, key);\n\tif (DsaPointerIsValid(dp)) {\n\t\tnode = plgo_cache_node_at(cache, dp);\n\t\tif (node->expires != 0 && node->expires <= GetCurrentTimestamp()) {\n\t\t\tplgo_cache_remove(cache, dp);\n\t\t} else {\n\t\t\tplgo_cache_unlink(cache, dp);\n\t\t\tplgo_cache_push_front(cache, dp);\n\t\t\t*len = node->value_len;\n\t\t\tvalue = palloc(node->value_len > 0 ? node->value_len : 1);\n\t\t\tmemcpy(value, dsa_get_address(cache->area, node->value), node->value_len);\n\t\t}\n\t}\n\tif (value != NULL)\n\t\tcache->control->hits++;\n\telse\n\t\tcache->control->misses++;\n\tLWLockRelease(&cache->control->lock);\n\treturn value;\n}\n\n// plgo_cache_put stores the value and evicts the least recently used items above max_size,\n// returns false if the value alone doesn't fit\nbool plgo_cache_put(plgo_cache *cache, char *key, void *value, Size len, int64 ttl_usecs, int64 max_size) {\n\tchar keybuf[PLGO_CACHE_KEYLEN];\n\tplgo_cache_entry *entry;\n\tplgo_cache_node *node;\n\tdsa_pointer dp;\n\tbool found;\n\tif ((int64) (sizeof(plgo_cache_node) + len) > max_size)\n\t\treturn false;\n\tMemSet(keybuf, 0, PLGO_CACHE_KEYLEN);\n\tstrlcpy(keybuf, key, PLGO_CACHE_KEYLEN);\n\tLWLockAcquire(&cache->control->lock, LW_EXCLUSIVE);\n\tentry = dshash_find_or_insert(cache->table, keybuf, &found);\n\tif (found) {\n\t\tdp = entry->node;\n\t\tnode = plgo_cache_node_at(cache, dp);\n\t\tplgo_cache_unlink(cache, dp);\n\t\tcache->control->size -= node->value_len;\n\t\tdsa_free(cache->area, node->value);\n\t} else {\n\t\tdp = dsa_allocate0(cache->area, sizeof(plgo_cache_node));\n\t\tnode = plgo_cache_node_at(cache, dp);\n\t\tmemcpy(node->key, keybuf, PLGO_CACHE_KEYLEN);\n\t\tentry->node = dp;\n\t\tcache->control->size += sizeof(plgo_cache_node);\n\t\tcache->control->entries++;\n\t}\n\tdshash_release_lock(cache->table, entry);\n\tnode->value = dsa_allocate(cache->area, len > 0 ? len : 1);\n\tmemcpy(dsa_get_address(cache->area, node->value), value, len);\n\tnode->value_len = len;\n\tnode->expires = ttl_usecs > 0 ? GetCurrentTimestamp() + ttl_usecs : 0;\n\tcache->control->size += len;\n\tplgo_cache_push_front(cache, dp);\n\twhile (cache->control->size > max_size && cache->control->tail != dp) {\n\t\tplgo_cache_remove(cache, cache->control->tail);\n\t\tcache->control->evictions++;\n\t}\n\tLWLockRelease(&cache->control->lock);\n\treturn true;\n}\n\nbool plgo_cache_delete(plgo_cache *cache, char *key) {\n\tdsa_pointer dp;\n\tLWLockAcquire(&cache->control->lock, LW_EXCLUSIVE);\n\tdp = plgo_cache_lookup(cache, key);\n\tif (DsaPointerIsValid(dp))\n\t\tplgo_cache_remove(cache, dp);\n\tLWLockRelease(&cache->control->lock);\n\treturn DsaPointerIsValid(dp);\n}\n\nplgo_cache_stats plgo_cache_get_stats(plgo_cache *cache) {\n\tplgo_cache_stats stats;\n\tLWLockAcquire(&cache->control->lock, LW_SHARED);\n\tstats.entries = cache->control->entries;\n\tstats.size = cache->control->size;\n\tstats.hits = cache->control->hits;\n\tstats.misses = cache->control->misses;\n\tstats.evictions = cache->control->evictions;\n\tLWLockRelease(&cache->control->lock);\n\treturn stats;\n}\n\nbool plgo_cache_arg_null(FunctionCallInfo fcinfo, int i) {\n\treturn i >= PG_NARGS() || PG_ARGISNULL(i);\n}\n\nint64 plgo_cache_arg_interval_usecs(FunctionCallInfo fcinfo, int i) {\n\tInterval *interval = PG_GETARG_INTERVAL_P(i);\n\treturn interval->time + ((int64) interval->month * DAYS_PER_MONTH + interval->day) * USECS_PER_DAY;\n}\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"math\"\n\t\"time\"\n\t\"unsafe\"\n)\n\n//cacheKeyLen is the maximum length of an cache key (including the terminating zero byte)\nconst cacheKeyLen = 128\n\n//cacheSize is <extension>.cache_size\nvar cacheSize = newIntGUC(gucDesc{\n\tname:      \"cache_size\",\n\tshortDesc: \"Sets the maximum size of the shared cache of the extension.\",\n\tcontext:   gucSighup,\n\tflags:     gucUnitKB,\n}, 16*1024, 64, math.MaxInt32)\n\n//Cache is the LRU cache of the extension in shared memory, that is visible to all backends.\n//The least recently used items are evicted when the cache is larger than <extension>.cache_size.\n//Like the shared areas, the cache lives until the last attached backend exits\ntype Cache struct {\n\tc *C.plgo_cache\n}\n\n//CacheStats are the counters of the shared cache\ntype CacheStats struct {\n\tEntries   int64 `json:\"entries\"`\n\tSize      int64 `json:\"size\"`\n\tHits      int64 `json:\"hits\"`\n\tMisses    int64 `json:\"misses\"`\n\tEvictions int64 `json:\"evictions\"`\n}\n\nvar sharedCache *Cache\n\n//SharedCache attaches to the shared cache of the extension, it creates the cache if it doesn't exist yet.\n//It raises an ERROR if the name of the extension is too long for the shared memory index\nfunc SharedCache() *Cache {\n\tif sharedCache == nil {\n\t\tcname, err := shmemName(\"plgo cache \", extensionName)\n\t\tif err != nil {\n\t\t\tLog.Error(err.Error())\n\t\t\treturn nil\n\t\t}\n\t\tdefer C.free(unsafe.Pointer(cname))\n\t\tsharedCache = &Cache{c: C.plgo_cache_attach(cname)}\n\t}\n\treturn sharedCache\n}\n\nfunc cacheKey(key string) (*C.char, error) {\n\tif len(key) == 0 || len(key) >= cacheKeyLen {\n\t\treturn nil, fmt.Errorf(\"Cache key must be 1 to %d bytes long: %q\", cacheKeyLen-1, key)\n\t}\n\treturn C.CString(key), nil\n}\n\n//Get returns a copy of the cached value, ok is false if the key isn't cached or its TTL expired\nfunc (c *Cache) Get(key string) (value []byte, ok bool, err error) {\n\tckey, err := cacheKey(key)\n\tif err != nil {\n\t\treturn nil, false, err\n\t}\n\tdefer C.free(unsafe.Pointer(ckey))\n\tvar length C.Size\n\tcvalue := C.plgo_cache_get(c.c, ckey, &length)\n\tif cvalue == nil {\n\t\treturn nil, false, nil\n\t}\n\tdefer C.pfree(cvalue)\n\treturn C.GoBytes(cvalue, C.int(length)), true, nil\n}\n\n//Put stores the value under the key, the value expires after the ttl (0 means no expiration).\n//It returns false if the value is larger than the cache\nfunc (c *Cache) Put(key string, value []byte, ttl time.Duration) (bool, error) {\n\tckey, err := cacheKey(key)\n\tif err != nil {\n\t\treturn false, err\n\t}\n\tdefer C.free(unsafe.Pointer(ckey))\n\tvar p unsafe.Pointer\n\tif len(value) > 0 {\n\t\tp = C.CBytes(value)\n\t\tdefer C.free(p)\n\t}\n\tmaxSize := C.int64(cacheSize.get()) * 1024\n\treturn C.plgo_cache_put(c.c, ckey, p, C.Size(len(value)), C.int64(ttl/time.Microsecond), maxSize) == (C._Bool)(true), nil\n}\n\n//Delete removes the key from the cache, returns false if it wasn't cached\nfunc (c *Cache) Delete(key string) (bool, error) {\n\tckey, err := cacheKey(key)\n\tif err != nil {\n\t\treturn false, err\n\t}\n\tdefer C.free(unsafe.Pointer(ckey))\n\treturn C.plgo_cache_delete(c.c, ckey) == (C._Bool)(true), nil\n}\n\n//Stats returns the counters of the cache\nfunc (c *Cache) Stats() CacheStats {\n\tstats := C.plgo_cache_get_stats(c.c)\n\treturn CacheStats{\n\t\tEntries:   int64(stats.entries),\n\t\tSize:      int64(stats.size),\n\t\tHits:      int64(stats.hits),\n\t\tMisses:    int64(stats.misses),\n\t\tEvictions: int64(stats.evictions),\n\t}\n}\n",
+	"cachesql.go":        "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"catalog/pg_type.h\"\n\nbool plgo_cache_arg_null(FunctionCallInfo fcinfo, int i);\nint64 plgo_cache_arg_interval_usecs(FunctionCallInfo fcinfo, int i);\n*/\nimport \"C\"\nimport (\n\t\"encoding/json\"\n\t\"time\"\n\t\"unsafe\"\n)\n\n//cfcinfo returns the C pointer of the call info\nfunc (fcinfo *funcInfo) cfcinfo() C.FunctionCallInfo {\n\treturn (C.FunctionCallInfo)(unsafe.Pointer(fcinfo))\n}\n\n//cacheGet reads the key argument and returns the cached value\nfunc cacheGet(fcinfo *funcInfo) ([]byte, bool) {\n\tvar key string\n\tif err := fcinfo.Scan(&key); err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\tvalue, ok, err := SharedCache().Get(key)\n\tif err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\tif !ok {\n\t\tfcinfo.isnull = (C._Bool)(true)\n\t}\n\treturn value, ok\n}\n\n//export plgo_cache_get_bytea\nfunc plgo_cache_get_bytea(fcinfo *funcInfo) Datum {\n\tvalue, ok := cacheGet(fcinfo)\n\tif !ok {\n\t\treturn toDatum(nil)\n\t}\n\treturn toDatum(value)\n}\n\n//export plgo_cache_get_jsonb\nfunc plgo_cache_get_jsonb(fcinfo *funcInfo) Datum {\n\tvalue, ok := cacheGet(fcinfo)\n\tif !ok {\n\t\treturn toDatum(nil)\n\t}\n\treturn jsonbDatum(json.RawMessage(value))\n}\n\n//export plgo_cache_store\nfunc plgo_cache_store(fcinfo *funcInfo) Datum {\n\tcfcinfo := fcinfo.cfcinfo()\n\tif C.plgo_cache_arg_null(cfcinfo, 0) == (C._Bool)(true) || C.plgo_cache_arg_null(cfcinfo, 1) == (C._Bool)(true) {\n\t\treturn toDatum(false)\n\t}\n\tvar key string\n\tvar value []byte\n\tvar err error\n\tif C.get_call_expr_argtype(fcinfo.flinfo.fn_expr, 1) == C.BYTEAOID {\n\t\terr = fcinfo.Scan(&key, &value)\n\t} else {\n\t\tvar raw json.RawMessage\n\t\terr = fcinfo.Scan(&key, &raw)\n\t\tvalue = raw\n\t}\n\tif err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\tvar ttl time.Duration\n\tif C.plgo_cache_arg_null(cfcinfo, 2) != (C._Bool)(true) {\n\t\tttl = time.Duration(C.plgo_cache_arg_interval_usecs(cfcinfo, 2)) * time.Microsecond\n\t}\n\tstored, err := SharedCache().Put(key, value, ttl)\n\tif err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn toDatum(stored)\n}\n\n//export plgo_cache_remove_key\nfunc plgo_cache_remove_key(fcinfo *funcInfo) Datum {\n\tvar key string\n\tif err := fcinfo.Scan(&key); err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\tdeleted, err := SharedCache().Delete(key)\n\tif err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn toDatum(deleted)\n}\n\n//export plgo_cache_counters\nfunc plgo_cache_counters(fcinfo *funcInfo) Datum {\n\treturn jsonbDatum(SharedCache().Stats())\n}\n",
+	"calls.go":           "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"access/xact.h\"\n\nextern Datum jsonb_to_datum(char* val);\n*/\nimport \"C\"\nimport (\n\t\"encoding/json\"\n\t\"sort\"\n\t\"sync\"\n\t\"time\"\n\t\"unsafe\"\n)\n\n//funcCall is the state of an running call of an exported function\ntype funcCall struct {\n\tid       uint64\n\tname     string\n\tstart    time.Time\n\tsubID    uint32\n\trows     int64\n\tcounters map[string]int64\n\tspan     *span\n\t//aborted is the time when the call was interrupted by an ERROR\n\taborted time.Time\n\t//deadline is the time set by SetDeadline, zero if the call has no deadline\n\tdeadline time.Time\n\t//traced is true when the call is logged by <extension>.trace, result is its logged result\n\ttraced bool\n\tresult string\n\t//nonatomic is true for the procedures called by CALL outside of an transaction block\n\tnonatomic bool\n}\n\n//lastCallID is the id of the last call in the backend\nvar lastCallID uint64\n\n//callStack holds the running calls, the last one is the innermost call\n//(exported functions can call each other through SPI)\nvar callStack []*funcCall\n\n//beginCall is called by the generated wrappers at the start of every exported function,\n//the returned call must be ended with end\nfunc beginCall(fcinfo *funcInfo, name string) *funcCall {\n\tif len(pendingErrors) > 0 {\n\t\tflushPendingErrors()\n\t}\n\tenterRestricted()\n\tlastCallID++\n\tcall := &funcCall{\n\t\tid:     lastCallID,\n\t\tname:   name,\n\t\tstart:  time.Now(),\n\t\tsubID:  currentSubTransactionID(),\n\t\tspan:   startCallSpan(name, int(fcinfo.nargs)),\n\t\ttraced: traceCalls.get(),\n\t}\n\tcallStack = append(callStack, call)\n\tCheckTimers()\n\treturn call\n}\n\n//end finishes the call and records its statistics,\n//it must be deferred directly, so it can recover panics of the function\nfunc (call *funcCall) end() {\n\tif r := recover(); r != nil {\n\t\t//raises ERROR, the call is then cleaned up by the abort handler\n\t\thandlePanic(call, r)\n\t}\n\tif call.traced {\n\t\t//logged before the call is removed from the stack, so the line has its function and call id\n\t\tcall.traceEnd(time.Since(call.start))\n\t}\n\tfor i := len(callStack) - 1; i >= 0; i-- {\n\t\tif callStack[i] == call {\n\t\t\tcallStack = callStack[:i]\n\t\t\tbreak\n\t\t}\n\t}\n\tcall.endDeadline()\n\tcall.span.finish(nil)\n\tduration := time.Since(call.start)\n\texplainStats.record(call, duration)\n\trecordStat(call, duration, false)\n}\n\n//currentSubTransactionID returns the id of the current (sub)transaction\nfunc currentSubTransactionID() uint32 {\n\treturn uint32(C.GetCurrentSubTransactionId())\n}\n\n//currentCall returns the innermost running call, or nil if no exported function is running\nfunc currentCall() *funcCall {\n\tif len(callStack) == 0 {\n\t\treturn nil\n\t}\n\treturn callStack[len(callStack)-1]\n}\n\nfunc init() {\n\t//calls interrupted by an ERROR never call end, drop them from the stack\n\tonAbort(func(subID uint32) {\n\t\tfor i, call := range callStack {\n\t\t\tif subID == 0 || call.subID >= subID {\n\t\t\t\tnow := time.Now()\n\t\t\t\tfor _, aborted := range callStack[i:] {\n\t\t\t\t\taborted.aborted = now\n\t\t\t\t\tpendingErrors = append(pendingErrors, aborted)\n\t\t\t\t}\n\t\t\t\tcallStack = callStack[:i]\n\t\t\t\treturn\n\t\t\t}\n\t\t}\n\t})\n}\n\n//AddRows adds n to the rows counter of the currently running exported function,\n//the rows are reported by the <extension>_explain() function\nfunc AddRows(n int64) {\n\tif call := currentCall(); call != nil {\n\t\tcall.rows += n\n\t}\n}\n\n//AddCounter adds delta to the named counter of the currently running exported function,\n//the counters are reported by the <extension>_explain() function\nfunc AddCounter(name string, delta int64) {\n\tcall := currentCall()\n\tif call == nil {\n\t\treturn\n\t}\n\tif call.counters == nil {\n\t\tcall.counters = make(map[string]int64)\n\t}\n\tcall.counters[name] += delta\n}\n\n//funcExplain are the instrumentation data of one exported function in the current backend\ntype funcExplain struct {\n\tFunction  string           `json:\"function\"`\n\tCalls     int64            `json:\"calls\"`\n\tTotalTime float64          `json:\"total_time_ms\"`\n\tMaxTime   float64          `json:\"max_time_ms\"`\n\tMeanTime  float64          `json:\"mean_time_ms\"`\n\tRows      int64            `json:\"rows\"`\n\tCounters  map[string]int64 `json:\"counters,omitempty\"`\n}\n\ntype explainCollector struct {\n\tsync.Mutex\n\tfuncs map[string]*funcExplain\n}\n\nvar explainStats = &explainCollector{funcs: make(map[string]*funcExplain)}\n\nfunc (e *explainCollector) record(call *funcCall, duration time.Duration) {\n\te.Lock()\n\tdefer e.Unlock()\n\tf, ok := e.funcs[call.name]\n\tif !ok {\n\t\tf = &funcExplain{Function: call.name}\n\t\te.funcs[call.name] = f\n\t}\n\tms := float64(duration) / float64(time.Millisecond)\n\tf.Calls++\n\tf.TotalTime += ms\n\tif ms > f.MaxTime {\n\t\tf.MaxTime = ms\n\t}\n\tf.MeanTime = f.TotalTime / float64(f.Calls)\n\tf.Rows += call.rows\n\tfor name, delta := range call.counters {\n\t\tif f.Counters == nil {\n\t\t\tf.Counters = make(map[string]int64)\n\t\t}\n\t\tf.Counters[name] += delta\n\t}\n}\n\nfunc (e *explainCollector) list() []funcExplain {\n\te.Lock()\n\tdefer e.Unlock()\n\tlist := make([]funcExplain, 0, len(e.funcs))\n\tfor _, f := range e.funcs {\n\t\tlist = append(list, *f)\n\t}\n\tsort.Slice(list, func(i, j int) bool { return list[i].Function < list[j].Function })\n\treturn list\n}\n\nfunc (e *explainCollector) reset() {\n\te.Lock()\n\tdefer e.Unlock()\n\te.funcs = make(map[string]*funcExplain)\n}\n\n//jsonbDatum returns val marshaled as jsonb datum\nfunc jsonbDatum(val interface{}) Datum {\n\tdata, err := json.Marshal(val)\n\tif err != nil {\n\t\tdata = []byte(\"null\")\n\t}\n\tcjson := C.CString(string(data))\n\tdefer C.free(unsafe.Pointer(cjson))\n\treturn (Datum)(C.jsonb_to_datum(cjson))\n}\n\n//export plgo_explain\nfunc plgo_explain(fcinfo *funcInfo) Datum {\n\treturn jsonbDatum(explainStats.list())\n}\n\n//export plgo_explain_reset\nfunc plgo_explain_reset(fcinfo *funcInfo) Datum {\n\texplainStats.reset()\n\treturn toDatum(nil)\n}\n",
+	"calltrace.go":       "package plgo\n\nimport (\n\t\"fmt\"\n\t\"reflect\"\n\t\"time\"\n\t\"unicode/utf8\"\n)\n\n//traceCalls is <extension>.trace, the calls of the exported functions are logged at DEBUG1,\n//regardless of <extension>.log_level (log_min_messages and client_min_messages still apply)\nvar traceCalls = newBoolGUC(gucDesc{\n\tname:      \"trace\",\n\tshortDesc: \"Logs the calls of the exported functions with their arguments, duration and result at DEBUG1.\",\n\tlongDesc:  \"The values are passed through the redactor set with SetTraceRedactor and the secrets are hidden.\",\n\tcontext:   gucSuset,\n}, false)\n\n//maxTraceValue is the maximum length of an logged argument or result\nconst maxTraceValue = 200\n\n//TraceRedactor returns the value written to the trace for the argument or the result (\"result\") of the function,\n//e.g. an placeholder for the sensitive parameters\ntype TraceRedactor func(function, name string, value interface{}) interface{}\n\nvar traceRedactor TraceRedactor\n\n//SetTraceRedactor sets the redactor of the values logged by <extension>.trace,\n//it should be called from an init() function of the package\nfunc SetTraceRedactor(redactor TraceRedactor) {\n\ttraceRedactor = redactor\n}\n\n//traceValue returns the short description of the value for the trace\nfunc (call *funcCall) traceValue(name string, value interface{}) string {\n\tif traceRedactor != nil {\n\t\tvalue = traceRedactor(call.name, name, value)\n\t}\n\t//the nullable arguments and results are pointers\n\tif v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {\n\t\tif v.IsNil() {\n\t\t\treturn \"NULL\"\n\t\t}\n\t\tvalue = v.Elem().Interface()\n\t}\n\tvar s string\n\tswitch v := value.(type) {\n\tcase nil:\n\t\treturn \"NULL\"\n\tcase []byte:\n\t\treturn fmt.Sprintf(\"bytea(%d bytes)\", len(v))\n\tcase string:\n\t\ts = fmt.Sprintf(\"%q\", v)\n\tdefault:\n\t\ts = fmt.Sprint(v)\n\t}\n\tif len(s) > maxTraceValue {\n\t\tcut := maxTraceValue\n\t\tfor cut > 0 && !utf8.RuneStart(s[cut]) {\n\t\t\tcut--\n\t\t}\n\t\ts = fmt.Sprintf(\"%s...(%d bytes)\", s[:cut], len(s))\n\t}\n\treturn s\n}\n\n//traceArgs logs the entry of the traced call with its arguments,\n//it is called by the generated wrappers after the arguments are scanned\nfunc (call *funcCall) traceArgs(names []string, args ...interface{}) {\n\tfields := make([]interface{}, 0, 2*len(args))\n\tfor i, arg := range args {\n\t\tfields = append(fields, \"arg.\"+names[i], call.traceValue(names[i], arg))\n\t}\n\twriteLine(LevelDebug, Log.Format(\"call\", fields...))\n}\n\n//traceResult remembers the result of the traced call, it is logged when the call ends\nfunc (call *funcCall) traceResult(result interface{}) {\n\tcall.result = call.traceValue(\"result\", result)\n}\n\n//traceEnd logs the exit of the traced call\nfunc (call *funcCall) traceEnd(duration time.Duration) {\n\tfields := []interface{}{\"duration_ms\", float64(duration) / float64(time.Millisecond)}\n\tif call.result != \"\" {\n\t\tfields = append(fields, \"result\", call.result)\n\t}\n\twriteLine(LevelDebug, Log.Format(\"return\", fields...))\n}\n",
+	"codecs.go":          "//go:build plgo_codecs\n\npackage plgo\n\nimport (\n\t\"bytes\"\n\t\"compress/flate\"\n\t\"compress/gzip\"\n\t\"compress/zlib\"\n\t\"encoding/base64\"\n\t\"encoding/hex\"\n\t\"fmt\"\n\t\"io\"\n\n\t\"github.com/klauspost/compress/zstd\"\n\t\"github.com/pierrec/lz4/v4\"\n)\n\n//maxDecompressedSize is the largest bytea value PostgreSQL can store (MaxAllocSize),\n//the larger decompressed data is rejected instead of exhausting the backend memory\nconst maxDecompressedSize = 1<<30 - 1\n\n//compress compresses the data with gzip, zlib, raw deflate, zstd or lz4 (frame format)\nfunc compress(algorithm string, data []byte) ([]byte, error) {\n\tvar buf bytes.Buffer\n\tvar w io.WriteCloser\n\tswitch algorithm {\n\tcase \"zstd\":\n\t\tzw, err := zstd.NewWriter(nil)\n\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t\tdefer zw.Close()\n\t\treturn zw.EncodeAll(data, nil), nil\n\tcase \"lz4\":\n\t\tw = lz4.NewWriter(&buf)\n\tcase \"gzip\":\n\t\tw = gzip.NewWriter(&buf)\n\tcase \"zlib\":\n\t\tw = zlib.NewWriter(&buf)\n\tcase \"deflate\":\n\t\tfw, err := flate.NewWriter(&buf, flate.DefaultCompression)\n\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t\tw = fw\n\tdefault:\n\t\treturn nil, fmt.Errorf(\"Unknown compression %q, use zstd, lz4, gzip, zlib or deflate\", algorithm)\n\t}\n\tif _, err := w.Write(data); err != nil {\n\t\treturn nil, err\n\t}\n\tif err := w.Close(); err != nil {\n\t\treturn nil, err\n\t}\n\treturn buf.Bytes(), nil\n}\n\n//decompress decompresses the data compressed by compress\nfunc decompress(algorithm string, data []byte) ([]byte, error) {\n\tvar r io.ReadCloser\n\tswitch algorithm {\n\tcase \"zstd\":\n\t\tzr, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxDecompressedSize))\n\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t\tr = zr.IOReadCloser()\n\tcase \"lz4\":\n\t\tr = io.NopCloser(lz4.NewReader(bytes.NewReader(data)))\n\tcase \"gzip\":\n\t\tgr, err := gzip.NewReader(bytes.NewReader(data))\n\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t\tr = gr\n\tcase \"zlib\":\n\t\tzr, err := zlib.NewReader(bytes.NewReader(data))\n\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t\tr = zr\n\tcase \"deflate\":\n\t\tr = flate.NewReader(bytes.NewReader(data))\n\tdefault:\n\t\treturn nil, fmt.Errorf(\"Unknown compression %q, use zstd, lz4, gzip, zlib or deflate\", algorithm)\n\t}\n\tdefer r.Close()\n\tout, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tif len(out) > maxDecompressedSize {\n\t\treturn nil, fmt.Errorf(\"Decompressed data is larger than %d bytes\", maxDecompressedSize)\n\t}\n\treturn out, nil\n}\n\n//encode encodes the data as base64, base64url (without padding) or hex\nfunc encode(format string, data []byte) (string, error) {\n\tswitch format {\n\tcase \"base64\":\n\t\treturn base64.StdEncoding.EncodeToString(data), nil\n\tcase \"base64url\":\n\t\treturn base64.RawURLEncoding.EncodeToString(data), nil\n\tcase \"hex\":\n\t\treturn hex.EncodeToString(data), nil\n\tdefault:\n\t\treturn \"\", fmt.Errorf(\"Unknown encoding %q, use base64, base64url or hex\", format)\n\t}\n}\n\n//decode decodes the text encoded by encode\nfunc decode(format string, text string) ([]byte, error) {\n\tswitch format {\n\tcase \"base64\":\n\t\treturn base64.StdEncoding.DecodeString(text)\n\tcase \"base64url\":\n\t\treturn base64.RawURLEncoding.DecodeString(text)\n\tcase \"hex\":\n\t\treturn hex.DecodeString(text)\n\tdefault:\n\t\treturn nil, fmt.Errorf(\"Unknown encoding %q, use base64, base64url or hex\", format)\n\t}\n}\n\n//codecArgs reads the data and the algorithm (or format) arguments\nfunc codecArgs(fcinfo *funcInfo, data interface{}) string {\n\tvar algorithm string\n\tif err := fcinfo.Scan(data, &algorithm); err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn algorithm\n}\n\n//export plgo_codec_compress\nfunc plgo_codec_compress(fcinfo *funcInfo) Datum {\n\tvar data []byte\n\tout, err := compress(codecArgs(fcinfo, &data), data)\n\tif err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn toDatum(out)\n}\n\n//export plgo_codec_decompress\nfunc plgo_codec_decompress(fcinfo *funcInfo) Datum {\n\tvar data []byte\n\tout, err := decompress(codecArgs(fcinfo, &data), data)\n\tif err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn toDatum(out)\n}\n\n//export plgo_codec_encode\nfunc plgo_codec_encode(fcinfo *funcInfo) Datum {\n\tvar data []byte\n\tout, err := encode(codecArgs(fcinfo, &data), data)\n\tif err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn toDatum(out)\n}\n\n//export plgo_codec_decode\nfunc plgo_codec_decode(fcinfo *funcInfo) Datum {\n\tvar text string\n\tout, err := decode(codecArgs(fcinfo, &text), text)\n\tif err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn toDatum(out)\n}\n",
+	"composite.go":       "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"funcapi.h\"\n#include \"access/htup_details.h\"\n#include \"utils/typcache.h\"\n\nTupleDesc plgo_composite_tupdesc(Datum val, HeapTupleData *tuple) {\n\tHeapTupleHeader header = DatumGetHeapTupleHeader(val);\n\ttuple->t_len = HeapTupleHeaderGetDatumLength(header);\n\tItemPointerSetInvalid(&(tuple->t_self));\n\ttuple->t_tableOid = InvalidOid;\n\ttuple->t_data = header;\n\treturn lookup_rowtype_tupdesc(HeapTupleHeaderGetTypeId(header), HeapTupleHeaderGetTypMod(header));\n}\n\nvoid plgo_release_tupdesc(TupleDesc tupdesc) {\n\tReleaseTupleDesc(tupdesc);\n}\n\nTupleDesc plgo_result_tupdesc(FunctionCallInfo fcinfo) {\n\tTupleDesc tupdesc;\n\tif (get_call_result_type(fcinfo, NULL, &tupdesc) != TYPEFUNC_COMPOSITE)\n\t\tereport(ERROR, (errcode(ERRCODE_FEATURE_NOT_SUPPORTED),\n\t\t\t\t\t\terrmsg(\"function returning composite type called in context that cannot accept type record\")));\n\treturn BlessTupleDesc(tupdesc);\n}\n\nDatum plgo_composite_datum(HeapTuple tuple) {\n\treturn HeapTupleGetDatum(tuple);\n}\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"reflect\"\n\t\"unsafe\"\n)\n\n//scanComposite sets the struct pointed by dest from the composite datum,\n//the attributes are mapped to the fields like the columns in TriggerRow.ScanStruct\nfunc scanComposite(val C.Datum, dest interface{}) error {\n\tvar tuple C.HeapTupleData\n\ttupleDesc := C.plgo_composite_tupdesc(val, &tuple)\n\tdefer C.plgo_release_tupdesc(tupleDesc)\n\treturn newTriggerRow(tupleDesc, &tuple).ScanStruct(dest)\n}\n\n//compositeDatum returns the struct pointed by src as the composite result of the function,\n//the attributes without an field are NULL\nfunc compositeDatum(fcinfo *funcInfo, src interface{}) Datum {\n\ttupleDesc := C.plgo_result_tupdesc((*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo)))\n\tnatts := int(tupleDesc.natts)\n\trow := &TriggerRow{tupleDesc, make([]C.Datum, natts), make([]bool, natts)}\n\tfor i := range row.nulls {\n\t\trow.nulls[i] = true\n\t}\n\tif err := row.SetStruct(src); err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn (Datum)(C.plgo_composite_datum(row.heapTuple()))\n}\n\n//recordDatum returns the values as the record result of an function with OUT parameters,\n//the values are in the order of the OUT parameters, the nil pointers are NULL\nfunc recordDatum(fcinfo *funcInfo, values ...interface{}) Datum {\n\ttupleDesc := C.plgo_result_tupdesc((*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo)))\n\tnatts := int(tupleDesc.natts)\n\tif natts != len(values) {\n\t\tLog.Error(fmt.Sprintf(\"The function returns %d values for %d OUT parameters\", len(values), natts))\n\t}\n\trow := &TriggerRow{tupleDesc, make([]C.Datum, natts), make([]bool, natts)}\n\tfor i, value := range values {\n\t\tif v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {\n\t\t\tif v.IsNil() {\n\t\t\t\trow.Set(i, nil)\n\t\t\t\tcontinue\n\t\t\t}\n\t\t\tvalue = v.Elem().Interface()\n\t\t}\n\t\trow.Set(i, value)\n\t}\n\treturn (Datum)(C.plgo_composite_datum(row.heapTuple()))\n}\n",
+	"config.go":          "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"miscadmin.h\"\n#include \"utils/guc.h\"\n\n//plgo_get_config returns the value of the setting as current_setting, NULL if it doesn't exist\nchar *plgo_get_config(const char *name) {\n\treturn GetConfigOptionByName(name, NULL, true);\n}\n\n//plgo_set_config sets the setting as set_config, the invalid values raise an ERROR\nvoid plgo_set_config(const char *name, const char *value, bool is_local) {\n\t(void) set_config_option(name, value, superuser() ? PGC_SUSET : PGC_USERSET, PGC_S_SESSION,\n\t\t\t\t\t\t\t is_local ? GUC_ACTION_LOCAL : GUC_ACTION_SET, true, 0, false);\n}\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"strings\"\n\t\"unsafe\"\n)\n\n//GetConfigOption returns the value of the setting as current_setting(name), e.g. \"30s\" for statement_timeout,\n//it returns an error if the setting doesn't exist. The settings readable only by the privileged roles raise an ERROR\nfunc GetConfigOption(name string) (string, error) {\n\tcname := C.CString(name)\n\tdefer C.free(unsafe.Pointer(cname))\n\tvalue := C.plgo_get_config(cname)\n\tif value == nil {\n\t\treturn \"\", fmt.Errorf(\"Unrecognized configuration parameter %s\", name)\n\t}\n\tdefer C.pfree(unsafe.Pointer(value))\n\treturn C.GoString(value), nil\n}\n\n//SetConfigOption sets the setting as set_config(name, value, isLocal), the local value lasts until the end of the transaction,\n//otherwise until the end of the session. It returns an error if the setting doesn't exist (the names with an dot\n//are the custom settings, they are created), the invalid values and the settings the user can't change raise an ERROR\nfunc SetConfigOption(name, value string, isLocal bool) error {\n\tif _, err := GetConfigOption(name); err != nil && !strings.Contains(name, \".\") {\n\t\treturn err\n\t}\n\tcname := C.CString(name)\n\tdefer C.free(unsafe.Pointer(cname))\n\tcvalue := C.CString(value)\n\tdefer C.free(unsafe.Pointer(cvalue))\n\tC.plgo_set_config(cname, cvalue, (C._Bool)(isLocal))\n\treturn nil\n}\n",
+	"copy.go":            "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"access/xact.h\"\n#include \"catalog/namespace.h\"\n#include \"catalog/objectaddress.h\"\n#include \"commands/copy.h\"\n#include \"miscadmin.h\"\n#include \"nodes/makefuncs.h\"\n#include \"nodes/value.h\"\n#include \"parser/parse_node.h\"\n#include \"parser/parse_type.h\"\n#include \"utils/acl.h\"\n#include \"utils/rel.h\"\n#include \"utils/rls.h\"\n#include \"utils/varlena.h\"\n#if PG_VERSION_NUM >= 120000\n#include \"access/table.h\"\n#else\n#include \"access/heapam.h\"\n#define table_openrv heap_openrv\n#define table_close heap_close\n#endif\n#if PG_VERSION_NUM < 140000\ntypedef CopyState CopyFromState;\n#endif\n\nextern char *plgo_text_output(Oid type, Datum value);\nextern int plgo_copy_read(void *outbuf, int minread, int maxread);\n\n//plgo_copy_from loads the rows read by plgo_copy_read into the columns of the table as COPY table (columns) FROM\n//in the text format, the user must have the INSERT privilege on the table. It returns the number of the loaded rows\nuint64 plgo_copy_from(const char *table, char **columns, int ncolumns) {\n#if PG_VERSION_NUM >= 160000\n\tRangeVar *rv = makeRangeVarFromNameList(stringToQualifiedNameList(table, NULL));\n#else\n\tRangeVar *rv = makeRangeVarFromNameList(stringToQualifiedNameList(table));\n#endif\n\tRelation rel = table_openrv(rv, RowExclusiveLock);\n\tParseState *pstate;\n\tCopyFromState cstate;\n\tList *attnames = NIL;\n\tAclResult aclresult;\n\tuint64 processed;\n\tint i;\n\n\taclresult = pg_class_aclcheck(RelationGetRelid(rel), GetUserId(), ACL_INSERT);\n\tif (aclresult != ACLCHECK_OK)\n\t\taclcheck_error(aclresult, get_relkind_objtype(rel->rd_rel->relkind), RelationGetRelationName(rel));\n\tif (check_enable_rls(RelationGetRelid(rel), InvalidOid, false) == RLS_ENABLED)\n\t\tereport(ERROR, (errcode(ERRCODE_FEATURE_NOT_SUPPORTED),\n\t\t\t\t\t\terrmsg(\"COPY FROM not supported with row-level security\")));\n\tfor (i = 0; i < ncolumns; i++)\n\t\tattnames = lappend(attnames, makeString(pstrdup(columns[i])));\n\tpstate = make_parsestate(NULL);\n#if PG_VERSION_NUM >= 140000\n\tcstate = BeginCopyFrom(pstate, rel, NULL, NULL, false, plgo_copy_read, attnames, NIL);\n#else\n\tcstate = BeginCopyFrom(pstate, rel, NULL, false, plgo_copy_read, attnames, NIL);\n#endif\n\tprocessed = CopyFrom(cstate);\n\tEndCopyFrom(cstate);\n\tfree_parsestate(pstate);\n\ttable_close(rel, NoLock);\n\t//the next queries see the loaded rows\n\tCommandCounterIncrement();\n\treturn processed;\n}\n\n//plgo_copy_type returns the type of the type name, e.g. timestamptz\nOid plgo_copy_type(const char *name) {\n\tOid type;\n\tint32 typmod;\n\n#if PG_VERSION_NUM >= 160000\n\tparseTypeString(name, &type, &typmod, NULL);\n#else\n\tparseTypeString(name, &type, &typmod, false);\n#endif\n\treturn type;\n}\n*/\nimport \"C\"\nimport (\n\t\"errors\"\n\t\"fmt\"\n\t\"reflect\"\n\t\"strings\"\n\t\"unsafe\"\n)\n\n//CopySource is the source of the rows loaded by CopyFrom, Next advances to the next row\n//and Values returns its values, Err the error that stopped Next\ntype CopySource interface {\n\tNext() bool\n\tValues() ([]interface{}, error)\n\tErr() error\n}\n\n//copyRows is the CopySource of an slice of rows\ntype copyRows struct {\n\trows [][]interface{}\n\tnext int\n}\n\n//CopyFromRows returns the CopySource of the rows\nfunc CopyFromRows(rows [][]interface{}) CopySource {\n\treturn &copyRows{rows: rows}\n}\n\nfunc (r *copyRows) Next() bool {\n\tr.next++\n\treturn r.next <= len(r.rows)\n}\n\nfunc (r *copyRows) Values() ([]interface{}, error) {\n\treturn r.rows[r.next-1], nil\n}\n\nfunc (r *copyRows) Err() error {\n\treturn nil\n}\n\n//copyReader formats the rows of the source as the COPY text format for plgo_copy_read\ntype copyReader struct {\n\tsource  CopySource\n\tcolumns int\n\t//types are the SQL types of the Go types of the values\n\ttypes   map[reflect.Type]C.Oid\n\tpending []byte\n\trows    int64\n\tdone    bool\n\terr     error\n}\n\n//currentCopy is the running CopyFrom\nvar currentCopy *copyReader\n\nfunc init() {\n\t//the ERROR in COPY never returns to CopyFrom\n\tonAbort(func(subID uint32) {\n\t\tcurrentCopy = nil\n\t})\n}\n\n//CopyFrom loads the rows of the source into the columns of the table (an qualified name, e.g. \"sales.orders\")\n//as COPY FROM, much faster than the INSERT of every row. The values are converted as the query parameters\n//(int64 is bigint, time.Time timestamptz, ...) and then to the types of the columns, nil and the nil pointers are NULL.\n//It returns the number of the loaded rows. The rows loaded before an error of the source stay inserted,\n//run CopyFrom in an db.SubTransaction to load all or nothing. The invalid values raise an ERROR as in COPY\n//\n//\tn, err := db.CopyFrom(\"events\", []string{\"id\", \"created\", \"payload\"}, plgo.CopyFromRows(rows))\nfunc (db *DB) CopyFrom(table string, columns []string, source CopySource) (processed int64, err error) {\n\tif len(columns) == 0 {\n\t\treturn 0, errors.New(\"CopyFrom needs at least one column\")\n\t}\n\tif currentCopy != nil {\n\t\treturn 0, errors.New(\"Another CopyFrom is running, finish it first\")\n\t}\n\t//the query hooks, the tracing and the slow query log see the COPY command\n\tq := beginQuery(\"COPY \"+table+\" (\"+strings.Join(columns, \", \")+\") FROM STDIN\", nil)\n\tdefer endQuery(q, &err)\n\tif err = auditQuery(q); err != nil {\n\t\treturn 0, err\n\t}\n\tcurrentCopy = &copyReader{source: source, columns: len(columns), types: make(map[reflect.Type]C.Oid)}\n\tdefer func() { currentCopy = nil }()\n\tctable := C.CString(table)\n\tdefer C.free(unsafe.Pointer(ctable))\n\tccolumns := make([]*C.char, len(columns))\n\tfor i, column := range columns {\n\t\tccolumns[i] = C.CString(column)\n\t\tdefer C.free(unsafe.Pointer(ccolumns[i]))\n\t}\n\t//the array of C strings is in the C memory, it can't hold them as an Go slice\n\tcnames := (**C.char)(C.malloc(C.size_t(len(columns)) * C.size_t(unsafe.Sizeof(ccolumns[0]))))\n\tdefer C.free(unsafe.Pointer(cnames))\n\tcopy(unsafe.Slice(cnames, len(columns)), ccolumns)\n\tprocessed = int64(C.plgo_copy_from(ctable, cnames, C.int(len(columns))))\n\tif currentCopy.err != nil {\n\t\treturn processed, currentCopy.err\n\t}\n\treturn processed, nil\n}\n\n//export plgo_copy_read\nfunc plgo_copy_read(outbuf unsafe.Pointer, minread, maxread C.int) C.int {\n\tr := currentCopy\n\tfor !r.done && len(r.pending) < int(minread) {\n\t\tif !r.source.Next() {\n\t\t\tr.err = r.source.Err()\n\t\t\tr.done = true\n\t\t\tbreak\n\t\t}\n\t\tif r.err = r.appendRow(); r.err != nil {\n\t\t\t//the rows before the failed one are still loaded, the copy ends after them\n\t\t\tr.done = true\n\t\t}\n\t}\n\tn := len(r.pending)\n\tif n > int(maxread) {\n\t\tn = int(maxread)\n\t}\n\tcopy(unsafe.Slice((*byte)(outbuf), n), r.pending[:n])\n\tr.pending = r.pending[n:]\n\treturn C.int(n)\n}\n\n//appendRow appends the line of the values of the current row of the source\nfunc (r *copyReader) appendRow() error {\n\tvalues, err := r.source.Values()\n\tif err != nil {\n\t\treturn err\n\t}\n\tif len(values) != r.columns {\n\t\treturn fmt.Errorf(\"CopyFrom row %d has %d values, expected %d\", r.rows+1, len(values), r.columns)\n\t}\n\tline := len(r.pending)\n\tfor i, value := range values {\n\t\tif i > 0 {\n\t\t\tr.pending = append(r.pending, '\\t')\n\t\t}\n\t\tif err = r.appendValue(value); err != nil {\n\t\t\tr.pending = r.pending[:line]\n\t\t\treturn fmt.Errorf(\"CopyFrom row %d, column %d: %w\", r.rows+1, i+1, err)\n\t\t}\n\t}\n\tr.pending = append(r.pending, '\\n')\n\tr.rows++\n\treturn nil\n}\n\n//appendValue appends the value as the text of its SQL type, escaped for the COPY text format\nfunc (r *copyReader) appendValue(value interface{}) error {\n\tif v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {\n\t\tif v.IsNil() {\n\t\t\tvalue = nil\n\t\t} else {\n\t\t\tvalue = v.Elem().Interface()\n\t\t}\n\t}\n\tif value == nil {\n\t\tr.pending = append(r.pending, `\\N`...)\n\t\treturn nil\n\t}\n\toid, err := r.typeOf(value)\n\tif err != nil {\n\t\treturn err\n\t}\n\ttext := C.plgo_text_output(oid, (C.Datum)(toDatum(value)))\n\tdefer C.pfree(unsafe.Pointer(text))\n\tfor _, c := range []byte(C.GoString(text)) {\n\t\tswitch c {\n\t\tcase '\\\\':\n\t\t\tr.pending = append(r.pending, `\\\\`...)\n\t\tcase '\\t':\n\t\t\tr.pending = append(r.pending, `\\t`...)\n\t\tcase '\\n':\n\t\t\tr.pending = append(r.pending, `\\n`...)\n\t\tcase '\\r':\n\t\t\tr.pending = append(r.pending, `\\r`...)\n\t\tdefault:\n\t\t\tr.pending = append(r.pending, c)\n\t\t}\n\t}\n\treturn nil\n}\n\n//typeOf returns the SQL type of the Go type of the value as in the query parameters\nfunc (r *copyReader) typeOf(value interface{}) (C.Oid, error) {\n\tt := reflect.TypeOf(value)\n\tif oid, ok := r.types[t]; ok {\n\t\treturn oid, nil\n\t}\n\ttypeName, ok := paramTypes[t]\n\tif t == reflect.TypeOf(JSONB(nil)) {\n\t\ttypeName, ok = \"jsonb\", true\n\t}\n\tif !ok {\n\t\treturn 0, fmt.Errorf(\"type %T not supported\", value)\n\t}\n\tctype := C.CString(typeName)\n\tdefer C.free(unsafe.Pointer(ctype))\n\toid := C.plgo_copy_type(ctype)\n\tr.types[t] = oid\n\treturn oid, nil\n}\n",
+	"cursor.go":          "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"executor/spi.h\"\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n)\n\n//defaultFetchSize is the number of rows fetched by an Cursor at once\nconst defaultFetchSize = 1000\n\n//Cursor streams the rows of an query, they are fetched in batches (SPI_cursor_fetch) instead of materialized at once,\n//so only the current batch is in the memory. The cursor must be closed before the DB\n//\n//\tcursor, err := db.QueryCursor(\"SELECT id, name FROM users WHERE active = $1\", true)\n//\tif err != nil {\n//\t\t...\n//\t}\n//\tdefer cursor.Close()\n//\tfor cursor.Next() {\n//\t\terr = cursor.Scan(&id, &name)\n//\t}\ntype Cursor struct {\n\tportal    C.Portal\n\tfetchSize int\n\t//tuptable is the fetched batch, rows its remaining rows\n\ttuptable *C.SPITupleTable\n\trows     *Rows\n\tdone     bool\n}\n\n//QueryCursor opens an cursor of the query, the parameter types are derived from the Go types of the args\n//as in Query.Param\nfunc (db *DB) QueryCursor(query string, args ...interface{}) (*Cursor, error) {\n\ttypes := make([]string, len(args))\n\tfor i, arg := range args {\n\t\ttypeName, err := paramType(arg, i+1)\n\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t\ttypes[i] = typeName\n\t}\n\tstmt, err := db.Prepare(query, types)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\treturn stmt.Cursor(args...)\n}\n\n//Cursor executes the prepared Stmt with the provided args and returns an cursor of its rows\nfunc (stmt *Stmt) Cursor(args ...interface{}) (cursor *Cursor, err error) {\n\tq := beginQuery(stmt.query, args)\n\tdefer endQuery(q, &err)\n\tif err = auditQuery(q); err != nil {\n\t\treturn nil, err\n\t}\n\tvaluesP, nullsP, err := stmt.spiArgs(args)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tportal, err := stmt.cursorOpen(valuesP, nullsP)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tif portal == nil {\n\t\treturn nil, fmt.Errorf(\"Cursor failed: %s\", C.GoString(C.SPI_result_code_string(C.SPI_result)))\n\t}\n\treturn &Cursor{portal: portal, fetchSize: defaultFetchSize}, nil\n}\n\n//SetFetchSize sets the number of rows fetched at once, 1000 by default\nfunc (c *Cursor) SetFetchSize(n int) {\n\tif n > 0 {\n\t\tc.fetchSize = n\n\t}\n}\n\n//Next sets the cursor to the next row, the next batch is fetched when the current is read.\n//It returns false after the last row\nfunc (c *Cursor) Next() bool {\n\tif c.rows != nil && c.rows.Next() {\n\t\treturn true\n\t}\n\tif c.done || c.portal == nil {\n\t\treturn false\n\t}\n\tc.freeBatch()\n\tC.SPI_cursor_fetch(c.portal, (C._Bool)(true), C.long(c.fetchSize))\n\tif C.SPI_processed == 0 {\n\t\tc.done = true\n\t\treturn false\n\t}\n\tc.tuptable = C.SPI_tuptable\n\tc.rows = newRows(c.tuptable.vals, c.tuptable.tupdesc, C.uint64(C.SPI_processed))\n\treturn c.rows.Next()\n}\n\n//freeBatch frees the fetched batch\nfunc (c *Cursor) freeBatch() {\n\tif c.tuptable != nil {\n\t\tC.SPI_freetuptable(c.tuptable)\n\t\tc.tuptable, c.rows = nil, nil\n\t}\n}\n\n//Scan takes pointers to variables that will be filled with the values of the current row\nfunc (c *Cursor) Scan(args ...interface{}) error {\n\tif c.rows == nil {\n\t\treturn fmt.Errorf(\"Cursor has no current row\")\n\t}\n\treturn c.rows.Scan(args...)\n}\n\n//ScanStruct sets the exported fields of the struct pointed by dest from the columns of the current row,\n//as Rows.ScanStruct\nfunc (c *Cursor) ScanStruct(dest interface{}) error {\n\tif c.rows == nil {\n\t\treturn fmt.Errorf(\"Cursor has no current row\")\n\t}\n\treturn c.rows.ScanStruct(dest)\n}\n\n//Columns returns the names of columns, after the first Next\nfunc (c *Cursor) Columns() ([]string, error) {\n\tif c.rows == nil {\n\t\treturn nil, fmt.Errorf(\"Cursor has no current row\")\n\t}\n\treturn c.rows.Columns()\n}\n\n//Close frees the fetched rows and closes the cursor\nfunc (c *Cursor) Close() error {\n\tif c.portal == nil {\n\t\treturn nil\n\t}\n\tc.freeBatch()\n\tC.SPI_cursor_close(c.portal)\n\tc.portal = nil\n\treturn nil\n}\n",
+	"datetime.go":        "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"catalog/pg_type.h\"\n#include \"datatype/timestamp.h\"\n#include \"utils/date.h\"\n#include \"utils/timestamp.h\"\n\nextern Datum date_to_datum(DateADT val);\nextern Datum time_to_datum(Timestamp val);\nextern Datum timetz_to_datum(TimestampTz val);\nextern DateADT datum_to_date(Datum val);\nextern Timestamp datum_to_time(Datum val);\nextern TimestampTz datum_to_timetz(Datum val);\n\nDatum plgo_timeadt_to_datum(TimeADT val) {\n\treturn TimeADTGetDatum(val);\n}\n\nTimeADT plgo_datum_to_timeadt(Datum val) {\n\treturn DatumGetTimeADT(val);\n}\n\nDatum plgo_interval_to_datum(int64 time, int32 day, int32 month) {\n\tInterval *interval = palloc(sizeof(Interval));\n\n\tinterval->time = time;\n\tinterval->day = day;\n\tinterval->month = month;\n\treturn IntervalPGetDatum(interval);\n}\n\nvoid plgo_datum_to_interval(Datum val, int64 *time, int32 *day, int32 *month) {\n\tInterval *interval = DatumGetIntervalP(val);\n\n\t*time = interval->time;\n\t*day = interval->day;\n\t*month = interval->month;\n}\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"time\"\n)\n\n//pgEpoch is the Unix time of 2000-01-01 00:00:00 UTC, the epoch of the PostgreSQL timestamps and dates\nconst pgEpoch = 946684800\n\n//pgMicros returns the microseconds of the time since the PostgreSQL epoch\nfunc pgMicros(t time.Time) int64 {\n\treturn (t.Unix()-pgEpoch)*1000000 + int64(t.Nanosecond()/1000)\n}\n\n//fromPgMicros returns the time of the microseconds since the PostgreSQL epoch\nfunc fromPgMicros(micros int64) time.Time {\n\treturn time.Unix(pgEpoch+micros/1000000, micros%1000000*1000)\n}\n\n//wallClock returns the date and the clock of the time in its location as an UTC time,\n//the timestamp (without time zone) and the date keep the wall clock\nfunc wallClock(t time.Time) time.Time {\n\tyear, month, day := t.Date()\n\thour, min, sec := t.Clock()\n\treturn time.Date(year, month, day, hour, min, sec, t.Nanosecond(), time.UTC)\n}\n\n//timeDatum converts the time to the datum of the SQL type, timestamptz, timestamp, date or time (the time of day),\n//the types are declared with the //plgo:time directive\nfunc timeDatum(t time.Time, sqlType string) Datum {\n\tswitch sqlType {\n\tcase \"timestamp\":\n\t\treturn (Datum)(C.time_to_datum(C.Timestamp(pgMicros(wallClock(t)))))\n\tcase \"date\":\n\t\tyear, month, day := t.Date()\n\t\tdays := (time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() - pgEpoch) / (24 * 60 * 60)\n\t\treturn (Datum)(C.date_to_datum(C.DateADT(days)))\n\tcase \"time\":\n\t\thour, min, sec := t.Clock()\n\t\tmicros := (int64(hour)*3600+int64(min)*60+int64(sec))*1000000 + int64(t.Nanosecond()/1000)\n\t\treturn (Datum)(C.plgo_timeadt_to_datum(C.TimeADT(micros)))\n\t}\n\treturn (Datum)(C.timetz_to_datum(C.TimestampTz(pgMicros(t))))\n}\n\n//scanTime sets the time from the timestamptz (in the local time zone), timestamp (UTC), date (UTC midnight)\n//or time datum (the time of the day 0000-01-01 UTC)\nfunc scanTime(oid C.Oid, typeName string, val C.Datum, dest *time.Time) error {\n\tswitch oid {\n\tcase C.TIMESTAMPTZOID:\n\t\t*dest = fromPgMicros(int64(C.datum_to_timetz(val))).Local()\n\tcase C.TIMESTAMPOID:\n\t\t*dest = fromPgMicros(int64(C.datum_to_time(val))).UTC()\n\tcase C.DATEOID:\n\t\t*dest = time.Unix(pgEpoch+int64(C.datum_to_date(val))*24*60*60, 0).UTC()\n\tcase C.TIMEOID:\n\t\t*dest = time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(C.plgo_datum_to_timeadt(val)) * time.Microsecond)\n\tdefault:\n\t\treturn fmt.Errorf(\"Unsupported time type %s\", typeName)\n\t}\n\treturn nil\n}\n\n//intervalDatum converts the duration to an interval of microseconds, without days and months\nfunc intervalDatum(d time.Duration) Datum {\n\treturn (Datum)(C.plgo_interval_to_datum(C.int64(d.Microseconds()), 0, 0))\n}\n\n//scanDuration sets the duration from the interval, the days are 24 hours and the months 30 days as in the interval comparison,\n//or from the time of the day\nfunc scanDuration(oid C.Oid, typeName string, val C.Datum, dest *time.Duration) error {\n\tswitch oid {\n\tcase C.INTERVALOID:\n\t\tvar micros C.int64\n\t\tvar days, months C.int32\n\t\tC.plgo_datum_to_interval(val, &micros, &days, &months)\n\t\t*dest = time.Duration(micros)*time.Microsecond + time.Duration(int64(days)+int64(months)*30)*24*time.Hour\n\tcase C.TIMEOID:\n\t\t*dest = time.Duration(C.plgo_datum_to_timeadt(val)) * time.Microsecond\n\tdefault:\n\t\treturn fmt.Errorf(\"Column type is not interval %s\", typeName)\n\t}\n\treturn nil\n}\n",
+	"enum.go":            "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"utils/lsyscache.h\"\n\nextern Datum plgo_text_input(Oid type, char *text);\nextern char *plgo_text_output(Oid type, Datum value);\n\n//plgo_result_type returns the declared result type of the called function\nOid plgo_result_type(FunctionCallInfo fcinfo) {\n\treturn get_func_rettype(fcinfo->flinfo->fn_oid);\n}\n*/\nimport \"C\"\nimport (\n\t\"reflect\"\n\t\"unsafe\"\n)\n\n//enumDatum returns the datum of the label of the enum result of the function, the unknown label raises an ERROR\nfunc enumDatum(fcinfo *funcInfo, label string) Datum {\n\toid := C.plgo_result_type((C.FunctionCallInfo)(unsafe.Pointer(fcinfo)))\n\ttext := C.CString(label)\n\tdefer C.free(unsafe.Pointer(text))\n\treturn (Datum)(C.plgo_text_input(oid, text))\n}\n\n//scanEnum sets the string type pointed by the target to the label of the enum datum\nfunc scanEnum(oid C.Oid, val C.Datum, target reflect.Value) {\n\ttext := C.plgo_text_output(oid, val)\n\tdefer C.pfree(unsafe.Pointer(text))\n\ttarget.Elem().SetString(C.GoString(text))\n}\n",
+	"errors.go":          "package plgo\n\n/*\n#include \"postgres.h\"\n\n//plgo_raise_error raises an ERROR with the message and the detail if not NULL,\n//the SQLSTATE is ERRCODE_INTERNAL_ERROR if sqlstate is NULL\nvoid plgo_raise_error(const char *sqlstate, const char *message, const char *detail) {\n\tint code = ERRCODE_INTERNAL_ERROR;\n\n\tif (sqlstate != NULL)\n\t\tcode = MAKE_SQLSTATE(sqlstate[0], sqlstate[1], sqlstate[2], sqlstate[3], sqlstate[4]);\n\tereport(ERROR, (errcode(code), errmsg(\"%s\", message), detail != NULL ? errdetail(\"%s\", detail) : 0));\n}\n\n//plgo_raise_fields raises an ERROR as plgo_raise_error with the hint and the names of the object if not NULL\nvoid plgo_raise_fields(const char *sqlstate, const char *message, const char *detail, const char *hint,\n\t\t\t\t\t   const char *schema, const char *table, const char *column, const char *datatype, const char *constraint) {\n\tint code = ERRCODE_INTERNAL_ERROR;\n\n\tif (sqlstate != NULL)\n\t\tcode = MAKE_SQLSTATE(sqlstate[0], sqlstate[1], sqlstate[2], sqlstate[3], sqlstate[4]);\n\tereport(ERROR, (errcode(code), errmsg(\"%s\", message),\n\t\t\t\t\tdetail != NULL ? errdetail(\"%s\", detail) : 0,\n\t\t\t\t\thint != NULL ? errhint(\"%s\", hint) : 0,\n\t\t\t\t\tschema != NULL ? err_generic_string(PG_DIAG_SCHEMA_NAME, schema) : 0,\n\t\t\t\t\ttable != NULL ? err_generic_string(PG_DIAG_TABLE_NAME, table) : 0,\n\t\t\t\t\tcolumn != NULL ? err_generic_string(PG_DIAG_COLUMN_NAME, column) : 0,\n\t\t\t\t\tdatatype != NULL ? err_generic_string(PG_DIAG_DATATYPE_NAME, datatype) : 0,\n\t\t\t\t\tconstraint != NULL ? err_generic_string(PG_DIAG_CONSTRAINT_NAME, constraint) : 0));\n}\n*/\nimport \"C\"\nimport \"errors\"\n\n//SQLStater is implemented by the errors with an SQLSTATE code, e.g. 22023 (invalid_parameter_value).\n//The error returned by an exported function is raised with its code\ntype SQLStater interface {\n\tSQLState() string\n}\n\n//sqlStateError is an error with an SQLSTATE code\ntype sqlStateError struct {\n\tcode string\n\terr  error\n}\n\nfunc (e *sqlStateError) Error() string {\n\treturn e.err.Error()\n}\n\nfunc (e *sqlStateError) SQLState() string {\n\treturn e.code\n}\n\nfunc (e *sqlStateError) Unwrap() error {\n\treturn e.err\n}\n\n//WithSQLState returns the error with the SQLSTATE code, it is raised with the code when returned by an exported function\n//\n//\treturn 0, plgo.WithSQLState(\"22023\", fmt.Errorf(\"negative amount %d\", amount))\nfunc WithSQLState(code string, err error) error {\n\tif err == nil {\n\t\treturn nil\n\t}\n\treturn &sqlStateError{code: code, err: err}\n}\n\n//Error is an error raised with the SQLSTATE code and the fields of the PostgreSQL error, the clients can handle it\n//by the code (e.g. 23505 unique_violation) and the names of the object\n//\n//\treturn &plgo.Error{Code: \"23514\", Message: \"negative balance\", Detail: fmt.Sprintf(\"Account %d has %d.\", id, balance),\n//\t\tTable: \"accounts\", Constraint: \"balance_positive\"}\ntype Error struct {\n\t//Code is the SQLSTATE, internal_error (XX000) if empty\n\tCode    string\n\tMessage string\n\t//Detail and Hint are reported as DETAIL and HINT\n\tDetail, Hint string\n\t//Schema, Table, Column, Datatype and Constraint are the names of the object the error is about\n\tSchema, Table, Column, Datatype, Constraint string\n\t//Err is the cause of the error, it's not reported\n\tErr error\n}\n\nfunc (e *Error) Error() string {\n\treturn e.Message\n}\n\nfunc (e *Error) SQLState() string {\n\treturn e.Code\n}\n\nfunc (e *Error) Unwrap() error {\n\treturn e.Err\n}\n\n//validSQLState reports if the code is an SQLSTATE, five digits or upper case letters\nfunc validSQLState(code string) bool {\n\tif len(code) != 5 {\n\t\treturn false\n\t}\n\tfor _, c := range code {\n\t\tif (c < '0' || c > '9') && (c < 'A' || c > 'Z') {\n\t\t\treturn false\n\t\t}\n\t}\n\treturn true\n}\n\n//raiseError raises the error returned by an exported function as an PostgreSQL ERROR,\n//with the fields of the first *Error in its chain, otherwise with the SQLSTATE of the first error implementing SQLStater\nfunc raiseError(err error) {\n\tvar pgError *Error\n\tif errors.As(err, &pgError) {\n\t\traiseFields(pgError, err.Error())\n\t}\n\tvar stater SQLStater\n\tif errors.As(err, &stater) && validSQLState(stater.SQLState()) {\n\t\traise(stater.SQLState(), err.Error(), \"\")\n\t}\n\traise(\"\", err.Error(), \"\")\n}\n\n//raise raises an ERROR with the SQLSTATE code (internal_error if empty), the message and the detail if not empty\nfunc raise(code, message, detail string) {\n\t//the strings are freed with the C memory of the aborted call\n\tvar ccode, cdetail *C.char\n\tif code != \"\" {\n\t\tccode = C.CString(code)\n\t}\n\tif detail != \"\" {\n\t\tcdetail = C.CString(detail)\n\t}\n\tC.plgo_raise_error(ccode, C.CString(message), cdetail)\n}\n\n//raiseFields raises an ERROR with the message and the fields of the error, the invalid code is internal_error\nfunc raiseFields(e *Error, message string) {\n\t//the strings are freed with the C memory of the aborted call\n\tcstring := func(s string) *C.char {\n\t\tif s == \"\" {\n\t\t\treturn nil\n\t\t}\n\t\treturn C.CString(s)\n\t}\n\tcode := e.Code\n\tif !validSQLState(code) {\n\t\tcode = \"\"\n\t}\n\tC.plgo_raise_fields(cstring(code), C.CString(message), cstring(e.Detail), cstring(e.Hint),\n\t\tcstring(e.Schema), cstring(e.Table), cstring(e.Column), cstring(e.Datatype), cstring(e.Constraint))\n}\n",
+	"eventtrigger.go":    "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"commands/event_trigger.h\"\n\nbool plgo_called_as_event_trigger(FunctionCallInfo fcinfo) {\n\treturn CALLED_AS_EVENT_TRIGGER(fcinfo);\n}\n\nconst char *plgo_event_trigger_event(FunctionCallInfo fcinfo) {\n\treturn ((EventTriggerData *) fcinfo->context)->event;\n}\n\n//plgo_event_trigger_tag returns the command tag, e.g. CREATE TABLE\nconst char *plgo_event_trigger_tag(FunctionCallInfo fcinfo) {\n#if PG_VERSION_NUM >= 130000\n\treturn GetCommandTagName(((EventTriggerData *) fcinfo->context)->tag);\n#else\n\treturn ((EventTriggerData *) fcinfo->context)->tag;\n#endif\n}\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"unsafe\"\n)\n\n//EventTriggerData is the event passed to an event trigger function declared with //plgo:event-trigger,\n//func(ev *plgo.EventTriggerData) error\ntype EventTriggerData struct {\n\t//Event is ddl_command_start, ddl_command_end, sql_drop or table_rewrite\n\tEvent string\n\t//Tag is the command tag of the command firing the event, e.g. CREATE TABLE\n\tTag string\n}\n\n//DDLCommand is an object created or altered by the command, an row of pg_event_trigger_ddl_commands()\ntype DDLCommand struct {\n\tClassID, ObjID Oid\n\tObjSubID       int32\n\tCommandTag     string\n\tObjectType     string\n\t//SchemaName is \"\" for the objects not in an schema\n\tSchemaName     string\n\tObjectIdentity string\n\tInExtension    bool\n}\n\n//DroppedObject is an object dropped by the command, an row of pg_event_trigger_dropped_objects()\ntype DroppedObject struct {\n\tClassID, ObjID Oid\n\tObjSubID       int32\n\t//Original is true for the objects named in the command, Normal for the objects dropped by an normal dependency\n\tOriginal, Normal bool\n\tIsTemporary      bool\n\tObjectType       string\n\t//SchemaName and ObjectName are \"\" when they don't apply to the object\n\tSchemaName, ObjectName string\n\tObjectIdentity         string\n\tAddressNames           []string\n\tAddressArgs            []string\n}\n\n//EventTriggerData returns the event data, if the function was called as an event trigger, else nil\nfunc (fcinfo *funcInfo) EventTriggerData() *EventTriggerData {\n\tcfcinfo := (C.FunctionCallInfo)(unsafe.Pointer(fcinfo))\n\tif C.plgo_called_as_event_trigger(cfcinfo) != (C._Bool)(true) {\n\t\treturn nil\n\t}\n\treturn &EventTriggerData{\n\t\tEvent: C.GoString(C.plgo_event_trigger_event(cfcinfo)),\n\t\tTag:   C.GoString(C.plgo_event_trigger_tag(cfcinfo)),\n\t}\n}\n\n//DDLCommands returns the objects created or altered by the command, it's available only in ddl_command_end\nfunc (ev *EventTriggerData) DDLCommands() ([]DDLCommand, error) {\n\tif ev.Event != \"ddl_command_end\" {\n\t\treturn nil, fmt.Errorf(\"DDLCommands is available only in ddl_command_end, not in %s\", ev.Event)\n\t}\n\tvar commands []DDLCommand\n\terr := queryEventObjects(`SELECT classid::bigint, objid::bigint, objsubid, command_tag, object_type,\n\t\tcoalesce(schema_name, ''), object_identity, in_extension FROM pg_event_trigger_ddl_commands()`, func(rows *Rows) error {\n\t\tvar c DDLCommand\n\t\tvar classID, objID int64\n\t\tif err := rows.Scan(&classID, &objID, &c.ObjSubID, &c.CommandTag, &c.ObjectType, &c.SchemaName, &c.ObjectIdentity, &c.InExtension); err != nil {\n\t\t\treturn err\n\t\t}\n\t\tc.ClassID, c.ObjID = Oid(classID), Oid(objID)\n\t\tcommands = append(commands, c)\n\t\treturn nil\n\t})\n\treturn commands, err\n}\n\n//DroppedObjects returns the objects dropped by the command, it's available only in sql_drop\nfunc (ev *EventTriggerData) DroppedObjects() ([]DroppedObject, error) {\n\tif ev.Event != \"sql_drop\" {\n\t\treturn nil, fmt.Errorf(\"DroppedObjects is available only in sql_drop, not in %s\", ev.Event)\n\t}\n\tvar objects []DroppedObject\n\terr := queryEventObjects(`SELECT classid::bigint, objid::bigint, objsubid, original, normal, is_temporary, object_type,\n\t\tcoalesce(schema_name, ''), coalesce(object_name, ''), object_identity, address_names, address_args\n\t\tFROM pg_event_trigger_dropped_objects()`, func(rows *Rows) error {\n\t\tvar o DroppedObject\n\t\tvar classID, objID int64\n\t\tif err := rows.Scan(&classID, &objID, &o.ObjSubID, &o.Original, &o.Normal, &o.IsTemporary, &o.ObjectType,\n\t\t\t&o.SchemaName, &o.ObjectName, &o.ObjectIdentity, &o.AddressNames, &o.AddressArgs); err != nil {\n\t\t\treturn err\n\t\t}\n\t\to.ClassID, o.ObjID = Oid(classID), Oid(objID)\n\t\tobjects = append(objects, o)\n\t\treturn nil\n\t})\n\treturn objects, err\n}\n\n//queryEventObjects runs the query of the event trigger function in its own SPI connection and calls scan for every row\nfunc queryEventObjects(query string, scan func(rows *Rows) error) error {\n\tdb, err := Open()\n\tif err != nil {\n\t\treturn err\n\t}\n\tdefer db.Close()\n\tstmt, err := db.Prepare(query, nil)\n\tif err != nil {\n\t\treturn err\n\t}\n\trows, err := stmt.Query()\n\tif err != nil {\n\t\treturn err\n\t}\n\tfor rows.Next() {\n\t\tif err = scan(rows); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n\treturn nil\n}\n",
+	"guc.go":             "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"utils/guc.h\"\n#include \"utils/memutils.h\"\n\nstatic char *guc_strdup_top(char *s) {\n\tif (s == NULL)\n\t\treturn NULL;\n\treturn MemoryContextStrdup(TopMemoryContext, s);\n}\n\nint *plgo_define_int_guc(char *name, char *short_desc, char *long_desc, int boot, int min, int max, int context, int flags) {\n\tint *value = MemoryContextAllocZero(TopMemoryContext, sizeof(int));\n\t*value = boot;\n\tDefineCustomIntVariable(name, guc_strdup_top(short_desc), guc_strdup_top(long_desc), value,\n\t\t\t\t\t\t\tboot, min, max, (GucContext) context, flags, NULL, NULL, NULL);\n\treturn value;\n}\n\nbool *plgo_define_bool_guc(char *name, char *short_desc, char *long_desc, bool boot, int context, int flags) {\n\tbool *value = MemoryContextAllocZero(TopMemoryContext, sizeof(bool));\n\t*value = boot;\n\tDefineCustomBoolVariable(name, guc_strdup_top(short_desc), guc_strdup_top(long_desc), value,\n\t\t\t\t\t\t\t boot, (GucContext) context, flags, NULL, NULL, NULL);\n\treturn value;\n}\n\ndouble *plgo_define_real_guc(char *name, char *short_desc, char *long_desc, double boot, double min, double max, int context, int flags) {\n\tdouble *value = MemoryContextAllocZero(TopMemoryContext, sizeof(double));\n\t*value = boot;\n\tDefineCustomRealVariable(name, guc_strdup_top(short_desc), guc_strdup_top(long_desc), value,\n\t\t\t\t\t\t\t boot, min, max, (GucContext) context, flags, NULL, NULL, NULL);\n\treturn value;\n}\n\nchar **plgo_define_string_guc(char *name, char *short_desc, char *long_desc, char *boot, int context, int flags) {\n\tchar **value = MemoryContextAllocZero(TopMemoryContext, sizeof(char *));\n\tDefineCustomStringVariable(name, guc_strdup_top(short_desc), guc_strdup_top(long_desc), value,\n\t\t\t\t\t\t\t   guc_strdup_top(boot), (GucContext) context, flags, NULL, NULL, NULL);\n\treturn value;\n}\n\nstruct config_enum_entry *plgo_new_enum_options(int count) {\n\treturn MemoryContextAllocZero(TopMemoryContext, sizeof(struct config_enum_entry) * (count + 1));\n}\n\nvoid plgo_set_enum_option(struct config_enum_entry *options, int i, char *name, int val) {\n\toptions[i].name = guc_strdup_top(name);\n\toptions[i].val = val;\n\toptions[i].hidden = false;\n}\n\nint *plgo_define_enum_guc(char *name, char *short_desc, char *long_desc, int boot, struct config_enum_entry *options, int context, int flags) {\n\tint *value = MemoryContextAllocZero(TopMemoryContext, sizeof(int));\n\t*value = boot;\n\tDefineCustomEnumVariable(name, guc_strdup_top(short_desc), guc_strdup_top(long_desc), value,\n\t\t\t\t\t\t\t boot, options, (GucContext) context, flags, NULL, NULL, NULL);\n\treturn value;\n}\n\nvoid plgo_reserve_guc_prefix(char *prefix) {\n#if PG_VERSION_NUM >= 150000\n\tMarkGUCPrefixReserved(prefix);\n#else\n\tEmitWarningsOnPlaceholders(prefix);\n#endif\n}\n*/\nimport \"C\"\nimport \"unsafe\"\n\n//gucContext is the context in which the setting can be changed\ntype gucContext int\n\n//gucContext constants\nconst (\n\tgucUserset    gucContext = C.PGC_USERSET\n\tgucSuset      gucContext = C.PGC_SUSET\n\tgucSighup     gucContext = C.PGC_SIGHUP\n\tgucBackend    gucContext = C.PGC_BACKEND\n\tgucPostmaster gucContext = C.PGC_POSTMASTER\n)\n\n//flags of the settings\nconst (\n\t//gucUnitMs is the flag for settings in milliseconds\n\tgucUnitMs = C.GUC_UNIT_MS\n\t//gucUnitKB is the flag for settings in kilobytes\n\tgucUnitKB = C.GUC_UNIT_KB\n\t//gucSuperuserOnly hides the setting from the other users\n\tgucSuperuserOnly = C.GUC_SUPERUSER_ONLY\n)\n\n//gucVar is a custom configuration variable <extension>.<name>,\n//the variables are defined from _PG_init\ntype gucVar interface {\n\tdefine(fullName *C.char)\n\tgucName() string\n}\n\nvar gucVars []gucVar\n\nfunc init() {\n\tonInit(defineGUCs)\n}\n\nfunc registerGUC(v gucVar) {\n\tgucVars = append(gucVars, v)\n}\n\nfunc defineGUCs() {\n\tif len(gucVars) == 0 {\n\t\treturn\n\t}\n\tfor _, v := range gucVars {\n\t\tcname := C.CString(extensionName + \".\" + v.gucName())\n\t\tv.define(cname)\n\t\tC.free(unsafe.Pointer(cname))\n\t}\n\tcprefix := C.CString(extensionName)\n\tdefer C.free(unsafe.Pointer(cprefix))\n\tC.plgo_reserve_guc_prefix(cprefix)\n}\n\n//gucDesc has the common fields of the configuration variables\ntype gucDesc struct {\n\tname      string\n\tshortDesc string\n\tlongDesc  string\n\tcontext   gucContext\n\tflags     int\n}\n\nfunc (d *gucDesc) gucName() string {\n\treturn d.name\n}\n\n//cDesc returns the C strings of the descriptions, they must be freed by the caller\nfunc (d *gucDesc) cDesc() (*C.char, *C.char) {\n\tvar long *C.char\n\tif d.longDesc != \"\" {\n\t\tlong = C.CString(d.longDesc)\n\t}\n\treturn C.CString(d.shortDesc), long\n}\n\nfunc freeDesc(short, long *C.char) {\n\tC.free(unsafe.Pointer(short))\n\tif long != nil {\n\t\tC.free(unsafe.Pointer(long))\n\t}\n}\n\ntype intGUC struct {\n\tgucDesc\n\tboot, min, max int\n\tvalue          *C.int\n}\n\nfunc newIntGUC(desc gucDesc, boot, min, max int) *intGUC {\n\tg := &intGUC{gucDesc: desc, boot: boot, min: min, max: max}\n\tregisterGUC(g)\n\treturn g\n}\n\nfunc (g *intGUC) define(fullName *C.char) {\n\tshort, long := g.cDesc()\n\tdefer freeDesc(short, long)\n\tg.value = C.plgo_define_int_guc(fullName, short, long, C.int(g.boot), C.int(g.min), C.int(g.max), C.int(g.context), C.int(g.flags))\n}\n\n//get returns the current value of the variable\nfunc (g *intGUC) get() int {\n\tif g.value == nil {\n\t\treturn g.boot\n\t}\n\treturn int(*g.value)\n}\n\ntype boolGUC struct {\n\tgucDesc\n\tboot  bool\n\tvalue *C.bool\n}\n\nfunc newBoolGUC(desc gucDesc, boot bool) *boolGUC {\n\tg := &boolGUC{gucDesc: desc, boot: boot}\n\tregisterGUC(g)\n\treturn g\n}\n\nfunc (g *boolGUC) define(fullName *C.char) {\n\tshort, long := g.cDesc()\n\tdefer freeDesc(short, long)\n\tg.value = C.plgo_define_bool_guc(fullName, short, long, (C._Bool)(g.boot), C.int(g.context), C.int(g.flags))\n}\n\nfunc (g *boolGUC) get() bool {\n\tif g.value == nil {\n\t\treturn g.boot\n\t}\n\treturn *g.value == (C._Bool)(true)\n}\n\ntype realGUC struct {\n\tgucDesc\n\tboot, min, max float64\n\tvalue          *C.double\n}\n\nfunc newRealGUC(desc gucDesc, boot, min, max float64) *realGUC {\n\tg := &realGUC{gucDesc: desc, boot: boot, min: min, max: max}\n\tregisterGUC(g)\n\treturn g\n}\n\nfunc (g *realGUC) define(fullName *C.char) {\n\tshort, long := g.cDesc()\n\tdefer freeDesc(short, long)\n\tg.value = C.plgo_define_real_guc(fullName, short, long, C.double(g.boot), C.double(g.min), C.double(g.max), C.int(g.context), C.int(g.flags))\n}\n\nfunc (g *realGUC) get() float64 {\n\tif g.value == nil {\n\t\treturn g.boot\n\t}\n\treturn float64(*g.value)\n}\n\ntype stringGUC struct {\n\tgucDesc\n\tboot  string\n\tvalue **C.char\n}\n\nfunc newStringGUC(desc gucDesc, boot string) *stringGUC {\n\tg := &stringGUC{gucDesc: desc, boot: boot}\n\tregisterGUC(g)\n\treturn g\n}\n\nfunc (g *stringGUC) define(fullName *C.char) {\n\tshort, long := g.cDesc()\n\tdefer freeDesc(short, long)\n\tboot := C.CString(g.boot)\n\tdefer C.free(unsafe.Pointer(boot))\n\tg.value = C.plgo_define_string_guc(fullName, short, long, boot, C.int(g.context), C.int(g.flags))\n}\n\nfunc (g *stringGUC) get() string {\n\tif g.value == nil {\n\t\treturn g.boot\n\t}\n\tif *g.value == nil {\n\t\treturn \"\"\n\t}\n\treturn C.GoString(*g.value)\n}\n\ntype enumGUC struct {\n\tgucDesc\n\tboot    int\n\toptions []string\n\tvalue   *C.int\n}\n\n//newEnumGUC defines an enum variable, the value is the index of the option\nfunc newEnumGUC(desc gucDesc, boot int, options []string) *enumGUC {\n\tg := &enumGUC{gucDesc: desc, boot: boot, options: options}\n\tregisterGUC(g)\n\treturn g\n}\n\nfunc (g *enumGUC) define(fullName *C.char) {\n\tshort, long := g.cDesc()\n\tdefer freeDesc(short, long)\n\toptions := C.plgo_new_enum_options(C.int(len(g.options)))\n\tfor i, option := range g.options {\n\t\tcoption := C.CString(option)\n\t\tC.plgo_set_enum_option(options, C.int(i), coption, C.int(i))\n\t\tC.free(unsafe.Pointer(coption))\n\t}\n\tg.value = C.plgo_define_enum_guc(fullName, short, long, C.int(g.boot), options, C.int(g.context), C.int(g.flags))\n}\n\nfunc (g *enumGUC) get() int {\n\tif g.value == nil {\n\t\treturn g.boot\n\t}\n\treturn int(*g.value)\n}\n",
+	"gucapi.go":          "package plgo\n\nimport (\n\t\"fmt\"\n\t\"regexp\"\n)\n\n//GUCContext is the context in which an setting of the extension can be changed\ntype GUCContext int\n\n//GUCContext constants\nconst (\n\t//GUCUserset settings can be changed by any user with SET\n\tGUCUserset = GUCContext(gucUserset)\n\t//GUCSuset settings can be changed by superusers with SET\n\tGUCSuset = GUCContext(gucSuset)\n\t//GUCSighup settings are changed in postgresql.conf and reloaded\n\tGUCSighup = GUCContext(gucSighup)\n\t//GUCBackend settings are fixed when the session starts\n\tGUCBackend = GUCContext(gucBackend)\n\t//GUCPostmaster settings are changed by an restart of the server, the extension must be in shared_preload_libraries\n\tGUCPostmaster = GUCContext(gucPostmaster)\n)\n\n//gucNameRe matches the valid names of the settings\nvar gucNameRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)\n\n//publicDesc returns the description of the setting defined by the package,\n//it panics if the name is invalid or already used by the extension\nfunc publicDesc(name, description string, context GUCContext) gucDesc {\n\tif !gucNameRe.MatchString(name) {\n\t\tpanic(fmt.Sprintf(\"plgo: invalid setting name %q\", name))\n\t}\n\tfor _, v := range gucVars {\n\t\tif v.gucName() == name {\n\t\t\tpanic(fmt.Sprintf(\"plgo: setting %s is already defined\", name))\n\t\t}\n\t}\n\treturn gucDesc{name: name, shortDesc: description, context: gucContext(context)}\n}\n\n//IntGUC is an integer setting of the extension defined with DefineIntGUC\ntype IntGUC struct {\n\tguc *intGUC\n}\n\n//DefineIntGUC defines the setting <extension>.<name> with the default value and the range,\n//it must be called from an init() function or an variable declaration of the package:\n//\n//\tvar batchSize = plgo.DefineIntGUC(\"batch_size\", \"Sets the number of rows processed in one batch.\", 100, 1, 10000, plgo.GUCUserset)\nfunc DefineIntGUC(name, description string, boot, min, max int, context GUCContext) *IntGUC {\n\treturn &IntGUC{newIntGUC(publicDesc(name, description, context), boot, min, max)}\n}\n\n//Get returns the current value of the setting\nfunc (g *IntGUC) Get() int {\n\treturn g.guc.get()\n}\n\n//BoolGUC is an boolean setting of the extension defined with DefineBoolGUC\ntype BoolGUC struct {\n\tguc *boolGUC\n}\n\n//DefineBoolGUC defines the boolean setting <extension>.<name>, like DefineIntGUC\nfunc DefineBoolGUC(name, description string, boot bool, context GUCContext) *BoolGUC {\n\treturn &BoolGUC{newBoolGUC(publicDesc(name, description, context), boot)}\n}\n\n//Get returns the current value of the setting\nfunc (g *BoolGUC) Get() bool {\n\treturn g.guc.get()\n}\n\n//FloatGUC is an floating point setting of the extension defined with DefineFloatGUC\ntype FloatGUC struct {\n\tguc *realGUC\n}\n\n//DefineFloatGUC defines the floating point setting <extension>.<name> with the default value and the range, like DefineIntGUC\nfunc DefineFloatGUC(name, description string, boot, min, max float64, context GUCContext) *FloatGUC {\n\treturn &FloatGUC{newRealGUC(publicDesc(name, description, context), boot, min, max)}\n}\n\n//Get returns the current value of the setting\nfunc (g *FloatGUC) Get() float64 {\n\treturn g.guc.get()\n}\n\n//StringGUC is an string setting of the extension defined with DefineStringGUC\ntype StringGUC struct {\n\tguc *stringGUC\n}\n\n//DefineStringGUC defines the string setting <extension>.<name>, like DefineIntGUC\nfunc DefineStringGUC(name, description, boot string, context GUCContext) *StringGUC {\n\treturn &StringGUC{newStringGUC(publicDesc(name, description, context), boot)}\n}\n\n//Get returns the current value of the setting\nfunc (g *StringGUC) Get() string {\n\treturn g.guc.get()\n}\n\n//EnumGUC is an setting of the extension with one of the options, defined with DefineEnumGUC\ntype EnumGUC struct {\n\tguc *enumGUC\n}\n\n//DefineEnumGUC defines the setting <extension>.<name> with one of the options, boot is the default option, like DefineIntGUC\nfunc DefineEnumGUC(name, description, boot string, options []string, context GUCContext) *EnumGUC {\n\tfor i, option := range options {\n\t\tif option == boot {\n\t\t\treturn &EnumGUC{newEnumGUC(publicDesc(name, description, context), i, options)}\n\t\t}\n\t}\n\tpanic(fmt.Sprintf(\"plgo: setting %s: the default %q isn't an option\", name, boot))\n}\n\n//Get returns the current option of the setting\nfunc (g *EnumGUC) Get() string {\n\treturn g.guc.options[g.guc.get()]\n}\n",
+	"hstore.go":          "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"access/htup_details.h\"\n#include \"catalog/pg_type.h\"\n#include \"commands/extension.h\"\n#include \"utils/lsyscache.h\"\n#include \"utils/syscache.h\"\n\n//plgo_hstore_oid returns the oid of the hstore type in the schema of the hstore extension, InvalidOid without the extension\nOid plgo_hstore_oid(void) {\n\tOid extension = get_extension_oid(\"hstore\", true);\n\n\tif (!OidIsValid(extension))\n\t\treturn InvalidOid;\n#if PG_VERSION_NUM >= 120000\n\treturn GetSysCacheOid2(TYPENAMENSP, Anum_pg_type_oid, CStringGetDatum(\"hstore\"),\n\t\t\t\t\t\t   ObjectIdGetDatum(get_extension_schema(extension)));\n#else\n\treturn GetSysCacheOid2(TYPENAMENSP, CStringGetDatum(\"hstore\"),\n\t\t\t\t\t\t   ObjectIdGetDatum(get_extension_schema(extension)));\n#endif\n}\n\nDatum plgo_text_input(Oid type, char *text) {\n\tOid input, ioparam;\n\n\tgetTypeInputInfo(type, &input, &ioparam);\n\treturn OidInputFunctionCall(input, text, ioparam, -1);\n}\n\nchar *plgo_text_output(Oid type, Datum value) {\n\tOid output;\n\tbool varlena;\n\n\tgetTypeOutputInfo(type, &output, &varlena);\n\treturn OidOutputFunctionCall(output, value);\n}\n*/\nimport \"C\"\nimport (\n\t\"errors\"\n\t\"fmt\"\n\t\"sort\"\n\t\"strings\"\n\t\"unsafe\"\n)\n\n//hstoreOid returns the oid of the hstore type, an error if the hstore extension isn't created.\n//It isn't cached, the extension can be recreated\nfunc hstoreOid() (C.Oid, error) {\n\toid := C.plgo_hstore_oid()\n\tif oid == C.InvalidOid {\n\t\treturn oid, errors.New(\"The hstore extension is not created\")\n\t}\n\treturn oid, nil\n}\n\n//formatHstore returns the hstore text of the map, the nil values are NULL\nfunc formatHstore(m map[string]*string) string {\n\tkeys := make([]string, 0, len(m))\n\tfor key := range m {\n\t\tkeys = append(keys, key)\n\t}\n\tsort.Strings(keys)\n\tquote := strings.NewReplacer(`\\`, `\\\\`, `\"`, `\\\"`)\n\tpairs := make([]string, len(keys))\n\tfor i, key := range keys {\n\t\tpairs[i] = `\"` + quote.Replace(key) + `\"=>`\n\t\tif value := m[key]; value != nil {\n\t\t\tpairs[i] += `\"` + quote.Replace(*value) + `\"`\n\t\t} else {\n\t\t\tpairs[i] += \"NULL\"\n\t\t}\n\t}\n\treturn strings.Join(pairs, \", \")\n}\n\n//parseHstore parses the hstore text, as written by the hstore output function: \"key\"=>\"value\", \"key\"=>NULL\nfunc parseHstore(text string) (map[string]*string, error) {\n\tm := make(map[string]*string)\n\t//readQuoted reads the quoted string at the start of text, it returns the unescaped string and the rest of text\n\treadQuoted := func(text string) (string, string, error) {\n\t\tif !strings.HasPrefix(text, `\"`) {\n\t\t\treturn \"\", \"\", fmt.Errorf(\"Invalid hstore %q\", text)\n\t\t}\n\t\tvar b strings.Builder\n\t\tfor i := 1; i < len(text); i++ {\n\t\t\tswitch text[i] {\n\t\t\tcase '\\\\':\n\t\t\t\ti++\n\t\t\t\tif i < len(text) {\n\t\t\t\t\tb.WriteByte(text[i])\n\t\t\t\t}\n\t\t\tcase '\"':\n\t\t\t\treturn b.String(), text[i+1:], nil\n\t\t\tdefault:\n\t\t\t\tb.WriteByte(text[i])\n\t\t\t}\n\t\t}\n\t\treturn \"\", \"\", fmt.Errorf(\"Invalid hstore %q\", text)\n\t}\n\trest := strings.TrimSpace(text)\n\tfor rest != \"\" {\n\t\tkey, after, err := readQuoted(rest)\n\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t\tafter = strings.TrimSpace(after)\n\t\tif !strings.HasPrefix(after, \"=>\") {\n\t\t\treturn nil, fmt.Errorf(\"Invalid hstore %q\", text)\n\t\t}\n\t\tafter = strings.TrimSpace(after[2:])\n\t\tif strings.HasPrefix(after, \"NULL\") {\n\t\t\tm[key], after = nil, after[4:]\n\t\t} else {\n\t\t\tvalue, valueAfter, err := readQuoted(after)\n\t\t\tif err != nil {\n\t\t\t\treturn nil, err\n\t\t\t}\n\t\t\tm[key], after = &value, valueAfter\n\t\t}\n\t\trest = strings.TrimPrefix(strings.TrimSpace(after), \",\")\n\t\trest = strings.TrimSpace(rest)\n\t}\n\treturn m, nil\n}\n\n//hstoreDatum converts the map to an hstore datum\nfunc hstoreDatum(m map[string]*string) Datum {\n\toid, err := hstoreOid()\n\tif err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\ttext := C.CString(formatHstore(m))\n\tdefer C.free(unsafe.Pointer(text))\n\treturn (Datum)(C.plgo_text_input(oid, text))\n}\n\n//scanHstore sets the map from the hstore datum, an error if the type oid isn't hstore\nfunc scanHstore(oid C.Oid, typeName string, val C.Datum, dest *map[string]*string) error {\n\thstore, err := hstoreOid()\n\tif err != nil {\n\t\treturn err\n\t}\n\tif oid != hstore {\n\t\treturn fmt.Errorf(\"Column type is not hstore %s\", typeName)\n\t}\n\ttext := C.plgo_text_output(oid, val)\n\tdefer C.pfree(unsafe.Pointer(text))\n\tm, err := parseHstore(C.GoString(text))\n\tif err != nil {\n\t\treturn err\n\t}\n\t*dest = m\n\treturn nil\n}\n",
+	"httpclient.go":      "package plgo\n\nimport (\n\t\"io\"\n\t\"net/http\"\n\t\"time\"\n)\n\nvar httpClient *http.Client\n\n//HTTPClient returns the HTTP client of the backend. Its requests are canceled by an query cancel\n//or statement_timeout (the function then returns ErrInterrupted and the backend reports the cancel),\n//so the API calls can't hang the backend. The connections are reused by all calls in the backend.\n//The response body must be closed\nfunc HTTPClient() *http.Client {\n\tif httpClient == nil {\n\t\t//the clone keeps the restrictions of the default transport\n\t\tbase := http.DefaultTransport.(*http.Transport).Clone()\n\t\tbase.IdleConnTimeout = 5 * time.Minute\n\t\thttpClient = &http.Client{Transport: &interruptTransport{base: base}}\n\t}\n\treturn httpClient\n}\n\n//interruptTransport watches the backend interrupts during the request and reading of the response body\ntype interruptTransport struct {\n\tbase http.RoundTripper\n}\n\n//RoundTrip executes the request, it is canceled when the backend is interrupted\nfunc (t *interruptTransport) RoundTrip(req *http.Request) (*http.Response, error) {\n\tctx, watcher := watchInterrupts(req.Context())\n\tresp, err := t.base.RoundTrip(req.WithContext(ctx))\n\tif err != nil {\n\t\twatcher.stop()\n\t\treturn nil, watcher.err(err)\n\t}\n\tresp.Body = &interruptBody{ReadCloser: resp.Body, watcher: watcher}\n\treturn resp, nil\n}\n\n//interruptBody stops the interrupt watcher when the body is closed\ntype interruptBody struct {\n\tio.ReadCloser\n\twatcher *interruptWatcher\n}\n\nfunc (b *interruptBody) Read(p []byte) (int, error) {\n\tn, err := b.ReadCloser.Read(p)\n\tif err != nil && err != io.EOF {\n\t\terr = b.watcher.err(err)\n\t}\n\treturn n, err\n}\n\nfunc (b *interruptBody) Close() error {\n\terr := b.ReadCloser.Close()\n\tb.watcher.stop()\n\treturn err\n}\n",
+	"init.go":            "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"access/xact.h\"\n*/\nimport \"C\"\nimport \"unsafe\"\n\n//initFuncs are run from _PG_init when the extension library is loaded into the backend\nvar initFuncs []func()\n\n//abortFuncs are run when the transaction (or a subtransaction) is aborted,\n//e.g. after an ERROR jumped out of Go code\nvar abortFuncs []func(subID uint32)\n\n//onInit registers fn to be run from _PG_init,\n//PostgreSQL functions can be called only from there, not from the Go init() functions\nfunc onInit(fn func()) {\n\tinitFuncs = append(initFuncs, fn)\n}\n\n//onAbort registers fn to be run on a transaction abort (subID is 0)\n//or on a subtransaction abort (subID is the aborted subtransaction)\nfunc onAbort(fn func(subID uint32)) {\n\tabortFuncs = append(abortFuncs, fn)\n}\n\n//export plgo_init\nfunc plgo_init() {\n\tfor _, fn := range initFuncs {\n\t\tfn()\n\t}\n}\n\n//export plgo_xact_abort\nfunc plgo_xact_abort() {\n\t//the Rollback of an procedure aborts the transaction without an ERROR\n\tif endingTransaction {\n\t\treturn\n\t}\n\tfor _, fn := range abortFuncs {\n\t\tfn(0)\n\t}\n}\n\n//export plgo_subxact_abort\nfunc plgo_subxact_abort(subID C.SubTransactionId) {\n\tfor _, fn := range abortFuncs {\n\t\tfn(uint32(subID))\n\t}\n}\n\n//export plgo_worker_run\nfunc plgo_worker_run(name *C.char, arg C.int64) C.int {\n\treturn C.int(runWorker(C.GoString(name), int64(arg)))\n}\n\n//export plgo_aggregate_release\nfunc plgo_aggregate_release(handle C.uint64) {\n\treleaseAggregate(uint64(handle))\n}\n\n//export plgo_notification\nfunc plgo_notification(msg unsafe.Pointer, length C.int) {\n\treceiveNotification(C.GoBytes(msg, length))\n}\n",
+	"interrupt.go":       "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"miscadmin.h\"\n\nint plgo_interrupt_pending(void) {\n\treturn InterruptPending && (QueryCancelPending || ProcDiePending);\n}\n*/\nimport \"C\"\nimport (\n\t\"context\"\n\t\"errors\"\n\t\"sync\"\n\t\"sync/atomic\"\n\t\"time\"\n)\n\n//ErrInterrupted is returned when an operation was canceled by an query cancel,\n//statement_timeout or backend termination\nvar ErrInterrupted = errors.New(\"plgo: canceled by query cancel or statement timeout\")\n\n//interruptPollInterval is how often the interrupt flags are checked while Go code waits\nconst interruptPollInterval = 50 * time.Millisecond\n\n//interruptPending reports whether the backend received an query cancel (including statement_timeout) or termination,\n//the flags are set by the signal handlers, so they can be read while the backend waits in Go code.\n//The interrupt itself is processed by the backend at the next CHECK_FOR_INTERRUPTS\nfunc interruptPending() bool {\n\treturn C.plgo_interrupt_pending() != 0\n}\n\n//interruptWatchers are the running watchers, they are stopped when the transaction aborts\nvar interruptWatchers = struct {\n\tsync.Mutex\n\trunning map[*interruptWatcher]bool\n}{running: make(map[*interruptWatcher]bool)}\n\n//interruptWatcher cancels an context when the backend is interrupted\ntype interruptWatcher struct {\n\tcancel      context.CancelFunc\n\tdone        chan struct{}\n\tonce        sync.Once\n\tinterrupted atomic.Bool\n}\n\n//watchInterrupts returns an context derived from parent that is canceled on an interrupt of the backend,\n//the watcher must be stopped when the operation finished\nfunc watchInterrupts(parent context.Context) (context.Context, *interruptWatcher) {\n\tctx, cancel := context.WithCancel(parent)\n\tw := &interruptWatcher{cancel: cancel, done: make(chan struct{})}\n\tinterruptWatchers.Lock()\n\tinterruptWatchers.running[w] = true\n\tinterruptWatchers.Unlock()\n\tgo func() {\n\t\tticker := time.NewTicker(interruptPollInterval)\n\t\tdefer ticker.Stop()\n\t\tfor {\n\t\t\tselect {\n\t\t\tcase <-w.done:\n\t\t\t\treturn\n\t\t\tcase <-ctx.Done():\n\t\t\t\treturn\n\t\t\tcase <-ticker.C:\n\t\t\t\tif interruptPending() {\n\t\t\t\t\tw.interrupted.Store(true)\n\t\t\t\t\tcancel()\n\t\t\t\t\treturn\n\t\t\t\t}\n\t\t\t}\n\t\t}\n\t}()\n\treturn ctx, w\n}\n\n//stop stops the watcher and cancels its context\nfunc (w *interruptWatcher) stop() {\n\tw.once.Do(func() {\n\t\tclose(w.done)\n\t\tw.cancel()\n\t\tinterruptWatchers.Lock()\n\t\tdelete(interruptWatchers.running, w)\n\t\tinterruptWatchers.Unlock()\n\t})\n}\n\n//err returns ErrInterrupted if the context was canceled by an interrupt, otherwise err\nfunc (w *interruptWatcher) err(err error) error {\n\tif err != nil && w.interrupted.Load() {\n\t\treturn ErrInterrupted\n\t}\n\treturn err\n}\n\nfunc init() {\n\t//the operations interrupted by an ERROR are never finished\n\tonAbort(func(subID uint32) {\n\t\tif subID != 0 {\n\t\t\treturn\n\t\t}\n\t\tinterruptWatchers.Lock()\n\t\twatchers := make([]*interruptWatcher, 0, len(interruptWatchers.running))\n\t\tfor w := range interruptWatchers.running {\n\t\t\twatchers = append(watchers, w)\n\t\t}\n\t\tinterruptWatchers.Unlock()\n\t\tfor _, w := range watchers {\n\t\t\tw.stop()\n\t\t}\n\t})\n}\n",
+	"jobs.go":            "package plgo\n\nimport (\n\t\"encoding/json\"\n\t\"errors\"\n\t\"fmt\"\n\t\"runtime/debug\"\n\t\"strconv\"\n\t\"strings\"\n\t\"time\"\n)\n\n//JobFunc is the Go function of an scheduled job, it runs in an transaction which is committed if it returns nil\ntype JobFunc func(db *DB) error\n\n//job is an registered scheduled job\ntype job struct {\n\tname     string\n\tschedule string\n\tfn       JobFunc\n}\n\n//jobs are the registered jobs by name\nvar jobs = make(map[string]*job)\n\n//background workers of the scheduler\nconst (\n\tjobSchedulerName = \"job scheduler\"\n\tjobRunnerName    = \"job runner\"\n)\n\n//jobsDatabase is <extension>.jobs_database\nvar jobsDatabase *stringGUC\n\n//RegisterJob registers an Go job run by the cron schedule (e.g. \"*/5 * * * *\" or \"@daily\", in UTC).\n//The schedule is stored in the <extension>_jobs table when the scheduler starts,\n//where it can be changed, the job disabled or its retries configured.\n//The jobs are run by an background worker connected to the <extension>.jobs_database,\n//so the extension must be loaded with shared_preload_libraries.\n//It must be called from an init() function of the package\nfunc RegisterJob(name, schedule string, fn JobFunc) {\n\tif _, err := parseCron(schedule); err != nil {\n\t\tpanic(fmt.Sprintf(\"plgo: job %s: %s\", name, err))\n\t}\n\tjobs[name] = &job{name: name, schedule: schedule, fn: fn}\n\tif jobsDatabase != nil {\n\t\treturn\n\t}\n\tjobsDatabase = newStringGUC(gucDesc{\n\t\tname:      \"jobs_database\",\n\t\tshortDesc: \"Sets the database where the scheduled jobs of the extension run.\",\n\t\tcontext:   gucPostmaster,\n\t}, \"postgres\")\n\tdatabase := func() string { return jobsDatabase.get() }\n\tregisterWorker(&worker{name: jobSchedulerName, database: database, restart: 10 * time.Second, main: scheduleJobs})\n\tregisterWorker(&worker{name: jobRunnerName, database: database, dynamic: true, main: runJob})\n}\n\n//cronSchedule is an parsed cron expression, the fields are bitmaps of the allowed values\ntype cronSchedule struct {\n\tminute, hour, dom, month, dow uint64\n\t//domStar and dowStar are true if the day field is *, the days are matched as in cron:\n\t//if both day fields are restricted, either of them matches\n\tdomStar, dowStar bool\n}\n\nvar cronMacros = map[string]string{\n\t\"@yearly\":   \"0 0 1 1 *\",\n\t\"@annually\": \"0 0 1 1 *\",\n\t\"@monthly\":  \"0 0 1 * *\",\n\t\"@weekly\":   \"0 0 * * 0\",\n\t\"@daily\":    \"0 0 * * *\",\n\t\"@midnight\": \"0 0 * * *\",\n\t\"@hourly\":   \"0 * * * *\",\n}\n\n//parseCron parses the 5 field cron expression: minute hour day-of-month month day-of-week,\n//the fields can be *, numbers, ranges (1-5), steps (*/10, 0-30/5) and lists (1,15)\nfunc parseCron(expr string) (*cronSchedule, error) {\n\tif macro, ok := cronMacros[strings.TrimSpace(expr)]; ok {\n\t\texpr = macro\n\t}\n\tfields := strings.Fields(expr)\n\tif len(fields) != 5 {\n\t\treturn nil, fmt.Errorf(\"cron expression %q must have 5 fields\", expr)\n\t}\n\tbounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}\n\tvar bits [5]uint64\n\tfor i, field := range fields {\n\t\tvar err error\n\t\tif bits[i], err = parseCronField(field, bounds[i][0], bounds[i][1]); err != nil {\n\t\t\treturn nil, fmt.Errorf(\"cron expression %q: %w\", expr, err)\n\t\t}\n\t}\n\t//sunday is 0 or 7\n\tif bits[4]&(1<<7) != 0 {\n\t\tbits[4] |= 1\n\t}\n\treturn &cronSchedule{\n\t\tminute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],\n\t\tdomStar: fields[2] == \"*\", dowStar: fields[4] == \"*\",\n\t}, nil\n}\n\nfunc parseCronField(field string, min, max int) (uint64, error) {\n\tvar bits uint64\n\tfor _, part := range strings.Split(field, \",\") {\n\t\trangePart, stepPart, hasStep := strings.Cut(part, \"/\")\n\t\tstep := 1\n\t\tif hasStep {\n\t\t\tvar err error\n\t\t\tif step, err = strconv.Atoi(stepPart); err != nil || step < 1 {\n\t\t\t\treturn 0, fmt.Errorf(\"invalid step %q\", part)\n\t\t\t}\n\t\t}\n\t\tfrom, to := min, max\n\t\tif rangePart != \"*\" {\n\t\t\tfirst, last, isRange := strings.Cut(rangePart, \"-\")\n\t\t\tvar err error\n\t\t\tif from, err = strconv.Atoi(first); err != nil {\n\t\t\t\treturn 0, fmt.Errorf(\"invalid value %q\", part)\n\t\t\t}\n\t\t\tto = from\n\t\t\tif isRange {\n\t\t\t\tif to, err = strconv.Atoi(last); err != nil {\n\t\t\t\t\treturn 0, fmt.Errorf(\"invalid range %q\", part)\n\t\t\t\t}\n\t\t\t} else if hasStep {\n\t\t\t\tto = max\n\t\t\t}\n\t\t}\n\t\tif from < min || to > max || from > to {\n\t\t\treturn 0, fmt.Errorf(\"value out of range %q\", part)\n\t\t}\n\t\tfor v := from; v <= to; v += step {\n\t\t\tbits |= 1 << uint(v)\n\t\t}\n\t}\n\treturn bits, nil\n}\n\n//matches reports whether the schedule runs in the minute of t\nfunc (s *cronSchedule) matches(t time.Time) bool {\n\tif s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.month&(1<<uint(t.Month())) == 0 {\n\t\treturn false\n\t}\n\tdomMatch := s.dom&(1<<uint(t.Day())) != 0\n\tdowMatch := s.dow&(1<<uint(t.Weekday())) != 0\n\tif s.domStar || s.dowStar {\n\t\treturn domMatch && dowMatch\n\t}\n\treturn domMatch || dowMatch\n}\n\n//jobConfig is an row of the <extension>_jobs table\ntype jobConfig struct {\n\tName       string  `json:\"name\"`\n\tSchedule   string  `json:\"schedule\"`\n\tEnabled    bool    `json:\"enabled\"`\n\tMaxRetries int     `json:\"max_retries\"`\n\tRetryDelay float64 `json:\"retry_delay\"`\n}\n\n//jobRun is an run of an job started by the scheduler\ntype jobRun struct {\n\tid      int64\n\tjob     string\n\tattempt int\n\thandle  *workerHandle\n}\n\n//jobRetry is an failed run waiting for the retry\ntype jobRetry struct {\n\tjob     string\n\tattempt int\n\tat      time.Time\n}\n\n//scheduler is the state of the scheduler worker\ntype scheduler struct {\n\tctx *workerContext\n\t//schema of the extension, empty until the extension is found in the database\n\tschema     string\n\tlastLookup time.Time\n\tlastMinute time.Time\n\tconfigs    map[string]jobConfig\n\trunning    map[int64]*jobRun\n\tretries    []jobRetry\n}\n\n//table returns the qualified name of the extension table\nfunc (s *scheduler) table(name string) string {\n\treturn QuoteIdent(s.schema) + \".\" + QuoteIdent(extensionName+\"_\"+name)\n}\n\n//scheduleJobs is the main function of the scheduler worker\nfunc scheduleJobs(ctx *workerContext) error {\n\ts := &scheduler{ctx: ctx, running: make(map[int64]*jobRun), configs: make(map[string]jobConfig)}\n\tfor ctx.Wait(time.Second) {\n\t\tif s.schema == \"\" && !s.lookupSchema() {\n\t\t\tcontinue\n\t\t}\n\t\ts.checkRunning()\n\t\tnow := time.Now().UTC()\n\t\tif minute := now.Truncate(time.Minute); minute.After(s.lastMinute) {\n\t\t\ts.lastMinute = minute\n\t\t\ts.loadConfigs()\n\t\t\tfor _, config := range s.configs {\n\t\t\t\tschedule, err := parseCron(config.Schedule)\n\t\t\t\tif err != nil {\n\t\t\t\t\tLog.Warning(\"invalid job schedule\", \"job\", config.Name, \"error\", err)\n\t\t\t\t\tcontinue\n\t\t\t\t}\n\t\t\t\tif config.Enabled && schedule.matches(minute) {\n\t\t\t\t\ts.start(config.Name, 1)\n\t\t\t\t}\n\t\t\t}\n\t\t}\n\t\tpending := s.retries\n\t\ts.retries = nil\n\t\tfor _, retry := range pending {\n\t\t\tif now.Before(retry.at) {\n\t\t\t\ts.retries = append(s.retries, retry)\n\t\t\t\tcontinue\n\t\t\t}\n\t\t\ts.start(retry.job, retry.attempt)\n\t\t}\n\t}\n\treturn nil\n}\n\n//lookupSchema finds the schema of the extension and stores the registered jobs into its table,\n//the lookup is repeated every minute until the extension is created in the database\nfunc (s *scheduler) lookupSchema() bool {\n\tif time.Since(s.lastLookup) < time.Minute {\n\t\treturn false\n\t}\n\ts.lastLookup = time.Now()\n\terr := s.ctx.Transaction(func(db *DB) error {\n\t\tvar err error\n\t\tif s.schema, err = extensionSchema(db); err != nil || s.schema == \"\" {\n\t\t\treturn err\n\t\t}\n\t\tinsert, err := db.Prepare(\"INSERT INTO \"+s.table(\"jobs\")+\" (name, schedule) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING\",\n\t\t\t[]string{\"text\", \"text\"})\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\tfor _, j := range jobs {\n\t\t\tif err = insert.Exec(j.name, j.schedule); err != nil {\n\t\t\t\treturn err\n\t\t\t}\n\t\t}\n\t\t//the runs of the previous scheduler can't be followed anymore\n\t\tstale, err := db.Prepare(\"WITH stale AS (UPDATE \"+s.table(\"job_runs\")+\" SET status = 'failed', finished_at = now(), \"+\n\t\t\t\"error = 'scheduler restarted' WHERE status IN ('scheduled', 'running') RETURNING 1) SELECT count(*) FROM stale\", nil)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\t_, err = stale.QueryRow()\n\t\treturn err\n\t})\n\tif err != nil {\n\t\tLog.Warning(\"cannot initialize the job scheduler\", \"error\", err)\n\t\ts.schema = \"\"\n\t}\n\treturn s.schema != \"\"\n}\n\n//loadConfigs reads the <extension>_jobs table\nfunc (s *scheduler) loadConfigs() {\n\terr := s.ctx.Transaction(func(db *DB) error {\n\t\tstmt, err := db.Prepare(\"SELECT coalesce(json_agg(j), '[]')::text FROM (SELECT name, schedule, enabled, max_retries, \"+\n\t\t\t\"extract(epoch FROM retry_delay)::float8 AS retry_delay FROM \"+s.table(\"jobs\")+\") j\", nil)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\trow, err := stmt.QueryRow()\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\tvar data string\n\t\tif err = row.Scan(&data); err != nil {\n\t\t\treturn err\n\t\t}\n\t\tvar configs []jobConfig\n\t\tif err = json.Unmarshal([]byte(data), &configs); err != nil {\n\t\t\treturn err\n\t\t}\n\t\ts.configs = make(map[string]jobConfig)\n\t\tfor _, config := range configs {\n\t\t\tif _, ok := jobs[config.Name]; ok {\n\t\t\t\ts.configs[config.Name] = config\n\t\t\t}\n\t\t}\n\t\treturn nil\n\t})\n\tif err != nil {\n\t\tLog.Warning(\"cannot read the jobs\", \"error\", err)\n\t}\n}\n\n//start records the run and starts an runner worker for it,\n//the run is skipped if the previous run of the job is still running\nfunc (s *scheduler) start(name string, attempt int) {\n\tfor _, run := range s.running {\n\t\tif run.job == name {\n\t\t\ts.insertRun(name, attempt, \"skipped\", \"previous run is still running\")\n\t\t\treturn\n\t\t}\n\t}\n\tid, err := s.insertRun(name, attempt, \"scheduled\", \"\")\n\tif err != nil {\n\t\tLog.Warning(\"cannot schedule job\", \"job\", name, \"error\", err)\n\t\treturn\n\t}\n\thandle, err := startWorker(jobRunnerName, id)\n\tif err != nil {\n\t\ts.finishRun(id, err.Error())\n\t\ts.retry(&jobRun{id: id, job: name, attempt: attempt})\n\t\treturn\n\t}\n\ts.running[id] = &jobRun{id: id, job: name, attempt: attempt, handle: handle}\n}\n\nfunc (s *scheduler) insertRun(name string, attempt int, status, runError string) (id int64, err error) {\n\terr = s.ctx.Transaction(func(db *DB) error {\n\t\tstmt, err := db.Prepare(\"INSERT INTO \"+s.table(\"job_runs\")+\" (job, attempt, status, error, finished_at) \"+\n\t\t\t\"VALUES ($1, $2, $3, nullif($4, ''), CASE WHEN $3 = 'skipped' THEN now() END) RETURNING id\",\n\t\t\t[]string{\"text\", \"integer\", \"text\", \"text\"})\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\trow, err := stmt.QueryRow(name, int32(attempt), status, runError)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\treturn row.Scan(&id)\n\t})\n\treturn\n}\n\n//finishRun marks the run failed if the runner didn't record its result, returns the final status\nfunc (s *scheduler) finishRun(id int64, runError string) (status string) {\n\terr := s.ctx.Transaction(func(db *DB) error {\n\t\tstmt, err := db.Prepare(\"UPDATE \"+s.table(\"job_runs\")+\" SET status = CASE WHEN status IN ('scheduled', 'running') \"+\n\t\t\t\"THEN 'failed' ELSE status END, error = CASE WHEN status IN ('scheduled', 'running') THEN $2 ELSE error END, \"+\n\t\t\t\"finished_at = coalesce(finished_at, now()) WHERE id = $1 RETURNING status\", []string{\"bigint\", \"text\"})\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\trow, err := stmt.QueryRow(id, runError)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\treturn row.Scan(&status)\n\t})\n\tif err != nil {\n\t\tLog.Warning(\"cannot finish job run\", \"run\", id, \"error\", err)\n\t\treturn \"failed\"\n\t}\n\treturn status\n}\n\n//checkRunning finishes the runs whose workers exited\nfunc (s *scheduler) checkRunning() {\n\tfor id, run := range s.running {\n\t\tif !run.handle.stopped() {\n\t\t\tcontinue\n\t\t}\n\t\tdelete(s.running, id)\n\t\tif s.finishRun(id, \"job worker exited with an error, see the server log\") == \"failed\" {\n\t\t\ts.retry(run)\n\t\t}\n\t}\n}\n\n//retry schedules the next attempt of the failed run, if the job has retries left\nfunc (s *scheduler) retry(run *jobRun) {\n\tconfig, ok := s.configs[run.job]\n\tif !ok || run.attempt > config.MaxRetries {\n\t\treturn\n\t}\n\tdelay := time.Duration(config.RetryDelay * float64(time.Second))\n\ts.retries = append(s.retries, jobRetry{job: run.job, attempt: run.attempt + 1, at: time.Now().UTC().Add(delay)})\n}\n\n//errJobLocked is returned when the job is already running\nvar errJobLocked = errors.New(\"job is already running\")\n\n//runJob is the main function of the runner worker, it runs the job of the run ctx.arg\nfunc runJob(ctx *workerContext) error {\n\tid := ctx.arg\n\ts := &scheduler{}\n\tvar name string\n\terr := ctx.Transaction(func(db *DB) error {\n\t\tstmt, err := db.Prepare(\"SELECT n.nspname::text FROM pg_catalog.pg_extension e \"+\n\t\t\t\"JOIN pg_catalog.pg_namespace n ON n.oid = e.extnamespace WHERE e.extname = $1\", []string{\"text\"})\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\trow, err := stmt.QueryRow(extensionName)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\tif err = row.Scan(&s.schema); err != nil {\n\t\t\treturn err\n\t\t}\n\t\tstart, err := db.Prepare(\"UPDATE \"+s.table(\"job_runs\")+\" SET status = 'running', started_at = clock_timestamp() \"+\n\t\t\t\"WHERE id = $1 RETURNING job\", []string{\"bigint\"})\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\tif row, err = start.QueryRow(id); err != nil {\n\t\t\treturn err\n\t\t}\n\t\treturn row.Scan(&name)\n\t})\n\tif err != nil {\n\t\treturn err\n\t}\n\tj, ok := jobs[name]\n\tif !ok {\n\t\treturn recordRun(ctx, s, id, fmt.Errorf(\"job %s is not registered\", name))\n\t}\n\terr = ctx.Transaction(func(db *DB) error {\n\t\tlock, err := db.Prepare(\"SELECT pg_catalog.pg_try_advisory_xact_lock(pg_catalog.hashtext($1))\", []string{\"text\"})\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\trow, err := lock.QueryRow(extensionName + \".\" + name)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\tvar locked bool\n\t\tif err = row.Scan(&locked); err != nil {\n\t\t\treturn err\n\t\t}\n\t\tif !locked {\n\t\t\treturn errJobLocked\n\t\t}\n\t\tif err = runJobFunc(j, db); err != nil {\n\t\t\treturn err\n\t\t}\n\t\treturn succeedRun(db, s, id)\n\t})\n\tif err != nil {\n\t\treturn recordRun(ctx, s, id, err)\n\t}\n\treturn nil\n}\n\n//runJobFunc calls the job function, its panic is returned as an error\nfunc runJobFunc(j *job, db *DB) (err error) {\n\tdefer func() {\n\t\tif r := recover(); r != nil {\n\t\t\tLog.Warning(\"panic in job\", \"job\", j.name, \"panic\", fmt.Sprint(r), \"stack\", string(debug.Stack()))\n\t\t\terr = fmt.Errorf(\"panic: %v\", r)\n\t\t}\n\t}()\n\treturn j.fn(db)\n}\n\nfunc succeedRun(db *DB, s *scheduler, id int64) error {\n\tstmt, err := db.Prepare(\"UPDATE \"+s.table(\"job_runs\")+\" SET status = 'succeeded', finished_at = clock_timestamp() \"+\n\t\t\"WHERE id = $1 RETURNING id\", []string{\"bigint\"})\n\tif err != nil {\n\t\treturn err\n\t}\n\t_, err = stmt.QueryRow(id)\n\treturn err\n}\n\n//recordRun records the failed run in its own transaction, the transaction of the job was rolled back\nfunc recordRun(ctx *workerContext, s *scheduler, id int64, runError error) error {\n\treturn ctx.Transaction(func(db *DB) error {\n\t\tstmt, err := db.Prepare(\"UPDATE \"+s.table(\"job_runs\")+\" SET status = 'failed', finished_at = clock_timestamp(), \"+\n\t\t\t\"error = $2 WHERE id = $1 RETURNING id\", []string{\"bigint\", \"text\"})\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\t_, err = stmt.QueryRow(id, RedactSecrets(runError.Error()))\n\t\treturn err\n\t})\n}\n",
+	"jsonb.go":           "package plgo\n\nimport \"errors\"\n\n//JSONB is an raw jsonb document, it is passed to and returned from the functions without (un)marshaling.\n//The structs declared in the package are jsonb too, they are (un)marshaled with encoding/json\ntype JSONB []byte\n\n//document returns the document, nil is null\nfunc (j JSONB) document() []byte {\n\tif j == nil {\n\t\treturn []byte(\"null\")\n\t}\n\treturn j\n}\n\n//MarshalJSON returns the document\nfunc (j JSONB) MarshalJSON() ([]byte, error) {\n\treturn j.document(), nil\n}\n\n//UnmarshalJSON sets the document to an copy of data\nfunc (j *JSONB) UnmarshalJSON(data []byte) error {\n\tif j == nil {\n\t\treturn errors.New(\"plgo.JSONB: UnmarshalJSON on nil pointer\")\n\t}\n\t*j = append((*j)[0:0], data...)\n\treturn nil\n}\n\n//String returns the document\nfunc (j JSONB) String() string {\n\treturn string(j)\n}\n",
+	"largeobject.go":     "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"libpq/libpq-fs.h\"\n#include \"storage/large_object.h\"\n#include \"utils/memutils.h\"\n\nLargeObjectDesc *lo_open_desc(Oid oid, int mode) {\n\treturn inv_open(oid, mode, TopTransactionContext);\n}\n*/\nimport \"C\"\nimport (\n\t\"errors\"\n\t\"io\"\n\t\"unsafe\"\n)\n\n//Oid is an PostgreSQL object identifier\ntype Oid uint32\n\n//LargeObjectMode is the mode in which the large object is opened\ntype LargeObjectMode int\n\n//LargeObjectMode constants, can be combined LORead|LOWrite\nconst (\n\tLORead  LargeObjectMode = C.INV_READ\n\tLOWrite LargeObjectMode = C.INV_WRITE\n)\n\n//maxLargeObjectChunk is the maximum number of bytes read or written in one inv_read/inv_write call\nconst maxLargeObjectChunk = 1 << 30\n\n//LargeObject is an opened large object, it implements io.ReadWriteSeeker and io.Closer.\n//The large object must be closed before the end of the transaction\ntype LargeObject struct {\n\toid  Oid\n\tdesc *C.LargeObjectDesc\n}\n\n//CreateLargeObject creates a new empty large object and returns its Oid\nfunc CreateLargeObject() (Oid, error) {\n\toid := C.inv_create(0) // InvalidOid lets the server assign the Oid\n\tif oid == 0 {\n\t\treturn 0, errors.New(\"Cannot create large object\")\n\t}\n\treturn Oid(oid), nil\n}\n\n//OpenLargeObject opens the large object with the mode\nfunc OpenLargeObject(oid Oid, mode LargeObjectMode) (*LargeObject, error) {\n\tif mode&(LORead|LOWrite) == 0 {\n\t\treturn nil, errors.New(\"Large object mode must contain LORead or LOWrite\")\n\t}\n\tdesc := C.lo_open_desc(C.Oid(oid), C.int(mode))\n\tif desc == nil {\n\t\treturn nil, errors.New(\"Cannot open large object\")\n\t}\n\treturn &LargeObject{oid: oid, desc: desc}, nil\n}\n\n//UnlinkLargeObject removes the large object from the database\nfunc UnlinkLargeObject(oid Oid) error {\n\tif C.inv_drop(C.Oid(oid)) != 1 {\n\t\treturn errors.New(\"Cannot remove large object\")\n\t}\n\treturn nil\n}\n\n//Oid returns the Oid of the large object\nfunc (lo *LargeObject) Oid() Oid {\n\treturn lo.oid\n}\n\n//Read reads up to len(p) bytes from the current position\nfunc (lo *LargeObject) Read(p []byte) (int, error) {\n\tif lo.desc == nil {\n\t\treturn 0, errors.New(\"Large object is closed\")\n\t}\n\tif len(p) == 0 {\n\t\treturn 0, nil\n\t}\n\tif len(p) > maxLargeObjectChunk {\n\t\tp = p[:maxLargeObjectChunk]\n\t}\n\tn := int(C.inv_read(lo.desc, (*C.char)(unsafe.Pointer(&p[0])), C.int(len(p))))\n\tif n == 0 {\n\t\treturn 0, io.EOF\n\t}\n\treturn n, nil\n}\n\n//Write writes p at the current position\nfunc (lo *LargeObject) Write(p []byte) (int, error) {\n\tif lo.desc == nil {\n\t\treturn 0, errors.New(\"Large object is closed\")\n\t}\n\twritten := 0\n\tfor written < len(p) {\n\t\tchunk := p[written:]\n\t\tif len(chunk) > maxLargeObjectChunk {\n\t\t\tchunk = chunk[:maxLargeObjectChunk]\n\t\t}\n\t\tn := int(C.inv_write(lo.desc, (*C.char)(unsafe.Pointer(&chunk[0])), C.int(len(chunk))))\n\t\twritten += n\n\t\tif n < len(chunk) {\n\t\t\treturn written, io.ErrShortWrite\n\t\t}\n\t}\n\treturn written, nil\n}\n\n//Seek sets the position for the next Read or Write, whence is io.SeekStart, io.SeekCurrent or io.SeekEnd\nfunc (lo *LargeObject) Seek(offset int64, whence int) (int64, error) {\n\tif lo.desc == nil {\n\t\treturn 0, errors.New(\"Large object is closed\")\n\t}\n\tswitch whence {\n\tcase io.SeekStart, io.SeekCurrent, io.SeekEnd:\n\tdefault:\n\t\treturn 0, errors.New(\"Invalid whence\")\n\t}\n\treturn int64(C.inv_seek(lo.desc, C.int64(offset), C.int(whence))), nil\n}\n\n//Truncate truncates (or extends) the large object to size\nfunc (lo *LargeObject) Truncate(size int64) error {\n\tif lo.desc == nil {\n\t\treturn errors.New(\"Large object is closed\")\n\t}\n\tC.inv_truncate(lo.desc, C.int64(size))\n\treturn nil\n}\n\n//Close closes the large object\nfunc (lo *LargeObject) Close() error {\n\tif lo.desc == nil {\n\t\treturn errors.New(\"Large object is already closed\")\n\t}\n\tC.inv_close(lo.desc)\n\tlo.desc = nil\n\treturn nil\n}\n",
+	"listen.go":          "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"commands/async.h\"\n#include \"libpq/libpq.h\"\n#include \"libpq/pqcomm.h\"\n#include \"tcop/tcopprot.h\"\n\nextern void plgo_notification(void *msg, int len);\n\n//the listener worker has no client, the notifications are sent to the client (NotifyMyFrontEnd)\n//as the NotificationResponse protocol messages, they are dispatched to Go and the other messages are dropped\nstatic int plgo_listen_putmessage(char msgtype, const char *s, size_t len) {\n\tif (msgtype == 'A')\n\t\tplgo_notification((void *) s, (int) len);\n\treturn 0;\n}\n\nstatic void plgo_listen_putmessage_noblock(char msgtype, const char *s, size_t len) {\n\t(void) plgo_listen_putmessage(msgtype, s, len);\n}\n\nstatic void plgo_listen_comm_reset(void) {\n}\n\nstatic int plgo_listen_flush(void) {\n\treturn 0;\n}\n\nstatic bool plgo_listen_is_send_pending(void) {\n\treturn false;\n}\n\n#if PG_VERSION_NUM < 140000\nstatic void plgo_listen_startcopyout(void) {\n}\n\nstatic void plgo_listen_endcopyout(bool errorAbort) {\n}\n#endif\n\nstatic const PQcommMethods plgo_listen_comm_methods = {\n\t.comm_reset = plgo_listen_comm_reset,\n\t.flush = plgo_listen_flush,\n\t.flush_if_writable = plgo_listen_flush,\n\t.is_send_pending = plgo_listen_is_send_pending,\n\t.putmessage = plgo_listen_putmessage,\n\t.putmessage_noblock = plgo_listen_putmessage_noblock,\n#if PG_VERSION_NUM < 140000\n\t.startcopyout = plgo_listen_startcopyout,\n\t.endcopyout = plgo_listen_endcopyout,\n#endif\n};\n\n//plgo_listen_start redirects the messages to the client into plgo_listen_putmessage, as the parallel workers\n//redirect them into the shared memory queue. The protocol version 3 has the payload in the notifications\nvoid plgo_listen_start(void) {\n\tPqCommMethods = &plgo_listen_comm_methods;\n\twhereToSendOutput = DestRemote;\n\tFrontendProtocol = PG_PROTOCOL(3, 0);\n}\n\nvoid plgo_listen(char *channel) {\n\tAsync_Listen(channel);\n}\n\n//the longest payload of an notification, as in async.c\nint plgo_notify_payload_max_length(void) {\n\treturn BLCKSZ - NAMEDATALEN - 128;\n}\n\nvoid plgo_notify(char *channel, char *payload) {\n\tAsync_Notify(channel, payload);\n}\n\nvoid plgo_process_notifies(void) {\n\tif (notifyInterruptPending)\n\t\tProcessNotifyInterrupt(false);\n}\n*/\nimport \"C\"\nimport (\n\t\"bytes\"\n\t\"fmt\"\n\t\"runtime/debug\"\n\t\"strings\"\n\t\"time\"\n\t\"unsafe\"\n)\n\n//Notification is an message sent by NOTIFY or pg_notify\ntype Notification struct {\n\tChannel string\n\tPayload string\n}\n\n//NotificationHandler handles the notification in an transaction, which is committed if it returns nil\ntype NotificationHandler func(db *DB, n Notification) error\n\n//listeners are the handlers by channel\nvar listeners = make(map[string][]NotificationHandler)\n\n//listenerWorkerName is the name of the background worker listening on the channels\nconst listenerWorkerName = \"listener\"\n\n//listenDatabase is <extension>.listen_database\nvar listenDatabase *stringGUC\n\n//pendingNotifications are the received notifications waiting for the dispatch\nvar pendingNotifications []Notification\n\n//Listen registers the handler of the notifications sent to the channel (the channel name is case sensitive,\n//as in pg_notify). The notifications are received by an background worker connected to the <extension>.listen_database,\n//so the extension must be loaded with shared_preload_libraries.\n//It must be called from an init() function of the package\nfunc Listen(channel string, handler NotificationHandler) {\n\tlisteners[channel] = append(listeners[channel], handler)\n\tif listenDatabase != nil {\n\t\treturn\n\t}\n\tlistenDatabase = newStringGUC(gucDesc{\n\t\tname:      \"listen_database\",\n\t\tshortDesc: \"Sets the database where the extension listens for notifications.\",\n\t\tcontext:   gucPostmaster,\n\t}, \"postgres\")\n\tregisterWorker(&worker{\n\t\tname:     listenerWorkerName,\n\t\tdatabase: func() string { return listenDatabase.get() },\n\t\trestart:  10 * time.Second,\n\t\tmain:     listenNotifications,\n\t})\n}\n\n//Notify sends the notification to the channel as pg_notify, it is delivered when the transaction commits\n//(and dropped when it rolls back). The channel must be shorter than 64 bytes and the payload than 8000 bytes,\n//neither can contain an zero byte\nfunc Notify(channel, payload string) error {\n\tif channel == \"\" {\n\t\treturn fmt.Errorf(\"Notify: the channel name can't be empty\")\n\t}\n\tif len(channel) >= C.NAMEDATALEN {\n\t\treturn fmt.Errorf(\"Notify: the channel name %s is too long\", channel)\n\t}\n\tif max := int(C.plgo_notify_payload_max_length()); len(payload) >= max {\n\t\treturn fmt.Errorf(\"Notify: the payload of %d bytes is too long, the limit is %d bytes\", len(payload), max-1)\n\t}\n\tif strings.IndexByte(channel, 0) >= 0 || strings.IndexByte(payload, 0) >= 0 {\n\t\treturn fmt.Errorf(\"Notify: the channel name and the payload can't contain an zero byte\")\n\t}\n\tcchannel := C.CString(channel)\n\tdefer C.free(unsafe.Pointer(cchannel))\n\tcpayload := C.CString(payload)\n\tdefer C.free(unsafe.Pointer(cpayload))\n\t//Async_Notify copies the notification into the transaction memory, the C strings can be freed\n\tC.plgo_notify(cchannel, cpayload)\n\treturn nil\n}\n\n//receiveNotification is called with the NotificationResponse message received by the listener worker\nfunc receiveNotification(msg []byte) {\n\tif n, ok := parseNotification(msg); ok {\n\t\tpendingNotifications = append(pendingNotifications, n)\n\t}\n}\n\n//parseNotification parses the NotificationResponse message: the int32 pid of the notifying backend,\n//the channel and the payload as zero terminated strings (they can't contain an zero byte)\nfunc parseNotification(msg []byte) (Notification, bool) {\n\tif len(msg) < 4 {\n\t\treturn Notification{}, false\n\t}\n\tfields := bytes.SplitN(msg[4:], []byte{0}, 3)\n\tif len(fields) != 3 || len(fields[2]) != 0 {\n\t\treturn Notification{}, false\n\t}\n\treturn Notification{Channel: string(fields[0]), Payload: string(fields[1])}, true\n}\n\n//listenNotifications is the main function of the listener worker\nfunc listenNotifications(ctx *workerContext) error {\n\tC.plgo_listen_start()\n\terr := ctx.Transaction(func(db *DB) error {\n\t\tfor channel := range listeners {\n\t\t\tcchannel := C.CString(channel)\n\t\t\tC.plgo_listen(cchannel)\n\t\t\tC.free(unsafe.Pointer(cchannel))\n\t\t}\n\t\treturn nil\n\t})\n\tif err != nil {\n\t\treturn err\n\t}\n\t//the worker is woken up by the latch when an notification arrives\n\tfor ctx.Wait(time.Minute) {\n\t\tC.plgo_process_notifies()\n\t\tnotifications := pendingNotifications\n\t\tpendingNotifications = nil\n\t\tfor _, n := range notifications {\n\t\t\tfor _, handler := range listeners[n.Channel] {\n\t\t\t\terr := ctx.Transaction(func(db *DB) error {\n\t\t\t\t\treturn runNotificationHandler(handler, db, n)\n\t\t\t\t})\n\t\t\t\tif err != nil {\n\t\t\t\t\tLog.Warning(\"notification handler failed\", \"channel\", n.Channel, \"error\", err)\n\t\t\t\t}\n\t\t\t}\n\t\t}\n\t}\n\treturn nil\n}\n\n//runNotificationHandler calls the handler, its panic is returned as an error\nfunc runNotificationHandler(handler NotificationHandler, db *DB, n Notification) (err error) {\n\tdefer func() {\n\t\tif r := recover(); r != nil {\n\t\t\tLog.Warning(\"panic in notification handler\", \"channel\", n.Channel, \"panic\", fmt.Sprint(r), \"stack\", string(debug.Stack()))\n\t\t\terr = fmt.Errorf(\"panic: %v\", r)\n\t\t}\n\t}()\n\treturn handler(db, n)\n}\n",
+	"logger.go":          "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"utils/elog.h\"\n#include <stdlib.h>\n\n//plgo_pstrdup copies the string allocated by C.CString into the current memory context and frees it\nstatic char *plgo_pstrdup(char *s) {\n\tchar *copy;\n\tif (s == NULL)\n\t\treturn NULL;\n\tcopy = pstrdup(s);\n\tfree(s);\n\treturn copy;\n}\n\n//plgo_ereport reports the message with the level, the SQLSTATE, the detail and the hint are added if not NULL.\n//It takes the strings allocated by C.CString: they are copied into the current memory context before ereport,\n//because ereport(ERROR) doesn't return, the copies are freed with the context\nvoid plgo_ereport(int level, char *sqlstate, char *message, char *detail, char *hint) {\n\tsqlstate = plgo_pstrdup(sqlstate);\n\tmessage = plgo_pstrdup(message);\n\tdetail = plgo_pstrdup(detail);\n\thint = plgo_pstrdup(hint);\n\tereport(level, (sqlstate != NULL ? errcode(MAKE_SQLSTATE(sqlstate[0], sqlstate[1], sqlstate[2], sqlstate[3], sqlstate[4])) : 0,\n\t\t\t\t\terrmsg(\"%s\", message),\n\t\t\t\t\tdetail != NULL ? errdetail(\"%s\", detail) : 0,\n\t\t\t\t\thint != NULL ? errhint(\"%s\", hint) : 0));\n\tpfree(message);\n\tif (sqlstate != NULL)\n\t\tpfree(sqlstate);\n\tif (detail != NULL)\n\t\tpfree(detail);\n\tif (hint != NULL)\n\t\tpfree(hint);\n}\n*/\nimport \"C\"\nimport (\n\t\"bytes\"\n\t\"encoding/json\"\n\t\"fmt\"\n\t\"strconv\"\n\t\"strings\"\n)\n\n//LogLevel is the elog level of an log message\ntype LogLevel int\n\n//LogLevel constants\nconst (\n\tLevelDebug   LogLevel = C.DEBUG1\n\tLevelLog     LogLevel = C.LOG\n\tLevelInfo    LogLevel = C.INFO\n\tLevelNotice  LogLevel = C.NOTICE\n\tLevelWarning LogLevel = C.WARNING\n\tLevelError   LogLevel = C.ERROR\n)\n\n//logLevels are the options of <extension>.log_level\nvar logLevels = []LogLevel{LevelDebug, LevelLog, LevelInfo, LevelNotice, LevelWarning, LevelError}\n\n//minLogLevel is <extension>.log_level, the messages below this level are not written\nvar minLogLevel = newEnumGUC(gucDesc{\n\tname:      \"log_level\",\n\tshortDesc: \"Sets the message levels of the extension that are logged.\",\n\tlongDesc:  \"Each level includes all the levels that follow it. Errors are always reported.\",\n\tcontext:   gucUserset,\n}, 1, []string{\"debug\", \"log\", \"info\", \"notice\", \"warning\", \"error\"})\n\n//Enabled reports whether the messages of the level are written, see <extension>.log_level\nfunc (level LogLevel) Enabled() bool {\n\treturn level >= LevelError || level >= logLevels[minLogLevel.get()]\n}\n\n//LogFormat is the format of the structured log lines\ntype LogFormat int\n\n//LogFormat constants\nconst (\n\t//FormatKeyValue formats the log line as msg=\"...\" key=value ...\n\tFormatKeyValue LogFormat = iota\n\t//FormatJSON formats the log line as an JSON object\n\tFormatJSON\n)\n\n//Logger writes structured log lines with key/value fields into the PostgreSQL log.\n//Every line contains also the name of the running exported function and the id of its call\ntype Logger struct {\n\tformat LogFormat\n\tfields []interface{}\n\t//code is the SQLSTATE, detail and hint are the DETAIL and HINT of the messages\n\tcode, detail, hint string\n}\n\n//Log is the default structured logger\nvar Log = &Logger{}\n\n//With returns a new Logger that adds the key/value pairs to every log line\nfunc (l *Logger) With(keyvals ...interface{}) *Logger {\n\tfields := make([]interface{}, 0, len(l.fields)+len(keyvals))\n\tfields = append(fields, l.fields...)\n\tfields = append(fields, keyvals...)\n\tlogger := *l\n\tlogger.fields = fields\n\treturn &logger\n}\n\n//WithFormat returns a new Logger that writes the log lines in the format\nfunc (l *Logger) WithFormat(format LogFormat) *Logger {\n\tlogger := *l\n\tlogger.format = format\n\treturn &logger\n}\n\n//WithCode returns a new Logger that reports the messages with the SQLSTATE code, e.g. 01000 (warning)\n//or 23505 (unique_violation) for Error, so the clients can handle them programmatically.\n//The invalid codes are ignored\nfunc (l *Logger) WithCode(code string) *Logger {\n\tlogger := *l\n\tlogger.code = code\n\treturn &logger\n}\n\n//WithDetail returns a new Logger that reports the messages with the DETAIL\nfunc (l *Logger) WithDetail(detail string) *Logger {\n\tlogger := *l\n\tlogger.detail = detail\n\treturn &logger\n}\n\n//WithHint returns a new Logger that reports the messages with the HINT\nfunc (l *Logger) WithHint(hint string) *Logger {\n\tlogger := *l\n\tlogger.hint = hint\n\treturn &logger\n}\n\n//Debug writes the message with DEBUG1 level\nfunc (l *Logger) Debug(msg string, keyvals ...interface{}) {\n\tl.write(LevelDebug, msg, keyvals)\n}\n\n//Log writes the message with LOG level (only into the server log)\nfunc (l *Logger) Log(msg string, keyvals ...interface{}) {\n\tl.write(LevelLog, msg, keyvals)\n}\n\n//Info writes the message with INFO level\nfunc (l *Logger) Info(msg string, keyvals ...interface{}) {\n\tl.write(LevelInfo, msg, keyvals)\n}\n\n//Notice writes the message with NOTICE level\nfunc (l *Logger) Notice(msg string, keyvals ...interface{}) {\n\tl.write(LevelNotice, msg, keyvals)\n}\n\n//Warning writes the message with WARNING level\nfunc (l *Logger) Warning(msg string, keyvals ...interface{}) {\n\tl.write(LevelWarning, msg, keyvals)\n}\n\n//Error writes the message with ERROR level, this aborts the current transaction\nfunc (l *Logger) Error(msg string, keyvals ...interface{}) {\n\tl.write(LevelError, msg, keyvals)\n}\n\n//Debugf writes the formatted message with DEBUG1 level\nfunc (l *Logger) Debugf(format string, args ...interface{}) {\n\tl.write(LevelDebug, fmt.Sprintf(format, args...), nil)\n}\n\n//Logf writes the formatted message with LOG level (only into the server log)\nfunc (l *Logger) Logf(format string, args ...interface{}) {\n\tl.write(LevelLog, fmt.Sprintf(format, args...), nil)\n}\n\n//Infof writes the formatted message with INFO level\nfunc (l *Logger) Infof(format string, args ...interface{}) {\n\tl.write(LevelInfo, fmt.Sprintf(format, args...), nil)\n}\n\n//Noticef writes the formatted message with NOTICE level\nfunc (l *Logger) Noticef(format string, args ...interface{}) {\n\tl.write(LevelNotice, fmt.Sprintf(format, args...), nil)\n}\n\n//Warningf writes the formatted message with WARNING level\nfunc (l *Logger) Warningf(format string, args ...interface{}) {\n\tl.write(LevelWarning, fmt.Sprintf(format, args...), nil)\n}\n\n//Errorf writes the formatted message with ERROR level, this aborts the current transaction\nfunc (l *Logger) Errorf(format string, args ...interface{}) {\n\tl.write(LevelError, fmt.Sprintf(format, args...), nil)\n}\n\nfunc (l *Logger) write(level LogLevel, msg string, keyvals []interface{}) {\n\tif !level.Enabled() {\n\t\treturn\n\t}\n\tcode := l.code\n\tif !validSQLState(code) {\n\t\tcode = \"\"\n\t}\n\twriteReport(level, code, l.Format(msg, keyvals...), RedactSecrets(l.detail), RedactSecrets(l.hint))\n}\n\n//writeLine writes the formatted line with the level, regardless of <extension>.log_level\nfunc writeLine(level LogLevel, line string) {\n\twriteReport(level, \"\", line, \"\", \"\")\n}\n\n//writeReport reports the line with the level, the SQLSTATE code, the detail and the hint (\"\" are not reported)\nfunc writeReport(level LogLevel, code, line, detail, hint string) {\n\tcstrings := []*C.char{C.CString(line), nil, nil, nil}\n\tfor i, s := range []string{code, detail, hint} {\n\t\tif s != \"\" {\n\t\t\tcstrings[i+1] = C.CString(s)\n\t\t}\n\t}\n\t//plgo_ereport frees the strings, also when ereport(ERROR) doesn't return\n\tC.plgo_ereport(C.int(level), cstrings[1], cstrings[0], cstrings[2], cstrings[3])\n}\n\n//Format returns the log line that would be written for the message and key/value pairs\nfunc (l *Logger) Format(msg string, keyvals ...interface{}) string {\n\tfields := []interface{}{\"msg\", msg}\n\tif call := currentCall(); call != nil {\n\t\tfields = append(fields, \"function\", call.name, \"call_id\", call.id)\n\t}\n\tfields = append(fields, l.fields...)\n\tfields = append(fields, keyvals...)\n\tif len(fields)%2 != 0 {\n\t\tfields = append(fields, \"(MISSING)\")\n\t}\n\tif l.format == FormatJSON {\n\t\treturn RedactSecrets(formatJSON(fields))\n\t}\n\treturn RedactSecrets(formatKeyValue(fields))\n}\n\nfunc formatKeyValue(fields []interface{}) string {\n\tvar b strings.Builder\n\tfor i := 0; i < len(fields); i += 2 {\n\t\tif i > 0 {\n\t\t\tb.WriteByte(' ')\n\t\t}\n\t\tb.WriteString(fmt.Sprint(fields[i]))\n\t\tb.WriteByte('=')\n\t\tb.WriteString(formatValue(fields[i+1]))\n\t}\n\treturn b.String()\n}\n\nfunc formatValue(val interface{}) string {\n\tvar s string\n\tswitch v := val.(type) {\n\tcase error:\n\t\ts = v.Error()\n\tcase fmt.Stringer:\n\t\ts = v.String()\n\tdefault:\n\t\ts = fmt.Sprint(v)\n\t}\n\tif s == \"\" || strings.ContainsAny(s, \" \\t\\n\\r\\\"=\") {\n\t\treturn strconv.Quote(s)\n\t}\n\treturn s\n}\n\nfunc formatJSON(fields []interface{}) string {\n\tvar b bytes.Buffer\n\tb.WriteByte('{')\n\tfor i := 0; i < len(fields); i += 2 {\n\t\tif i > 0 {\n\t\t\tb.WriteByte(',')\n\t\t}\n\t\tkey, _ := json.Marshal(fmt.Sprint(fields[i]))\n\t\tb.Write(key)\n\t\tb.WriteByte(':')\n\t\tval := fields[i+1]\n\t\tif err, ok := val.(error); ok {\n\t\t\tval = err.Error()\n\t\t}\n\t\tdata, err := json.Marshal(val)\n\t\tif err != nil {\n\t\t\tdata, _ = json.Marshal(fmt.Sprint(val))\n\t\t}\n\t\tb.Write(data)\n\t}\n\tb.WriteByte('}')\n\treturn b.String()\n}\n",
+	"logical.go":         "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"access/xlogdefs.h\"\n#include \"replication/message.h\"\n\nXLogRecPtr log_logical_message(char *prefix, char *message, size_t size, bool transactional) {\n#if PG_VERSION_NUM >= 170000\n\treturn LogLogicalMessage(prefix, message, size, transactional, false);\n#else\n\treturn LogLogicalMessage(prefix, message, size, transactional);\n#endif\n}\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"unsafe\"\n)\n\n//LSN is a WAL location (XLogRecPtr)\ntype LSN uint64\n\n//String returns the LSN in the PostgreSQL format (e.g. 16/B374D848)\nfunc (lsn LSN) String() string {\n\treturn fmt.Sprintf(\"%X/%X\", uint32(lsn>>32), uint32(lsn))\n}\n\n//EmitLogicalMessage writes a message into the WAL stream, where logical decoding\n//output plugins can read it, it's the same as pg_logical_emit_message().\n//Transactional messages are decoded only if the transaction commits,\n//non-transactional messages are decoded immediately even if the transaction aborts.\n//Returns the LSN of the written message\nfunc EmitLogicalMessage(prefix string, message []byte, transactional bool) (LSN, error) {\n\tif prefix == \"\" {\n\t\treturn 0, fmt.Errorf(\"Logical message prefix can't be empty\")\n\t}\n\tcprefix := C.CString(prefix)\n\tdefer C.free(unsafe.Pointer(cprefix))\n\tvar cmessage *C.char\n\tif len(message) > 0 {\n\t\tcmessage = (*C.char)(C.CBytes(message))\n\t\tdefer C.free(unsafe.Pointer(cmessage))\n\t}\n\tlsn := C.log_logical_message(cprefix, cmessage, C.size_t(len(message)), (C._Bool)(transactional))\n\treturn LSN(lsn), nil\n}\n\n//EmitLogicalMessageString is like EmitLogicalMessage with a text message\nfunc EmitLogicalMessageString(prefix, message string, transactional bool) (LSN, error) {\n\treturn EmitLogicalMessage(prefix, []byte(message), transactional)\n}\n",
+	"network.go":         "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"catalog/pg_type.h\"\n#include \"utils/inet.h\"\n\nDatum plgo_inet_to_datum(unsigned char family, unsigned char bits, const unsigned char *addr) {\n\tinet *ip = palloc0(sizeof(inet));\n\n\tip_family(ip) = family == 4 ? PGSQL_AF_INET : PGSQL_AF_INET6;\n\tip_bits(ip) = bits;\n\tmemcpy(ip_addr(ip), addr, ip_addrsize(ip));\n\tSET_INET_VARSIZE(ip);\n\treturn InetPGetDatum(ip);\n}\n\n//plgo_datum_to_inet copies the address of the inet or cidr datum, it returns the size of the address (4 or 16)\nint plgo_datum_to_inet(Datum val, unsigned char *bits, unsigned char *addr) {\n\tinet *ip = DatumGetInetPP(val);\n\tint size = ip_addrsize(ip);\n\n\t*bits = ip_bits(ip);\n\tmemcpy(addr, ip_addr(ip), size);\n\treturn size;\n}\n\nDatum plgo_macaddr_to_datum(const unsigned char *addr) {\n\tmacaddr *mac = palloc(sizeof(macaddr));\n\n\tmemcpy(mac, addr, sizeof(macaddr));\n\treturn MacaddrPGetDatum(mac);\n}\n\nvoid plgo_datum_to_macaddr(Datum val, unsigned char *addr) {\n\tmemcpy(addr, DatumGetMacaddrP(val), sizeof(macaddr));\n}\n\nvoid plgo_datum_to_macaddr8(Datum val, unsigned char *addr) {\n\tmemcpy(addr, DatumGetMacaddr8P(val), sizeof(macaddr8));\n}\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"net\"\n\t\"net/netip\"\n\t\"unsafe\"\n)\n\n//inetDatum returns the inet (or cidr) datum of the address with the netmask bits, the IPv6 zone is dropped\nfunc inetDatum(addr netip.Addr, bits int) Datum {\n\tif !addr.IsValid() {\n\t\traise(\"22023\", \"invalid IP address, the zero netip.Addr can't be converted to inet\", \"\")\n\t}\n\tfamily := 6\n\tif addr.Is4() {\n\t\tfamily = 4\n\t}\n\tip := addr.WithZone(\"\").AsSlice()\n\treturn (Datum)(C.plgo_inet_to_datum(C.uchar(family), C.uchar(bits), (*C.uchar)(unsafe.Pointer(&ip[0]))))\n}\n\n//addrDatum returns the inet of the host address\nfunc addrDatum(addr netip.Addr) Datum {\n\treturn inetDatum(addr, addr.BitLen())\n}\n\n//prefixDatum returns the cidr of the network, the host bits are cleared\nfunc prefixDatum(prefix netip.Prefix) Datum {\n\tif !prefix.IsValid() {\n\t\traise(\"22023\", \"invalid IP prefix, the zero netip.Prefix can't be converted to cidr\", \"\")\n\t}\n\tprefix = prefix.Masked()\n\treturn inetDatum(prefix.Addr(), prefix.Bits())\n}\n\n//scanInet returns the address and the netmask bits of the inet or cidr datum\nfunc scanInet(oid C.Oid, typeName string, val C.Datum) (netip.Addr, int, error) {\n\tif oid != C.INETOID && oid != C.CIDROID {\n\t\treturn netip.Addr{}, 0, fmt.Errorf(\"Column type is not inet or cidr %s\", typeName)\n\t}\n\tvar bits C.uchar\n\tvar ip [16]byte\n\tsize := C.plgo_datum_to_inet(val, &bits, (*C.uchar)(unsafe.Pointer(&ip[0])))\n\taddr, _ := netip.AddrFromSlice(ip[:size])\n\treturn addr, int(bits), nil\n}\n\n//scanAddr sets the address of the inet or cidr datum, the netmask is dropped\nfunc scanAddr(oid C.Oid, typeName string, val C.Datum, dest *netip.Addr) error {\n\taddr, _, err := scanInet(oid, typeName, val)\n\tif err != nil {\n\t\treturn err\n\t}\n\t*dest = addr\n\treturn nil\n}\n\n//scanPrefix sets the prefix of the cidr or inet datum, the inet keeps its host bits\nfunc scanPrefix(oid C.Oid, typeName string, val C.Datum, dest *netip.Prefix) error {\n\taddr, bits, err := scanInet(oid, typeName, val)\n\tif err != nil {\n\t\treturn err\n\t}\n\t*dest = netip.PrefixFrom(addr, bits)\n\treturn nil\n}\n\n//macaddrDatum returns the macaddr datum, the address must have 6 bytes\nfunc macaddrDatum(mac net.HardwareAddr) Datum {\n\tif len(mac) != 6 {\n\t\traise(\"22023\", fmt.Sprintf(\"invalid MAC address %s, macaddr has 6 bytes\", mac), \"\")\n\t}\n\treturn (Datum)(C.plgo_macaddr_to_datum((*C.uchar)(unsafe.Pointer(&mac[0]))))\n}\n\n//scanMacaddr sets the address of the macaddr or macaddr8 datum\nfunc scanMacaddr(oid C.Oid, typeName string, val C.Datum, dest *net.HardwareAddr) error {\n\tswitch oid {\n\tcase C.MACADDROID:\n\t\tmac := make(net.HardwareAddr, 6)\n\t\tC.plgo_datum_to_macaddr(val, (*C.uchar)(unsafe.Pointer(&mac[0])))\n\t\t*dest = mac\n\tcase C.MACADDR8OID:\n\t\tmac := make(net.HardwareAddr, 8)\n\t\tC.plgo_datum_to_macaddr8(val, (*C.uchar)(unsafe.Pointer(&mac[0])))\n\t\t*dest = mac\n\tdefault:\n\t\treturn fmt.Errorf(\"Column type is not macaddr %s\", typeName)\n\t}\n\treturn nil\n}\n",
+	"noseccomp.go":       "//go:build !(plgo_restricted && plgo_seccomp && linux)\n\npackage plgo\n\n//enterRestricted is called before every call of an exported function,\n//it installs the seccomp filter when the extension is built with plgo -seccomp\nfunc enterRestricted() {}\n",
+	"numeric.go":         "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"catalog/pg_type.h\"\n\nextern Datum plgo_text_input(Oid type, char *text);\nextern char *plgo_text_output(Oid type, Datum value);\n*/\nimport \"C\"\nimport (\n\t\"bytes\"\n\t\"encoding/json\"\n\t\"fmt\"\n\t\"math/big\"\n\t\"strconv\"\n\t\"unsafe\"\n)\n\n//Numeric is the PostgreSQL numeric in its text form, e.g. \"12.50\" or \"NaN\",\n//it is converted without the precision loss of float64\ntype Numeric string\n\n//NewNumeric returns the number rounded to the scale (the digits after the decimal point)\nfunc NewNumeric(r *big.Rat, scale int) Numeric {\n\treturn Numeric(r.FloatString(scale))\n}\n\n//Rat returns the number as an big.Rat, an error for NaN and the infinities\nfunc (n Numeric) Rat() (*big.Rat, error) {\n\tr, ok := new(big.Rat).SetString(string(n))\n\tif !ok {\n\t\treturn nil, fmt.Errorf(\"Numeric %q is not a finite number\", string(n))\n\t}\n\treturn r, nil\n}\n\n//Float64 returns the nearest float64\nfunc (n Numeric) Float64() (float64, error) {\n\treturn strconv.ParseFloat(string(n), 64)\n}\n\n//String returns the text form\nfunc (n Numeric) String() string {\n\treturn string(n)\n}\n\n//MarshalJSON writes the finite numbers as JSON numbers, so the numeric fields of the jsonb structs keep their digits\nfunc (n Numeric) MarshalJSON() ([]byte, error) {\n\tif _, err := n.Rat(); err != nil {\n\t\treturn json.Marshal(string(n))\n\t}\n\treturn []byte(n), nil\n}\n\n//UnmarshalJSON reads an JSON number or string\nfunc (n *Numeric) UnmarshalJSON(data []byte) error {\n\tif bytes.HasPrefix(data, []byte(`\"`)) {\n\t\tvar s string\n\t\tif err := json.Unmarshal(data, &s); err != nil {\n\t\t\treturn err\n\t\t}\n\t\t*n = Numeric(s)\n\t\treturn nil\n\t}\n\tvar number json.Number\n\tif err := json.Unmarshal(data, &number); err != nil {\n\t\treturn err\n\t}\n\t*n = Numeric(number)\n\treturn nil\n}\n\n//numericDatum returns the numeric datum, the invalid text raises an ERROR\nfunc numericDatum(n Numeric) Datum {\n\ttext := C.CString(string(n))\n\tdefer C.free(unsafe.Pointer(text))\n\treturn (Datum)(C.plgo_text_input(C.NUMERICOID, text))\n}\n\n//scanNumeric sets the number from the numeric datum, an error if the type oid isn't numeric\nfunc scanNumeric(oid C.Oid, typeName string, val C.Datum, dest *Numeric) error {\n\tif oid != C.NUMERICOID {\n\t\treturn fmt.Errorf(\"Column type is not numeric %s\", typeName)\n\t}\n\ttext := C.plgo_text_output(oid, val)\n\tdefer C.pfree(unsafe.Pointer(text))\n\t*dest = Numeric(C.GoString(text))\n\treturn nil\n}\n",
+	"panic.go":           "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"miscadmin.h\"\n#include \"access/xact.h\"\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"runtime\"\n\t\"runtime/debug\"\n)\n\n//goroutineStacks returns the stack traces of all goroutines\nfunc goroutineStacks() string {\n\tbuf := make([]byte, 64*1024)\n\tfor {\n\t\tn := runtime.Stack(buf, true)\n\t\tif n < len(buf) {\n\t\t\treturn string(buf[:n])\n\t\t}\n\t\tbuf = make([]byte, 2*len(buf))\n\t}\n}\n\n//handlePanic logs the recovered panic with the function name, backend and transaction context\n//and all goroutine stacks at WARNING, and then raises an ERROR with the panic value\n//and the stack of the panicking goroutine in its DETAIL. It must be called by the deferred function recovering the panic\nfunc handlePanic(call *funcCall, recovered interface{}) {\n\tstack := string(debug.Stack())\n\tLog.Warning(\"panic in exported function\",\n\t\t\"panic\", fmt.Sprint(recovered),\n\t\t\"pid\", int(C.MyProcPid),\n\t\t\"txid\", uint32(C.GetTopTransactionIdIfAny()),\n\t\t\"goroutines\", goroutineStacks(),\n\t)\n\traise(\"\", fmt.Sprintf(\"panic in function %s: %v\", call.name, recovered), \"Go stack:\\n\"+stack)\n}\n\n//export plgo_goroutines\nfunc plgo_goroutines(fcinfo *funcInfo) Datum {\n\treturn toDatum(goroutineStacks())\n}\n",
+	"pl.go":              "package plgo\n\n/*\n#cgo CFLAGS: -I\"/usr/include/postgresql/16/server\" -fpic\n#cgo LDFLAGS: -shared\n\ntypedef unsigned int uint;\n\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"pgtime.h\"\n#include \"access/htup_details.h\"\n#include \"catalog/pg_type.h\"\n#include \"utils/builtins.h\"\n#include \"utils/date.h\"\n#include \"utils/timestamp.h\"\n#include \"utils/array.h\"\n#include \"utils/elog.h\"\n#include \"executor/spi.h\"\n#include \"parser/parse_type.h\"\n#include \"commands/trigger.h\"\n#include \"utils/rel.h\"\n#include \"utils/lsyscache.h\"\n#include \"utils/jsonb.h\"\n#include \"access/xact.h\"\n\n#ifdef PG_MODULE_MAGIC\nPG_MODULE_MAGIC;\n#endif\n\nextern void plgo_init(void);\nextern void plgo_xact_abort(void);\nextern void plgo_subxact_abort(SubTransactionId subid);\n\nPGDLLEXPORT void _PG_init(void);\n\nstatic void plgo_xact_callback(XactEvent event, void *arg) {\n\tif (event == XACT_EVENT_ABORT || event == XACT_EVENT_PARALLEL_ABORT)\n\t\tplgo_xact_abort();\n}\n\nstatic void plgo_subxact_callback(SubXactEvent event, SubTransactionId mySubid,\n\t\t\t\t\t\t\t\t  SubTransactionId parentSubid, void *arg) {\n\tif (event == SUBXACT_EVENT_ABORT_SUB)\n\t\tplgo_subxact_abort(mySubid);\n}\n\nvoid _PG_init(void) {\n\tRegisterXactCallback(plgo_xact_callback, NULL);\n\tRegisterSubXactCallback(plgo_subxact_callback, NULL);\n\tplgo_init();\n}\n\nint __varsize(void *var) {\n    return VARSIZE(var);\n}\n\nint __varsize_any(void *var) {\n    return VARSIZE_ANY_EXHDR(var);\n}\n\nvoid elog_notice(char* string) {\n    elog(NOTICE, \"%s\", string);\n}\n\nvoid elog_error(char* string) {\n    elog(ERROR, \"%s\", string);\n}\n\nDatum get_arg(PG_FUNCTION_ARGS, uint i) {\n\treturn PG_GETARG_DATUM(i);\n}\n\nbool arg_is_null(PG_FUNCTION_ARGS, uint i) {\n\treturn PG_ARGISNULL(i);\n}\n\nHeapTuple get_heap_tuple(HeapTuple* ht, uint i) {\n    return ht[i];\n}\n\nDatum get_col_as_datum(HeapTuple ht, TupleDesc td, int colnumber) {\n    bool isNull;\n    Datum ret = SPI_getbinval(ht, td, colnumber + 1, &isNull);\n\tif (isNull) PG_RETURN_VOID();\n\treturn ret;\n}\n\nbool called_as_trigger(PG_FUNCTION_ARGS) {\n\treturn CALLED_AS_TRIGGER(fcinfo);\n}\n\nDatum get_heap_getattr(HeapTuple ht, uint i, TupleDesc td, bool *isNull) {\n\treturn heap_getattr(ht, i, td, isNull);\n}\n\n//val to datum//////////////////////////////////////////////////\nDatum void_datum(){\n    PG_RETURN_VOID();\n}\n\nDatum bytes_to_datum(void *val, uint len) {\n\tvoid *v = (void *)palloc(len + VARHDRSZ);\n\tSET_VARSIZE(v, len + VARHDRSZ);\n\tif (len > 0)\n\t\tmemcpy(VARDATA(v), val, len);\n\treturn PointerGetDatum(v);\n}\n\nDatum cstring_to_datum(char *val) {\n    return CStringGetTextDatum(val);\n}\n\nDatum int16_to_datum(int16 val) {\n    return Int16GetDatum(val);\n}\n\nDatum uint16_to_datum(uint16 val) {\n    return UInt16GetDatum(val);\n}\n\nDatum int32_to_datum(int32 val) {\n    return Int32GetDatum(val);\n}\n\nDatum uint32_to_datum(uint32 val) {\n    return UInt32GetDatum(val);\n}\n\nDatum int64_to_datum(int64 val) {\n    return Int64GetDatum(val);\n}\n\nDatum date_to_datum(DateADT val){\n\treturn DateADTGetDatum(val);\n}\n\nDatum time_to_datum(TimeADT val){\n\treturn TimestampGetDatum(val);\n}\n\nDatum timetz_to_datum(TimestampTz val) {\n\treturn TimestampTzGetDatum(val);\n}\n\nDatum bool_to_datum(bool val) {\n\treturn BoolGetDatum(val);\n}\n\nDatum float4_to_datum(float val) {\n\treturn Float4GetDatum(val);\n}\n\nDatum float8_to_datum(double val) {\n\treturn Float8GetDatum(val);\n}\n\nDatum heap_tuple_to_datum(HeapTuple val) {\n\treturn PointerGetDatum(val);\n}\n\nDatum array_to_datum(Oid element_type, Datum* vals, bool* isnull, int size) {\n\tArrayType *result;\n    int dims[1];\n    int lbs[1];\n    int16 typlen;\n    bool typbyval;\n    char typalign;\n\n\tdims[0] = size;\n\tlbs[0] = 1;\n\n    // get required info about the element type\n    get_typlenbyvalalign(element_type, &typlen, &typbyval, &typalign);\n\tresult = construct_md_array(vals, isnull, 1, dims, lbs,\n                                element_type, typlen, typbyval, typalign);\n\n    PG_RETURN_ARRAYTYPE_P(result);\n}\n\nDatum jsonb_to_datum(char* val) {\n\treturn (Datum) DatumGetJsonbP(DirectFunctionCall1(jsonb_in, (Datum) (char *) val));\n}\n\n//Datum to val //////////////////////////////////////////////////////////\nchar* datum_to_cstring(Datum val) {\n    return TextDatumGetCString(val);\n}\n\nbytea* datum_to_byteap(Datum val) {\n    return DatumGetByteaPP(val);\n}\n\nunsigned char * bytea_to_chars(bytea* val) {\n    return  ((unsigned char *)VARDATA_ANY(val));\n}\n\n//bytea_free frees the detoasted copy of the bytea datum, the large values aren't kept until the end of the call\nvoid bytea_free(Datum val, bytea *detoasted) {\n\tif ((Pointer) detoasted != DatumGetPointer(val))\n\t\tpfree(detoasted);\n}\n\n\nint16 datum_to_int16(Datum val) {\n    return DatumGetInt16(val);\n}\n\nuint16 datum_to_uint16(Datum val) {\n    return DatumGetUInt16(val);\n}\n\nint32 datum_to_int32(Datum val) {\n    return DatumGetInt32(val);\n}\n\nuint32 datum_to_uint32(Datum val) {\n    return DatumGetUInt32(val);\n}\n\nint64 datum_to_int64(Datum val) {\n    return DatumGetInt64(val);\n}\n\nDateADT datum_to_date(Datum val) {\n\treturn DatumGetDateADT(val);\n}\n\nTimestamp datum_to_time(Datum val) {\n\treturn DatumGetTimestamp(val);\n}\n\nTimestampTz datum_to_timetz(Datum val) {\n\treturn DatumGetTimestampTz(val);\n}\n\nbool datum_to_bool(Datum val) {\n\treturn DatumGetBool(val);\n}\n\nfloat datum_to_float4(Datum val) {\n\treturn DatumGetFloat4(val);\n}\n\ndouble datum_to_float8(Datum val) {\n\treturn DatumGetFloat8(val);\n}\n\nHeapTuple datum_to_heap_tuple(Datum val) {\n\treturn (HeapTuple) DatumGetPointer(val);\n}\n\nDatum* datum_to_array(Datum val, int* nelemsp, bool** nullsp, Oid* elemtypep) {\n\tArrayType* array = DatumGetArrayTypeP(val);\n\n    int16 typlen;\n    bool typbyval;\n    char typalign;\n\tDatum *result;\n\n\t*elemtypep = ARR_ELEMTYPE(array);\n    get_typlenbyvalalign(ARR_ELEMTYPE(array), &typlen, &typbyval, &typalign);\n\n\tdeconstruct_array(array, ARR_ELEMTYPE(array),\n                      typlen, typbyval, typalign,\n                      &result, nullsp, nelemsp);\n\treturn result;\n}\n\nchar* unknown_to_char(Datum val) {\n\treturn (char*)val;\n}\n\nchar* datum_to_jsonb_cstring(Datum val) {\n\tJsonb *jsonb = DatumGetJsonbP(val);\n\treturn JsonbToCString(NULL, &jsonb->root, VARSIZE(jsonb));\n}\n\n//TriggerData functions/////////////////////////////////////////////\nbool trigger_fired_before(TriggerEvent tg_event) {\n\treturn TRIGGER_FIRED_BEFORE(tg_event);\n}\n\nbool trigger_fired_after(TriggerEvent tg_event) {\n\treturn TRIGGER_FIRED_AFTER(tg_event);\n}\n\nbool trigger_fired_instead(TriggerEvent tg_event) {\n\treturn TRIGGER_FIRED_INSTEAD(tg_event);\n}\n\nbool trigger_fired_for_row(TriggerEvent tg_event) {\n\treturn TRIGGER_FIRED_FOR_ROW(tg_event);\n}\n\nbool trigger_fired_for_statement(TriggerEvent tg_event) {\n\treturn TRIGGER_FIRED_FOR_STATEMENT(tg_event);\n}\n\nbool trigger_fired_by_insert(TriggerEvent tg_event) {\n\treturn TRIGGER_FIRED_BY_INSERT(tg_event);\n}\n\nbool trigger_fired_by_update(TriggerEvent tg_event) {\n\treturn TRIGGER_FIRED_BY_UPDATE(tg_event);\n}\n\nbool trigger_fired_by_delete(TriggerEvent tg_event) {\n\treturn TRIGGER_FIRED_BY_DELETE(tg_event);\n}\n\nbool trigger_fired_by_truncate(TriggerEvent tg_event) {\n\treturn TRIGGER_FIRED_BY_TRUNCATE(tg_event);\n}\n\n//{funcdec}\n*/\nimport \"C\"\nimport (\n\t\"encoding/json\"\n\t\"errors\"\n\t\"fmt\"\n\t\"log\"\n\t\"net\"\n\t\"net/netip\"\n\t\"reflect\"\n\t\"time\"\n\t\"unsafe\"\n)\n\n//this has to be here\nfunc main() {}\n\n//Datum is the return type of postgresql\ntype Datum C.Datum\n\n//DB represents the db connection, can be made only once\ntype DB struct {\n\t//nonatomic is true in the procedures called by CALL, they can Commit and Rollback\n\tnonatomic bool\n\t//subTx is the innermost running subtransaction\n\tsubTx *SubTx\n}\n\n//Open returns DB connection and runs SPI_connect, nonatomic in the procedures called by CALL\nfunc Open() (*DB, error) {\n\tif call := currentCall(); call != nil && call.nonatomic {\n\t\tif C.SPI_connect_ext(C.SPI_OPT_NONATOMIC) != C.SPI_OK_CONNECT {\n\t\t\treturn nil, errors.New(\"can't connect\")\n\t\t}\n\t\treturn &DB{nonatomic: true}, nil\n\t}\n\tif C.SPI_connect() != C.SPI_OK_CONNECT {\n\t\treturn nil, errors.New(\"can't connect\")\n\t}\n\treturn new(DB), nil\n}\n\n//Close closes the DB connection\nfunc (db *DB) Close() error {\n\tif db.subTx != nil {\n\t\treturn errors.New(\"Error closing DB, release or rollback the subtransaction first\")\n\t}\n\tif C.SPI_finish() != C.SPI_OK_FINISH {\n\t\treturn errors.New(\"Error closing DB\")\n\t}\n\treturn nil\n}\n\n//elogLevel Log level enum\ntype elogLevel int\n\n//elogLevel constants\nconst (\n\tnoticeLevel elogLevel = iota\n\terrorLevel\n)\n\n//elog represents the elog io.Writter to use with Logger\ntype elog struct {\n\tLevel elogLevel\n}\n\n//Write is an notify implemented as io.Writter\nfunc (e *elog) Write(p []byte) (n int, err error) {\n\tswitch e.Level {\n\tcase noticeLevel:\n\t\tcp := C.CString(string(p))\n\t\tdefer C.free(unsafe.Pointer(cp))\n\t\tC.elog_notice(cp)\n\tcase errorLevel:\n\t\tcp := C.CString(string(p))\n\t\tdefer C.free(unsafe.Pointer(cp))\n\t\tC.elog_error(cp)\n\t}\n\treturn len(p), nil\n}\n\n//NewNoticeLogger creates an logger that writes into NOTICE elog\nfunc NewNoticeLogger(prefix string, flag int) *log.Logger {\n\treturn log.New(&elog{Level: noticeLevel}, prefix, flag)\n}\n\n//NewErrorLogger creates an logger that writes into ERROR elog\nfunc NewErrorLogger(prefix string, flag int) *log.Logger {\n\treturn log.New(&elog{Level: errorLevel}, prefix, flag)\n}\n\n//funcInfo is the type of parameters that all functions get\ntype funcInfo C.FunctionCallInfoBaseData\n\n//CalledAsTrigger checks if the function is called as trigger\nfunc (fcinfo *funcInfo) CalledAsTrigger() bool {\n\treturn C.called_as_trigger((*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo))) == (C._Bool)(true)\n}\n\n//TODO Scan must return argument also if the function is called as trigger\n\n//Scan sets the args to the function parameter values (converted from PostgreSQL types to Go types).\n//The pointers to pointers (e.g. **int64) are set to nil for NULL, the other NULL arguments keep the zero values\nfunc (fcinfo *funcInfo) Scan(args ...interface{}) error {\n\t_, err := fcinfo.scanArgs(0, args...)\n\treturn err\n}\n\n//scanArgs sets the args to the parameter values from the parameter first on, as Scan,\n//it reports whether all the arguments of the not nullable args are not NULL\nfunc (fcinfo *funcInfo) scanArgs(first int, args ...interface{}) (bool, error) {\n\tpresent := true\n\tfor i, arg := range args {\n\t\tn := first + i\n\t\ttarget := reflect.ValueOf(arg).Elem()\n\t\tnullable := target.Kind() == reflect.Ptr\n\t\tif C.arg_is_null((*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo)), C.uint(n)) == (C._Bool)(true) {\n\t\t\tif nullable {\n\t\t\t\ttarget.Set(reflect.Zero(target.Type()))\n\t\t\t} else {\n\t\t\t\tpresent = false\n\t\t\t}\n\t\t\tcontinue\n\t\t}\n\t\tfuncArg := C.get_arg((*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo)), C.uint(n))\n\t\targOid := C.get_call_expr_argtype(fcinfo.flinfo.fn_expr, C.int(n))\n\t\tif nullable {\n\t\t\tvalue := reflect.New(target.Type().Elem())\n\t\t\tif err := scanVal(argOid, \"\", funcArg, value.Interface()); err != nil {\n\t\t\t\treturn false, err\n\t\t\t}\n\t\t\ttarget.Set(value)\n\t\t\tcontinue\n\t\t}\n\t\terr := scanVal(argOid, \"\", funcArg, arg)\n\t\tif err != nil {\n\t\t\treturn false, err\n\t\t}\n\t}\n\treturn present, nil\n}\n\n//TriggerData returns Trigger data, if the function was called as trigger, else nil\nfunc (fcinfo *funcInfo) TriggerData() *TriggerData {\n\tif !fcinfo.CalledAsTrigger() {\n\t\treturn nil\n\t}\n\tcTriggerData := (*C.TriggerData)(unsafe.Pointer(fcinfo.context))\n\ttriggerData := &TriggerData{\n\t\ttgEvent:    cTriggerData.tg_event,\n\t\ttgRelation: cTriggerData.tg_relation,\n\t\ttgTrigger:  cTriggerData.tg_trigger,\n\t}\n\tif triggerData.FiredByInsert() {\n\t\ttriggerData.OldRow = nil\n\t\ttriggerData.NewRow = newTriggerRow(cTriggerData.tg_relation.rd_att, cTriggerData.tg_trigtuple)\n\t} else if triggerData.FiredByDelete() {\n\t\ttriggerData.OldRow = newTriggerRow(cTriggerData.tg_relation.rd_att, cTriggerData.tg_trigtuple)\n\t\ttriggerData.NewRow = nil\n\t} else if triggerData.FiredByUpdate() {\n\t\ttriggerData.OldRow = newTriggerRow(cTriggerData.tg_relation.rd_att, cTriggerData.tg_trigtuple)\n\t\ttriggerData.NewRow = newTriggerRow(cTriggerData.tg_relation.rd_att, cTriggerData.tg_newtuple)\n\t}\n\treturn triggerData\n}\n\n//TriggerData represents the data passed by the trigger manager\ntype TriggerData struct {\n\ttgEvent    C.TriggerEvent\n\ttgRelation C.Relation\n\ttgTrigger  *C.Trigger\n\tOldRow     *TriggerRow\n\tNewRow     *TriggerRow\n}\n\n//FiredBefore returns true if the trigger fired before the operation.\nfunc (td *TriggerData) FiredBefore() bool {\n\treturn C.trigger_fired_before(td.tgEvent) == (C._Bool)(true)\n}\n\n//FiredAfter returns true if the trigger fired after the operation.\nfunc (td *TriggerData) FiredAfter() bool {\n\treturn C.trigger_fired_after(td.tgEvent) == (C._Bool)(true)\n}\n\n//FiredInstead returns true if the trigger fired instead of the operation.\nfunc (td *TriggerData) FiredInstead() bool {\n\treturn C.trigger_fired_instead(td.tgEvent) == (C._Bool)(true)\n}\n\n//FiredForRow returns true if the trigger fired for a row-level event.\nfunc (td *TriggerData) FiredForRow() bool {\n\treturn C.trigger_fired_for_row(td.tgEvent) == (C._Bool)(true)\n}\n\n//FiredForStatement returns true if the trigger fired for a statement-level event.\nfunc (td *TriggerData) FiredForStatement() bool {\n\treturn C.trigger_fired_for_statement(td.tgEvent) == (C._Bool)(true)\n}\n\n//FiredByInsert returns true if the trigger was fired by an INSERT command.\nfunc (td *TriggerData) FiredByInsert() bool {\n\treturn C.trigger_fired_by_insert(td.tgEvent) == (C._Bool)(true)\n}\n\n//FiredByUpdate returns true if the trigger was fired by an UPDATE command.\nfunc (td *TriggerData) FiredByUpdate() bool {\n\treturn C.trigger_fired_by_update(td.tgEvent) == (C._Bool)(true)\n}\n\n//FiredByDelete returns true if the trigger was fired by a DELETE command.\nfunc (td *TriggerData) FiredByDelete() bool {\n\treturn C.trigger_fired_by_delete(td.tgEvent) == (C._Bool)(true)\n}\n\n//FiredByTruncate returns true if the trigger was fired by a TRUNCATE command.\nfunc (td *TriggerData) FiredByTruncate() bool {\n\treturn C.trigger_fired_by_truncate(td.tgEvent) == (C._Bool)(true)\n}\n\n//TriggerRow is used in TriggerData as NewRow and OldRow\ntype TriggerRow struct {\n\ttupleDesc C.TupleDesc\n\tattrs     []C.Datum\n\tnulls     []bool\n}\n\nfunc newTriggerRow(tupleDesc C.TupleDesc, heapTuple C.HeapTuple) *TriggerRow {\n\tif heapTuple == nil {\n\t\treturn nil\n\t}\n\tnatts := int(tupleDesc.natts)\n\trow := &TriggerRow{tupleDesc, make([]C.Datum, natts), make([]bool, natts)}\n\tfor i := 0; i < natts; i++ {\n\t\tvar isNull C.bool\n\t\trow.attrs[i] = C.get_heap_getattr(heapTuple, C.uint(i+1), tupleDesc, &isNull)\n\t\trow.nulls[i] = isNull == (C._Bool)(true)\n\t}\n\treturn row\n}\n\n//Scan sets the args from the TriggerRow, the args of NULL columns are set to their zero values\nfunc (row *TriggerRow) Scan(args ...interface{}) error {\n\tfor i, arg := range args {\n\t\tif row.nulls[i] {\n\t\t\ttarget := reflect.ValueOf(arg).Elem()\n\t\t\ttarget.Set(reflect.Zero(target.Type()))\n\t\t\tcontinue\n\t\t}\n\t\toid := C.SPI_gettypeid(row.tupleDesc, C.int(i+1))\n\t\ttypeName := C.SPI_gettype(row.tupleDesc, C.int(i+1))\n\t\terr := scanVal(oid, C.GoString(typeName), row.attrs[i], arg)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n\treturn nil\n}\n\n//heapTuple forms the heap tuple of the row\nfunc (row *TriggerRow) heapTuple() C.HeapTuple {\n\tisNull := make([]C.bool, len(row.attrs))\n\tfor i := range row.attrs {\n\t\tisNull[i] = (C._Bool)(row.nulls[i])\n\t}\n\treturn C.heap_form_tuple(row.tupleDesc, &row.attrs[0], &isNull[0])\n}\n\n//Set sets the i'th value in the row, nil sets it to NULL\nfunc (row *TriggerRow) Set(i int, val interface{}) {\n\trow.attrs[i] = (C.Datum)(toDatum(val))\n\trow.nulls[i] = val == nil\n}\n\n//arrayElemOid returns the PostgreSQL type of the array elements of the Go type, the pointers are nullable elements\nfunc arrayElemOid(t reflect.Type) (C.Oid, bool) {\n\tif t.Kind() == reflect.Ptr {\n\t\tt = t.Elem()\n\t}\n\tif t == reflect.TypeOf(time.Time{}) {\n\t\treturn C.TIMESTAMPTZOID, true\n\t}\n\tif t == reflect.TypeOf(time.Duration(0)) {\n\t\treturn C.INTERVALOID, true\n\t}\n\tif t == reflect.TypeOf([]byte(nil)) {\n\t\treturn C.BYTEAOID, true\n\t}\n\tswitch t {\n\tcase reflect.TypeOf(netip.Addr{}):\n\t\treturn C.INETOID, true\n\tcase reflect.TypeOf(netip.Prefix{}):\n\t\treturn C.CIDROID, true\n\tcase reflect.TypeOf(net.HardwareAddr(nil)):\n\t\treturn C.MACADDROID, true\n\t}\n\tif t == reflect.TypeOf(UUID{}) {\n\t\treturn C.UUIDOID, true\n\t}\n\tif t == reflect.TypeOf(Numeric(\"\")) {\n\t\treturn C.NUMERICOID, true\n\t}\n\tswitch t.Kind() {\n\tcase reflect.String:\n\t\treturn C.TEXTOID, true\n\tcase reflect.Int16, reflect.Uint16:\n\t\treturn C.INT2OID, true\n\tcase reflect.Int32, reflect.Uint32:\n\t\treturn C.INT4OID, true\n\tcase reflect.Int64, reflect.Int, reflect.Uint:\n\t\treturn C.INT8OID, true\n\tcase reflect.Float32:\n\t\treturn C.FLOAT4OID, true\n\tcase reflect.Float64:\n\t\treturn C.FLOAT8OID, true\n\tcase reflect.Bool:\n\t\treturn C.BOOLOID, true\n\t}\n\treturn 0, false\n}\n\n//makeArray returns the array datum of the slice, the nil pointer elements are NULL\nfunc makeArray(elemtype C.Oid, s reflect.Value) Datum {\n\tdatums := make([]C.Datum, s.Len()+1)\n\tnulls := make([]C.bool, s.Len()+1)\n\tfor i := 0; i < s.Len(); i++ {\n\t\telem := s.Index(i)\n\t\tif elem.Kind() == reflect.Ptr {\n\t\t\tif elem.IsNil() {\n\t\t\t\tnulls[i] = (C._Bool)(true)\n\t\t\t\tcontinue\n\t\t\t}\n\t\t\telem = elem.Elem()\n\t\t}\n\t\tdatums[i] = (C.Datum)(toDatum(elem.Interface()))\n\t}\n\treturn (Datum)(C.array_to_datum(elemtype, &datums[0], &nulls[0], C.int(s.Len())))\n}\n\n//makeSlice returns the elements of the array datum with their NULL flags and the element type\nfunc makeSlice(val C.Datum) ([]C.Datum, []bool, C.Oid) {\n\tvar clength C.int\n\tvar cnulls *C.bool\n\tvar elemtype C.Oid\n\tdatumArray := C.datum_to_array(val, &clength, &cnulls, &elemtype)\n\tlength := int(clength)\n\tif length == 0 {\n\t\treturn nil, nil, elemtype\n\t}\n\tslice := (*[1 << 30]C.Datum)(unsafe.Pointer(datumArray))[:length:length]\n\tcnullSlice := (*[1 << 30]C.bool)(unsafe.Pointer(cnulls))[:length:length]\n\tnulls := make([]bool, length)\n\tfor i, isNull := range cnullSlice {\n\t\tnulls[i] = isNull == (C._Bool)(true)\n\t}\n\treturn slice, nulls, elemtype\n}\n\n//scanArray sets the slice pointed by target from the array datum,\n//the NULL elements can be scanned only into an slice of pointers\nfunc scanArray(val C.Datum, typeName string, target reflect.Value) error {\n\telems, nulls, elemtype := makeSlice(val)\n\tslice := reflect.MakeSlice(target.Type(), len(elems), len(elems))\n\tfor i := range elems {\n\t\telem := slice.Index(i)\n\t\tif nulls[i] {\n\t\t\tif elem.Kind() != reflect.Ptr {\n\t\t\t\treturn fmt.Errorf(\"Array %s contains NULL, scan it into an slice of pointers (%s)\", typeName, reflect.PtrTo(target.Type().Elem()))\n\t\t\t}\n\t\t\tcontinue\n\t\t}\n\t\tptr := elem.Addr()\n\t\tif elem.Kind() == reflect.Ptr {\n\t\t\telem.Set(reflect.New(elem.Type().Elem()))\n\t\t\tptr = elem\n\t\t}\n\t\tif err := scanVal(elemtype, typeName, elems[i], ptr.Interface()); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n\ttarget.Set(slice)\n\treturn nil\n}\n\n//toDatum returns the Postgresql C type from Golang type\nfunc toDatum(val interface{}) Datum {\n\tswitch v := val.(type) {\n\tcase error:\n\t\ts := C.CString(v.Error())\n\t\tdefer C.free(unsafe.Pointer(s))\n\t\treturn (Datum)(C.cstring_to_datum(s))\n\tcase string:\n\t\ts := C.CString(v)\n\t\tdefer C.free(unsafe.Pointer(s))\n\t\treturn (Datum)(C.cstring_to_datum(s))\n\tcase []byte:\n\t\t//the bytes are copied from the Go memory into the varlena, without an intermediate C copy\n\t\tif len(v) == 0 {\n\t\t\treturn (Datum)(C.bytes_to_datum(nil, 0))\n\t\t}\n\t\treturn (Datum)(C.bytes_to_datum(unsafe.Pointer(&v[0]), C.uint(len(v))))\n\tcase int16:\n\t\treturn (Datum)(C.int16_to_datum(C.int16(v)))\n\tcase uint16:\n\t\treturn (Datum)(C.uint16_to_datum(C.uint16(v)))\n\tcase int32:\n\t\treturn (Datum)(C.int32_to_datum(C.int32(v)))\n\tcase uint32:\n\t\treturn (Datum)(C.uint32_to_datum(C.uint32(v)))\n\tcase int64:\n\t\treturn (Datum)(C.int64_to_datum(C.int64(v)))\n\tcase int:\n\t\treturn (Datum)(C.int64_to_datum(C.int64(v)))\n\tcase uint:\n\t\treturn (Datum)(C.uint32_to_datum(C.uint32(v)))\n\tcase float32:\n\t\treturn (Datum)(C.float4_to_datum(C.float(v)))\n\tcase float64:\n\t\treturn (Datum)(C.float8_to_datum(C.double(v)))\n\tcase time.Time:\n\t\treturn timeDatum(v, \"timestamptz\")\n\tcase time.Duration:\n\t\treturn intervalDatum(v)\n\tcase bool:\n\t\tif v {\n\t\t\treturn (Datum)(C.bool_to_datum((C._Bool)(true)))\n\t\t}\n\t\treturn (Datum)(C.bool_to_datum((C._Bool)(false)))\n\tcase map[string]*string:\n\t\treturn hstoreDatum(v)\n\tcase UUID:\n\t\treturn uuidDatum(v)\n\tcase Numeric:\n\t\treturn numericDatum(v)\n\tcase netip.Addr:\n\t\treturn addrDatum(v)\n\tcase netip.Prefix:\n\t\treturn prefixDatum(v)\n\tcase net.HardwareAddr:\n\t\treturn macaddrDatum(v)\n\tcase rangeValue:\n\t\treturn rangeDatum(v)\n\tcase JSONB:\n\t\tcjson := C.CString(string(v.document()))\n\t\tdefer C.free(unsafe.Pointer(cjson))\n\t\treturn (Datum)(C.jsonb_to_datum(cjson))\n\tcase *TriggerRow:\n\t\tif v == nil {\n\t\t\treturn toDatum(nil)\n\t\t}\n\t\treturn (Datum)(C.heap_tuple_to_datum(v.heapTuple()))\n\tdefault:\n\t\t//slices of the builtin types and of pointers to them (nullable elements) are arrays\n\t\tif s := reflect.ValueOf(val); s.Kind() == reflect.Slice {\n\t\t\tif elemtype, ok := arrayElemOid(s.Type().Elem()); ok {\n\t\t\t\treturn makeArray(elemtype, s)\n\t\t\t}\n\t\t}\n\t\t//the structs (and maps) are jsonb\n\t\tif k := reflect.ValueOf(val).Kind(); k == reflect.Struct || k == reflect.Map {\n\t\t\tdata, err := json.Marshal(val)\n\t\t\tif err != nil {\n\t\t\t\tLog.Error(fmt.Sprintf(\"Cannot marshal %T to jsonb: %s\", val, err))\n\t\t\t}\n\t\t\treturn toDatum(JSONB(data))\n\t\t}\n\t\treturn (Datum)(C.void_datum())\n\t}\n}\n\n//Stmt represents the prepared SQL statement\ntype Stmt struct {\n\tspiPlan C.SPIPlanPtr\n\tdb      *DB\n\ttypeIds []C.Oid\n\tquery   string\n}\n\n//Prepare prepares an SQL query and returns a Stmt that can be executed\n//query - the SQL query\n//types - an array of strings with type names from postgresql of the prepared query\nfunc (db *DB) Prepare(query string, types []string) (*Stmt, error) {\n\tvar typeIds []C.Oid\n\tvar typeIdsP *C.Oid\n\tif len(types) > 0 {\n\t\ttypeIds = make([]C.Oid, len(types))\n\t\tvar typmod C.int32\n\t\tfor i, t := range types {\n\t\t\tct := C.CString(t)\n\t\t\tdefer C.free(unsafe.Pointer(ct))\n\t\t\tC.parseTypeString(ct, &typeIds[i], &typmod, nil)\n\t\t}\n\t\ttypeIdsP = &typeIds[0]\n\t}\n\tcq := C.CString(query)\n\tdefer C.free(unsafe.Pointer(cq))\n\tcplan, err := db.prepare(cq, C.int(len(types)), typeIdsP)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tif cplan != nil {\n\t\treturn &Stmt{spiPlan: cplan, db: db, typeIds: typeIds, query: query}, nil\n\t}\n\treturn nil, fmt.Errorf(\"Prepare failed: %s\", C.GoString(C.SPI_result_code_string(C.SPI_result)))\n}\n\n//Query executes the prepared Stmt with the provided args and returns\n//multiple Rows result, that can be iterated\nfunc (stmt *Stmt) Query(args ...interface{}) (rows *Rows, err error) {\n\tq := beginQuery(stmt.query, args)\n\tdefer endQuery(q, &err)\n\tif err = auditQuery(q); err != nil {\n\t\treturn nil, err\n\t}\n\tvaluesP, nullsP, err := stmt.spiArgs(args)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\trv, err := stmt.executePlan(valuesP, nullsP, 0)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tif rv == C.SPI_OK_SELECT && C.SPI_processed > 0 {\n\t\treturn newRows(C.SPI_tuptable.vals, C.SPI_tuptable.tupdesc, C.uint64(C.SPI_processed)), nil\n\t}\n\treturn nil, fmt.Errorf(\"Query failed: %s\", C.GoString(C.SPI_result_code_string(C.SPI_result)))\n}\n\n//QueryRow executes the prepared Stmt with the provided args and returns one row result\nfunc (stmt *Stmt) QueryRow(args ...interface{}) (row *Row, err error) {\n\tq := beginQuery(stmt.query, args)\n\tdefer endQuery(q, &err)\n\tif err = auditQuery(q); err != nil {\n\t\treturn nil, err\n\t}\n\tvaluesP, nullsP, err := stmt.spiArgs(args)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\trv, err := stmt.executePlan(valuesP, nullsP, 1)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tif rv >= C.int(0) && C.SPI_processed == 1 {\n\t\treturn &Row{\n\t\t\theapTuple: C.get_heap_tuple(C.SPI_tuptable.vals, C.uint(0)),\n\t\t\ttupleDesc: C.SPI_tuptable.tupdesc,\n\t\t}, nil\n\t}\n\treturn nil, fmt.Errorf(\"QueryRow failed: %s\", C.GoString(C.SPI_result_code_string(C.SPI_result)))\n}\n\n//Exec executes a prepared query Stmt with no result\nfunc (stmt *Stmt) Exec(args ...interface{}) (err error) {\n\tq := beginQuery(stmt.query, args)\n\tdefer endQuery(q, &err)\n\tif err = auditQuery(q); err != nil {\n\t\treturn err\n\t}\n\tvaluesP, nullsP, err := stmt.spiArgs(args)\n\tif err != nil {\n\t\treturn err\n\t}\n\trv, err := stmt.executePlan(valuesP, nullsP, 0)\n\tif err != nil {\n\t\treturn err\n\t}\n\tif rv >= C.int(0) && C.SPI_processed == 0 {\n\t\treturn nil\n\t}\n\tif rv == C.SPI_OK_INSERT {\n\t\treturn nil\n\t}\n\treturn fmt.Errorf(\"Exec failed: %s\", C.GoString(C.SPI_result_code_string(C.SPI_result)))\n}\n\n//queryCall is an query running through a Stmt\ntype queryCall struct {\n\tquery string\n\targs  []interface{}\n\tstart time.Time\n\tspan  *span\n}\n\n//beginQuery is called before every query executed through a Stmt\nfunc beginQuery(query string, args []interface{}) *queryCall {\n\tCheckTimers()\n\tq := &queryCall{query: query, args: args, start: time.Now()}\n\tq.span = startQuerySpan(query)\n\treturn q\n}\n\n//endQuery is called after the query finished, err is the error returned by the query\nfunc endQuery(q *queryCall, err *error) {\n\tq.span.finish(*err)\n\tlogSlowQuery(q, *err)\n}\n\nfunc (stmt *Stmt) spiArgs(args []interface{}) (valuesP *C.Datum, nullsP *C.char, err error) {\n\tif len(args) == 0 {\n\t\treturn\n\t}\n\tvalues := make([]Datum, len(args))\n\tnulls := make([]C.char, len(args))\n\tfor i, arg := range args {\n\t\t//nil and the nil pointers are NULL, the other pointers (but the trigger rows) bind their values\n\t\tif v := reflect.ValueOf(arg); v.Kind() == reflect.Ptr {\n\t\t\tif v.IsNil() {\n\t\t\t\targ = nil\n\t\t\t} else if _, ok := arg.(*TriggerRow); !ok {\n\t\t\t\targ = v.Elem().Interface()\n\t\t\t}\n\t\t}\n\t\tif arg == nil {\n\t\t\tnulls[i] = C.char('n')\n\t\t\tcontinue\n\t\t}\n\t\tswitch stmt.typeIds[i] {\n\t\tcase C.JSONBOID:\n\t\t\tjsonData, err := json.Marshal(arg)\n\t\t\tif err != nil {\n\t\t\t\treturn nil, nil, err\n\t\t\t}\n\t\t\tcjson := C.CString(string(jsonData))\n\t\t\tdefer C.free(unsafe.Pointer(cjson))\n\t\t\tvalues[i] = (Datum)(C.jsonb_to_datum(cjson))\n\t\tcase C.JSONOID:\n\t\t\tjsonData, err := json.Marshal(arg)\n\t\t\tif err != nil {\n\t\t\t\treturn nil, nil, err\n\t\t\t}\n\t\t\tvalues[i] = toDatum(string(jsonData))\n\t\tdefault:\n\t\t\tvalues[i] = toDatum(arg)\n\t\t}\n\t\tnulls[i] = C.char(' ')\n\t}\n\tvaluesP = (*C.Datum)(unsafe.Pointer(&values[0]))\n\tnullsP = &nulls[0]\n\treturn\n}\n\n//Rows represents the result of running a prepared Stmt with Query\ntype Rows struct {\n\theapTuples []C.HeapTuple\n\ttupleDesc  C.TupleDesc\n\tprocessed  uint32\n\tcurrent    C.HeapTuple\n}\n\nfunc newRows(heapTuples *C.HeapTuple, tupleDesc C.TupleDesc, processed C.uint64) *Rows {\n\trows := &Rows{\n\t\ttupleDesc: tupleDesc,\n\t\tprocessed: uint32(processed),\n\t}\n\trows.heapTuples = make([]C.HeapTuple, rows.processed)\n\tfor i := 0; i < int(rows.processed); i++ {\n\t\trows.heapTuples[i] = C.get_heap_tuple(heapTuples, C.uint(i))\n\t}\n\treturn rows\n}\n\n//Next sets the Rows to another row, returs false if there isn't another\n//must be first called to set the Rows to the first row\nfunc (rows *Rows) Next() bool {\n\tif len(rows.heapTuples) == 0 {\n\t\treturn false\n\t}\n\trows.current = rows.heapTuples[0]\n\trows.heapTuples = rows.heapTuples[1:]\n\treturn true\n}\n\n//Scan takes pointers to variables that will be filled with the values of the current row\nfunc (rows *Rows) Scan(args ...interface{}) error {\n\tfor i, arg := range args {\n\t\tval := C.get_col_as_datum(rows.current, rows.tupleDesc, C.int(i))\n\t\toid := C.SPI_gettypeid(rows.tupleDesc, C.int(i+1))\n\t\ttypeName := C.SPI_gettype(rows.tupleDesc, C.int(i+1))\n\t\terr := scanVal(oid, C.GoString(typeName), val, arg)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n\treturn nil\n}\n\n//Columns returns the names of columns\nfunc (rows *Rows) Columns() ([]string, error) {\n\tvar columns []string\n\tfor i := 1; ; i++ {\n\t\tfname := C.SPI_fname(rows.tupleDesc, C.int(i))\n\n\t\tif fname == nil {\n\t\t\tbreak\n\t\t}\n\t\tif C.SPI_result == C.SPI_ERROR_NOATTRIBUTE {\n\t\t\treturn nil, fmt.Errorf(\"Error getting column names\")\n\t\t}\n\t\tcolumns = append(columns, C.GoString(fname))\n\t}\n\treturn columns, nil\n}\n\n//Row represents a single row from running a query\ntype Row struct {\n\ttupleDesc C.TupleDesc\n\theapTuple C.HeapTuple\n}\n\n//Scan scans the args from Row\nfunc (row *Row) Scan(args ...interface{}) error {\n\tfor i, arg := range args {\n\t\tval := C.get_col_as_datum(row.heapTuple, row.tupleDesc, C.int(i))\n\t\toid := C.SPI_gettypeid(row.tupleDesc, C.int(i+1))\n\t\ttypeName := C.SPI_gettype(row.tupleDesc, C.int(i+1))\n\t\terr := scanVal(oid, C.GoString(typeName), val, arg)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n\treturn nil\n}\n\nfunc scanVal(oid C.Oid, typeName string, val C.Datum, arg interface{}) error {\n\tswitch targ := arg.(type) {\n\tcase *string:\n\t\tswitch oid {\n\t\tcase C.TEXTOID:\n\t\t\t*targ = C.GoString(C.datum_to_cstring(val))\n\t\tcase C.UNKNOWNOID:\n\t\t\t*targ = C.GoString(C.unknown_to_char(val))\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not text %s\", typeName)\n\t\t}\n\tcase *int16:\n\t\tswitch oid {\n\t\tcase C.INT2OID:\n\t\t\t*targ = int16(C.datum_to_int16(val))\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not int16 %s\", typeName)\n\t\t}\n\tcase *uint16:\n\t\tswitch oid {\n\t\tcase C.INT2OID:\n\t\t\t*targ = uint16(C.datum_to_uint16(val))\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not uint16 %s\", typeName)\n\t\t}\n\tcase *int32:\n\t\tswitch oid {\n\t\tcase C.INT4OID:\n\t\t\t*targ = int32(C.datum_to_int32(val))\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not int32 %s\", typeName)\n\t\t}\n\tcase *uint32:\n\t\tswitch oid {\n\t\tcase C.INT4OID:\n\t\t\t*targ = uint32(C.datum_to_uint32(val))\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not uint32 %s\", typeName)\n\t\t}\n\tcase *int64:\n\t\tswitch oid {\n\t\tcase C.INT8OID:\n\t\t\t*targ = int64(C.datum_to_int64(val))\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not int64 %s\", typeName)\n\t\t}\n\tcase *int:\n\t\tswitch oid {\n\t\tcase C.INT2OID:\n\t\t\t*targ = int(C.datum_to_int16(val))\n\t\tcase C.INT4OID:\n\t\t\t*targ = int(C.datum_to_int32(val))\n\t\tcase C.INT8OID:\n\t\t\t*targ = int(C.datum_to_int64(val))\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not int %s\", typeName)\n\t\t}\n\tcase *uint:\n\t\tswitch oid {\n\t\tcase C.INT2OID:\n\t\t\t*targ = uint(C.datum_to_int16(val))\n\t\tcase C.INT4OID:\n\t\t\t*targ = uint(C.datum_to_int32(val))\n\t\tcase C.INT8OID:\n\t\t\t*targ = uint(C.datum_to_int64(val))\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not uint %s\", typeName)\n\t\t}\n\tcase *bool:\n\t\tswitch oid {\n\t\tcase C.BOOLOID:\n\t\t\t*targ = C.datum_to_bool(val) == (C._Bool)(true)\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not bool %s\", typeName)\n\t\t}\n\tcase *float32:\n\t\tswitch oid {\n\t\tcase C.FLOAT4OID:\n\t\t\t*targ = float32(C.datum_to_float4(val))\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not real %s\", typeName)\n\t\t}\n\tcase *float64:\n\t\tswitch oid {\n\t\tcase C.FLOAT8OID:\n\t\t\t*targ = float64(C.datum_to_float8(val))\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not double precision %s\", typeName)\n\t\t}\n\tcase *[]uint8:\n\t\tswitch oid {\n\t\tcase C.BYTEAOID:\n\t\t\tbytea := C.datum_to_byteap(val)\n\t\t\tbyteaPointer := unsafe.Pointer(bytea)\n\t\t\t//the bytes are copied into the Go memory, the slice can be kept after the call\n\t\t\t*targ = C.GoBytes(unsafe.Pointer(C.bytea_to_chars(bytea)), C.__varsize_any(byteaPointer))\n\t\t\tC.bytea_free(val, bytea)\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Column type is not bytea %s\", typeName)\n\t\t}\n\tcase *time.Time:\n\t\treturn scanTime(oid, typeName, val, targ)\n\tcase *time.Duration:\n\t\treturn scanDuration(oid, typeName, val, targ)\n\tcase *UUID:\n\t\treturn scanUUID(oid, typeName, val, targ)\n\tcase *Numeric:\n\t\treturn scanNumeric(oid, typeName, val, targ)\n\tcase *netip.Addr:\n\t\treturn scanAddr(oid, typeName, val, targ)\n\tcase *netip.Prefix:\n\t\treturn scanPrefix(oid, typeName, val, targ)\n\tcase *net.HardwareAddr:\n\t\treturn scanMacaddr(oid, typeName, val, targ)\n\tcase rangeTarget:\n\t\treturn scanRange(oid, typeName, val, targ)\n\tcase *map[string]*string:\n\t\t//the jsonb objects can be scanned into the map too\n\t\tif oid == C.JSONBOID {\n\t\t\treturn json.Unmarshal([]byte(C.GoString(C.datum_to_jsonb_cstring(val))), targ)\n\t\t}\n\t\treturn scanHstore(oid, typeName, val, targ)\n\tdefault:\n\t\t//slices of the builtin types and of pointers to them (nullable elements)\n\t\tif target := reflect.ValueOf(arg); target.Kind() == reflect.Ptr && target.Elem().Kind() == reflect.Slice && C.get_element_type(oid) != 0 {\n\t\t\tif _, ok := arrayElemOid(target.Type().Elem().Elem()); ok {\n\t\t\t\treturn scanArray(val, typeName, target.Elem())\n\t\t\t}\n\t\t}\n\t\t//the structs are the composite types\n\t\tif target := reflect.ValueOf(arg); target.Kind() == reflect.Ptr && target.Elem().Kind() == reflect.Struct && C.type_is_rowtype(oid) == (C._Bool)(true) {\n\t\t\treturn scanComposite(val, arg)\n\t\t}\n\t\t//the string types are the enum types\n\t\tif target := reflect.ValueOf(arg); target.Kind() == reflect.Ptr && target.Elem().Kind() == reflect.String && C.type_is_enum(oid) == (C._Bool)(true) {\n\t\t\tscanEnum(oid, val, target)\n\t\t\treturn nil\n\t\t}\n\t\tswitch oid {\n\t\tcase C.JSONBOID:\n\t\t\tjsonData := []byte(C.GoString(C.datum_to_jsonb_cstring(val)))\n\t\t\treturn json.Unmarshal(jsonData, arg)\n\t\tcase C.JSONOID:\n\t\t\tjsonData := []byte(C.GoString(C.datum_to_cstring(val)))\n\t\t\treturn json.Unmarshal(jsonData, arg)\n\t\tdefault:\n\t\t\treturn fmt.Errorf(\"Unsupported type in Scan (%T) %s\", arg, typeName)\n\t\t}\n\t}\n\treturn nil\n}\n",
+	"plancache.go":       "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"executor/spi.h\"\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"strings\"\n\t\"sync\"\n)\n\n//plans are the statements prepared by Prepare by their queries and parameter types,\n//they are kept for the life of the backend\nvar plans = struct {\n\tsync.Mutex\n\tstmts map[string]*Stmt\n}{stmts: make(map[string]*Stmt)}\n\n//Prepare returns the prepared statement of the query with the parameter types (PostgreSQL type names),\n//the plan is prepared by the first call in the backend and kept (SPI_keepplan) for the next calls of the functions,\n//PostgreSQL replans it when the used tables change. It must be called with an open DB\n//\n//\tstmt, err := plgo.Prepare(\"SELECT name FROM users WHERE id = $1\", \"bigint\")\n//\trow, err := stmt.QueryRow(id)\nfunc Prepare(query string, argTypes ...string) (*Stmt, error) {\n\tkey := strings.Join(argTypes, \",\") + \"\\x00\" + query\n\tplans.Lock()\n\tdefer plans.Unlock()\n\tif stmt, ok := plans.stmts[key]; ok {\n\t\treturn stmt, nil\n\t}\n\tstmt, err := new(DB).Prepare(query, argTypes)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tif rv := C.SPI_keepplan(stmt.spiPlan); rv != 0 {\n\t\treturn nil, fmt.Errorf(\"Prepare failed: %s\", C.GoString(C.SPI_result_code_string(rv)))\n\t}\n\tplans.stmts[key] = stmt\n\treturn stmt, nil\n}\n\n//ResetPrepared frees the plans kept by Prepare, the next calls prepare them again\nfunc ResetPrepared() {\n\tplans.Lock()\n\tdefer plans.Unlock()\n\tfor key, stmt := range plans.stmts {\n\t\tC.SPI_freeplan(stmt.spiPlan)\n\t\tdelete(plans.stmts, key)\n\t}\n}\n",
+	"procedure.go":       "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"executor/spi.h\"\n#include \"nodes/parsenodes.h\"\n\n//plgo_nonatomic returns true if the procedure is called by CALL outside of an transaction block,\n//only then it can commit and rollback the transaction\nbool plgo_nonatomic(FunctionCallInfo fcinfo) {\n\treturn fcinfo->context != NULL && IsA(fcinfo->context, CallContext) && !castNode(CallContext, fcinfo->context)->atomic;\n}\n*/\nimport \"C\"\nimport (\n\t\"errors\"\n\t\"unsafe\"\n)\n\n//errAtomic is returned by Commit and Rollback outside of an procedure called by CALL outside of an transaction block\nvar errAtomic = errors.New(\"Transaction control is allowed only in procedures called by CALL outside of an transaction block\")\n\n//errOpenSubTx is returned by Commit and Rollback in an subtransaction\nvar errOpenSubTx = errors.New(\"Release or rollback the subtransaction before ending the transaction\")\n\n//endingTransaction is true while Commit or Rollback ends the transaction of the procedure,\n//the Go code isn't interrupted, so the abort handlers aren't run\nvar endingTransaction bool\n\n//beginProcedure is called by the generated wrappers of the procedures instead of beginCall,\n//the DB opened by the procedure called by CALL can commit and rollback\nfunc beginProcedure(fcinfo *funcInfo, name string) *funcCall {\n\tcall := beginCall(fcinfo, name)\n\tcall.nonatomic = C.plgo_nonatomic((C.FunctionCallInfo)(unsafe.Pointer(fcinfo))) == (C._Bool)(true)\n\treturn call\n}\n\n//Commit commits the current transaction of the procedure and starts a new one, the work done so far\n//stays committed even if the procedure fails later. The Rows and Cursors don't survive the transaction,\n//close them before Commit\nfunc (db *DB) Commit() error {\n\tif !db.nonatomic {\n\t\treturn errAtomic\n\t}\n\tif db.subTx != nil {\n\t\treturn errOpenSubTx\n\t}\n\tendingTransaction = true\n\tdefer func() { endingTransaction = false }()\n\tC.SPI_commit()\n\treturn nil\n}\n\n//Rollback rolls back the current transaction of the procedure and starts a new one, as Commit\nfunc (db *DB) Rollback() error {\n\tif !db.nonatomic {\n\t\treturn errAtomic\n\t}\n\tif db.subTx != nil {\n\t\treturn errOpenSubTx\n\t}\n\tendingTransaction = true\n\tdefer func() { endingTransaction = false }()\n\tC.SPI_rollback()\n\treturn nil\n}\n",
+	"query.go":           "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"utils/builtins.h\"\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"net\"\n\t\"net/netip\"\n\t\"reflect\"\n\t\"strconv\"\n\t\"strings\"\n\t\"time\"\n\t\"unsafe\"\n)\n\n//paramTypes are the SQL types of the Go values bound as query parameters\nvar paramTypes = map[reflect.Type]string{\n\treflect.TypeOf(\"\"):                    \"text\",\n\treflect.TypeOf([]byte{}):              \"bytea\",\n\treflect.TypeOf(int16(0)):              \"smallint\",\n\treflect.TypeOf(uint16(0)):             \"smallint\",\n\treflect.TypeOf(int32(0)):              \"integer\",\n\treflect.TypeOf(uint32(0)):             \"integer\",\n\treflect.TypeOf(int64(0)):              \"bigint\",\n\treflect.TypeOf(int(0)):                \"bigint\",\n\treflect.TypeOf(uint(0)):               \"bigint\",\n\treflect.TypeOf(float32(0)):            \"real\",\n\treflect.TypeOf(float64(0)):            \"double precision\",\n\treflect.TypeOf(false):                 \"boolean\",\n\treflect.TypeOf(time.Time{}):           \"timestamptz\",\n\treflect.TypeOf(time.Duration(0)):      \"interval\",\n\treflect.TypeOf(UUID{}):                \"uuid\",\n\treflect.TypeOf(Numeric(\"\")):           \"numeric\",\n\treflect.TypeOf(netip.Addr{}):          \"inet\",\n\treflect.TypeOf(netip.Prefix{}):        \"cidr\",\n\treflect.TypeOf(net.HardwareAddr(nil)): \"macaddr\",\n\treflect.TypeOf(Range[int32]{}):        \"int4range\",\n\treflect.TypeOf(Range[int64]{}):        \"int8range\",\n\treflect.TypeOf(Range[Numeric]{}):      \"numrange\",\n\treflect.TypeOf(Range[time.Time]{}):    \"tstzrange\",\n\t//the hstore extension must be created\n\treflect.TypeOf(map[string]*string(nil)): \"hstore\",\n}\n\n//Query is an SQL query composed from trusted SQL fragments, quoted identifiers and literals\n//and bound parameters, so the dynamically composed queries can't introduce an SQL injection.\n//Only the fragments added with NewQuery and SQL are written as they are, they must not contain user input\n//\n//\tq := plgo.NewQuery(\"SELECT name FROM \").Ident(schema, table).\n//\t\tSQL(\" WHERE id IN (\").In(ids).SQL(\") AND state = \").Param(\"active\")\n//\tstmt, err := db.PrepareQuery(q)\n//\trows, err := stmt.Query(q.Args()...)\ntype Query struct {\n\tsql   strings.Builder\n\targs  []interface{}\n\ttypes []string\n\terr   error\n}\n\n//NewQuery starts an query with the trusted SQL fragment\nfunc NewQuery(sql string) *Query {\n\tq := &Query{}\n\tq.sql.WriteString(sql)\n\treturn q\n}\n\n//SQL appends an trusted SQL fragment\nfunc (q *Query) SQL(sql string) *Query {\n\tq.sql.WriteString(sql)\n\treturn q\n}\n\n//Ident appends an identifier quoted by the server (quote_identifier),\n//more names are joined with dots to an qualified name, e.g. Ident(schema, table)\nfunc (q *Query) Ident(names ...string) *Query {\n\tfor i, name := range names {\n\t\tif i > 0 {\n\t\t\tq.sql.WriteByte('.')\n\t\t}\n\t\tq.sql.WriteString(QuoteIdent(name))\n\t}\n\treturn q\n}\n\n//Literal appends an string literal quoted by the server (quote_literal),\n//use it where parameters can't be used, e.g. in utility commands\nfunc (q *Query) Literal(value string) *Query {\n\tq.sql.WriteString(QuoteLiteral(value))\n\treturn q\n}\n\n//Param appends an parameter placeholder ($n) bound to the value,\n//the parameter type is derived from the Go type of the value, an nil pointer (e.g. (*string)(nil)) is NULL\nfunc (q *Query) Param(value interface{}) *Query {\n\ttypeName, err := paramType(value, len(q.args)+1)\n\tif err != nil {\n\t\tif q.err == nil {\n\t\t\tq.err = err\n\t\t}\n\t\treturn q\n\t}\n\treturn q.TypedParam(value, typeName)\n}\n\n//paramType returns the SQL type of the n-th query parameter value, the pointers have the types of their elements\nfunc paramType(value interface{}, n int) (string, error) {\n\tif value == nil {\n\t\treturn \"\", fmt.Errorf(\"Query parameter %d: untyped nil has no SQL type, pass an typed nil pointer, e.g. (*string)(nil), or write NULL in the SQL\", n)\n\t}\n\tt := reflect.TypeOf(value)\n\tif t.Kind() == reflect.Ptr {\n\t\tt = t.Elem()\n\t}\n\ttypeName, ok := paramTypes[t]\n\tif !ok {\n\t\treturn \"\", fmt.Errorf(\"Query parameter %d: type %T not supported\", n, value)\n\t}\n\treturn typeName, nil\n}\n\n//TypedParam appends an parameter placeholder ($n) bound to the value with the SQL type, e.g. jsonb\nfunc (q *Query) TypedParam(value interface{}, typeName string) *Query {\n\tq.args = append(q.args, value)\n\tq.types = append(q.types, typeName)\n\tq.sql.WriteString(\"$\" + strconv.Itoa(len(q.args)))\n\treturn q\n}\n\n//In appends an comma separated list of parameter placeholders bound to the elements of the values slice,\n//for `column IN (...)`. An empty slice appends NULL, so the IN matches no rows\nfunc (q *Query) In(values interface{}) *Query {\n\tslice := reflect.ValueOf(values)\n\tif slice.Kind() != reflect.Slice {\n\t\tif q.err == nil {\n\t\t\tq.err = fmt.Errorf(\"Query IN list: %T is not an slice\", values)\n\t\t}\n\t\treturn q\n\t}\n\tif slice.Len() == 0 {\n\t\tq.sql.WriteString(\"NULL\")\n\t\treturn q\n\t}\n\tfor i := 0; i < slice.Len(); i++ {\n\t\tif i > 0 {\n\t\t\tq.sql.WriteString(\", \")\n\t\t}\n\t\tq.Param(slice.Index(i).Interface())\n\t}\n\treturn q\n}\n\n//String returns the SQL text of the query\nfunc (q *Query) String() string {\n\treturn q.sql.String()\n}\n\n//Args returns the values of the query parameters\nfunc (q *Query) Args() []interface{} {\n\treturn q.args\n}\n\n//Types returns the SQL types of the query parameters\nfunc (q *Query) Types() []string {\n\treturn q.types\n}\n\n//Err returns the first error of composing the query\nfunc (q *Query) Err() error {\n\treturn q.err\n}\n\n//PrepareQuery prepares the composed query, execute the Stmt with q.Args()\nfunc (db *DB) PrepareQuery(q *Query) (*Stmt, error) {\n\tif q.err != nil {\n\t\treturn nil, q.err\n\t}\n\treturn db.Prepare(q.String(), q.types)\n}\n\n//QuoteIdent quotes the identifier for use in an SQL query, if needed\nfunc QuoteIdent(name string) string {\n\tcname := C.CString(name)\n\tdefer C.free(unsafe.Pointer(cname))\n\t//quote_identifier returns its argument if no quoting is needed\n\treturn C.GoString(C.quote_identifier(cname))\n}\n\n//QuoteLiteral quotes the string as an SQL literal\nfunc QuoteLiteral(value string) string {\n\tcvalue := C.CString(value)\n\tdefer C.free(unsafe.Pointer(cvalue))\n\tquoted := C.quote_literal_cstr(cvalue)\n\tdefer C.pfree(unsafe.Pointer(quoted))\n\treturn C.GoString(quoted)\n}\n\n//extensionSchema returns the schema of the extension, or \"\" if the extension isn't created in the database\nfunc extensionSchema(db *DB) (string, error) {\n\tstmt, err := db.Prepare(\"SELECT coalesce((SELECT n.nspname::text FROM pg_catalog.pg_extension e \"+\n\t\t\"JOIN pg_catalog.pg_namespace n ON n.oid = e.extnamespace WHERE e.extname = $1), '')\", []string{\"text\"})\n\tif err != nil {\n\t\treturn \"\", err\n\t}\n\trow, err := stmt.QueryRow(extensionName)\n\tif err != nil {\n\t\treturn \"\", err\n\t}\n\tvar schema string\n\terr = row.Scan(&schema)\n\treturn schema, err\n}\n",
+	"querylog.go":        "package plgo\n\nimport (\n\t\"fmt\"\n\t\"math\"\n\t\"strings\"\n\t\"time\"\n)\n\n//logMinDuration is <extension>.log_min_duration,\n//the queries running at least this long are logged, -1 disables it\nvar logMinDuration = newIntGUC(gucDesc{\n\tname:      \"log_min_duration\",\n\tshortDesc: \"Sets the minimum execution time above which SPI queries issued from Go are logged.\",\n\tlongDesc:  \"Zero logs all queries, -1 turns this feature off.\",\n\tcontext:   gucSuset,\n\tflags:     gucUnitMs,\n}, -1, -1, math.MaxInt32)\n\n//logRedactParameters is <extension>.log_redact_parameters,\n//the parameters of the logged slow queries are replaced by a placeholder\nvar logRedactParameters = newBoolGUC(gucDesc{\n\tname:      \"log_redact_parameters\",\n\tshortDesc: \"Hides the parameter values of the logged slow SPI queries.\",\n\tcontext:   gucSuset,\n}, false)\n\n//logSlowQuery logs the query if it ran longer than <extension>.log_min_duration\nfunc logSlowQuery(q *queryCall, err error) {\n\tminDuration := logMinDuration.get()\n\tif minDuration < 0 {\n\t\treturn\n\t}\n\tduration := time.Since(q.start)\n\tif duration < time.Duration(minDuration)*time.Millisecond {\n\t\treturn\n\t}\n\tfields := []interface{}{\n\t\t\"duration_ms\", float64(duration) / float64(time.Millisecond),\n\t\t\"query\", q.query,\n\t}\n\tif len(q.args) > 0 {\n\t\tfields = append(fields, \"parameters\", formatQueryArgs(q.args, logRedactParameters.get()))\n\t}\n\tif err != nil {\n\t\tfields = append(fields, \"error\", err)\n\t}\n\tLog.Log(\"slow query\", fields...)\n}\n\n//formatQueryArgs formats the query parameters as $1 = value, $2 = value\nfunc formatQueryArgs(args []interface{}, redact bool) string {\n\tparams := make([]string, len(args))\n\tfor i, arg := range args {\n\t\tvalue := \"<redacted>\"\n\t\tif !redact {\n\t\t\tswitch v := arg.(type) {\n\t\t\tcase nil:\n\t\t\t\tvalue = \"NULL\"\n\t\t\tcase string:\n\t\t\t\tvalue = \"'\" + strings.ReplaceAll(v, \"'\", \"''\") + \"'\"\n\t\t\tdefault:\n\t\t\t\tvalue = fmt.Sprint(v)\n\t\t\t}\n\t\t}\n\t\tparams[i] = fmt.Sprintf(\"$%d = %s\", i+1, value)\n\t}\n\treturn strings.Join(params, \", \")\n}\n",
+	"queue.go":           "package plgo\n\nimport (\n\t\"encoding/json\"\n\t\"errors\"\n\t\"fmt\"\n\t\"time\"\n)\n\n//Queue is an work queue stored in the <extension>_queue table, that is created in the extensions using NewQueue.\n//The messages are claimed with SELECT ... FOR UPDATE SKIP LOCKED, so the concurrent consumers don't block each other.\n//The claimed messages stay locked until the end of the transaction, if it aborts they are returned to the queue\ntype Queue struct {\n\tName string\n\t//MaxAttempts is the number of claims before the failed message is moved to the dead status\n\tMaxAttempts int\n\t//Backoff is the delay before the first retry of the failed message, it's doubled with every attempt up to MaxBackoff\n\tBackoff    time.Duration\n\tMaxBackoff time.Duration\n}\n\n//QueueMessage is an message claimed from the queue\ntype QueueMessage struct {\n\tID      int64  `json:\"id\"`\n\tPayload string `json:\"payload\"`\n\t//Attempts is the number of claims of the message, including this one\n\tAttempts int `json:\"attempts\"`\n}\n\n//ErrNoQueueTable is returned if the extension isn't created in the database\nvar ErrNoQueueTable = errors.New(\"plgo: the extension is not created in this database\")\n\n//NewQueue returns the queue with the default retries: 5 attempts, 10 seconds backoff up to an hour\nfunc NewQueue(name string) *Queue {\n\treturn &Queue{Name: name, MaxAttempts: 5, Backoff: 10 * time.Second, MaxBackoff: time.Hour}\n}\n\n//queueSchema is the cached schema of the extension\nvar queueSchema string\n\n//table returns the qualified name of the queue table\nfunc (q *Queue) table(db *DB) (string, error) {\n\tif queueSchema == \"\" {\n\t\tschema, err := extensionSchema(db)\n\t\tif err != nil {\n\t\t\treturn \"\", err\n\t\t}\n\t\tif schema == \"\" {\n\t\t\treturn \"\", ErrNoQueueTable\n\t\t}\n\t\tqueueSchema = schema\n\t}\n\treturn QuoteIdent(queueSchema) + \".\" + QuoteIdent(extensionName+\"_queue\"), nil\n}\n\n//Enqueue adds the message to the queue, returns its id\nfunc (q *Queue) Enqueue(db *DB, payload string) (int64, error) {\n\treturn q.EnqueueAfter(db, payload, 0)\n}\n\n//EnqueueAfter adds the message to the queue, it can be claimed after the delay\nfunc (q *Queue) EnqueueAfter(db *DB, payload string, delay time.Duration) (int64, error) {\n\ttable, err := q.table(db)\n\tif err != nil {\n\t\treturn 0, err\n\t}\n\tstmt, err := db.Prepare(\"INSERT INTO \"+table+\" (queue, payload, run_at) \"+\n\t\t\"VALUES ($1, $2, now() + make_interval(secs => $3)) RETURNING id\", []string{\"text\", \"text\", \"float8\"})\n\tif err != nil {\n\t\treturn 0, err\n\t}\n\trow, err := stmt.QueryRow(q.Name, payload, delay.Seconds())\n\tif err != nil {\n\t\treturn 0, err\n\t}\n\tvar id int64\n\terr = row.Scan(&id)\n\treturn id, err\n}\n\n//Claim locks up to limit ready messages, the oldest first. The locks are held until the end of the transaction,\n//every claimed message must be acknowledged with Ack or Fail before the commit, or it's claimed again\nfunc (q *Queue) Claim(db *DB, limit int) ([]QueueMessage, error) {\n\ttable, err := q.table(db)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tstmt, err := db.Prepare(\"WITH claimed AS (UPDATE \"+table+\" SET attempts = attempts + 1 WHERE id IN (\"+\n\t\t\"SELECT id FROM \"+table+\" WHERE queue = $1 AND status = 'ready' AND run_at <= now() \"+\n\t\t\"ORDER BY run_at, id LIMIT $2 FOR UPDATE SKIP LOCKED) RETURNING id, payload, attempts) \"+\n\t\t\"SELECT coalesce(json_agg(c ORDER BY c.id), '[]')::text FROM claimed c\", []string{\"text\", \"integer\"})\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\trow, err := stmt.QueryRow(q.Name, int32(limit))\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tvar data string\n\tif err = row.Scan(&data); err != nil {\n\t\treturn nil, err\n\t}\n\tvar messages []QueueMessage\n\terr = json.Unmarshal([]byte(data), &messages)\n\treturn messages, err\n}\n\n//Ack removes the processed message from the queue\nfunc (q *Queue) Ack(db *DB, m QueueMessage) error {\n\ttable, err := q.table(db)\n\tif err != nil {\n\t\treturn err\n\t}\n\tstmt, err := db.Prepare(\"WITH acked AS (DELETE FROM \"+table+\" WHERE id = $1 RETURNING 1) SELECT count(*) FROM acked\",\n\t\t[]string{\"bigint\"})\n\tif err != nil {\n\t\treturn err\n\t}\n\t_, err = stmt.QueryRow(m.ID)\n\treturn err\n}\n\n//Fail returns the message to the queue to be retried after the backoff,\n//the message is moved to the dead status after MaxAttempts\nfunc (q *Queue) Fail(db *DB, m QueueMessage, cause error) error {\n\ttable, err := q.table(db)\n\tif err != nil {\n\t\treturn err\n\t}\n\tdelay := q.Backoff\n\tfor i := 1; i < m.Attempts && delay < q.MaxBackoff; i++ {\n\t\tdelay *= 2\n\t}\n\tif delay > q.MaxBackoff {\n\t\tdelay = q.MaxBackoff\n\t}\n\tmessage := \"\"\n\tif cause != nil {\n\t\tmessage = RedactSecrets(cause.Error())\n\t}\n\tstmt, err := db.Prepare(\"WITH failed AS (UPDATE \"+table+\" SET status = CASE WHEN attempts >= $2 THEN 'dead' ELSE 'ready' END, \"+\n\t\t\"run_at = now() + make_interval(secs => $3), last_error = $4 WHERE id = $1 RETURNING 1) SELECT count(*) FROM failed\",\n\t\t[]string{\"bigint\", \"integer\", \"float8\", \"text\"})\n\tif err != nil {\n\t\treturn err\n\t}\n\t_, err = stmt.QueryRow(m.ID, int32(q.MaxAttempts), delay.Seconds(), message)\n\tif err != nil {\n\t\treturn fmt.Errorf(\"cannot fail message %d: %w\", m.ID, err)\n\t}\n\treturn nil\n}\n",
+	"range.go":           "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"catalog/pg_type.h\"\n#include \"utils/lsyscache.h\"\n#include \"utils/rangetypes.h\"\n#include \"utils/typcache.h\"\n\n//plgo_range_elem_type returns the element type of the range type\nOid plgo_range_elem_type(Oid rangetype) {\n\treturn get_range_subtype(rangetype);\n}\n\n//plgo_range_bounds deserializes the range datum, it returns true for the empty range\nbool plgo_range_bounds(Datum val, Datum *lower, bool *lower_inc, bool *lower_inf, Datum *upper, bool *upper_inc, bool *upper_inf) {\n\tRangeType *range = DatumGetRangeTypeP(val);\n\tTypeCacheEntry *typcache = lookup_type_cache(RangeTypeGetOid(range), TYPECACHE_RANGE_INFO);\n\tRangeBound l, u;\n\tbool empty;\n\n\trange_deserialize(typcache, range, &l, &u, &empty);\n\t*lower = l.val;\n\t*lower_inc = l.inclusive;\n\t*lower_inf = l.infinite;\n\t*upper = u.val;\n\t*upper_inc = u.inclusive;\n\t*upper_inf = u.infinite;\n\treturn empty;\n}\n\n//plgo_make_range returns the canonical range datum of the range type, e.g. [1,3) for the int4range [1,2]\nDatum plgo_make_range(Oid rangetype, Datum lower, bool lower_inc, bool lower_inf, Datum upper, bool upper_inc, bool upper_inf, bool empty) {\n\tTypeCacheEntry *typcache = lookup_type_cache(rangetype, TYPECACHE_RANGE_INFO);\n\tRangeBound l = {.val = lower, .infinite = lower_inf, .inclusive = lower_inc, .lower = true};\n\tRangeBound u = {.val = upper, .infinite = upper_inf, .inclusive = upper_inc, .lower = false};\n\n#if PG_VERSION_NUM >= 160000\n\treturn RangeTypePGetDatum(make_range(typcache, &l, &u, empty, NULL));\n#else\n\treturn RangeTypePGetDatum(make_range(typcache, &l, &u, empty));\n#endif\n}\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"reflect\"\n\t\"time\"\n)\n\n//Range is the PostgreSQL range of T: Range[int32] is int4range, Range[int64] int8range, Range[Numeric] numrange\n//and Range[time.Time] tstzrange (tsrange or daterange declared with //plgo:time)\ntype Range[T any] struct {\n\tLower, Upper T\n\t//LowerInc and UpperInc are true for the inclusive bounds, [ and ]\n\tLowerInc, UpperInc bool\n\t//LowerInf and UpperInf are true for the unbounded sides, their values are ignored\n\tLowerInf, UpperInf bool\n\t//Empty is true for the empty range, the bounds are ignored\n\tEmpty bool\n}\n\n//NewRange returns the range [lower, upper), the default bounds of the ranges\nfunc NewRange[T any](lower, upper T) Range[T] {\n\treturn Range[T]{Lower: lower, Upper: upper, LowerInc: true}\n}\n\n//rangeValue is implemented by the ranges, they are converted by the type of their bounds\ntype rangeValue interface {\n\telemType() reflect.Type\n\t//bounds returns the bound values, nil for the unbounded sides\n\tbounds() (lower, upper interface{})\n\tflags() (lowerInc, upperInc, empty bool)\n}\n\nfunc (r Range[T]) elemType() reflect.Type {\n\treturn reflect.TypeOf(&r.Lower).Elem()\n}\n\nfunc (r Range[T]) bounds() (interface{}, interface{}) {\n\tvar lower, upper interface{}\n\tif !r.LowerInf {\n\t\tlower = r.Lower\n\t}\n\tif !r.UpperInf {\n\t\tupper = r.Upper\n\t}\n\treturn lower, upper\n}\n\nfunc (r Range[T]) flags() (bool, bool, bool) {\n\treturn r.LowerInc, r.UpperInc, r.Empty\n}\n\n//rangeTarget is implemented by the pointers to the ranges, they are scanned from the range datums\ntype rangeTarget interface {\n\t//boundTargets returns the pointers to the bound values\n\tboundTargets() (lower, upper interface{})\n\tsetFlags(lowerInc, lowerInf, upperInc, upperInf, empty bool)\n}\n\nfunc (r *Range[T]) boundTargets() (interface{}, interface{}) {\n\treturn &r.Lower, &r.Upper\n}\n\nfunc (r *Range[T]) setFlags(lowerInc, lowerInf, upperInc, upperInf, empty bool) {\n\tr.LowerInc, r.LowerInf, r.UpperInc, r.UpperInf, r.Empty = lowerInc, lowerInf, upperInc, upperInf, empty\n}\n\n//rangeTypes are the builtin range types of the bound types\nvar rangeTypes = map[reflect.Type]C.Oid{\n\treflect.TypeOf(int32(0)):    C.INT4RANGEOID,\n\treflect.TypeOf(int64(0)):    C.INT8RANGEOID,\n\treflect.TypeOf(Numeric(\"\")): C.NUMRANGEOID,\n\treflect.TypeOf(time.Time{}): C.TSTZRANGEOID,\n}\n\n//rangeDatum returns the datum of the range, the bounds are converted by toDatum\nfunc rangeDatum(r rangeValue) Datum {\n\trangeType, ok := rangeTypes[r.elemType()]\n\tif !ok {\n\t\traise(\"\", fmt.Sprintf(\"range of %s not supported\", r.elemType()), \"\")\n\t}\n\treturn makeRange(rangeType, r, toDatum)\n}\n\n//timeRangeDatum returns the datum of the time range of the //plgo:time type, tsrange for timestamp and daterange for date\nfunc timeRangeDatum(r Range[time.Time], sqlType string) Datum {\n\trangeType := C.Oid(C.TSTZRANGEOID)\n\tswitch sqlType {\n\tcase \"timestamp\":\n\t\trangeType = C.TSRANGEOID\n\tcase \"date\":\n\t\trangeType = C.DATERANGEOID\n\t}\n\treturn makeRange(rangeType, r, func(t interface{}) Datum {\n\t\treturn timeDatum(t.(time.Time), sqlType)\n\t})\n}\n\n//makeRange returns the range datum of the range type with the bounds converted by elemDatum\nfunc makeRange(rangeType C.Oid, r rangeValue, elemDatum func(interface{}) Datum) Datum {\n\tvar lowerDatum, upperDatum C.Datum\n\tlower, upper := r.bounds()\n\tif lower != nil {\n\t\tlowerDatum = (C.Datum)(elemDatum(lower))\n\t}\n\tif upper != nil {\n\t\tupperDatum = (C.Datum)(elemDatum(upper))\n\t}\n\tlowerInc, upperInc, empty := r.flags()\n\treturn (Datum)(C.plgo_make_range(rangeType, lowerDatum, (C._Bool)(lowerInc), (C._Bool)(lower == nil),\n\t\tupperDatum, (C._Bool)(upperInc), (C._Bool)(upper == nil), (C._Bool)(empty)))\n}\n\n//scanRange sets the range from the range datum, the bounds are scanned into the bound type\nfunc scanRange(oid C.Oid, typeName string, val C.Datum, target rangeTarget) error {\n\telemType := C.plgo_range_elem_type(oid)\n\tif elemType == 0 {\n\t\treturn fmt.Errorf(\"Column type is not an range %s\", typeName)\n\t}\n\tvar lower, upper C.Datum\n\tvar lowerInc, lowerInf, upperInc, upperInf C.bool\n\tempty := C.plgo_range_bounds(val, &lower, &lowerInc, &lowerInf, &upper, &upperInc, &upperInf) == (C._Bool)(true)\n\ttarget.setFlags(lowerInc == (C._Bool)(true), lowerInf == (C._Bool)(true), upperInc == (C._Bool)(true), upperInf == (C._Bool)(true), empty)\n\tif empty {\n\t\treturn nil\n\t}\n\tlowerTarget, upperTarget := target.boundTargets()\n\tif lowerInf != (C._Bool)(true) {\n\t\tif err := scanVal(elemType, typeName, lower, lowerTarget); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n\tif upperInf != (C._Bool)(true) {\n\t\tif err := scanVal(elemType, typeName, upper, upperTarget); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n\treturn nil\n}\n",
+	"ratelimit.go":       "package plgo\n\nimport (\n\t\"encoding/json\"\n\t\"fmt\"\n\t\"math\"\n\t\"time\"\n)\n\n//RateLimiter is an token bucket shared by all backends, the bucket is stored in an shared area\n//and updated under its entry lock, so the limit is global across the sessions\ntype RateLimiter struct {\n\tname string\n\t//rate is the number of tokens added per second\n\trate float64\n\t//burst is the capacity of the bucket\n\tburst float64\n}\n\n//tokenBucket is the state of an rate limiter in the shared area\ntype tokenBucket struct {\n\tTokens float64 `json:\"t\"`\n\t//Updated is the time of the last refill in unix nanoseconds\n\tUpdated int64 `json:\"u\"`\n}\n\n//NewRateLimiter returns the limiter allowing rate events per second with bursts of up to burst events,\n//the limiters with the same name share the bucket\nfunc NewRateLimiter(name string, rate float64, burst int) (*RateLimiter, error) {\n\tif name == \"\" || len(name) >= sharedKeyLen {\n\t\treturn nil, fmt.Errorf(\"Rate limiter name must be 1 to %d bytes long: %q\", sharedKeyLen-1, name)\n\t}\n\tif rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) || burst < 1 {\n\t\treturn nil, fmt.Errorf(\"Rate limiter %s must have positive rate and burst\", name)\n\t}\n\treturn &RateLimiter{name: name, rate: rate, burst: float64(burst)}, nil\n}\n\n//rateLimits returns the shared area of the rate limiters of the extension\nfunc rateLimits() (*SharedArea, error) {\n\treturn AttachSharedArea(extensionName + \" rate limits\")\n}\n\n//reserve takes n tokens from the bucket if there are enough,\n//otherwise returns the time until there will be enough tokens\nfunc (l *RateLimiter) reserve(n int) (bool, time.Duration, error) {\n\tif float64(n) > l.burst {\n\t\treturn false, 0, fmt.Errorf(\"Rate limiter %s can't allow %d events at once, the burst is %g\", l.name, n, l.burst)\n\t}\n\tarea, err := rateLimits()\n\tif err != nil {\n\t\treturn false, 0, err\n\t}\n\tvar allowed bool\n\tvar wait time.Duration\n\tvar bucketErr error\n\terr = area.Update(l.name, func(old []byte, ok bool) []byte {\n\t\tnow := time.Now().UnixNano()\n\t\tbucket := tokenBucket{Tokens: l.burst, Updated: now}\n\t\tif ok {\n\t\t\tif bucketErr = json.Unmarshal(old, &bucket); bucketErr != nil {\n\t\t\t\treturn old\n\t\t\t}\n\t\t\telapsed := time.Duration(now - bucket.Updated).Seconds()\n\t\t\tif elapsed > 0 {\n\t\t\t\tbucket.Tokens = math.Min(l.burst, bucket.Tokens+elapsed*l.rate)\n\t\t\t}\n\t\t\tbucket.Updated = now\n\t\t}\n\t\tif bucket.Tokens >= float64(n) {\n\t\t\tbucket.Tokens -= float64(n)\n\t\t\tallowed = true\n\t\t} else {\n\t\t\twait = time.Duration((float64(n) - bucket.Tokens) / l.rate * float64(time.Second))\n\t\t}\n\t\tvar data []byte\n\t\tif data, bucketErr = json.Marshal(bucket); bucketErr != nil {\n\t\t\treturn old\n\t\t}\n\t\treturn data\n\t})\n\tif err == nil {\n\t\terr = bucketErr\n\t}\n\treturn allowed, wait, err\n}\n\n//Allow takes an token, returns false if the limit is exceeded\nfunc (l *RateLimiter) Allow() (bool, error) {\n\treturn l.AllowN(1)\n}\n\n//AllowN takes n tokens, returns false (and takes nothing) if there aren't enough\nfunc (l *RateLimiter) AllowN(n int) (bool, error) {\n\tallowed, _, err := l.reserve(n)\n\treturn allowed, err\n}\n\n//Wait waits until n tokens can be taken, it returns ErrInterrupted on an query cancel or statement_timeout\nfunc (l *RateLimiter) Wait(n int) error {\n\tfor {\n\t\tallowed, wait, err := l.reserve(n)\n\t\tif err != nil || allowed {\n\t\t\treturn err\n\t\t}\n\t\tfor wait > 0 {\n\t\t\tif interruptPending() {\n\t\t\t\treturn ErrInterrupted\n\t\t\t}\n\t\t\tstep := wait\n\t\t\tif step > interruptPollInterval {\n\t\t\t\tstep = interruptPollInterval\n\t\t\t}\n\t\t\ttime.Sleep(step)\n\t\t\twait -= step\n\t\t}\n\t}\n}\n\n//Reset refills the bucket of the limiter\nfunc (l *RateLimiter) Reset() error {\n\tarea, err := rateLimits()\n\tif err != nil {\n\t\treturn err\n\t}\n\t_, err = area.Delete(l.name)\n\treturn err\n}\n\n//rateLimiterArgs reads the name, rate, burst and tokens arguments of the rate limit functions\nfunc rateLimiterArgs(fcinfo *funcInfo) (*RateLimiter, int) {\n\tvar name string\n\tvar rate float64\n\tvar burst, tokens int32\n\tif err := fcinfo.Scan(&name, &rate, &burst, &tokens); err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\tlimiter, err := NewRateLimiter(name, rate, int(burst))\n\tif err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn limiter, int(tokens)\n}\n\n//export plgo_rate_limit\nfunc plgo_rate_limit(fcinfo *funcInfo) Datum {\n\tlimiter, tokens := rateLimiterArgs(fcinfo)\n\tallowed, err := limiter.AllowN(tokens)\n\tif err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn toDatum(allowed)\n}\n\n//export plgo_rate_limit_wait\nfunc plgo_rate_limit_wait(fcinfo *funcInfo) Datum {\n\tlimiter, tokens := rateLimiterArgs(fcinfo)\n\tif err := limiter.Wait(tokens); err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn toDatum(nil)\n}\n",
+	"restricted.go":      "//go:build plgo_restricted\n\npackage plgo\n\nimport (\n\t\"context\"\n\t\"errors\"\n\t\"net\"\n\t\"net/http\"\n)\n\n//ErrRestricted is returned by the network access blocked in the restricted mode\nvar ErrRestricted = errors.New(\"plgo: network access is not allowed in restricted mode\")\n\nfunc init() {\n\t//the default HTTP client is the usual way for libraries to reach the network\n\thttp.DefaultTransport = &http.Transport{\n\t\tDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {\n\t\t\treturn nil, ErrRestricted\n\t\t},\n\t}\n\thttp.DefaultClient = &http.Client{Transport: http.DefaultTransport}\n}\n",
+	"rowstruct.go":       "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"executor/spi.h\"\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"reflect\"\n\t\"strings\"\n\t\"unicode\"\n\t\"unsafe\"\n)\n\n//columnName returns the column of the struct field, its `plgo:\"name\"` or `db:\"name\"` tag or the field name in snake case\nfunc columnName(field reflect.StructField) string {\n\tif name := field.Tag.Get(\"plgo\"); name != \"\" {\n\t\treturn name\n\t}\n\tif name := field.Tag.Get(\"db\"); name != \"\" && name != \"-\" {\n\t\treturn name\n\t}\n\treturn snakeCase(field.Name)\n}\n\n//snakeCase returns the column name of the field name, e.g. user_id from UserID\nfunc snakeCase(name string) string {\n\trunes := []rune(name)\n\tvar b strings.Builder\n\tfor i, r := range runes {\n\t\tif unicode.IsUpper(r) && i > 0 {\n\t\t\tprevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])\n\t\t\tnextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])\n\t\t\tif prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {\n\t\t\t\tb.WriteByte('_')\n\t\t\t}\n\t\t}\n\t\tb.WriteRune(unicode.ToLower(r))\n\t}\n\treturn b.String()\n}\n\n//column returns the index of the named column in the row\nfunc (row *TriggerRow) column(name string) (int, error) {\n\tcname := C.CString(name)\n\tdefer C.free(unsafe.Pointer(cname))\n\tattnum := int(C.SPI_fnumber(row.tupleDesc, cname))\n\tif attnum <= 0 {\n\t\treturn 0, fmt.Errorf(\"Column %s not found in the trigger row\", name)\n\t}\n\treturn attnum - 1, nil\n}\n\n//structValue returns the struct pointed by ptr\nfunc structValue(ptr interface{}) (reflect.Value, error) {\n\tv := reflect.ValueOf(ptr)\n\tif v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {\n\t\treturn reflect.Value{}, fmt.Errorf(\"%T is not an pointer to struct\", ptr)\n\t}\n\treturn v.Elem(), nil\n}\n\n//ScanStruct sets the exported fields of the struct pointed by dest from the columns of the row,\n//the columns are named by the `plgo:\"name\"` tag or the field names in snake case, `plgo:\"-\"` skips the field.\n//The pointer fields of NULL columns are set to nil, the other fields to their zero values\nfunc (row *TriggerRow) ScanStruct(dest interface{}) error {\n\tv, err := structValue(dest)\n\tif err != nil {\n\t\treturn err\n\t}\n\tfor _, index := range setColumns(v.Type()) {\n\t\tfield := v.Type().Field(index)\n\t\ti, err := row.column(columnName(field))\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\ttarget := v.Field(index)\n\t\tif row.nulls[i] {\n\t\t\ttarget.Set(reflect.Zero(target.Type()))\n\t\t\tcontinue\n\t\t}\n\t\toid := C.SPI_gettypeid(row.tupleDesc, C.int(i+1))\n\t\ttypeName := C.GoString(C.SPI_gettype(row.tupleDesc, C.int(i+1)))\n\t\tif target.Kind() == reflect.Ptr {\n\t\t\tvalue := reflect.New(target.Type().Elem())\n\t\t\tif err = scanVal(oid, typeName, row.attrs[i], value.Interface()); err != nil {\n\t\t\t\treturn fmt.Errorf(\"Column %s: %w\", field.Name, err)\n\t\t\t}\n\t\t\ttarget.Set(value)\n\t\t\tcontinue\n\t\t}\n\t\tif err = scanVal(oid, typeName, row.attrs[i], target.Addr().Interface()); err != nil {\n\t\t\treturn fmt.Errorf(\"Column %s: %w\", field.Name, err)\n\t\t}\n\t}\n\treturn nil\n}\n\n//scanStruct sets the exported fields of the struct pointed by dest from the columns of the query result tuple,\n//the fields tagged `db:\"-\"` are skipped and the columns without an field are ignored\nfunc scanStruct(tupleDesc C.TupleDesc, tuple C.HeapTuple, dest interface{}) error {\n\tv, err := structValue(dest)\n\tif err != nil {\n\t\treturn err\n\t}\n\tfor _, index := range setColumns(v.Type()) {\n\t\tfield := v.Type().Field(index)\n\t\tif field.Tag.Get(\"db\") == \"-\" {\n\t\t\tcontinue\n\t\t}\n\t\tname := columnName(field)\n\t\tcname := C.CString(name)\n\t\tattnum := C.SPI_fnumber(tupleDesc, cname)\n\t\tC.free(unsafe.Pointer(cname))\n\t\tif attnum <= 0 {\n\t\t\treturn fmt.Errorf(\"Column %s not found in the result\", name)\n\t\t}\n\t\ttarget := v.Field(index)\n\t\tvar isnull C.bool\n\t\tval := C.SPI_getbinval(tuple, tupleDesc, attnum, &isnull)\n\t\tif isnull == (C._Bool)(true) {\n\t\t\ttarget.Set(reflect.Zero(target.Type()))\n\t\t\tcontinue\n\t\t}\n\t\toid := C.SPI_gettypeid(tupleDesc, attnum)\n\t\ttypeName := C.GoString(C.SPI_gettype(tupleDesc, attnum))\n\t\tif target.Kind() == reflect.Ptr {\n\t\t\tvalue := reflect.New(target.Type().Elem())\n\t\t\tif err = scanVal(oid, typeName, val, value.Interface()); err != nil {\n\t\t\t\treturn fmt.Errorf(\"Column %s: %w\", name, err)\n\t\t\t}\n\t\t\ttarget.Set(value)\n\t\t\tcontinue\n\t\t}\n\t\tif err = scanVal(oid, typeName, val, target.Addr().Interface()); err != nil {\n\t\t\treturn fmt.Errorf(\"Column %s: %w\", name, err)\n\t\t}\n\t}\n\treturn nil\n}\n\n//ScanStruct sets the exported fields of the struct pointed by dest from the columns of the current row,\n//the columns are named by the `db:\"name\"` (or `plgo:\"name\"`) tag or the field names in snake case, `db:\"-\"` skips the field.\n//The values are converted as by Scan, the pointer fields of NULL columns are set to nil, the other fields to their zero values.\n//The columns without an field are ignored\nfunc (rows *Rows) ScanStruct(dest interface{}) error {\n\treturn scanStruct(rows.tupleDesc, rows.current, dest)\n}\n\n//ScanStruct sets the exported fields of the struct pointed by dest from the columns of the row, as Rows.ScanStruct\nfunc (row *Row) ScanStruct(dest interface{}) error {\n\treturn scanStruct(row.tupleDesc, row.heapTuple, dest)\n}\n\n//SetStruct sets the columns of the row from the exported fields of the struct pointed by src,\n//the nil pointer fields set the columns to NULL, the columns without an field are unchanged\nfunc (row *TriggerRow) SetStruct(src interface{}) error {\n\tv, err := structValue(src)\n\tif err != nil {\n\t\treturn err\n\t}\n\tfor _, index := range setColumns(v.Type()) {\n\t\ti, err := row.column(columnName(v.Type().Field(index)))\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\tvalue := v.Field(index)\n\t\tif value.Kind() == reflect.Ptr {\n\t\t\tif value.IsNil() {\n\t\t\t\trow.Set(i, nil)\n\t\t\t\tcontinue\n\t\t\t}\n\t\t\tvalue = value.Elem()\n\t\t}\n\t\trow.Set(i, value.Interface())\n\t}\n\treturn nil\n}\n\n//scanRows sets newRow and oldRow (pointers to the struct pointers of an typed trigger) from NEW and OLD,\n//the missing row is nil\nfunc (td *TriggerData) scanRows(newRow, oldRow interface{}) error {\n\trows := []struct {\n\t\trow    *TriggerRow\n\t\ttarget interface{}\n\t}{{td.NewRow, newRow}, {td.OldRow, oldRow}}\n\tfor _, r := range rows {\n\t\tif r.row == nil {\n\t\t\tcontinue\n\t\t}\n\t\ttarget := reflect.ValueOf(r.target).Elem()\n\t\tvalue := reflect.New(target.Type().Elem())\n\t\tif err := r.row.ScanStruct(value.Interface()); err != nil {\n\t\t\treturn err\n\t\t}\n\t\ttarget.Set(value)\n\t}\n\treturn nil\n}\n\n//returnRow returns the result of an typed trigger, NEW (OLD for DELETE) with the columns set from the returned struct.\n//nil returns NULL, it skips the operation in an BEFORE trigger\nfunc (td *TriggerData) returnRow(row interface{}) Datum {\n\tif v := reflect.ValueOf(row); !v.IsValid() || v.IsNil() {\n\t\treturn toDatum(nil)\n\t}\n\ttarget := td.NewRow\n\tif target == nil {\n\t\ttarget = td.OldRow\n\t}\n\tif target == nil {\n\t\treturn toDatum(nil)\n\t}\n\tif err := target.SetStruct(row); err != nil {\n\t\tLog.Error(err.Error())\n\t}\n\treturn toDatum(target)\n}\n",
+	"rowvalues.go":       "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"access/tupdesc.h\"\n#include \"catalog/pg_type.h\"\n#include \"executor/spi.h\"\n#include \"utils/lsyscache.h\"\n\nextern char *plgo_text_output(Oid type, Datum value);\n\nint plgo_tupdesc_natts(TupleDesc tupdesc) {\n\treturn tupdesc->natts;\n}\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"net\"\n\t\"net/netip\"\n\t\"reflect\"\n\t\"time\"\n\t\"unsafe\"\n)\n\n//valueTypes are the Go types of the SQL types of the values returned by Values and Map,\n//the arrays of the array element types are slices (of pointers if they contain NULL)\nvar valueTypes = map[C.Oid]reflect.Type{\n\tC.BOOLOID:        reflect.TypeOf(false),\n\tC.INT2OID:        reflect.TypeOf(int16(0)),\n\tC.INT4OID:        reflect.TypeOf(int32(0)),\n\tC.INT8OID:        reflect.TypeOf(int64(0)),\n\tC.FLOAT4OID:      reflect.TypeOf(float32(0)),\n\tC.FLOAT8OID:      reflect.TypeOf(float64(0)),\n\tC.NUMERICOID:     reflect.TypeOf(Numeric(\"\")),\n\tC.TEXTOID:        reflect.TypeOf(\"\"),\n\tC.BYTEAOID:       reflect.TypeOf([]byte(nil)),\n\tC.TIMESTAMPTZOID: reflect.TypeOf(time.Time{}),\n\tC.TIMESTAMPOID:   reflect.TypeOf(time.Time{}),\n\tC.DATEOID:        reflect.TypeOf(time.Time{}),\n\tC.INTERVALOID:    reflect.TypeOf(time.Duration(0)),\n\tC.UUIDOID:        reflect.TypeOf(UUID{}),\n\tC.INETOID:        reflect.TypeOf(netip.Addr{}),\n\tC.CIDROID:        reflect.TypeOf(netip.Prefix{}),\n\tC.MACADDROID:     reflect.TypeOf(net.HardwareAddr(nil)),\n\tC.MACADDR8OID:    reflect.TypeOf(net.HardwareAddr(nil)),\n\tC.INT4RANGEOID:   reflect.TypeOf(Range[int32]{}),\n\tC.INT8RANGEOID:   reflect.TypeOf(Range[int64]{}),\n\tC.NUMRANGEOID:    reflect.TypeOf(Range[Numeric]{}),\n\tC.TSTZRANGEOID:   reflect.TypeOf(Range[time.Time]{}),\n\tC.TSRANGEOID:     reflect.TypeOf(Range[time.Time]{}),\n\tC.DATERANGEOID:   reflect.TypeOf(Range[time.Time]{}),\n\t//the json documents are decoded into maps, slices, strings, float64 and bool\n\tC.JSONBOID: reflect.TypeOf((*interface{})(nil)).Elem(),\n\tC.JSONOID:  reflect.TypeOf((*interface{})(nil)).Elem(),\n}\n\n//columnValue returns the value of the column converted to the Go type of its SQL type in valueTypes,\n//the enums and the types missing in valueTypes are returned in their text form\nfunc columnValue(oid C.Oid, typeName string, val C.Datum) (interface{}, error) {\n\tif goType, ok := valueTypes[oid]; ok {\n\t\tvalue := reflect.New(goType)\n\t\tif err := scanVal(oid, typeName, val, value.Interface()); err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t\treturn value.Elem().Interface(), nil\n\t}\n\tif elemGoType, ok := valueTypes[C.get_element_type(oid)]; ok && isArrayElem(elemGoType) {\n\t\tvalue := reflect.New(reflect.SliceOf(elemGoType))\n\t\tif err := scanVal(oid, typeName, val, value.Interface()); err == nil {\n\t\t\treturn value.Elem().Interface(), nil\n\t\t}\n\t\t//the arrays with NULL elements\n\t\tvalue = reflect.New(reflect.SliceOf(reflect.PtrTo(elemGoType)))\n\t\tif err := scanVal(oid, typeName, val, value.Interface()); err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t\treturn value.Elem().Interface(), nil\n\t}\n\ttext := C.plgo_text_output(oid, val)\n\tdefer C.pfree(unsafe.Pointer(text))\n\treturn C.GoString(text), nil\n}\n\nfunc isArrayElem(t reflect.Type) bool {\n\t_, ok := arrayElemOid(t)\n\treturn ok\n}\n\n//rowValues returns the values of the columns of the tuple, NULL is nil\nfunc rowValues(tupleDesc C.TupleDesc, tuple C.HeapTuple) ([]interface{}, error) {\n\tvalues := make([]interface{}, int(C.plgo_tupdesc_natts(tupleDesc)))\n\tfor i := range values {\n\t\tvar isnull C.bool\n\t\tval := C.SPI_getbinval(tuple, tupleDesc, C.int(i+1), &isnull)\n\t\tif isnull == (C._Bool)(true) {\n\t\t\tcontinue\n\t\t}\n\t\toid := C.SPI_gettypeid(tupleDesc, C.int(i+1))\n\t\ttypeName := C.GoString(C.SPI_gettype(tupleDesc, C.int(i+1)))\n\t\tvalue, err := columnValue(oid, typeName, val)\n\t\tif err != nil {\n\t\t\treturn nil, fmt.Errorf(\"Column %d: %w\", i+1, err)\n\t\t}\n\t\tvalues[i] = value\n\t}\n\treturn values, nil\n}\n\n//rowMap returns the values of the columns of the tuple by the column names, NULL is nil\nfunc rowMap(tupleDesc C.TupleDesc, tuple C.HeapTuple) (map[string]interface{}, error) {\n\tvalues, err := rowValues(tupleDesc, tuple)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tm := make(map[string]interface{}, len(values))\n\tfor i, value := range values {\n\t\tm[C.GoString(C.SPI_fname(tupleDesc, C.int(i+1)))] = value\n\t}\n\treturn m, nil\n}\n\n//Values returns the values of the columns of the current row converted to the Go types of their SQL types\n//(int32 for integer, time.Time for timestamptz, plgo.Numeric for numeric, ...), NULL is nil.\n//The types without a Go type, e.g. the enums, are returned in their text form\nfunc (rows *Rows) Values() ([]interface{}, error) {\n\treturn rowValues(rows.tupleDesc, rows.current)\n}\n\n//Map returns the values of the current row as Values by the column names, the later columns with the same name win\nfunc (rows *Rows) Map() (map[string]interface{}, error) {\n\treturn rowMap(rows.tupleDesc, rows.current)\n}\n\n//Values returns the values of the columns of the row, as Rows.Values\nfunc (row *Row) Values() ([]interface{}, error) {\n\treturn rowValues(row.tupleDesc, row.heapTuple)\n}\n\n//Map returns the values of the row by the column names, as Rows.Map\nfunc (row *Row) Map() (map[string]interface{}, error) {\n\treturn rowMap(row.tupleDesc, row.heapTuple)\n}\n\n//Values returns the values of the columns of the current row, as Rows.Values\nfunc (c *Cursor) Values() ([]interface{}, error) {\n\tif c.rows == nil {\n\t\treturn nil, fmt.Errorf(\"Cursor has no current row\")\n\t}\n\treturn c.rows.Values()\n}\n\n//Map returns the values of the current row by the column names, as Rows.Map\nfunc (c *Cursor) Map() (map[string]interface{}, error) {\n\tif c.rows == nil {\n\t\treturn nil, fmt.Errorf(\"Cursor has no current row\")\n\t}\n\treturn c.rows.Map()\n}\n",
+	"seccomp_linux.go":   "//go:build plgo_restricted && plgo_seccomp\n\npackage plgo\n\n/*\n#define _GNU_SOURCE\n#include <link.h>\n#include <stdint.h>\n\n//plgo_text_range finds the executable segment of the shared object of the extension, the Go runtime is linked into it\nstatic int plgo_text_phdr(struct dl_phdr_info *info, size_t size, void *data) {\n\tuintptr_t *text = data;\n\tuintptr_t self = (uintptr_t) &plgo_text_phdr;\n\tfor (int i = 0; i < info->dlpi_phnum; i++) {\n\t\tconst ElfW(Phdr) *phdr = &info->dlpi_phdr[i];\n\t\tif (phdr->p_type != PT_LOAD || !(phdr->p_flags & PF_X)) {\n\t\t\tcontinue;\n\t\t}\n\t\tuintptr_t start = info->dlpi_addr + phdr->p_vaddr;\n\t\tif (self >= start && self < start + phdr->p_memsz) {\n\t\t\ttext[0] = start;\n\t\t\ttext[1] = start + phdr->p_memsz;\n\t\t\treturn 1;\n\t\t}\n\t}\n\treturn 0;\n}\n\nstatic int plgo_text_range(uintptr_t *text) {\n\treturn dl_iterate_phdr(plgo_text_phdr, text);\n}\n*/\nimport \"C\"\nimport (\n\t\"errors\"\n\t\"fmt\"\n\t\"runtime\"\n\t\"syscall\"\n\t\"time\"\n\t\"unsafe\"\n)\n\n//seccomp constants from linux/seccomp.h and linux/audit.h\nconst (\n\tseccompSetModeFilter   = 1\n\tseccompFilterFlagTsync = 1\n\tseccompRetAllow        = 0x7fff0000\n\tseccompRetErrno        = 0x00050000\n\tauditArchX8664         = 0xc000003e\n\tauditArchAarch64       = 0xc00000b7\n\tprSetNoNewPrivs        = 38\n\tsysSeccompAmd64        = 317\n\tsysSeccompArm64        = 277\n\t//x32SyscallBit marks the syscalls of the x32 ABI, they have the x86-64 arch\n\tx32SyscallBit = 0x40000000\n)\n\n//fileSyscalls are the syscalls opening, changing or executing the files, by architecture:\n//open, creat, openat, openat2, truncate, rename, renameat, renameat2, mkdir, mkdirat, rmdir, mknod, mknodat,\n//link, linkat, unlink, unlinkat, symlink, symlinkat, chmod, fchmodat, fchmodat2, chown, lchown, fchownat, execve, execveat.\n//arm64 has only the *at syscalls\nvar fileSyscalls = map[string][]uint32{\n\t\"amd64\": {2, 85, 257, 437, 76, 82, 264, 316, 83, 258, 84, 133, 259, 86, 265, 87, 263, 88, 266, 90, 268, 452, 92, 94, 260, 59, 322},\n\t\"arm64\": {56, 437, 45, 38, 276, 34, 33, 37, 35, 36, 53, 452, 54, 221, 281},\n}\n\nvar seccompInstalled bool\n\n//enterRestricted installs an seccomp filter into the backend before the first call of an exported function,\n//the filter denies the file system and the creation of all but unix domain sockets to the code of the extension\n//(the Go code and the runtime linked into its shared object). The filter can't be removed, it applies to all threads\n//of the backend, but PostgreSQL and the other extensions (dblink, postgres_fdw) keep their files and sockets.\n//The open files stay usable, the time zone of time.Local is loaded before the filter\nfunc enterRestricted() {\n\tif seccompInstalled {\n\t\treturn\n\t}\n\t//time.Local is loaded on its first use, from /etc/localtime or the TZ zone\n\t_ = time.Local.String()\n\tif err := installSeccomp(); err != nil {\n\t\t//the call is aborted until the filter is installed\n\t\tLog.Error(fmt.Sprintf(\"cannot install seccomp filter: %s\", err))\n\t\treturn\n\t}\n\tseccompInstalled = true\n}\n\n//seccompFilter returns the filter program denying the syscalls of the code between start and end\nfunc seccompFilter(arch uint32, syscalls []uint32, start, end uint64) []syscall.SockFilter {\n\tdeny := uint32(seccompRetErrno | uint32(syscall.EACCES))\n\tconst (\n\t\tld  = syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS\n\t\tjeq = syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K\n\t\tjge = syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K\n\t\tjgt = syscall.BPF_JMP | syscall.BPF_JGT | syscall.BPF_K\n\t\tret = syscall.BPF_RET | syscall.BPF_K\n\t)\n\tfilter := []syscall.SockFilter{\n\t\t//seccomp_data.arch\n\t\t{Code: ld, K: 4},\n\t\t{Code: jeq, Jt: 1, Jf: 0, K: arch},\n\t\t{Code: ret, K: deny},\n\t\t//seccomp_data.nr, the x32 syscalls are denied\n\t\t{Code: ld, K: 0},\n\t\t{Code: jge, Jt: 0, Jf: 1, K: x32SyscallBit},\n\t\t{Code: ret, K: deny},\n\t}\n\t//the guarded syscalls jump to the check of the code, the others are allowed\n\tguarded := append([]uint32{syscall.SYS_SOCKET}, syscalls...)\n\tfor i, nr := range guarded {\n\t\tfilter = append(filter, syscall.SockFilter{Code: jeq, Jt: uint8(len(guarded) - i), Jf: 0, K: nr})\n\t}\n\tfilter = append(filter, []syscall.SockFilter{\n\t\t{Code: ret, K: seccompRetAllow},\n\t\t//seccomp_data.instruction_pointer, the syscalls of the other code are allowed\n\t\t{Code: ld, K: 12},\n\t\t{Code: jeq, Jt: 0, Jf: 8, K: uint32(start >> 32)},\n\t\t{Code: ld, K: 8},\n\t\t{Code: jge, Jt: 0, Jf: 6, K: uint32(start)},\n\t\t{Code: jgt, Jt: 5, Jf: 0, K: uint32(end)},\n\t\t//seccomp_data.args[0] of socket, the socket domain, the file syscalls are denied\n\t\t{Code: ld, K: 0},\n\t\t{Code: jeq, Jt: 0, Jf: 2, K: syscall.SYS_SOCKET},\n\t\t{Code: ld, K: 16},\n\t\t{Code: jeq, Jt: 1, Jf: 0, K: syscall.AF_UNIX},\n\t\t{Code: ret, K: deny},\n\t\t{Code: ret, K: seccompRetAllow},\n\t}...)\n\treturn filter\n}\n\nfunc installSeccomp() error {\n\tvar arch uint32\n\tvar sysSeccomp uintptr\n\tswitch runtime.GOARCH {\n\tcase \"amd64\":\n\t\tarch, sysSeccomp = auditArchX8664, sysSeccompAmd64\n\tcase \"arm64\":\n\t\tarch, sysSeccomp = auditArchAarch64, sysSeccompArm64\n\tdefault:\n\t\treturn fmt.Errorf(\"unsupported architecture %s\", runtime.GOARCH)\n\t}\n\tvar text [2]C.uintptr_t\n\tif C.plgo_text_range(&text[0]) == 0 {\n\t\treturn errors.New(\"cannot find the code of the extension\")\n\t}\n\tstart, end := uint64(text[0]), uint64(text[1])-1\n\t//the instruction pointer is compared by its words, the code must not cross an 4 GiB boundary\n\tif start>>32 != end>>32 {\n\t\treturn errors.New(\"the code of the extension crosses an 4 GiB boundary\")\n\t}\n\tfilter := seccompFilter(arch, fileSyscalls[runtime.GOARCH], start, end)\n\tprogram := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}\n\tif _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {\n\t\treturn errno\n\t}\n\t_, _, errno := syscall.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&program)))\n\truntime.KeepAlive(filter)\n\tif errno != 0 {\n\t\treturn errno\n\t}\n\treturn nil\n}\n",
+	"secrets.go":         "package plgo\n\nimport (\n\t\"bufio\"\n\t\"bytes\"\n\t\"fmt\"\n\t\"os\"\n\t\"strings\"\n\t\"time\"\n)\n\n//redacted replaces the secrets in the printed and logged values\nconst redacted = \"[REDACTED]\"\n\n//Secret is an secret value like an API key, it is redacted when printed, formatted into an error or logged,\n//use Value to get the secret itself\ntype Secret string\n\n//Value returns the secret\nfunc (s Secret) Value() string {\n\treturn string(s)\n}\n\n//String returns the redacted placeholder\nfunc (s Secret) String() string {\n\treturn redacted\n}\n\n//GoString returns the redacted placeholder\nfunc (s Secret) GoString() string {\n\treturn redacted\n}\n\n//Format writes the redacted placeholder for all verbs\nfunc (s Secret) Format(f fmt.State, verb rune) {\n\tf.Write([]byte(redacted))\n}\n\n//MarshalJSON encodes the redacted placeholder\nfunc (s Secret) MarshalJSON() ([]byte, error) {\n\treturn []byte(`\"` + redacted + `\"`), nil\n}\n\n//secretSettings are the settings declared with DeclareSecret by the secret names\nvar secretSettings = map[string]*stringGUC{}\n\n//credentialsFile is <extension>.credentials_file\nvar credentialsFile = newStringGUC(gucDesc{\n\tname:      \"credentials_file\",\n\tshortDesc: \"Sets the file with the secrets of the extension.\",\n\tlongDesc:  \"The file has name=value lines and must be owned by root or the server user and not accessible by others.\",\n\tcontext:   gucSighup,\n\tflags:     gucSuperuserOnly,\n}, \"\")\n\n//DeclareSecret defines the superuser-only setting <extension>.<name> holding an secret,\n//it can be set only in postgresql.conf, so the secret isn't written into the statement log.\n//It must be called from an init() function of the package\nfunc DeclareSecret(name, description string) {\n\tsecretSettings[name] = newStringGUC(gucDesc{\n\t\tname:      name,\n\t\tshortDesc: description,\n\t\tcontext:   gucSighup,\n\t\tflags:     gucSuperuserOnly,\n\t}, \"\")\n}\n\n//GetSecret returns the secret from the setting declared with DeclareSecret,\n//or if it is not set, from the <extension>.credentials_file.\n//The returned secrets are also redacted from the lines written by the Logger\nfunc GetSecret(name string) (Secret, error) {\n\tif setting, ok := secretSettings[name]; ok {\n\t\tif value := setting.get(); value != \"\" {\n\t\t\trememberSecret(value)\n\t\t\treturn Secret(value), nil\n\t\t}\n\t}\n\tpath := credentialsFile.get()\n\tif path == \"\" {\n\t\treturn \"\", fmt.Errorf(\"Secret %s is not set\", name)\n\t}\n\tcredentials, err := readCredentials(path)\n\tif err != nil {\n\t\treturn \"\", err\n\t}\n\tvalue, ok := credentials[name]\n\tif !ok {\n\t\treturn \"\", fmt.Errorf(\"Secret %s is not set in %s\", name, path)\n\t}\n\trememberSecret(value)\n\treturn Secret(value), nil\n}\n\n//credentialsCache is the last read credentials file, it is read again when it changes\nvar credentialsCache struct {\n\tpath    string\n\tmodTime time.Time\n\tsize    int64\n\tvalues  map[string]string\n}\n\nfunc readCredentials(path string) (map[string]string, error) {\n\tinfo, err := os.Stat(path)\n\tif err != nil {\n\t\treturn nil, fmt.Errorf(\"Cannot read credentials file: %w\", err)\n\t}\n\tif credentialsCache.values != nil && credentialsCache.path == path &&\n\t\tcredentialsCache.modTime.Equal(info.ModTime()) && credentialsCache.size == info.Size() {\n\t\treturn credentialsCache.values, nil\n\t}\n\tif err := checkCredentialsPermissions(path, info); err != nil {\n\t\treturn nil, err\n\t}\n\tdata, err := os.ReadFile(path)\n\tif err != nil {\n\t\treturn nil, fmt.Errorf(\"Cannot read credentials file: %w\", err)\n\t}\n\tvalues := make(map[string]string)\n\tscanner := bufio.NewScanner(bytes.NewReader(data))\n\tfor scanner.Scan() {\n\t\tline := strings.TrimSpace(scanner.Text())\n\t\tif line == \"\" || strings.HasPrefix(line, \"#\") {\n\t\t\tcontinue\n\t\t}\n\t\tname, value, ok := strings.Cut(line, \"=\")\n\t\tif !ok {\n\t\t\tcontinue\n\t\t}\n\t\tvalues[strings.TrimSpace(name)] = strings.TrimSpace(value)\n\t}\n\tcredentialsCache.path = path\n\tcredentialsCache.modTime = info.ModTime()\n\tcredentialsCache.size = info.Size()\n\tcredentialsCache.values = values\n\treturn values, nil\n}\n\n//knownSecrets are the secrets returned by GetSecret in this backend\nvar knownSecrets = map[string]bool{}\n\nfunc rememberSecret(value string) {\n\t//too short values would redact random parts of the log lines\n\tif len(value) >= 4 {\n\t\tknownSecrets[value] = true\n\t}\n}\n\n//RedactSecrets replaces the secrets returned by GetSecret in the string, e.g. in the error of an external API\nfunc RedactSecrets(s string) string {\n\tfor secret := range knownSecrets {\n\t\ts = strings.ReplaceAll(s, secret, redacted)\n\t}\n\treturn s\n}\n",
+	"secrets_unix.go":    "//go:build !windows\n\npackage plgo\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\t\"syscall\"\n)\n\n//checkCredentialsPermissions accepts the same ownership as the server for its ssl key:\n//owned by the server user and accessible only by it, or owned by root and readable by its group\nfunc checkCredentialsPermissions(path string, info os.FileInfo) error {\n\tstat, ok := info.Sys().(*syscall.Stat_t)\n\tif !ok {\n\t\treturn nil\n\t}\n\tmode := info.Mode().Perm()\n\tswitch {\n\tcase int(stat.Uid) == os.Getuid() && mode&0077 == 0:\n\t\treturn nil\n\tcase stat.Uid == 0 && mode&0037 == 0:\n\t\treturn nil\n\t}\n\treturn fmt.Errorf(\"Credentials file %s has group or world access or wrong owner, \"+\n\t\t\"it must be owned by the server user (mode 0600) or by root (mode 0640)\", path)\n}\n",
+	"secrets_windows.go": "package plgo\n\nimport \"os\"\n\n//checkCredentialsPermissions doesn't check the file ACLs on windows\nfunc checkCredentialsPermissions(path string, info os.FileInfo) error {\n\treturn nil\n}\n",
+	"session.go":         "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"miscadmin.h\"\n#include \"commands/dbcommands.h\"\n#include \"utils/guc.h\"\n\nOid plgo_user_id(void) {\n\treturn GetUserId();\n}\n\nOid plgo_session_user_id(void) {\n\treturn GetSessionUserId();\n}\n\nOid plgo_database_id(void) {\n\treturn MyDatabaseId;\n}\n\n//plgo_user_name returns the name of the role, NULL if it doesn't exist\nchar *plgo_user_name(Oid roleid) {\n\treturn GetUserNameFromId(roleid, true);\n}\n\nconst char *plgo_application_name(void) {\n\treturn GetConfigOption(\"application_name\", true, false);\n}\n*/\nimport \"C\"\nimport \"unsafe\"\n\n//Session describes the current session, the roles checking the privileges and the database\ntype Session struct {\n\t//UserID and User are the current role (current_user), it changes in the SECURITY DEFINER functions and with SET ROLE\n\tUserID Oid\n\tUser   string\n\t//SessionUserID and SessionUser are the role of the session (session_user)\n\tSessionUserID Oid\n\tSessionUser   string\n\tDatabaseID    Oid\n\tDatabase      string\n\t//ApplicationName is the application_name of the client\n\tApplicationName string\n\t//PID is the process id of the backend, pg_backend_pid()\n\tPID int\n}\n\n//SessionInfo returns the current session, without an SPI query, e.g. for auditing or row filtering\nfunc SessionInfo() Session {\n\ts := Session{\n\t\tUserID:        Oid(C.plgo_user_id()),\n\t\tSessionUserID: Oid(C.plgo_session_user_id()),\n\t\tDatabaseID:    Oid(C.plgo_database_id()),\n\t\tPID:           int(C.MyProcPid),\n\t}\n\ts.User = roleName(s.UserID)\n\ts.SessionUser = roleName(s.SessionUserID)\n\tif database := C.get_database_name(C.Oid(s.DatabaseID)); database != nil {\n\t\ts.Database = C.GoString(database)\n\t\tC.pfree(unsafe.Pointer(database))\n\t}\n\tif name := C.plgo_application_name(); name != nil {\n\t\ts.ApplicationName = C.GoString(name)\n\t}\n\treturn s\n}\n\n//roleName returns the name of the role, \"\" if it was dropped\nfunc roleName(id Oid) string {\n\tname := C.plgo_user_name(C.Oid(id))\n\tif name == nil {\n\t\treturn \"\"\n\t}\n\tdefer C.pfree(unsafe.Pointer(name))\n\treturn C.GoString(name)\n}\n",
+	"shared.go":          "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"miscadmin.h\"\n#include \"storage/ipc.h\"\n#include \"storage/lwlock.h\"\n#include \"storage/shmem.h\"\n#include \"utils/dsa.h\"\n#include \"utils/memutils.h\"\n#include \"lib/dshash.h\"\n#if PG_VERSION_NUM >= 170000\n#include \"storage/dsm_registry.h\"\n\n// the named DSM segments have NAMEDATALEN long names\n#define PLGO_SHMEM_NAMELEN 64\n#else\n#define PLGO_SHMEM_NAMELEN SHMEM_INDEX_KEYSIZE\n// PLGO_SHMEM_RESERVE is the shared memory reserved at preload for the control structs of the shared areas and the cache\n#define PLGO_SHMEM_RESERVE (32 * 1024)\n#endif\n\n#define PLGO_SHARED_KEYLEN 64\n\nextern bool plgo_preloading(void);\n\ntypedef struct plgo_shared_entry {\n\tchar key[PLGO_SHARED_KEYLEN];\n\tint64 counter;\n\tdsa_pointer value;\n\tSize value_len;\n} plgo_shared_entry;\n\ntypedef struct plgo_shared_control {\n\tbool initialized;\n\tint refcount;\n\tint tranche_id;\n\tdsa_handle area;\n\tdshash_table_handle table;\n} plgo_shared_control;\n\ntypedef struct plgo_shared_map {\n\tplgo_shared_control *control;\n\tdsa_area *area;\n\tdshash_table *table;\n} plgo_shared_map;\n\nstatic void plgo_shared_params(dshash_parameters *params, int tranche_id) {\n\tMemSet(params, 0, sizeof(dshash_parameters));\n\tparams->key_size = PLGO_SHARED_KEYLEN;\n\tparams->entry_size = sizeof(plgo_shared_entry);\n\tparams->compare_function = dshash_memcmp;\n\tparams->hash_function = dshash_memhash;\n#if PG_VERSION_NUM >= 170000\n\tparams->copy_function = dshash_memcpy;\n#endif\n\tparams->tranche_id = tranche_id;\n}\n\nstatic void plgo_shared_key(char *dst, char *key) {\n\tMemSet(dst, 0, PLGO_SHARED_KEYLEN);\n\tstrlcpy(dst, key, PLGO_SHARED_KEYLEN);\n}\n\n// plgo_shared_detach drops the backend's reference to the area, the last\n// backend marks the control struct as uninitialized, because the DSM segment\n// is destroyed together with its last mapping\nstatic void plgo_shared_detach(int code, Datum arg) {\n\tplgo_shared_control *control = (plgo_shared_control *) DatumGetPointer(arg);\n\tLWLockAcquire(AddinShmemInitLock, LW_EXCLUSIVE);\n\tif (--control->refcount == 0)\n\t\tcontrol->initialized = false;\n\tLWLockRelease(AddinShmemInitLock);\n}\n\n#if PG_VERSION_NUM >= 150000 && PG_VERSION_NUM < 170000\nstatic shmem_request_hook_type plgo_prev_shmem_request_hook = NULL;\n\nstatic void plgo_shmem_request(void) {\n\tif (plgo_prev_shmem_request_hook)\n\t\tplgo_prev_shmem_request_hook();\n\tRequestAddinShmemSpace(PLGO_SHMEM_RESERVE);\n}\n#endif\n\n// plgo_shmem_reserve reserves the shared memory for the control structs, it's called from _PG_init of the preloaded library.\n// The named DSM segments need no reservation\nvoid plgo_shmem_reserve(void) {\n#if PG_VERSION_NUM >= 150000 && PG_VERSION_NUM < 170000\n\tplgo_prev_shmem_request_hook = shmem_request_hook;\n\tshmem_request_hook = plgo_shmem_request;\n#elif PG_VERSION_NUM < 150000\n\tRequestAddinShmemSpace(PLGO_SHMEM_RESERVE);\n#endif\n}\n\n// plgo_shmem_init_struct finds or allocates the named control struct, the caller holds AddinShmemInitLock.\n// Since PostgreSQL 17 the struct is in an named DSM segment, the older versions allocate it from the spare main\n// shared memory, which is enlarged by plgo_shmem_reserve when the library is preloaded\nvoid *plgo_shmem_init_struct(char *name, Size size, bool *found) {\n#if PG_VERSION_NUM >= 170000\n\treturn GetNamedDSMSegment(name, size, NULL, found);\n#else\n\treturn ShmemInitStruct(name, size, found);\n#endif\n}\n\n// plgo_shared_attach attaches the area, shmem_name fits into PLGO_SHMEM_NAMELEN\nplgo_shared_map *plgo_shared_attach(char *shmem_name) {\n\tbool found;\n\tdshash_parameters params;\n\tplgo_shared_control *control;\n\tplgo_shared_map *map;\n\tMemoryContext old = MemoryContextSwitchTo(TopMemoryContext);\n\n\tmap = palloc0(sizeof(plgo_shared_map));\n\tLWLockAcquire(AddinShmemInitLock, LW_EXCLUSIVE);\n\tcontrol = plgo_shmem_init_struct(shmem_name, sizeof(plgo_shared_control), &found);\n\tif (!found) {\n\t\tcontrol->initialized = false;\n\t\tcontrol->refcount = 0;\n\t\tcontrol->tranche_id = LWLockNewTrancheId();\n\t}\n\tLWLockRegisterTranche(control->tranche_id, \"plgo_shared\");\n\tplgo_shared_params(&params, control->tranche_id);\n\tif (!control->initialized) {\n\t\tmap->area = dsa_create(control->tranche_id);\n\t\tmap->table = dshash_create(map->area, &params, NULL);\n\t\tcontrol->area = dsa_get_handle(map->area);\n\t\tcontrol->table = dshash_get_hash_table_handle(map->table);\n\t\tcontrol->initialized = true;\n\t} else {\n\t\tmap->area = dsa_attach(control->area);\n\t\tmap->table = dshash_attach(map->area, &params, control->table, NULL);\n\t}\n\tdsa_pin_mapping(map->area);\n\tcontrol->refcount++;\n\tmap->control = control;\n\tLWLockRelease(AddinShmemInitLock);\n\tbefore_shmem_exit(plgo_shared_detach, PointerGetDatum(control));\n\tMemoryContextSwitchTo(old);\n\treturn map;\n}\n\nplgo_shared_entry *plgo_shared_find(plgo_shared_map *map, char *key, bool exclusive) {\n\tchar keybuf[PLGO_SHARED_KEYLEN];\n\tplgo_shared_key(keybuf, key);\n\treturn dshash_find(map->table, keybuf, exclusive);\n}\n\nplgo_shared_entry *plgo_shared_find_or_insert(plgo_shared_map *map, char *key) {\n\tchar keybuf[PLGO_SHARED_KEYLEN];\n\tbool found;\n\tplgo_shared_entry *entry;\n\tplgo_shared_key(keybuf, key);\n\tentry = dshash_find_or_insert(map->table, keybuf, &found);\n\tif (!found) {\n\t\tentry->counter = 0;\n\t\tentry->value = InvalidDsaPointer;\n\t\tentry->value_len = 0;\n\t}\n\treturn entry;\n}\n\nvoid plgo_shared_release(plgo_shared_map *map, plgo_shared_entry *entry) {\n\tdshash_release_lock(map->table, entry);\n}\n\nvoid *plgo_shared_value(plgo_shared_map *map, plgo_shared_entry *entry) {\n\tif (!DsaPointerIsValid(entry->value))\n\t\treturn NULL;\n\treturn dsa_get_address(map->area, entry->value);\n}\n\nvoid plgo_shared_set_value(plgo_shared_map *map, plgo_shared_entry *entry, void *value, Size len) {\n\tif (DsaPointerIsValid(entry->value))\n\t\tdsa_free(map->area, entry->value);\n\tentry->value = dsa_allocate(map->area, len > 0 ? len : 1);\n\tmemcpy(dsa_get_address(map->area, entry->value), value, len);\n\tentry->value_len = len;\n}\n\nbool plgo_shared_delete(plgo_shared_map *map, char *key) {\n\tplgo_shared_entry *entry = plgo_shared_find(map, key, true);\n\tif (entry == NULL)\n\t\treturn false;\n\tif (DsaPointerIsValid(entry->value))\n\t\tdsa_free(map->area, entry->value);\n\tdshash_delete_entry(map->table, entry);\n\treturn true;\n}\n\n// plgo_shared_keys returns palloc'd array of the keys in the table\nchar **plgo_shared_keys(plgo_shared_map *map, int *count) {\n\tdshash_seq_status status;\n\tplgo_shared_entry *entry;\n\tint size = 16;\n\tchar **keys = palloc(sizeof(char *) * size);\n\t*count = 0;\n\tdshash_seq_init(&status, map->table, false);\n\twhile ((entry = dshash_seq_next(&status)) != NULL) {\n\t\tif (*count == size) {\n\t\t\tsize *= 2;\n\t\t\tkeys = repalloc(keys, sizeof(char *) * size);\n\t\t}\n\t\tkeys[(*count)++] = pstrdup(entry->key);\n\t}\n\tdshash_seq_term(&status);\n\treturn keys;\n}\n\nchar *plgo_shared_key_at(char **keys, int i) {\n\treturn keys[i];\n}\n*/\nimport \"C\"\nimport (\n\t\"encoding/json\"\n\t\"fmt\"\n\t\"unsafe\"\n)\n\nfunc init() {\n\tonInit(func() {\n\t\tif C.plgo_preloading() == (C._Bool)(true) {\n\t\t\tC.plgo_shmem_reserve()\n\t\t}\n\t})\n}\n\n//shmemName returns the name of the shared memory control struct of an shared area or the cache,\n//the names that don't fit into the shared memory index (into the DSM registry since PostgreSQL 17) are rejected\nfunc shmemName(prefix, name string) (*C.char, error) {\n\tshmem := prefix + name\n\tif len(shmem) >= C.PLGO_SHMEM_NAMELEN {\n\t\treturn nil, fmt.Errorf(\"Shared memory name %q must be shorter than %d bytes\", shmem, C.PLGO_SHMEM_NAMELEN)\n\t}\n\treturn C.CString(shmem), nil\n}\n\n//sharedKeyLen is the maximum length of an key in shared area (including the terminating zero byte)\nconst sharedKeyLen = 64\n\n//SharedArea is a named hash table in dynamic shared memory, that is visible to all backends.\n//The area is created by the first backend that attaches it\n//and lives until the last attached backend exits (it's tied to the DSM segment)\ntype SharedArea struct {\n\tname string\n\tm    *C.plgo_shared_map\n}\n\nvar sharedAreas = make(map[string]*SharedArea)\n\n//AttachSharedArea attaches to the named shared area, it creates the area if it doesn't exist yet.\n//The area stays attached until the backend exits\nfunc AttachSharedArea(name string) (*SharedArea, error) {\n\tif area, ok := sharedAreas[name]; ok {\n\t\treturn area, nil\n\t}\n\tif name == \"\" {\n\t\treturn nil, fmt.Errorf(\"Shared area name can't be empty\")\n\t}\n\tcname, err := shmemName(\"plgo shared \", name)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tdefer C.free(unsafe.Pointer(cname))\n\tarea := &SharedArea{name: name, m: C.plgo_shared_attach(cname)}\n\tsharedAreas[name] = area\n\treturn area, nil\n}\n\n//Name returns the name of the shared area\nfunc (a *SharedArea) Name() string {\n\treturn a.name\n}\n\nfunc sharedKey(key string) (*C.char, error) {\n\tif len(key) == 0 || len(key) >= sharedKeyLen {\n\t\treturn nil, fmt.Errorf(\"Shared area key must be 1 to %d bytes long: %q\", sharedKeyLen-1, key)\n\t}\n\treturn C.CString(key), nil\n}\n\n//Add atomically adds delta to the counter stored under the key and returns the new value\nfunc (a *SharedArea) Add(key string, delta int64) (int64, error) {\n\tckey, err := sharedKey(key)\n\tif err != nil {\n\t\treturn 0, err\n\t}\n\tdefer C.free(unsafe.Pointer(ckey))\n\tentry := C.plgo_shared_find_or_insert(a.m, ckey)\n\tentry.counter += C.int64(delta)\n\tret := int64(entry.counter)\n\tC.plgo_shared_release(a.m, entry)\n\treturn ret, nil\n}\n\n//Counter returns the counter stored under the key\nfunc (a *SharedArea) Counter(key string) (int64, error) {\n\tckey, err := sharedKey(key)\n\tif err != nil {\n\t\treturn 0, err\n\t}\n\tdefer C.free(unsafe.Pointer(ckey))\n\tentry := C.plgo_shared_find(a.m, ckey, (C._Bool)(false))\n\tif entry == nil {\n\t\treturn 0, nil\n\t}\n\tret := int64(entry.counter)\n\tC.plgo_shared_release(a.m, entry)\n\treturn ret, nil\n}\n\n//Get returns a copy of the value stored under the key\nfunc (a *SharedArea) Get(key string) ([]byte, bool, error) {\n\tckey, err := sharedKey(key)\n\tif err != nil {\n\t\treturn nil, false, err\n\t}\n\tdefer C.free(unsafe.Pointer(ckey))\n\tentry := C.plgo_shared_find(a.m, ckey, (C._Bool)(false))\n\tif entry == nil {\n\t\treturn nil, false, nil\n\t}\n\tdefer C.plgo_shared_release(a.m, entry)\n\tvalue := C.plgo_shared_value(a.m, entry)\n\tif value == nil {\n\t\treturn nil, false, nil\n\t}\n\treturn C.GoBytes(value, C.int(entry.value_len)), true, nil\n}\n\n//Set stores the value under the key\nfunc (a *SharedArea) Set(key string, value []byte) error {\n\treturn a.Update(key, func(old []byte, ok bool) []byte {\n\t\treturn value\n\t})\n}\n\n//Update replaces the value stored under the key with the result of fn,\n//the entry is locked while fn runs, so the update is atomic across backends.\n//fn must not access the same shared area\nfunc (a *SharedArea) Update(key string, fn func(old []byte, ok bool) []byte) error {\n\tckey, err := sharedKey(key)\n\tif err != nil {\n\t\treturn err\n\t}\n\tdefer C.free(unsafe.Pointer(ckey))\n\tentry := C.plgo_shared_find_or_insert(a.m, ckey)\n\tdefer C.plgo_shared_release(a.m, entry)\n\tvar old []byte\n\tvalue := C.plgo_shared_value(a.m, entry)\n\tif value != nil {\n\t\told = C.GoBytes(value, C.int(entry.value_len))\n\t}\n\tnewValue := fn(old, value != nil)\n\tvar p unsafe.Pointer\n\tif len(newValue) > 0 {\n\t\tp = C.CBytes(newValue)\n\t\tdefer C.free(p)\n\t}\n\tC.plgo_shared_set_value(a.m, entry, p, C.Size(len(newValue)))\n\treturn nil\n}\n\n//Delete removes the key (with its counter and value) from the area, returns false if it wasn't there\nfunc (a *SharedArea) Delete(key string) (bool, error) {\n\tckey, err := sharedKey(key)\n\tif err != nil {\n\t\treturn false, err\n\t}\n\tdefer C.free(unsafe.Pointer(ckey))\n\treturn C.plgo_shared_delete(a.m, ckey) == (C._Bool)(true), nil\n}\n\n//Keys returns all keys stored in the area\nfunc (a *SharedArea) Keys() []string {\n\tvar count C.int\n\tckeys := C.plgo_shared_keys(a.m, &count)\n\tkeys := make([]string, int(count))\n\tfor i := range keys {\n\t\tckey := C.plgo_shared_key_at(ckeys, C.int(i))\n\t\tkeys[i] = C.GoString(ckey)\n\t\tC.pfree(unsafe.Pointer(ckey))\n\t}\n\tC.pfree(unsafe.Pointer(ckeys))\n\treturn keys\n}\n\n//SharedMap is a typed view of a SharedArea, values are stored JSON encoded\ntype SharedMap[V any] struct {\n\tarea *SharedArea\n}\n\n//NewSharedMap attaches to the named shared area and returns it as a typed map\nfunc NewSharedMap[V any](name string) (*SharedMap[V], error) {\n\tarea, err := AttachSharedArea(name)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\treturn &SharedMap[V]{area: area}, nil\n}\n\n//Area returns the underlying SharedArea\nfunc (m *SharedMap[V]) Area() *SharedArea {\n\treturn m.area\n}\n\n//Load returns the value stored under the key\nfunc (m *SharedMap[V]) Load(key string) (V, bool, error) {\n\tvar v V\n\tdata, ok, err := m.area.Get(key)\n\tif err != nil || !ok {\n\t\treturn v, ok, err\n\t}\n\treturn v, true, json.Unmarshal(data, &v)\n}\n\n//Store stores the value under the key\nfunc (m *SharedMap[V]) Store(key string, v V) error {\n\tdata, err := json.Marshal(v)\n\tif err != nil {\n\t\treturn err\n\t}\n\treturn m.area.Set(key, data)\n}\n\n//Update atomically replaces the value under the key with the result of fn,\n//ok is false if there was no value stored\nfunc (m *SharedMap[V]) Update(key string, fn func(v V, ok bool) V) (V, error) {\n\tvar ret V\n\tvar fnErr error\n\terr := m.area.Update(key, func(old []byte, ok bool) []byte {\n\t\tvar v V\n\t\tif ok {\n\t\t\tif fnErr = json.Unmarshal(old, &v); fnErr != nil {\n\t\t\t\treturn old\n\t\t\t}\n\t\t}\n\t\tret = fn(v, ok)\n\t\tvar data []byte\n\t\tif data, fnErr = json.Marshal(ret); fnErr != nil {\n\t\t\treturn old\n\t\t}\n\t\treturn data\n\t})\n\tif err != nil {\n\t\treturn ret, err\n\t}\n\treturn ret, fnErr\n}\n\n//Delete removes the key from the map\nfunc (m *SharedMap[V]) Delete(key string) (bool, error) {\n\treturn m.area.Delete(key)\n}\n\n//Keys returns all keys in the map\nfunc (m *SharedMap[V]) Keys() []string {\n\treturn m.area.Keys()\n}\n",
+	"slog.go":            "//go:build go1.21\n\npackage plgo\n\nimport (\n\t\"context\"\n\t\"log/slog\"\n)\n\n//slogHandler is the slog.Handler writing the records with the structured Logger\ntype slogHandler struct {\n\tlevel  slog.Leveler\n\tlogger *Logger\n\t//prefix is the prefix of the keys in the open groups, e.g. \"request.\"\n\tprefix string\n}\n\n//NewSlogHandler returns an slog.Handler writing the records of the level and above into the PostgreSQL log as Log does,\n//e.g. slog.SetDefault(slog.New(plgo.NewSlogHandler(slog.LevelInfo))). The debug records are DEBUG1, the info records LOG\n//and the warnings WARNING, the error records are WARNING too, an ERROR would abort the transaction.\n//The records must be logged by the goroutine of the exported function, as the other PostgreSQL calls\nfunc NewSlogHandler(level slog.Leveler) slog.Handler {\n\tif level == nil {\n\t\tlevel = slog.LevelInfo\n\t}\n\treturn &slogHandler{level: level, logger: Log}\n}\n\n//slogLevel returns the elog level of the slog level\nfunc slogLevel(level slog.Level) LogLevel {\n\tswitch {\n\tcase level < slog.LevelInfo:\n\t\treturn LevelDebug\n\tcase level < slog.LevelWarn:\n\t\treturn LevelLog\n\tdefault:\n\t\treturn LevelWarning\n\t}\n}\n\nfunc (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {\n\treturn level >= h.level.Level() && slogLevel(level).Enabled()\n}\n\nfunc (h *slogHandler) Handle(_ context.Context, r slog.Record) error {\n\tkeyvals := make([]interface{}, 0, 2*r.NumAttrs())\n\tr.Attrs(func(a slog.Attr) bool {\n\t\tkeyvals = appendAttr(keyvals, h.prefix, a)\n\t\treturn true\n\t})\n\th.logger.write(slogLevel(r.Level), r.Message, keyvals)\n\treturn nil\n}\n\nfunc (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {\n\tvar keyvals []interface{}\n\tfor _, a := range attrs {\n\t\tkeyvals = appendAttr(keyvals, h.prefix, a)\n\t}\n\treturn &slogHandler{level: h.level, logger: h.logger.With(keyvals...), prefix: h.prefix}\n}\n\nfunc (h *slogHandler) WithGroup(name string) slog.Handler {\n\tif name == \"\" {\n\t\treturn h\n\t}\n\treturn &slogHandler{level: h.level, logger: h.logger, prefix: h.prefix + name + \".\"}\n}\n\n//appendAttr appends the key/value pair of the attribute, the groups are flattened into the keys group.key\nfunc appendAttr(keyvals []interface{}, prefix string, a slog.Attr) []interface{} {\n\ta.Value = a.Value.Resolve()\n\tif a.Equal(slog.Attr{}) {\n\t\treturn keyvals\n\t}\n\tif a.Value.Kind() == slog.KindGroup {\n\t\tif a.Key != \"\" {\n\t\t\tprefix += a.Key + \".\"\n\t\t}\n\t\tfor _, member := range a.Value.Group() {\n\t\t\tkeyvals = appendAttr(keyvals, prefix, member)\n\t\t}\n\t\treturn keyvals\n\t}\n\treturn append(keyvals, prefix+a.Key, a.Value.Any())\n}\n",
+	"srf.go":             "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"funcapi.h\"\n#include \"miscadmin.h\"\n#include \"access/tupdesc.h\"\n#include \"utils/tuplestore.h\"\n\nint plgo_srf_begin(FunctionCallInfo fcinfo) {\n\tReturnSetInfo *rsinfo = (ReturnSetInfo *) fcinfo->resultinfo;\n\tMemoryContext oldcontext;\n\tTupleDesc tupdesc;\n\tOid resulttype;\n\n\tif (rsinfo == NULL || !IsA(rsinfo, ReturnSetInfo))\n\t\tereport(ERROR, (errcode(ERRCODE_FEATURE_NOT_SUPPORTED),\n\t\t\t\t\t\terrmsg(\"set-valued function called in context that cannot accept a set\")));\n\tif (!(rsinfo->allowedModes & SFRM_Materialize))\n\t\tereport(ERROR, (errcode(ERRCODE_FEATURE_NOT_SUPPORTED),\n\t\t\t\t\t\terrmsg(\"materialize mode required, but it is not allowed in this context\")));\n\toldcontext = MemoryContextSwitchTo(rsinfo->econtext->ecxt_per_query_memory);\n\tswitch (get_call_result_type(fcinfo, &resulttype, &tupdesc)) {\n\tcase TYPEFUNC_COMPOSITE:\n\t\ttupdesc = CreateTupleDescCopy(tupdesc);\n\t\tbreak;\n\tcase TYPEFUNC_SCALAR:\n#if PG_VERSION_NUM >= 120000\n\t\ttupdesc = CreateTemplateTupleDesc(1);\n#else\n\t\ttupdesc = CreateTemplateTupleDesc(1, false);\n#endif\n\t\tTupleDescInitEntry(tupdesc, (AttrNumber) 1, \"value\", resulttype, -1, 0);\n\t\tbreak;\n\tdefault:\n\t\tereport(ERROR, (errcode(ERRCODE_FEATURE_NOT_SUPPORTED),\n\t\t\t\t\t\terrmsg(\"return type of the set returning function is not supported\")));\n\t}\n\trsinfo->returnMode = SFRM_Materialize;\n\trsinfo->setResult = tuplestore_begin_heap(rsinfo->allowedModes & SFRM_Materialize_Random, false, work_mem);\n\trsinfo->setDesc = tupdesc;\n\tMemoryContextSwitchTo(oldcontext);\n\treturn tupdesc->natts;\n}\n\nvoid plgo_srf_put(FunctionCallInfo fcinfo, Datum *values, bool *nulls) {\n\tReturnSetInfo *rsinfo = (ReturnSetInfo *) fcinfo->resultinfo;\n\ttuplestore_putvalues(rsinfo->setResult, rsinfo->setDesc, values, nulls);\n}\n*/\nimport \"C\"\nimport (\n\t\"context\"\n\t\"fmt\"\n\t\"reflect\"\n\t\"time\"\n\t\"unsafe\"\n)\n\n//setColumns returns the indexes of the struct fields that are the columns of the rows:\n//the exported fields without the `plgo:\"-\"` tag, in the order of the RETURNS TABLE columns\nfunc setColumns(t reflect.Type) []int {\n\tvar columns []int\n\tfor i := 0; i < t.NumField(); i++ {\n\t\tfield := t.Field(i)\n\t\tif field.PkgPath != \"\" || field.Anonymous || field.Tag.Get(\"plgo\") == \"-\" {\n\t\t\tcontinue\n\t\t}\n\t\tcolumns = append(columns, i)\n\t}\n\treturn columns\n}\n\n//setWriter writes the rows of an set returning function into its tuplestore\ntype setWriter struct {\n\tfcinfo  *C.struct_FunctionCallInfoBaseData\n\tcolumns []int\n\tvalues  []C.Datum\n\tnulls   []C.bool\n}\n\n//put writes the row, an struct for RETURNS TABLE or an scalar value for RETURNS SETOF\nfunc (s *setWriter) put(row reflect.Value) {\n\tvar values []reflect.Value\n\tif row.Kind() == reflect.Struct {\n\t\tif s.columns == nil {\n\t\t\ts.columns = setColumns(row.Type())\n\t\t}\n\t\tfor _, i := range s.columns {\n\t\t\tvalues = append(values, row.Field(i))\n\t\t}\n\t} else {\n\t\tvalues = []reflect.Value{row}\n\t}\n\tif len(values) != len(s.values) {\n\t\tLog.Error(fmt.Sprintf(\"Set returning function returned %d columns, but the result has %d\", len(values), len(s.values)))\n\t}\n\tfor i, value := range values {\n\t\t//the pointer fields are nullable\n\t\tif value.Kind() == reflect.Ptr {\n\t\t\tif value.IsNil() {\n\t\t\t\ts.values[i], s.nulls[i] = 0, (C._Bool)(true)\n\t\t\t\tcontinue\n\t\t\t}\n\t\t\tvalue = value.Elem()\n\t\t}\n\t\ts.values[i], s.nulls[i] = (C.Datum)(toDatum(value.Interface())), (C._Bool)(false)\n\t}\n\tC.plgo_srf_put(s.fcinfo, &s.values[0], &s.nulls[0])\n}\n\n//setContexts are the contexts passed to the running set returning functions, by the subtransaction of their call\nvar setContexts = make(map[*interruptWatcher]uint32)\n\n//setContext returns the context passed to an set returning function as its first parameter, its sending goroutine stops\n//when it's done: the context is canceled when the rows are returned, by an cancel of the query\n//or when the (sub)transaction of the call is aborted\nfunc setContext() (context.Context, *interruptWatcher) {\n\tctx, watcher := watchInterrupts(context.Background())\n\tsetContexts[watcher] = currentSubTransactionID()\n\treturn ctx, watcher\n}\n\n//stopSetContext cancels the context of the set returning function\nfunc stopSetContext(watcher *interruptWatcher) {\n\twatcher.stop()\n\tdelete(setContexts, watcher)\n}\n\nfunc init() {\n\t//an ERROR jumps out of returnSet without stopping the context\n\tonAbort(func(subID uint32) {\n\t\tfor watcher, watcherSubID := range setContexts {\n\t\t\tif subID == 0 || watcherSubID >= subID {\n\t\t\t\tstopSetContext(watcher)\n\t\t\t}\n\t\t}\n\t})\n}\n\n//returnSet materializes the rows returned by an set returning function into its result,\n//rows is an slice or an channel of structs (RETURNS TABLE) or of scalar values (RETURNS SETOF).\n//The channel is read until it is closed, an cancel of the query stops the reading.\n//watcher is the context of the function from setContext, or nil, it is canceled on return\nfunc returnSet(fcinfo *funcInfo, rows interface{}, watcher *interruptWatcher) Datum {\n\tif watcher != nil {\n\t\tdefer stopSetContext(watcher)\n\t}\n\tcfcinfo := (*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo))\n\tnatts := int(C.plgo_srf_begin(cfcinfo))\n\twriter := &setWriter{fcinfo: cfcinfo, values: make([]C.Datum, natts), nulls: make([]C.bool, natts)}\n\tvalue := reflect.ValueOf(rows)\n\tswitch value.Kind() {\n\tcase reflect.Slice:\n\t\tfor i := 0; i < value.Len(); i++ {\n\t\t\twriter.put(value.Index(i))\n\t\t}\n\tcase reflect.Chan:\n\t\tif value.IsNil() {\n\t\t\tbreak\n\t\t}\n\t\tticker := time.NewTicker(interruptPollInterval)\n\t\tcases := []reflect.SelectCase{\n\t\t\t{Dir: reflect.SelectRecv, Chan: value},\n\t\t\t{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ticker.C)},\n\t\t}\n\t\tfor {\n\t\t\tchosen, row, ok := reflect.Select(cases)\n\t\t\tif chosen == 1 {\n\t\t\t\tif interruptPending() {\n\t\t\t\t\tticker.Stop()\n\t\t\t\t\tLog.Error(ErrInterrupted.Error())\n\t\t\t\t}\n\t\t\t\tcontinue\n\t\t\t}\n\t\t\tif !ok {\n\t\t\t\tbreak\n\t\t\t}\n\t\t\twriter.put(row)\n\t\t}\n\t\tticker.Stop()\n\t}\n\treturn toDatum(nil)\n}\n",
+	"stats.go":           "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n*/\nimport \"C\"\nimport (\n\t\"math\"\n\t\"sort\"\n\t\"time\"\n)\n\n//statBuckets are the upper bounds (in milliseconds) of the latency histogram buckets,\n//the last bucket is unbounded\nvar statBuckets = [...]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, math.Inf(1)}\n\n//funcStat are the statistics of one exported function collected from all backends\ntype funcStat struct {\n\tCalls   int64                   `json:\"c\"`\n\tErrors  int64                   `json:\"e\"`\n\tTotalMs float64                 `json:\"t\"`\n\tMinMs   float64                 `json:\"min\"`\n\tMaxMs   float64                 `json:\"max\"`\n\tBuckets [len(statBuckets)]int64 `json:\"b\"`\n}\n\nfunc (s *funcStat) add(ms float64, failed bool) {\n\tif s.Calls == 0 || ms < s.MinMs {\n\t\ts.MinMs = ms\n\t}\n\tif ms > s.MaxMs {\n\t\ts.MaxMs = ms\n\t}\n\ts.Calls++\n\tif failed {\n\t\ts.Errors++\n\t}\n\ts.TotalMs += ms\n\tfor i, bound := range statBuckets {\n\t\tif ms <= bound {\n\t\t\ts.Buckets[i]++\n\t\t\tbreak\n\t\t}\n\t}\n}\n\n//merge adds the statistics collected by the backend\nfunc (s *funcStat) merge(local *funcStat) {\n\tif s.Calls == 0 || local.MinMs < s.MinMs {\n\t\ts.MinMs = local.MinMs\n\t}\n\tif local.MaxMs > s.MaxMs {\n\t\ts.MaxMs = local.MaxMs\n\t}\n\ts.Calls += local.Calls\n\ts.Errors += local.Errors\n\ts.TotalMs += local.TotalMs\n\tfor i, count := range local.Buckets {\n\t\ts.Buckets[i] += count\n\t}\n}\n\n//percentile returns the upper bound of the histogram bucket containing the q quantile\nfunc (s *funcStat) percentile(q float64) float64 {\n\tif s.Calls == 0 {\n\t\treturn 0\n\t}\n\trank := int64(math.Ceil(q * float64(s.Calls)))\n\tvar cumulative int64\n\tfor i, count := range s.Buckets {\n\t\tcumulative += count\n\t\tif cumulative >= rank {\n\t\t\tif math.IsInf(statBuckets[i], 1) {\n\t\t\t\treturn s.MaxMs\n\t\t\t}\n\t\t\treturn math.Min(statBuckets[i], s.MaxMs)\n\t\t}\n\t}\n\treturn s.MaxMs\n}\n\n//funcStatRow is one row of the <extension>_stat_functions view\ntype funcStatRow struct {\n\tFunction  string  `json:\"funcname\"`\n\tCalls     int64   `json:\"calls\"`\n\tErrors    int64   `json:\"errors\"`\n\tTotalTime float64 `json:\"total_time\"`\n\tMeanTime  float64 `json:\"mean_time\"`\n\tMinTime   float64 `json:\"min_time\"`\n\tMaxTime   float64 `json:\"max_time\"`\n\tP50Time   float64 `json:\"p50_time\"`\n\tP95Time   float64 `json:\"p95_time\"`\n\tP99Time   float64 `json:\"p99_time\"`\n}\n\n//pendingErrors are the calls aborted by an ERROR, they are recorded with the next call,\n//because the shared memory can't be safely used while the transaction is aborting\nvar pendingErrors []*funcCall\n\n//statFlushInterval is how often the statistics collected by the backend are added to the shared ones\nconst statFlushInterval = time.Second\n\n//localStats are the statistics of the backend not yet added to the shared ones\nvar localStats = make(map[string]*funcStat)\n\nvar lastStatFlush time.Time\n\n//statsMap returns the shared statistics of the extension\nfunc statsMap() (*SharedMap[funcStat], error) {\n\treturn NewSharedMap[funcStat](extensionName + \" stats\")\n}\n\n//recordStat adds the call to the statistics of the backend, they are added to the shared statistics\n//at most once per statFlushInterval, so the calls don't lock the shared entries\nfunc recordStat(call *funcCall, duration time.Duration, failed bool) {\n\ts, ok := localStats[call.name]\n\tif !ok {\n\t\ts = &funcStat{}\n\t\tlocalStats[call.name] = s\n\t}\n\ts.add(float64(duration)/float64(time.Millisecond), failed)\n\tif time.Since(lastStatFlush) >= statFlushInterval {\n\t\tflushStats()\n\t}\n}\n\n//flushStats adds the statistics of the backend to the shared statistics\nfunc flushStats() {\n\tlastStatFlush = time.Now()\n\tif len(localStats) == 0 {\n\t\treturn\n\t}\n\tstats, err := statsMap()\n\tif err != nil {\n\t\treturn\n\t}\n\tfor name, local := range localStats {\n\t\tstats.Update(name, func(s funcStat, ok bool) funcStat {\n\t\t\ts.merge(local)\n\t\t\treturn s\n\t\t})\n\t}\n\tlocalStats = make(map[string]*funcStat)\n}\n\n//flushPendingErrors records the calls aborted by an ERROR\nfunc flushPendingErrors() {\n\terrors := pendingErrors\n\tpendingErrors = nil\n\tfor _, call := range errors {\n\t\trecordStat(call, call.aborted.Sub(call.start), true)\n\t}\n}\n\nfunc statRows() []funcStatRow {\n\tflushStats()\n\tstats, err := statsMap()\n\tif err != nil {\n\t\treturn nil\n\t}\n\trows := []funcStatRow{}\n\tfor _, name := range stats.Keys() {\n\t\ts, ok, err := stats.Load(name)\n\t\tif err != nil || !ok {\n\t\t\tcontinue\n\t\t}\n\t\trow := funcStatRow{\n\t\t\tFunction:  name,\n\t\t\tCalls:     s.Calls,\n\t\t\tErrors:    s.Errors,\n\t\t\tTotalTime: s.TotalMs,\n\t\t\tMinTime:   s.MinMs,\n\t\t\tMaxTime:   s.MaxMs,\n\t\t\tP50Time:   s.percentile(0.50),\n\t\t\tP95Time:   s.percentile(0.95),\n\t\t\tP99Time:   s.percentile(0.99),\n\t\t}\n\t\tif s.Calls > 0 {\n\t\t\trow.MeanTime = s.TotalMs / float64(s.Calls)\n\t\t}\n\t\trows = append(rows, row)\n\t}\n\tsort.Slice(rows, func(i, j int) bool { return rows[i].Function < rows[j].Function })\n\treturn rows\n}\n\n//export plgo_stat_functions\nfunc plgo_stat_functions(fcinfo *funcInfo) Datum {\n\treturn jsonbDatum(statRows())\n}\n\n//export plgo_stat_reset\nfunc plgo_stat_reset(fcinfo *funcInfo) Datum {\n\tlocalStats = make(map[string]*funcStat)\n\tif stats, err := statsMap(); err == nil {\n\t\tfor _, name := range stats.Keys() {\n\t\t\tstats.Delete(name)\n\t\t}\n\t}\n\treturn toDatum(nil)\n}\n",
+	"subtx.go":           "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"access/xact.h\"\n#include \"executor/spi.h\"\n#include \"utils/elog.h\"\n#include \"utils/memutils.h\"\n#include \"utils/resowner.h\"\n\nMemoryContext plgo_current_memory_context(void) {\n\treturn CurrentMemoryContext;\n}\n\nResourceOwner plgo_current_resource_owner(void) {\n\treturn CurrentResourceOwner;\n}\n\n//plgo_subtx_begin starts an subtransaction, the memory context is kept\nvoid plgo_subtx_begin(void) {\n\tMemoryContext oldcontext = CurrentMemoryContext;\n\n\tBeginInternalSubTransaction(NULL);\n\tMemoryContextSwitchTo(oldcontext);\n}\n\n//plgo_subtx_end releases or rolls back the subtransaction, the memory context and the resource owner\n//of the code that started it are restored\nvoid plgo_subtx_end(bool release, MemoryContext oldcontext, ResourceOwner oldowner) {\n\tif (release)\n\t\tReleaseCurrentSubTransaction();\n\telse\n\t\tRollbackAndReleaseCurrentSubTransaction();\n\tMemoryContextSwitchTo(oldcontext);\n\tCurrentResourceOwner = oldowner;\n}\n\n//plgo_catch copies the caught ERROR into edata, the canceled query is thrown again\nstatic void plgo_catch(MemoryContext oldcontext, ErrorData **edata) {\n\tErrorData *copy;\n\n\tMemoryContextSwitchTo(oldcontext);\n\tcopy = CopyErrorData();\n\tif (copy->sqlerrcode == ERRCODE_QUERY_CANCELED)\n\t{\n\t\tFreeErrorData(copy);\n\t\tPG_RE_THROW();\n\t}\n\tFlushErrorState();\n\t*edata = copy;\n}\n\n//plgo_execute_plan_catch executes the plan as SPI_execute_plan, its ERROR is caught and copied into edata,\n//the canceled query is not caught\nint plgo_execute_plan_catch(SPIPlanPtr plan, Datum *values, const char *nulls, long count, ErrorData **edata) {\n\tMemoryContext oldcontext = CurrentMemoryContext;\n\tvolatile int ret = 0;\n\n\t*edata = NULL;\n\tPG_TRY();\n\t{\n\t\tret = SPI_execute_plan(plan, values, nulls, false, count);\n\t}\n\tPG_CATCH();\n\t{\n\t\tplgo_catch(oldcontext, edata);\n\t}\n\tPG_END_TRY();\n\treturn ret;\n}\n\n//plgo_prepare_catch prepares the query as SPI_prepare, its ERROR (e.g. a syntax error) is caught and copied into edata\nSPIPlanPtr plgo_prepare_catch(const char *src, int nargs, Oid *argtypes, ErrorData **edata) {\n\tMemoryContext oldcontext = CurrentMemoryContext;\n\tvolatile SPIPlanPtr ret = NULL;\n\n\t*edata = NULL;\n\tPG_TRY();\n\t{\n\t\tret = SPI_prepare(src, nargs, argtypes);\n\t}\n\tPG_CATCH();\n\t{\n\t\tplgo_catch(oldcontext, edata);\n\t}\n\tPG_END_TRY();\n\treturn ret;\n}\n\n//plgo_cursor_open_catch opens the cursor of the plan as SPI_cursor_open, its ERROR is caught and copied into edata\nPortal plgo_cursor_open_catch(SPIPlanPtr plan, Datum *values, const char *nulls, ErrorData **edata) {\n\tMemoryContext oldcontext = CurrentMemoryContext;\n\tvolatile Portal ret = NULL;\n\n\t*edata = NULL;\n\tPG_TRY();\n\t{\n\t\tret = SPI_cursor_open(NULL, plan, values, nulls, false);\n\t}\n\tPG_CATCH();\n\t{\n\t\tplgo_catch(oldcontext, edata);\n\t}\n\tPG_END_TRY();\n\treturn ret;\n}\n\nconst char *plgo_error_sqlstate(ErrorData *edata) {\n\treturn unpack_sql_state(edata->sqlerrcode);\n}\n*/\nimport \"C\"\nimport \"errors\"\n\n//SubTx is an subtransaction of the DB, the ERROR of an statement executed in it (Stmt.Exec, Query and QueryRow)\n//rolls back only the subtransaction and it is returned as an *Error, e.g. to recover from an unique_violation\n//as BEGIN ... EXCEPTION in PL/pgSQL. The subtransactions are nested, only the innermost can be released or rolled back\ntype SubTx struct {\n\tdb     *DB\n\tparent *SubTx\n\t//oldContext and oldOwner are the memory context and the resource owner of the code that started the subtransaction\n\toldContext C.MemoryContext\n\toldOwner   C.ResourceOwner\n\tdone       bool\n}\n\n//errSubTxDone is returned by the SubTx released or rolled back\nvar errSubTxDone = errors.New(\"The subtransaction was already released or rolled back\")\n\n//BeginSubTx starts an subtransaction, it must be released or rolled back before the DB is closed\nfunc (db *DB) BeginSubTx() (*SubTx, error) {\n\ttx := &SubTx{db: db, parent: db.subTx, oldContext: C.plgo_current_memory_context(), oldOwner: C.plgo_current_resource_owner()}\n\tC.plgo_subtx_begin()\n\tdb.subTx = tx\n\treturn tx, nil\n}\n\n//Release commits the subtransaction into the enclosing transaction\nfunc (tx *SubTx) Release() error {\n\treturn tx.end(true)\n}\n\n//Rollback rolls back the subtransaction, the changes done in it are discarded and its Rows can't be used\nfunc (tx *SubTx) Rollback() error {\n\treturn tx.end(false)\n}\n\nfunc (tx *SubTx) end(release bool) error {\n\tif tx.done {\n\t\treturn errSubTxDone\n\t}\n\tif tx.db.subTx != tx {\n\t\treturn errors.New(\"The subtransaction is not the innermost, release or rollback the nested subtransactions first\")\n\t}\n\tC.plgo_subtx_end((C._Bool)(release), tx.oldContext, tx.oldOwner)\n\ttx.done = true\n\ttx.db.subTx = tx.parent\n\treturn nil\n}\n\n//SubTransaction runs fn in an subtransaction, it is released if fn returns nil, otherwise rolled back.\n//The error of fn is returned, the failed statement returns an *Error\n//\n//\terr := db.SubTransaction(func() error {\n//\t\treturn insert.Exec(email)\n//\t})\n//\tvar pgErr *plgo.Error\n//\tif errors.As(err, &pgErr) && pgErr.Code == \"23505\" {\n//\t\t//the email is already registered\n//\t}\nfunc (db *DB) SubTransaction(fn func() error) error {\n\ttx, err := db.BeginSubTx()\n\tif err != nil {\n\t\treturn err\n\t}\n\tif err = fn(); err != nil {\n\t\tif rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != errSubTxDone {\n\t\t\treturn rollbackErr\n\t\t}\n\t\treturn err\n\t}\n\treturn tx.Release()\n}\n\n//executePlan executes the plan of the Stmt, the ERROR in an subtransaction rolls it back and it's returned as an *Error\nfunc (stmt *Stmt) executePlan(valuesP *C.Datum, nullsP *C.char, count C.long) (C.int, error) {\n\ttx := stmt.db.subTx\n\tif tx == nil {\n\t\treturn C.SPI_execute_plan(stmt.spiPlan, valuesP, nullsP, (C._Bool)(false), count), nil\n\t}\n\tvar edata *C.ErrorData\n\trv := C.plgo_execute_plan_catch(stmt.spiPlan, valuesP, nullsP, count, &edata)\n\tif edata == nil {\n\t\treturn rv, nil\n\t}\n\treturn rv, tx.caught(edata)\n}\n\n//prepare prepares the query, the ERROR in an subtransaction rolls it back and it's returned as an *Error\nfunc (db *DB) prepare(query *C.char, nargs C.int, typeIds *C.Oid) (C.SPIPlanPtr, error) {\n\ttx := db.subTx\n\tif tx == nil {\n\t\treturn C.SPI_prepare(query, nargs, typeIds), nil\n\t}\n\tvar edata *C.ErrorData\n\tplan := C.plgo_prepare_catch(query, nargs, typeIds, &edata)\n\tif edata == nil {\n\t\treturn plan, nil\n\t}\n\treturn nil, tx.caught(edata)\n}\n\n//cursorOpen opens the cursor of the plan of the Stmt, the ERROR in an subtransaction rolls it back\n//and it's returned as an *Error\nfunc (stmt *Stmt) cursorOpen(valuesP *C.Datum, nullsP *C.char) (C.Portal, error) {\n\ttx := stmt.db.subTx\n\tif tx == nil {\n\t\treturn C.SPI_cursor_open(nil, stmt.spiPlan, valuesP, nullsP, (C._Bool)(false)), nil\n\t}\n\tvar edata *C.ErrorData\n\tportal := C.plgo_cursor_open_catch(stmt.spiPlan, valuesP, nullsP, &edata)\n\tif edata == nil {\n\t\treturn portal, nil\n\t}\n\treturn nil, tx.caught(edata)\n}\n\n//caught returns the caught ERROR as an *Error and rolls back the failed subtransaction, it can't continue\nfunc (tx *SubTx) caught(edata *C.ErrorData) error {\n\terr := errorFromData(edata)\n\tC.FreeErrorData(edata)\n\ttx.Rollback()\n\treturn err\n}\n\n//errorFromData returns the *Error of the caught ERROR\nfunc errorFromData(edata *C.ErrorData) *Error {\n\tgostring := func(s *C.char) string {\n\t\tif s == nil {\n\t\t\treturn \"\"\n\t\t}\n\t\treturn C.GoString(s)\n\t}\n\treturn &Error{\n\t\tCode:       C.GoString(C.plgo_error_sqlstate(edata)),\n\t\tMessage:    gostring(edata.message),\n\t\tDetail:     gostring(edata.detail),\n\t\tHint:       gostring(edata.hint),\n\t\tSchema:     gostring(edata.schema_name),\n\t\tTable:      gostring(edata.table_name),\n\t\tColumn:     gostring(edata.column_name),\n\t\tDatatype:   gostring(edata.datatype_name),\n\t\tConstraint: gostring(edata.constraint_name),\n\t}\n}\n",
+	"timers.go":          "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"miscadmin.h\"\n#include \"storage/latch.h\"\n#include \"utils/timeout.h\"\n#include \"utils/timestamp.h\"\n#include <signal.h>\n\n//the timers and the deadlines share one timeout, PostgreSQL allows only a few timeouts registered by extensions\nstatic TimeoutId plgo_timeout_id;\nstatic bool plgo_timeout_registered;\n//plgo_timer_at is the expiration of the next timer, plgo_deadline_at of the earliest deadline, 0 if not armed\nstatic volatile TimestampTz plgo_timer_at;\nstatic volatile TimestampTz plgo_deadline_at;\nstatic volatile sig_atomic_t plgo_timer_fired;\n\n//plgo_timeout_schedule arms the timeout for the earlier of the next timer and the deadline\nstatic void plgo_timeout_schedule(void) {\n\tTimestampTz at = plgo_timer_at;\n\tif (at == 0 || (plgo_deadline_at != 0 && plgo_deadline_at < at))\n\t\tat = plgo_deadline_at;\n\tif (at != 0)\n\t\tenable_timeout_at(plgo_timeout_id, at);\n\telse\n\t\tdisable_timeout(plgo_timeout_id, false);\n}\n\n//the timeout handler runs in the SIGALRM handler, it only marks the expired timer and wakes up the backend.\n//The expired deadline cancels the query the same way as statement_timeout, then the timeout is armed again for the rest\nstatic void plgo_timeout_handler(void) {\n\tTimestampTz now = GetCurrentTimestamp();\n\tif (plgo_timer_at != 0 && plgo_timer_at <= now) {\n\t\tplgo_timer_at = 0;\n\t\tplgo_timer_fired = 1;\n\t\tSetLatch(MyLatch);\n\t}\n\tif (plgo_deadline_at != 0 && plgo_deadline_at <= now) {\n\t\tplgo_deadline_at = 0;\n\t\tkill(MyProcPid, SIGINT);\n\t}\n\tplgo_timeout_schedule();\n}\n\n//plgo_timeout_set arms the timeout for the next timer and the deadline after the milliseconds, -1 disarms them\nvoid plgo_timeout_set(int64 timer_ms, int64 deadline_ms) {\n\tTimestampTz now;\n\tif (!plgo_timeout_registered) {\n\t\tif (timer_ms < 0 && deadline_ms < 0)\n\t\t\treturn;\n\t\tplgo_timeout_id = RegisterTimeout(USER_TIMEOUT, plgo_timeout_handler);\n\t\tplgo_timeout_registered = true;\n\t}\n\t//the handler doesn't run while the timeout is disabled\n\tdisable_timeout(plgo_timeout_id, false);\n\tnow = GetCurrentTimestamp();\n\tplgo_timer_at = timer_ms < 0 ? 0 : TimestampTzPlusMilliseconds(now, timer_ms);\n\tplgo_deadline_at = deadline_ms < 0 ? 0 : TimestampTzPlusMilliseconds(now, deadline_ms);\n\tplgo_timeout_schedule();\n}\n\nint plgo_timer_take_fired(void) {\n\tint fired = plgo_timer_fired;\n\tplgo_timer_fired = 0;\n\treturn fired;\n}\n*/\nimport \"C\"\nimport (\n\t\"errors\"\n\t\"fmt\"\n\t\"time\"\n)\n\n//Timer is an timer of the backend. The timers and the deadlines are multiplexed on one backend timeout (RegisterTimeout),\n//it fires in the signal handler of the backend, which only marks the expired timer. The callback runs on the backend thread\n//from CheckTimers, which is also called before every call of an exported function and every SPI query\ntype Timer struct {\n\tat       time.Time\n\tinterval time.Duration\n\tperiodic bool\n\tfn       func()\n}\n\n//timers are the armed timers\nvar timers []*Timer\n\n//AfterFunc arms an timer that calls fn once after d\nfunc AfterFunc(d time.Duration, fn func()) (*Timer, error) {\n\treturn armTimer(&Timer{interval: d, fn: fn}), nil\n}\n\n//Every arms an timer that calls fn every interval until it is stopped\nfunc Every(interval time.Duration, fn func()) (*Timer, error) {\n\treturn armTimer(&Timer{interval: interval, periodic: true, fn: fn}), nil\n}\n\nfunc armTimer(t *Timer) *Timer {\n\tt.at = time.Now().Add(t.interval)\n\ttimers = append(timers, t)\n\tscheduleTimeout()\n\treturn t\n}\n\n//Stop disarms the timer, the callback is not called anymore\nfunc (t *Timer) Stop() {\n\tfor i, armed := range timers {\n\t\tif armed == t {\n\t\t\ttimers = append(timers[:i], timers[i+1:]...)\n\t\t\tscheduleTimeout()\n\t\t\treturn\n\t\t}\n\t}\n}\n\n//CheckTimers runs the callbacks of the expired timers, the periodic timers are armed again\nfunc CheckTimers() {\n\tif C.plgo_timer_take_fired() == 0 {\n\t\treturn\n\t}\n\tnow := time.Now()\n\tvar expired, armed []*Timer\n\tfor _, t := range timers {\n\t\tif t.at.After(now) {\n\t\t\tarmed = append(armed, t)\n\t\t\tcontinue\n\t\t}\n\t\texpired = append(expired, t)\n\t\tif t.periodic {\n\t\t\tt.at = now.Add(t.interval)\n\t\t\tarmed = append(armed, t)\n\t\t}\n\t}\n\ttimers = armed\n\tscheduleTimeout()\n\tfor _, t := range expired {\n\t\tt.run()\n\t}\n}\n\n//scheduleTimeout arms the timeout of the backend for the next timer and the earliest deadline of the running calls\nfunc scheduleTimeout() {\n\tnow := time.Now()\n\ttimer, deadline := C.int64(-1), C.int64(-1)\n\tfor _, t := range timers {\n\t\tif ms := timeoutMs(t.at.Sub(now)); timer < 0 || ms < timer {\n\t\t\ttimer = ms\n\t\t}\n\t}\n\tfor _, call := range callStack {\n\t\tif call.deadline.IsZero() {\n\t\t\tcontinue\n\t\t}\n\t\tif ms := timeoutMs(call.deadline.Sub(now)); deadline < 0 || ms < deadline {\n\t\t\tdeadline = ms\n\t\t}\n\t}\n\tC.plgo_timeout_set(timer, deadline)\n}\n\n//run calls the callback, its panic is logged, because CheckTimers runs also outside of the recovered function body\nfunc (t *Timer) run() {\n\tdefer func() {\n\t\tif r := recover(); r != nil {\n\t\t\tLog.Warning(\"panic in timer callback\", \"panic\", fmt.Sprint(r))\n\t\t}\n\t}()\n\tt.fn()\n}\n\nfunc timeoutMs(d time.Duration) C.int64 {\n\tms := d.Milliseconds()\n\tif ms < 1 {\n\t\tms = 1\n\t}\n\treturn C.int64(ms)\n}\n\n//SetDeadline arms an deadline for the running exported function call. When it expires, the call is canceled\n//the same way as by statement_timeout or pg_cancel_backend (the SPI queries and HTTPClient requests are interrupted,\n//the error is \"canceling statement due to user request\"). The deadline is disarmed when the call ends.\n//The nested calls have their own deadlines, the earliest of the running calls cancels the query\nfunc SetDeadline(d time.Duration) error {\n\tcall := currentCall()\n\tif call == nil {\n\t\treturn errors.New(\"plgo: SetDeadline called outside of an function call\")\n\t}\n\tcall.deadline = time.Now().Add(d)\n\tscheduleTimeout()\n\treturn nil\n}\n\n//endDeadline disarms the deadline of the finished call, the deadlines of the outer calls stay armed\nfunc (call *funcCall) endDeadline() {\n\tif !call.deadline.IsZero() {\n\t\tcall.deadline = time.Time{}\n\t\tscheduleTimeout()\n\t}\n}\n\nfunc init() {\n\t//the aborted calls are already dropped from the stack (calls.go registers its handler first),\n\t//so their deadlines are disarmed\n\tonAbort(func(subID uint32) {\n\t\tif subID == 0 {\n\t\t\ttimers = nil\n\t\t}\n\t\tscheduleTimeout()\n\t})\n}\n",
+	"tracing.go":         "package plgo\n\nimport (\n\t\"bytes\"\n\t\"crypto/rand\"\n\t\"encoding/hex\"\n\t\"encoding/json\"\n\t\"fmt\"\n\t\"net/http\"\n\t\"strconv\"\n\t\"strings\"\n\t\"time\"\n)\n\n//TracingConfig configures the export of the traces of exported function calls\ntype TracingConfig struct {\n\t//Endpoint is the OTLP/HTTP collector address, e.g. http://localhost:4318\n\tEndpoint string\n\t//ServiceName is the service.name resource attribute, the extension name by default\n\tServiceName string\n\t//Headers are added to every export request (e.g. authorization)\n\tHeaders map[string]string\n\t//Interval is the export interval of the background worker, 5s by default\n\tInterval time.Duration\n\t//MaxQueued is the maximum number of traces waiting for the export, 10000 by default\n\tMaxQueued int64\n}\n\n//tracingWorkerName is the name of the background worker exporting the spans\nconst tracingWorkerName = \"otlp exporter\"\n\n//tracingArea is the shared area where the backends queue the finished traces for the exporter worker\nconst tracingArea = \"plgo_traces\"\n\nvar tracing *TracingConfig\n\n//EnableTracing turns on the tracing of the exported function calls and SPI queries.\n//Every call of an exported function opens a span, the SPI queries are its child spans.\n//The spans are exported via OTLP/HTTP (JSON) by a background worker,\n//so the extension must be loaded with shared_preload_libraries.\n//It must be called from an init() function of the package\nfunc EnableTracing(config TracingConfig) {\n\tif config.Interval <= 0 {\n\t\tconfig.Interval = 5 * time.Second\n\t}\n\tif config.MaxQueued <= 0 {\n\t\tconfig.MaxQueued = 10000\n\t}\n\ttracing = &config\n\tregisterWorker(&worker{name: tracingWorkerName, restart: 10 * time.Second, main: exportTraces})\n}\n\n//span is an OTLP span\ntype span struct {\n\ttraceID    [16]byte\n\tspanID     [8]byte\n\tparentID   [8]byte\n\tname       string\n\tkind       int\n\tstart, end time.Time\n\tattributes map[string]interface{}\n\terr        error\n\tsubID      uint32\n\t//children are the finished child spans, the root span collects all spans of the trace\n\tchildren []*span\n\tparent   *span\n}\n\n//span kinds\nconst (\n\tspanKindInternal = 1\n\tspanKindClient   = 3\n)\n\n//spanStack holds the open spans of the running calls\nvar spanStack []*span\n\nfunc newSpan(name string, kind int, attributes map[string]interface{}) *span {\n\ts := &span{name: name, kind: kind, start: time.Now(), attributes: attributes, subID: currentSubTransactionID()}\n\trand.Read(s.spanID[:])\n\tif len(spanStack) > 0 {\n\t\ts.parent = spanStack[len(spanStack)-1]\n\t\ts.traceID = s.parent.traceID\n\t\ts.parentID = s.parent.spanID\n\t} else {\n\t\trand.Read(s.traceID[:])\n\t}\n\tspanStack = append(spanStack, s)\n\treturn s\n}\n\n//startCallSpan opens the span of an exported function call, returns nil if tracing is disabled\nfunc startCallSpan(name string, nargs int) *span {\n\tif tracing == nil {\n\t\treturn nil\n\t}\n\treturn newSpan(name, spanKindInternal, map[string]interface{}{\n\t\t\"code.function\": name,\n\t\t\"plgo.args\":     nargs,\n\t})\n}\n\n//startQuerySpan opens the span of an SPI query, returns nil if tracing is disabled\nfunc startQuerySpan(query string) *span {\n\tif tracing == nil {\n\t\treturn nil\n\t}\n\treturn newSpan(\"SPI query\", spanKindClient, map[string]interface{}{\n\t\t\"db.system\":    \"postgresql\",\n\t\t\"db.statement\": query,\n\t})\n}\n\n//finish closes the span, the finished trace is queued for the export when the root span is finished\nfunc (s *span) finish(err error) {\n\tif s == nil {\n\t\treturn\n\t}\n\ts.end = time.Now()\n\ts.err = err\n\tfor i := len(spanStack) - 1; i >= 0; i-- {\n\t\tif spanStack[i] == s {\n\t\t\tspanStack = spanStack[:i]\n\t\t\tbreak\n\t\t}\n\t}\n\tif s.parent != nil {\n\t\ts.parent.children = append(s.parent.children, s)\n\t\ts.parent.children = append(s.parent.children, s.children...)\n\t\ts.children = nil\n\t\treturn\n\t}\n\tqueueTrace(append([]*span{s}, s.children...))\n}\n\nfunc init() {\n\t//spans interrupted by an ERROR are never finished\n\tonAbort(func(subID uint32) {\n\t\tfor i, s := range spanStack {\n\t\t\tif subID == 0 || s.subID >= subID {\n\t\t\t\tspanStack = spanStack[:i]\n\t\t\t\treturn\n\t\t\t}\n\t\t}\n\t})\n}\n\n//otlpSpan is the OTLP JSON encoding of an span\ntype otlpSpan struct {\n\tTraceID           string          `json:\"traceId\"`\n\tSpanID            string          `json:\"spanId\"`\n\tParentSpanID      string          `json:\"parentSpanId,omitempty\"`\n\tName              string          `json:\"name\"`\n\tKind              int             `json:\"kind\"`\n\tStartTimeUnixNano string          `json:\"startTimeUnixNano\"`\n\tEndTimeUnixNano   string          `json:\"endTimeUnixNano\"`\n\tAttributes        []otlpAttribute `json:\"attributes,omitempty\"`\n\tStatus            otlpStatus      `json:\"status\"`\n}\n\ntype otlpAttribute struct {\n\tKey   string                 `json:\"key\"`\n\tValue map[string]interface{} `json:\"value\"`\n}\n\ntype otlpStatus struct {\n\tCode    int    `json:\"code,omitempty\"`\n\tMessage string `json:\"message,omitempty\"`\n}\n\nfunc otlpAttributes(attributes map[string]interface{}) []otlpAttribute {\n\tvar ret []otlpAttribute\n\tfor key, val := range attributes {\n\t\tvar value map[string]interface{}\n\t\tswitch v := val.(type) {\n\t\tcase int:\n\t\t\tvalue = map[string]interface{}{\"intValue\": strconv.Itoa(v)}\n\t\tcase int64:\n\t\t\tvalue = map[string]interface{}{\"intValue\": strconv.FormatInt(v, 10)}\n\t\tcase bool:\n\t\t\tvalue = map[string]interface{}{\"boolValue\": v}\n\t\tcase float64:\n\t\t\tvalue = map[string]interface{}{\"doubleValue\": v}\n\t\tdefault:\n\t\t\tvalue = map[string]interface{}{\"stringValue\": fmt.Sprint(v)}\n\t\t}\n\t\tret = append(ret, otlpAttribute{Key: key, Value: value})\n\t}\n\treturn ret\n}\n\nfunc (s *span) otlp() otlpSpan {\n\to := otlpSpan{\n\t\tTraceID:           hex.EncodeToString(s.traceID[:]),\n\t\tSpanID:            hex.EncodeToString(s.spanID[:]),\n\t\tName:              s.name,\n\t\tKind:              s.kind,\n\t\tStartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),\n\t\tEndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),\n\t\tAttributes:        otlpAttributes(s.attributes),\n\t}\n\tif s.parent != nil {\n\t\to.ParentSpanID = hex.EncodeToString(s.parentID[:])\n\t}\n\tif s.err != nil {\n\t\to.Status = otlpStatus{Code: 2, Message: s.err.Error()}\n\t}\n\treturn o\n}\n\n//queueTrace stores the spans of an finished trace into the shared area, where the exporter worker picks them up\nfunc queueTrace(spans []*span) {\n\tarea, err := AttachSharedArea(tracingArea)\n\tif err != nil {\n\t\treturn\n\t}\n\tif queued, _ := area.Add(\"queued\", 1); queued > tracing.MaxQueued {\n\t\tarea.Add(\"queued\", -1)\n\t\tarea.Add(\"dropped\", 1)\n\t\treturn\n\t}\n\tencoded := make([]otlpSpan, len(spans))\n\tfor i, s := range spans {\n\t\tencoded[i] = s.otlp()\n\t}\n\tdata, err := json.Marshal(encoded)\n\tif err != nil {\n\t\treturn\n\t}\n\tid, _ := area.Add(\"sequence\", 1)\n\tarea.Set(\"trace:\"+strconv.FormatInt(id, 10), data)\n}\n\n//exportTraces is the main function of the exporter background worker\nfunc exportTraces(ctx *workerContext) error {\n\tarea, err := AttachSharedArea(tracingArea)\n\tif err != nil {\n\t\treturn err\n\t}\n\tserviceName := tracing.ServiceName\n\tif serviceName == \"\" {\n\t\tserviceName = extensionName\n\t}\n\t//own transport, the default one is blocked in the restricted mode\n\tclient := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}\n\tendpoint := strings.TrimRight(tracing.Endpoint, \"/\") + \"/v1/traces\"\n\tfor ctx.Wait(tracing.Interval) {\n\t\tvar spans []json.RawMessage\n\t\tvar traces int64\n\t\tfor _, key := range area.Keys() {\n\t\t\tif !strings.HasPrefix(key, \"trace:\") {\n\t\t\t\tcontinue\n\t\t\t}\n\t\t\tdata, ok, err := area.Get(key)\n\t\t\tarea.Delete(key)\n\t\t\ttraces++\n\t\t\tif err != nil || !ok {\n\t\t\t\tcontinue\n\t\t\t}\n\t\t\tvar traceSpans []json.RawMessage\n\t\t\tif json.Unmarshal(data, &traceSpans) == nil {\n\t\t\t\tspans = append(spans, traceSpans...)\n\t\t\t}\n\t\t}\n\t\tif traces == 0 {\n\t\t\tcontinue\n\t\t}\n\t\tarea.Add(\"queued\", -traces)\n\t\tif err := postSpans(client, endpoint, serviceName, spans); err != nil {\n\t\t\tLog.Log(\"cannot export traces\", \"endpoint\", endpoint, \"error\", err)\n\t\t}\n\t}\n\treturn nil\n}\n\nfunc postSpans(client *http.Client, endpoint, serviceName string, spans []json.RawMessage) error {\n\trequest := map[string]interface{}{\n\t\t\"resourceSpans\": []interface{}{\n\t\t\tmap[string]interface{}{\n\t\t\t\t\"resource\": map[string]interface{}{\n\t\t\t\t\t\"attributes\": otlpAttributes(map[string]interface{}{\"service.name\": serviceName}),\n\t\t\t\t},\n\t\t\t\t\"scopeSpans\": []interface{}{\n\t\t\t\t\tmap[string]interface{}{\n\t\t\t\t\t\t\"scope\": map[string]interface{}{\"name\": \"plgo\"},\n\t\t\t\t\t\t\"spans\": spans,\n\t\t\t\t\t},\n\t\t\t\t},\n\t\t\t},\n\t\t},\n\t}\n\tbody, err := json.Marshal(request)\n\tif err != nil {\n\t\treturn err\n\t}\n\treq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))\n\tif err != nil {\n\t\treturn err\n\t}\n\treq.Header.Set(\"Content-Type\", \"application/json\")\n\tfor key, val := range tracing.Headers {\n\t\treq.Header.Set(key, val)\n\t}\n\tresp, err := client.Do(req)\n\tif err != nil {\n\t\treturn err\n\t}\n\tdefer resp.Body.Close()\n\tif resp.StatusCode/100 != 2 {\n\t\treturn fmt.Errorf(\"collector returned %s\", resp.Status)\n\t}\n\treturn nil\n}\n",
+	"uuid.go":            "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"catalog/pg_type.h\"\n#include \"utils/uuid.h\"\n\nDatum plgo_uuid_to_datum(const unsigned char *data) {\n\tpg_uuid_t *uuid = palloc(sizeof(pg_uuid_t));\n\n\tmemcpy(uuid->data, data, UUID_LEN);\n\treturn UUIDPGetDatum(uuid);\n}\n\nvoid plgo_datum_to_uuid(Datum val, unsigned char *data) {\n\tmemcpy(data, DatumGetUUIDP(val)->data, UUID_LEN);\n}\n*/\nimport \"C\"\nimport (\n\t\"encoding/hex\"\n\t\"fmt\"\n\t\"unsafe\"\n)\n\n//UUID is the PostgreSQL uuid, it has the layout of github.com/google/uuid UUID,\n//so they are converted with plgo.UUID(id) and uuid.UUID(u)\ntype UUID [16]byte\n\n//ParseUUID parses the uuid in the canonical form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx, with or without the hyphens\nfunc ParseUUID(s string) (UUID, error) {\n\tvar u UUID\n\tdigits := make([]byte, 0, 32)\n\tfor i := 0; i < len(s); i++ {\n\t\tif s[i] == '-' && (i == 8 || i == 13 || i == 18 || i == 23) && len(s) == 36 {\n\t\t\tcontinue\n\t\t}\n\t\tdigits = append(digits, s[i])\n\t}\n\tif len(digits) != 32 {\n\t\treturn u, fmt.Errorf(\"Invalid uuid %q\", s)\n\t}\n\tif _, err := hex.Decode(u[:], digits); err != nil {\n\t\treturn u, fmt.Errorf(\"Invalid uuid %q\", s)\n\t}\n\treturn u, nil\n}\n\n//String returns the canonical form of the uuid, xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx\nfunc (u UUID) String() string {\n\ts := hex.EncodeToString(u[:])\n\treturn s[0:8] + \"-\" + s[8:12] + \"-\" + s[12:16] + \"-\" + s[16:20] + \"-\" + s[20:]\n}\n\n//MarshalText returns the canonical form, the uuid fields of the jsonb structs are strings\nfunc (u UUID) MarshalText() ([]byte, error) {\n\treturn []byte(u.String()), nil\n}\n\n//UnmarshalText parses the uuid\nfunc (u *UUID) UnmarshalText(text []byte) error {\n\tparsed, err := ParseUUID(string(text))\n\tif err != nil {\n\t\treturn err\n\t}\n\t*u = parsed\n\treturn nil\n}\n\n//uuidDatum returns the uuid datum\nfunc uuidDatum(u UUID) Datum {\n\treturn (Datum)(C.plgo_uuid_to_datum((*C.uchar)(unsafe.Pointer(&u[0]))))\n}\n\n//scanUUID sets the uuid from the datum, an error if the type oid isn't uuid\nfunc scanUUID(oid C.Oid, typeName string, val C.Datum, dest *UUID) error {\n\tif oid != C.UUIDOID {\n\t\treturn fmt.Errorf(\"Column type is not uuid %s\", typeName)\n\t}\n\tC.plgo_datum_to_uuid(val, (*C.uchar)(unsafe.Pointer(&dest[0])))\n\treturn nil\n}\n",
+	"window.go":          "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"fmgr.h\"\n#include \"windowapi.h\"\n\nbool plgo_called_as_window(FunctionCallInfo fcinfo) {\n\treturn WindowObjectIsValid(PG_WINDOW_OBJECT());\n}\n\nWindowObject plgo_window_object(FunctionCallInfo fcinfo) {\n\treturn PG_WINDOW_OBJECT();\n}\n*/\nimport \"C\"\nimport (\n\t\"fmt\"\n\t\"math\"\n\t\"reflect\"\n\t\"unsafe\"\n)\n\n//WindowContext is the window of the current row passed to an window function, func(w *plgo.WindowContext, args...) T.\n//The function is created as an WINDOW function and called with an OVER clause, the arguments are numbered\n//from 0 without the WindowContext, the positions are numbered from 0 in the partition or in the frame\ntype WindowContext struct {\n\tfcinfo *funcInfo\n\twinobj C.WindowObject\n}\n\n//WindowContext returns the window of the current row, if the function was called as an window function, else nil\nfunc (fcinfo *funcInfo) WindowContext() *WindowContext {\n\tcfcinfo := (C.FunctionCallInfo)(unsafe.Pointer(fcinfo))\n\tif C.plgo_called_as_window(cfcinfo) != (C._Bool)(true) {\n\t\treturn nil\n\t}\n\treturn &WindowContext{fcinfo: fcinfo, winobj: C.plgo_window_object(cfcinfo)}\n}\n\n//PartitionRowCount returns the number of rows in the partition of the current row\nfunc (w *WindowContext) PartitionRowCount() int64 {\n\treturn int64(C.WinGetPartitionRowCount(w.winobj))\n}\n\n//CurrentPosition returns the position of the current row in the partition\nfunc (w *WindowContext) CurrentPosition() int64 {\n\treturn int64(C.WinGetCurrentPosition(w.winobj))\n}\n\n//RowsArePeers reports whether the rows at the positions of the partition are peers in the ORDER BY of the window\nfunc (w *WindowContext) RowsArePeers(pos1, pos2 int64) bool {\n\treturn C.WinRowsArePeers(w.winobj, C.int64(pos1), C.int64(pos2)) == (C._Bool)(true)\n}\n\n//SetMarkPosition tells PostgreSQL that the rows before the position of the partition won't be read anymore,\n//so they can be released\nfunc (w *WindowContext) SetMarkPosition(pos int64) {\n\tC.WinSetMarkPosition(w.winobj, C.int64(pos))\n}\n\n//ArgCurrent sets dest to the argument of the current row, as Scan\nfunc (w *WindowContext) ArgCurrent(argno int, dest interface{}) error {\n\tvar isnull C.bool\n\tdatum := C.WinGetFuncArgCurrent(w.winobj, C.int(argno), &isnull)\n\treturn w.scanArg(argno, datum, isnull == (C._Bool)(true), dest)\n}\n\n//ArgInPartition sets dest to the argument of the row at the position of the partition, as Scan.\n//It returns false if the position is outside of the partition, dest is unchanged\nfunc (w *WindowContext) ArgInPartition(argno int, pos int64, dest interface{}) (bool, error) {\n\treturn w.argAt(argno, pos, dest, false)\n}\n\n//ArgInFrame sets dest to the argument of the row at the position of the window frame of the current row, as Scan.\n//It returns false if the position is outside of the frame, dest is unchanged\nfunc (w *WindowContext) ArgInFrame(argno int, pos int64, dest interface{}) (bool, error) {\n\treturn w.argAt(argno, pos, dest, true)\n}\n\n//argAt sets dest to the argument of the row at the position from the head of the partition or of the frame\nfunc (w *WindowContext) argAt(argno int, pos int64, dest interface{}, frame bool) (bool, error) {\n\tif pos < 0 || pos > math.MaxInt32 {\n\t\treturn false, nil\n\t}\n\tvar isnull, isout C.bool\n\tvar datum C.Datum\n\tif frame {\n\t\tdatum = C.WinGetFuncArgInFrame(w.winobj, C.int(argno), C.int(pos), C.WINDOW_SEEK_HEAD, (C._Bool)(false), &isnull, &isout)\n\t} else {\n\t\tdatum = C.WinGetFuncArgInPartition(w.winobj, C.int(argno), C.int(pos), C.WINDOW_SEEK_HEAD, (C._Bool)(false), &isnull, &isout)\n\t}\n\tif isout == (C._Bool)(true) {\n\t\treturn false, nil\n\t}\n\treturn true, w.scanArg(argno, datum, isnull == (C._Bool)(true), dest)\n}\n\n//scanArg converts the argument value into dest, the pointers to pointers are set to nil for NULL,\n//the other NULL arguments keep the zero values\nfunc (w *WindowContext) scanArg(argno int, datum C.Datum, isnull bool, dest interface{}) error {\n\ttarget := reflect.ValueOf(dest)\n\tif target.Kind() != reflect.Ptr || target.IsNil() {\n\t\treturn fmt.Errorf(\"Window argument %d: %T is not an pointer\", argno, dest)\n\t}\n\ttarget = target.Elem()\n\tnullable := target.Kind() == reflect.Ptr\n\tif isnull {\n\t\tif nullable {\n\t\t\ttarget.Set(reflect.Zero(target.Type()))\n\t\t}\n\t\treturn nil\n\t}\n\targOid := C.get_call_expr_argtype(w.fcinfo.flinfo.fn_expr, C.int(argno))\n\tif nullable {\n\t\tvalue := reflect.New(target.Type().Elem())\n\t\tif err := scanVal(argOid, \"\", datum, value.Interface()); err != nil {\n\t\t\treturn fmt.Errorf(\"Window argument %d: %w\", argno, err)\n\t\t}\n\t\ttarget.Set(value)\n\t\treturn nil\n\t}\n\tif err := scanVal(argOid, \"\", datum, dest); err != nil {\n\t\treturn fmt.Errorf(\"Window argument %d: %w\", argno, err)\n\t}\n\treturn nil\n}\n\n//scanCurrent sets the args to the arguments of the current row, the executor doesn't pass them in fcinfo\nfunc (w *WindowContext) scanCurrent(args ...interface{}) error {\n\tfor i, arg := range args {\n\t\tif err := w.ArgCurrent(i, arg); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n\treturn nil\n}\n",
+	"worker.go":          "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"miscadmin.h\"\n#include \"pgstat.h\"\n#include \"postmaster/bgworker.h\"\n#include \"postmaster/interrupt.h\"\n#include \"access/xact.h\"\n#include \"storage/ipc.h\"\n#include \"storage/latch.h\"\n#include \"utils/guc.h\"\n#include \"utils/memutils.h\"\n#include \"utils/snapmgr.h\"\n\nextern int plgo_worker_run(char *name, int64 arg);\n\nPGDLLEXPORT void plgo_worker_main(Datum main_arg);\n\nvoid plgo_worker_main(Datum main_arg) {\n\tpqsignal(SIGHUP, SignalHandlerForConfigReload);\n\tpqsignal(SIGTERM, SignalHandlerForShutdownRequest);\n\tBackgroundWorkerUnblockSignals();\n\tproc_exit(plgo_worker_run(MyBgworkerEntry->bgw_extra, DatumGetInt64(main_arg)));\n}\n\nstatic void plgo_fill_worker(BackgroundWorker *worker, char *library, char *name, int restart_seconds, bool connection) {\n\tMemSet(worker, 0, sizeof(BackgroundWorker));\n\tworker->bgw_flags = BGWORKER_SHMEM_ACCESS;\n\tif (connection)\n\t\tworker->bgw_flags |= BGWORKER_BACKEND_DATABASE_CONNECTION;\n\tworker->bgw_start_time = BgWorkerStart_RecoveryFinished;\n\tworker->bgw_restart_time = restart_seconds;\n\tsnprintf(worker->bgw_name, BGW_MAXLEN, \"plgo worker %s\", name);\n\tsnprintf(worker->bgw_type, BGW_MAXLEN, \"plgo worker %s\", name);\n\tstrlcpy(worker->bgw_library_name, library, sizeof(worker->bgw_library_name));\n\tstrlcpy(worker->bgw_function_name, \"plgo_worker_main\", sizeof(worker->bgw_function_name));\n\tstrlcpy(worker->bgw_extra, name, BGW_EXTRALEN);\n\tworker->bgw_main_arg = (Datum) 0;\n\tworker->bgw_notify_pid = 0;\n}\n\nvoid plgo_register_worker(char *library, char *name, int restart_seconds, bool connection) {\n\tBackgroundWorker worker;\n\tplgo_fill_worker(&worker, library, name, restart_seconds, connection);\n\tRegisterBackgroundWorker(&worker);\n}\n\n// plgo_start_worker starts an dynamic background worker, returns NULL if there is no free worker slot\nBackgroundWorkerHandle *plgo_start_worker(char *library, char *name, int64 arg, bool connection) {\n\tBackgroundWorker worker;\n\tBackgroundWorkerHandle *handle;\n\tMemoryContext old;\n\tbool started;\n\tplgo_fill_worker(&worker, library, name, BGW_NEVER_RESTART, connection);\n\tworker.bgw_main_arg = Int64GetDatum(arg);\n\tworker.bgw_notify_pid = MyProcPid;\n\told = MemoryContextSwitchTo(TopMemoryContext);\n\tstarted = RegisterDynamicBackgroundWorker(&worker, &handle);\n\tMemoryContextSwitchTo(old);\n\treturn started ? handle : NULL;\n}\n\nint plgo_worker_status(BackgroundWorkerHandle *handle) {\n\tpid_t pid;\n\treturn GetBackgroundWorkerPid(handle, &pid);\n}\n\nvoid plgo_worker_begin(void) {\n\tSetCurrentStatementStartTimestamp();\n\tStartTransactionCommand();\n\tPushActiveSnapshot(GetTransactionSnapshot());\n}\n\nvoid plgo_worker_commit(void) {\n\tPopActiveSnapshot();\n\tCommitTransactionCommand();\n\tpgstat_report_stat(false);\n\tpgstat_report_activity(STATE_IDLE, NULL);\n}\n\nvoid plgo_worker_rollback(void) {\n\tPopActiveSnapshot();\n\tAbortCurrentTransaction();\n\tpgstat_report_activity(STATE_IDLE, NULL);\n}\n\nbool plgo_preloading(void) {\n\treturn process_shared_preload_libraries_in_progress;\n}\n\n// plgo_worker_reloads counts the configuration reloads of the worker\nstatic uint64 plgo_worker_reloads = 0;\n\n// plgo_worker_wait waits for the latch or the timeout, returns true if shutdown was requested\nbool plgo_worker_wait(long milliseconds) {\n\t(void) WaitLatch(MyLatch, WL_LATCH_SET | WL_TIMEOUT | WL_EXIT_ON_PM_DEATH,\n\t\t\t\t\t milliseconds, PG_WAIT_EXTENSION);\n\tResetLatch(MyLatch);\n\tCHECK_FOR_INTERRUPTS();\n\tif (ConfigReloadPending) {\n\t\tConfigReloadPending = false;\n\t\tProcessConfigFile(PGC_SIGHUP);\n\t\tplgo_worker_reloads++;\n\t}\n\treturn ShutdownRequestPending;\n}\n\nuint64 plgo_worker_reload_count(void) {\n\treturn plgo_worker_reloads;\n}\n\nbool plgo_worker_shutdown_requested(void) {\n\treturn ShutdownRequestPending;\n}\n\nvoid plgo_worker_connect(char *database, char *user) {\n\tBackgroundWorkerInitializeConnection(database, user, 0);\n}\n*/\nimport \"C\"\nimport (\n\t\"errors\"\n\t\"fmt\"\n\t\"time\"\n\t\"unsafe\"\n)\n\n//extensionName is the name of the extension (and its shared library), it's set by the generated code\nvar extensionName = \"plgo\"\n\n//worker is an background worker process running Go code\ntype worker struct {\n\tname string\n\t//database returns the database to connect to, nil if the worker doesn't need SPI\n\tdatabase func() string\n\t//restart is the delay before the postmaster restarts the crashed worker, 0 means never restart\n\trestart time.Duration\n\t//dynamic workers are not started with the server, they are started by startWorker\n\tdynamic bool\n\tmain    func(ctx *workerContext) error\n}\n\n//workers are the registered background workers by name\nvar workers = make(map[string]*worker)\n\n//registerWorker registers the background worker, it's started when the library is in shared_preload_libraries\nfunc registerWorker(w *worker) {\n\tworkers[w.name] = w\n}\n\nfunc init() {\n\tonInit(func() {\n\t\tif C.plgo_preloading() != (C._Bool)(true) {\n\t\t\treturn\n\t\t}\n\t\tclib := C.CString(extensionName)\n\t\tdefer C.free(unsafe.Pointer(clib))\n\t\tfor _, w := range workers {\n\t\t\tif w.dynamic {\n\t\t\t\tcontinue\n\t\t\t}\n\t\t\trestart := C.int(C.BGW_NEVER_RESTART)\n\t\t\tif w.restart > 0 {\n\t\t\t\trestart = C.int(w.restart / time.Second)\n\t\t\t}\n\t\t\tcname := C.CString(w.name)\n\t\t\tC.plgo_register_worker(clib, cname, restart, (C._Bool)(w.database != nil))\n\t\t\tC.free(unsafe.Pointer(cname))\n\t\t}\n\t})\n}\n\n//workerContext is passed to the main function of the background worker\ntype workerContext struct {\n\tworker *worker\n\t//arg is the argument of an dynamic worker passed to startWorker\n\targ int64\n}\n\n//Wait waits for the timeout, or until the worker is woken up.\n//Returns false if the worker should exit\nfunc (ctx *workerContext) Wait(timeout time.Duration) bool {\n\treturn C.plgo_worker_wait(C.long(timeout/time.Millisecond)) != (C._Bool)(true)\n}\n\n//ShutdownRequested returns true if the worker got SIGTERM\nfunc (ctx *workerContext) ShutdownRequested() bool {\n\treturn C.plgo_worker_shutdown_requested() == (C._Bool)(true)\n}\n\n//Transaction runs fn in an transaction with an SPI connection, the transaction is committed if fn returns nil.\n//It can be used only in workers connected to an database\nfunc (ctx *workerContext) Transaction(fn func(db *DB) error) error {\n\tC.plgo_worker_begin()\n\tdb, err := Open()\n\tif err != nil {\n\t\tC.plgo_worker_rollback()\n\t\treturn err\n\t}\n\terr = fn(db)\n\tif closeErr := db.Close(); err == nil {\n\t\terr = closeErr\n\t}\n\tif err != nil {\n\t\tC.plgo_worker_rollback()\n\t\treturn err\n\t}\n\tC.plgo_worker_commit()\n\treturn nil\n}\n\n//workerHandle is the handle of an started dynamic worker\ntype workerHandle struct {\n\thandle *C.BackgroundWorkerHandle\n}\n\n//startWorker starts the dynamic worker with the argument\nfunc startWorker(name string, arg int64) (*workerHandle, error) {\n\tw, ok := workers[name]\n\tif !ok || !w.dynamic {\n\t\treturn nil, fmt.Errorf(\"unknown dynamic background worker %s\", name)\n\t}\n\tclib := C.CString(extensionName)\n\tdefer C.free(unsafe.Pointer(clib))\n\tcname := C.CString(name)\n\tdefer C.free(unsafe.Pointer(cname))\n\thandle := C.plgo_start_worker(clib, cname, C.int64(arg), (C._Bool)(w.database != nil))\n\tif handle == nil {\n\t\treturn nil, errors.New(\"no free background worker slot, increase max_worker_processes\")\n\t}\n\treturn &workerHandle{handle: handle}, nil\n}\n\n//stopped reports whether the worker exited, the handle is released then\nfunc (h *workerHandle) stopped() bool {\n\tif h.handle == nil {\n\t\treturn true\n\t}\n\tif C.plgo_worker_status(h.handle) != C.BGWH_STOPPED {\n\t\treturn false\n\t}\n\tC.pfree(unsafe.Pointer(h.handle))\n\th.handle = nil\n\treturn true\n}\n\n//runWorker runs the main function of the named worker, returns the exit code of the process\nfunc runWorker(name string, arg int64) int {\n\tw, ok := workers[name]\n\tif !ok {\n\t\tLog.Warning(\"unknown background worker\", \"worker\", name)\n\t\treturn 1\n\t}\n\tif w.database != nil {\n\t\tcdb := C.CString(w.database())\n\t\tC.plgo_worker_connect(cdb, nil)\n\t\tC.free(unsafe.Pointer(cdb))\n\t}\n\tif err := w.main(&workerContext{worker: w, arg: arg}); err != nil {\n\t\tLog.Log(fmt.Sprintf(\"background worker %s failed\", name), \"error\", err)\n\t\treturn 1\n\t}\n\treturn 0\n}\n",
+	"workerfunc.go":      "package plgo\n\n/*\n#include \"postgres.h\"\n#include \"postmaster/bgworker.h\"\n\nextern bool plgo_worker_shutdown_requested(void);\nextern uint64 plgo_worker_reload_count(void);\n*/\nimport \"C\"\nimport (\n\t\"context\"\n\t\"time\"\n)\n\n//workersDatabase is <extension>.workers_database\nvar workersDatabase *stringGUC\n\n//Worker is the background worker running an function of the package declared with //plgo:worker,\n//the function runs until it returns or the worker is shut down:\n//\n//\t//plgo:worker restart=30s\n//\tfunc Cleaner(w *plgo.Worker) error {\n//\t\tfor w.Wait(time.Minute) {\n//\t\t\tif err := w.Transaction(cleanup); err != nil {\n//\t\t\t\tplgo.Log.Warning(\"cleanup failed\", \"error\", err)\n//\t\t\t}\n//\t\t}\n//\t\treturn nil\n//\t}\ntype Worker struct {\n\t//Name is the name of the worker, the name of the function\n\tName    string\n\tctx     *workerContext\n\tcontext context.Context\n\tcancel  context.CancelFunc\n\treload  chan struct{}\n\treloads C.uint64\n}\n\n//newWorker returns the Worker of the worker process, its context is canceled on SIGTERM\nfunc newWorker(ctx *workerContext) *Worker {\n\tw := &Worker{Name: ctx.worker.name, ctx: ctx, reload: make(chan struct{}, 1), reloads: C.plgo_worker_reload_count()}\n\tw.context, w.cancel = context.WithCancel(context.Background())\n\tgo func() {\n\t\tticker := time.NewTicker(interruptPollInterval)\n\t\tdefer ticker.Stop()\n\t\tfor {\n\t\t\tselect {\n\t\t\tcase <-w.context.Done():\n\t\t\t\treturn\n\t\t\tcase <-ticker.C:\n\t\t\t\tif C.plgo_worker_shutdown_requested() == (C._Bool)(true) {\n\t\t\t\t\tw.cancel()\n\t\t\t\t\treturn\n\t\t\t\t}\n\t\t\t}\n\t\t}\n\t}()\n\treturn w\n}\n\n//Context returns the context of the worker, it's canceled when the worker gets SIGTERM\nfunc (w *Worker) Context() context.Context {\n\treturn w.context\n}\n\n//Reload returns the channel receiving after the configuration was reloaded (SIGHUP),\n//the configuration is reloaded by Wait\nfunc (w *Worker) Reload() <-chan struct{} {\n\treturn w.reload\n}\n\n//Wait waits for the timeout, or until the worker is woken up, and reloads the configuration after SIGHUP.\n//Returns false if the worker should exit\nfunc (w *Worker) Wait(timeout time.Duration) bool {\n\trunning := w.ctx.Wait(timeout)\n\tif reloads := C.plgo_worker_reload_count(); reloads != w.reloads {\n\t\tw.reloads = reloads\n\t\tselect {\n\t\tcase w.reload <- struct{}{}:\n\t\tdefault:\n\t\t}\n\t}\n\tif !running {\n\t\tw.cancel()\n\t}\n\treturn running\n}\n\n//ShutdownRequested returns true if the worker got SIGTERM\nfunc (w *Worker) ShutdownRequested() bool {\n\treturn w.ctx.ShutdownRequested()\n}\n\n//Transaction runs fn in an transaction with an SPI connection to the database of the worker,\n//the transaction is committed if fn returns nil\nfunc (w *Worker) Transaction(fn func(db *DB) error) error {\n\treturn w.ctx.Transaction(fn)\n}\n\n//registerWorkerFunc registers the function declared with //plgo:worker, it's called by the generated code.\n//The worker is restarted after the restart seconds (0 never), it connects to the database\n//or to the <extension>.workers_database if it is empty\nfunc registerWorkerFunc(name string, fn func(w *Worker) error, restart int, database string) {\n\tdatabaseName := func() string { return database }\n\tif database == \"\" {\n\t\tif workersDatabase == nil {\n\t\t\tworkersDatabase = newStringGUC(gucDesc{\n\t\t\t\tname:      \"workers_database\",\n\t\t\t\tshortDesc: \"Sets the database of the background workers of the extension.\",\n\t\t\t\tcontext:   gucPostmaster,\n\t\t\t}, \"postgres\")\n\t\t}\n\t\tdatabaseName = func() string { return workersDatabase.get() }\n\t}\n\tregisterWorker(&worker{\n\t\tname:     name,\n\t\tdatabase: databaseName,\n\t\trestart:  time.Duration(restart) * time.Second,\n\t\tmain: func(ctx *workerContext) error {\n\t\t\tw := newWorker(ctx)\n\t\t\tdefer w.cancel()\n\t\t\treturn fn(w)\n\t\t},\n\t})\n}\n",
+}
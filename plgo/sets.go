@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//Column is an column of the rows returned by an set returning function
+type Column struct {
+	Name, Type string
+}
+
+//SetFunction is an set returning function, it returns an slice or channel of structs (RETURNS TABLE)
+//or an channel of scalar values (RETURNS SETOF)
+type SetFunction struct {
+	VoidFunction
+	//Columns are the columns of the returned structs, ElemType is the Go type of the returned scalar values
+	Columns  []Column
+	ElemType string
+	//Context is true if the function returning an channel has the context.Context parameter
+	Context bool
+}
+
+//newSetFunction returns the set returning function if the result is an channel or an slice of structs declared in the package,
+//otherwise nil, the slices of basic types are returned as arrays
+func newSetFunction(function VoidFunction, result ast.Expr, structs map[string]*ast.StructType) (*SetFunction, error) {
+	var elem ast.Expr
+	switch res := result.(type) {
+	case *ast.ChanType:
+		if res.Dir == ast.SEND {
+			return nil, fmt.Errorf("Function %s returns an send-only channel", function.Name)
+		}
+		elem = res.Value
+	case *ast.ArrayType:
+		if ident, ok := res.Elt.(*ast.Ident); !ok || structs[ident.Name] == nil {
+			return nil, nil
+		}
+		elem = res.Elt
+	default:
+		return nil, nil
+	}
+	ident, ok := elem.(*ast.Ident)
+	if !ok {
+		return nil, fmt.Errorf("Function %s returns an set of not supported type", function.Name)
+	}
+	if structType, ok := structs[ident.Name]; ok {
+		columns, err := structColumns("Function "+function.Name, structType)
+		if err != nil {
+			return nil, err
+		}
+		return &SetFunction{VoidFunction: function, Columns: columns}, nil
+	}
+	if _, ok := datumTypes[ident.Name]; !ok || ident.Name == "error" {
+		return nil, fmt.Errorf("Function %s returns an set of not supported type %s", function.Name, ident.Name)
+	}
+	return &SetFunction{VoidFunction: function, ElemType: ident.Name}, nil
+}
+
+//structColumns returns the columns of the struct (the rows of an function or an composite type, owner names it in the errors):
+//the exported fields, named by the `plgo:"name"` tag or in snake case, `plgo:"-"` skips the field.
+//The pointer fields are NULL when nil
+func structColumns(owner string, structType *ast.StructType) ([]Column, error) {
+	var columns []Column
+	for _, field := range structType.Fields.List {
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded fields of the rows are not supported", owner)
+		}
+		var tag string
+		if field.Tag != nil {
+			unquoted, _ := strconv.Unquote(field.Tag.Value)
+			tag = reflect.StructTag(unquoted).Get("plgo")
+		}
+		if tag == "-" {
+			continue
+		}
+		fieldType := field.Type
+		if star, ok := fieldType.(*ast.StarExpr); ok {
+			fieldType = star.X
+		}
+		goType := typeString(fieldType)
+		sqlType, ok := datumTypes[goType]
+		if !ok || goType == "error" || goType == triggerRow {
+			return nil, fmt.Errorf("%s, column %s: type not supported", owner, field.Names[0].Name)
+		}
+		for _, name := range field.Names {
+			if !ast.IsExported(name.Name) {
+				continue
+			}
+			column := Column{Name: tag, Type: sqlType}
+			if column.Name == "" || len(field.Names) > 1 {
+				column.Name = snakeCase(name.Name)
+			}
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%s: rows without exported fields", owner)
+	}
+	return columns, nil
+}
+
+//typeString returns the Go type of the expression as written in datumTypes, e.g. []int, time.Time or map[string]*string
+func typeString(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.ArrayType:
+		return "[]" + typeString(t.Elt)
+	case *ast.StarExpr:
+		return "*" + typeString(t.X)
+	case *ast.SelectorExpr:
+		return typeString(t.X) + "." + t.Sel.Name
+	case *ast.MapType:
+		return "map[" + typeString(t.Key) + "]" + typeString(t.Value)
+	case *ast.Ellipsis:
+		return "..." + typeString(t.Elt)
+	case *ast.IndexExpr:
+		return typeString(t.X) + "[" + typeString(t.Index) + "]"
+	default:
+		return ""
+	}
+}
+
+//snakeCase returns the column name of the field name, e.g. user_id from UserID
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+//sqlReturnType returns the RETURNS clause type of the set returning function
+func (f *SetFunction) sqlReturnType() string {
+	if f.Columns == nil {
+		return "SETOF " + datumTypes[f.ElemType]
+	}
+	columns := make([]string, len(f.Columns))
+	for i, c := range f.Columns {
+		columns[i] = sqlName(c.Name) + " " + c.Type
+	}
+	return "TABLE(" + strings.Join(columns, ", ") + ")"
+}
+
+//Code writes the wrapper function, the returned rows are materialized into an tuplestore
+func (f *SetFunction) Code(w io.Writer) {
+	writeFuncHeader(w, f.Name)
+	if len(f.Params) > 0 {
+		for _, p := range f.Params {
+			w.Write([]byte("var " + p.Name + " " + p.Type + "\n"))
+		}
+		w.Write([]byte("err:=fcinfo.Scan(\n"))
+		for _, p := range f.Params {
+			w.Write([]byte("&" + p.Name + ",\n"))
+		}
+		w.Write([]byte(")\n"))
+		w.Write([]byte(`
+		if(err!=nil){
+			C.elog_error(C.CString(
+				err.Error(),
+			))
+		}
+		`))
+	}
+	f.writeTraceArgs(w)
+	//the context is canceled by returnSet, or when the call is aborted
+	watcher := "nil"
+	if f.Context {
+		watcher = "setWatcher"
+		w.Write([]byte("setCtx, setWatcher := setContext()\n"))
+	}
+	if !f.Error {
+		w.Write([]byte("return returnSet(fcinfo, __" + f.Name + "(\n"))
+		f.writeArgs(w)
+		w.Write([]byte("), " + watcher + ")\n"))
+		w.Write([]byte("}\n"))
+		return
+	}
+	w.Write([]byte("ret, retErr := __" + f.Name + "(\n"))
+	f.writeArgs(w)
+	w.Write([]byte(")\n"))
+	f.writeRaise(w)
+	w.Write([]byte("return returnSet(fcinfo, ret, " + watcher + ")\n"))
+	w.Write([]byte("}\n"))
+}
+
+//writeArgs writes the arguments of the call of the Go function, the context is the first one
+func (f *SetFunction) writeArgs(w io.Writer) {
+	if f.Context {
+		w.Write([]byte("setCtx,\n"))
+	}
+	for _, p := range f.Params {
+		w.Write([]byte(p.arg() + ",\n"))
+	}
+}
+
+//SQL writes the SQL command that creates the function in DB
+func (f *SetFunction) SQL(target SQLTarget, w io.Writer) {
+	f.writeRequires(w)
+	w.Write([]byte("CREATE OR REPLACE FUNCTION " + f.qualifiedName(target) + "("))
+	var paramsString []string
+	for _, p := range f.Params {
+		paramsString = append(paramsString, p.sql())
+	}
+	w.Write([]byte(strings.Join(paramsString, ",")))
+	w.Write([]byte(")\n"))
+	w.Write([]byte("RETURNS " + f.sqlReturnType() + " AS\n"))
+	w.Write([]byte(modulePathname + ", '" + f.Name + "'\n"))
+	f.writeLanguage(target, w)
+	f.writeGrants(target, w)
+	if f.Doc == "" {
+		w.Write([]byte("\n"))
+		return
+	}
+	f.Comment(target, w)
+}
+
+//Describe adds the function to the manifest
+func (f *SetFunction) Describe(m *Manifest) {
+	m.Functions = append(m.Functions, f.manifestFunction(f.sqlReturnType()))
+}
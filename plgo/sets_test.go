@@ -0,0 +1,141 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSnakeCase(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Name", "name"},
+		{"ID", "id"},
+		{"UserID", "user_id"},
+		{"UserName", "user_name"},
+		{"HTTPServer", "http_server"},
+		{"Field2Name", "field2_name"},
+		{"already_snake", "already_snake"},
+	}
+	for _, test := range tests {
+		if got := snakeCase(test.name); got != test.want {
+			t.Errorf("snakeCase(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+//parseStructType returns the first struct type declared in the source of an package
+func parseStructType(t *testing.T, source string) *ast.StructType {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "test.go", "package test\n\n"+source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var structType *ast.StructType
+	ast.Inspect(file, func(n ast.Node) bool {
+		if s, ok := n.(*ast.StructType); ok && structType == nil {
+			structType = s
+		}
+		return structType == nil
+	})
+	if structType == nil {
+		t.Fatal("no struct in the source")
+	}
+	return structType
+}
+
+func TestStructColumns(t *testing.T) {
+	tests := []struct {
+		source string
+		//want are the columns as "name type", err is the part of the expected error
+		want []string
+		err  string
+	}{
+		{"type R struct{ ID int64; UserName string }", []string{"id bigint", "user_name text"}, ""},
+		{"type R struct{ Name string `plgo:\"full_name\"`; At time.Time }", []string{"full_name text", "at timestamptz"}, ""},
+		{"type R struct{ Name string; Secret string `plgo:\"-\"` }", []string{"name text"}, ""},
+		{"type R struct{ Score *float64; Tags []string }", []string{"score double precision", "tags text[]"}, ""},
+		{"type R struct{ Name string; hidden int64 }", []string{"name text"}, ""},
+		{"type R struct{ X, Y int32 `plgo:\"point\"` }", []string{"x integer", "y integer"}, ""},
+		{"type R struct{ Name string `json:\"n\"` }", []string{"name text"}, ""},
+		{"type R struct{ Base; Name string }", nil, "T: embedded fields of the rows are not supported"},
+		{"type R struct{ Ch chan int }", nil, "T, column Ch: type not supported"},
+		{"type R struct{ Err error }", nil, "T, column Err: type not supported"},
+		{"type R struct{ Row TriggerRow }", nil, "T, column Row: type not supported"},
+		{"type R struct{ name string }", nil, "T: rows without exported fields"},
+		{"type R struct{ Name string `plgo:\"-\"` }", nil, "T: rows without exported fields"},
+	}
+	for _, test := range tests {
+		columns, err := structColumns("T", parseStructType(t, test.source))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: error %v, want %q", test.source, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", test.source, err)
+			continue
+		}
+		var got []string
+		for _, c := range columns {
+			got = append(got, c.Name+" "+c.Type)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: columns %q, want %q", test.source, got, test.want)
+		}
+	}
+}
+
+func TestSetFunctionContext(t *testing.T) {
+	tests := []struct {
+		source string
+		//code are the parts of the expected wrapper, err is the part of the expected error
+		code []string
+		err  string
+	}{
+		{
+			source: "func Series(ctx context.Context, n int32) <-chan int32 { return nil }",
+			code:   []string{"setCtx, setWatcher := setContext()\n", "__Series(\nsetCtx,\nn,\n), setWatcher)\n"},
+		},
+		{
+			source: "func Series(ctx context.Context, n int32) (<-chan int32, error) { return nil, nil }",
+			code:   []string{"setCtx, setWatcher := setContext()\n", "return returnSet(fcinfo, ret, setWatcher)\n"},
+		},
+		{
+			source: "func Series(n int32) <-chan int32 { return nil }",
+			code:   []string{"__Series(\nn,\n), nil)\n"},
+		},
+		{source: "func Count(ctx context.Context, n int32) int32 { return 0 }", err: "context.Context is the first parameter only of the functions returning an channel"},
+		{source: "func Series(n int32, ctx context.Context) <-chan int32 { return nil }", err: "context.Context must be just the first parameter"},
+	}
+	for _, test := range tests {
+		code, err := NewCode(parseFuncDecl(t, test.source), nil, nil)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: error %v, want %q", test.source, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", test.source, err)
+			continue
+		}
+		set, ok := code.(*SetFunction)
+		if !ok || len(set.Params) != 1 {
+			t.Errorf("%q: %T %+v isn't an set returning function with the parameter n", test.source, code, code)
+			continue
+		}
+		var wrapper strings.Builder
+		set.Code(&wrapper)
+		for _, part := range test.code {
+			if !strings.Contains(wrapper.String(), part) {
+				t.Errorf("%q: the wrapper doesn't contain %q:\n%s", test.source, part, wrapper.String())
+			}
+		}
+	}
+}
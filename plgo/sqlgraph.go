@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+//entity ids of the generated SQL objects, e.g. "function add(integer,integer)" or "view myext_stat_functions",
+//the unquoted SQL names are case insensitive
+
+func functionEntity(name string, argTypes []string) string {
+	return "function " + strings.ToLower(name) + "(" + strings.Join(argTypes, ",") + ")"
+}
+
+func relationEntity(kind, name string) string {
+	return kind + " " + strings.ToLower(name)
+}
+
+//orderSQL orders the objects so that every object is created after its dependencies,
+//the objects without dependencies between them keep their order.
+//The dependencies on objects that are not generated (e.g. created by sql/pre.sql) are ignored
+func orderSQL(writers []CodeWriter) ([]CodeWriter, error) {
+	index := make(map[string]int)
+	for i, w := range writers {
+		id := w.Entity()
+		if _, ok := index[id]; ok {
+			return nil, fmt.Errorf("SQL object %s is generated twice", id)
+		}
+		index[id] = i
+	}
+	//dependents are the objects waiting for the object, pending is the number of the missing dependencies
+	dependents := make([][]int, len(writers))
+	pending := make([]int, len(writers))
+	for i, w := range writers {
+		for _, dep := range w.Dependencies() {
+			if j, ok := index[dep]; ok && j != i {
+				dependents[j] = append(dependents[j], i)
+				pending[i]++
+			} else if ok {
+				return nil, fmt.Errorf("SQL object %s depends on itself", w.Entity())
+			}
+		}
+	}
+	ordered := make([]CodeWriter, 0, len(writers))
+	done := make([]bool, len(writers))
+	//the first ready object is emitted, so the order is stable
+	for len(ordered) < len(writers) {
+		next := -1
+		for i := range writers {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, fmt.Errorf("Dependency cycle between SQL objects (-> depends on): %s", strings.Join(findCycle(writers, index, done), " -> "))
+		}
+		done[next] = true
+		ordered = append(ordered, writers[next])
+		for _, i := range dependents[next] {
+			pending[i]--
+		}
+	}
+	return ordered, nil
+}
+
+//findCycle returns the entity ids of an dependency cycle among the objects that are not done
+func findCycle(writers []CodeWriter, index map[string]int, done []bool) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(writers))
+	var stack []int
+	var cycle []string
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		state[i] = visiting
+		stack = append(stack, i)
+		for _, dep := range writers[i].Dependencies() {
+			j, ok := index[dep]
+			if !ok || done[j] {
+				continue
+			}
+			if state[j] == visiting {
+				for k := len(stack) - 1; k >= 0; k-- {
+					cycle = append([]string{writers[stack[k]].Entity()}, cycle...)
+					if stack[k] == j {
+						break
+					}
+				}
+				cycle = append(cycle, writers[j].Entity())
+				return true
+			}
+			if state[j] == unvisited && visit(j) {
+				return true
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+		return false
+	}
+	for i := range writers {
+		if !done[i] && state[i] == unvisited && visit(i) {
+			break
+		}
+	}
+	return cycle
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//testObject is an SQL object with its dependencies, it generates no code
+type testObject struct {
+	entity       string
+	dependencies []string
+}
+
+func (o *testObject) FuncDec() string                   { return "" }
+func (o *testObject) Code(w io.Writer)                  {}
+func (o *testObject) SQL(target SQLTarget, w io.Writer) {}
+func (o *testObject) Describe(m *Manifest)              {}
+func (o *testObject) Entity() string                    { return o.entity }
+func (o *testObject) Dependencies() []string            { return o.dependencies }
+
+//testObjects returns the objects declared as "entity:dependency,dependency"
+func testObjects(declarations ...string) []CodeWriter {
+	var writers []CodeWriter
+	for _, declaration := range declarations {
+		entity, deps, _ := strings.Cut(declaration, ":")
+		object := &testObject{entity: entity}
+		if deps != "" {
+			object.dependencies = strings.Split(deps, ",")
+		}
+		writers = append(writers, object)
+	}
+	return writers
+}
+
+func TestOrderSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []string
+		//want are the entities in the created order, err is the part of the expected error
+		want []string
+		err  string
+	}{
+		{name: "no dependencies keep the order", objects: []string{"c", "a", "b"}, want: []string{"c", "a", "b"}},
+		{name: "dependency first", objects: []string{"f:t", "t"}, want: []string{"t", "f"}},
+		{name: "chain", objects: []string{"a:b", "b:c", "c"}, want: []string{"c", "b", "a"}},
+		{name: "stable", objects: []string{"x", "f:t", "y", "t", "z"}, want: []string{"x", "y", "t", "f", "z"}},
+		{name: "diamond", objects: []string{"d:b,c", "b:a", "c:a", "a"}, want: []string{"a", "b", "c", "d"}},
+		{name: "external dependency", objects: []string{"f:pre.sql type", "g:f"}, want: []string{"f", "g"}},
+		{name: "duplicate", objects: []string{"a", "a"}, err: "SQL object a is generated twice"},
+		{name: "self", objects: []string{"a:a"}, err: "SQL object a depends on itself"},
+		{name: "cycle", objects: []string{"x", "a:b", "b:c", "c:a"}, err: "Dependency cycle between SQL objects (-> depends on): a -> b -> c -> a"},
+		{name: "cycle after ready objects", objects: []string{"a:b", "b:a", "c:a"}, err: "a -> b -> a"},
+	}
+	for _, test := range tests {
+		ordered, err := orderSQL(testObjects(test.objects...))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		var entities []string
+		for _, w := range ordered {
+			entities = append(entities, w.Entity())
+		}
+		if !reflect.DeepEqual(entities, test.want) {
+			t.Errorf("%s: order %q, want %q", test.name, entities, test.want)
+		}
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		objects []string
+		//done are the indexes of the already created objects
+		done []int
+		want []string
+	}{
+		{objects: []string{"a:b", "b:a"}, want: []string{"a", "b", "a"}},
+		{objects: []string{"a:b", "b:c", "c:b"}, want: []string{"b", "c", "b"}},
+		{objects: []string{"a:b", "b:c", "c:a", "d:a"}, done: nil, want: []string{"a", "b", "c", "a"}},
+		{objects: []string{"a:b", "b"}, done: []int{1}, want: nil},
+		{objects: []string{"a", "b:a"}, want: nil},
+	}
+	for _, test := range tests {
+		writers := testObjects(test.objects...)
+		index := make(map[string]int)
+		for i, w := range writers {
+			index[w.Entity()] = i
+		}
+		done := make([]bool, len(writers))
+		for _, i := range test.done {
+			done[i] = true
+		}
+		if cycle := findCycle(writers, index, done); !reflect.DeepEqual(cycle, test.want) {
+			t.Errorf("%q: cycle %q, want %q", test.objects, cycle, test.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"regexp"
+	"strings"
+)
+
+//sqlKeywords are the keywords of PostgreSQL that can't be used as some of the function, parameter, type or column names,
+//the reserved, the type and function name and the column name keywords
+var sqlKeywords = make(map[string]bool)
+
+func init() {
+	for _, keyword := range strings.Fields(`all analyse analyze and any array as asc asymmetric both case cast check collate column
+		constraint create current_catalog current_date current_role current_time current_timestamp current_user default deferrable
+		desc distinct do else end except false fetch for foreign from grant group having in initially intersect into lateral leading
+		limit localtime localtimestamp not null offset on only or order placing primary references returning select session_user
+		some symmetric system_user table then to trailing true union unique user using variadic when where window with
+		authorization binary collation concurrently cross current_schema freeze full ilike inner is isnull join left like natural
+		notnull outer overlaps right similar tablesample verbose
+		between bigint bit boolean char character coalesce dec decimal exists extract float greatest grouping inout int integer
+		interval json json_array json_arrayagg json_object json_objectagg json_scalar json_serialize least national nchar none
+		normalize nullif numeric out overlay position precision real row setof smallint substring time timestamp treat trim values
+		varchar xmlattributes xmlconcat xmlelement xmlexists xmlforest xmlnamespaces xmlparse xmlpi xmlroot xmlserialize xmltable`) {
+		sqlKeywords[keyword] = true
+	}
+}
+
+//sqlIdentRe matches the names that are valid unquoted SQL identifiers, besides the keywords
+var sqlIdentRe = regexp.MustCompile(`^[\pL_][\pL\pN_$]*$`)
+
+//quotedIdentRe matches the quoted SQL identifiers of //plgo:name, e.g. "GetUser", they keep the case of the name
+var quotedIdentRe = regexp.MustCompile(`^"(?:[^"]|"")+"$`)
+
+//sqlName returns the SQL name of an function, parameter, type or column. The names are written unquoted, so they are
+//case insensitive, only the keywords are quoted in lowercase (Select is "select") and the other names aren't identifiers.
+//The names quoted by //plgo:name are written as they are
+func sqlName(name string) string {
+	if quotedIdentRe.MatchString(name) {
+		return name
+	}
+	if lower := strings.ToLower(name); sqlKeywords[lower] {
+		return quoteIdent(lower)
+	}
+	if !sqlIdentRe.MatchString(name) {
+		return quoteIdent(name)
+	}
+	return name
+}
+
+//quoteControlValue quotes the string value of the control file, its parser reads the backslash escapes
+func quoteControlValue(value string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), "'", "''") + "'"
+}
+
+//functionNaming is the conversion of the Go names of the functions into their SQL names, the naming of plgo.toml:
+//go (or empty) keeps the Go name, snake_case converts ConcatAll into concat_all
+var functionNaming string
+
+//functionSQLName returns the SQL name and the schema of the function declared with the name directive,
+//e.g. //plgo:name my_name schema=util, the name converted by the functionNaming without the name.
+//An quoted name, e.g. //plgo:name "GetUser", is case sensitive
+func functionSQLName(function *ast.FuncDecl) (string, string, error) {
+	name, schema := "", ""
+	if functionNaming == "snake_case" {
+		name = snakeCase(function.Name.Name)
+	}
+	for _, word := range strings.Fields(strings.Join(functionDirectives(function)["name"], " ")) {
+		if value, ok := strings.CutPrefix(word, "schema="); ok {
+			schema = value
+			continue
+		}
+		name = word
+	}
+	if name != "" && !sqlIdentRe.MatchString(name) && !quotedIdentRe.MatchString(name) {
+		return "", "", fmt.Errorf("Function %s: //plgo:name %s isn't an SQL identifier", function.Name.Name, name)
+	}
+	if schema != "" && (!sqlIdentRe.MatchString(schema) || strings.HasPrefix(strings.ToLower(schema), "pg_")) {
+		return "", "", fmt.Errorf("Function %s: schema %s isn't an SQL identifier or has the reserved pg_ prefix", function.Name.Name, schema)
+	}
+	return name, schema, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestSQLName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"add", "add"},
+		{"ConcatAll", "ConcatAll"},
+		{"user_id", "user_id"},
+		{"limit", `"limit"`},
+		{"Select", `"select"`},
+		{"ORDER", `"order"`},
+		{"integer", `"integer"`},
+		{"my-name", `"my-name"`},
+		{`a"b`, `"a""b"`},
+		{"1st", `"1st"`},
+		{"naïve", "naïve"},
+		{`"GetUser"`, `"GetUser"`},
+	}
+	for _, test := range tests {
+		if got := sqlName(test.name); got != test.want {
+			t.Errorf("sqlName(%q) = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestQuoting(t *testing.T) {
+	tests := []struct {
+		quote       func(string) string
+		value, want string
+	}{
+		{quoteIdent, "util", `"util"`},
+		{quoteIdent, `my "schema"`, `"my ""schema"""`},
+		{quoteLiteral, "it's", `'it''s'`},
+		{quoteLiteral, `C:\path`, `'C:\path'`},
+		{quoteLiteral, "", "''"},
+		{quoteControlValue, "it's", `'it''s'`},
+		{quoteControlValue, `C:\path`, `'C:\\path'`},
+	}
+	for _, test := range tests {
+		if got := test.quote(test.value); got != test.want {
+			t.Errorf("quoting %q = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestQualify(t *testing.T) {
+	tests := []struct {
+		schema, name, want string
+	}{
+		{"", "add", "add"},
+		{"", "limit", `"limit"`},
+		{"util", "add", `"util".add`},
+		{"My Schema", "order(integer,integer)", `"My Schema"."order"(integer,integer)`},
+		{"", "add(integer, text)", "add(integer, text)"},
+	}
+	for _, test := range tests {
+		if got := (SQLTarget{Schema: test.schema}).qualify(test.name); got != test.want {
+			t.Errorf("qualify(%q, %q) = %s, want %s", test.schema, test.name, got, test.want)
+		}
+	}
+}
+
+func TestExtensionName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"ex", true},
+		{"my_ext2", true},
+		{"_ext", true},
+		{"MyExt", false},
+		{"2ext", false},
+		{"my-ext", false},
+		{"ext'; DROP TABLE t; --", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if valid := extensionNameRe.MatchString(test.name); valid != test.valid {
+			t.Errorf("extension name %q valid %v, want %v", test.name, valid, test.valid)
+		}
+	}
+}
+
+//parseFuncDecl returns the first function declared in the source of an package
+func parseFuncDecl(t *testing.T, source string) *ast.FuncDecl {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "test.go", "package test\n\n"+source, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decl := range file.Decls {
+		if function, ok := decl.(*ast.FuncDecl); ok {
+			return function
+		}
+	}
+	t.Fatal("no function in the source")
+	return nil
+}
+
+func TestFunctionSQLName(t *testing.T) {
+	tests := []struct {
+		source, naming string
+		//name and schema are the SQL name and schema, err is the part of the expected error
+		name, schema, err string
+	}{
+		{source: "func ConcatAll() {}"},
+		{source: "func ConcatAll() {}", naming: "snake_case", name: "concat_all"},
+		{source: "//plgo:name concat\nfunc ConcatAll() {}", naming: "snake_case", name: "concat"},
+		{source: "//plgo:name concat schema=util\nfunc ConcatAll() {}", name: "concat", schema: "util"},
+		{source: "//plgo:name schema=util\nfunc ConcatAll() {}", schema: "util"},
+		{source: "//plgo:name \"GetUser\"\nfunc GetUser() {}", name: `"GetUser"`},
+		{source: "//plgo:name concat-all\nfunc ConcatAll() {}", err: "//plgo:name concat-all isn't an SQL identifier"},
+		{source: "//plgo:name schema=pg_util\nfunc ConcatAll() {}", err: "has the reserved pg_ prefix"},
+		{source: "//plgo:name schema=my\"schema\nfunc ConcatAll() {}", err: "isn't an SQL identifier"},
+	}
+	defer func(naming string) { functionNaming = naming }(functionNaming)
+	for _, test := range tests {
+		functionNaming = test.naming
+		name, schema, err := functionSQLName(parseFuncDecl(t, test.source))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: error %v, want %q", test.source, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", test.source, err)
+			continue
+		}
+		if name != test.name || schema != test.schema {
+			t.Errorf("%q: name %q schema %q, want %q %q", test.source, name, schema, test.name, test.schema)
+		}
+	}
+}
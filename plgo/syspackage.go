@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//debArchs and rpmArchs are the package architectures of GOARCH, GOARCH is used for the others
+var (
+	debArchs = map[string]string{"386": "i386", "arm": "armhf", "ppc64le": "ppc64el"}
+	rpmArchs = map[string]string{"amd64": "x86_64", "386": "i686", "arm64": "aarch64", "arm": "armv7hl"}
+)
+
+//systemPackage is the deb or rpm package of the built extension for an PostgreSQL major version
+type systemPackage struct {
+	mw         *ModuleWriter
+	buildDir   string
+	maintainer string
+	license    string
+	pgVersion  int
+}
+
+//parseSystemPackage parses the flags of plgo package deb|rpm and checks the built extension
+func parseSystemPackage(format string, args []string) (*systemPackage, error) {
+	flags := flag.NewFlagSet("package "+format, flag.ExitOnError)
+	buildDir := flags.String("build", "build", "directory of the built extension")
+	maintainer := flags.String("maintainer", "", "maintainer of the package, \"name <email>\" of git config by default")
+	license := flags.String("license", "unknown", "license of the package (rpm)")
+	pgVersion := flags.Int("pg", 0, "PostgreSQL major version of the built extension, the version of pg_config by default")
+	flags.Parse(args)
+	moduleWriter, err := builtExtension(flags, *buildDir)
+	if err != nil {
+		return nil, err
+	}
+	library := filepath.Join(*buildDir, moduleWriter.PackageName+".so")
+	if _, err = os.Stat(library); err != nil {
+		return nil, fmt.Errorf("%s is missing, build the extension for linux, e.g. with plgo build -docker", library)
+	}
+	if *pgVersion == 0 {
+		if *pgVersion, err = serverVersion(); err != nil {
+			return nil, fmt.Errorf("%w, set the PostgreSQL version with -pg", err)
+		}
+	}
+	if *maintainer == "" {
+		if *maintainer = gitMaintainer(); *maintainer == "" {
+			return nil, fmt.Errorf("Cannot find the maintainer in git config, set it with -maintainer")
+		}
+	}
+	return &systemPackage{mw: moduleWriter, buildDir: *buildDir, maintainer: *maintainer, license: *license, pgVersion: *pgVersion}, nil
+}
+
+//stage copies the shared object into libdir and the control file and the scripts into the extension directory
+//of sharedir, under the root directory. It returns the paths of the files in the package
+func (p *systemPackage) stage(root, libdir, sharedir string) ([]string, error) {
+	name := p.mw.PackageName
+	scripts, err := filepath.Glob(filepath.Join(p.buildDir, name+"--*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{filepath.Join(p.buildDir, name+".so"): libdir, filepath.Join(p.buildDir, name+".control"): sharedir + "/extension"}
+	for _, script := range scripts {
+		files[script] = sharedir + "/extension"
+	}
+	if err = os.RemoveAll(root); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for source, dir := range files {
+		data, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		path := dir + "/" + filepath.Base(source)
+		target := filepath.Join(root, filepath.FromSlash(path))
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		mode := os.FileMode(0644)
+		if dir == libdir {
+			mode = 0755
+		}
+		if err = ioutil.WriteFile(target, data, mode); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+//packageDeb lays out the Debian package postgresql-<version>-<extension> in build/deb with the directories
+//of postgresql-common and writes its DEBIAN/control, dpkg-deb --build builds it
+func packageDeb(args []string) error {
+	p, err := parseSystemPackage("deb", args)
+	if err != nil {
+		return err
+	}
+	version := strconv.Itoa(p.pgVersion)
+	//the underscores aren't allowed in the Debian package names
+	name := "postgresql-" + version + "-" + strings.ReplaceAll(p.mw.PackageName, "_", "-")
+	root := filepath.Join(p.buildDir, "deb", name)
+	if _, err = p.stage(root, "usr/lib/postgresql/"+version+"/lib", "usr/share/postgresql/"+version); err != nil {
+		return err
+	}
+	arch := runtime.GOARCH
+	if debArch, ok := debArchs[arch]; ok {
+		arch = debArch
+	}
+	control := "Package: " + name + "\n" +
+		"Version: " + p.mw.Version + "-1\n" +
+		"Architecture: " + arch + "\n" +
+		"Maintainer: " + p.maintainer + "\n" +
+		"Depends: postgresql-" + version + "\n" +
+		"Section: database\n" +
+		"Priority: optional\n" +
+		"Description: " + p.mw.comment() + "\n"
+	if strings.TrimSpace(p.mw.Doc) != "" {
+		control += " " + p.mw.description() + "\n"
+	}
+	if err = os.MkdirAll(filepath.Join(root, "DEBIAN"), 0755); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(root, "DEBIAN", "control"), []byte(control), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s, build the package with: dpkg-deb --root-owner-group --build %s\n", root, root)
+	return nil
+}
+
+//packageRPM lays out the files of the PGDG RPM package <extension>_<version> in build/rpm/root with the directories
+//of /usr/pgsql-<version> and writes its spec file, rpmbuild -bb builds it
+func packageRPM(args []string) error {
+	p, err := parseSystemPackage("rpm", args)
+	if err != nil {
+		return err
+	}
+	version := strconv.Itoa(p.pgVersion)
+	name := p.mw.PackageName + "_" + version
+	dir := filepath.Join(p.buildDir, "rpm")
+	paths, err := p.stage(filepath.Join(dir, "root"), "usr/pgsql-"+version+"/lib", "usr/pgsql-"+version+"/share")
+	if err != nil {
+		return err
+	}
+	arch := runtime.GOARCH
+	if rpmArch, ok := rpmArchs[arch]; ok {
+		arch = rpmArch
+	}
+	//the RPM versions can't contain hyphens
+	spec := "Name: " + name + "\n" +
+		"Version: " + strings.ReplaceAll(p.mw.Version, "-", "~") + "\n" +
+		"Release: 1%{?dist}\n" +
+		"Summary: " + p.mw.comment() + "\n" +
+		"License: " + p.license + "\n" +
+		"Packager: " + p.maintainer + "\n" +
+		"BuildArch: " + arch + "\n" +
+		"Requires: postgresql" + version + "-server\n" +
+		"\n%description\n" + p.mw.description() + "\n" +
+		"\n%install\n" +
+		"cp -a %{_sourcedir}/root/. %{buildroot}/\n" +
+		"\n%files\n"
+	for _, path := range paths {
+		spec += "/" + path + "\n"
+	}
+	specPath := filepath.Join(dir, name+".spec")
+	if err = ioutil.WriteFile(specPath, []byte(spec), 0644); err != nil {
+		return err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s, build the package with: rpmbuild -bb --define '_sourcedir %s' %s\n", specPath, absDir, specPath)
+	return nil
+}
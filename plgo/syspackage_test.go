@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//builtPackage writes the package my_ext and the files of its build into the temporary directory,
+//it returns the package directory and the build directory
+func builtPackage(t *testing.T) (string, string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "my_ext")
+	writeFiles(t, dir, map[string]string{
+		"ext.go":                     extensionSource,
+		"build/my_ext.manifest.json": `{"extension": "my_ext", "version": "1.2-rc1", "functions": []}`,
+		"build/my_ext.so":            "ELF",
+		"build/my_ext.control":       "default_version = '1.2-rc1'\n",
+		"build/my_ext--1.2-rc1.sql":  "CREATE FUNCTION tags(tags hstore) RETURNS integer AS 'MODULE_PATHNAME', 'Tags' LANGUAGE c;\n",
+		"build/my_ext--1.1--1.2.sql": "",
+	})
+	return dir, filepath.Join(dir, "build")
+}
+
+//checkFiles checks that the files exist under the root directory
+func checkFiles(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(file))); err != nil {
+			t.Errorf("the package doesn't contain %s: %s", file, err)
+		}
+	}
+}
+
+func TestPackageDeb(t *testing.T) {
+	dir, buildDir := builtPackage(t)
+	if err := packageDeb([]string{"-build", buildDir, "-maintainer", "Jo <jo@example.com>", "-pg", "16", dir}); err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(buildDir, "deb", "postgresql-16-my-ext")
+	checkFiles(t, root, "usr/lib/postgresql/16/lib/my_ext.so", "usr/share/postgresql/16/extension/my_ext.control",
+		"usr/share/postgresql/16/extension/my_ext--1.2-rc1.sql", "usr/share/postgresql/16/extension/my_ext--1.1--1.2.sql")
+	control, err := os.ReadFile(filepath.Join(root, "DEBIAN", "control"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Package: postgresql-16-my-ext\n", "Version: 1.2-rc1-1\n", "Maintainer: Jo <jo@example.com>\n",
+		"Depends: postgresql-16\n", "Description: my_ext extension\n Package ext tags the rows.\n"} {
+		if !strings.Contains(string(control), line) {
+			t.Errorf("the control file doesn't contain %q:\n%s", line, control)
+		}
+	}
+}
+
+func TestPackageRPM(t *testing.T) {
+	dir, buildDir := builtPackage(t)
+	if err := packageRPM([]string{"-build", buildDir, "-maintainer", "Jo <jo@example.com>", "-license", "MIT", "-pg", "15", dir}); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, filepath.Join(buildDir, "rpm", "root"), "usr/pgsql-15/lib/my_ext.so", "usr/pgsql-15/share/extension/my_ext.control")
+	spec, err := os.ReadFile(filepath.Join(buildDir, "rpm", "my_ext_15.spec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Name: my_ext_15\n", "Version: 1.2~rc1\n", "License: MIT\n", "Requires: postgresql15-server\n",
+		"\n%files\n/usr/pgsql-15/lib/my_ext.so\n/usr/pgsql-15/share/extension/my_ext--1.1--1.2.sql\n" +
+			"/usr/pgsql-15/share/extension/my_ext--1.2-rc1.sql\n/usr/pgsql-15/share/extension/my_ext.control\n"} {
+		if !strings.Contains(string(spec), line) {
+			t.Errorf("the spec file doesn't contain %q:\n%s", line, spec)
+		}
+	}
+	os.Remove(filepath.Join(buildDir, "my_ext.so"))
+	if err := packageRPM([]string{"-build", buildDir, "-maintainer", "Jo", "-pg", "15", dir}); err == nil || !strings.Contains(err.Error(), "build the extension for linux") {
+		t.Errorf("packageRPM without the shared object: %v", err)
+	}
+}
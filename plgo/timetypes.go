@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+//timeTypes are the SQL types of the time.Time parameters and results selectable with the //plgo:time directive,
+//timestamptz is the default
+var timeTypes = map[string]bool{"timestamptz": true, "timestamp": true, "date": true, "time": true}
+
+//timeReturn names the result in the //plgo:time directive
+const timeReturn = "return"
+
+//parseTimeDirective returns the SQL types declared with //plgo:time name=type,... by the parameter names,
+//the type of the result is declared as return=type, e.g. //plgo:time day=date,return=timestamp
+func parseTimeDirective(function string, values []string) (map[string]string, error) {
+	types := make(map[string]string)
+	for _, value := range values {
+		name, sqlType, ok := strings.Cut(value, "=")
+		name, sqlType = strings.TrimSpace(name), strings.ToLower(strings.TrimSpace(sqlType))
+		if !ok || name == "" || !timeTypes[sqlType] {
+			return nil, fmt.Errorf("Function %s: invalid //plgo:time %s, expected name=timestamptz|timestamp|date|time", function, value)
+		}
+		types[name] = sqlType
+	}
+	return types, nil
+}
+
+//timeRange is the Go type of the time ranges in the generated code
+const timeRange = "Range[time.Time]"
+
+//timeRangeTypes are the range types of the //plgo:time types, there is no range of time
+var timeRangeTypes = map[string]string{"timestamptz": "tstzrange", "timestamp": "tsrange", "date": "daterange"}
+
+//timeSQLType returns the SQL type of the time.Time (an pointer or slice of it) or time range Go type declared
+//as the //plgo:time type, "" if the Go type isn't an time
+func timeSQLType(goType, timeType string) string {
+	switch strings.TrimPrefix(strings.TrimPrefix(goType, "[]"), "*") {
+	case "time.Time":
+		if strings.HasPrefix(goType, "[]") {
+			return timeType + "[]"
+		}
+		return timeType
+	case timeRange:
+		if strings.HasPrefix(goType, "[]") {
+			return ""
+		}
+		return timeRangeTypes[timeType]
+	}
+	return ""
+}
+
+//setTimeTypes sets the SQL types of the time.Time and time range parameters declared with //plgo:time, the arrays are arrays of the type
+func setTimeTypes(function string, params []Param, types map[string]string) error {
+	for name, sqlType := range types {
+		if name == timeReturn {
+			continue
+		}
+		found := false
+		for i, p := range params {
+			if p.Name != name {
+				continue
+			}
+			timeSQL := timeSQLType(p.Type, sqlType)
+			if timeSQL == "" {
+				return fmt.Errorf("Function %s: //plgo:time %s=%s is not allowed for the parameter of type %s", function, name, sqlType, p.Type)
+			}
+			params[i].SQLType, found = timeSQL, true
+		}
+		if !found {
+			return fmt.Errorf("Function %s: //plgo:time names no parameter %s", function, name)
+		}
+	}
+	return nil
+}
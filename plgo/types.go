@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//CompositeType is an struct of the package annotated with //plgo:type, it is created as an composite type
+//and the functions take and return it as an row instead of jsonb.
+//An string type annotated with //plgo:enum is created as an enum type with the Labels
+type CompositeType struct {
+	//GoName is the name of the struct, Name the name of the SQL type
+	GoName, Name string
+	Columns      []Column
+	Doc          string
+	//Labels are the labels of the enum type, nil for an composite type
+	Labels []string
+}
+
+//compositeTypes returns the composite types of the package by the struct names,
+//the type is named by the directive (//plgo:type name) or the struct name in snake case
+func compositeTypes(packageAst *ast.Package) (map[string]*CompositeType, error) {
+	composites := make(map[string]*CompositeType)
+	for _, file := range packageAst.Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				doc := typeSpec.Doc
+				if doc == nil && len(gen.Specs) == 1 {
+					doc = gen.Doc
+				}
+				if names, ok := docDirectives(doc)["enum"]; ok {
+					enum, err := enumType(packageAst, typeSpec, names, doc)
+					if err != nil {
+						return nil, err
+					}
+					composites[enum.GoName] = enum
+					continue
+				}
+				names, ok := docDirectives(doc)["type"]
+				if !ok {
+					continue
+				}
+				structType, ok := typeSpec.Type.(*ast.StructType)
+				if !ok {
+					return nil, fmt.Errorf("Type %s: only structs can be composite types", typeSpec.Name.Name)
+				}
+				columns, err := structColumns("Type "+typeSpec.Name.Name, structType)
+				if err != nil {
+					return nil, err
+				}
+				composite := &CompositeType{GoName: typeSpec.Name.Name, Name: snakeCase(typeSpec.Name.Name), Columns: columns, Doc: doc.Text()}
+				if len(names) > 0 {
+					composite.Name = names[0]
+				}
+				composites[composite.GoName] = composite
+			}
+		}
+	}
+	return composites, nil
+}
+
+//enumType returns the enum type of the string type annotated with //plgo:enum [name], its labels are listed
+//with //plgo:labels or they are the values of the constants of the type in the order of declaration
+func enumType(packageAst *ast.Package, typeSpec *ast.TypeSpec, names []string, doc *ast.CommentGroup) (*CompositeType, error) {
+	if ident, ok := typeSpec.Type.(*ast.Ident); !ok || ident.Name != "string" {
+		return nil, fmt.Errorf("Type %s: only string types can be enum types", typeSpec.Name.Name)
+	}
+	enum := &CompositeType{GoName: typeSpec.Name.Name, Name: snakeCase(typeSpec.Name.Name), Doc: doc.Text(), Labels: docDirectives(doc)["labels"]}
+	if len(names) > 0 {
+		enum.Name = names[0]
+	}
+	if enum.Labels == nil {
+		labels, err := enumConstants(packageAst, enum.GoName)
+		if err != nil {
+			return nil, err
+		}
+		enum.Labels = labels
+	}
+	if len(enum.Labels) == 0 {
+		return nil, fmt.Errorf("Type %s: the enum has no labels, declare constants of the type or //plgo:labels", enum.GoName)
+	}
+	seen := make(map[string]bool)
+	for _, label := range enum.Labels {
+		if seen[label] {
+			return nil, fmt.Errorf("Type %s: duplicate enum label %q", enum.GoName, label)
+		}
+		seen[label] = true
+	}
+	return enum, nil
+}
+
+//enumConstants returns the values of the string constants of the type, the files are read in the order of their names
+func enumConstants(packageAst *ast.Package, typeName string) ([]string, error) {
+	fileNames := make([]string, 0, len(packageAst.Files))
+	for name := range packageAst.Files {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+	var labels []string
+	for _, name := range fileNames {
+		for _, decl := range packageAst.Files[name].Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				valueSpec := spec.(*ast.ValueSpec)
+				if ident, ok := valueSpec.Type.(*ast.Ident); !ok || ident.Name != typeName {
+					continue
+				}
+				for i, value := range valueSpec.Values {
+					lit, ok := value.(*ast.BasicLit)
+					if !ok || lit.Kind != token.STRING {
+						return nil, fmt.Errorf("Type %s: the constant %s must be an string literal", typeName, valueSpec.Names[i].Name)
+					}
+					label, err := strconv.Unquote(lit.Value)
+					if err != nil {
+						return nil, err
+					}
+					labels = append(labels, label)
+				}
+			}
+		}
+	}
+	return labels, nil
+}
+
+//isEnum reports if the type is an enum type, nil is not
+func (t *CompositeType) isEnum() bool {
+	return t != nil && t.Labels != nil
+}
+
+//isRow reports if the type is an composite type converted as an row, nil is not
+func (t *CompositeType) isRow() bool {
+	return t != nil && t.Labels == nil
+}
+
+//FuncDec returns nothing, type isn't a function
+func (t *CompositeType) FuncDec() string {
+	return ""
+}
+
+//Code does nothing, the struct is declared in the package
+func (t *CompositeType) Code(w io.Writer) {}
+
+//SQL writes the SQL command that creates the type in DB
+func (t *CompositeType) SQL(target SQLTarget, w io.Writer) {
+	if t.isEnum() {
+		labels := make([]string, len(t.Labels))
+		for i, label := range t.Labels {
+			labels[i] = quoteLiteral(label)
+		}
+		w.Write([]byte("CREATE TYPE " + target.qualify(t.Name) + " AS ENUM (" + strings.Join(labels, ", ") + ");\n"))
+	} else {
+		columns := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			columns[i] = "\t" + sqlName(c.Name) + " " + c.Type
+		}
+		w.Write([]byte("CREATE TYPE " + target.qualify(t.Name) + " AS (\n" + strings.Join(columns, ",\n") + "\n);\n"))
+	}
+	if t.Doc == "" {
+		w.Write([]byte("\n"))
+		return
+	}
+	w.Write([]byte("COMMENT ON TYPE " + target.qualify(t.Name) + " IS " + quoteLiteral(t.Doc) + ";\n\n"))
+}
+
+//Entity returns the id of the type
+func (t *CompositeType) Entity() string {
+	return relationEntity("type", t.Name)
+}
+
+//Dependencies returns nothing, the columns have builtin types and the enums none
+func (t *CompositeType) Dependencies() []string {
+	return nil
+}
+
+//Describe adds the type to the manifest
+func (t *CompositeType) Describe(m *Manifest) {
+	m.Relations = append(m.Relations, ManifestRelation{Kind: "type", Name: t.Name, Doc: strings.TrimSpace(t.Doc)})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+//scriptObjectRe matches the statement creating an object in an extension script, the name of an cast
+//is its (source AS target) types
+var scriptObjectRe = regexp.MustCompile(`(?im)^CREATE\s+(OR\s+REPLACE\s+)?(FUNCTION|PROCEDURE|AGGREGATE|TYPE|VIEW|TABLE|INDEX|SEQUENCE|` +
+	`SCHEMA|CAST|OPERATOR\s+CLASS|OPERATOR|EVENT\s+TRIGGER)\s+(IF\s+NOT\s+EXISTS\s+)?(\([^)]*\)|[^\s(;]+)`)
+
+//operatorArgRe matches the LEFTARG and RIGHTARG options of CREATE OPERATOR
+var operatorArgRe = regexp.MustCompile(`(?i)\b(LEFT|RIGHT)ARG\s*=\s*([^,\n)]+)`)
+
+//operatorClassMethodRe matches the index method of CREATE OPERATOR CLASS
+var operatorClassMethodRe = regexp.MustCompile(`(?i)\bUSING\s+(\w+)`)
+
+//defaultRe matches the default value of an function parameter
+var defaultRe = regexp.MustCompile(`(?is)\s+(DEFAULT\s|=).*$`)
+
+//scriptObject is an SQL object created by an extension script
+type scriptObject struct {
+	//kind is function, procedure, aggregate, type, view, table, index, sequence, schema, cast, operator,
+	//operator class or event trigger. signature is the name of the object as written by DROP, with the parameter types
+	//for an function, procedure or aggregate, the argument types for an operator and the index method for an operator class
+	kind, signature string
+	//replaceable is true if the object is created with CREATE OR REPLACE
+	replaceable bool
+	//header is the first line of the statement, returns the RETURNS clause of an function
+	header, returns string
+	//text are the statements creating the object, with its grants and comment
+	text string
+}
+
+//key identifies the object, the unquoted SQL names are case insensitive
+func (o *scriptObject) key() string {
+	return o.kind + " " + strings.ToLower(o.signature)
+}
+
+//parseScript returns the objects created by the extension script in their order,
+//an object lasts until the next CREATE statement, the trailing comments are not part of it
+func parseScript(script string) []*scriptObject {
+	matches := scriptObjectRe.FindAllStringSubmatchIndex(script, -1)
+	objects := make([]*scriptObject, 0, len(matches))
+	for i, match := range matches {
+		end := len(script)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		object := &scriptObject{
+			kind:        strings.ToLower(strings.Join(strings.Fields(script[match[4]:match[5]]), " ")),
+			signature:   script[match[8]:match[9]],
+			replaceable: match[2] >= 0,
+			text:        trimScriptTail(script[match[0]:end]),
+		}
+		lines := strings.Split(object.text, "\n")
+		object.header = strings.TrimSpace(lines[0])
+		for _, line := range lines[1:] {
+			if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line)), "RETURNS ") {
+				object.returns = strings.TrimSpace(line)
+				break
+			}
+		}
+		switch object.kind {
+		case "function", "procedure", "aggregate":
+			object.signature += "(" + strings.Join(parameterTypes(object.header[match[9]-match[0]:]), ",") + ")"
+		case "cast":
+			object.signature = strings.Join(strings.Fields(object.signature), " ")
+		case "operator":
+			args := map[string]string{"left": "NONE", "right": "NONE"}
+			for _, arg := range operatorArgRe.FindAllStringSubmatch(object.text, 2) {
+				args[strings.ToLower(arg[1])] = strings.ToLower(strings.TrimSpace(arg[2]))
+			}
+			object.signature += "(" + args["left"] + "," + args["right"] + ")"
+		case "operator class":
+			if method := operatorClassMethodRe.FindStringSubmatch(object.text); method != nil {
+				object.signature += " USING " + strings.ToLower(method[1])
+			}
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+//trimScriptTail removes the trailing empty lines and comments (of the next object) from the statements
+func trimScriptTail(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for len(lines) > 1 {
+		last := strings.TrimSpace(lines[len(lines)-1])
+		if last != "" && !strings.HasPrefix(last, "--") {
+			break
+		}
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+//parameterTypes returns the types of the parameter list, e.g. (a integer, b text DEFAULT '') is integer, text,
+//(IN a integer, OUT b text) is integer
+func parameterTypes(params string) []string {
+	start, end := strings.Index(params, "("), strings.LastIndex(params, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+	var types []string
+	depth, from := 0, start+1
+	for i := start + 1; i <= end; i++ {
+		switch params[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			fallthrough
+		case ',':
+			if depth > 0 {
+				continue
+			}
+			param := strings.TrimSpace(defaultRe.ReplaceAllString(params[from:i], ""))
+			from = i + 1
+			if param == "" {
+				continue
+			}
+			//the OUT parameters aren't part of the signature, the mode of the others is skipped
+			words := strings.Fields(param)
+			switch strings.ToUpper(words[0]) {
+			case "OUT":
+				continue
+			case "IN", "INOUT", "VARIADIC":
+				words = words[1:]
+			}
+			//the parameters are named, the types can have more words (double precision)
+			if len(words) > 1 {
+				param = strings.Join(words[1:], " ")
+			} else if len(words) == 1 {
+				param = words[0]
+			}
+			types = append(types, strings.ToLower(param))
+		}
+	}
+	return types
+}
+
+//upgradeScript returns the script upgrading the extension from the previous release script to the current one:
+//the removed objects are dropped, the new and changed ones are created again.
+//The changed objects that can't be replaced (types, tables, operators) are left to be altered by hand
+func upgradeScript(extension, version, previous, current string) string {
+	previousObjects := parseScript(previous)
+	previousKeys := make(map[string]*scriptObject)
+	for _, object := range previousObjects {
+		previousKeys[object.key()] = object
+	}
+	currentObjects := parseScript(current)
+	currentKeys := make(map[string]bool)
+	for _, object := range currentObjects {
+		currentKeys[object.key()] = true
+	}
+	//the objects are dropped in the reverse order, so the dependent objects are dropped first
+	var removed []*scriptObject
+	for i := len(previousObjects) - 1; i >= 0; i-- {
+		if !currentKeys[previousObjects[i].key()] {
+			removed = append(removed, previousObjects[i])
+		}
+	}
+	var b strings.Builder
+	b.WriteString("-- complain if script is sourced in psql, rather than via ALTER EXTENSION\n")
+	b.WriteString(`\echo Use "ALTER EXTENSION ` + extension + ` UPDATE TO '` + version + `'" to load this file. \quit` + "\n\n")
+	for _, object := range removed {
+		b.WriteString("DROP " + strings.ToUpper(object.kind) + " IF EXISTS " + object.signature + ";\n")
+	}
+	if len(removed) > 0 {
+		b.WriteString("\n")
+	}
+	for _, object := range currentObjects {
+		old, ok := previousKeys[object.key()]
+		switch {
+		case ok && old.text == object.text:
+			continue
+		case ok && (object.kind == "cast" || object.kind == "event trigger"):
+			//the casts and the event triggers aren't replaceable, they are created again
+			b.WriteString("DROP " + strings.ToUpper(object.kind) + " IF EXISTS " + object.signature + ";\n")
+		case ok && !object.replaceable:
+			b.WriteString("-- the " + object.kind + " " + object.signature + " changed, alter it here:\n")
+			b.WriteString("-- " + strings.ReplaceAll(object.text, "\n", "\n-- ") + "\n\n")
+			continue
+		case ok && (object.kind == "function" || object.kind == "procedure") && (old.header != object.header || old.returns != object.returns):
+			//CREATE OR REPLACE can't change the result, the parameter names or the defaults
+			b.WriteString("DROP " + strings.ToUpper(object.kind) + " IF EXISTS " + object.signature + ";\n")
+		}
+		b.WriteString(object.text + "\n\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//castScript is an extension script with an cast, an operator class and an event trigger
+const castScript = `-- complain if script is sourced in psql, rather than via CREATE EXTENSION
+\echo Use "CREATE EXTENSION ext" to load this file. \quit
+CREATE SCHEMA IF NOT EXISTS "util";
+CREATE TYPE version AS (
+	major integer,
+	minor integer
+);
+
+CREATE OR REPLACE FUNCTION version_text(v version)
+RETURNS text AS
+'MODULE_PATHNAME', 'VersionText'
+LANGUAGE c IMMUTABLE STRICT;
+COMMENT ON FUNCTION version_text(version) IS 'VersionText formats the version
+';
+
+CREATE CAST (version AS text)
+WITH FUNCTION version_text(version)
+AS ASSIGNMENT;
+
+CREATE OR REPLACE FUNCTION version_lt(a version,b version)
+RETURNS boolean AS
+'MODULE_PATHNAME', 'VersionLt'
+LANGUAGE c IMMUTABLE STRICT;
+
+CREATE OPERATOR < (
+	FUNCTION = version_lt,
+	LEFTARG = version,
+	RIGHTARG = version,
+	COMMUTATOR = OPERATOR(>)
+);
+
+CREATE OPERATOR CLASS version_ops
+DEFAULT FOR TYPE version USING btree AS
+	OPERATOR 1 <,
+	FUNCTION 1 version_cmp(version,version);
+
+CREATE OR REPLACE FUNCTION "util".audit()
+RETURNS event_trigger AS
+'MODULE_PATHNAME', 'Audit'
+LANGUAGE c;
+CREATE EVENT TRIGGER audit ON ddl_command_end
+EXECUTE FUNCTION "util".audit();
+`
+
+//releaseScript is an extension script with an type, an function using it and an table
+const releaseScript = `-- complain if script is sourced in psql, rather than via CREATE EXTENSION
+\echo Use "CREATE EXTENSION ext" to load this file. \quit
+CREATE TYPE version AS (
+	major integer,
+	minor integer
+);
+
+CREATE OR REPLACE FUNCTION version_text(v version)
+RETURNS text AS
+'MODULE_PATHNAME', 'VersionText'
+LANGUAGE c IMMUTABLE STRICT;
+COMMENT ON FUNCTION version_text(version) IS 'VersionText formats the version
+';
+
+-- the installed versions
+CREATE TABLE IF NOT EXISTS ext_versions (
+	v version
+);
+`
+
+func TestParseScript(t *testing.T) {
+	var keys []string
+	for _, object := range parseScript(castScript) {
+		keys = append(keys, object.key())
+	}
+	want := []string{
+		`schema "util"`,
+		"type version",
+		"function version_text(version)",
+		"cast (version as text)",
+		"function version_lt(version,version)",
+		"operator <(version,version)",
+		"operator class version_ops using btree",
+		`function "util".audit()`,
+		"event trigger audit",
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("parseScript keys:\n%s\nwant:\n%s", strings.Join(keys, "\n"), strings.Join(want, "\n"))
+	}
+	objects := parseScript(castScript)
+	if text := objects[2].text; strings.Contains(text, "CAST") {
+		t.Errorf("the function text contains the cast:\n%s", text)
+	}
+	if object := objects[5]; object.replaceable || object.signature != "<(version,version)" {
+		t.Errorf("operator signature %s, replaceable %v", object.signature, object.replaceable)
+	}
+}
+
+func TestParseScriptSignatures(t *testing.T) {
+	tests := []struct {
+		statement, key string
+	}{
+		{"CREATE OR REPLACE FUNCTION add(a integer, b integer DEFAULT 1)\nRETURNS integer AS", "function add(integer,integer)"},
+		{"CREATE OR REPLACE FUNCTION f(IN a text, OUT b text, VARIADIC c integer[])\nRETURNS record AS", "function f(text,integer[])"},
+		{"CREATE OR REPLACE FUNCTION f(x double precision, y numeric(10, 2))\nRETURNS void AS", "function f(double precision,numeric(10, 2))"},
+		{"CREATE PROCEDURE p()\nLANGUAGE c;", "procedure p()"},
+		{"CREATE AGGREGATE median(value double precision) (\n\tsfunc = acc\n);", "aggregate median(double precision)"},
+		{"CREATE TABLE IF NOT EXISTS ext_jobs (\n\tname text\n);", "table ext_jobs"},
+		{"CREATE CAST (text  AS\tVersion)\nWITH FUNCTION text_version(text);", "cast (text as version)"},
+		{"CREATE OPERATOR - (\n\tFUNCTION = neg,\n\tRIGHTARG = version\n);", "operator -(none,version)"},
+		{"CREATE OPERATOR \"s\".= (\n\tFUNCTION = eq,\n\tLEFTARG = Version,\n\tRIGHTARG = version\n);", "operator \"s\".=(version,version)"},
+		{"CREATE OPERATOR CLASS version_hash_ops\nFOR TYPE version USING HASH AS\n\tOPERATOR 1 =;", "operator class version_hash_ops using hash"},
+		{"CREATE EVENT TRIGGER guard ON sql_drop\nEXECUTE FUNCTION guard();", "event trigger guard"},
+	}
+	for _, test := range tests {
+		objects := parseScript(test.statement)
+		if len(objects) != 1 {
+			t.Errorf("%q: %d objects", test.statement, len(objects))
+			continue
+		}
+		if key := objects[0].key(); key != test.key {
+			t.Errorf("%q: key %q, want %q", test.statement, key, test.key)
+		}
+	}
+}
+
+func TestParameterTypes(t *testing.T) {
+	tests := []struct {
+		params string
+		want   []string
+	}{
+		{"()", nil},
+		{"(a integer, b text DEFAULT '')", []string{"integer", "text"}},
+		{"(IN a integer, OUT b text)", []string{"integer"}},
+		{"(INOUT n bigint, m bigint = 2)", []string{"bigint", "bigint"}},
+		{"(x Double Precision)", []string{"double precision"}},
+		{"(integer, text)", []string{"integer", "text"}},
+		{"(n numeric(10,2), t timestamp(3) with time zone)", []string{"numeric(10,2)", "timestamp(3) with time zone"}},
+		{"no parameters", nil},
+	}
+	for _, test := range tests {
+		if types := parameterTypes(test.params); !reflect.DeepEqual(types, test.want) {
+			t.Errorf("parameterTypes(%q) = %q, want %q", test.params, types, test.want)
+		}
+	}
+}
+
+func TestTrimScriptTail(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"CREATE TABLE t (a integer);", "CREATE TABLE t (a integer);"},
+		{"CREATE TABLE t (a integer);\n\n\n", "CREATE TABLE t (a integer);"},
+		{"CREATE TABLE t (a integer);\n\n-- the next function\n--\n", "CREATE TABLE t (a integer);"},
+		{"CREATE VIEW v AS\n-- the columns\nSELECT 1;\n", "CREATE VIEW v AS\n-- the columns\nSELECT 1;"},
+		{"-- only a comment\n", "-- only a comment"},
+	}
+	for _, test := range tests {
+		if got := trimScriptTail(test.text); got != test.want {
+			t.Errorf("trimScriptTail(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestUpgradeScript(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous, current string
+		//contains and excludes are the lines expected and not expected in the upgrade script
+		contains, excludes []string
+	}{
+		{
+			name:     "changed function",
+			previous: releaseScript,
+			current:  strings.Replace(releaseScript, "VersionText formats the version", "VersionText formats the version as major.minor", 1),
+			contains: []string{"CREATE OR REPLACE FUNCTION version_text(v version)", "as major.minor"},
+			excludes: []string{"DROP", "CREATE TYPE", "CREATE TABLE"},
+		},
+		{
+			name:     "removed function",
+			previous: releaseScript,
+			current:  releaseScript[:strings.Index(releaseScript, "CREATE OR REPLACE")] + releaseScript[strings.Index(releaseScript, "-- the installed"):],
+			contains: []string{"DROP FUNCTION IF EXISTS version_text(version);"},
+			excludes: []string{"CREATE"},
+		},
+		{
+			name:     "changed type",
+			previous: releaseScript,
+			current:  strings.Replace(releaseScript, "\tminor integer\n", "\tminor integer,\n\tpatch integer\n", 1),
+			contains: []string{"-- the type version changed, alter it here:", "-- \tpatch integer"},
+			excludes: []string{"\nCREATE TYPE", "CREATE OR REPLACE"},
+		},
+		{
+			name:     "changed return type",
+			previous: releaseScript,
+			current:  strings.Replace(releaseScript, "RETURNS text AS", "RETURNS varchar AS", 1),
+			contains: []string{"DROP FUNCTION IF EXISTS version_text(version);\nCREATE OR REPLACE FUNCTION version_text(v version)\nRETURNS varchar AS"},
+		},
+		{
+			name:     "renamed parameter",
+			previous: releaseScript,
+			current:  strings.Replace(releaseScript, "version_text(v version)", "version_text(ver version)", 1),
+			contains: []string{"DROP FUNCTION IF EXISTS version_text(version);", "CREATE OR REPLACE FUNCTION version_text(ver version)"},
+		},
+		{
+			name:     "unchanged cast of an changed function",
+			previous: castScript,
+			current:  strings.Replace(castScript, "VersionText formats the version", "VersionText formats the version as major.minor", 1),
+			contains: []string{"CREATE OR REPLACE FUNCTION version_text(v version)"},
+			excludes: []string{"CREATE CAST", "DROP CAST", "CREATE OPERATOR", "CREATE EVENT TRIGGER"},
+		},
+		{
+			name:     "removed cast, operator class and operator",
+			previous: castScript,
+			current:  castScript[:strings.Index(castScript, "CREATE CAST")] + castScript[strings.Index(castScript, "CREATE OR REPLACE FUNCTION version_lt"):strings.Index(castScript, "CREATE OPERATOR <")],
+			contains: []string{
+				"DROP EVENT TRIGGER IF EXISTS audit;",
+				"DROP OPERATOR CLASS IF EXISTS version_ops USING btree;",
+				"DROP OPERATOR IF EXISTS <(version,version);",
+				"DROP CAST IF EXISTS (version AS text);",
+				`DROP FUNCTION IF EXISTS "util".audit();`,
+			},
+			excludes: []string{"CREATE", `DROP SCHEMA`},
+		},
+		{
+			name:     "changed cast",
+			previous: castScript,
+			current:  strings.Replace(castScript, "AS ASSIGNMENT", "AS IMPLICIT", 1),
+			contains: []string{"DROP CAST IF EXISTS (version AS text);", "AS IMPLICIT;"},
+			excludes: []string{"CREATE OR REPLACE FUNCTION"},
+		},
+		{
+			name:     "changed event trigger",
+			previous: castScript,
+			current:  strings.Replace(castScript, "ON ddl_command_end", "ON sql_drop", 1),
+			contains: []string{"DROP EVENT TRIGGER IF EXISTS audit;", "CREATE EVENT TRIGGER audit ON sql_drop"},
+		},
+		{
+			name:     "changed operator",
+			previous: castScript,
+			current:  strings.Replace(castScript, "COMMUTATOR = OPERATOR(>)", "COMMUTATOR = OPERATOR(>),\n\tNEGATOR = OPERATOR(>=)", 1),
+			contains: []string{"-- the operator <(version,version) changed, alter it here:"},
+			excludes: []string{"\nCREATE OPERATOR"},
+		},
+		{
+			name:     "new schema",
+			previous: "CREATE TYPE version AS (major integer);\n",
+			current:  "CREATE SCHEMA IF NOT EXISTS \"util\";\nCREATE TYPE version AS (major integer);\n",
+			contains: []string{`CREATE SCHEMA IF NOT EXISTS "util";`},
+			excludes: []string{"CREATE TYPE"},
+		},
+	}
+	for _, test := range tests {
+		script := upgradeScript("ext", "0.2", test.previous, test.current)
+		for _, line := range test.contains {
+			if !strings.Contains(script, line) {
+				t.Errorf("%s: the upgrade script doesn't contain %q:\n%s", test.name, line, script)
+			}
+		}
+		for _, line := range test.excludes {
+			if strings.Contains(script, line) {
+				t.Errorf("%s: the upgrade script contains %q:\n%s", test.name, line, script)
+			}
+		}
+	}
+}
+
+func TestUpgradeScriptDropOrder(t *testing.T) {
+	script := upgradeScript("ext", "0.2", castScript, "")
+	//the dependent objects are dropped first
+	order := []string{"DROP EVENT TRIGGER", "DROP OPERATOR CLASS", "DROP OPERATOR IF", "DROP CAST", "DROP TYPE", `DROP SCHEMA IF EXISTS "util";`}
+	last := -1
+	for _, statement := range order {
+		i := strings.Index(script, statement)
+		if i <= last {
+			t.Fatalf("%s isn't dropped after the previous objects:\n%s", statement, script)
+		}
+		last = i
+	}
+}
+
+func TestUpgradeScriptUnchanged(t *testing.T) {
+	script := upgradeScript("ext", "0.2", releaseScript, releaseScript)
+	want := "-- complain if script is sourced in psql, rather than via ALTER EXTENSION\n" +
+		`\echo Use "ALTER EXTENSION ext UPDATE TO '0.2'" to load this file. \quit` + "\n\n"
+	if script != want {
+		t.Errorf("the upgrade script of an unchanged extension is\n%s", script)
+	}
+	if name := upgradeScriptName("ext", "0.1", "0.2"); name != "ext--0.1--0.2.sql" {
+		t.Errorf("upgradeScriptName = %q", name)
+	}
+}
@@ -1,27 +1,72 @@
 package main
 
-import "go/ast"
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+)
 
 const plgo = "plgo"
 
+//plgoImportPaths are the import paths of the plgo runtime,
+//packages written for the upstream microo8/plgo are accepted without changes
+var plgoImportPaths = []string{"github.com/algonode/plgo", "github.com/microo8/plgo"}
+
+//isPlgoImport reports if the import spec imports the plgo runtime
+func isPlgoImport(spec *ast.ImportSpec) bool {
+	for _, path := range plgoImportPaths {
+		if spec.Path.Value == strconv.Quote(path) {
+			return true
+		}
+	}
+	return false
+}
+
 //FuncVisitor collects all definitions of exported functions in an packate
 type FuncVisitor struct {
-	err       error
-	functions []CodeWriter
+	err          error
+	functions    []CodeWriter
+	capabilities *CapabilityVisitor
+	//structs are the struct types declared in the package, the rows of the set returning functions
+	structs map[string]*ast.StructType
+	//composites are the structs annotated with //plgo:type
+	composites map[string]*CompositeType
 }
 
 //Visit checks if the functions is exported and creates and Code object from it
 func (v *FuncVisitor) Visit(node ast.Node) ast.Visitor {
+	//stop on the first error, so it isn't overwritten by the next function
+	if v.err != nil {
+		return nil
+	}
+	//the methods aren't functions, the Accumulate and Final methods make the aggregates
 	function, ok := node.(*ast.FuncDecl)
-	if !ok || !ast.IsExported(function.Name.Name) {
+	if !ok || function.Recv != nil || !ast.IsExported(function.Name.Name) {
 		return v
 	}
 	var code CodeWriter
-	code, v.err = NewCode(function)
+	code, v.err = NewCode(function, v.structs, v.composites)
 	if v.err != nil {
 		return nil
 	}
+	if v.err = v.capabilities.Check(function.Name.Name, functionDirectives(function)["requires"]); v.err != nil {
+		return nil
+	}
+	//the operators and the casts follow their function
+	operators, err := newOperators(function, code)
+	if err != nil {
+		v.err = err
+		return nil
+	}
+	casts, err := newCasts(function, code)
+	if err != nil {
+		v.err = err
+		return nil
+	}
 	v.functions = append(v.functions, code)
+	v.functions = append(v.functions, operators...)
+	v.functions = append(v.functions, casts...)
 	function.Name.Name = "__" + function.Name.Name
 	return v
 }
@@ -29,33 +74,125 @@ func (v *FuncVisitor) Visit(node ast.Node) ast.Visitor {
 //Remover is an visitor that removes all plgo usages
 type Remover struct{}
 
+var (
+	exprType      = reflect.TypeOf((*ast.Expr)(nil)).Elem()
+	exprSliceType = reflect.TypeOf([]ast.Expr(nil))
+)
+
 //Visit removes plgo selectors and plgo import
 func (v *Remover) Visit(node ast.Node) ast.Visitor {
-	switch n := node.(type) {
-	case *ast.ImportSpec:
-		if n.Path.Value == "\"github.com/algonode/plgo\"" {
-			n.Path.Value = ""
-		}
-	case *ast.CallExpr:
-		selector, ok := n.Fun.(*ast.SelectorExpr)
-		if !ok {
-			break
+	if node == nil {
+		return nil
+	}
+	if file, ok := node.(*ast.File); ok {
+		removePlgoImports(file)
+		return v
+	}
+	//every expression field of the node can hold an plgo selector
+	//(function calls, types, generic instantiations, constants, ...)
+	value := reflect.ValueOf(node)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return v
+	}
+	value = value.Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		switch field.Type() {
+		case exprType:
+			if ident := plgoSelector(field.Interface()); ident != nil {
+				field.Set(reflect.ValueOf(ident))
+			}
+		case exprSliceType:
+			for j := 0; j < field.Len(); j++ {
+				if ident := plgoSelector(field.Index(j).Interface()); ident != nil {
+					field.Index(j).Set(reflect.ValueOf(ident))
+				}
+			}
 		}
-		expr, ok := selector.X.(*ast.Ident)
-		if !ok || expr.Name != plgo {
-			break
+	}
+	return v
+}
+
+//removePlgoImports removes the plgo import from the file, with its declaration if it was the only import
+func removePlgoImports(file *ast.File) {
+	imports := file.Imports[:0]
+	for _, spec := range file.Imports {
+		if !isPlgoImport(spec) {
+			imports = append(imports, spec)
 		}
-		n.Fun = selector.Sel
-	case *ast.StarExpr:
-		sel, ok := n.X.(*ast.SelectorExpr)
-		if !ok {
-			break
+	}
+	file.Imports = imports
+	decls := file.Decls[:0]
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			specs := gen.Specs[:0]
+			for _, spec := range gen.Specs {
+				if !isPlgoImport(spec.(*ast.ImportSpec)) {
+					specs = append(specs, spec)
+				}
+			}
+			if gen.Specs = specs; len(specs) == 0 {
+				continue
+			}
 		}
-		ident, ok := sel.X.(*ast.Ident)
-		if !ok || ident.Name != plgo {
-			break
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+}
+
+//plgoSelector returns the selected identifier if expr is an plgo selector (plgo.Something)
+func plgoSelector(expr interface{}) *ast.Ident {
+	selector, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	ident, ok := selector.X.(*ast.Ident)
+	if !ok || ident.Name != plgo {
+		return nil
+	}
+	return selector.Sel
+}
+
+//packageStructs returns the struct types declared at the top level of the package by their names
+func packageStructs(packageAst *ast.Package) map[string]*ast.StructType {
+	structs := make(map[string]*ast.StructType)
+	for _, file := range packageAst.Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				if structType, ok := typeSpec.Type.(*ast.StructType); ok {
+					structs[typeSpec.Name.Name] = structType
+				}
+			}
 		}
-		n.X = sel.Sel
 	}
-	return v
+	return structs
+}
+
+//usesPlgo reports whether the package uses the plgo runtime identifier (plgo.Name)
+func usesPlgo(packageAst *ast.Package, name string) bool {
+	found := false
+	ast.Inspect(packageAst, func(node ast.Node) bool {
+		if ident := plgoSelector(node); ident != nil && ident.Name == name {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+//startsGoroutines reports whether the package has go statements
+func startsGoroutines(packageAst *ast.Package) bool {
+	found := false
+	ast.Inspect(packageAst, func(node ast.Node) bool {
+		if _, ok := node.(*ast.GoStmt); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//packageSnapshot returns the modification times of the files of the package read by the build,
+//the Go files, go.mod and the SQL files of the sql directory
+func packageSnapshot(packagePath string) (map[string]time.Time, error) {
+	var files []string
+	for _, pattern := range []string{"*.go", "go.mod", filepath.Join("sql", "*.sql")} {
+		matches, err := filepath.Glob(filepath.Join(packagePath, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	snapshot := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			//the file was removed after Glob, the next snapshot notices it
+			continue
+		}
+		snapshot[file] = info.ModTime()
+	}
+	return snapshot, nil
+}
+
+//changedFiles returns the files added, modified or removed since the previous snapshot
+func changedFiles(previous, current map[string]time.Time) []string {
+	var changed []string
+	for file, modTime := range current {
+		if previousTime, ok := previous[file]; !ok || !previousTime.Equal(modTime) {
+			changed = append(changed, file)
+		}
+	}
+	for file := range previous {
+		if _, ok := current[file]; !ok {
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
+
+//reloadExtension drops and creates the extension in the database, the new sessions load the new shared object
+func reloadExtension(conninfo, extension string) error {
+	out, err := psql("", "-v", "ON_ERROR_STOP=1", "-d", conninfo,
+		"-c", "DROP EXTENSION IF EXISTS "+quoteIdent(extension)+" CASCADE",
+		"-c", "CREATE EXTENSION "+quoteIdent(extension)+" CASCADE")
+	if err != nil {
+		return fmt.Errorf("Cannot recreate the extension %s: %s\n%s", extension, err, out)
+	}
+	return nil
+}
+
+//watchExtension rebuilds and installs the extension whenever the files of the package change,
+//with -db it also recreates the extension in the development database. The failed builds are reported
+//and the next change is awaited
+func watchExtension(args []string) error {
+	var conninfo string
+	var interval time.Duration
+	flag.StringVar(&conninfo, "db", "", "conninfo of the development database, the extension is dropped (CASCADE) and created in it after every install")
+	flag.DurationVar(&interval, "interval", time.Second, "interval of the checks of the package files")
+	build, extension := parseBuildFlags(args)
+	output, err := usePgVersion(extension.pg, extension.output)
+	if err != nil {
+		return err
+	}
+	packagePath := "."
+	if flag.NArg() == 1 {
+		packagePath = flag.Arg(0)
+	}
+	var previous map[string]time.Time
+	for {
+		current, err := packageSnapshot(packagePath)
+		if err != nil {
+			return err
+		}
+		if changed := changedFiles(previous, current); len(changed) > 0 {
+			if previous != nil {
+				fmt.Println("changed:", strings.Join(changed, ", "))
+			}
+			start := time.Now()
+			if err = rebuildExtension(build, output, conninfo); err != nil {
+				fmt.Printf("FAIL\t%.2fs\n%s\n", time.Since(start).Seconds(), err)
+			} else {
+				fmt.Printf("ok\t%.2fs\n", time.Since(start).Seconds())
+			}
+			//the build can change the files of the package, e.g. -with-regress, so the next change is
+			//compared with the files after the build
+			if current, err = packageSnapshot(packagePath); err != nil {
+				return err
+			}
+		}
+		previous = current
+		time.Sleep(interval)
+	}
+}
+
+//rebuildExtension builds and installs the extension, then recreates it in the database of the conninfo, if any
+func rebuildExtension(build func(output string) (*ModuleWriter, string, error), output, conninfo string) error {
+	moduleWriter, output, err := build(output)
+	if err != nil {
+		return err
+	}
+	if err = installExtension(output); err != nil {
+		return err
+	}
+	if conninfo == "" {
+		return nil
+	}
+	return reloadExtension(conninfo, moduleWriter.PackageName)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strings"
+)
+
+//WindowFunction is an function with the first parameter *plgo.WindowContext, func(w *plgo.WindowContext, params...) T,
+//it is created as an WINDOW function and called with an OVER clause. The wrapper reads the arguments of the current row
+//from the window object, the context reads the other rows of the partition
+type WindowFunction struct {
+	Function
+	//Context is the name of the WindowContext parameter
+	Context string
+}
+
+//newWindowFunction returns the window function returning the result or (result, error)
+func newWindowFunction(function VoidFunction, context string, results *ast.FieldList, structs map[string]*ast.StructType,
+	composites map[string]*CompositeType, timeType string) (*WindowFunction, error) {
+	if results != nil && len(results.List) == 2 && len(results.List[0].Names) <= 1 && len(results.List[1].Names) <= 1 &&
+		typeString(results.List[1].Type) == "error" {
+		results, function.Error = &ast.FieldList{List: results.List[:1]}, true
+	}
+	returnType, sqlReturnType, isStar, err := getReturnType(function.Name, results, structs, composites)
+	if err != nil {
+		return nil, err
+	}
+	if returnType == "" || returnType == triggerRow || returnType == "error" {
+		return nil, fmt.Errorf("Window function %s must return an value, func(%s *plgo.WindowContext, ...) T", function.Name, context)
+	}
+	if timeType != "" {
+		if sqlReturnType = timeSQLType(returnType, timeType); sqlReturnType == "" || strings.HasPrefix(returnType, "[]") {
+			return nil, fmt.Errorf("Window function %s: //plgo:time return=%s is not allowed for the %s result", function.Name, timeType, returnType)
+		}
+	}
+	if function.Attributes.Rows > 0 {
+		return nil, fmt.Errorf("Window function %s: the rows attribute is allowed only for set returning functions", function.Name)
+	}
+	function.Attributes.Window = true
+	composite := composites[returnType]
+	function.dependOn(composite)
+	return &WindowFunction{
+		Function: Function{VoidFunction: function, ReturnType: returnType, SQLReturnType: sqlReturnType, IsStar: isStar,
+			Composite: composite.isRow(), Enum: composite.isEnum(), TimeType: timeType},
+		Context: context,
+	}, nil
+}
+
+//Code writes the wrapper function, the executor doesn't pass the arguments of an window function in fcinfo
+func (f *WindowFunction) Code(w io.Writer) {
+	writeFuncHeader(w, f.Name)
+	w.Write([]byte(f.Context + " := fcinfo.WindowContext()\n"))
+	w.Write([]byte("if " + f.Context + " == nil {\nC.elog_error(C.CString(\"" + f.Name + " must be called as an window function, with OVER\"))\n}\n"))
+	if len(f.Params) > 0 {
+		for _, p := range f.Params {
+			w.Write([]byte("var " + p.Name + " " + p.Type + "\n"))
+		}
+		w.Write([]byte("if err := " + f.Context + ".scanCurrent(\n"))
+		for _, p := range f.Params {
+			w.Write([]byte("&" + p.Name + ",\n"))
+		}
+		w.Write([]byte("); err != nil {\nC.elog_error(C.CString(err.Error()))\n}\n"))
+	}
+	f.writeTraceArgs(w)
+	if f.Error {
+		w.Write([]byte("ret, retErr := "))
+	} else {
+		w.Write([]byte("ret := "))
+	}
+	w.Write([]byte("__" + f.Name + "(\n" + f.Context + ",\n"))
+	for _, p := range f.Params {
+		w.Write([]byte(p.arg() + ",\n"))
+	}
+	w.Write([]byte(")\n"))
+	f.writeRaise(w)
+	w.Write([]byte("if call.traced {\ncall.traceResult(ret)\n}\n"))
+	f.writeReturn(w)
+	w.Write([]byte("}\n"))
+}
+
+//Describe adds the window function to the manifest
+func (f *WindowFunction) Describe(m *Manifest) {
+	function := f.manifestFunction(f.sqlReturnType())
+	function.Window = true
+	m.Functions = append(m.Functions, function)
+}
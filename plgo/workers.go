@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//defaultWorkerRestart is the delay before the postmaster restarts an crashed worker, in seconds
+const defaultWorkerRestart = 10
+
+//WorkerFunction is an function declared with //plgo:worker, func(w *plgo.Worker) error,
+//it runs in an background worker started with the server
+type WorkerFunction struct {
+	Name string
+	//Restart is the restart delay in seconds (0 never), Database the database of the worker
+	Restart  int
+	Database string
+}
+
+//newWorkerFunction returns the worker function declared by the //plgo:worker directive,
+//its options are restart=<duration> and database=<name>
+func newWorkerFunction(function *ast.FuncDecl, options []string) (*WorkerFunction, error) {
+	params, results := function.Type.Params.List, function.Type.Results
+	if len(params) != 1 || len(params[0].Names) > 1 || !isPlgoPointer(params[0].Type, "Worker") ||
+		results == nil || len(results.List) != 1 || typeString(results.List[0].Type) != "error" {
+		return nil, fmt.Errorf("Worker %s must be func(w *plgo.Worker) error", function.Name.Name)
+	}
+	worker := &WorkerFunction{Name: function.Name.Name, Restart: defaultWorkerRestart}
+	for _, option := range options {
+		name, value, _ := strings.Cut(option, "=")
+		switch strings.TrimSpace(name) {
+		case "restart":
+			restart, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil || restart < 0 {
+				return nil, fmt.Errorf("Worker %s: invalid restart %q", function.Name.Name, value)
+			}
+			worker.Restart = int(restart / time.Second)
+		case "database":
+			worker.Database = strings.TrimSpace(value)
+		default:
+			return nil, fmt.Errorf("Worker %s: unknown option %s", function.Name.Name, option)
+		}
+	}
+	return worker, nil
+}
+
+//FuncDec returns nothing, the worker isn't called by PostgreSQL
+func (f *WorkerFunction) FuncDec() string {
+	return ""
+}
+
+//Code registers the worker
+func (f *WorkerFunction) Code(w io.Writer) {
+	w.Write([]byte("func init() {\n"))
+	w.Write([]byte("registerWorkerFunc(" + strconv.Quote(f.Name) + ", __" + f.Name + ", " + strconv.Itoa(f.Restart) + ", " + strconv.Quote(f.Database) + ")\n"))
+	w.Write([]byte("}\n"))
+}
+
+//SQL writes an note, the worker has no SQL object
+func (f *WorkerFunction) SQL(target SQLTarget, w io.Writer) {
+	w.Write([]byte("-- background worker " + f.Name + " is started when " + target.PackageName + " is in shared_preload_libraries\n\n"))
+}
+
+//Entity returns the id of the worker
+func (f *WorkerFunction) Entity() string {
+	return relationEntity("worker", f.Name)
+}
+
+//Dependencies returns nothing
+func (f *WorkerFunction) Dependencies() []string {
+	return nil
+}
+
+//Describe does nothing, the worker isn't an SQL object
+func (f *WorkerFunction) Describe(m *Manifest) {}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+//goEnv returns the value of the go environment variable
+func goEnv(name string) (string, error) {
+	out, err := exec.Command("go", "env", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("Cannot run go env %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+//goWork returns the go.work file of the workspace of the current directory,
+//an empty string outside of an workspace or with GOWORK=off
+func goWork() string {
+	gowork, err := goEnv("GOWORK")
+	if err != nil || gowork == "off" {
+		return ""
+	}
+	return gowork
+}
+
+//workspaceBuildFlags returns the go build flags needed in workspace mode,
+//the workspace mode rejects -mod=mod set in GOFLAGS
+func workspaceBuildFlags() []string {
+	if goWork() == "" {
+		return nil
+	}
+	goflags, err := goEnv("GOFLAGS")
+	if err != nil || !strings.Contains(goflags, "-mod=mod") {
+		return nil
+	}
+	return []string{"-mod=readonly"}
+}
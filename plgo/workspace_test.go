@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWorkspaceBuildFlags(t *testing.T) {
+	dir := t.TempDir()
+	gowork := filepath.Join(dir, "go.work")
+	if err := os.WriteFile(gowork, []byte("go 1.20\n\nuse .\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/ext\n\ngo 1.20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		gowork, goflags string
+		//work is the expected go.work of goWork
+		work  string
+		flags []string
+	}{
+		{gowork, "-mod=mod", gowork, []string{"-mod=readonly"}},
+		{gowork, "-mod=mod -trimpath", gowork, []string{"-mod=readonly"}},
+		{gowork, "-trimpath", gowork, nil},
+		{"off", "-mod=mod", "", nil},
+	}
+	for _, test := range tests {
+		t.Setenv("GOWORK", test.gowork)
+		t.Setenv("GOFLAGS", test.goflags)
+		if work := goWork(); work != test.work {
+			t.Errorf("goWork with GOWORK=%s = %q, want %q", test.gowork, work, test.work)
+		}
+		if flags := workspaceBuildFlags(); !reflect.DeepEqual(flags, test.flags) {
+			t.Errorf("workspaceBuildFlags with GOWORK=%s GOFLAGS=%s = %q, want %q", test.gowork, test.goflags, flags, test.flags)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "executor/spi.h"
+#include "nodes/parsenodes.h"
+
+//plgo_nonatomic returns true if the procedure is called by CALL outside of an transaction block,
+//only then it can commit and rollback the transaction
+bool plgo_nonatomic(FunctionCallInfo fcinfo) {
+	return fcinfo->context != NULL && IsA(fcinfo->context, CallContext) && !castNode(CallContext, fcinfo->context)->atomic;
+}
+*/
+import "C"
+import (
+	"errors"
+	"unsafe"
+)
+
+//errAtomic is returned by Commit and Rollback outside of an procedure called by CALL outside of an transaction block
+var errAtomic = errors.New("Transaction control is allowed only in procedures called by CALL outside of an transaction block")
+
+//errOpenSubTx is returned by Commit and Rollback in an subtransaction
+var errOpenSubTx = errors.New("Release or rollback the subtransaction before ending the transaction")
+
+//endingTransaction is true while Commit or Rollback ends the transaction of the procedure,
+//the Go code isn't interrupted, so the abort handlers aren't run
+var endingTransaction bool
+
+//beginProcedure is called by the generated wrappers of the procedures instead of beginCall,
+//the DB opened by the procedure called by CALL can commit and rollback
+func beginProcedure(fcinfo *funcInfo, name string) *funcCall {
+	call := beginCall(fcinfo, name)
+	call.nonatomic = C.plgo_nonatomic((C.FunctionCallInfo)(unsafe.Pointer(fcinfo))) == (C._Bool)(true)
+	return call
+}
+
+//Commit commits the current transaction of the procedure and starts a new one, the work done so far
+//stays committed even if the procedure fails later. The Rows and Cursors don't survive the transaction,
+//close them before Commit
+func (db *DB) Commit() error {
+	if !db.nonatomic {
+		return errAtomic
+	}
+	if db.subTx != nil {
+		return errOpenSubTx
+	}
+	endingTransaction = true
+	defer func() { endingTransaction = false }()
+	C.SPI_commit()
+	return nil
+}
+
+//Rollback rolls back the current transaction of the procedure and starts a new one, as Commit
+func (db *DB) Rollback() error {
+	if !db.nonatomic {
+		return errAtomic
+	}
+	if db.subTx != nil {
+		return errOpenSubTx
+	}
+	endingTransaction = true
+	defer func() { endingTransaction = false }()
+	C.SPI_rollback()
+	return nil
+}
@@ -0,0 +1,214 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "utils/builtins.h"
+*/
+import "C"
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+//paramTypes are the SQL types of the Go values bound as query parameters
+var paramTypes = map[reflect.Type]string{
+	reflect.TypeOf(""):                    "text",
+	reflect.TypeOf([]byte{}):              "bytea",
+	reflect.TypeOf(int16(0)):              "smallint",
+	reflect.TypeOf(uint16(0)):             "smallint",
+	reflect.TypeOf(int32(0)):              "integer",
+	reflect.TypeOf(uint32(0)):             "integer",
+	reflect.TypeOf(int64(0)):              "bigint",
+	reflect.TypeOf(int(0)):                "bigint",
+	reflect.TypeOf(uint(0)):               "bigint",
+	reflect.TypeOf(float32(0)):            "real",
+	reflect.TypeOf(float64(0)):            "double precision",
+	reflect.TypeOf(false):                 "boolean",
+	reflect.TypeOf(time.Time{}):           "timestamptz",
+	reflect.TypeOf(time.Duration(0)):      "interval",
+	reflect.TypeOf(UUID{}):                "uuid",
+	reflect.TypeOf(Numeric("")):           "numeric",
+	reflect.TypeOf(netip.Addr{}):          "inet",
+	reflect.TypeOf(netip.Prefix{}):        "cidr",
+	reflect.TypeOf(net.HardwareAddr(nil)): "macaddr",
+	reflect.TypeOf(Range[int32]{}):        "int4range",
+	reflect.TypeOf(Range[int64]{}):        "int8range",
+	reflect.TypeOf(Range[Numeric]{}):      "numrange",
+	reflect.TypeOf(Range[time.Time]{}):    "tstzrange",
+	//the hstore extension must be created
+	reflect.TypeOf(map[string]*string(nil)): "hstore",
+}
+
+//Query is an SQL query composed from trusted SQL fragments, quoted identifiers and literals
+//and bound parameters, so the dynamically composed queries can't introduce an SQL injection.
+//Only the fragments added with NewQuery and SQL are written as they are, they must not contain user input
+//
+//	q := plgo.NewQuery("SELECT name FROM ").Ident(schema, table).
+//		SQL(" WHERE id IN (").In(ids).SQL(") AND state = ").Param("active")
+//	stmt, err := db.PrepareQuery(q)
+//	rows, err := stmt.Query(q.Args()...)
+type Query struct {
+	sql   strings.Builder
+	args  []interface{}
+	types []string
+	err   error
+}
+
+//NewQuery starts an query with the trusted SQL fragment
+func NewQuery(sql string) *Query {
+	q := &Query{}
+	q.sql.WriteString(sql)
+	return q
+}
+
+//SQL appends an trusted SQL fragment
+func (q *Query) SQL(sql string) *Query {
+	q.sql.WriteString(sql)
+	return q
+}
+
+//Ident appends an identifier quoted by the server (quote_identifier),
+//more names are joined with dots to an qualified name, e.g. Ident(schema, table)
+func (q *Query) Ident(names ...string) *Query {
+	for i, name := range names {
+		if i > 0 {
+			q.sql.WriteByte('.')
+		}
+		q.sql.WriteString(QuoteIdent(name))
+	}
+	return q
+}
+
+//Literal appends an string literal quoted by the server (quote_literal),
+//use it where parameters can't be used, e.g. in utility commands
+func (q *Query) Literal(value string) *Query {
+	q.sql.WriteString(QuoteLiteral(value))
+	return q
+}
+
+//Param appends an parameter placeholder ($n) bound to the value,
+//the parameter type is derived from the Go type of the value, an nil pointer (e.g. (*string)(nil)) is NULL
+func (q *Query) Param(value interface{}) *Query {
+	typeName, err := paramType(value, len(q.args)+1)
+	if err != nil {
+		if q.err == nil {
+			q.err = err
+		}
+		return q
+	}
+	return q.TypedParam(value, typeName)
+}
+
+//paramType returns the SQL type of the n-th query parameter value, the pointers have the types of their elements
+func paramType(value interface{}, n int) (string, error) {
+	if value == nil {
+		return "", fmt.Errorf("Query parameter %d: untyped nil has no SQL type, pass an typed nil pointer, e.g. (*string)(nil), or write NULL in the SQL", n)
+	}
+	t := reflect.TypeOf(value)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	typeName, ok := paramTypes[t]
+	if !ok {
+		return "", fmt.Errorf("Query parameter %d: type %T not supported", n, value)
+	}
+	return typeName, nil
+}
+
+//TypedParam appends an parameter placeholder ($n) bound to the value with the SQL type, e.g. jsonb
+func (q *Query) TypedParam(value interface{}, typeName string) *Query {
+	q.args = append(q.args, value)
+	q.types = append(q.types, typeName)
+	q.sql.WriteString("$" + strconv.Itoa(len(q.args)))
+	return q
+}
+
+//In appends an comma separated list of parameter placeholders bound to the elements of the values slice,
+//for `column IN (...)`. An empty slice appends NULL, so the IN matches no rows
+func (q *Query) In(values interface{}) *Query {
+	slice := reflect.ValueOf(values)
+	if slice.Kind() != reflect.Slice {
+		if q.err == nil {
+			q.err = fmt.Errorf("Query IN list: %T is not an slice", values)
+		}
+		return q
+	}
+	if slice.Len() == 0 {
+		q.sql.WriteString("NULL")
+		return q
+	}
+	for i := 0; i < slice.Len(); i++ {
+		if i > 0 {
+			q.sql.WriteString(", ")
+		}
+		q.Param(slice.Index(i).Interface())
+	}
+	return q
+}
+
+//String returns the SQL text of the query
+func (q *Query) String() string {
+	return q.sql.String()
+}
+
+//Args returns the values of the query parameters
+func (q *Query) Args() []interface{} {
+	return q.args
+}
+
+//Types returns the SQL types of the query parameters
+func (q *Query) Types() []string {
+	return q.types
+}
+
+//Err returns the first error of composing the query
+func (q *Query) Err() error {
+	return q.err
+}
+
+//PrepareQuery prepares the composed query, execute the Stmt with q.Args()
+func (db *DB) PrepareQuery(q *Query) (*Stmt, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	return db.Prepare(q.String(), q.types)
+}
+
+//QuoteIdent quotes the identifier for use in an SQL query, if needed
+func QuoteIdent(name string) string {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	//quote_identifier returns its argument if no quoting is needed
+	return C.GoString(C.quote_identifier(cname))
+}
+
+//QuoteLiteral quotes the string as an SQL literal
+func QuoteLiteral(value string) string {
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cvalue))
+	quoted := C.quote_literal_cstr(cvalue)
+	defer C.pfree(unsafe.Pointer(quoted))
+	return C.GoString(quoted)
+}
+
+//extensionSchema returns the schema of the extension, or "" if the extension isn't created in the database
+func extensionSchema(db *DB) (string, error) {
+	stmt, err := db.Prepare("SELECT coalesce((SELECT n.nspname::text FROM pg_catalog.pg_extension e "+
+		"JOIN pg_catalog.pg_namespace n ON n.oid = e.extnamespace WHERE e.extname = $1), '')", []string{"text"})
+	if err != nil {
+		return "", err
+	}
+	row, err := stmt.QueryRow(extensionName)
+	if err != nil {
+		return "", err
+	}
+	var schema string
+	err = row.Scan(&schema)
+	return schema, err
+}
@@ -0,0 +1,69 @@
+package plgo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+//logMinDuration is <extension>.log_min_duration,
+//the queries running at least this long are logged, -1 disables it
+var logMinDuration = newIntGUC(gucDesc{
+	name:      "log_min_duration",
+	shortDesc: "Sets the minimum execution time above which SPI queries issued from Go are logged.",
+	longDesc:  "Zero logs all queries, -1 turns this feature off.",
+	context:   gucSuset,
+	flags:     gucUnitMs,
+}, -1, -1, math.MaxInt32)
+
+//logRedactParameters is <extension>.log_redact_parameters,
+//the parameters of the logged slow queries are replaced by a placeholder
+var logRedactParameters = newBoolGUC(gucDesc{
+	name:      "log_redact_parameters",
+	shortDesc: "Hides the parameter values of the logged slow SPI queries.",
+	context:   gucSuset,
+}, false)
+
+//logSlowQuery logs the query if it ran longer than <extension>.log_min_duration
+func logSlowQuery(q *queryCall, err error) {
+	minDuration := logMinDuration.get()
+	if minDuration < 0 {
+		return
+	}
+	duration := time.Since(q.start)
+	if duration < time.Duration(minDuration)*time.Millisecond {
+		return
+	}
+	fields := []interface{}{
+		"duration_ms", float64(duration) / float64(time.Millisecond),
+		"query", q.query,
+	}
+	if len(q.args) > 0 {
+		fields = append(fields, "parameters", formatQueryArgs(q.args, logRedactParameters.get()))
+	}
+	if err != nil {
+		fields = append(fields, "error", err)
+	}
+	Log.Log("slow query", fields...)
+}
+
+//formatQueryArgs formats the query parameters as $1 = value, $2 = value
+func formatQueryArgs(args []interface{}, redact bool) string {
+	params := make([]string, len(args))
+	for i, arg := range args {
+		value := "<redacted>"
+		if !redact {
+			switch v := arg.(type) {
+			case nil:
+				value = "NULL"
+			case string:
+				value = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+			default:
+				value = fmt.Sprint(v)
+			}
+		}
+		params[i] = fmt.Sprintf("$%d = %s", i+1, value)
+	}
+	return strings.Join(params, ", ")
+}
@@ -0,0 +1,152 @@
+package plgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//Queue is an work queue stored in the <extension>_queue table, that is created in the extensions using NewQueue.
+//The messages are claimed with SELECT ... FOR UPDATE SKIP LOCKED, so the concurrent consumers don't block each other.
+//The claimed messages stay locked until the end of the transaction, if it aborts they are returned to the queue
+type Queue struct {
+	Name string
+	//MaxAttempts is the number of claims before the failed message is moved to the dead status
+	MaxAttempts int
+	//Backoff is the delay before the first retry of the failed message, it's doubled with every attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+//QueueMessage is an message claimed from the queue
+type QueueMessage struct {
+	ID      int64  `json:"id"`
+	Payload string `json:"payload"`
+	//Attempts is the number of claims of the message, including this one
+	Attempts int `json:"attempts"`
+}
+
+//ErrNoQueueTable is returned if the extension isn't created in the database
+var ErrNoQueueTable = errors.New("plgo: the extension is not created in this database")
+
+//NewQueue returns the queue with the default retries: 5 attempts, 10 seconds backoff up to an hour
+func NewQueue(name string) *Queue {
+	return &Queue{Name: name, MaxAttempts: 5, Backoff: 10 * time.Second, MaxBackoff: time.Hour}
+}
+
+//queueSchema is the cached schema of the extension
+var queueSchema string
+
+//table returns the qualified name of the queue table
+func (q *Queue) table(db *DB) (string, error) {
+	if queueSchema == "" {
+		schema, err := extensionSchema(db)
+		if err != nil {
+			return "", err
+		}
+		if schema == "" {
+			return "", ErrNoQueueTable
+		}
+		queueSchema = schema
+	}
+	return QuoteIdent(queueSchema) + "." + QuoteIdent(extensionName+"_queue"), nil
+}
+
+//Enqueue adds the message to the queue, returns its id
+func (q *Queue) Enqueue(db *DB, payload string) (int64, error) {
+	return q.EnqueueAfter(db, payload, 0)
+}
+
+//EnqueueAfter adds the message to the queue, it can be claimed after the delay
+func (q *Queue) EnqueueAfter(db *DB, payload string, delay time.Duration) (int64, error) {
+	table, err := q.table(db)
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := db.Prepare("INSERT INTO "+table+" (queue, payload, run_at) "+
+		"VALUES ($1, $2, now() + make_interval(secs => $3)) RETURNING id", []string{"text", "text", "float8"})
+	if err != nil {
+		return 0, err
+	}
+	row, err := stmt.QueryRow(q.Name, payload, delay.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = row.Scan(&id)
+	return id, err
+}
+
+//Claim locks up to limit ready messages, the oldest first. The locks are held until the end of the transaction,
+//every claimed message must be acknowledged with Ack or Fail before the commit, or it's claimed again
+func (q *Queue) Claim(db *DB, limit int) ([]QueueMessage, error) {
+	table, err := q.table(db)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := db.Prepare("WITH claimed AS (UPDATE "+table+" SET attempts = attempts + 1 WHERE id IN ("+
+		"SELECT id FROM "+table+" WHERE queue = $1 AND status = 'ready' AND run_at <= now() "+
+		"ORDER BY run_at, id LIMIT $2 FOR UPDATE SKIP LOCKED) RETURNING id, payload, attempts) "+
+		"SELECT coalesce(json_agg(c ORDER BY c.id), '[]')::text FROM claimed c", []string{"text", "integer"})
+	if err != nil {
+		return nil, err
+	}
+	row, err := stmt.QueryRow(q.Name, int32(limit))
+	if err != nil {
+		return nil, err
+	}
+	var data string
+	if err = row.Scan(&data); err != nil {
+		return nil, err
+	}
+	var messages []QueueMessage
+	err = json.Unmarshal([]byte(data), &messages)
+	return messages, err
+}
+
+//Ack removes the processed message from the queue
+func (q *Queue) Ack(db *DB, m QueueMessage) error {
+	table, err := q.table(db)
+	if err != nil {
+		return err
+	}
+	stmt, err := db.Prepare("WITH acked AS (DELETE FROM "+table+" WHERE id = $1 RETURNING 1) SELECT count(*) FROM acked",
+		[]string{"bigint"})
+	if err != nil {
+		return err
+	}
+	_, err = stmt.QueryRow(m.ID)
+	return err
+}
+
+//Fail returns the message to the queue to be retried after the backoff,
+//the message is moved to the dead status after MaxAttempts
+func (q *Queue) Fail(db *DB, m QueueMessage, cause error) error {
+	table, err := q.table(db)
+	if err != nil {
+		return err
+	}
+	delay := q.Backoff
+	for i := 1; i < m.Attempts && delay < q.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.MaxBackoff {
+		delay = q.MaxBackoff
+	}
+	message := ""
+	if cause != nil {
+		message = RedactSecrets(cause.Error())
+	}
+	stmt, err := db.Prepare("WITH failed AS (UPDATE "+table+" SET status = CASE WHEN attempts >= $2 THEN 'dead' ELSE 'ready' END, "+
+		"run_at = now() + make_interval(secs => $3), last_error = $4 WHERE id = $1 RETURNING 1) SELECT count(*) FROM failed",
+		[]string{"bigint", "integer", "float8", "text"})
+	if err != nil {
+		return err
+	}
+	_, err = stmt.QueryRow(m.ID, int32(q.MaxAttempts), delay.Seconds(), message)
+	if err != nil {
+		return fmt.Errorf("cannot fail message %d: %w", m.ID, err)
+	}
+	return nil
+}
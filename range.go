@@ -0,0 +1,182 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "catalog/pg_type.h"
+#include "utils/lsyscache.h"
+#include "utils/rangetypes.h"
+#include "utils/typcache.h"
+
+//plgo_range_elem_type returns the element type of the range type
+Oid plgo_range_elem_type(Oid rangetype) {
+	return get_range_subtype(rangetype);
+}
+
+//plgo_range_bounds deserializes the range datum, it returns true for the empty range
+bool plgo_range_bounds(Datum val, Datum *lower, bool *lower_inc, bool *lower_inf, Datum *upper, bool *upper_inc, bool *upper_inf) {
+	RangeType *range = DatumGetRangeTypeP(val);
+	TypeCacheEntry *typcache = lookup_type_cache(RangeTypeGetOid(range), TYPECACHE_RANGE_INFO);
+	RangeBound l, u;
+	bool empty;
+
+	range_deserialize(typcache, range, &l, &u, &empty);
+	*lower = l.val;
+	*lower_inc = l.inclusive;
+	*lower_inf = l.infinite;
+	*upper = u.val;
+	*upper_inc = u.inclusive;
+	*upper_inf = u.infinite;
+	return empty;
+}
+
+//plgo_make_range returns the canonical range datum of the range type, e.g. [1,3) for the int4range [1,2]
+Datum plgo_make_range(Oid rangetype, Datum lower, bool lower_inc, bool lower_inf, Datum upper, bool upper_inc, bool upper_inf, bool empty) {
+	TypeCacheEntry *typcache = lookup_type_cache(rangetype, TYPECACHE_RANGE_INFO);
+	RangeBound l = {.val = lower, .infinite = lower_inf, .inclusive = lower_inc, .lower = true};
+	RangeBound u = {.val = upper, .infinite = upper_inf, .inclusive = upper_inc, .lower = false};
+
+#if PG_VERSION_NUM >= 160000
+	return RangeTypePGetDatum(make_range(typcache, &l, &u, empty, NULL));
+#else
+	return RangeTypePGetDatum(make_range(typcache, &l, &u, empty));
+#endif
+}
+*/
+import "C"
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+//Range is the PostgreSQL range of T: Range[int32] is int4range, Range[int64] int8range, Range[Numeric] numrange
+//and Range[time.Time] tstzrange (tsrange or daterange declared with //plgo:time)
+type Range[T any] struct {
+	Lower, Upper T
+	//LowerInc and UpperInc are true for the inclusive bounds, [ and ]
+	LowerInc, UpperInc bool
+	//LowerInf and UpperInf are true for the unbounded sides, their values are ignored
+	LowerInf, UpperInf bool
+	//Empty is true for the empty range, the bounds are ignored
+	Empty bool
+}
+
+//NewRange returns the range [lower, upper), the default bounds of the ranges
+func NewRange[T any](lower, upper T) Range[T] {
+	return Range[T]{Lower: lower, Upper: upper, LowerInc: true}
+}
+
+//rangeValue is implemented by the ranges, they are converted by the type of their bounds
+type rangeValue interface {
+	elemType() reflect.Type
+	//bounds returns the bound values, nil for the unbounded sides
+	bounds() (lower, upper interface{})
+	flags() (lowerInc, upperInc, empty bool)
+}
+
+func (r Range[T]) elemType() reflect.Type {
+	return reflect.TypeOf(&r.Lower).Elem()
+}
+
+func (r Range[T]) bounds() (interface{}, interface{}) {
+	var lower, upper interface{}
+	if !r.LowerInf {
+		lower = r.Lower
+	}
+	if !r.UpperInf {
+		upper = r.Upper
+	}
+	return lower, upper
+}
+
+func (r Range[T]) flags() (bool, bool, bool) {
+	return r.LowerInc, r.UpperInc, r.Empty
+}
+
+//rangeTarget is implemented by the pointers to the ranges, they are scanned from the range datums
+type rangeTarget interface {
+	//boundTargets returns the pointers to the bound values
+	boundTargets() (lower, upper interface{})
+	setFlags(lowerInc, lowerInf, upperInc, upperInf, empty bool)
+}
+
+func (r *Range[T]) boundTargets() (interface{}, interface{}) {
+	return &r.Lower, &r.Upper
+}
+
+func (r *Range[T]) setFlags(lowerInc, lowerInf, upperInc, upperInf, empty bool) {
+	r.LowerInc, r.LowerInf, r.UpperInc, r.UpperInf, r.Empty = lowerInc, lowerInf, upperInc, upperInf, empty
+}
+
+//rangeTypes are the builtin range types of the bound types
+var rangeTypes = map[reflect.Type]C.Oid{
+	reflect.TypeOf(int32(0)):    C.INT4RANGEOID,
+	reflect.TypeOf(int64(0)):    C.INT8RANGEOID,
+	reflect.TypeOf(Numeric("")): C.NUMRANGEOID,
+	reflect.TypeOf(time.Time{}): C.TSTZRANGEOID,
+}
+
+//rangeDatum returns the datum of the range, the bounds are converted by toDatum
+func rangeDatum(r rangeValue) Datum {
+	rangeType, ok := rangeTypes[r.elemType()]
+	if !ok {
+		raise("", fmt.Sprintf("range of %s not supported", r.elemType()), "")
+	}
+	return makeRange(rangeType, r, toDatum)
+}
+
+//timeRangeDatum returns the datum of the time range of the //plgo:time type, tsrange for timestamp and daterange for date
+func timeRangeDatum(r Range[time.Time], sqlType string) Datum {
+	rangeType := C.Oid(C.TSTZRANGEOID)
+	switch sqlType {
+	case "timestamp":
+		rangeType = C.TSRANGEOID
+	case "date":
+		rangeType = C.DATERANGEOID
+	}
+	return makeRange(rangeType, r, func(t interface{}) Datum {
+		return timeDatum(t.(time.Time), sqlType)
+	})
+}
+
+//makeRange returns the range datum of the range type with the bounds converted by elemDatum
+func makeRange(rangeType C.Oid, r rangeValue, elemDatum func(interface{}) Datum) Datum {
+	var lowerDatum, upperDatum C.Datum
+	lower, upper := r.bounds()
+	if lower != nil {
+		lowerDatum = (C.Datum)(elemDatum(lower))
+	}
+	if upper != nil {
+		upperDatum = (C.Datum)(elemDatum(upper))
+	}
+	lowerInc, upperInc, empty := r.flags()
+	return (Datum)(C.plgo_make_range(rangeType, lowerDatum, (C._Bool)(lowerInc), (C._Bool)(lower == nil),
+		upperDatum, (C._Bool)(upperInc), (C._Bool)(upper == nil), (C._Bool)(empty)))
+}
+
+//scanRange sets the range from the range datum, the bounds are scanned into the bound type
+func scanRange(oid C.Oid, typeName string, val C.Datum, target rangeTarget) error {
+	elemType := C.plgo_range_elem_type(oid)
+	if elemType == 0 {
+		return fmt.Errorf("Column type is not an range %s", typeName)
+	}
+	var lower, upper C.Datum
+	var lowerInc, lowerInf, upperInc, upperInf C.bool
+	empty := C.plgo_range_bounds(val, &lower, &lowerInc, &lowerInf, &upper, &upperInc, &upperInf) == (C._Bool)(true)
+	target.setFlags(lowerInc == (C._Bool)(true), lowerInf == (C._Bool)(true), upperInc == (C._Bool)(true), upperInf == (C._Bool)(true), empty)
+	if empty {
+		return nil
+	}
+	lowerTarget, upperTarget := target.boundTargets()
+	if lowerInf != (C._Bool)(true) {
+		if err := scanVal(elemType, typeName, lower, lowerTarget); err != nil {
+			return err
+		}
+	}
+	if upperInf != (C._Bool)(true) {
+		if err := scanVal(elemType, typeName, upper, upperTarget); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package plgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+//RateLimiter is an token bucket shared by all backends, the bucket is stored in an shared area
+//and updated under its entry lock, so the limit is global across the sessions
+type RateLimiter struct {
+	name string
+	//rate is the number of tokens added per second
+	rate float64
+	//burst is the capacity of the bucket
+	burst float64
+}
+
+//tokenBucket is the state of an rate limiter in the shared area
+type tokenBucket struct {
+	Tokens float64 `json:"t"`
+	//Updated is the time of the last refill in unix nanoseconds
+	Updated int64 `json:"u"`
+}
+
+//NewRateLimiter returns the limiter allowing rate events per second with bursts of up to burst events,
+//the limiters with the same name share the bucket
+func NewRateLimiter(name string, rate float64, burst int) (*RateLimiter, error) {
+	if name == "" || len(name) >= sharedKeyLen {
+		return nil, fmt.Errorf("Rate limiter name must be 1 to %d bytes long: %q", sharedKeyLen-1, name)
+	}
+	if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) || burst < 1 {
+		return nil, fmt.Errorf("Rate limiter %s must have positive rate and burst", name)
+	}
+	return &RateLimiter{name: name, rate: rate, burst: float64(burst)}, nil
+}
+
+//rateLimits returns the shared area of the rate limiters of the extension
+func rateLimits() (*SharedArea, error) {
+	return AttachSharedArea(extensionName + " rate limits")
+}
+
+//reserve takes n tokens from the bucket if there are enough,
+//otherwise returns the time until there will be enough tokens
+func (l *RateLimiter) reserve(n int) (bool, time.Duration, error) {
+	if float64(n) > l.burst {
+		return false, 0, fmt.Errorf("Rate limiter %s can't allow %d events at once, the burst is %g", l.name, n, l.burst)
+	}
+	area, err := rateLimits()
+	if err != nil {
+		return false, 0, err
+	}
+	var allowed bool
+	var wait time.Duration
+	var bucketErr error
+	err = area.Update(l.name, func(old []byte, ok bool) []byte {
+		now := time.Now().UnixNano()
+		bucket := tokenBucket{Tokens: l.burst, Updated: now}
+		if ok {
+			if bucketErr = json.Unmarshal(old, &bucket); bucketErr != nil {
+				return old
+			}
+			elapsed := time.Duration(now - bucket.Updated).Seconds()
+			if elapsed > 0 {
+				bucket.Tokens = math.Min(l.burst, bucket.Tokens+elapsed*l.rate)
+			}
+			bucket.Updated = now
+		}
+		if bucket.Tokens >= float64(n) {
+			bucket.Tokens -= float64(n)
+			allowed = true
+		} else {
+			wait = time.Duration((float64(n) - bucket.Tokens) / l.rate * float64(time.Second))
+		}
+		var data []byte
+		if data, bucketErr = json.Marshal(bucket); bucketErr != nil {
+			return old
+		}
+		return data
+	})
+	if err == nil {
+		err = bucketErr
+	}
+	return allowed, wait, err
+}
+
+//Allow takes an token, returns false if the limit is exceeded
+func (l *RateLimiter) Allow() (bool, error) {
+	return l.AllowN(1)
+}
+
+//AllowN takes n tokens, returns false (and takes nothing) if there aren't enough
+func (l *RateLimiter) AllowN(n int) (bool, error) {
+	allowed, _, err := l.reserve(n)
+	return allowed, err
+}
+
+//Wait waits until n tokens can be taken, it returns ErrInterrupted on an query cancel or statement_timeout
+func (l *RateLimiter) Wait(n int) error {
+	for {
+		allowed, wait, err := l.reserve(n)
+		if err != nil || allowed {
+			return err
+		}
+		for wait > 0 {
+			if interruptPending() {
+				return ErrInterrupted
+			}
+			step := wait
+			if step > interruptPollInterval {
+				step = interruptPollInterval
+			}
+			time.Sleep(step)
+			wait -= step
+		}
+	}
+}
+
+//Reset refills the bucket of the limiter
+func (l *RateLimiter) Reset() error {
+	area, err := rateLimits()
+	if err != nil {
+		return err
+	}
+	_, err = area.Delete(l.name)
+	return err
+}
+
+//rateLimiterArgs reads the name, rate, burst and tokens arguments of the rate limit functions
+func rateLimiterArgs(fcinfo *funcInfo) (*RateLimiter, int) {
+	var name string
+	var rate float64
+	var burst, tokens int32
+	if err := fcinfo.Scan(&name, &rate, &burst, &tokens); err != nil {
+		Log.Error(err.Error())
+	}
+	limiter, err := NewRateLimiter(name, rate, int(burst))
+	if err != nil {
+		Log.Error(err.Error())
+	}
+	return limiter, int(tokens)
+}
+
+//export plgo_rate_limit
+func plgo_rate_limit(fcinfo *funcInfo) Datum {
+	limiter, tokens := rateLimiterArgs(fcinfo)
+	allowed, err := limiter.AllowN(tokens)
+	if err != nil {
+		Log.Error(err.Error())
+	}
+	return toDatum(allowed)
+}
+
+//export plgo_rate_limit_wait
+func plgo_rate_limit_wait(fcinfo *funcInfo) Datum {
+	limiter, tokens := rateLimiterArgs(fcinfo)
+	if err := limiter.Wait(tokens); err != nil {
+		Log.Error(err.Error())
+	}
+	return toDatum(nil)
+}
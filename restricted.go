@@ -0,0 +1,23 @@
+//go:build plgo_restricted
+
+package plgo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+//ErrRestricted is returned by the network access blocked in the restricted mode
+var ErrRestricted = errors.New("plgo: network access is not allowed in restricted mode")
+
+func init() {
+	//the default HTTP client is the usual way for libraries to reach the network
+	http.DefaultTransport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, ErrRestricted
+		},
+	}
+	http.DefaultClient = &http.Client{Transport: http.DefaultTransport}
+}
@@ -0,0 +1,219 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "executor/spi.h"
+*/
+import "C"
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+	"unsafe"
+)
+
+//columnName returns the column of the struct field, its `plgo:"name"` or `db:"name"` tag or the field name in snake case
+func columnName(field reflect.StructField) string {
+	if name := field.Tag.Get("plgo"); name != "" {
+		return name
+	}
+	if name := field.Tag.Get("db"); name != "" && name != "-" {
+		return name
+	}
+	return snakeCase(field.Name)
+}
+
+//snakeCase returns the column name of the field name, e.g. user_id from UserID
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+//column returns the index of the named column in the row
+func (row *TriggerRow) column(name string) (int, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	attnum := int(C.SPI_fnumber(row.tupleDesc, cname))
+	if attnum <= 0 {
+		return 0, fmt.Errorf("Column %s not found in the trigger row", name)
+	}
+	return attnum - 1, nil
+}
+
+//structValue returns the struct pointed by ptr
+func structValue(ptr interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("%T is not an pointer to struct", ptr)
+	}
+	return v.Elem(), nil
+}
+
+//ScanStruct sets the exported fields of the struct pointed by dest from the columns of the row,
+//the columns are named by the `plgo:"name"` tag or the field names in snake case, `plgo:"-"` skips the field.
+//The pointer fields of NULL columns are set to nil, the other fields to their zero values
+func (row *TriggerRow) ScanStruct(dest interface{}) error {
+	v, err := structValue(dest)
+	if err != nil {
+		return err
+	}
+	for _, index := range setColumns(v.Type()) {
+		field := v.Type().Field(index)
+		i, err := row.column(columnName(field))
+		if err != nil {
+			return err
+		}
+		target := v.Field(index)
+		if row.nulls[i] {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		oid := C.SPI_gettypeid(row.tupleDesc, C.int(i+1))
+		typeName := C.GoString(C.SPI_gettype(row.tupleDesc, C.int(i+1)))
+		if target.Kind() == reflect.Ptr {
+			value := reflect.New(target.Type().Elem())
+			if err = scanVal(oid, typeName, row.attrs[i], value.Interface()); err != nil {
+				return fmt.Errorf("Column %s: %w", field.Name, err)
+			}
+			target.Set(value)
+			continue
+		}
+		if err = scanVal(oid, typeName, row.attrs[i], target.Addr().Interface()); err != nil {
+			return fmt.Errorf("Column %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+//scanStruct sets the exported fields of the struct pointed by dest from the columns of the query result tuple,
+//the fields tagged `db:"-"` are skipped and the columns without an field are ignored
+func scanStruct(tupleDesc C.TupleDesc, tuple C.HeapTuple, dest interface{}) error {
+	v, err := structValue(dest)
+	if err != nil {
+		return err
+	}
+	for _, index := range setColumns(v.Type()) {
+		field := v.Type().Field(index)
+		if field.Tag.Get("db") == "-" {
+			continue
+		}
+		name := columnName(field)
+		cname := C.CString(name)
+		attnum := C.SPI_fnumber(tupleDesc, cname)
+		C.free(unsafe.Pointer(cname))
+		if attnum <= 0 {
+			return fmt.Errorf("Column %s not found in the result", name)
+		}
+		target := v.Field(index)
+		var isnull C.bool
+		val := C.SPI_getbinval(tuple, tupleDesc, attnum, &isnull)
+		if isnull == (C._Bool)(true) {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		oid := C.SPI_gettypeid(tupleDesc, attnum)
+		typeName := C.GoString(C.SPI_gettype(tupleDesc, attnum))
+		if target.Kind() == reflect.Ptr {
+			value := reflect.New(target.Type().Elem())
+			if err = scanVal(oid, typeName, val, value.Interface()); err != nil {
+				return fmt.Errorf("Column %s: %w", name, err)
+			}
+			target.Set(value)
+			continue
+		}
+		if err = scanVal(oid, typeName, val, target.Addr().Interface()); err != nil {
+			return fmt.Errorf("Column %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+//ScanStruct sets the exported fields of the struct pointed by dest from the columns of the current row,
+//the columns are named by the `db:"name"` (or `plgo:"name"`) tag or the field names in snake case, `db:"-"` skips the field.
+//The values are converted as by Scan, the pointer fields of NULL columns are set to nil, the other fields to their zero values.
+//The columns without an field are ignored
+func (rows *Rows) ScanStruct(dest interface{}) error {
+	return scanStruct(rows.tupleDesc, rows.current, dest)
+}
+
+//ScanStruct sets the exported fields of the struct pointed by dest from the columns of the row, as Rows.ScanStruct
+func (row *Row) ScanStruct(dest interface{}) error {
+	return scanStruct(row.tupleDesc, row.heapTuple, dest)
+}
+
+//SetStruct sets the columns of the row from the exported fields of the struct pointed by src,
+//the nil pointer fields set the columns to NULL, the columns without an field are unchanged
+func (row *TriggerRow) SetStruct(src interface{}) error {
+	v, err := structValue(src)
+	if err != nil {
+		return err
+	}
+	for _, index := range setColumns(v.Type()) {
+		i, err := row.column(columnName(v.Type().Field(index)))
+		if err != nil {
+			return err
+		}
+		value := v.Field(index)
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				row.Set(i, nil)
+				continue
+			}
+			value = value.Elem()
+		}
+		row.Set(i, value.Interface())
+	}
+	return nil
+}
+
+//scanRows sets newRow and oldRow (pointers to the struct pointers of an typed trigger) from NEW and OLD,
+//the missing row is nil
+func (td *TriggerData) scanRows(newRow, oldRow interface{}) error {
+	rows := []struct {
+		row    *TriggerRow
+		target interface{}
+	}{{td.NewRow, newRow}, {td.OldRow, oldRow}}
+	for _, r := range rows {
+		if r.row == nil {
+			continue
+		}
+		target := reflect.ValueOf(r.target).Elem()
+		value := reflect.New(target.Type().Elem())
+		if err := r.row.ScanStruct(value.Interface()); err != nil {
+			return err
+		}
+		target.Set(value)
+	}
+	return nil
+}
+
+//returnRow returns the result of an typed trigger, NEW (OLD for DELETE) with the columns set from the returned struct.
+//nil returns NULL, it skips the operation in an BEFORE trigger
+func (td *TriggerData) returnRow(row interface{}) Datum {
+	if v := reflect.ValueOf(row); !v.IsValid() || v.IsNil() {
+		return toDatum(nil)
+	}
+	target := td.NewRow
+	if target == nil {
+		target = td.OldRow
+	}
+	if target == nil {
+		return toDatum(nil)
+	}
+	if err := target.SetStruct(row); err != nil {
+		Log.Error(err.Error())
+	}
+	return toDatum(target)
+}
@@ -0,0 +1,159 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "access/tupdesc.h"
+#include "catalog/pg_type.h"
+#include "executor/spi.h"
+#include "utils/lsyscache.h"
+
+extern char *plgo_text_output(Oid type, Datum value);
+
+int plgo_tupdesc_natts(TupleDesc tupdesc) {
+	return tupdesc->natts;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"time"
+	"unsafe"
+)
+
+//valueTypes are the Go types of the SQL types of the values returned by Values and Map,
+//the arrays of the array element types are slices (of pointers if they contain NULL)
+var valueTypes = map[C.Oid]reflect.Type{
+	C.BOOLOID:        reflect.TypeOf(false),
+	C.INT2OID:        reflect.TypeOf(int16(0)),
+	C.INT4OID:        reflect.TypeOf(int32(0)),
+	C.INT8OID:        reflect.TypeOf(int64(0)),
+	C.FLOAT4OID:      reflect.TypeOf(float32(0)),
+	C.FLOAT8OID:      reflect.TypeOf(float64(0)),
+	C.NUMERICOID:     reflect.TypeOf(Numeric("")),
+	C.TEXTOID:        reflect.TypeOf(""),
+	C.BYTEAOID:       reflect.TypeOf([]byte(nil)),
+	C.TIMESTAMPTZOID: reflect.TypeOf(time.Time{}),
+	C.TIMESTAMPOID:   reflect.TypeOf(time.Time{}),
+	C.DATEOID:        reflect.TypeOf(time.Time{}),
+	C.INTERVALOID:    reflect.TypeOf(time.Duration(0)),
+	C.UUIDOID:        reflect.TypeOf(UUID{}),
+	C.INETOID:        reflect.TypeOf(netip.Addr{}),
+	C.CIDROID:        reflect.TypeOf(netip.Prefix{}),
+	C.MACADDROID:     reflect.TypeOf(net.HardwareAddr(nil)),
+	C.MACADDR8OID:    reflect.TypeOf(net.HardwareAddr(nil)),
+	C.INT4RANGEOID:   reflect.TypeOf(Range[int32]{}),
+	C.INT8RANGEOID:   reflect.TypeOf(Range[int64]{}),
+	C.NUMRANGEOID:    reflect.TypeOf(Range[Numeric]{}),
+	C.TSTZRANGEOID:   reflect.TypeOf(Range[time.Time]{}),
+	C.TSRANGEOID:     reflect.TypeOf(Range[time.Time]{}),
+	C.DATERANGEOID:   reflect.TypeOf(Range[time.Time]{}),
+	//the json documents are decoded into maps, slices, strings, float64 and bool
+	C.JSONBOID: reflect.TypeOf((*interface{})(nil)).Elem(),
+	C.JSONOID:  reflect.TypeOf((*interface{})(nil)).Elem(),
+}
+
+//columnValue returns the value of the column converted to the Go type of its SQL type in valueTypes,
+//the enums and the types missing in valueTypes are returned in their text form
+func columnValue(oid C.Oid, typeName string, val C.Datum) (interface{}, error) {
+	if goType, ok := valueTypes[oid]; ok {
+		value := reflect.New(goType)
+		if err := scanVal(oid, typeName, val, value.Interface()); err != nil {
+			return nil, err
+		}
+		return value.Elem().Interface(), nil
+	}
+	if elemGoType, ok := valueTypes[C.get_element_type(oid)]; ok && isArrayElem(elemGoType) {
+		value := reflect.New(reflect.SliceOf(elemGoType))
+		if err := scanVal(oid, typeName, val, value.Interface()); err == nil {
+			return value.Elem().Interface(), nil
+		}
+		//the arrays with NULL elements
+		value = reflect.New(reflect.SliceOf(reflect.PtrTo(elemGoType)))
+		if err := scanVal(oid, typeName, val, value.Interface()); err != nil {
+			return nil, err
+		}
+		return value.Elem().Interface(), nil
+	}
+	text := C.plgo_text_output(oid, val)
+	defer C.pfree(unsafe.Pointer(text))
+	return C.GoString(text), nil
+}
+
+func isArrayElem(t reflect.Type) bool {
+	_, ok := arrayElemOid(t)
+	return ok
+}
+
+//rowValues returns the values of the columns of the tuple, NULL is nil
+func rowValues(tupleDesc C.TupleDesc, tuple C.HeapTuple) ([]interface{}, error) {
+	values := make([]interface{}, int(C.plgo_tupdesc_natts(tupleDesc)))
+	for i := range values {
+		var isnull C.bool
+		val := C.SPI_getbinval(tuple, tupleDesc, C.int(i+1), &isnull)
+		if isnull == (C._Bool)(true) {
+			continue
+		}
+		oid := C.SPI_gettypeid(tupleDesc, C.int(i+1))
+		typeName := C.GoString(C.SPI_gettype(tupleDesc, C.int(i+1)))
+		value, err := columnValue(oid, typeName, val)
+		if err != nil {
+			return nil, fmt.Errorf("Column %d: %w", i+1, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+//rowMap returns the values of the columns of the tuple by the column names, NULL is nil
+func rowMap(tupleDesc C.TupleDesc, tuple C.HeapTuple) (map[string]interface{}, error) {
+	values, err := rowValues(tupleDesc, tuple)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		m[C.GoString(C.SPI_fname(tupleDesc, C.int(i+1)))] = value
+	}
+	return m, nil
+}
+
+//Values returns the values of the columns of the current row converted to the Go types of their SQL types
+//(int32 for integer, time.Time for timestamptz, plgo.Numeric for numeric, ...), NULL is nil.
+//The types without a Go type, e.g. the enums, are returned in their text form
+func (rows *Rows) Values() ([]interface{}, error) {
+	return rowValues(rows.tupleDesc, rows.current)
+}
+
+//Map returns the values of the current row as Values by the column names, the later columns with the same name win
+func (rows *Rows) Map() (map[string]interface{}, error) {
+	return rowMap(rows.tupleDesc, rows.current)
+}
+
+//Values returns the values of the columns of the row, as Rows.Values
+func (row *Row) Values() ([]interface{}, error) {
+	return rowValues(row.tupleDesc, row.heapTuple)
+}
+
+//Map returns the values of the row by the column names, as Rows.Map
+func (row *Row) Map() (map[string]interface{}, error) {
+	return rowMap(row.tupleDesc, row.heapTuple)
+}
+
+//Values returns the values of the columns of the current row, as Rows.Values
+func (c *Cursor) Values() ([]interface{}, error) {
+	if c.rows == nil {
+		return nil, fmt.Errorf("Cursor has no current row")
+	}
+	return c.rows.Values()
+}
+
+//Map returns the values of the current row by the column names, as Rows.Map
+func (c *Cursor) Map() (map[string]interface{}, error) {
+	if c.rows == nil {
+		return nil, fmt.Errorf("Cursor has no current row")
+	}
+	return c.rows.Map()
+}
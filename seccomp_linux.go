@@ -0,0 +1,163 @@
+//go:build plgo_restricted && plgo_seccomp
+
+package plgo
+
+/*
+#define _GNU_SOURCE
+#include <link.h>
+#include <stdint.h>
+
+//plgo_text_range finds the executable segment of the shared object of the extension, the Go runtime is linked into it
+static int plgo_text_phdr(struct dl_phdr_info *info, size_t size, void *data) {
+	uintptr_t *text = data;
+	uintptr_t self = (uintptr_t) &plgo_text_phdr;
+	for (int i = 0; i < info->dlpi_phnum; i++) {
+		const ElfW(Phdr) *phdr = &info->dlpi_phdr[i];
+		if (phdr->p_type != PT_LOAD || !(phdr->p_flags & PF_X)) {
+			continue;
+		}
+		uintptr_t start = info->dlpi_addr + phdr->p_vaddr;
+		if (self >= start && self < start + phdr->p_memsz) {
+			text[0] = start;
+			text[1] = start + phdr->p_memsz;
+			return 1;
+		}
+	}
+	return 0;
+}
+
+static int plgo_text_range(uintptr_t *text) {
+	return dl_iterate_phdr(plgo_text_phdr, text);
+}
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+//seccomp constants from linux/seccomp.h and linux/audit.h
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+	seccompRetAllow        = 0x7fff0000
+	seccompRetErrno        = 0x00050000
+	auditArchX8664         = 0xc000003e
+	auditArchAarch64       = 0xc00000b7
+	prSetNoNewPrivs        = 38
+	sysSeccompAmd64        = 317
+	sysSeccompArm64        = 277
+	//x32SyscallBit marks the syscalls of the x32 ABI, they have the x86-64 arch
+	x32SyscallBit = 0x40000000
+)
+
+//fileSyscalls are the syscalls opening, changing or executing the files, by architecture:
+//open, creat, openat, openat2, truncate, rename, renameat, renameat2, mkdir, mkdirat, rmdir, mknod, mknodat,
+//link, linkat, unlink, unlinkat, symlink, symlinkat, chmod, fchmodat, fchmodat2, chown, lchown, fchownat, execve, execveat.
+//arm64 has only the *at syscalls
+var fileSyscalls = map[string][]uint32{
+	"amd64": {2, 85, 257, 437, 76, 82, 264, 316, 83, 258, 84, 133, 259, 86, 265, 87, 263, 88, 266, 90, 268, 452, 92, 94, 260, 59, 322},
+	"arm64": {56, 437, 45, 38, 276, 34, 33, 37, 35, 36, 53, 452, 54, 221, 281},
+}
+
+var seccompInstalled bool
+
+//enterRestricted installs an seccomp filter into the backend before the first call of an exported function,
+//the filter denies the file system and the creation of all but unix domain sockets to the code of the extension
+//(the Go code and the runtime linked into its shared object). The filter can't be removed, it applies to all threads
+//of the backend, but PostgreSQL and the other extensions (dblink, postgres_fdw) keep their files and sockets.
+//The open files stay usable, the time zone of time.Local is loaded before the filter
+func enterRestricted() {
+	if seccompInstalled {
+		return
+	}
+	//time.Local is loaded on its first use, from /etc/localtime or the TZ zone
+	_ = time.Local.String()
+	if err := installSeccomp(); err != nil {
+		//the call is aborted until the filter is installed
+		Log.Error(fmt.Sprintf("cannot install seccomp filter: %s", err))
+		return
+	}
+	seccompInstalled = true
+}
+
+//seccompFilter returns the filter program denying the syscalls of the code between start and end
+func seccompFilter(arch uint32, syscalls []uint32, start, end uint64) []syscall.SockFilter {
+	deny := uint32(seccompRetErrno | uint32(syscall.EACCES))
+	const (
+		ld  = syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS
+		jeq = syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K
+		jge = syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K
+		jgt = syscall.BPF_JMP | syscall.BPF_JGT | syscall.BPF_K
+		ret = syscall.BPF_RET | syscall.BPF_K
+	)
+	filter := []syscall.SockFilter{
+		//seccomp_data.arch
+		{Code: ld, K: 4},
+		{Code: jeq, Jt: 1, Jf: 0, K: arch},
+		{Code: ret, K: deny},
+		//seccomp_data.nr, the x32 syscalls are denied
+		{Code: ld, K: 0},
+		{Code: jge, Jt: 0, Jf: 1, K: x32SyscallBit},
+		{Code: ret, K: deny},
+	}
+	//the guarded syscalls jump to the check of the code, the others are allowed
+	guarded := append([]uint32{syscall.SYS_SOCKET}, syscalls...)
+	for i, nr := range guarded {
+		filter = append(filter, syscall.SockFilter{Code: jeq, Jt: uint8(len(guarded) - i), Jf: 0, K: nr})
+	}
+	filter = append(filter, []syscall.SockFilter{
+		{Code: ret, K: seccompRetAllow},
+		//seccomp_data.instruction_pointer, the syscalls of the other code are allowed
+		{Code: ld, K: 12},
+		{Code: jeq, Jt: 0, Jf: 8, K: uint32(start >> 32)},
+		{Code: ld, K: 8},
+		{Code: jge, Jt: 0, Jf: 6, K: uint32(start)},
+		{Code: jgt, Jt: 5, Jf: 0, K: uint32(end)},
+		//seccomp_data.args[0] of socket, the socket domain, the file syscalls are denied
+		{Code: ld, K: 0},
+		{Code: jeq, Jt: 0, Jf: 2, K: syscall.SYS_SOCKET},
+		{Code: ld, K: 16},
+		{Code: jeq, Jt: 1, Jf: 0, K: syscall.AF_UNIX},
+		{Code: ret, K: deny},
+		{Code: ret, K: seccompRetAllow},
+	}...)
+	return filter
+}
+
+func installSeccomp() error {
+	var arch uint32
+	var sysSeccomp uintptr
+	switch runtime.GOARCH {
+	case "amd64":
+		arch, sysSeccomp = auditArchX8664, sysSeccompAmd64
+	case "arm64":
+		arch, sysSeccomp = auditArchAarch64, sysSeccompArm64
+	default:
+		return fmt.Errorf("unsupported architecture %s", runtime.GOARCH)
+	}
+	var text [2]C.uintptr_t
+	if C.plgo_text_range(&text[0]) == 0 {
+		return errors.New("cannot find the code of the extension")
+	}
+	start, end := uint64(text[0]), uint64(text[1])-1
+	//the instruction pointer is compared by its words, the code must not cross an 4 GiB boundary
+	if start>>32 != end>>32 {
+		return errors.New("the code of the extension crosses an 4 GiB boundary")
+	}
+	filter := seccompFilter(arch, fileSyscalls[runtime.GOARCH], start, end)
+	program := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return errno
+	}
+	_, _, errno := syscall.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&program)))
+	runtime.KeepAlive(filter)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package plgo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+//redacted replaces the secrets in the printed and logged values
+const redacted = "[REDACTED]"
+
+//Secret is an secret value like an API key, it is redacted when printed, formatted into an error or logged,
+//use Value to get the secret itself
+type Secret string
+
+//Value returns the secret
+func (s Secret) Value() string {
+	return string(s)
+}
+
+//String returns the redacted placeholder
+func (s Secret) String() string {
+	return redacted
+}
+
+//GoString returns the redacted placeholder
+func (s Secret) GoString() string {
+	return redacted
+}
+
+//Format writes the redacted placeholder for all verbs
+func (s Secret) Format(f fmt.State, verb rune) {
+	f.Write([]byte(redacted))
+}
+
+//MarshalJSON encodes the redacted placeholder
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+//secretSettings are the settings declared with DeclareSecret by the secret names
+var secretSettings = map[string]*stringGUC{}
+
+//credentialsFile is <extension>.credentials_file
+var credentialsFile = newStringGUC(gucDesc{
+	name:      "credentials_file",
+	shortDesc: "Sets the file with the secrets of the extension.",
+	longDesc:  "The file has name=value lines and must be owned by root or the server user and not accessible by others.",
+	context:   gucSighup,
+	flags:     gucSuperuserOnly,
+}, "")
+
+//DeclareSecret defines the superuser-only setting <extension>.<name> holding an secret,
+//it can be set only in postgresql.conf, so the secret isn't written into the statement log.
+//It must be called from an init() function of the package
+func DeclareSecret(name, description string) {
+	secretSettings[name] = newStringGUC(gucDesc{
+		name:      name,
+		shortDesc: description,
+		context:   gucSighup,
+		flags:     gucSuperuserOnly,
+	}, "")
+}
+
+//GetSecret returns the secret from the setting declared with DeclareSecret,
+//or if it is not set, from the <extension>.credentials_file.
+//The returned secrets are also redacted from the lines written by the Logger
+func GetSecret(name string) (Secret, error) {
+	if setting, ok := secretSettings[name]; ok {
+		if value := setting.get(); value != "" {
+			rememberSecret(value)
+			return Secret(value), nil
+		}
+	}
+	path := credentialsFile.get()
+	if path == "" {
+		return "", fmt.Errorf("Secret %s is not set", name)
+	}
+	credentials, err := readCredentials(path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := credentials[name]
+	if !ok {
+		return "", fmt.Errorf("Secret %s is not set in %s", name, path)
+	}
+	rememberSecret(value)
+	return Secret(value), nil
+}
+
+//credentialsCache is the last read credentials file, it is read again when it changes
+var credentialsCache struct {
+	path    string
+	modTime time.Time
+	size    int64
+	values  map[string]string
+}
+
+func readCredentials(path string) (map[string]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read credentials file: %w", err)
+	}
+	if credentialsCache.values != nil && credentialsCache.path == path &&
+		credentialsCache.modTime.Equal(info.ModTime()) && credentialsCache.size == info.Size() {
+		return credentialsCache.values, nil
+	}
+	if err := checkCredentialsPermissions(path, info); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read credentials file: %w", err)
+	}
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	credentialsCache.path = path
+	credentialsCache.modTime = info.ModTime()
+	credentialsCache.size = info.Size()
+	credentialsCache.values = values
+	return values, nil
+}
+
+//knownSecrets are the secrets returned by GetSecret in this backend
+var knownSecrets = map[string]bool{}
+
+func rememberSecret(value string) {
+	//too short values would redact random parts of the log lines
+	if len(value) >= 4 {
+		knownSecrets[value] = true
+	}
+}
+
+//RedactSecrets replaces the secrets returned by GetSecret in the string, e.g. in the error of an external API
+func RedactSecrets(s string) string {
+	for secret := range knownSecrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
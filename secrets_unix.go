@@ -0,0 +1,27 @@
+//go:build !windows
+
+package plgo
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+//checkCredentialsPermissions accepts the same ownership as the server for its ssl key:
+//owned by the server user and accessible only by it, or owned by root and readable by its group
+func checkCredentialsPermissions(path string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	mode := info.Mode().Perm()
+	switch {
+	case int(stat.Uid) == os.Getuid() && mode&0077 == 0:
+		return nil
+	case stat.Uid == 0 && mode&0037 == 0:
+		return nil
+	}
+	return fmt.Errorf("Credentials file %s has group or world access or wrong owner, "+
+		"it must be owned by the server user (mode 0600) or by root (mode 0640)", path)
+}
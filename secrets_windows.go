@@ -0,0 +1,8 @@
+package plgo
+
+import "os"
+
+//checkCredentialsPermissions doesn't check the file ACLs on windows
+func checkCredentialsPermissions(path string, info os.FileInfo) error {
+	return nil
+}
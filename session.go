@@ -0,0 +1,77 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "miscadmin.h"
+#include "commands/dbcommands.h"
+#include "utils/guc.h"
+
+Oid plgo_user_id(void) {
+	return GetUserId();
+}
+
+Oid plgo_session_user_id(void) {
+	return GetSessionUserId();
+}
+
+Oid plgo_database_id(void) {
+	return MyDatabaseId;
+}
+
+//plgo_user_name returns the name of the role, NULL if it doesn't exist
+char *plgo_user_name(Oid roleid) {
+	return GetUserNameFromId(roleid, true);
+}
+
+const char *plgo_application_name(void) {
+	return GetConfigOption("application_name", true, false);
+}
+*/
+import "C"
+import "unsafe"
+
+//Session describes the current session, the roles checking the privileges and the database
+type Session struct {
+	//UserID and User are the current role (current_user), it changes in the SECURITY DEFINER functions and with SET ROLE
+	UserID Oid
+	User   string
+	//SessionUserID and SessionUser are the role of the session (session_user)
+	SessionUserID Oid
+	SessionUser   string
+	DatabaseID    Oid
+	Database      string
+	//ApplicationName is the application_name of the client
+	ApplicationName string
+	//PID is the process id of the backend, pg_backend_pid()
+	PID int
+}
+
+//SessionInfo returns the current session, without an SPI query, e.g. for auditing or row filtering
+func SessionInfo() Session {
+	s := Session{
+		UserID:        Oid(C.plgo_user_id()),
+		SessionUserID: Oid(C.plgo_session_user_id()),
+		DatabaseID:    Oid(C.plgo_database_id()),
+		PID:           int(C.MyProcPid),
+	}
+	s.User = roleName(s.UserID)
+	s.SessionUser = roleName(s.SessionUserID)
+	if database := C.get_database_name(C.Oid(s.DatabaseID)); database != nil {
+		s.Database = C.GoString(database)
+		C.pfree(unsafe.Pointer(database))
+	}
+	if name := C.plgo_application_name(); name != nil {
+		s.ApplicationName = C.GoString(name)
+	}
+	return s
+}
+
+//roleName returns the name of the role, "" if it was dropped
+func roleName(id Oid) string {
+	name := C.plgo_user_name(C.Oid(id))
+	if name == nil {
+		return ""
+	}
+	defer C.pfree(unsafe.Pointer(name))
+	return C.GoString(name)
+}
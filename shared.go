@@ -0,0 +1,462 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "miscadmin.h"
+#include "storage/ipc.h"
+#include "storage/lwlock.h"
+#include "storage/shmem.h"
+#include "utils/dsa.h"
+#include "utils/memutils.h"
+#include "lib/dshash.h"
+#if PG_VERSION_NUM >= 170000
+#include "storage/dsm_registry.h"
+
+// the named DSM segments have NAMEDATALEN long names
+#define PLGO_SHMEM_NAMELEN 64
+#else
+#define PLGO_SHMEM_NAMELEN SHMEM_INDEX_KEYSIZE
+// PLGO_SHMEM_RESERVE is the shared memory reserved at preload for the control structs of the shared areas and the cache
+#define PLGO_SHMEM_RESERVE (32 * 1024)
+#endif
+
+#define PLGO_SHARED_KEYLEN 64
+
+extern bool plgo_preloading(void);
+
+typedef struct plgo_shared_entry {
+	char key[PLGO_SHARED_KEYLEN];
+	int64 counter;
+	dsa_pointer value;
+	Size value_len;
+} plgo_shared_entry;
+
+typedef struct plgo_shared_control {
+	bool initialized;
+	int refcount;
+	int tranche_id;
+	dsa_handle area;
+	dshash_table_handle table;
+} plgo_shared_control;
+
+typedef struct plgo_shared_map {
+	plgo_shared_control *control;
+	dsa_area *area;
+	dshash_table *table;
+} plgo_shared_map;
+
+static void plgo_shared_params(dshash_parameters *params, int tranche_id) {
+	MemSet(params, 0, sizeof(dshash_parameters));
+	params->key_size = PLGO_SHARED_KEYLEN;
+	params->entry_size = sizeof(plgo_shared_entry);
+	params->compare_function = dshash_memcmp;
+	params->hash_function = dshash_memhash;
+#if PG_VERSION_NUM >= 170000
+	params->copy_function = dshash_memcpy;
+#endif
+	params->tranche_id = tranche_id;
+}
+
+static void plgo_shared_key(char *dst, char *key) {
+	MemSet(dst, 0, PLGO_SHARED_KEYLEN);
+	strlcpy(dst, key, PLGO_SHARED_KEYLEN);
+}
+
+// plgo_shared_detach drops the backend's reference to the area, the last
+// backend marks the control struct as uninitialized, because the DSM segment
+// is destroyed together with its last mapping
+static void plgo_shared_detach(int code, Datum arg) {
+	plgo_shared_control *control = (plgo_shared_control *) DatumGetPointer(arg);
+	LWLockAcquire(AddinShmemInitLock, LW_EXCLUSIVE);
+	if (--control->refcount == 0)
+		control->initialized = false;
+	LWLockRelease(AddinShmemInitLock);
+}
+
+#if PG_VERSION_NUM >= 150000 && PG_VERSION_NUM < 170000
+static shmem_request_hook_type plgo_prev_shmem_request_hook = NULL;
+
+static void plgo_shmem_request(void) {
+	if (plgo_prev_shmem_request_hook)
+		plgo_prev_shmem_request_hook();
+	RequestAddinShmemSpace(PLGO_SHMEM_RESERVE);
+}
+#endif
+
+// plgo_shmem_reserve reserves the shared memory for the control structs, it's called from _PG_init of the preloaded library.
+// The named DSM segments need no reservation
+void plgo_shmem_reserve(void) {
+#if PG_VERSION_NUM >= 150000 && PG_VERSION_NUM < 170000
+	plgo_prev_shmem_request_hook = shmem_request_hook;
+	shmem_request_hook = plgo_shmem_request;
+#elif PG_VERSION_NUM < 150000
+	RequestAddinShmemSpace(PLGO_SHMEM_RESERVE);
+#endif
+}
+
+// plgo_shmem_init_struct finds or allocates the named control struct, the caller holds AddinShmemInitLock.
+// Since PostgreSQL 17 the struct is in an named DSM segment, the older versions allocate it from the spare main
+// shared memory, which is enlarged by plgo_shmem_reserve when the library is preloaded
+void *plgo_shmem_init_struct(char *name, Size size, bool *found) {
+#if PG_VERSION_NUM >= 170000
+	return GetNamedDSMSegment(name, size, NULL, found);
+#else
+	return ShmemInitStruct(name, size, found);
+#endif
+}
+
+// plgo_shared_attach attaches the area, shmem_name fits into PLGO_SHMEM_NAMELEN
+plgo_shared_map *plgo_shared_attach(char *shmem_name) {
+	bool found;
+	dshash_parameters params;
+	plgo_shared_control *control;
+	plgo_shared_map *map;
+	MemoryContext old = MemoryContextSwitchTo(TopMemoryContext);
+
+	map = palloc0(sizeof(plgo_shared_map));
+	LWLockAcquire(AddinShmemInitLock, LW_EXCLUSIVE);
+	control = plgo_shmem_init_struct(shmem_name, sizeof(plgo_shared_control), &found);
+	if (!found) {
+		control->initialized = false;
+		control->refcount = 0;
+		control->tranche_id = LWLockNewTrancheId();
+	}
+	LWLockRegisterTranche(control->tranche_id, "plgo_shared");
+	plgo_shared_params(&params, control->tranche_id);
+	if (!control->initialized) {
+		map->area = dsa_create(control->tranche_id);
+		map->table = dshash_create(map->area, &params, NULL);
+		control->area = dsa_get_handle(map->area);
+		control->table = dshash_get_hash_table_handle(map->table);
+		control->initialized = true;
+	} else {
+		map->area = dsa_attach(control->area);
+		map->table = dshash_attach(map->area, &params, control->table, NULL);
+	}
+	dsa_pin_mapping(map->area);
+	control->refcount++;
+	map->control = control;
+	LWLockRelease(AddinShmemInitLock);
+	before_shmem_exit(plgo_shared_detach, PointerGetDatum(control));
+	MemoryContextSwitchTo(old);
+	return map;
+}
+
+plgo_shared_entry *plgo_shared_find(plgo_shared_map *map, char *key, bool exclusive) {
+	char keybuf[PLGO_SHARED_KEYLEN];
+	plgo_shared_key(keybuf, key);
+	return dshash_find(map->table, keybuf, exclusive);
+}
+
+plgo_shared_entry *plgo_shared_find_or_insert(plgo_shared_map *map, char *key) {
+	char keybuf[PLGO_SHARED_KEYLEN];
+	bool found;
+	plgo_shared_entry *entry;
+	plgo_shared_key(keybuf, key);
+	entry = dshash_find_or_insert(map->table, keybuf, &found);
+	if (!found) {
+		entry->counter = 0;
+		entry->value = InvalidDsaPointer;
+		entry->value_len = 0;
+	}
+	return entry;
+}
+
+void plgo_shared_release(plgo_shared_map *map, plgo_shared_entry *entry) {
+	dshash_release_lock(map->table, entry);
+}
+
+void *plgo_shared_value(plgo_shared_map *map, plgo_shared_entry *entry) {
+	if (!DsaPointerIsValid(entry->value))
+		return NULL;
+	return dsa_get_address(map->area, entry->value);
+}
+
+void plgo_shared_set_value(plgo_shared_map *map, plgo_shared_entry *entry, void *value, Size len) {
+	if (DsaPointerIsValid(entry->value))
+		dsa_free(map->area, entry->value);
+	entry->value = dsa_allocate(map->area, len > 0 ? len : 1);
+	memcpy(dsa_get_address(map->area, entry->value), value, len);
+	entry->value_len = len;
+}
+
+bool plgo_shared_delete(plgo_shared_map *map, char *key) {
+	plgo_shared_entry *entry = plgo_shared_find(map, key, true);
+	if (entry == NULL)
+		return false;
+	if (DsaPointerIsValid(entry->value))
+		dsa_free(map->area, entry->value);
+	dshash_delete_entry(map->table, entry);
+	return true;
+}
+
+// plgo_shared_keys returns palloc'd array of the keys in the table
+char **plgo_shared_keys(plgo_shared_map *map, int *count) {
+	dshash_seq_status status;
+	plgo_shared_entry *entry;
+	int size = 16;
+	char **keys = palloc(sizeof(char *) * size);
+	*count = 0;
+	dshash_seq_init(&status, map->table, false);
+	while ((entry = dshash_seq_next(&status)) != NULL) {
+		if (*count == size) {
+			size *= 2;
+			keys = repalloc(keys, sizeof(char *) * size);
+		}
+		keys[(*count)++] = pstrdup(entry->key);
+	}
+	dshash_seq_term(&status);
+	return keys;
+}
+
+char *plgo_shared_key_at(char **keys, int i) {
+	return keys[i];
+}
+*/
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"unsafe"
+)
+
+func init() {
+	onInit(func() {
+		if C.plgo_preloading() == (C._Bool)(true) {
+			C.plgo_shmem_reserve()
+		}
+	})
+}
+
+//shmemName returns the name of the shared memory control struct of an shared area or the cache,
+//the names that don't fit into the shared memory index (into the DSM registry since PostgreSQL 17) are rejected
+func shmemName(prefix, name string) (*C.char, error) {
+	shmem := prefix + name
+	if len(shmem) >= C.PLGO_SHMEM_NAMELEN {
+		return nil, fmt.Errorf("Shared memory name %q must be shorter than %d bytes", shmem, C.PLGO_SHMEM_NAMELEN)
+	}
+	return C.CString(shmem), nil
+}
+
+//sharedKeyLen is the maximum length of an key in shared area (including the terminating zero byte)
+const sharedKeyLen = 64
+
+//SharedArea is a named hash table in dynamic shared memory, that is visible to all backends.
+//The area is created by the first backend that attaches it
+//and lives until the last attached backend exits (it's tied to the DSM segment)
+type SharedArea struct {
+	name string
+	m    *C.plgo_shared_map
+}
+
+var sharedAreas = make(map[string]*SharedArea)
+
+//AttachSharedArea attaches to the named shared area, it creates the area if it doesn't exist yet.
+//The area stays attached until the backend exits
+func AttachSharedArea(name string) (*SharedArea, error) {
+	if area, ok := sharedAreas[name]; ok {
+		return area, nil
+	}
+	if name == "" {
+		return nil, fmt.Errorf("Shared area name can't be empty")
+	}
+	cname, err := shmemName("plgo shared ", name)
+	if err != nil {
+		return nil, err
+	}
+	defer C.free(unsafe.Pointer(cname))
+	area := &SharedArea{name: name, m: C.plgo_shared_attach(cname)}
+	sharedAreas[name] = area
+	return area, nil
+}
+
+//Name returns the name of the shared area
+func (a *SharedArea) Name() string {
+	return a.name
+}
+
+func sharedKey(key string) (*C.char, error) {
+	if len(key) == 0 || len(key) >= sharedKeyLen {
+		return nil, fmt.Errorf("Shared area key must be 1 to %d bytes long: %q", sharedKeyLen-1, key)
+	}
+	return C.CString(key), nil
+}
+
+//Add atomically adds delta to the counter stored under the key and returns the new value
+func (a *SharedArea) Add(key string, delta int64) (int64, error) {
+	ckey, err := sharedKey(key)
+	if err != nil {
+		return 0, err
+	}
+	defer C.free(unsafe.Pointer(ckey))
+	entry := C.plgo_shared_find_or_insert(a.m, ckey)
+	entry.counter += C.int64(delta)
+	ret := int64(entry.counter)
+	C.plgo_shared_release(a.m, entry)
+	return ret, nil
+}
+
+//Counter returns the counter stored under the key
+func (a *SharedArea) Counter(key string) (int64, error) {
+	ckey, err := sharedKey(key)
+	if err != nil {
+		return 0, err
+	}
+	defer C.free(unsafe.Pointer(ckey))
+	entry := C.plgo_shared_find(a.m, ckey, (C._Bool)(false))
+	if entry == nil {
+		return 0, nil
+	}
+	ret := int64(entry.counter)
+	C.plgo_shared_release(a.m, entry)
+	return ret, nil
+}
+
+//Get returns a copy of the value stored under the key
+func (a *SharedArea) Get(key string) ([]byte, bool, error) {
+	ckey, err := sharedKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	defer C.free(unsafe.Pointer(ckey))
+	entry := C.plgo_shared_find(a.m, ckey, (C._Bool)(false))
+	if entry == nil {
+		return nil, false, nil
+	}
+	defer C.plgo_shared_release(a.m, entry)
+	value := C.plgo_shared_value(a.m, entry)
+	if value == nil {
+		return nil, false, nil
+	}
+	return C.GoBytes(value, C.int(entry.value_len)), true, nil
+}
+
+//Set stores the value under the key
+func (a *SharedArea) Set(key string, value []byte) error {
+	return a.Update(key, func(old []byte, ok bool) []byte {
+		return value
+	})
+}
+
+//Update replaces the value stored under the key with the result of fn,
+//the entry is locked while fn runs, so the update is atomic across backends.
+//fn must not access the same shared area
+func (a *SharedArea) Update(key string, fn func(old []byte, ok bool) []byte) error {
+	ckey, err := sharedKey(key)
+	if err != nil {
+		return err
+	}
+	defer C.free(unsafe.Pointer(ckey))
+	entry := C.plgo_shared_find_or_insert(a.m, ckey)
+	defer C.plgo_shared_release(a.m, entry)
+	var old []byte
+	value := C.plgo_shared_value(a.m, entry)
+	if value != nil {
+		old = C.GoBytes(value, C.int(entry.value_len))
+	}
+	newValue := fn(old, value != nil)
+	var p unsafe.Pointer
+	if len(newValue) > 0 {
+		p = C.CBytes(newValue)
+		defer C.free(p)
+	}
+	C.plgo_shared_set_value(a.m, entry, p, C.Size(len(newValue)))
+	return nil
+}
+
+//Delete removes the key (with its counter and value) from the area, returns false if it wasn't there
+func (a *SharedArea) Delete(key string) (bool, error) {
+	ckey, err := sharedKey(key)
+	if err != nil {
+		return false, err
+	}
+	defer C.free(unsafe.Pointer(ckey))
+	return C.plgo_shared_delete(a.m, ckey) == (C._Bool)(true), nil
+}
+
+//Keys returns all keys stored in the area
+func (a *SharedArea) Keys() []string {
+	var count C.int
+	ckeys := C.plgo_shared_keys(a.m, &count)
+	keys := make([]string, int(count))
+	for i := range keys {
+		ckey := C.plgo_shared_key_at(ckeys, C.int(i))
+		keys[i] = C.GoString(ckey)
+		C.pfree(unsafe.Pointer(ckey))
+	}
+	C.pfree(unsafe.Pointer(ckeys))
+	return keys
+}
+
+//SharedMap is a typed view of a SharedArea, values are stored JSON encoded
+type SharedMap[V any] struct {
+	area *SharedArea
+}
+
+//NewSharedMap attaches to the named shared area and returns it as a typed map
+func NewSharedMap[V any](name string) (*SharedMap[V], error) {
+	area, err := AttachSharedArea(name)
+	if err != nil {
+		return nil, err
+	}
+	return &SharedMap[V]{area: area}, nil
+}
+
+//Area returns the underlying SharedArea
+func (m *SharedMap[V]) Area() *SharedArea {
+	return m.area
+}
+
+//Load returns the value stored under the key
+func (m *SharedMap[V]) Load(key string) (V, bool, error) {
+	var v V
+	data, ok, err := m.area.Get(key)
+	if err != nil || !ok {
+		return v, ok, err
+	}
+	return v, true, json.Unmarshal(data, &v)
+}
+
+//Store stores the value under the key
+func (m *SharedMap[V]) Store(key string, v V) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return m.area.Set(key, data)
+}
+
+//Update atomically replaces the value under the key with the result of fn,
+//ok is false if there was no value stored
+func (m *SharedMap[V]) Update(key string, fn func(v V, ok bool) V) (V, error) {
+	var ret V
+	var fnErr error
+	err := m.area.Update(key, func(old []byte, ok bool) []byte {
+		var v V
+		if ok {
+			if fnErr = json.Unmarshal(old, &v); fnErr != nil {
+				return old
+			}
+		}
+		ret = fn(v, ok)
+		var data []byte
+		if data, fnErr = json.Marshal(ret); fnErr != nil {
+			return old
+		}
+		return data
+	})
+	if err != nil {
+		return ret, err
+	}
+	return ret, fnErr
+}
+
+//Delete removes the key from the map
+func (m *SharedMap[V]) Delete(key string) (bool, error) {
+	return m.area.Delete(key)
+}
+
+//Keys returns all keys in the map
+func (m *SharedMap[V]) Keys() []string {
+	return m.area.Keys()
+}
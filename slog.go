@@ -0,0 +1,86 @@
+//go:build go1.21
+
+package plgo
+
+import (
+	"context"
+	"log/slog"
+)
+
+//slogHandler is the slog.Handler writing the records with the structured Logger
+type slogHandler struct {
+	level  slog.Leveler
+	logger *Logger
+	//prefix is the prefix of the keys in the open groups, e.g. "request."
+	prefix string
+}
+
+//NewSlogHandler returns an slog.Handler writing the records of the level and above into the PostgreSQL log as Log does,
+//e.g. slog.SetDefault(slog.New(plgo.NewSlogHandler(slog.LevelInfo))). The debug records are DEBUG1, the info records LOG
+//and the warnings WARNING, the error records are WARNING too, an ERROR would abort the transaction.
+//The records must be logged by the goroutine of the exported function, as the other PostgreSQL calls
+func NewSlogHandler(level slog.Leveler) slog.Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &slogHandler{level: level, logger: Log}
+}
+
+//slogLevel returns the elog level of the slog level
+func slogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelLog
+	default:
+		return LevelWarning
+	}
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && slogLevel(level).Enabled()
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	keyvals := make([]interface{}, 0, 2*r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		keyvals = appendAttr(keyvals, h.prefix, a)
+		return true
+	})
+	h.logger.write(slogLevel(r.Level), r.Message, keyvals)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var keyvals []interface{}
+	for _, a := range attrs {
+		keyvals = appendAttr(keyvals, h.prefix, a)
+	}
+	return &slogHandler{level: h.level, logger: h.logger.With(keyvals...), prefix: h.prefix}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{level: h.level, logger: h.logger, prefix: h.prefix + name + "."}
+}
+
+//appendAttr appends the key/value pair of the attribute, the groups are flattened into the keys group.key
+func appendAttr(keyvals []interface{}, prefix string, a slog.Attr) []interface{} {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return keyvals
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, member := range a.Value.Group() {
+			keyvals = appendAttr(keyvals, prefix, member)
+		}
+		return keyvals
+	}
+	return append(keyvals, prefix+a.Key, a.Value.Any())
+}
@@ -0,0 +1,185 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "funcapi.h"
+#include "miscadmin.h"
+#include "access/tupdesc.h"
+#include "utils/tuplestore.h"
+
+int plgo_srf_begin(FunctionCallInfo fcinfo) {
+	ReturnSetInfo *rsinfo = (ReturnSetInfo *) fcinfo->resultinfo;
+	MemoryContext oldcontext;
+	TupleDesc tupdesc;
+	Oid resulttype;
+
+	if (rsinfo == NULL || !IsA(rsinfo, ReturnSetInfo))
+		ereport(ERROR, (errcode(ERRCODE_FEATURE_NOT_SUPPORTED),
+						errmsg("set-valued function called in context that cannot accept a set")));
+	if (!(rsinfo->allowedModes & SFRM_Materialize))
+		ereport(ERROR, (errcode(ERRCODE_FEATURE_NOT_SUPPORTED),
+						errmsg("materialize mode required, but it is not allowed in this context")));
+	oldcontext = MemoryContextSwitchTo(rsinfo->econtext->ecxt_per_query_memory);
+	switch (get_call_result_type(fcinfo, &resulttype, &tupdesc)) {
+	case TYPEFUNC_COMPOSITE:
+		tupdesc = CreateTupleDescCopy(tupdesc);
+		break;
+	case TYPEFUNC_SCALAR:
+#if PG_VERSION_NUM >= 120000
+		tupdesc = CreateTemplateTupleDesc(1);
+#else
+		tupdesc = CreateTemplateTupleDesc(1, false);
+#endif
+		TupleDescInitEntry(tupdesc, (AttrNumber) 1, "value", resulttype, -1, 0);
+		break;
+	default:
+		ereport(ERROR, (errcode(ERRCODE_FEATURE_NOT_SUPPORTED),
+						errmsg("return type of the set returning function is not supported")));
+	}
+	rsinfo->returnMode = SFRM_Materialize;
+	rsinfo->setResult = tuplestore_begin_heap(rsinfo->allowedModes & SFRM_Materialize_Random, false, work_mem);
+	rsinfo->setDesc = tupdesc;
+	MemoryContextSwitchTo(oldcontext);
+	return tupdesc->natts;
+}
+
+void plgo_srf_put(FunctionCallInfo fcinfo, Datum *values, bool *nulls) {
+	ReturnSetInfo *rsinfo = (ReturnSetInfo *) fcinfo->resultinfo;
+	tuplestore_putvalues(rsinfo->setResult, rsinfo->setDesc, values, nulls);
+}
+*/
+import "C"
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+	"unsafe"
+)
+
+//setColumns returns the indexes of the struct fields that are the columns of the rows:
+//the exported fields without the `plgo:"-"` tag, in the order of the RETURNS TABLE columns
+func setColumns(t reflect.Type) []int {
+	var columns []int
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Anonymous || field.Tag.Get("plgo") == "-" {
+			continue
+		}
+		columns = append(columns, i)
+	}
+	return columns
+}
+
+//setWriter writes the rows of an set returning function into its tuplestore
+type setWriter struct {
+	fcinfo  *C.struct_FunctionCallInfoBaseData
+	columns []int
+	values  []C.Datum
+	nulls   []C.bool
+}
+
+//put writes the row, an struct for RETURNS TABLE or an scalar value for RETURNS SETOF
+func (s *setWriter) put(row reflect.Value) {
+	var values []reflect.Value
+	if row.Kind() == reflect.Struct {
+		if s.columns == nil {
+			s.columns = setColumns(row.Type())
+		}
+		for _, i := range s.columns {
+			values = append(values, row.Field(i))
+		}
+	} else {
+		values = []reflect.Value{row}
+	}
+	if len(values) != len(s.values) {
+		Log.Error(fmt.Sprintf("Set returning function returned %d columns, but the result has %d", len(values), len(s.values)))
+	}
+	for i, value := range values {
+		//the pointer fields are nullable
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				s.values[i], s.nulls[i] = 0, (C._Bool)(true)
+				continue
+			}
+			value = value.Elem()
+		}
+		s.values[i], s.nulls[i] = (C.Datum)(toDatum(value.Interface())), (C._Bool)(false)
+	}
+	C.plgo_srf_put(s.fcinfo, &s.values[0], &s.nulls[0])
+}
+
+//setContexts are the contexts passed to the running set returning functions, by the subtransaction of their call
+var setContexts = make(map[*interruptWatcher]uint32)
+
+//setContext returns the context passed to an set returning function as its first parameter, its sending goroutine stops
+//when it's done: the context is canceled when the rows are returned, by an cancel of the query
+//or when the (sub)transaction of the call is aborted
+func setContext() (context.Context, *interruptWatcher) {
+	ctx, watcher := watchInterrupts(context.Background())
+	setContexts[watcher] = currentSubTransactionID()
+	return ctx, watcher
+}
+
+//stopSetContext cancels the context of the set returning function
+func stopSetContext(watcher *interruptWatcher) {
+	watcher.stop()
+	delete(setContexts, watcher)
+}
+
+func init() {
+	//an ERROR jumps out of returnSet without stopping the context
+	onAbort(func(subID uint32) {
+		for watcher, watcherSubID := range setContexts {
+			if subID == 0 || watcherSubID >= subID {
+				stopSetContext(watcher)
+			}
+		}
+	})
+}
+
+//returnSet materializes the rows returned by an set returning function into its result,
+//rows is an slice or an channel of structs (RETURNS TABLE) or of scalar values (RETURNS SETOF).
+//The channel is read until it is closed, an cancel of the query stops the reading.
+//watcher is the context of the function from setContext, or nil, it is canceled on return
+func returnSet(fcinfo *funcInfo, rows interface{}, watcher *interruptWatcher) Datum {
+	if watcher != nil {
+		defer stopSetContext(watcher)
+	}
+	cfcinfo := (*C.struct_FunctionCallInfoBaseData)(unsafe.Pointer(fcinfo))
+	natts := int(C.plgo_srf_begin(cfcinfo))
+	writer := &setWriter{fcinfo: cfcinfo, values: make([]C.Datum, natts), nulls: make([]C.bool, natts)}
+	value := reflect.ValueOf(rows)
+	switch value.Kind() {
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			writer.put(value.Index(i))
+		}
+	case reflect.Chan:
+		if value.IsNil() {
+			break
+		}
+		ticker := time.NewTicker(interruptPollInterval)
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: value},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ticker.C)},
+		}
+		for {
+			chosen, row, ok := reflect.Select(cases)
+			if chosen == 1 {
+				if interruptPending() {
+					ticker.Stop()
+					Log.Error(ErrInterrupted.Error())
+				}
+				continue
+			}
+			if !ok {
+				break
+			}
+			writer.put(row)
+		}
+		ticker.Stop()
+	}
+	return toDatum(nil)
+}
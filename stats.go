@@ -0,0 +1,202 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+*/
+import "C"
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+//statBuckets are the upper bounds (in milliseconds) of the latency histogram buckets,
+//the last bucket is unbounded
+var statBuckets = [...]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, math.Inf(1)}
+
+//funcStat are the statistics of one exported function collected from all backends
+type funcStat struct {
+	Calls   int64                   `json:"c"`
+	Errors  int64                   `json:"e"`
+	TotalMs float64                 `json:"t"`
+	MinMs   float64                 `json:"min"`
+	MaxMs   float64                 `json:"max"`
+	Buckets [len(statBuckets)]int64 `json:"b"`
+}
+
+func (s *funcStat) add(ms float64, failed bool) {
+	if s.Calls == 0 || ms < s.MinMs {
+		s.MinMs = ms
+	}
+	if ms > s.MaxMs {
+		s.MaxMs = ms
+	}
+	s.Calls++
+	if failed {
+		s.Errors++
+	}
+	s.TotalMs += ms
+	for i, bound := range statBuckets {
+		if ms <= bound {
+			s.Buckets[i]++
+			break
+		}
+	}
+}
+
+//merge adds the statistics collected by the backend
+func (s *funcStat) merge(local *funcStat) {
+	if s.Calls == 0 || local.MinMs < s.MinMs {
+		s.MinMs = local.MinMs
+	}
+	if local.MaxMs > s.MaxMs {
+		s.MaxMs = local.MaxMs
+	}
+	s.Calls += local.Calls
+	s.Errors += local.Errors
+	s.TotalMs += local.TotalMs
+	for i, count := range local.Buckets {
+		s.Buckets[i] += count
+	}
+}
+
+//percentile returns the upper bound of the histogram bucket containing the q quantile
+func (s *funcStat) percentile(q float64) float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(s.Calls)))
+	var cumulative int64
+	for i, count := range s.Buckets {
+		cumulative += count
+		if cumulative >= rank {
+			if math.IsInf(statBuckets[i], 1) {
+				return s.MaxMs
+			}
+			return math.Min(statBuckets[i], s.MaxMs)
+		}
+	}
+	return s.MaxMs
+}
+
+//funcStatRow is one row of the <extension>_stat_functions view
+type funcStatRow struct {
+	Function  string  `json:"funcname"`
+	Calls     int64   `json:"calls"`
+	Errors    int64   `json:"errors"`
+	TotalTime float64 `json:"total_time"`
+	MeanTime  float64 `json:"mean_time"`
+	MinTime   float64 `json:"min_time"`
+	MaxTime   float64 `json:"max_time"`
+	P50Time   float64 `json:"p50_time"`
+	P95Time   float64 `json:"p95_time"`
+	P99Time   float64 `json:"p99_time"`
+}
+
+//pendingErrors are the calls aborted by an ERROR, they are recorded with the next call,
+//because the shared memory can't be safely used while the transaction is aborting
+var pendingErrors []*funcCall
+
+//statFlushInterval is how often the statistics collected by the backend are added to the shared ones
+const statFlushInterval = time.Second
+
+//localStats are the statistics of the backend not yet added to the shared ones
+var localStats = make(map[string]*funcStat)
+
+var lastStatFlush time.Time
+
+//statsMap returns the shared statistics of the extension
+func statsMap() (*SharedMap[funcStat], error) {
+	return NewSharedMap[funcStat](extensionName + " stats")
+}
+
+//recordStat adds the call to the statistics of the backend, they are added to the shared statistics
+//at most once per statFlushInterval, so the calls don't lock the shared entries
+func recordStat(call *funcCall, duration time.Duration, failed bool) {
+	s, ok := localStats[call.name]
+	if !ok {
+		s = &funcStat{}
+		localStats[call.name] = s
+	}
+	s.add(float64(duration)/float64(time.Millisecond), failed)
+	if time.Since(lastStatFlush) >= statFlushInterval {
+		flushStats()
+	}
+}
+
+//flushStats adds the statistics of the backend to the shared statistics
+func flushStats() {
+	lastStatFlush = time.Now()
+	if len(localStats) == 0 {
+		return
+	}
+	stats, err := statsMap()
+	if err != nil {
+		return
+	}
+	for name, local := range localStats {
+		stats.Update(name, func(s funcStat, ok bool) funcStat {
+			s.merge(local)
+			return s
+		})
+	}
+	localStats = make(map[string]*funcStat)
+}
+
+//flushPendingErrors records the calls aborted by an ERROR
+func flushPendingErrors() {
+	errors := pendingErrors
+	pendingErrors = nil
+	for _, call := range errors {
+		recordStat(call, call.aborted.Sub(call.start), true)
+	}
+}
+
+func statRows() []funcStatRow {
+	flushStats()
+	stats, err := statsMap()
+	if err != nil {
+		return nil
+	}
+	rows := []funcStatRow{}
+	for _, name := range stats.Keys() {
+		s, ok, err := stats.Load(name)
+		if err != nil || !ok {
+			continue
+		}
+		row := funcStatRow{
+			Function:  name,
+			Calls:     s.Calls,
+			Errors:    s.Errors,
+			TotalTime: s.TotalMs,
+			MinTime:   s.MinMs,
+			MaxTime:   s.MaxMs,
+			P50Time:   s.percentile(0.50),
+			P95Time:   s.percentile(0.95),
+			P99Time:   s.percentile(0.99),
+		}
+		if s.Calls > 0 {
+			row.MeanTime = s.TotalMs / float64(s.Calls)
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Function < rows[j].Function })
+	return rows
+}
+
+//export plgo_stat_functions
+func plgo_stat_functions(fcinfo *funcInfo) Datum {
+	return jsonbDatum(statRows())
+}
+
+//export plgo_stat_reset
+func plgo_stat_reset(fcinfo *funcInfo) Datum {
+	localStats = make(map[string]*funcStat)
+	if stats, err := statsMap(); err == nil {
+		for _, name := range stats.Keys() {
+			stats.Delete(name)
+		}
+	}
+	return toDatum(nil)
+}
@@ -0,0 +1,255 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "access/xact.h"
+#include "executor/spi.h"
+#include "utils/elog.h"
+#include "utils/memutils.h"
+#include "utils/resowner.h"
+
+MemoryContext plgo_current_memory_context(void) {
+	return CurrentMemoryContext;
+}
+
+ResourceOwner plgo_current_resource_owner(void) {
+	return CurrentResourceOwner;
+}
+
+//plgo_subtx_begin starts an subtransaction, the memory context is kept
+void plgo_subtx_begin(void) {
+	MemoryContext oldcontext = CurrentMemoryContext;
+
+	BeginInternalSubTransaction(NULL);
+	MemoryContextSwitchTo(oldcontext);
+}
+
+//plgo_subtx_end releases or rolls back the subtransaction, the memory context and the resource owner
+//of the code that started it are restored
+void plgo_subtx_end(bool release, MemoryContext oldcontext, ResourceOwner oldowner) {
+	if (release)
+		ReleaseCurrentSubTransaction();
+	else
+		RollbackAndReleaseCurrentSubTransaction();
+	MemoryContextSwitchTo(oldcontext);
+	CurrentResourceOwner = oldowner;
+}
+
+//plgo_catch copies the caught ERROR into edata, the canceled query is thrown again
+static void plgo_catch(MemoryContext oldcontext, ErrorData **edata) {
+	ErrorData *copy;
+
+	MemoryContextSwitchTo(oldcontext);
+	copy = CopyErrorData();
+	if (copy->sqlerrcode == ERRCODE_QUERY_CANCELED)
+	{
+		FreeErrorData(copy);
+		PG_RE_THROW();
+	}
+	FlushErrorState();
+	*edata = copy;
+}
+
+//plgo_execute_plan_catch executes the plan as SPI_execute_plan, its ERROR is caught and copied into edata,
+//the canceled query is not caught
+int plgo_execute_plan_catch(SPIPlanPtr plan, Datum *values, const char *nulls, long count, ErrorData **edata) {
+	MemoryContext oldcontext = CurrentMemoryContext;
+	volatile int ret = 0;
+
+	*edata = NULL;
+	PG_TRY();
+	{
+		ret = SPI_execute_plan(plan, values, nulls, false, count);
+	}
+	PG_CATCH();
+	{
+		plgo_catch(oldcontext, edata);
+	}
+	PG_END_TRY();
+	return ret;
+}
+
+//plgo_prepare_catch prepares the query as SPI_prepare, its ERROR (e.g. a syntax error) is caught and copied into edata
+SPIPlanPtr plgo_prepare_catch(const char *src, int nargs, Oid *argtypes, ErrorData **edata) {
+	MemoryContext oldcontext = CurrentMemoryContext;
+	volatile SPIPlanPtr ret = NULL;
+
+	*edata = NULL;
+	PG_TRY();
+	{
+		ret = SPI_prepare(src, nargs, argtypes);
+	}
+	PG_CATCH();
+	{
+		plgo_catch(oldcontext, edata);
+	}
+	PG_END_TRY();
+	return ret;
+}
+
+//plgo_cursor_open_catch opens the cursor of the plan as SPI_cursor_open, its ERROR is caught and copied into edata
+Portal plgo_cursor_open_catch(SPIPlanPtr plan, Datum *values, const char *nulls, ErrorData **edata) {
+	MemoryContext oldcontext = CurrentMemoryContext;
+	volatile Portal ret = NULL;
+
+	*edata = NULL;
+	PG_TRY();
+	{
+		ret = SPI_cursor_open(NULL, plan, values, nulls, false);
+	}
+	PG_CATCH();
+	{
+		plgo_catch(oldcontext, edata);
+	}
+	PG_END_TRY();
+	return ret;
+}
+
+const char *plgo_error_sqlstate(ErrorData *edata) {
+	return unpack_sql_state(edata->sqlerrcode);
+}
+*/
+import "C"
+import "errors"
+
+//SubTx is an subtransaction of the DB, the ERROR of an statement executed in it (Stmt.Exec, Query and QueryRow)
+//rolls back only the subtransaction and it is returned as an *Error, e.g. to recover from an unique_violation
+//as BEGIN ... EXCEPTION in PL/pgSQL. The subtransactions are nested, only the innermost can be released or rolled back
+type SubTx struct {
+	db     *DB
+	parent *SubTx
+	//oldContext and oldOwner are the memory context and the resource owner of the code that started the subtransaction
+	oldContext C.MemoryContext
+	oldOwner   C.ResourceOwner
+	done       bool
+}
+
+//errSubTxDone is returned by the SubTx released or rolled back
+var errSubTxDone = errors.New("The subtransaction was already released or rolled back")
+
+//BeginSubTx starts an subtransaction, it must be released or rolled back before the DB is closed
+func (db *DB) BeginSubTx() (*SubTx, error) {
+	tx := &SubTx{db: db, parent: db.subTx, oldContext: C.plgo_current_memory_context(), oldOwner: C.plgo_current_resource_owner()}
+	C.plgo_subtx_begin()
+	db.subTx = tx
+	return tx, nil
+}
+
+//Release commits the subtransaction into the enclosing transaction
+func (tx *SubTx) Release() error {
+	return tx.end(true)
+}
+
+//Rollback rolls back the subtransaction, the changes done in it are discarded and its Rows can't be used
+func (tx *SubTx) Rollback() error {
+	return tx.end(false)
+}
+
+func (tx *SubTx) end(release bool) error {
+	if tx.done {
+		return errSubTxDone
+	}
+	if tx.db.subTx != tx {
+		return errors.New("The subtransaction is not the innermost, release or rollback the nested subtransactions first")
+	}
+	C.plgo_subtx_end((C._Bool)(release), tx.oldContext, tx.oldOwner)
+	tx.done = true
+	tx.db.subTx = tx.parent
+	return nil
+}
+
+//SubTransaction runs fn in an subtransaction, it is released if fn returns nil, otherwise rolled back.
+//The error of fn is returned, the failed statement returns an *Error
+//
+//	err := db.SubTransaction(func() error {
+//		return insert.Exec(email)
+//	})
+//	var pgErr *plgo.Error
+//	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+//		//the email is already registered
+//	}
+func (db *DB) SubTransaction(fn func() error) error {
+	tx, err := db.BeginSubTx()
+	if err != nil {
+		return err
+	}
+	if err = fn(); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != errSubTxDone {
+			return rollbackErr
+		}
+		return err
+	}
+	return tx.Release()
+}
+
+//executePlan executes the plan of the Stmt, the ERROR in an subtransaction rolls it back and it's returned as an *Error
+func (stmt *Stmt) executePlan(valuesP *C.Datum, nullsP *C.char, count C.long) (C.int, error) {
+	tx := stmt.db.subTx
+	if tx == nil {
+		return C.SPI_execute_plan(stmt.spiPlan, valuesP, nullsP, (C._Bool)(false), count), nil
+	}
+	var edata *C.ErrorData
+	rv := C.plgo_execute_plan_catch(stmt.spiPlan, valuesP, nullsP, count, &edata)
+	if edata == nil {
+		return rv, nil
+	}
+	return rv, tx.caught(edata)
+}
+
+//prepare prepares the query, the ERROR in an subtransaction rolls it back and it's returned as an *Error
+func (db *DB) prepare(query *C.char, nargs C.int, typeIds *C.Oid) (C.SPIPlanPtr, error) {
+	tx := db.subTx
+	if tx == nil {
+		return C.SPI_prepare(query, nargs, typeIds), nil
+	}
+	var edata *C.ErrorData
+	plan := C.plgo_prepare_catch(query, nargs, typeIds, &edata)
+	if edata == nil {
+		return plan, nil
+	}
+	return nil, tx.caught(edata)
+}
+
+//cursorOpen opens the cursor of the plan of the Stmt, the ERROR in an subtransaction rolls it back
+//and it's returned as an *Error
+func (stmt *Stmt) cursorOpen(valuesP *C.Datum, nullsP *C.char) (C.Portal, error) {
+	tx := stmt.db.subTx
+	if tx == nil {
+		return C.SPI_cursor_open(nil, stmt.spiPlan, valuesP, nullsP, (C._Bool)(false)), nil
+	}
+	var edata *C.ErrorData
+	portal := C.plgo_cursor_open_catch(stmt.spiPlan, valuesP, nullsP, &edata)
+	if edata == nil {
+		return portal, nil
+	}
+	return nil, tx.caught(edata)
+}
+
+//caught returns the caught ERROR as an *Error and rolls back the failed subtransaction, it can't continue
+func (tx *SubTx) caught(edata *C.ErrorData) error {
+	err := errorFromData(edata)
+	C.FreeErrorData(edata)
+	tx.Rollback()
+	return err
+}
+
+//errorFromData returns the *Error of the caught ERROR
+func errorFromData(edata *C.ErrorData) *Error {
+	gostring := func(s *C.char) string {
+		if s == nil {
+			return ""
+		}
+		return C.GoString(s)
+	}
+	return &Error{
+		Code:       C.GoString(C.plgo_error_sqlstate(edata)),
+		Message:    gostring(edata.message),
+		Detail:     gostring(edata.detail),
+		Hint:       gostring(edata.hint),
+		Schema:     gostring(edata.schema_name),
+		Table:      gostring(edata.table_name),
+		Column:     gostring(edata.column_name),
+		Datatype:   gostring(edata.datatype_name),
+		Constraint: gostring(edata.constraint_name),
+	}
+}
@@ -29,6 +29,7 @@ func PLGoTest() {
 	testJSON(plgo.NewNoticeLogger("testJSON", log.Ltime|log.Lshortfile))
 	//testGoroutines(plgo.NewNoticeLogger("testGoroutines", log.Ltime|log.Lshortfile))
 	testFunctionByteaOutput(plgo.NewNoticeLogger("testFunctionByteaOutput", log.Ltime|log.Lshortfile))
+	testSharedArea(plgo.NewNoticeLogger("testSharedArea", log.Ltime|log.Lshortfile))
 }
 
 func testConnection(t *log.Logger) {
@@ -720,6 +721,42 @@ func testFunctionByteaOutput(t *log.Logger) {
 	}
 }
 
+func testSharedArea(t *log.Logger) {
+	area, err := plgo.AttachSharedArea("plgotest")
+	if err != nil {
+		t.Fatal("attach", err)
+	}
+	area.Delete("counter")
+	for i := 0; i < 3; i++ {
+		if _, err = area.Add("counter", 2); err != nil {
+			t.Fatal("add", err)
+		}
+	}
+	if c, _ := area.Counter("counter"); c != 6 {
+		t.Print("counter not equal ", c, "!=", 6)
+	}
+	m, err := plgo.NewSharedMap[exampleStruct]("plgotest")
+	if err != nil {
+		t.Fatal("shared map", err)
+	}
+	if err = m.Store("example", exampleStruct{1, "foo"}); err != nil {
+		t.Fatal("store", err)
+	}
+	v, err := m.Update("example", func(v exampleStruct, ok bool) exampleStruct {
+		v.Val1++
+		return v
+	})
+	if err != nil {
+		t.Fatal("update", err)
+	}
+	if v.Val1 != 2 || v.Val2 != "foo" {
+		t.Print("shared value not equal ", v)
+	}
+	if ok, _ := m.Delete("example"); !ok {
+		t.Print("shared value not deleted")
+	}
+}
+
 func ReverseBytea(v []byte) []byte {
 	ret := make([]byte, len(v))
 	for i, b := range v {
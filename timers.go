@@ -0,0 +1,211 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "miscadmin.h"
+#include "storage/latch.h"
+#include "utils/timeout.h"
+#include "utils/timestamp.h"
+#include <signal.h>
+
+//the timers and the deadlines share one timeout, PostgreSQL allows only a few timeouts registered by extensions
+static TimeoutId plgo_timeout_id;
+static bool plgo_timeout_registered;
+//plgo_timer_at is the expiration of the next timer, plgo_deadline_at of the earliest deadline, 0 if not armed
+static volatile TimestampTz plgo_timer_at;
+static volatile TimestampTz plgo_deadline_at;
+static volatile sig_atomic_t plgo_timer_fired;
+
+//plgo_timeout_schedule arms the timeout for the earlier of the next timer and the deadline
+static void plgo_timeout_schedule(void) {
+	TimestampTz at = plgo_timer_at;
+	if (at == 0 || (plgo_deadline_at != 0 && plgo_deadline_at < at))
+		at = plgo_deadline_at;
+	if (at != 0)
+		enable_timeout_at(plgo_timeout_id, at);
+	else
+		disable_timeout(plgo_timeout_id, false);
+}
+
+//the timeout handler runs in the SIGALRM handler, it only marks the expired timer and wakes up the backend.
+//The expired deadline cancels the query the same way as statement_timeout, then the timeout is armed again for the rest
+static void plgo_timeout_handler(void) {
+	TimestampTz now = GetCurrentTimestamp();
+	if (plgo_timer_at != 0 && plgo_timer_at <= now) {
+		plgo_timer_at = 0;
+		plgo_timer_fired = 1;
+		SetLatch(MyLatch);
+	}
+	if (plgo_deadline_at != 0 && plgo_deadline_at <= now) {
+		plgo_deadline_at = 0;
+		kill(MyProcPid, SIGINT);
+	}
+	plgo_timeout_schedule();
+}
+
+//plgo_timeout_set arms the timeout for the next timer and the deadline after the milliseconds, -1 disarms them
+void plgo_timeout_set(int64 timer_ms, int64 deadline_ms) {
+	TimestampTz now;
+	if (!plgo_timeout_registered) {
+		if (timer_ms < 0 && deadline_ms < 0)
+			return;
+		plgo_timeout_id = RegisterTimeout(USER_TIMEOUT, plgo_timeout_handler);
+		plgo_timeout_registered = true;
+	}
+	//the handler doesn't run while the timeout is disabled
+	disable_timeout(plgo_timeout_id, false);
+	now = GetCurrentTimestamp();
+	plgo_timer_at = timer_ms < 0 ? 0 : TimestampTzPlusMilliseconds(now, timer_ms);
+	plgo_deadline_at = deadline_ms < 0 ? 0 : TimestampTzPlusMilliseconds(now, deadline_ms);
+	plgo_timeout_schedule();
+}
+
+int plgo_timer_take_fired(void) {
+	int fired = plgo_timer_fired;
+	plgo_timer_fired = 0;
+	return fired;
+}
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//Timer is an timer of the backend. The timers and the deadlines are multiplexed on one backend timeout (RegisterTimeout),
+//it fires in the signal handler of the backend, which only marks the expired timer. The callback runs on the backend thread
+//from CheckTimers, which is also called before every call of an exported function and every SPI query
+type Timer struct {
+	at       time.Time
+	interval time.Duration
+	periodic bool
+	fn       func()
+}
+
+//timers are the armed timers
+var timers []*Timer
+
+//AfterFunc arms an timer that calls fn once after d
+func AfterFunc(d time.Duration, fn func()) (*Timer, error) {
+	return armTimer(&Timer{interval: d, fn: fn}), nil
+}
+
+//Every arms an timer that calls fn every interval until it is stopped
+func Every(interval time.Duration, fn func()) (*Timer, error) {
+	return armTimer(&Timer{interval: interval, periodic: true, fn: fn}), nil
+}
+
+func armTimer(t *Timer) *Timer {
+	t.at = time.Now().Add(t.interval)
+	timers = append(timers, t)
+	scheduleTimeout()
+	return t
+}
+
+//Stop disarms the timer, the callback is not called anymore
+func (t *Timer) Stop() {
+	for i, armed := range timers {
+		if armed == t {
+			timers = append(timers[:i], timers[i+1:]...)
+			scheduleTimeout()
+			return
+		}
+	}
+}
+
+//CheckTimers runs the callbacks of the expired timers, the periodic timers are armed again
+func CheckTimers() {
+	if C.plgo_timer_take_fired() == 0 {
+		return
+	}
+	now := time.Now()
+	var expired, armed []*Timer
+	for _, t := range timers {
+		if t.at.After(now) {
+			armed = append(armed, t)
+			continue
+		}
+		expired = append(expired, t)
+		if t.periodic {
+			t.at = now.Add(t.interval)
+			armed = append(armed, t)
+		}
+	}
+	timers = armed
+	scheduleTimeout()
+	for _, t := range expired {
+		t.run()
+	}
+}
+
+//scheduleTimeout arms the timeout of the backend for the next timer and the earliest deadline of the running calls
+func scheduleTimeout() {
+	now := time.Now()
+	timer, deadline := C.int64(-1), C.int64(-1)
+	for _, t := range timers {
+		if ms := timeoutMs(t.at.Sub(now)); timer < 0 || ms < timer {
+			timer = ms
+		}
+	}
+	for _, call := range callStack {
+		if call.deadline.IsZero() {
+			continue
+		}
+		if ms := timeoutMs(call.deadline.Sub(now)); deadline < 0 || ms < deadline {
+			deadline = ms
+		}
+	}
+	C.plgo_timeout_set(timer, deadline)
+}
+
+//run calls the callback, its panic is logged, because CheckTimers runs also outside of the recovered function body
+func (t *Timer) run() {
+	defer func() {
+		if r := recover(); r != nil {
+			Log.Warning("panic in timer callback", "panic", fmt.Sprint(r))
+		}
+	}()
+	t.fn()
+}
+
+func timeoutMs(d time.Duration) C.int64 {
+	ms := d.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return C.int64(ms)
+}
+
+//SetDeadline arms an deadline for the running exported function call. When it expires, the call is canceled
+//the same way as by statement_timeout or pg_cancel_backend (the SPI queries and HTTPClient requests are interrupted,
+//the error is "canceling statement due to user request"). The deadline is disarmed when the call ends.
+//The nested calls have their own deadlines, the earliest of the running calls cancels the query
+func SetDeadline(d time.Duration) error {
+	call := currentCall()
+	if call == nil {
+		return errors.New("plgo: SetDeadline called outside of an function call")
+	}
+	call.deadline = time.Now().Add(d)
+	scheduleTimeout()
+	return nil
+}
+
+//endDeadline disarms the deadline of the finished call, the deadlines of the outer calls stay armed
+func (call *funcCall) endDeadline() {
+	if !call.deadline.IsZero() {
+		call.deadline = time.Time{}
+		scheduleTimeout()
+	}
+}
+
+func init() {
+	//the aborted calls are already dropped from the stack (calls.go registers its handler first),
+	//so their deadlines are disarmed
+	onAbort(func(subID uint32) {
+		if subID == 0 {
+			timers = nil
+		}
+		scheduleTimeout()
+	})
+}
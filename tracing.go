@@ -0,0 +1,313 @@
+package plgo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//TracingConfig configures the export of the traces of exported function calls
+type TracingConfig struct {
+	//Endpoint is the OTLP/HTTP collector address, e.g. http://localhost:4318
+	Endpoint string
+	//ServiceName is the service.name resource attribute, the extension name by default
+	ServiceName string
+	//Headers are added to every export request (e.g. authorization)
+	Headers map[string]string
+	//Interval is the export interval of the background worker, 5s by default
+	Interval time.Duration
+	//MaxQueued is the maximum number of traces waiting for the export, 10000 by default
+	MaxQueued int64
+}
+
+//tracingWorkerName is the name of the background worker exporting the spans
+const tracingWorkerName = "otlp exporter"
+
+//tracingArea is the shared area where the backends queue the finished traces for the exporter worker
+const tracingArea = "plgo_traces"
+
+var tracing *TracingConfig
+
+//EnableTracing turns on the tracing of the exported function calls and SPI queries.
+//Every call of an exported function opens a span, the SPI queries are its child spans.
+//The spans are exported via OTLP/HTTP (JSON) by a background worker,
+//so the extension must be loaded with shared_preload_libraries.
+//It must be called from an init() function of the package
+func EnableTracing(config TracingConfig) {
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Second
+	}
+	if config.MaxQueued <= 0 {
+		config.MaxQueued = 10000
+	}
+	tracing = &config
+	registerWorker(&worker{name: tracingWorkerName, restart: 10 * time.Second, main: exportTraces})
+}
+
+//span is an OTLP span
+type span struct {
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	name       string
+	kind       int
+	start, end time.Time
+	attributes map[string]interface{}
+	err        error
+	subID      uint32
+	//children are the finished child spans, the root span collects all spans of the trace
+	children []*span
+	parent   *span
+}
+
+//span kinds
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+//spanStack holds the open spans of the running calls
+var spanStack []*span
+
+func newSpan(name string, kind int, attributes map[string]interface{}) *span {
+	s := &span{name: name, kind: kind, start: time.Now(), attributes: attributes, subID: currentSubTransactionID()}
+	rand.Read(s.spanID[:])
+	if len(spanStack) > 0 {
+		s.parent = spanStack[len(spanStack)-1]
+		s.traceID = s.parent.traceID
+		s.parentID = s.parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	spanStack = append(spanStack, s)
+	return s
+}
+
+//startCallSpan opens the span of an exported function call, returns nil if tracing is disabled
+func startCallSpan(name string, nargs int) *span {
+	if tracing == nil {
+		return nil
+	}
+	return newSpan(name, spanKindInternal, map[string]interface{}{
+		"code.function": name,
+		"plgo.args":     nargs,
+	})
+}
+
+//startQuerySpan opens the span of an SPI query, returns nil if tracing is disabled
+func startQuerySpan(query string) *span {
+	if tracing == nil {
+		return nil
+	}
+	return newSpan("SPI query", spanKindClient, map[string]interface{}{
+		"db.system":    "postgresql",
+		"db.statement": query,
+	})
+}
+
+//finish closes the span, the finished trace is queued for the export when the root span is finished
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	for i := len(spanStack) - 1; i >= 0; i-- {
+		if spanStack[i] == s {
+			spanStack = spanStack[:i]
+			break
+		}
+	}
+	if s.parent != nil {
+		s.parent.children = append(s.parent.children, s)
+		s.parent.children = append(s.parent.children, s.children...)
+		s.children = nil
+		return
+	}
+	queueTrace(append([]*span{s}, s.children...))
+}
+
+func init() {
+	//spans interrupted by an ERROR are never finished
+	onAbort(func(subID uint32) {
+		for i, s := range spanStack {
+			if subID == 0 || s.subID >= subID {
+				spanStack = spanStack[:i]
+				return
+			}
+		}
+	})
+}
+
+//otlpSpan is the OTLP JSON encoding of an span
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func otlpAttributes(attributes map[string]interface{}) []otlpAttribute {
+	var ret []otlpAttribute
+	for key, val := range attributes {
+		var value map[string]interface{}
+		switch v := val.(type) {
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		ret = append(ret, otlpAttribute{Key: key, Value: value})
+	}
+	return ret
+}
+
+func (s *span) otlp() otlpSpan {
+	o := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        otlpAttributes(s.attributes),
+	}
+	if s.parent != nil {
+		o.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if s.err != nil {
+		o.Status = otlpStatus{Code: 2, Message: s.err.Error()}
+	}
+	return o
+}
+
+//queueTrace stores the spans of an finished trace into the shared area, where the exporter worker picks them up
+func queueTrace(spans []*span) {
+	area, err := AttachSharedArea(tracingArea)
+	if err != nil {
+		return
+	}
+	if queued, _ := area.Add("queued", 1); queued > tracing.MaxQueued {
+		area.Add("queued", -1)
+		area.Add("dropped", 1)
+		return
+	}
+	encoded := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		encoded[i] = s.otlp()
+	}
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return
+	}
+	id, _ := area.Add("sequence", 1)
+	area.Set("trace:"+strconv.FormatInt(id, 10), data)
+}
+
+//exportTraces is the main function of the exporter background worker
+func exportTraces(ctx *workerContext) error {
+	area, err := AttachSharedArea(tracingArea)
+	if err != nil {
+		return err
+	}
+	serviceName := tracing.ServiceName
+	if serviceName == "" {
+		serviceName = extensionName
+	}
+	//own transport, the default one is blocked in the restricted mode
+	client := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	endpoint := strings.TrimRight(tracing.Endpoint, "/") + "/v1/traces"
+	for ctx.Wait(tracing.Interval) {
+		var spans []json.RawMessage
+		var traces int64
+		for _, key := range area.Keys() {
+			if !strings.HasPrefix(key, "trace:") {
+				continue
+			}
+			data, ok, err := area.Get(key)
+			area.Delete(key)
+			traces++
+			if err != nil || !ok {
+				continue
+			}
+			var traceSpans []json.RawMessage
+			if json.Unmarshal(data, &traceSpans) == nil {
+				spans = append(spans, traceSpans...)
+			}
+		}
+		if traces == 0 {
+			continue
+		}
+		area.Add("queued", -traces)
+		if err := postSpans(client, endpoint, serviceName, spans); err != nil {
+			Log.Log("cannot export traces", "endpoint", endpoint, "error", err)
+		}
+	}
+	return nil
+}
+
+func postSpans(client *http.Client, endpoint, serviceName string, spans []json.RawMessage) error {
+	request := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "plgo"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range tracing.Headers {
+		req.Header.Set(key, val)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "catalog/pg_type.h"
+#include "utils/uuid.h"
+
+Datum plgo_uuid_to_datum(const unsigned char *data) {
+	pg_uuid_t *uuid = palloc(sizeof(pg_uuid_t));
+
+	memcpy(uuid->data, data, UUID_LEN);
+	return UUIDPGetDatum(uuid);
+}
+
+void plgo_datum_to_uuid(Datum val, unsigned char *data) {
+	memcpy(data, DatumGetUUIDP(val)->data, UUID_LEN);
+}
+*/
+import "C"
+import (
+	"encoding/hex"
+	"fmt"
+	"unsafe"
+)
+
+//UUID is the PostgreSQL uuid, it has the layout of github.com/google/uuid UUID,
+//so they are converted with plgo.UUID(id) and uuid.UUID(u)
+type UUID [16]byte
+
+//ParseUUID parses the uuid in the canonical form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx, with or without the hyphens
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	digits := make([]byte, 0, 32)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '-' && (i == 8 || i == 13 || i == 18 || i == 23) && len(s) == 36 {
+			continue
+		}
+		digits = append(digits, s[i])
+	}
+	if len(digits) != 32 {
+		return u, fmt.Errorf("Invalid uuid %q", s)
+	}
+	if _, err := hex.Decode(u[:], digits); err != nil {
+		return u, fmt.Errorf("Invalid uuid %q", s)
+	}
+	return u, nil
+}
+
+//String returns the canonical form of the uuid, xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+func (u UUID) String() string {
+	s := hex.EncodeToString(u[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+//MarshalText returns the canonical form, the uuid fields of the jsonb structs are strings
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+//UnmarshalText parses the uuid
+func (u *UUID) UnmarshalText(text []byte) error {
+	parsed, err := ParseUUID(string(text))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
+
+//uuidDatum returns the uuid datum
+func uuidDatum(u UUID) Datum {
+	return (Datum)(C.plgo_uuid_to_datum((*C.uchar)(unsafe.Pointer(&u[0]))))
+}
+
+//scanUUID sets the uuid from the datum, an error if the type oid isn't uuid
+func scanUUID(oid C.Oid, typeName string, val C.Datum, dest *UUID) error {
+	if oid != C.UUIDOID {
+		return fmt.Errorf("Column type is not uuid %s", typeName)
+	}
+	C.plgo_datum_to_uuid(val, (*C.uchar)(unsafe.Pointer(&dest[0])))
+	return nil
+}
@@ -0,0 +1,137 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "fmgr.h"
+#include "windowapi.h"
+
+bool plgo_called_as_window(FunctionCallInfo fcinfo) {
+	return WindowObjectIsValid(PG_WINDOW_OBJECT());
+}
+
+WindowObject plgo_window_object(FunctionCallInfo fcinfo) {
+	return PG_WINDOW_OBJECT();
+}
+*/
+import "C"
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+//WindowContext is the window of the current row passed to an window function, func(w *plgo.WindowContext, args...) T.
+//The function is created as an WINDOW function and called with an OVER clause, the arguments are numbered
+//from 0 without the WindowContext, the positions are numbered from 0 in the partition or in the frame
+type WindowContext struct {
+	fcinfo *funcInfo
+	winobj C.WindowObject
+}
+
+//WindowContext returns the window of the current row, if the function was called as an window function, else nil
+func (fcinfo *funcInfo) WindowContext() *WindowContext {
+	cfcinfo := (C.FunctionCallInfo)(unsafe.Pointer(fcinfo))
+	if C.plgo_called_as_window(cfcinfo) != (C._Bool)(true) {
+		return nil
+	}
+	return &WindowContext{fcinfo: fcinfo, winobj: C.plgo_window_object(cfcinfo)}
+}
+
+//PartitionRowCount returns the number of rows in the partition of the current row
+func (w *WindowContext) PartitionRowCount() int64 {
+	return int64(C.WinGetPartitionRowCount(w.winobj))
+}
+
+//CurrentPosition returns the position of the current row in the partition
+func (w *WindowContext) CurrentPosition() int64 {
+	return int64(C.WinGetCurrentPosition(w.winobj))
+}
+
+//RowsArePeers reports whether the rows at the positions of the partition are peers in the ORDER BY of the window
+func (w *WindowContext) RowsArePeers(pos1, pos2 int64) bool {
+	return C.WinRowsArePeers(w.winobj, C.int64(pos1), C.int64(pos2)) == (C._Bool)(true)
+}
+
+//SetMarkPosition tells PostgreSQL that the rows before the position of the partition won't be read anymore,
+//so they can be released
+func (w *WindowContext) SetMarkPosition(pos int64) {
+	C.WinSetMarkPosition(w.winobj, C.int64(pos))
+}
+
+//ArgCurrent sets dest to the argument of the current row, as Scan
+func (w *WindowContext) ArgCurrent(argno int, dest interface{}) error {
+	var isnull C.bool
+	datum := C.WinGetFuncArgCurrent(w.winobj, C.int(argno), &isnull)
+	return w.scanArg(argno, datum, isnull == (C._Bool)(true), dest)
+}
+
+//ArgInPartition sets dest to the argument of the row at the position of the partition, as Scan.
+//It returns false if the position is outside of the partition, dest is unchanged
+func (w *WindowContext) ArgInPartition(argno int, pos int64, dest interface{}) (bool, error) {
+	return w.argAt(argno, pos, dest, false)
+}
+
+//ArgInFrame sets dest to the argument of the row at the position of the window frame of the current row, as Scan.
+//It returns false if the position is outside of the frame, dest is unchanged
+func (w *WindowContext) ArgInFrame(argno int, pos int64, dest interface{}) (bool, error) {
+	return w.argAt(argno, pos, dest, true)
+}
+
+//argAt sets dest to the argument of the row at the position from the head of the partition or of the frame
+func (w *WindowContext) argAt(argno int, pos int64, dest interface{}, frame bool) (bool, error) {
+	if pos < 0 || pos > math.MaxInt32 {
+		return false, nil
+	}
+	var isnull, isout C.bool
+	var datum C.Datum
+	if frame {
+		datum = C.WinGetFuncArgInFrame(w.winobj, C.int(argno), C.int(pos), C.WINDOW_SEEK_HEAD, (C._Bool)(false), &isnull, &isout)
+	} else {
+		datum = C.WinGetFuncArgInPartition(w.winobj, C.int(argno), C.int(pos), C.WINDOW_SEEK_HEAD, (C._Bool)(false), &isnull, &isout)
+	}
+	if isout == (C._Bool)(true) {
+		return false, nil
+	}
+	return true, w.scanArg(argno, datum, isnull == (C._Bool)(true), dest)
+}
+
+//scanArg converts the argument value into dest, the pointers to pointers are set to nil for NULL,
+//the other NULL arguments keep the zero values
+func (w *WindowContext) scanArg(argno int, datum C.Datum, isnull bool, dest interface{}) error {
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("Window argument %d: %T is not an pointer", argno, dest)
+	}
+	target = target.Elem()
+	nullable := target.Kind() == reflect.Ptr
+	if isnull {
+		if nullable {
+			target.Set(reflect.Zero(target.Type()))
+		}
+		return nil
+	}
+	argOid := C.get_call_expr_argtype(w.fcinfo.flinfo.fn_expr, C.int(argno))
+	if nullable {
+		value := reflect.New(target.Type().Elem())
+		if err := scanVal(argOid, "", datum, value.Interface()); err != nil {
+			return fmt.Errorf("Window argument %d: %w", argno, err)
+		}
+		target.Set(value)
+		return nil
+	}
+	if err := scanVal(argOid, "", datum, dest); err != nil {
+		return fmt.Errorf("Window argument %d: %w", argno, err)
+	}
+	return nil
+}
+
+//scanCurrent sets the args to the arguments of the current row, the executor doesn't pass them in fcinfo
+func (w *WindowContext) scanCurrent(args ...interface{}) error {
+	for i, arg := range args {
+		if err := w.ArgCurrent(i, arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "miscadmin.h"
+#include "pgstat.h"
+#include "postmaster/bgworker.h"
+#include "postmaster/interrupt.h"
+#include "access/xact.h"
+#include "storage/ipc.h"
+#include "storage/latch.h"
+#include "utils/guc.h"
+#include "utils/memutils.h"
+#include "utils/snapmgr.h"
+
+extern int plgo_worker_run(char *name, int64 arg);
+
+PGDLLEXPORT void plgo_worker_main(Datum main_arg);
+
+void plgo_worker_main(Datum main_arg) {
+	pqsignal(SIGHUP, SignalHandlerForConfigReload);
+	pqsignal(SIGTERM, SignalHandlerForShutdownRequest);
+	BackgroundWorkerUnblockSignals();
+	proc_exit(plgo_worker_run(MyBgworkerEntry->bgw_extra, DatumGetInt64(main_arg)));
+}
+
+static void plgo_fill_worker(BackgroundWorker *worker, char *library, char *name, int restart_seconds, bool connection) {
+	MemSet(worker, 0, sizeof(BackgroundWorker));
+	worker->bgw_flags = BGWORKER_SHMEM_ACCESS;
+	if (connection)
+		worker->bgw_flags |= BGWORKER_BACKEND_DATABASE_CONNECTION;
+	worker->bgw_start_time = BgWorkerStart_RecoveryFinished;
+	worker->bgw_restart_time = restart_seconds;
+	snprintf(worker->bgw_name, BGW_MAXLEN, "plgo worker %s", name);
+	snprintf(worker->bgw_type, BGW_MAXLEN, "plgo worker %s", name);
+	strlcpy(worker->bgw_library_name, library, sizeof(worker->bgw_library_name));
+	strlcpy(worker->bgw_function_name, "plgo_worker_main", sizeof(worker->bgw_function_name));
+	strlcpy(worker->bgw_extra, name, BGW_EXTRALEN);
+	worker->bgw_main_arg = (Datum) 0;
+	worker->bgw_notify_pid = 0;
+}
+
+void plgo_register_worker(char *library, char *name, int restart_seconds, bool connection) {
+	BackgroundWorker worker;
+	plgo_fill_worker(&worker, library, name, restart_seconds, connection);
+	RegisterBackgroundWorker(&worker);
+}
+
+// plgo_start_worker starts an dynamic background worker, returns NULL if there is no free worker slot
+BackgroundWorkerHandle *plgo_start_worker(char *library, char *name, int64 arg, bool connection) {
+	BackgroundWorker worker;
+	BackgroundWorkerHandle *handle;
+	MemoryContext old;
+	bool started;
+	plgo_fill_worker(&worker, library, name, BGW_NEVER_RESTART, connection);
+	worker.bgw_main_arg = Int64GetDatum(arg);
+	worker.bgw_notify_pid = MyProcPid;
+	old = MemoryContextSwitchTo(TopMemoryContext);
+	started = RegisterDynamicBackgroundWorker(&worker, &handle);
+	MemoryContextSwitchTo(old);
+	return started ? handle : NULL;
+}
+
+int plgo_worker_status(BackgroundWorkerHandle *handle) {
+	pid_t pid;
+	return GetBackgroundWorkerPid(handle, &pid);
+}
+
+void plgo_worker_begin(void) {
+	SetCurrentStatementStartTimestamp();
+	StartTransactionCommand();
+	PushActiveSnapshot(GetTransactionSnapshot());
+}
+
+void plgo_worker_commit(void) {
+	PopActiveSnapshot();
+	CommitTransactionCommand();
+	pgstat_report_stat(false);
+	pgstat_report_activity(STATE_IDLE, NULL);
+}
+
+void plgo_worker_rollback(void) {
+	PopActiveSnapshot();
+	AbortCurrentTransaction();
+	pgstat_report_activity(STATE_IDLE, NULL);
+}
+
+bool plgo_preloading(void) {
+	return process_shared_preload_libraries_in_progress;
+}
+
+// plgo_worker_reloads counts the configuration reloads of the worker
+static uint64 plgo_worker_reloads = 0;
+
+// plgo_worker_wait waits for the latch or the timeout, returns true if shutdown was requested
+bool plgo_worker_wait(long milliseconds) {
+	(void) WaitLatch(MyLatch, WL_LATCH_SET | WL_TIMEOUT | WL_EXIT_ON_PM_DEATH,
+					 milliseconds, PG_WAIT_EXTENSION);
+	ResetLatch(MyLatch);
+	CHECK_FOR_INTERRUPTS();
+	if (ConfigReloadPending) {
+		ConfigReloadPending = false;
+		ProcessConfigFile(PGC_SIGHUP);
+		plgo_worker_reloads++;
+	}
+	return ShutdownRequestPending;
+}
+
+uint64 plgo_worker_reload_count(void) {
+	return plgo_worker_reloads;
+}
+
+bool plgo_worker_shutdown_requested(void) {
+	return ShutdownRequestPending;
+}
+
+void plgo_worker_connect(char *database, char *user) {
+	BackgroundWorkerInitializeConnection(database, user, 0);
+}
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+//extensionName is the name of the extension (and its shared library), it's set by the generated code
+var extensionName = "plgo"
+
+//worker is an background worker process running Go code
+type worker struct {
+	name string
+	//database returns the database to connect to, nil if the worker doesn't need SPI
+	database func() string
+	//restart is the delay before the postmaster restarts the crashed worker, 0 means never restart
+	restart time.Duration
+	//dynamic workers are not started with the server, they are started by startWorker
+	dynamic bool
+	main    func(ctx *workerContext) error
+}
+
+//workers are the registered background workers by name
+var workers = make(map[string]*worker)
+
+//registerWorker registers the background worker, it's started when the library is in shared_preload_libraries
+func registerWorker(w *worker) {
+	workers[w.name] = w
+}
+
+func init() {
+	onInit(func() {
+		if C.plgo_preloading() != (C._Bool)(true) {
+			return
+		}
+		clib := C.CString(extensionName)
+		defer C.free(unsafe.Pointer(clib))
+		for _, w := range workers {
+			if w.dynamic {
+				continue
+			}
+			restart := C.int(C.BGW_NEVER_RESTART)
+			if w.restart > 0 {
+				restart = C.int(w.restart / time.Second)
+			}
+			cname := C.CString(w.name)
+			C.plgo_register_worker(clib, cname, restart, (C._Bool)(w.database != nil))
+			C.free(unsafe.Pointer(cname))
+		}
+	})
+}
+
+//workerContext is passed to the main function of the background worker
+type workerContext struct {
+	worker *worker
+	//arg is the argument of an dynamic worker passed to startWorker
+	arg int64
+}
+
+//Wait waits for the timeout, or until the worker is woken up.
+//Returns false if the worker should exit
+func (ctx *workerContext) Wait(timeout time.Duration) bool {
+	return C.plgo_worker_wait(C.long(timeout/time.Millisecond)) != (C._Bool)(true)
+}
+
+//ShutdownRequested returns true if the worker got SIGTERM
+func (ctx *workerContext) ShutdownRequested() bool {
+	return C.plgo_worker_shutdown_requested() == (C._Bool)(true)
+}
+
+//Transaction runs fn in an transaction with an SPI connection, the transaction is committed if fn returns nil.
+//It can be used only in workers connected to an database
+func (ctx *workerContext) Transaction(fn func(db *DB) error) error {
+	C.plgo_worker_begin()
+	db, err := Open()
+	if err != nil {
+		C.plgo_worker_rollback()
+		return err
+	}
+	err = fn(db)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		C.plgo_worker_rollback()
+		return err
+	}
+	C.plgo_worker_commit()
+	return nil
+}
+
+//workerHandle is the handle of an started dynamic worker
+type workerHandle struct {
+	handle *C.BackgroundWorkerHandle
+}
+
+//startWorker starts the dynamic worker with the argument
+func startWorker(name string, arg int64) (*workerHandle, error) {
+	w, ok := workers[name]
+	if !ok || !w.dynamic {
+		return nil, fmt.Errorf("unknown dynamic background worker %s", name)
+	}
+	clib := C.CString(extensionName)
+	defer C.free(unsafe.Pointer(clib))
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	handle := C.plgo_start_worker(clib, cname, C.int64(arg), (C._Bool)(w.database != nil))
+	if handle == nil {
+		return nil, errors.New("no free background worker slot, increase max_worker_processes")
+	}
+	return &workerHandle{handle: handle}, nil
+}
+
+//stopped reports whether the worker exited, the handle is released then
+func (h *workerHandle) stopped() bool {
+	if h.handle == nil {
+		return true
+	}
+	if C.plgo_worker_status(h.handle) != C.BGWH_STOPPED {
+		return false
+	}
+	C.pfree(unsafe.Pointer(h.handle))
+	h.handle = nil
+	return true
+}
+
+//runWorker runs the main function of the named worker, returns the exit code of the process
+func runWorker(name string, arg int64) int {
+	w, ok := workers[name]
+	if !ok {
+		Log.Warning("unknown background worker", "worker", name)
+		return 1
+	}
+	if w.database != nil {
+		cdb := C.CString(w.database())
+		C.plgo_worker_connect(cdb, nil)
+		C.free(unsafe.Pointer(cdb))
+	}
+	if err := w.main(&workerContext{worker: w, arg: arg}); err != nil {
+		Log.Log(fmt.Sprintf("background worker %s failed", name), "error", err)
+		return 1
+	}
+	return 0
+}
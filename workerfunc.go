@@ -0,0 +1,127 @@
+package plgo
+
+/*
+#include "postgres.h"
+#include "postmaster/bgworker.h"
+
+extern bool plgo_worker_shutdown_requested(void);
+extern uint64 plgo_worker_reload_count(void);
+*/
+import "C"
+import (
+	"context"
+	"time"
+)
+
+//workersDatabase is <extension>.workers_database
+var workersDatabase *stringGUC
+
+//Worker is the background worker running an function of the package declared with //plgo:worker,
+//the function runs until it returns or the worker is shut down:
+//
+//	//plgo:worker restart=30s
+//	func Cleaner(w *plgo.Worker) error {
+//		for w.Wait(time.Minute) {
+//			if err := w.Transaction(cleanup); err != nil {
+//				plgo.Log.Warning("cleanup failed", "error", err)
+//			}
+//		}
+//		return nil
+//	}
+type Worker struct {
+	//Name is the name of the worker, the name of the function
+	Name    string
+	ctx     *workerContext
+	context context.Context
+	cancel  context.CancelFunc
+	reload  chan struct{}
+	reloads C.uint64
+}
+
+//newWorker returns the Worker of the worker process, its context is canceled on SIGTERM
+func newWorker(ctx *workerContext) *Worker {
+	w := &Worker{Name: ctx.worker.name, ctx: ctx, reload: make(chan struct{}, 1), reloads: C.plgo_worker_reload_count()}
+	w.context, w.cancel = context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(interruptPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.context.Done():
+				return
+			case <-ticker.C:
+				if C.plgo_worker_shutdown_requested() == (C._Bool)(true) {
+					w.cancel()
+					return
+				}
+			}
+		}
+	}()
+	return w
+}
+
+//Context returns the context of the worker, it's canceled when the worker gets SIGTERM
+func (w *Worker) Context() context.Context {
+	return w.context
+}
+
+//Reload returns the channel receiving after the configuration was reloaded (SIGHUP),
+//the configuration is reloaded by Wait
+func (w *Worker) Reload() <-chan struct{} {
+	return w.reload
+}
+
+//Wait waits for the timeout, or until the worker is woken up, and reloads the configuration after SIGHUP.
+//Returns false if the worker should exit
+func (w *Worker) Wait(timeout time.Duration) bool {
+	running := w.ctx.Wait(timeout)
+	if reloads := C.plgo_worker_reload_count(); reloads != w.reloads {
+		w.reloads = reloads
+		select {
+		case w.reload <- struct{}{}:
+		default:
+		}
+	}
+	if !running {
+		w.cancel()
+	}
+	return running
+}
+
+//ShutdownRequested returns true if the worker got SIGTERM
+func (w *Worker) ShutdownRequested() bool {
+	return w.ctx.ShutdownRequested()
+}
+
+//Transaction runs fn in an transaction with an SPI connection to the database of the worker,
+//the transaction is committed if fn returns nil
+func (w *Worker) Transaction(fn func(db *DB) error) error {
+	return w.ctx.Transaction(fn)
+}
+
+//registerWorkerFunc registers the function declared with //plgo:worker, it's called by the generated code.
+//The worker is restarted after the restart seconds (0 never), it connects to the database
+//or to the <extension>.workers_database if it is empty
+func registerWorkerFunc(name string, fn func(w *Worker) error, restart int, database string) {
+	databaseName := func() string { return database }
+	if database == "" {
+		if workersDatabase == nil {
+			workersDatabase = newStringGUC(gucDesc{
+				name:      "workers_database",
+				shortDesc: "Sets the database of the background workers of the extension.",
+				context:   gucPostmaster,
+			}, "postgres")
+		}
+		databaseName = func() string { return workersDatabase.get() }
+	}
+	registerWorker(&worker{
+		name:     name,
+		database: databaseName,
+		restart:  time.Duration(restart) * time.Second,
+		main: func(ctx *workerContext) error {
+			w := newWorker(ctx)
+			defer w.cancel()
+			return fn(w)
+		},
+	})
+}